@@ -0,0 +1,325 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metadata
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/uber/cherami-server/common"
+	m "github.com/uber/cherami-thrift/.generated/go/metadata"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// Destination aliases are additional rows in the destinations_by_path
+// table that carry the destination record of another (primary) path.
+// Since all rows of destinations_by_path live in the same partition
+// (directory_uuid), the uniqueness of a path across destinations and
+// aliases is guaranteed by the same lightweight transaction, and a
+// rename can be applied to the path table as a single conditional batch.
+// The set of aliases for a destination is also tracked in the aliases
+// column of the destinations table, so they can be listed by UUID.
+const (
+	opsCreateAlias = "create_alias"
+	opsDeleteAlias = "delete_alias"
+	opsRename      = "rename"
+)
+
+const (
+	sqlReadDstAliases = `SELECT ` + columnAliases +
+		` FROM ` + tableDestinations +
+		` WHERE ` + columnUUID + `=?`
+
+	sqlAddDstAlias = `UPDATE ` + tableDestinations +
+		` SET ` + columnAliases + ` = ` + columnAliases + ` + ?` +
+		` WHERE ` + columnUUID + `=?`
+
+	sqlRemoveDstAlias = `UPDATE ` + tableDestinations +
+		` SET ` + columnAliases + ` = ` + columnAliases + ` - ?` +
+		` WHERE ` + columnUUID + `=?`
+
+	sqlDeleteDstAliases = `DELETE ` + columnAliases +
+		` FROM ` + tableDestinations +
+		` WHERE ` + columnUUID + `=?`
+
+	sqlDeleteDstAliasByPath = `DELETE FROM ` + tableDestinationsByPath +
+		` WHERE ` + columnDirectoryUUID + `=? and ` + columnPath + `=? IF EXISTS`
+)
+
+// readDestinationAliases returns the aliases recorded for the given destination, sorted by path
+func (s *CassandraMetadataService) readDestinationAliases(dstUUID string) ([]string, error) {
+	var aliases []string
+	query := s.session.Query(sqlReadDstAliases, dstUUID).Consistency(s.lowConsLevel)
+	if err := query.Scan(&aliases); err != nil {
+		if err == gocql.ErrNotFound {
+			return nil, &shared.EntityNotExistsError{
+				Message: fmt.Sprintf("Destination %s does not exist", dstUUID),
+			}
+		}
+		return nil, &shared.InternalServiceError{
+			Message: err.Error(),
+		}
+	}
+	sort.Strings(aliases)
+	return aliases, nil
+}
+
+// readDestinationForAlias returns the destination that the given alias resolves to.
+// Like a read by primary path, this only succeeds if the destination is not deleted.
+func (s *CassandraMetadataService) readDestinationForAlias(dstUUID string, alias string) (*shared.DestinationDescription, error) {
+	result, err := s.ReadDestination(nil, &m.ReadDestinationRequest{DestinationUUID: common.StringPtr(dstUUID)})
+	if err != nil {
+		return nil, err
+	}
+	switch result.GetStatus() {
+	case shared.DestinationStatus_DELETING, shared.DestinationStatus_DELETED:
+		return nil, &shared.EntityNotExistsError{
+			Message: fmt.Sprintf("Destination %s does not exist", alias),
+		}
+	}
+	return result, nil
+}
+
+// readPrimaryDestination reads the destination at the given path and
+// fails if the path is an alias of some other destination
+func (s *CassandraMetadataService) readPrimaryDestination(path string) (*shared.DestinationDescription, error) {
+	existing, err := s.ReadDestination(nil, &m.ReadDestinationRequest{Path: common.StringPtr(path)})
+	if err != nil {
+		return nil, err
+	}
+	if existing.GetPath() != path {
+		return nil, &shared.BadRequestError{
+			Message: fmt.Sprintf("%v is an alias of destination %v", path, existing.GetPath()),
+		}
+	}
+	if existing.GetIsMultiZone() {
+		// multi zone destinations are reconciled by path across zones
+		return nil, &shared.BadRequestError{
+			Message: fmt.Sprintf("Aliases are not supported for multi zone destination %v", path),
+		}
+	}
+	return existing, nil
+}
+
+// bindDstType returns the bind values for sqlDstType, with the given destination path
+func bindDstType(desc *shared.DestinationDescription, path string) []interface{} {
+	return []interface{}{
+		desc.GetDestinationUUID(),
+		path,
+		desc.GetType(),
+		desc.GetStatus(),
+		desc.GetConsumedMessagesRetention(),
+		desc.GetUnconsumedMessagesRetention(),
+		desc.GetOwnerEmail(),
+		desc.GetChecksumOption(),
+		desc.GetIsMultiZone(),
+		marshalDstZoneConfigs(desc.GetZoneConfigs()),
+	}
+}
+
+// CreateDestinationAlias adds an alias path that resolves to the destination at dstPath.
+// The call is idempotent; adding an alias that already points to the same destination
+// succeeds.
+func (s *CassandraMetadataService) CreateDestinationAlias(ctx thrift.Context, dstPath string, alias string) error {
+	if common.PathDLQRegex.MatchString(alias) {
+		return &shared.BadRequestError{Message: fmt.Sprintf("CreateDestinationAlias: invalid alias %v", alias)}
+	}
+
+	existing, err := s.readPrimaryDestination(dstPath)
+	if err != nil {
+		return err
+	}
+
+	previous := make(map[string]interface{})
+	args := append([]interface{}{directoryUUID, alias, existing.GetIsMultiZone()}, bindDstType(existing, existing.GetPath())...)
+	applied, err := s.session.Query(sqlInsertDstByPath, args...).MapScanCAS(previous)
+	if err != nil {
+		return &shared.InternalServiceError{
+			Message: fmt.Sprintf("CreateDestinationAlias failure while inserting into destinations_by_path: %v", err),
+		}
+	}
+	if !applied {
+		// retry of a previously failed attempt
+		current, errRead := s.ReadDestination(nil, &m.ReadDestinationRequest{Path: common.StringPtr(alias)})
+		if errRead != nil || current.GetDestinationUUID() != existing.GetDestinationUUID() || current.GetPath() == alias {
+			return &shared.EntityAlreadyExistsError{
+				Message: fmt.Sprintf("CreateDestinationAlias: path %v already exists", alias),
+			}
+		}
+	}
+
+	if err = s.session.Query(sqlAddDstAlias, []string{alias}, existing.GetDestinationUUID()).Exec(); err != nil {
+		return &shared.InternalServiceError{
+			Message: fmt.Sprintf("CreateDestinationAlias failure while updating destinations: %v", err),
+		}
+	}
+
+	s.recordUserOperation(
+		alias,
+		existing.GetDestinationUUID(),
+		entityTypeDst,
+		getThriftContextValue(ctx, common.CallerUserName),
+		"", //place holder for user's email
+		getThriftContextValue(ctx, common.CallerServiceName),
+		getThriftContextValue(ctx, common.CallerHostName),
+		opsCreateAlias,
+		time.Now(),
+		marshalRequest(map[string]string{"path": dstPath, "alias": alias}))
+
+	return nil
+}
+
+// DeleteDestinationAlias removes the given alias. The destination itself is not affected.
+func (s *CassandraMetadataService) DeleteDestinationAlias(ctx thrift.Context, alias string) error {
+	existing, err := s.ReadDestination(nil, &m.ReadDestinationRequest{Path: common.StringPtr(alias)})
+	if err != nil {
+		return err
+	}
+	if existing.GetPath() == alias {
+		return &shared.BadRequestError{
+			Message: fmt.Sprintf("DeleteDestinationAlias: %v is not an alias, use DeleteDestination instead", alias),
+		}
+	}
+
+	previous := make(map[string]interface{})
+	if _, err = s.session.Query(sqlDeleteDstAliasByPath, directoryUUID, alias).MapScanCAS(previous); err != nil {
+		return &shared.InternalServiceError{
+			Message: fmt.Sprintf("DeleteDestinationAlias failure while deleting from destinations_by_path: %v", err),
+		}
+	}
+
+	if err = s.session.Query(sqlRemoveDstAlias, []string{alias}, existing.GetDestinationUUID()).Exec(); err != nil {
+		return &shared.InternalServiceError{
+			Message: fmt.Sprintf("DeleteDestinationAlias failure while updating destinations: %v", err),
+		}
+	}
+
+	s.recordUserOperation(
+		alias,
+		existing.GetDestinationUUID(),
+		entityTypeDst,
+		getThriftContextValue(ctx, common.CallerUserName),
+		"", //place holder for user's email
+		getThriftContextValue(ctx, common.CallerServiceName),
+		getThriftContextValue(ctx, common.CallerHostName),
+		opsDeleteAlias,
+		time.Now(),
+		marshalRequest(map[string]string{"alias": alias}))
+
+	return nil
+}
+
+// ListDestinationAliases returns the aliases of the destination at the given path,
+// which may itself be an alias
+func (s *CassandraMetadataService) ListDestinationAliases(ctx thrift.Context, path string) ([]string, error) {
+	existing, err := s.ReadDestination(nil, &m.ReadDestinationRequest{Path: common.StringPtr(path)})
+	if err != nil {
+		return nil, err
+	}
+	return s.readDestinationAliases(existing.GetDestinationUUID())
+}
+
+// RenameDestination moves the primary path of a destination to newPath and keeps
+// the old path as an alias, so that publishers and consumers can move over at
+// their own pace. The switch in destinations_by_path is done as one conditional
+// batch, i.e. either both paths resolve to the destination afterwards or nothing
+// changed. If the follow-up update of the destinations table fails, the call can
+// be safely retried.
+func (s *CassandraMetadataService) RenameDestination(ctx thrift.Context, path string, newPath string) (*shared.DestinationDescription, error) {
+	if common.PathDLQRegex.MatchString(newPath) {
+		return nil, &shared.BadRequestError{Message: fmt.Sprintf("RenameDestination: invalid path %v", newPath)}
+	}
+
+	existing, err := s.ReadDestination(nil, &m.ReadDestinationRequest{Path: common.StringPtr(path)})
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.GetPath() == newPath {
+		// a previous attempt already switched the path table
+		if err = s.completeRename(existing, path); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+
+	if existing, err = s.readPrimaryDestination(path); err != nil {
+		return nil, err
+	}
+
+	batch := s.session.NewBatch(gocql.LoggedBatch)
+	batch.Query(sqlInsertDstByPath, append([]interface{}{directoryUUID, newPath, existing.GetIsMultiZone()}, bindDstType(existing, newPath)...)...)
+	batch.Query(sqlUpdateDstByPath, append(bindDstType(existing, newPath), path, directoryUUID)...)
+
+	previous := make(map[string]interface{})
+	applied, iter, err := s.session.MapExecuteBatchCAS(batch, previous)
+	if iter != nil {
+		iter.Close()
+	}
+	if err != nil {
+		return nil, &shared.InternalServiceError{
+			Message: fmt.Sprintf("RenameDestination failure while updating destinations_by_path: %v", err),
+		}
+	}
+	if !applied {
+		return nil, &shared.EntityAlreadyExistsError{
+			Message: fmt.Sprintf("RenameDestination: path %v already exists", newPath),
+		}
+	}
+
+	existing.Path = common.StringPtr(newPath)
+	if err = s.completeRename(existing, path); err != nil {
+		return nil, err
+	}
+
+	s.recordUserOperation(
+		newPath,
+		existing.GetDestinationUUID(),
+		entityTypeDst,
+		getThriftContextValue(ctx, common.CallerUserName),
+		"", //place holder for user's email
+		getThriftContextValue(ctx, common.CallerServiceName),
+		getThriftContextValue(ctx, common.CallerHostName),
+		opsRename,
+		time.Now(),
+		marshalRequest(map[string]string{"path": path, "newPath": newPath}))
+
+	return existing, nil
+}
+
+// completeRename updates the destinations table after the path table has been
+// switched over to the new primary path of the destination
+func (s *CassandraMetadataService) completeRename(desc *shared.DestinationDescription, oldPath string) error {
+	batch := s.session.NewBatch(gocql.LoggedBatch)
+	batch.Query(sqlUpdateDstByUUID, append(bindDstType(desc, desc.GetPath()), desc.GetDestinationUUID())...)
+	batch.Query(sqlAddDstAlias, []string{oldPath}, desc.GetDestinationUUID())
+	batch.Query(sqlRemoveDstAlias, []string{desc.GetPath()}, desc.GetDestinationUUID())
+
+	if err := s.session.ExecuteBatch(batch); err != nil {
+		return &shared.InternalServiceError{
+			Message: fmt.Sprintf("RenameDestination failure while updating destinations: %v", err),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metadata
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// The retention overrides of consumer groups are kept apart from the
+// consumer group descriptions, in the consumer_group_retention table,
+// keyed by the consumer group uuid. A consumer group without a row has
+// no override, its ack level counts towards the retention of the
+// destination as usual.
+const (
+	tableConsumerGroupRetention = "consumer_group_retention"
+
+	columnExcludeAfterInactiveSeconds = "exclude_after_inactive_seconds"
+	columnProtect                     = "protect"
+
+	sqlConsumerGroupRetentionColumns = columnConsumerGroupUUID + `, ` +
+		columnExcludeAfterInactiveSeconds + `, ` +
+		columnProtect + `, ` +
+		columnUpdatedTime
+
+	sqlPutConsumerGroupRetention = `INSERT INTO ` + tableConsumerGroupRetention +
+		` (` + sqlConsumerGroupRetentionColumns + `)` +
+		` VALUES (?, ?, ?, ?)`
+
+	sqlGetConsumerGroupRetention = `SELECT ` + sqlConsumerGroupRetentionColumns +
+		` FROM ` + tableConsumerGroupRetention +
+		` WHERE ` + columnConsumerGroupUUID + `=?`
+
+	sqlDeleteConsumerGroupRetention = `DELETE FROM ` + tableConsumerGroupRetention +
+		` WHERE ` + columnConsumerGroupUUID + `=?`
+
+	// the outputhosts only write the ack level of a consumer group extent
+	// when it moves, so its write time is the time of the last ack
+	sqlGetConsumerGroupAckWriteTimes = `SELECT WRITETIME(` + columnAckLevelOffset + `)` +
+		` FROM ` + tableConsumerGroupExtents +
+		` WHERE ` + columnConsumerGroupUUID + `=?`
+)
+
+// ConsumerGroupRetention is the retention override of a consumer group
+type ConsumerGroupRetention struct {
+	ConsumerGroupUUID string
+	// ExcludeAfterInactive, when set, excludes the consumer group from
+	// the soft retention of its destination once it has not acked
+	// anything for that long
+	ExcludeAfterInactive time.Duration
+	// Protect keeps the messages the consumer group has not acked yet,
+	// even past the hard retention of its destination
+	Protect     bool
+	UpdatedTime time.Time
+}
+
+func scanConsumerGroupRetention(scanner interface {
+	Scan(dest ...interface{}) bool
+}) *ConsumerGroupRetention {
+	retention := &ConsumerGroupRetention{}
+	var id gocql.UUID
+	var excludeAfterInactiveSecs int64
+	if !scanner.Scan(&id, &excludeAfterInactiveSecs, &retention.Protect, &retention.UpdatedTime) {
+		return nil
+	}
+	retention.ConsumerGroupUUID = id.String()
+	retention.ExcludeAfterInactive = time.Duration(excludeAfterInactiveSecs) * time.Second
+	return retention
+}
+
+// SetConsumerGroupRetention sets the retention override of a consumer
+// group, an override that neither excludes nor protects it is removed
+func (s *CassandraMetadataService) SetConsumerGroupRetention(ctx thrift.Context, retention *ConsumerGroupRetention) error {
+
+	if len(retention.ConsumerGroupUUID) == 0 {
+		return &shared.BadRequestError{
+			Message: "SetConsumerGroupRetention: consumer group uuid must be set",
+		}
+	}
+
+	if retention.ExcludeAfterInactive < 0 {
+		return &shared.BadRequestError{
+			Message: "SetConsumerGroupRetention: inactivity period cannot be negative",
+		}
+	}
+
+	if retention.Protect && retention.ExcludeAfterInactive > 0 {
+		return &shared.BadRequestError{
+			Message: "SetConsumerGroupRetention: a consumer group cannot be both protected and excluded when inactive",
+		}
+	}
+
+	var query *gocql.Query
+	if !retention.Protect && retention.ExcludeAfterInactive == 0 {
+		query = s.session.Query(sqlDeleteConsumerGroupRetention, retention.ConsumerGroupUUID)
+	} else {
+		query = s.session.Query(sqlPutConsumerGroupRetention,
+			retention.ConsumerGroupUUID,
+			int64(retention.ExcludeAfterInactive/time.Second),
+			retention.Protect,
+			retention.UpdatedTime)
+	}
+
+	if err := query.Consistency(s.midConsLevel).Exec(); err != nil {
+		return &shared.InternalServiceError{
+			Message: fmt.Sprintf("SetConsumerGroupRetention: %v", err),
+		}
+	}
+	return nil
+}
+
+// ReadConsumerGroupRetention returns the retention override of a
+// consumer group, or EntityNotExistsError if it has none
+func (s *CassandraMetadataService) ReadConsumerGroupRetention(ctx thrift.Context, cgUUID string) (*ConsumerGroupRetention, error) {
+
+	query := s.session.Query(sqlGetConsumerGroupRetention, cgUUID).Consistency(s.lowConsLevel)
+	iter := query.Iter()
+	retention := scanConsumerGroupRetention(iter)
+	if err := iter.Close(); err != nil {
+		return nil, &shared.InternalServiceError{
+			Message: fmt.Sprintf("ReadConsumerGroupRetention: %v", err),
+		}
+	}
+	if retention == nil {
+		return nil, &shared.EntityNotExistsError{
+			Message: fmt.Sprintf("Consumer group %v has no retention override", cgUUID),
+		}
+	}
+	return retention, nil
+}
+
+// ReadConsumerGroupLastAckTime returns the last time the consumer group
+// moved its ack level on any of its extents, or the zero time if it
+// never acked anything
+func (s *CassandraMetadataService) ReadConsumerGroupLastAckTime(ctx thrift.Context, cgUUID string) (time.Time, error) {
+
+	iter := s.session.Query(sqlGetConsumerGroupAckWriteTimes, cgUUID).Consistency(s.lowConsLevel).Iter()
+
+	var lastAckTime time.Time
+	var writeTime int64 // in microseconds; zero when the ack level was never written
+	for iter.Scan(&writeTime) {
+		if t := time.Unix(0, writeTime*int64(time.Microsecond)); writeTime > 0 && t.After(lastAckTime) {
+			lastAckTime = t
+		}
+		writeTime = 0
+	}
+	if err := iter.Close(); err != nil {
+		return time.Time{}, &shared.InternalServiceError{
+			Message: fmt.Sprintf("ReadConsumerGroupLastAckTime: %v", err),
+		}
+	}
+	return lastAckTime, nil
+}
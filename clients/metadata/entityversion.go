@@ -0,0 +1,132 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metadata
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// Multi-zone destinations and consumer groups can be updated in any zone,
+// the replicators resolve conflicting updates with the version of the
+// entity kept in the multi_zone_entity_versions table, keyed by the uuid
+// of the destination or consumer group. An entity without a row was never
+// updated since versions were introduced. Versions are read, merged and
+// written back, the write is conditioned on the vector that was read so
+// that concurrent writers don't lose each other's updates.
+const (
+	tableMultiZoneEntityVersions = "multi_zone_entity_versions"
+
+	columnVersionVector = "version_vector"
+	columnUpdatedZone   = "updated_zone"
+
+	sqlMultiZoneEntityVersionColumns = columnEntityUUID + `, ` +
+		columnVersionVector + `, ` +
+		columnUpdatedZone + `, ` +
+		columnUpdatedTime
+
+	sqlInsertMultiZoneEntityVersion = `INSERT INTO ` + tableMultiZoneEntityVersions +
+		` (` + sqlMultiZoneEntityVersionColumns + `)` +
+		` VALUES (?, ?, ?, ?) IF NOT EXISTS`
+
+	sqlUpdateMultiZoneEntityVersion = `UPDATE ` + tableMultiZoneEntityVersions +
+		` SET ` + columnVersionVector + `=?, ` + columnUpdatedZone + `=?, ` + columnUpdatedTime + `=?` +
+		` WHERE ` + columnEntityUUID + `=?` +
+		` IF ` + columnVersionVector + `=?`
+
+	sqlGetMultiZoneEntityVersion = `SELECT ` + sqlMultiZoneEntityVersionColumns +
+		` FROM ` + tableMultiZoneEntityVersions +
+		` WHERE ` + columnEntityUUID + `=?`
+)
+
+// EntityVersion is the version of a multi-zone destination or consumer group
+type EntityVersion struct {
+	EntityUUID string
+	// Vector counts the updates made to the entity in each zone
+	Vector map[string]int64
+	// UpdatedZone and UpdatedTime are the zone and time of the update
+	// that won, they break the tie between concurrent updates
+	UpdatedZone string
+	UpdatedTime time.Time
+}
+
+// ReadEntityVersion returns the version of a multi-zone entity, or
+// EntityNotExistsError if it has none
+func (s *CassandraMetadataService) ReadEntityVersion(ctx thrift.Context, entityUUID string) (*EntityVersion, error) {
+
+	version := &EntityVersion{}
+	var id gocql.UUID
+	query := s.session.Query(sqlGetMultiZoneEntityVersion, entityUUID).Consistency(s.midConsLevel)
+	if err := query.Scan(&id, &version.Vector, &version.UpdatedZone, &version.UpdatedTime); err != nil {
+		if err == gocql.ErrNotFound {
+			return nil, &shared.EntityNotExistsError{
+				Message: fmt.Sprintf("Entity %v has no multi-zone version", entityUUID),
+			}
+		}
+		return nil, &shared.InternalServiceError{
+			Message: fmt.Sprintf("ReadEntityVersion: %v", err),
+		}
+	}
+	version.EntityUUID = id.String()
+	return version, nil
+}
+
+// WriteEntityVersion sets the version of a multi-zone entity, merged by
+// the caller with the previous version it read, nil if it had none. It
+// returns false, without writing, if the version changed since it was read;
+// the caller is expected to read it again and retry.
+func (s *CassandraMetadataService) WriteEntityVersion(ctx thrift.Context, version *EntityVersion, previous *EntityVersion) (bool, error) {
+
+	if len(version.EntityUUID) == 0 || len(version.Vector) == 0 {
+		return false, &shared.BadRequestError{
+			Message: "WriteEntityVersion: entity uuid and version vector must be set",
+		}
+	}
+
+	var query *gocql.Query
+	if previous == nil {
+		query = s.session.Query(sqlInsertMultiZoneEntityVersion,
+			version.EntityUUID,
+			version.Vector,
+			version.UpdatedZone,
+			version.UpdatedTime)
+	} else {
+		query = s.session.Query(sqlUpdateMultiZoneEntityVersion,
+			version.Vector,
+			version.UpdatedZone,
+			version.UpdatedTime,
+			version.EntityUUID,
+			previous.Vector)
+	}
+
+	previousRow := make(map[string]interface{}) // We actually throw away the old values below, but passing nil causes a panic
+	applied, err := query.Consistency(s.midConsLevel).MapScanCAS(previousRow)
+	if err != nil {
+		return false, &shared.InternalServiceError{
+			Message: fmt.Sprintf("WriteEntityVersion: %v", err),
+		}
+	}
+	return applied, nil
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metadata
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// The event journal keeps the controller events that are not done yet,
+// so that they can be replayed if the controller handling them goes
+// away. The events of a journal are partitioned by the controller that
+// journaled them and by a bucket of time chosen by that controller, so
+// that the deletes of a busy controller don't pile up as tombstones in
+// the partitions that have to be read to replay the events of the
+// controllers that went away. The partitions that have events are kept
+// in the controller_event_partitions table. Rows expire after
+// eventJournalTTLSeconds, so that events that are stuck for good don't
+// pile up forever.
+const (
+	tableControllerEvents          = "controller_events"
+	tableControllerEventPartitions = "controller_event_partitions"
+
+	columnJournal     = "journal"
+	columnBucket      = "bucket"
+	columnEventUUID   = "event_uuid"
+	columnPayload     = "payload"
+	columnState       = "state"
+	columnAttempts    = "attempts"
+	columnLastError   = "last_error"
+	columnUpdatedTime = "updated_time"
+
+	eventJournalTTLSeconds = 7 * 24 * 3600
+
+	sqlJournalEventColumns = columnEventUUID + `, ` +
+		columnType + `, ` +
+		columnPayload + `, ` +
+		columnState + `, ` +
+		columnAttempts + `, ` +
+		columnLastError + `, ` +
+		columnCreatedTime + `, ` +
+		columnUpdatedTime
+
+	sqlJournalPartitionKey = columnJournal + `=? AND ` + columnOwner + `=? AND ` + columnBucket + `=?`
+
+	sqlPutJournalEvent = `INSERT INTO ` + tableControllerEvents +
+		` (` + columnJournal + `, ` + columnOwner + `, ` + columnBucket + `, ` + sqlJournalEventColumns + `)` +
+		` VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) USING TTL ?`
+
+	sqlListJournalEvents = `SELECT ` + sqlJournalEventColumns +
+		` FROM ` + tableControllerEvents +
+		` WHERE ` + sqlJournalPartitionKey
+
+	sqlGetJournalEvent = sqlListJournalEvents + ` AND ` + columnEventUUID + `=?`
+
+	sqlDeleteJournalEvent = `DELETE FROM ` + tableControllerEvents +
+		` WHERE ` + sqlJournalPartitionKey + ` AND ` + columnEventUUID + `=?`
+
+	sqlPutJournalPartition = `INSERT INTO ` + tableControllerEventPartitions +
+		` (` + columnJournal + `, ` + columnOwner + `, ` + columnBucket + `)` +
+		` VALUES (?, ?, ?) USING TTL ?`
+
+	sqlListJournalPartitions = `SELECT ` + columnOwner + `, ` + columnBucket +
+		` FROM ` + tableControllerEventPartitions +
+		` WHERE ` + columnJournal + `=?`
+
+	sqlDeleteJournalPartition = `DELETE FROM ` + tableControllerEventPartitions +
+		` WHERE ` + sqlJournalPartitionKey
+)
+
+type (
+	// JournalPartition is the partition of the events journaled
+	// by one controller within one bucket of time
+	JournalPartition struct {
+		Owner  string
+		Bucket int64
+	}
+
+	// JournalEvent is an event saved in the controller event journal
+	JournalEvent struct {
+		JournalPartition
+		ID          string
+		Type        string
+		Payload     string
+		State       string
+		Attempts    int
+		LastError   string
+		CreatedTime time.Time
+		UpdatedTime time.Time
+	}
+)
+
+func scanJournalEvent(partition JournalPartition, scanner interface {
+	Scan(dest ...interface{}) bool
+}) *JournalEvent {
+	event := &JournalEvent{JournalPartition: partition}
+	var id gocql.UUID
+	if !scanner.Scan(&id, &event.Type, &event.Payload, &event.State, &event.Attempts, &event.LastError, &event.CreatedTime, &event.UpdatedTime) {
+		return nil
+	}
+	event.ID = id.String()
+	return event
+}
+
+// WriteJournalEvents adds or overwrites the given events, and removes
+// the given deleted events from the journal, with one batch per partition
+func (s *CassandraMetadataService) WriteJournalEvents(ctx thrift.Context, journal string, events []*JournalEvent, deleted []*JournalEvent) error {
+
+	if len(journal) == 0 {
+		return &shared.BadRequestError{
+			Message: "WriteJournalEvents: journal must be set",
+		}
+	}
+
+	batches := make(map[JournalPartition]*gocql.Batch)
+	getBatch := func(partition JournalPartition) *gocql.Batch {
+		batch, ok := batches[partition]
+		if !ok {
+			// all the writes of a batch go to the same partition
+			batch = s.session.NewBatch(gocql.UnloggedBatch)
+			batch.Cons = s.midConsLevel
+			batches[partition] = batch
+		}
+		return batch
+	}
+
+	for _, event := range events {
+		if len(event.Owner) == 0 || len(event.ID) == 0 || len(event.Type) == 0 {
+			return &shared.BadRequestError{
+				Message: "WriteJournalEvents: event owner, id and type must be set",
+			}
+		}
+		getBatch(event.JournalPartition).Query(sqlPutJournalEvent,
+			journal,
+			event.Owner,
+			event.Bucket,
+			event.ID,
+			event.Type,
+			event.Payload,
+			event.State,
+			event.Attempts,
+			event.LastError,
+			event.CreatedTime,
+			event.UpdatedTime,
+			eventJournalTTLSeconds)
+	}
+
+	for _, event := range deleted {
+		getBatch(event.JournalPartition).Query(sqlDeleteJournalEvent, journal, event.Owner, event.Bucket, event.ID)
+	}
+
+	for _, batch := range batches {
+		if err := s.session.ExecuteBatch(batch); err != nil {
+			return &shared.InternalServiceError{
+				Message: fmt.Sprintf("WriteJournalEvents: %v", err),
+			}
+		}
+	}
+	return nil
+}
+
+// ReadJournalEvent returns the given event of the journal
+func (s *CassandraMetadataService) ReadJournalEvent(ctx thrift.Context, journal string, partition JournalPartition, eventID string) (*JournalEvent, error) {
+
+	query := s.session.Query(sqlGetJournalEvent, journal, partition.Owner, partition.Bucket, eventID).Consistency(s.midConsLevel)
+	iter := query.Iter()
+	event := scanJournalEvent(partition, iter)
+	if err := iter.Close(); err != nil {
+		return nil, &shared.InternalServiceError{
+			Message: fmt.Sprintf("ReadJournalEvent: %v", err),
+		}
+	}
+	if event == nil {
+		return nil, &shared.EntityNotExistsError{
+			Message: fmt.Sprintf("Event %v does not exist in journal %v", eventID, journal),
+		}
+	}
+	return event, nil
+}
+
+// ListJournalEvents returns the events of the given partition of the journal
+func (s *CassandraMetadataService) ListJournalEvents(ctx thrift.Context, journal string, partition JournalPartition) ([]*JournalEvent, error) {
+
+	iter := s.session.Query(sqlListJournalEvents, journal, partition.Owner, partition.Bucket).Consistency(s.lowConsLevel).Iter()
+
+	var events []*JournalEvent
+	for event := scanJournalEvent(partition, iter); event != nil; event = scanJournalEvent(partition, iter) {
+		events = append(events, event)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, &shared.InternalServiceError{
+			Message: fmt.Sprintf("ListJournalEvents: %v", err),
+		}
+	}
+	return events, nil
+}
+
+// PutJournalPartition records that the given partition of the journal has events
+func (s *CassandraMetadataService) PutJournalPartition(ctx thrift.Context, journal string, partition JournalPartition) error {
+
+	if len(journal) == 0 || len(partition.Owner) == 0 {
+		return &shared.BadRequestError{
+			Message: "PutJournalPartition: journal and owner must be set",
+		}
+	}
+
+	query := s.session.Query(sqlPutJournalPartition, journal, partition.Owner, partition.Bucket, eventJournalTTLSeconds).Consistency(s.midConsLevel)
+	if err := query.Exec(); err != nil {
+		return &shared.InternalServiceError{
+			Message: fmt.Sprintf("PutJournalPartition: %v", err),
+		}
+	}
+	return nil
+}
+
+// ListJournalPartitions returns the partitions of the journal that have events
+func (s *CassandraMetadataService) ListJournalPartitions(ctx thrift.Context, journal string) ([]JournalPartition, error) {
+
+	iter := s.session.Query(sqlListJournalPartitions, journal).Consistency(s.lowConsLevel).Iter()
+
+	var partitions []JournalPartition
+	var partition JournalPartition
+	for iter.Scan(&partition.Owner, &partition.Bucket) {
+		partitions = append(partitions, partition)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, &shared.InternalServiceError{
+			Message: fmt.Sprintf("ListJournalPartitions: %v", err),
+		}
+	}
+	return partitions, nil
+}
+
+// DeleteJournalPartition forgets the given partition of the journal, it
+// is meant for partitions that have no events left
+func (s *CassandraMetadataService) DeleteJournalPartition(ctx thrift.Context, journal string, partition JournalPartition) error {
+
+	query := s.session.Query(sqlDeleteJournalPartition, journal, partition.Owner, partition.Bucket).Consistency(s.midConsLevel)
+	if err := query.Exec(); err != nil {
+		return &shared.InternalServiceError{
+			Message: fmt.Sprintf("DeleteJournalPartition: %v", err),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metadata
+
+import (
+	"fmt"
+
+	"github.com/gocql/gocql"
+	"github.com/uber/cherami-server/common"
+	m "github.com/uber/cherami-thrift/.generated/go/metadata"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// The store list of an extent is denormalized into destination_extents,
+// input_host_extents and store_extents. Replacing a replica rewrites the
+// extent in all of them, moves the replica stats over to the new store and
+// drops the store_extents row of the old store, so that the extent no
+// longer shows up when listing the extents of the old store.
+const (
+	sqlDeleteDstExtentReplicaStats = `DELETE ` + columnReplicaStats + `[?] FROM ` + tableDestinationExtents +
+		` WHERE ` + columnDestinationUUID + `=? AND ` + columnExtentUUID + `=?`
+
+	sqlDeleteInputHostExtentReplicaStats = `DELETE ` + columnReplicaStats + `[?] FROM ` + tableInputHostExtents +
+		` WHERE ` + columnDestinationUUID + `=? AND ` + columnInputHostUUID + `=? AND ` + columnExtentUUID + `=?`
+
+	sqlDeleteStoreExtentRow = `DELETE FROM ` + tableStoreExtents +
+		` WHERE ` + columnStoreUUID + `=? AND ` + columnExtentUUID + `=?`
+)
+
+// ReplaceExtentStore replaces oldStoreUUID with newStoreUUID in the store list of
+// the given extent. It is a no-op if the replacement was already done.
+func (s *CassandraMetadataService) ReplaceExtentStore(ctx thrift.Context, dstUUID string, extentUUID string, oldStoreUUID string, newStoreUUID string) (*shared.ExtentStats, error) {
+
+	if len(dstUUID) == 0 || len(extentUUID) == 0 || len(oldStoreUUID) == 0 || len(newStoreUUID) == 0 {
+		return nil, &shared.BadRequestError{
+			Message: "ReplaceExtentStore: some required request field is not set",
+		}
+	}
+
+	result, err := s.ReadExtentStats(ctx, &m.ReadExtentStatsRequest{
+		DestinationUUID: common.StringPtr(dstUUID),
+		ExtentUUID:      common.StringPtr(extentUUID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := result.GetExtentStats()
+	extent := stats.GetExtent()
+
+	var hasOld, hasNew bool
+	storeIDs := make([]string, 0, len(extent.GetStoreUUIDs()))
+	for _, id := range extent.GetStoreUUIDs() {
+		switch id {
+		case oldStoreUUID:
+			hasOld = true
+			continue
+		case newStoreUUID:
+			hasNew = true
+		}
+		storeIDs = append(storeIDs, id)
+	}
+
+	switch {
+	case !hasOld && hasNew:
+		return stats, nil // already replaced
+	case !hasOld:
+		return nil, &shared.BadRequestError{
+			Message: fmt.Sprintf("ReplaceExtentStore: store %v is not a replica of extent %v", oldStoreUUID, extentUUID),
+		}
+	case hasNew:
+		return nil, &shared.BadRequestError{
+			Message: fmt.Sprintf("ReplaceExtentStore: store %v is already a replica of extent %v", newStoreUUID, extentUUID),
+		}
+	}
+
+	extent.StoreUUIDs = append(storeIDs, newStoreUUID)
+	status := stats.GetStatus()
+
+	batch := s.session.NewBatch(gocql.LoggedBatch)
+	batch.Cons = s.midConsLevel
+
+	batch.Query(
+		sqlUpdateDstExtents,
+		status,
+		extent.GetOriginZone(),
+		stats.GetStatusUpdatedTimeMillis(),
+		extent.GetExtentUUID(),
+		extent.GetDestinationUUID(),
+		extent.GetStoreUUIDs(),
+		extent.GetInputHostUUID(),
+		extent.GetOriginZone(),
+		extent.GetRemoteExtentPrimaryStore(),
+		status,
+		stats.GetArchivalLocation(),
+		dstUUID,
+		extentUUID,
+	)
+	batch.Query(sqlDeleteDstExtentReplicaStats, oldStoreUUID, dstUUID, extentUUID)
+
+	batch.Query(
+		sqlUpdateInputHostExtents,
+		status,
+		extent.GetExtentUUID(),
+		extent.GetDestinationUUID(),
+		extent.GetStoreUUIDs(),
+		extent.GetInputHostUUID(),
+		extent.GetOriginZone(),
+		extent.GetRemoteExtentPrimaryStore(),
+		status,
+		stats.GetArchivalLocation(),
+		dstUUID,
+		extent.GetInputHostUUID(),
+		extentUUID,
+	)
+	batch.Query(sqlDeleteInputHostExtentReplicaStats, oldStoreUUID, dstUUID, extent.GetInputHostUUID(), extentUUID)
+
+	for _, storeID := range storeIDs {
+		batch.Query(
+			sqlUpdateStoreExtents,
+			status,
+			extent.GetExtentUUID(),
+			extent.GetDestinationUUID(),
+			extent.GetStoreUUIDs(),
+			extent.GetInputHostUUID(),
+			extent.GetOriginZone(),
+			extent.GetRemoteExtentPrimaryStore(),
+			status,
+			stats.GetArchivalLocation(),
+			storeID,
+			extentUUID,
+		)
+	}
+
+	replicationStatus := shared.ExtentReplicaReplicationStatus_INVALID
+	if len(extent.GetOriginZone()) > 0 {
+		replicationStatus = shared.ExtentReplicaReplicationStatus_PENDING
+	}
+
+	// the new replica starts out empty, the store host reports
+	// the real stats once the replication is under way
+	batch.Query(
+		sqlInsertStoreExent,
+		newStoreUUID,
+		extentUUID,
+		status,
+		stats.GetCreatedTimeMillis(),
+		replicationStatus,
+		extent.GetExtentUUID(),
+		extent.GetDestinationUUID(),
+		extent.GetStoreUUIDs(),
+		extent.GetInputHostUUID(),
+		extent.GetOriginZone(),
+		extent.GetRemoteExtentPrimaryStore(),
+		status,
+		map[string]interface{}{
+			columnExtentUUID:            extentUUID,
+			columnStoreUUID:             newStoreUUID,
+			columnDestinationUUID:       dstUUID,
+			columnAvailableAddress:      0,
+			columnAvailableSequence:     0,
+			columnAvailableSequenceRate: 0.0,
+			columnBeginAddress:          0,
+			columnLastAddress:           0,
+			columnBeginSequence:         0,
+			columnLastSequence:          0,
+			columnLastSequenceRate:      0.0,
+			columnBeginEnqueueTime:      nil,
+			columnLastEnqueueTime:       nil,
+			columnSizeInBytes:           0,
+			columnSizeInBytesRate:       0.0,
+			columnStatus:                shared.ExtentReplicaStatus_OPEN,
+			columnBeginTime:             nil,
+			columnCreatedTime:           nil,
+			columnEndTime:               nil,
+			columnStore:                 "ManyRocks", // FIXME: hardcoded for now
+			columnStoreVersion:          "0.2",       // FIXME: hardcoded for now
+		},
+	)
+
+	batch.Query(sqlDeleteStoreExtentRow, oldStoreUUID, extentUUID)
+
+	if err = s.session.ExecuteBatch(batch); err != nil {
+		return nil, &shared.InternalServiceError{
+			Message: "ReplaceExtentStore: " + err.Error(),
+		}
+	}
+
+	replicaStats := make([]*shared.ExtentReplicaStats, 0, len(stats.GetReplicaStats()))
+	for _, r := range stats.GetReplicaStats() {
+		if r.GetStoreUUID() != oldStoreUUID {
+			replicaStats = append(replicaStats, r)
+		}
+	}
+	stats.ReplicaStats = replicaStats
+	return stats, nil
+}
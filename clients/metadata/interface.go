@@ -21,8 +21,11 @@
 package metadata
 
 import (
+	"time"
+
 	m "github.com/uber/cherami-thrift/.generated/go/metadata"
 	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
 )
 
 type (
@@ -49,4 +52,67 @@ type (
 		DeleteServiceConfig(request *m.DeleteServiceConfigRequest) error
 		ListEntityOps(request *m.ListEntityOpsRequest) (*m.ListEntityOpsResult_, error)
 	}
+
+	// DestinationAliasService exposes the management of destination
+	// aliases and renames, which are not part of the thrift metadata API
+	DestinationAliasService interface {
+		CreateDestinationAlias(ctx thrift.Context, path string, alias string) error
+		DeleteDestinationAlias(ctx thrift.Context, alias string) error
+		ListDestinationAliases(ctx thrift.Context, path string) ([]string, error)
+		RenameDestination(ctx thrift.Context, path string, newPath string) (*shared.DestinationDescription, error)
+	}
+
+	// DestinationSchemaService exposes the versioned schemas of destinations.
+	// The first version can be given to CreateDestination, later versions are
+	// added through this interface and must be compatible with the latest one.
+	DestinationSchemaService interface {
+		CreateDestinationSchema(ctx thrift.Context, dstUUID string, schema *shared.SchemaInfo) (*shared.SchemaInfo, error)
+		ReadDestinationSchema(ctx thrift.Context, dstUUID string, version int32) (*shared.SchemaInfo, error)
+		ListDestinationSchemas(ctx thrift.Context, dstUUID string) ([]*shared.SchemaInfo, error)
+	}
+
+	// ExtentReplicaService exposes the replacement of a replica in the store
+	// list of an extent, used when re-replicating the extents of a lost store
+	ExtentReplicaService interface {
+		ReplaceExtentStore(ctx thrift.Context, dstUUID string, extentUUID string, oldStoreUUID string, newStoreUUID string) (*shared.ExtentStats, error)
+	}
+
+	// LeaseService exposes named leases that expire unless renewed by their
+	// owner, used to elect the single owner of work that must not run twice
+	LeaseService interface {
+		AcquireLease(ctx thrift.Context, name string, owner string, ttl time.Duration) (*Lease, error)
+		ReleaseLease(ctx thrift.Context, name string, owner string) error
+		ReadLease(ctx thrift.Context, name string) (*Lease, error)
+	}
+
+	// EventJournalService exposes the journal of controller events that
+	// are not done yet, used to replay them after a controller goes away
+	EventJournalService interface {
+		WriteJournalEvents(ctx thrift.Context, journal string, events []*JournalEvent, deleted []*JournalEvent) error
+		ReadJournalEvent(ctx thrift.Context, journal string, partition JournalPartition, eventID string) (*JournalEvent, error)
+		ListJournalEvents(ctx thrift.Context, journal string, partition JournalPartition) ([]*JournalEvent, error)
+		PutJournalPartition(ctx thrift.Context, journal string, partition JournalPartition) error
+		ListJournalPartitions(ctx thrift.Context, journal string) ([]JournalPartition, error)
+		DeleteJournalPartition(ctx thrift.Context, journal string, partition JournalPartition) error
+	}
+
+	// ConsumerGroupRetentionService exposes the retention overrides of
+	// consumer groups, that exclude an inactive consumer group from the
+	// retention of its destination, or protect the messages it needs
+	ConsumerGroupRetentionService interface {
+		SetConsumerGroupRetention(ctx thrift.Context, retention *ConsumerGroupRetention) error
+		ReadConsumerGroupRetention(ctx thrift.Context, cgUUID string) (*ConsumerGroupRetention, error)
+		ReadConsumerGroupLastAckTime(ctx thrift.Context, cgUUID string) (time.Time, error)
+	}
+
+	// MultiZoneService exposes what the replicator needs to apply the
+	// changes made to multi-zone entities in other zones: their versions,
+	// the creation of consumer groups under the uuid of their origin, and
+	// the ack levels of consumer groups
+	MultiZoneService interface {
+		ReadEntityVersion(ctx thrift.Context, entityUUID string) (*EntityVersion, error)
+		WriteEntityVersion(ctx thrift.Context, version *EntityVersion, previous *EntityVersion) (bool, error)
+		CreateConsumerGroupUUID(ctx thrift.Context, request *shared.CreateConsumerGroupUUIDRequest) (*shared.ConsumerGroupDescription, error)
+		SetReplicatedAckLevel(ctx thrift.Context, cgUUID string, extentUUID string, storeUUIDs []string, ackLevelAddress int64, ackLevelSeqNo int64) (bool, error)
+	}
 )
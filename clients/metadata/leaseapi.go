@@ -0,0 +1,186 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metadata
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// Leases are rows of the leases table that expire through the cassandra
+// TTL unless they are renewed by their owner. Every change to a lease is
+// a lightweight transaction conditioned on the current owner, so at most
+// one owner holds a lease at any time, as far as cassandra is concerned.
+const (
+	tableLeases = "leases"
+
+	columnOwner        = "owner"
+	columnAcquiredTime = "acquired_time"
+
+	sqlInsertLease = `INSERT INTO ` + tableLeases +
+		` (` + columnName + `, ` + columnOwner + `, ` + columnAcquiredTime + `)` +
+		` VALUES (?, ?, ?) IF NOT EXISTS USING TTL ?`
+
+	sqlRenewLease = `UPDATE ` + tableLeases + ` USING TTL ?` +
+		` SET ` + columnOwner + `=?, ` + columnAcquiredTime + `=?` +
+		` WHERE ` + columnName + `=? IF ` + columnOwner + `=?`
+
+	sqlDeleteLease = `DELETE FROM ` + tableLeases +
+		` WHERE ` + columnName + `=? IF ` + columnOwner + `=?`
+
+	sqlGetLease = `SELECT ` + columnOwner + `, ` + columnAcquiredTime + `, TTL(` + columnOwner + `)` +
+		` FROM ` + tableLeases +
+		` WHERE ` + columnName + `=?`
+)
+
+// Lease is the state of a lease, as seen by the last operation on it
+type Lease struct {
+	Name         string
+	Owner        string
+	AcquiredTime time.Time
+	// ExpiryTime is only known when the lease is read
+	ExpiryTime time.Time
+}
+
+func leaseTTLSeconds(ttl time.Duration) int64 {
+	secs := int64(ttl / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
+
+func validateLeaseArgs(op string, name string, owner string) error {
+	if len(name) == 0 || len(owner) == 0 {
+		return &shared.BadRequestError{
+			Message: fmt.Sprintf("%v: lease name and owner must be set", op),
+		}
+	}
+	return nil
+}
+
+// AcquireLease acquires the named lease for the owner, or renews it if
+// the owner already holds it. The returned lease tells who holds the
+// lease after the call, which is someone else if it was already taken.
+func (s *CassandraMetadataService) AcquireLease(ctx thrift.Context, name string, owner string, ttl time.Duration) (*Lease, error) {
+
+	if err := validateLeaseArgs("AcquireLease", name, owner); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	ttlSecs := leaseTTLSeconds(ttl)
+
+	previous := make(map[string]interface{})
+	applied, err := s.session.Query(sqlInsertLease, name, owner, now, ttlSecs).MapScanCAS(previous)
+	if err != nil {
+		return nil, &shared.InternalServiceError{
+			Message: fmt.Sprintf("AcquireLease: failure while inserting into leases: %v", err),
+		}
+	}
+
+	if applied {
+		return &Lease{Name: name, Owner: owner, AcquiredTime: now}, nil
+	}
+
+	current := leaseFromCASResult(name, previous)
+	if current.Owner != owner {
+		return current, nil
+	}
+
+	// already the owner, extend the TTL and keep the
+	// time the lease was originally acquired
+	previous = make(map[string]interface{})
+	applied, err = s.session.Query(sqlRenewLease, ttlSecs, owner, current.AcquiredTime, name, owner).MapScanCAS(previous)
+	if err != nil {
+		return nil, &shared.InternalServiceError{
+			Message: fmt.Sprintf("AcquireLease: failure while renewing lease: %v", err),
+		}
+	}
+
+	if !applied {
+		// expired and taken over in the meanwhile
+		return leaseFromCASResult(name, previous), nil
+	}
+
+	return current, nil
+}
+
+// ReleaseLease gives up the named lease, if it is held by the owner
+func (s *CassandraMetadataService) ReleaseLease(ctx thrift.Context, name string, owner string) error {
+
+	if err := validateLeaseArgs("ReleaseLease", name, owner); err != nil {
+		return err
+	}
+
+	previous := make(map[string]interface{})
+	if _, err := s.session.Query(sqlDeleteLease, name, owner).MapScanCAS(previous); err != nil {
+		return &shared.InternalServiceError{
+			Message: fmt.Sprintf("ReleaseLease: failure while deleting from leases: %v", err),
+		}
+	}
+	return nil
+}
+
+// ReadLease returns the current state of the named lease. The returned
+// lease has no owner if nobody holds it.
+func (s *CassandraMetadataService) ReadLease(ctx thrift.Context, name string) (*Lease, error) {
+
+	if len(name) == 0 {
+		return nil, &shared.BadRequestError{Message: "ReadLease: lease name must be set"}
+	}
+
+	var owner string
+	var acquiredTime time.Time
+	var ttlSecs int
+
+	result := &Lease{Name: name}
+
+	query := s.session.Query(sqlGetLease, name).Consistency(s.highConsLevel)
+	if err := query.Scan(&owner, &acquiredTime, &ttlSecs); err != nil {
+		if err == gocql.ErrNotFound {
+			return result, nil
+		}
+		return nil, &shared.InternalServiceError{
+			Message: fmt.Sprintf("ReadLease: %v", err),
+		}
+	}
+
+	result.Owner = owner
+	result.AcquiredTime = acquiredTime
+	result.ExpiryTime = time.Now().Add(time.Duration(ttlSecs) * time.Second)
+	return result, nil
+}
+
+func leaseFromCASResult(name string, previous map[string]interface{}) *Lease {
+	result := &Lease{Name: name}
+	if owner, ok := previous[columnOwner].(string); ok {
+		result.Owner = owner
+	}
+	if acquiredTime, ok := previous[columnAcquiredTime].(time.Time); ok {
+		result.AcquiredTime = acquiredTime
+	}
+	return result
+}
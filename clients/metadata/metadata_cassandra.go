@@ -62,6 +62,7 @@ const (
 	tableConsumerGroupsByName   = "consumer_groups_by_name"
 	tableDestinationExtents     = "destination_extents"
 	tableDestinations           = "destinations"
+	tableDestinationSchema      = "destination_schema"
 	tableDestinationsByPath     = "destinations_by_path"
 	tableHostAddrToUUID         = "host_addr_to_uuid"
 	tableInputHostExtents       = "input_host_extents"
@@ -75,6 +76,7 @@ const (
 	columnAckLevelOffset                 = "ack_level_offset"
 	columnAckLevelSequence               = "ack_level_sequence"
 	columnAckLevelSequenceRate           = "ack_level_sequence_rate"
+	columnAliases                        = "aliases"
 	columnArchivalLocation               = "archival_location"
 	columnAvailableAddress               = "available_address"
 	columnAvailableEnqueueTime           = "available_enqueue_time"
@@ -90,6 +92,7 @@ const (
 	columnConsumerGroupUUID              = "consumer_group_uuid"
 	columnConsumerGroupVisibility        = "consumer_group_visibility"
 	columnCreatedTime                    = "created_time"
+	columnData                           = "data"
 	columnDLQConsumerGroup               = "dlq_consumer_group"
 	columnDeadLetterQueueDestinationUUID = "dead_letter_queue_destination_uuid"
 	columnDestination                    = "destination"
@@ -123,6 +126,7 @@ const (
 	columnSizeInBytes                    = "size_in_bytes"
 	columnSizeInBytesRate                = "size_in_bytes_rate"
 	columnSkipOlderMessagesSeconds       = "skip_older_messages_seconds"
+	columnSource                         = "source"
 	columnStartFrom                      = "start_from"
 	columnStatus                         = "status"
 	columnStatusUpdatedTime              = "status_updated_time"
@@ -133,6 +137,7 @@ const (
 	columnType                           = "type"
 	columnUUID                           = "uuid"
 	columnUnconsumedMessagesRetention    = "unconsumed_messages_retention"
+	columnVersion                        = "version"
 	columnEntityName                     = "entity_name"
 	columnEntityUUID                     = "entity_uuid"
 	columnEntityType                     = "entity_type"
@@ -179,6 +184,7 @@ type CassandraMetadataService struct {
 
 // interface implementation check
 var _ m.TChanMetadataService = (*CassandraMetadataService)(nil)
+var _ DestinationAliasService = (*CassandraMetadataService)(nil)
 
 // NewCassandraMetadataService creates an instance of TChanMetadataServiceClient backed up by Cassandra.
 func NewCassandraMetadataService(cfg configure.CommonMetadataConfig) (*CassandraMetadataService, error) {
@@ -329,7 +335,7 @@ const (
 
 	sqlGetDstByPath = `SELECT ` +
 		columnDestination + `.` + columnUUID + `, ` +
-		columnPath + `, ` +
+		columnDestination + `.` + columnPath + `, ` +
 		columnDestination + `.` + columnType + `, ` +
 		columnDestination + `.` + columnStatus + `, ` +
 		columnDestination + `.` + columnConsumedMessagesRetention + `, ` +
@@ -404,6 +410,24 @@ func (s *CassandraMetadataService) CreateDestinationUUID(ctx thrift.Context, uui
 		request.DLQConsumerGroupUUID = nil // CQL doesn't accept empty string as a UUID type value; force nil
 	}
 
+	// The first version of the schema is written ahead of the destination; if
+	// the destination can't be created, the schema row is never referenced
+	var schemaInfo *shared.SchemaInfo
+	if request.SchemaInfo != nil {
+		if err := common.ValidateSchemaInfo(request.GetSchemaInfo()); err != nil {
+			return nil, &shared.BadRequestError{Message: fmt.Sprintf("CreateDestination: %v", err)}
+		}
+		if _, err := s.insertDestinationSchema(destinationUUID, 1, request.GetSchemaInfo()); err != nil {
+			return nil, err
+		}
+		schemaInfo = &shared.SchemaInfo{
+			Type:    common.StringPtr(request.GetSchemaInfo().GetType()),
+			Version: common.Int32Ptr(1),
+			Data:    request.GetSchemaInfo().GetData(),
+			Source:  common.StringPtr(request.GetSchemaInfo().GetSource()),
+		}
+	}
+
 	if err := s.session.Query(
 		sqlInsertDstByUUID,
 		destinationUUID,
@@ -491,6 +515,7 @@ func (s *CassandraMetadataService) CreateDestinationUUID(ctx thrift.Context, uui
 		IsMultiZone:                 common.BoolPtr(request.GetIsMultiZone()),
 		ZoneConfigs:                 request.GetZoneConfigs(),
 		DLQConsumerGroupUUID:        common.StringPtr(request.GetDLQConsumerGroupUUID()),
+		SchemaInfo:                  schemaInfo,
 	}, nil
 }
 
@@ -660,6 +685,13 @@ func (s *CassandraMetadataService) ReadDestination(ctx thrift.Context, getReques
 		}
 	}
 
+	// A row in destinations_by_path whose destination carries a different
+	// path is an alias. Alias rows are not updated along with the destination,
+	// so the authoritative record is read from the destinations table.
+	if getRequest.Path != nil && result.GetPath() != getRequest.GetPath() {
+		return s.readDestinationForAlias(result.GetDestinationUUID(), getRequest.GetPath())
+	}
+
 	*result.DLQPurgeBefore = int64(cqlTimestampToUnixNano(*result.DLQPurgeBefore))
 	*result.DLQMergeBefore = int64(cqlTimestampToUnixNano(*result.DLQMergeBefore))
 
@@ -702,6 +734,16 @@ func (s *CassandraMetadataService) UpdateDestination(ctx thrift.Context, updateR
 	if updateRequest.ChecksumOption == nil {
 		updateRequest.ChecksumOption = common.InternalChecksumOptionPtr(existing.GetChecksumOption())
 	}
+
+	// The new version of the schema is added first, so that an
+	// incompatible schema fails the update as a whole
+	var schemaInfo *shared.SchemaInfo
+	if updateRequest.SchemaInfo != nil {
+		if schemaInfo, err = s.CreateDestinationSchema(ctx, updateRequest.GetDestinationUUID(), updateRequest.GetSchemaInfo()); err != nil {
+			return nil, err
+		}
+	}
+
 	batch := s.session.NewBatch(gocql.LoggedBatch) // Consider switching to unlogged
 
 	batch.Query(
@@ -760,6 +802,9 @@ func (s *CassandraMetadataService) UpdateDestination(ctx thrift.Context, updateR
 	existing.UnconsumedMessagesRetention = common.Int32Ptr(updateRequest.GetUnconsumedMessagesRetention())
 	existing.OwnerEmail = common.StringPtr(updateRequest.GetOwnerEmail())
 	existing.ChecksumOption = common.InternalChecksumOptionPtr(updateRequest.GetChecksumOption())
+	if schemaInfo != nil {
+		existing.SchemaInfo = schemaInfo
+	}
 	return existing, nil
 }
 
@@ -772,6 +817,10 @@ func (s *CassandraMetadataService) DeleteDestination(ctx thrift.Context, deleteR
 	if err != nil {
 		return err
 	}
+	aliases, err := s.readDestinationAliases(existing.GetDestinationUUID())
+	if err != nil {
+		return err
+	}
 	batch := s.session.NewBatch(gocql.LoggedBatch)
 	batch.Query(
 		sqlUpdateDstByUUID,
@@ -787,6 +836,12 @@ func (s *CassandraMetadataService) DeleteDestination(ctx thrift.Context, deleteR
 		marshalDstZoneConfigs(existing.GetZoneConfigs()),
 		existing.GetDestinationUUID())
 	batch.Query(sqlDeleteDst, directoryUUID, existing.GetPath())
+	for _, alias := range aliases {
+		batch.Query(sqlDeleteDst, directoryUUID, alias)
+	}
+	if len(aliases) > 0 {
+		batch.Query(sqlDeleteDstAliases, existing.GetDestinationUUID())
+	}
 	if err = s.session.ExecuteBatch(batch); err != nil {
 		return &shared.InternalServiceError{
 			Message: "DeleteDestination: " + err.Error(),
@@ -886,7 +941,8 @@ func (s *CassandraMetadataService) ListDestinations(ctx thrift.Context, listRequ
 		columnDestination + `.` + columnOwnerEmail + `, ` +
 		columnDestination + `.` + columnChecksumOption + `, ` +
 		columnDestination + `.` + columnIsMultiZone + `, ` +
-		columnDestination + `.` + columnZoneConfigs +
+		columnDestination + `.` + columnZoneConfigs + `, ` +
+		columnDestination + `.` + columnPath +
 		` FROM ` + tableDestinationsByPath +
 		` WHERE ` + columnDirectoryUUID + `=? and ` + columnPath + `>=? and ` + columnPath + `<?`
 	if listRequest.GetMultiZoneOnly() {
@@ -915,6 +971,7 @@ func (s *CassandraMetadataService) ListDestinations(ctx thrift.Context, listRequ
 	}
 	d := getUtilDestinationDescription()
 	var zoneConfigsData []map[string]interface{}
+	var primaryPath string
 	for iter.Scan(
 		d.DestinationUUID,
 		d.Path,
@@ -925,12 +982,16 @@ func (s *CassandraMetadataService) ListDestinations(ctx thrift.Context, listRequ
 		d.OwnerEmail,
 		d.ChecksumOption,
 		d.IsMultiZone,
-		&zoneConfigsData) {
-		d.ZoneConfigs = unmarshalDstZoneConfigs(zoneConfigsData)
+		&zoneConfigsData,
+		&primaryPath) {
+		// skip the alias rows, the destination is listed under its primary path
+		if primaryPath == d.GetPath() {
+			d.ZoneConfigs = unmarshalDstZoneConfigs(zoneConfigsData)
 
-		// Get a new item within limit
-		result.Destinations = append(result.Destinations, d)
-		d = getUtilDestinationDescription()
+			// Get a new item within limit
+			result.Destinations = append(result.Destinations, d)
+			d = getUtilDestinationDescription()
+		}
 		zoneConfigsData = nil
 	}
 
@@ -1176,6 +1237,16 @@ const (
 // multiple destination paths. If the requested [destinationPath, consumerGroupName] already exists,
 // this method will return an EntityAlreadyExistsError.
 func (s *CassandraMetadataService) CreateConsumerGroup(ctx thrift.Context, request *shared.CreateConsumerGroupRequest) (*shared.ConsumerGroupDescription, error) {
+	uuidRequest := shared.NewCreateConsumerGroupUUIDRequest()
+	uuidRequest.Request = request
+	uuidRequest.ConsumerGroupUUID = common.StringPtr(uuid.New())
+	return s.CreateConsumerGroupUUID(ctx, uuidRequest)
+}
+
+// CreateConsumerGroupUUID creates a ConsumerGroup with the given uuid, used to create
+// a multi-zone consumer group under the uuid it was given in the zone it was created in
+func (s *CassandraMetadataService) CreateConsumerGroupUUID(ctx thrift.Context, uuidRequest *shared.CreateConsumerGroupUUIDRequest) (*shared.ConsumerGroupDescription, error) {
+	request := uuidRequest.GetRequest()
 
 	dstInfo, err := s.ReadDestination(nil, &m.ReadDestinationRequest{Path: common.StringPtr(request.GetDestinationPath())})
 	if err != nil {
@@ -1197,7 +1268,7 @@ func (s *CassandraMetadataService) CreateConsumerGroup(ctx thrift.Context, reque
 			A batch query cannot be used here, because CassandraDB requires all the queries in a batch
 			to be from the same partition.
 	*/
-	cgUUID := uuid.New()
+	cgUUID := uuidRequest.GetConsumerGroupUUID()
 	dstUUID := dstInfo.GetDestinationUUID()
 	var dlqUUID *string
 	if request.DeadLetterQueueDestinationUUID != nil {
@@ -540,6 +540,189 @@ func (s *CassandraSuite) TestListDestinations() {
 	s.Equal(0, len(listResult.GetDestinations()))
 }
 
+func (s *CassandraSuite) TestDestinationAliases() {
+	path := s.generateName("/aliastest/dst")
+	alias := s.generateName("/aliastest/alias")
+	newPath := s.generateName("/aliastest/renamed")
+	aliasSvc := s.client.(DestinationAliasService)
+
+	createDestination := &shared.CreateDestinationRequest{
+		Path: common.StringPtr(path),
+		Type: common.InternalDestinationTypePtr(shared.DestinationType_PLAIN),
+		ConsumedMessagesRetention:   common.Int32Ptr(10),
+		UnconsumedMessagesRetention: common.Int32Ptr(20),
+		OwnerEmail:                  common.StringPtr(destinationOwnerEmail),
+		ChecksumOption:              common.InternalChecksumOptionPtr(0),
+	}
+	dest, err := s.client.CreateDestination(nil, createDestination)
+	s.Nil(err)
+
+	// Create alias, twice to make sure it's idempotent
+	s.Nil(aliasSvc.CreateDestinationAlias(nil, path, alias))
+	s.Nil(aliasSvc.CreateDestinationAlias(nil, path, alias))
+
+	// Alias can't shadow an existing destination, nor be created for an alias
+	err = aliasSvc.CreateDestinationAlias(nil, path, path)
+	s.IsType(&shared.EntityAlreadyExistsError{}, err)
+	err = aliasSvc.CreateDestinationAlias(nil, alias, newPath)
+	s.IsType(&shared.BadRequestError{}, err)
+
+	// Alias resolves to the destination with its primary path
+	loaded, err := s.client.ReadDestination(nil, &m.ReadDestinationRequest{Path: common.StringPtr(alias)})
+	s.Nil(err)
+	s.Equal(dest.GetDestinationUUID(), loaded.GetDestinationUUID())
+	s.Equal(path, loaded.GetPath())
+
+	aliases, err := aliasSvc.ListDestinationAliases(nil, path)
+	s.Nil(err)
+	s.Equal([]string{alias}, aliases)
+
+	// Updates through the primary path are visible through the alias
+	updateDestination := &shared.UpdateDestinationRequest{
+		DestinationUUID:             common.StringPtr(dest.GetDestinationUUID()),
+		Status:                      common.InternalDestinationStatusPtr(shared.DestinationStatus_SENDONLY),
+		ConsumedMessagesRetention:   common.Int32Ptr(dest.GetConsumedMessagesRetention()),
+		UnconsumedMessagesRetention: common.Int32Ptr(dest.GetUnconsumedMessagesRetention()),
+		OwnerEmail:                  common.StringPtr(dest.GetOwnerEmail()),
+		ChecksumOption:              common.InternalChecksumOptionPtr(dest.GetChecksumOption()),
+	}
+	_, err = s.client.UpdateDestination(nil, updateDestination)
+	s.Nil(err)
+	loaded, err = s.client.ReadDestination(nil, &m.ReadDestinationRequest{Path: common.StringPtr(alias)})
+	s.Nil(err)
+	s.Equal(shared.DestinationStatus_SENDONLY, loaded.GetStatus())
+
+	// Aliases are not listed as destinations
+	listResult, err := s.client.ListDestinations(nil, &shared.ListDestinationsRequest{
+		Prefix: common.StringPtr(alias),
+		Limit:  common.Int64Ptr(testPageSize),
+	})
+	s.Nil(err)
+	s.Equal(0, len(listResult.GetDestinations()))
+
+	// Rename; the old path becomes an alias
+	renamed, err := aliasSvc.RenameDestination(nil, path, newPath)
+	s.Nil(err)
+	s.Equal(newPath, renamed.GetPath())
+	s.Equal(dest.GetDestinationUUID(), renamed.GetDestinationUUID())
+
+	for _, p := range []string{path, alias, newPath} {
+		loaded, err = s.client.ReadDestination(nil, &m.ReadDestinationRequest{Path: common.StringPtr(p)})
+		s.Nil(err)
+		s.Equal(dest.GetDestinationUUID(), loaded.GetDestinationUUID())
+		s.Equal(newPath, loaded.GetPath())
+	}
+	loaded, err = s.client.ReadDestination(nil, &m.ReadDestinationRequest{DestinationUUID: common.StringPtr(dest.GetDestinationUUID())})
+	s.Nil(err)
+	s.Equal(newPath, loaded.GetPath())
+
+	aliases, err = aliasSvc.ListDestinationAliases(nil, newPath)
+	s.Nil(err)
+	s.Equal(2, len(aliases))
+	s.Contains(aliases, path)
+	s.Contains(aliases, alias)
+
+	// Rename to an existing path fails
+	_, err = aliasSvc.RenameDestination(nil, newPath, alias)
+	s.IsType(&shared.EntityAlreadyExistsError{}, err)
+
+	// Delete alias
+	err = aliasSvc.DeleteDestinationAlias(nil, newPath)
+	s.IsType(&shared.BadRequestError{}, err)
+	s.Nil(aliasSvc.DeleteDestinationAlias(nil, alias))
+	_, err = s.client.ReadDestination(nil, &m.ReadDestinationRequest{Path: common.StringPtr(alias)})
+	s.IsType(&shared.EntityNotExistsError{}, err)
+
+	// Deleting the destination removes the remaining aliases
+	s.Nil(s.client.DeleteDestination(nil, &shared.DeleteDestinationRequest{Path: common.StringPtr(newPath)}))
+	for _, p := range []string{path, newPath} {
+		_, err = s.client.ReadDestination(nil, &m.ReadDestinationRequest{Path: common.StringPtr(p)})
+		s.IsType(&shared.EntityNotExistsError{}, err)
+	}
+}
+
+func (s *CassandraSuite) TestDestinationSchemas() {
+	path := s.generateName("/schematest/dst")
+	schemaSvc := s.client.(DestinationSchemaService)
+
+	createDestination := &shared.CreateDestinationRequest{
+		Path: common.StringPtr(path),
+		Type: common.InternalDestinationTypePtr(shared.DestinationType_PLAIN),
+		ConsumedMessagesRetention:   common.Int32Ptr(10),
+		UnconsumedMessagesRetention: common.Int32Ptr(20),
+		OwnerEmail:                  common.StringPtr(destinationOwnerEmail),
+		ChecksumOption:              common.InternalChecksumOptionPtr(0),
+		SchemaInfo: &shared.SchemaInfo{
+			Type: common.StringPtr(common.SchemaTypeJSON),
+			Data: []byte(`{"type": "object", "required": ["id"], "properties": {"id": {"type": "number"}}}`),
+		},
+	}
+	dest, err := s.client.CreateDestination(nil, createDestination)
+	s.Nil(err)
+	s.Equal(int32(1), dest.GetSchemaInfo().GetVersion())
+
+	schema, err := schemaSvc.ReadDestinationSchema(nil, dest.GetDestinationUUID(), 0)
+	s.Nil(err)
+	s.Equal(int32(1), schema.GetVersion())
+	s.Equal(common.SchemaTypeJSON, schema.GetType())
+	s.Equal(createDestination.SchemaInfo.GetData(), schema.GetData())
+
+	// An incompatible version is rejected
+	_, err = schemaSvc.CreateDestinationSchema(nil, dest.GetDestinationUUID(), &shared.SchemaInfo{
+		Type: common.StringPtr(common.SchemaTypeJSON),
+		Data: []byte(`{"type": "object", "properties": {"id": {"type": "number"}}}`),
+	})
+	s.IsType(&shared.BadRequestError{}, err)
+
+	// A compatible version is added as the latest version
+	schema, err = schemaSvc.CreateDestinationSchema(nil, dest.GetDestinationUUID(), &shared.SchemaInfo{
+		Type: common.StringPtr(common.SchemaTypeJSON),
+		Data: []byte(`{"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}}}`),
+	})
+	s.Nil(err)
+	s.Equal(int32(2), schema.GetVersion())
+
+	schema, err = schemaSvc.ReadDestinationSchema(nil, dest.GetDestinationUUID(), 0)
+	s.Nil(err)
+	s.Equal(int32(2), schema.GetVersion())
+	schema, err = schemaSvc.ReadDestinationSchema(nil, dest.GetDestinationUUID(), 1)
+	s.Nil(err)
+	s.Equal(int32(1), schema.GetVersion())
+
+	schemas, err := schemaSvc.ListDestinationSchemas(nil, dest.GetDestinationUUID())
+	s.Nil(err)
+	s.Equal(2, len(schemas))
+
+	_, err = schemaSvc.ReadDestinationSchema(nil, dest.GetDestinationUUID(), 3)
+	s.IsType(&shared.EntityNotExistsError{}, err)
+
+	// UpdateDestination adds a new version, an incompatible one fails the update
+	updateDestination := &shared.UpdateDestinationRequest{
+		DestinationUUID: common.StringPtr(dest.GetDestinationUUID()),
+		OwnerEmail:      common.StringPtr("schema@uber.com"),
+		SchemaInfo: &shared.SchemaInfo{
+			Type: common.StringPtr(common.SchemaTypeJSON),
+			Data: []byte(`{"type": "object", "properties": {"id": {"type": "integer"}}}`),
+		},
+	}
+	_, err = s.client.UpdateDestination(nil, updateDestination)
+	s.IsType(&shared.BadRequestError{}, err)
+	dest, err = s.client.ReadDestination(nil, &m.ReadDestinationRequest{DestinationUUID: common.StringPtr(dest.GetDestinationUUID())})
+	s.Nil(err)
+	s.Equal(destinationOwnerEmail, dest.GetOwnerEmail())
+
+	updateDestination.SchemaInfo.Data = []byte(`{"type": "object", "required": ["id", "name"], "properties": {"id": {"type": "integer"}, "name": {"type": "string"}}}`)
+	dest, err = s.client.UpdateDestination(nil, updateDestination)
+	s.Nil(err)
+	s.Equal("schema@uber.com", dest.GetOwnerEmail())
+	s.Equal(int32(3), dest.GetSchemaInfo().GetVersion())
+
+	schema, err = schemaSvc.ReadDestinationSchema(nil, dest.GetDestinationUUID(), 0)
+	s.Nil(err)
+	s.Equal(int32(3), schema.GetVersion())
+	s.Equal(updateDestination.SchemaInfo.GetData(), schema.GetData())
+}
+
 func (s *CassandraSuite) TestExtentCRU() {
 	// Create
 	var destinations [3]*shared.DestinationDescription
@@ -729,6 +912,424 @@ func (s *CassandraSuite) TestReplicationStatus_Remote() {
 	s.Equal(0, len(readResult.GetExtentStatsList()))
 }
 
+func (s *CassandraSuite) TestLeases() {
+	assert := s.Require()
+
+	name := s.generateName("lease")
+	owner1 := uuid.New()
+	owner2 := uuid.New()
+
+	lease, err := s.client.ReadLease(nil, name)
+	assert.Nil(err)
+	assert.Equal("", lease.Owner)
+
+	lease, err = s.client.AcquireLease(nil, name, owner1, time.Minute)
+	assert.Nil(err)
+	assert.Equal(owner1, lease.Owner)
+	acquiredTime := lease.AcquiredTime
+
+	// held by someone else
+	lease, err = s.client.AcquireLease(nil, name, owner2, time.Minute)
+	assert.Nil(err)
+	assert.Equal(owner1, lease.Owner)
+
+	// renewal keeps the time the lease was acquired
+	lease, err = s.client.AcquireLease(nil, name, owner1, time.Minute)
+	assert.Nil(err)
+	assert.Equal(owner1, lease.Owner)
+	assert.Equal(acquiredTime.Unix(), lease.AcquiredTime.Unix())
+
+	lease, err = s.client.ReadLease(nil, name)
+	assert.Nil(err)
+	assert.Equal(owner1, lease.Owner)
+	assert.True(lease.ExpiryTime.After(time.Now()))
+
+	// only the owner can release the lease
+	assert.Nil(s.client.ReleaseLease(nil, name, owner2))
+	lease, err = s.client.ReadLease(nil, name)
+	assert.Nil(err)
+	assert.Equal(owner1, lease.Owner)
+
+	assert.Nil(s.client.ReleaseLease(nil, name, owner1))
+	lease, err = s.client.AcquireLease(nil, name, owner2, time.Second)
+	assert.Nil(err)
+	assert.Equal(owner2, lease.Owner)
+
+	// expires unless renewed
+	time.Sleep(2 * time.Second)
+	lease, err = s.client.AcquireLease(nil, name, owner1, time.Minute)
+	assert.Nil(err)
+	assert.Equal(owner1, lease.Owner)
+
+	_, err = s.client.AcquireLease(nil, "", owner1, time.Minute)
+	assert.IsType(&shared.BadRequestError{}, err)
+}
+
+func (s *CassandraSuite) TestEventJournal() {
+	assert := s.Require()
+
+	journal := s.generateName("journal")
+	now := time.Now().Truncate(time.Millisecond)
+	partition := JournalPartition{Owner: uuid.New(), Bucket: now.Truncate(time.Hour).Unix()}
+	other := JournalPartition{Owner: uuid.New(), Bucket: partition.Bucket}
+
+	partitions, err := s.client.ListJournalPartitions(nil, journal)
+	assert.Nil(err)
+	assert.Equal(0, len(partitions))
+
+	assert.Nil(s.client.PutJournalPartition(nil, journal, partition))
+	assert.Nil(s.client.PutJournalPartition(nil, journal, partition))
+	assert.Nil(s.client.PutJournalPartition(nil, journal, other))
+	partitions, err = s.client.ListJournalPartitions(nil, journal)
+	assert.Nil(err)
+	assert.Equal(2, len(partitions))
+
+	events, err := s.client.ListJournalEvents(nil, journal, partition)
+	assert.Nil(err)
+	assert.Equal(0, len(events))
+
+	event := &JournalEvent{
+		JournalPartition: partition,
+		ID:               uuid.New(),
+		Type:             "ExtentDownEvent",
+		Payload:          `{"dstID":"foo"}`,
+		State:            "pending",
+		CreatedTime:      now,
+		UpdatedTime:      now,
+	}
+	event2 := *event
+	event2.ID = uuid.New()
+	event3 := *event
+	event3.JournalPartition = other
+	event3.ID = uuid.New()
+	assert.Nil(s.client.WriteJournalEvents(nil, journal, []*JournalEvent{event, &event2, &event3}, nil))
+
+	event.State = "failed"
+	event.Attempts = 3
+	event.LastError = "retries exceeded"
+	assert.Nil(s.client.WriteJournalEvents(nil, journal, []*JournalEvent{event}, nil))
+
+	got, err := s.client.ReadJournalEvent(nil, journal, partition, event.ID)
+	assert.Nil(err)
+	assert.Equal(event.Type, got.Type)
+	assert.Equal(event.Payload, got.Payload)
+	assert.Equal(partition, got.JournalPartition)
+	assert.Equal("failed", got.State)
+	assert.Equal(3, got.Attempts)
+	assert.Equal(event.LastError, got.LastError)
+	assert.Equal(now.UnixNano(), got.CreatedTime.UnixNano())
+
+	_, err = s.client.ReadJournalEvent(nil, journal, other, event.ID)
+	assert.IsType(&shared.EntityNotExistsError{}, err)
+
+	events, err = s.client.ListJournalEvents(nil, journal, partition)
+	assert.Nil(err)
+	assert.Equal(2, len(events))
+
+	assert.Nil(s.client.WriteJournalEvents(nil, journal, nil, []*JournalEvent{event, &event3}))
+	_, err = s.client.ReadJournalEvent(nil, journal, partition, event.ID)
+	assert.IsType(&shared.EntityNotExistsError{}, err)
+
+	events, err = s.client.ListJournalEvents(nil, journal, partition)
+	assert.Nil(err)
+	assert.Equal(1, len(events))
+	assert.Equal(event2.ID, events[0].ID)
+
+	events, err = s.client.ListJournalEvents(nil, journal, other)
+	assert.Nil(err)
+	assert.Equal(0, len(events))
+
+	assert.Nil(s.client.DeleteJournalPartition(nil, journal, other))
+	partitions, err = s.client.ListJournalPartitions(nil, journal)
+	assert.Nil(err)
+	assert.Equal([]JournalPartition{partition}, partitions)
+}
+
+func (s *CassandraSuite) TestConsumerGroupRetention() {
+	assert := s.Require()
+
+	cgUUID := uuid.New()
+	now := time.Now().Truncate(time.Millisecond)
+
+	_, err := s.client.ReadConsumerGroupRetention(nil, cgUUID)
+	assert.IsType(&shared.EntityNotExistsError{}, err)
+
+	err = s.client.SetConsumerGroupRetention(nil, &ConsumerGroupRetention{
+		ConsumerGroupUUID:    cgUUID,
+		ExcludeAfterInactive: time.Hour,
+		Protect:              true,
+	})
+	assert.IsType(&shared.BadRequestError{}, err)
+
+	assert.Nil(s.client.SetConsumerGroupRetention(nil, &ConsumerGroupRetention{
+		ConsumerGroupUUID:    cgUUID,
+		ExcludeAfterInactive: 3 * 24 * time.Hour,
+		UpdatedTime:          now,
+	}))
+
+	got, err := s.client.ReadConsumerGroupRetention(nil, cgUUID)
+	assert.Nil(err)
+	assert.Equal(cgUUID, got.ConsumerGroupUUID)
+	assert.Equal(3*24*time.Hour, got.ExcludeAfterInactive)
+	assert.False(got.Protect)
+	assert.Equal(now.UnixNano(), got.UpdatedTime.UnixNano())
+
+	assert.Nil(s.client.SetConsumerGroupRetention(nil, &ConsumerGroupRetention{
+		ConsumerGroupUUID: cgUUID,
+		Protect:           true,
+		UpdatedTime:       now,
+	}))
+
+	got, err = s.client.ReadConsumerGroupRetention(nil, cgUUID)
+	assert.Nil(err)
+	assert.Equal(time.Duration(0), got.ExcludeAfterInactive)
+	assert.True(got.Protect)
+
+	// an override that does nothing is removed
+	assert.Nil(s.client.SetConsumerGroupRetention(nil, &ConsumerGroupRetention{ConsumerGroupUUID: cgUUID}))
+	_, err = s.client.ReadConsumerGroupRetention(nil, cgUUID)
+	assert.IsType(&shared.EntityNotExistsError{}, err)
+
+	// the last ack time is zero until an ack level is written
+	cReq := m.NewCreateConsumerGroupExtentRequest()
+	cReq.DestinationUUID = common.StringPtr(uuid.New())
+	cReq.ExtentUUID = common.StringPtr(uuid.New())
+	cReq.ConsumerGroupUUID = common.StringPtr(cgUUID)
+	cReq.OutputHostUUID = common.StringPtr(uuid.New())
+	cReq.StoreUUIDs = []string{uuid.New()}
+	assert.Nil(s.client.CreateConsumerGroupExtent(nil, cReq))
+
+	lastAckTime, err := s.client.ReadConsumerGroupLastAckTime(nil, cgUUID)
+	assert.Nil(err)
+	assert.True(lastAckTime.IsZero())
+
+	before := time.Now().Add(-time.Minute)
+	assert.Nil(s.client.SetAckOffset(nil, &m.SetAckOffsetRequest{
+		ConsumerGroupUUID:  common.StringPtr(cgUUID),
+		ExtentUUID:         common.StringPtr(cReq.GetExtentUUID()),
+		OutputHostUUID:     common.StringPtr(cReq.GetOutputHostUUID()),
+		ConnectedStoreUUID: common.StringPtr(cReq.StoreUUIDs[0]),
+		AckLevelAddress:    common.Int64Ptr(1234),
+	}))
+
+	lastAckTime, err = s.client.ReadConsumerGroupLastAckTime(nil, cgUUID)
+	assert.Nil(err)
+	assert.True(lastAckTime.After(before))
+	assert.False(lastAckTime.After(time.Now().Add(time.Minute)))
+}
+
+func (s *CassandraSuite) TestEntityVersion() {
+	assert := s.Require()
+
+	entityUUID := uuid.New()
+	now := time.Now().Truncate(time.Millisecond)
+
+	_, err := s.client.ReadEntityVersion(nil, entityUUID)
+	assert.IsType(&shared.EntityNotExistsError{}, err)
+
+	_, err = s.client.WriteEntityVersion(nil, &EntityVersion{EntityUUID: entityUUID}, nil)
+	assert.IsType(&shared.BadRequestError{}, err)
+
+	first := &EntityVersion{
+		EntityUUID:  entityUUID,
+		Vector:      map[string]int64{"zone1": 2, "zone2": 1},
+		UpdatedZone: "zone1",
+		UpdatedTime: now,
+	}
+	applied, err := s.client.WriteEntityVersion(nil, first, nil)
+	assert.Nil(err)
+	assert.True(applied)
+
+	got, err := s.client.ReadEntityVersion(nil, entityUUID)
+	assert.Nil(err)
+	assert.Equal(entityUUID, got.EntityUUID)
+	assert.Equal(map[string]int64{"zone1": 2, "zone2": 1}, got.Vector)
+	assert.Equal("zone1", got.UpdatedZone)
+	assert.Equal(now.UnixNano(), got.UpdatedTime.UnixNano())
+
+	// a writer that read no version, or an older one, loses to the one that wrote first
+	second := &EntityVersion{
+		EntityUUID:  entityUUID,
+		Vector:      map[string]int64{"zone1": 3, "zone2": 1},
+		UpdatedZone: "zone1",
+		UpdatedTime: now,
+	}
+	applied, err = s.client.WriteEntityVersion(nil, second, nil)
+	assert.Nil(err)
+	assert.False(applied)
+
+	applied, err = s.client.WriteEntityVersion(nil, second, first)
+	assert.Nil(err)
+	assert.True(applied)
+
+	applied, err = s.client.WriteEntityVersion(nil, &EntityVersion{
+		EntityUUID:  entityUUID,
+		Vector:      map[string]int64{"zone1": 2, "zone2": 2},
+		UpdatedZone: "zone2",
+		UpdatedTime: now,
+	}, first)
+	assert.Nil(err)
+	assert.False(applied)
+
+	got, err = s.client.ReadEntityVersion(nil, entityUUID)
+	assert.Nil(err)
+	assert.Equal(map[string]int64{"zone1": 3, "zone2": 1}, got.Vector)
+}
+
+func (s *CassandraSuite) TestCreateConsumerGroupUUID() {
+	assert := s.Require()
+
+	dstPath := s.generateName("/foo/bar")
+	_, err := createDestination(s, dstPath, false)
+	assert.Nil(err, "CreateDestination failed")
+
+	cgUUID := uuid.New()
+	createReq := shared.NewCreateConsumerGroupUUIDRequest()
+	createReq.ConsumerGroupUUID = common.StringPtr(cgUUID)
+	createReq.Request = &shared.CreateConsumerGroupRequest{
+		DestinationPath:   common.StringPtr(dstPath),
+		ConsumerGroupName: common.StringPtr(s.generateName("foobar-consumer")),
+		IsMultiZone:       common.BoolPtr(true),
+	}
+
+	gotCG, err := s.client.CreateConsumerGroupUUID(nil, createReq)
+	assert.Nil(err)
+	assert.Equal(cgUUID, gotCG.GetConsumerGroupUUID())
+
+	readCG, err := s.client.ReadConsumerGroupByUUID(nil, &m.ReadConsumerGroupRequest{ConsumerGroupUUID: common.StringPtr(cgUUID)})
+	assert.Nil(err)
+	assert.Equal(createReq.GetRequest().GetConsumerGroupName(), readCG.GetConsumerGroupName())
+	assert.True(readCG.GetIsMultiZone())
+}
+
+func (s *CassandraSuite) TestReplicatedAckLevel() {
+	assert := s.Require()
+
+	cgUUID := uuid.New()
+	extentUUID := uuid.New()
+	readReq := &m.ReadConsumerGroupExtentRequest{
+		ConsumerGroupUUID: common.StringPtr(cgUUID),
+		ExtentUUID:        common.StringPtr(extentUUID),
+	}
+
+	storeUUIDs := []string{uuid.New(), uuid.New()}
+
+	// a missing consumer group extent can't be created without stores
+	_, err := s.client.SetReplicatedAckLevel(nil, cgUUID, extentUUID, nil, 100, 10)
+	assert.IsType(&shared.BadRequestError{}, err)
+
+	// it is created open on the given stores, without outputhost
+	moved, err := s.client.SetReplicatedAckLevel(nil, cgUUID, extentUUID, storeUUIDs, 100, 10)
+	assert.Nil(err)
+	assert.True(moved)
+
+	got, err := s.client.ReadConsumerGroupExtent(nil, readReq)
+	assert.Nil(err)
+	assert.Equal(m.ConsumerGroupExtentStatus_OPEN, got.GetExtent().GetStatus())
+	assert.Equal(int64(100), got.GetExtent().GetAckLevelOffset())
+	assert.Equal(int64(10), got.GetExtent().GetAckLevelSeqNo())
+	assert.Equal("", got.GetExtent().GetOutputHostUUID())
+	assert.Equal(len(storeUUIDs), len(got.GetExtent().GetStoreUUIDs()))
+
+	// ack levels only move forward
+	moved, err = s.client.SetReplicatedAckLevel(nil, cgUUID, extentUUID, storeUUIDs, 50, 5)
+	assert.Nil(err)
+	assert.False(moved)
+
+	moved, err = s.client.SetReplicatedAckLevel(nil, cgUUID, extentUUID, nil, 200, 20)
+	assert.Nil(err)
+	assert.True(moved)
+
+	// the local outputhost is ahead, the shipped ack level is older
+	outputHostUUID := uuid.New()
+	assert.Nil(s.client.SetAckOffset(nil, &m.SetAckOffsetRequest{
+		ConsumerGroupUUID: common.StringPtr(cgUUID),
+		ExtentUUID:        common.StringPtr(extentUUID),
+		OutputHostUUID:    common.StringPtr(outputHostUUID),
+		AckLevelAddress:   common.Int64Ptr(300),
+		AckLevelSeqNo:     common.Int64Ptr(30),
+	}))
+
+	moved, err = s.client.SetReplicatedAckLevel(nil, cgUUID, extentUUID, storeUUIDs, 250, 25)
+	assert.Nil(err)
+	assert.False(moved)
+
+	got, err = s.client.ReadConsumerGroupExtent(nil, readReq)
+	assert.Nil(err)
+	assert.Equal(int64(300), got.GetExtent().GetAckLevelOffset())
+	assert.Equal(outputHostUUID, got.GetExtent().GetOutputHostUUID())
+
+	_, err = s.client.SetReplicatedAckLevel(nil, "", extentUUID, storeUUIDs, 1, 1)
+	assert.IsType(&shared.BadRequestError{}, err)
+}
+
+func (s *CassandraSuite) TestReplaceExtentStore() {
+	assert := s.Require()
+
+	dest, err := createDestination(s, s.generateName("/foo/replace-store"), false)
+	assert.Nil(err)
+
+	extentUUID := uuid.New()
+	storeIds := []string{uuid.New(), uuid.New(), uuid.New()}
+	newStoreID := uuid.New()
+	extent := &shared.Extent{
+		ExtentUUID:      common.StringPtr(extentUUID),
+		DestinationUUID: common.StringPtr(dest.GetDestinationUUID()),
+		StoreUUIDs:      storeIds,
+		InputHostUUID:   common.StringPtr(uuid.New()),
+	}
+	_, err = s.client.CreateExtent(nil, &shared.CreateExtentRequest{Extent: extent})
+	assert.Nil(err)
+
+	sealReq := m.NewSealExtentRequest()
+	sealReq.DestinationUUID = common.StringPtr(dest.GetDestinationUUID())
+	sealReq.ExtentUUID = common.StringPtr(extentUUID)
+	assert.Nil(s.client.SealExtent(nil, sealReq))
+
+	stats, err := s.client.ReplaceExtentStore(nil, dest.GetDestinationUUID(), extentUUID, storeIds[0], newStoreID)
+	assert.Nil(err)
+	assert.Equal(shared.ExtentStatus_SEALED, stats.GetStatus())
+	assert.Equal([]string{storeIds[1], storeIds[2], newStoreID}, stats.GetExtent().GetStoreUUIDs())
+
+	readResult, err := s.client.ReadExtentStats(nil, &m.ReadExtentStatsRequest{
+		DestinationUUID: common.StringPtr(dest.GetDestinationUUID()),
+		ExtentUUID:      common.StringPtr(extentUUID),
+	})
+	assert.Nil(err)
+	assert.Equal(shared.ExtentStatus_SEALED, readResult.GetExtentStats().GetStatus())
+	assert.Equal(3, len(readResult.GetExtentStats().GetExtent().GetStoreUUIDs()))
+	assert.Contains(readResult.GetExtentStats().GetExtent().GetStoreUUIDs(), newStoreID)
+	assert.NotContains(readResult.GetExtentStats().GetExtent().GetStoreUUIDs(), storeIds[0])
+	for _, r := range readResult.GetExtentStats().GetReplicaStats() {
+		assert.NotEqual(storeIds[0], r.GetStoreUUID())
+	}
+
+	listStore := func(storeID string) []*shared.ExtentStats {
+		listResult, e := s.client.ListStoreExtentsStats(nil, &m.ListStoreExtentsStatsRequest{StoreUUID: common.StringPtr(storeID)})
+		assert.Nil(e)
+		return listResult.GetExtentStatsList()
+	}
+	assert.Equal(0, len(listStore(storeIds[0])))
+	newStoreExtents := listStore(newStoreID)
+	assert.Equal(1, len(newStoreExtents))
+	assert.Equal(extentUUID, newStoreExtents[0].GetExtent().GetExtentUUID())
+	assert.Equal(shared.ExtentStatus_SEALED, newStoreExtents[0].GetStatus())
+	oldStoreExtents := listStore(storeIds[1])
+	assert.Equal(1, len(oldStoreExtents))
+	assert.Contains(oldStoreExtents[0].GetExtent().GetStoreUUIDs(), newStoreID)
+
+	// replacing again is a no-op
+	stats, err = s.client.ReplaceExtentStore(nil, dest.GetDestinationUUID(), extentUUID, storeIds[0], newStoreID)
+	assert.Nil(err)
+	assert.Contains(stats.GetExtent().GetStoreUUIDs(), newStoreID)
+
+	// the old store must be a replica and the new one must not
+	_, err = s.client.ReplaceExtentStore(nil, dest.GetDestinationUUID(), extentUUID, uuid.New(), uuid.New())
+	assert.IsType(&shared.BadRequestError{}, err)
+	_, err = s.client.ReplaceExtentStore(nil, dest.GetDestinationUUID(), extentUUID, storeIds[1], storeIds[2])
+	assert.IsType(&shared.BadRequestError{}, err)
+}
+
 func (s *CassandraSuite) TestMoveExtent() {
 	var err error
 	var (
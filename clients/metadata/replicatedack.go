@@ -0,0 +1,105 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metadata
+
+import (
+	"fmt"
+
+	"github.com/gocql/gocql"
+	m "github.com/uber/cherami-thrift/.generated/go/metadata"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// The replicators ship the ack levels of multi-zone consumer groups to the
+// other zones, so that consumers failing over to another zone resume close
+// to where they were. A shipped ack level only touches the ack columns of
+// the consumer group extent, the rest of the row belongs to the outputhost
+// and the controller of the zone; it is conditioned on the ack level read
+// before, so it never moves back an ack level the local outputhost wrote.
+// A missing consumer group extent is created with the stores of the local
+// replicas, the controller assigns it an outputhost like any other open
+// extent whose outputhost is gone.
+const (
+	sqlCGGetAckLevel = `SELECT ` + columnAckLevelOffset +
+		` FROM ` + tableConsumerGroupExtents +
+		` WHERE ` + columnConsumerGroupUUID + `=? AND ` + columnExtentUUID + `=?`
+
+	sqlCGInsertReplicatedAckLevel = `INSERT INTO ` + tableConsumerGroupExtents +
+		` (` + columnConsumerGroupUUID + `, ` + columnExtentUUID + `, ` + columnStatus + `, ` +
+		columnStoreUUIDS + `, ` + columnAckLevelOffset + `, ` + columnAckLevelSequence + `)` +
+		` VALUES (?, ?, ?, ?, ?, ?) IF NOT EXISTS`
+
+	sqlCGUpdateReplicatedAckLevel = `UPDATE ` + tableConsumerGroupExtents +
+		` SET ` + columnAckLevelOffset + `=?, ` + columnAckLevelSequence + `=?` +
+		` WHERE ` + columnConsumerGroupUUID + `=? AND ` + columnExtentUUID + `=?` +
+		` IF ` + columnAckLevelOffset + `=?`
+)
+
+// SetReplicatedAckLevel moves the ack level of a consumer group extent to
+// the one shipped from another zone, if it is ahead of the local one. A
+// missing consumer group extent is created open on the given stores, which
+// must be the ones of the local replicas of the extent, for the controller
+// to assign an outputhost when consumers connect. It returns whether the
+// ack level moved.
+func (s *CassandraMetadataService) SetReplicatedAckLevel(ctx thrift.Context, cgUUID string, extentUUID string, storeUUIDs []string, ackLevelAddress int64, ackLevelSeqNo int64) (bool, error) {
+
+	if len(cgUUID) == 0 || len(extentUUID) == 0 {
+		return false, &shared.BadRequestError{
+			Message: "SetReplicatedAckLevel: consumer group and extent uuids must be set",
+		}
+	}
+
+	var current *int64
+	err := s.session.Query(sqlCGGetAckLevel, cgUUID, extentUUID).Consistency(s.midConsLevel).Scan(&current)
+
+	var query *gocql.Query
+	switch {
+	case err == gocql.ErrNotFound:
+		// without stores, the controller would never consider the extent
+		// consumable, nor repair it
+		if len(storeUUIDs) == 0 {
+			return false, &shared.BadRequestError{
+				Message: fmt.Sprintf("SetReplicatedAckLevel: no stores to create consumer group extent, cg=%v ext=%v", cgUUID, extentUUID),
+			}
+		}
+		query = s.session.Query(sqlCGInsertReplicatedAckLevel,
+			cgUUID, extentUUID, m.ConsumerGroupExtentStatus_OPEN, storeUUIDs, ackLevelAddress, ackLevelSeqNo)
+	case err != nil:
+		return false, &shared.InternalServiceError{
+			Message: fmt.Sprintf("SetReplicatedAckLevel: %v", err),
+		}
+	case current != nil && *current >= ackLevelAddress:
+		return false, nil
+	default:
+		query = s.session.Query(sqlCGUpdateReplicatedAckLevel,
+			ackLevelAddress, ackLevelSeqNo, cgUUID, extentUUID, current)
+	}
+
+	previous := make(map[string]interface{}) // We actually throw away the old values below, but passing nil causes a panic
+	applied, err := query.Consistency(s.midConsLevel).MapScanCAS(previous)
+	if err != nil {
+		return false, &shared.InternalServiceError{
+			Message: fmt.Sprintf("SetReplicatedAckLevel: %v", err),
+		}
+	}
+	return applied, nil
+}
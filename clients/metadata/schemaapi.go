@@ -0,0 +1,198 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metadata
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/uber/cherami-server/common"
+	m "github.com/uber/cherami-thrift/.generated/go/metadata"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// The schemas of a destination are kept in the destination_schema
+// table, one row per version. Versions start at 1 and every new
+// version has to be compatible with the latest one, see
+// common.CheckSchemaCompatibility. Since the version is part of the
+// primary key, concurrent updates are serialized by inserting the
+// next version with a lightweight transaction.
+const opsCreateSchema = "create_schema"
+
+const (
+	sqlSchemaColumns = columnVersion + `, ` +
+		columnType + `, ` +
+		columnSource + `, ` +
+		columnData + `, ` +
+		columnCreatedTime
+
+	sqlInsertDstSchema = `INSERT INTO ` + tableDestinationSchema +
+		` (` + columnDestinationUUID + `, ` + sqlSchemaColumns + `)` +
+		` VALUES (?, ?, ?, ?, ?, ?) IF NOT EXISTS`
+
+	sqlListDstSchemas = `SELECT ` + sqlSchemaColumns +
+		` FROM ` + tableDestinationSchema +
+		` WHERE ` + columnDestinationUUID + `=?`
+
+	sqlGetDstSchema = sqlListDstSchemas + ` and ` + columnVersion + `=?`
+
+	sqlGetLatestDstSchema = sqlListDstSchemas +
+		` ORDER BY ` + columnVersion + ` DESC LIMIT 1`
+)
+
+// insertDestinationSchema adds the given version of the schema, returns false
+// if the version already exists
+func (s *CassandraMetadataService) insertDestinationSchema(dstUUID string, version int32, schema *shared.SchemaInfo) (bool, error) {
+	previous := make(map[string]interface{})
+	query := s.session.Query(sqlInsertDstSchema,
+		dstUUID,
+		version,
+		schema.GetType(),
+		schema.GetSource(),
+		string(schema.GetData()),
+		unixNanoToCQLTimestamp(common.Now()))
+	applied, err := query.MapScanCAS(previous)
+	if err != nil {
+		return false, &shared.InternalServiceError{
+			Message: fmt.Sprintf("failure while inserting into destination_schema: %v", err),
+		}
+	}
+	return applied, nil
+}
+
+func scanDestinationSchema(scanner interface {
+	Scan(dest ...interface{}) bool
+}) *shared.SchemaInfo {
+	var version int
+	var schemaType, source, data string
+	var createdTime time.Time
+	if !scanner.Scan(&version, &schemaType, &source, &data, &createdTime) {
+		return nil
+	}
+	return &shared.SchemaInfo{
+		Type:           common.StringPtr(schemaType),
+		Version:        common.Int32Ptr(int32(version)),
+		Data:           []byte(data),
+		Source:         common.StringPtr(source),
+		CreatedTimeUtc: common.Int64Ptr(createdTime.UnixNano()),
+	}
+}
+
+// CreateDestinationSchema adds a new version of the schema of the given destination.
+// The new version must be compatible with the latest version, if any.
+func (s *CassandraMetadataService) CreateDestinationSchema(ctx thrift.Context, dstUUID string, schema *shared.SchemaInfo) (*shared.SchemaInfo, error) {
+	if err := common.ValidateSchemaInfo(schema); err != nil {
+		return nil, &shared.BadRequestError{Message: fmt.Sprintf("CreateDestinationSchema: %v", err)}
+	}
+
+	existing, err := s.ReadDestination(nil, &m.ReadDestinationRequest{DestinationUUID: common.StringPtr(dstUUID)})
+	if err != nil {
+		return nil, err
+	}
+	switch existing.GetStatus() {
+	case shared.DestinationStatus_DELETING, shared.DestinationStatus_DELETED:
+		return nil, &shared.EntityNotExistsError{
+			Message: fmt.Sprintf("Destination %s does not exist", dstUUID),
+		}
+	}
+
+	version := int32(1)
+	latest, err := s.ReadDestinationSchema(nil, dstUUID, 0)
+	switch err.(type) {
+	case nil:
+		if err = common.CheckSchemaCompatibility(latest, schema); err != nil {
+			return nil, &shared.BadRequestError{
+				Message: fmt.Sprintf("CreateDestinationSchema: incompatible with version %d: %v", latest.GetVersion(), err),
+			}
+		}
+		version = latest.GetVersion() + 1
+	case *shared.EntityNotExistsError:
+	default:
+		return nil, err
+	}
+
+	applied, err := s.insertDestinationSchema(dstUUID, version, schema)
+	if err != nil {
+		return nil, err
+	}
+	if !applied {
+		return nil, &shared.EntityAlreadyExistsError{
+			Message: fmt.Sprintf("CreateDestinationSchema: version %d was created concurrently, retry", version),
+		}
+	}
+
+	s.recordUserOperation(
+		existing.GetPath(),
+		dstUUID,
+		entityTypeDst,
+		getThriftContextValue(ctx, common.CallerUserName),
+		"", //place holder for user's email
+		getThriftContextValue(ctx, common.CallerServiceName),
+		getThriftContextValue(ctx, common.CallerHostName),
+		opsCreateSchema,
+		time.Now(),
+		marshalRequest(schema))
+
+	return s.ReadDestinationSchema(nil, dstUUID, version)
+}
+
+// ReadDestinationSchema returns the given version of the schema of the destination,
+// or the latest version if version is zero
+func (s *CassandraMetadataService) ReadDestinationSchema(ctx thrift.Context, dstUUID string, version int32) (*shared.SchemaInfo, error) {
+	var query *gocql.Query
+	if version > 0 {
+		query = s.session.Query(sqlGetDstSchema, dstUUID, version)
+	} else {
+		query = s.session.Query(sqlGetLatestDstSchema, dstUUID)
+	}
+
+	iter := query.Consistency(s.lowConsLevel).Iter()
+	schema := scanDestinationSchema(iter)
+	if err := iter.Close(); err != nil {
+		return nil, &shared.InternalServiceError{
+			Message: err.Error(),
+		}
+	}
+	if schema == nil {
+		return nil, &shared.EntityNotExistsError{
+			Message: fmt.Sprintf("Schema for destination %s does not exist", dstUUID),
+		}
+	}
+	return schema, nil
+}
+
+// ListDestinationSchemas returns all the versions of the schema of the destination
+func (s *CassandraMetadataService) ListDestinationSchemas(ctx thrift.Context, dstUUID string) ([]*shared.SchemaInfo, error) {
+	iter := s.session.Query(sqlListDstSchemas, dstUUID).Consistency(s.lowConsLevel).Iter()
+
+	var schemas []*shared.SchemaInfo
+	for schema := scanDestinationSchema(iter); schema != nil; schema = scanDestinationSchema(iter) {
+		schemas = append(schemas, schema)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, &shared.InternalServiceError{
+			Message: err.Error(),
+		}
+	}
+	return schemas, nil
+}
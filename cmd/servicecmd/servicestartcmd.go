@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 
@@ -71,7 +72,9 @@ func StartInputHostService() {
 	dClient := dconfigclient.NewDconfigClient(cfg.GetServiceConfig(serviceName), serviceName)
 
 	sCommon := common.NewService(serviceName, uuid.New(), cfg.GetServiceConfig(serviceName), common.NewUUIDResolver(meta), hwInfoReader, reporter, dClient)
-	h, tc := inputhost.NewInputHost(serviceName, sCommon, meta, nil)
+	h, tc := inputhost.NewInputHost(serviceName, sCommon, meta, &inputhost.InOptions{
+		DrainTimeout: time.Duration(common.HostDrainTimeoutSeconds) * time.Second,
+	})
 	h.Start(tc)
 
 	// start websocket server
@@ -101,7 +104,7 @@ func StartControllerService() {
 	sVice := common.NewService(serviceName, uuid.New(), cfg.GetServiceConfig(serviceName), common.NewUUIDResolver(meta), hwInfoReader, reporter, dClient)
 	mcp, tc := controllerhost.NewController(cfg, sVice, meta)
 	mcp.Start(tc)
-	common.ServiceLoop(cfg.GetServiceConfig(serviceName).GetPort()+diagnosticPortOffset, cfg, mcp.Service)
+	common.ServiceLoop(cfg.GetServiceConfig(serviceName).GetPort()+diagnosticPortOffset, cfg, mcp.Service, mcp)
 }
 
 //StartFrontendHostService starts the frontendhost service of cherami
@@ -71,12 +71,18 @@ func main() {
 			Usage:  "Host:port for frontend host",
 			EnvVar: "CHERAMI_FRONTEND_HOSTPORT",
 		},
+		cli.StringFlag{
+			Name:   "controller_hostport, ch",
+			Value:  "",
+			Usage:  "Host:port for the http admin endpoint (diagnostic port) of the controller",
+			EnvVar: "CHERAMI_CONTROLLER_HOSTPORT",
+		},
 	}
 	app.Commands = []cli.Command{
 		{
 			Name:    "create",
 			Aliases: []string{"c", "cr"},
-			Usage:   "create (destination | consumergroup)",
+			Usage:   "create (destination | consumergroup | alias | schema)",
 			Subcommands: []cli.Command{
 				{
 					Name:    "destination",
@@ -150,12 +156,42 @@ func main() {
 						admin.CreateConsumerGroup(c, cliHelper)
 					},
 				},
+				{
+					Name:    "alias",
+					Aliases: []string{"a"},
+					Usage:   "create alias <destination_path> <alias_path>",
+					Action: func(c *cli.Context) {
+						admin.CreateDestinationAlias(c)
+					},
+				},
+				{
+					Name:  "schema",
+					Usage: "create schema <destination_path> --type (json | thrift | avro) [--file <schema_file>] [--source <idl_reference>]; adds a new version, requires controller_hostport",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "type, t",
+							Value: "json",
+							Usage: "type of the schema: json schemas are enforced on publish, thrift and avro schemas are IDL references",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "file with the schema",
+						},
+						cli.StringFlag{
+							Name:  "source, s",
+							Usage: "reference to the source of the schema, e.g. a repository link",
+						},
+					},
+					Action: func(c *cli.Context) {
+						admin.CreateDestinationSchema(c)
+					},
+				},
 			},
 		},
 		{
 			Name:    "show",
 			Aliases: []string{"s", "sh", "info", "i"},
-			Usage:   "show (destination | consumergroup | extent | storehost | message | dlq | cgAckID | cgqueue | destqueue | cgBacklog)",
+			Usage:   "show (destination | consumergroup | schema | extent | storehost | rereplication | rebalance | verifier | leader | events | controller | retention | message | dlq | cgAckID | cgqueue | destqueue | cgBacklog)",
 			Subcommands: []cli.Command{
 				{
 					Name:    "destination",
@@ -167,6 +203,11 @@ func main() {
 							Value: "false",
 							Usage: "show consumer group(false, true), default to false",
 						},
+						cli.StringFlag{
+							Name:  "showaliases, sa",
+							Value: "false",
+							Usage: "show aliases(false, true), default to false; requires controller_hostport",
+						},
 					},
 					Action: func(c *cli.Context) {
 						admin.ReadDestination(c)
@@ -175,11 +216,24 @@ func main() {
 				{
 					Name:    "consumergroup",
 					Aliases: []string{"c", "cg"},
-					Usage:   "show consumergroup (<consumer_group_uuid> | <destination_path> <consumer_group_name>)",
+					Usage:   "show consumergroup (<consumer_group_uuid> | <destination_path> <consumer_group_name>); shows the retention override too, if controller_hostport is set",
 					Action: func(c *cli.Context) {
 						admin.ReadConsumerGroup(c)
 					},
 				},
+				{
+					Name:  "schema",
+					Usage: "show schema <destination_path> [--version <version>]; requires controller_hostport",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "version, v",
+							Usage: "version of the schema, all versions are shown by default",
+						},
+					},
+					Action: func(c *cli.Context) {
+						admin.ReadDestinationSchema(c)
+					},
+				},
 				{
 					Name:    "extent",
 					Aliases: []string{"e"},
@@ -210,6 +264,62 @@ func main() {
 						admin.ReadStoreHost(c)
 					},
 				},
+				{
+					Name:    "rereplication",
+					Aliases: []string{"rr"},
+					Usage:   "show rereplication; lists the extents being re-replicated off lost store hosts, requires controller_hostport",
+					Action: func(c *cli.Context) {
+						admin.ReadStoreReReplication(c)
+					},
+				},
+				{
+					Name:    "rebalance",
+					Aliases: []string{"rb"},
+					Usage:   "show rebalance; lists the moves of the last rebalancing round of the controller, requires controller_hostport",
+					Action: func(c *cli.Context) {
+						admin.ReadRebalance(c)
+					},
+				},
+				{
+					Name:    "verifier",
+					Aliases: []string{"vf"},
+					Usage:   "show verifier; lists the extents compared by the last round of the replica verifier of the controller, requires controller_hostport",
+					Action: func(c *cli.Context) {
+						admin.ReadReplicaVerifier(c)
+					},
+				},
+				{
+					Name:    "leader",
+					Aliases: []string{"ld"},
+					Usage:   "show leader; lists the controllers that run the background loops, requires controller_hostport",
+					Action: func(c *cli.Context) {
+						admin.ReadLeader(c)
+					},
+				},
+				{
+					Name:    "events",
+					Aliases: []string{"ev"},
+					Usage:   "show events; lists the pending and failed events of the controller event journal, requires controller_hostport",
+					Action: func(c *cli.Context) {
+						admin.ReadEvents(c)
+					},
+				},
+				{
+					Name:    "controller",
+					Aliases: []string{"ctl"},
+					Usage:   "show controller; lists the in-flight events and the held locks of the controller event pipeline, requires controller_hostport",
+					Action: func(c *cli.Context) {
+						admin.ReadController(c)
+					},
+				},
+				{
+					Name:    "retention",
+					Aliases: []string{"ret"},
+					Usage:   "show retention (<destination_uuid> | <destination_path>); explains the retention of each extent of the destination, requires controller_hostport",
+					Action: func(c *cli.Context) {
+						admin.ReadRetention(c)
+					},
+				},
 				{
 					Name:    "message",
 					Aliases: []string{"m"},
@@ -277,7 +387,7 @@ func main() {
 		{
 			Name:    "update",
 			Aliases: []string{"u"},
-			Usage:   "update (destination | consumergroup | storehost)",
+			Usage:   "update (destination | consumergroup | cgretention | storehost)",
 			Subcommands: []cli.Command{
 				{
 					Name:    "destination",
@@ -350,12 +460,30 @@ func main() {
 						admin.UpdateConsumerGroup(c)
 					},
 				},
+				{
+					Name:    "cgretention",
+					Aliases: []string{"cgr"},
+					Usage:   "update cgretention (<consumer_group_uuid> | <destination_path> <consumer_group_name>) [--protect] [--exclude_after_inactive_days <days>]; requires controller_hostport",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "protect, p",
+							Usage: "keep the messages the consumer group has not acked, even past the hard retention of the destination",
+						},
+						cli.IntFlag{
+							Name:  "exclude_after_inactive_days, x",
+							Usage: "leave the consumer group out of the soft retention of the destination after this many days without acks, 0 to never",
+						},
+					},
+					Action: func(c *cli.Context) {
+						admin.UpdateConsumerGroupRetention(c)
+					},
+				},
 			},
 		},
 		{
 			Name:    "delete",
 			Aliases: []string{"d"},
-			Usage:   "delete (destination | consumergroup)",
+			Usage:   "delete (destination | consumergroup | alias)",
 			Subcommands: []cli.Command{
 				{
 					Name:    "destination",
@@ -375,6 +503,96 @@ func main() {
 						println("deleted consumergroup: ", c.Args()[0], c.Args()[1])
 					},
 				},
+				{
+					Name:    "alias",
+					Aliases: []string{"a"},
+					Usage:   "delete alias <alias_path>",
+					Action: func(c *cli.Context) {
+						admin.DeleteDestinationAlias(c)
+						println("deleted alias: ", c.Args().First())
+					},
+				},
+			},
+		},
+		{
+			Name:    "rename",
+			Aliases: []string{"mv"},
+			Usage:   "rename (destination)",
+			Subcommands: []cli.Command{
+				{
+					Name:    "destination",
+					Aliases: []string{"d", "dst"},
+					Usage:   "rename destination <destination_path> <new_destination_path>; the old path remains as an alias",
+					Action: func(c *cli.Context) {
+						admin.RenameDestination(c)
+					},
+				},
+			},
+		},
+		{
+			Name:  "drain",
+			Usage: "drain (storehost)",
+			Subcommands: []cli.Command{
+				{
+					Name:    "storehost",
+					Aliases: []string{"s"},
+					Usage:   "drain storehost <storehost_uuid>; seals and moves the extents of the store host to other store hosts, requires controller_hostport",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "status, s",
+							Value: "false",
+							Usage: "only show the progress of the drain(false, true), default to false",
+						},
+						cli.StringFlag{
+							Name:  "cancel, c",
+							Value: "false",
+							Usage: "stop draining the store host(false, true), default to false",
+						},
+					},
+					Action: func(c *cli.Context) {
+						admin.DrainStoreHost(c)
+					},
+				},
+			},
+		},
+		{
+			Name:  "verify",
+			Usage: "verify (extent)",
+			Subcommands: []cli.Command{
+				{
+					Name:    "extent",
+					Aliases: []string{"e", "ext"},
+					Usage:   "verify extent <extent_uuid>; compares the messages held by the replicas of a sealed extent, requires controller_hostport",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "repair, r",
+							Value: "false",
+							Usage: "replace a replica that differs from the majority of the replicas(false, true), default to false",
+						},
+						cli.IntFlag{
+							Name:  "max_msgs, m",
+							Value: 0,
+							Usage: "max number of messages to compare, default to 0 which compares the whole extent",
+						},
+					},
+					Action: func(c *cli.Context) {
+						admin.VerifyExtent(c)
+					},
+				},
+			},
+		},
+		{
+			Name:  "cancel",
+			Usage: "cancel (event)",
+			Subcommands: []cli.Command{
+				{
+					Name:    "event",
+					Aliases: []string{"ev"},
+					Usage:   "cancel event <event_uuid>; removes a stuck event from the controller event journal, requires controller_hostport",
+					Action: func(c *cli.Context) {
+						admin.CancelEvent(c)
+					},
+				},
 			},
 		},
 		{
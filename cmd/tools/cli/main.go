@@ -81,6 +81,12 @@ func main() {
 			Usage:  "Host:port for frontend host",
 			EnvVar: "CHERAMI_FRONTEND_HOSTPORT",
 		},
+		cli.StringFlag{
+			Name:   "controller_hostport, ch",
+			Value:  "",
+			Usage:  "Host:port for the http admin endpoint (diagnostic port) of the controller",
+			EnvVar: "CHERAMI_CONTROLLER_HOSTPORT",
+		},
 	}
 	app.Commands = []cli.Command{
 		{
@@ -189,7 +195,7 @@ func main() {
 				{
 					Name:    "consumergroup",
 					Aliases: []string{"c", "cg"},
-					Usage:   "show consumergroup (<consumer_group_uuid> | <destination_path> <consumer_group_name>)",
+					Usage:   "show consumergroup (<consumer_group_uuid> | <destination_path> <consumer_group_name>); shows the retention override too, if controller_hostport is set",
 					Action: func(c *cli.Context) {
 						lib.ReadConsumerGroup(c)
 					},
@@ -20,10 +20,17 @@
 
 package configure
 
+import "time"
+
+// defaultAckLevelShipInterval is how often the ack levels of multi-zone
+// consumer groups are shipped to the other zones, unless configured
+const defaultAckLevelShipInterval = 30 * time.Second
+
 // ReplicatorConfig -- contains config info passed to replicator
 type ReplicatorConfig struct {
-	DefaultAuthoritativeZone string            `yaml:"DefaultAuthoritativeZone"`
-	ReplicatorHosts          map[string]string `yaml:"ReplicatorHosts"`
+	DefaultAuthoritativeZone    string            `yaml:"DefaultAuthoritativeZone"`
+	ReplicatorHosts             map[string]string `yaml:"ReplicatorHosts"`
+	AckLevelShipIntervalSeconds int               `yaml:"AckLevelShipIntervalSeconds"`
 }
 
 // NewCommonReplicatorConfig returns the replicator config
@@ -42,3 +49,12 @@ func (r *ReplicatorConfig) GetReplicatorHosts() map[string]string {
 func (r *ReplicatorConfig) GetDefaultAuthoritativeZone() string {
 	return r.DefaultAuthoritativeZone
 }
+
+// GetAckLevelShipInterval returns how often the ack levels of multi-zone
+// consumer groups are shipped to the other zones
+func (r *ReplicatorConfig) GetAckLevelShipInterval() time.Duration {
+	if r.AckLevelShipIntervalSeconds <= 0 {
+		return defaultAckLevelShipInterval
+	}
+	return time.Duration(r.AckLevelShipIntervalSeconds) * time.Second
+}
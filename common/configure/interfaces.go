@@ -22,6 +22,7 @@ package configure
 
 import (
 	"net"
+	"time"
 
 	"github.com/uber-common/bark"
 	"github.com/uber/tchannel-go"
@@ -195,6 +196,8 @@ type (
 		GetReplicatorHosts() map[string]string
 		// GetDefaultAuthoritativeZone returns the default authoritative zone from config
 		GetDefaultAuthoritativeZone() string
+		// GetAckLevelShipInterval returns how often the ack levels of multi-zone consumer groups are shipped to the other zones
+		GetAckLevelShipInterval() time.Duration
 	}
 
 	// CommonFrontendConfig holds the frontend related config
@@ -63,4 +63,33 @@ const (
 
 	// InputHostForRemoteExtent is a special (and fake) input host ID for remote extent
 	InputHostForRemoteExtent = "88888888-8888-8888-8888-888888888888"
+
+	// MessageTTLSecondsKey is the user context key of a PutMessage that carries the
+	// time-to-live of the message, in seconds. The message is not delivered to
+	// consumers once its TTL has elapsed.
+	MessageTTLSecondsKey = "cherami-message-ttl-seconds"
+
+	// MessageChunkIndexKey is the user context key of a PutMessage that carries the
+	// index of the chunk, for messages that were split up by the inputhost
+	MessageChunkIndexKey = "cherami-chunk-index"
+
+	// MessageChunkCountKey is the user context key of a PutMessage that carries the
+	// total number of chunks of the message it is a chunk of
+	MessageChunkCountKey = "cherami-chunk-count"
+
+	// ThrottlePauseMillisKey is the user context key of a THROTTLED PutMessageAck that
+	// carries the duration, in milliseconds, the publisher should pause before retrying
+	ThrottlePauseMillisKey = "cherami-throttle-pause-ms"
+
+	// ThrottleRateKey is the user context key of a THROTTLED PutMessageAck that carries
+	// the publish rate, in messages per second, the publisher should stay under
+	ThrottleRateKey = "cherami-throttle-rate"
+
+	// PublishErrorKey is the user context key of a failed PutMessageAck that carries
+	// the type of the error, for the errors that the publisher should not retry
+	PublishErrorKey = "cherami-publish-error"
+
+	// PublishErrorSchemaValidation is the PublishErrorKey value for messages whose
+	// payload doesn't satisfy the schema of the destination
+	PublishErrorSchemaValidation = "schema-validation"
 )
@@ -0,0 +1,345 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+)
+
+// Supported types of destination schemas. JSON schemas are enforced
+// on publish; Thrift and Avro schemas are references to the IDL of
+// the payload (e.g. a repository link), which are recorded for the
+// consumers but can't be enforced by the inputhost.
+const (
+	// SchemaTypeJSON is a JSON Schema that the payloads must satisfy
+	SchemaTypeJSON = "json"
+	// SchemaTypeThrift is a reference to the Thrift IDL of the payloads
+	SchemaTypeThrift = "thrift"
+	// SchemaTypeAvro is a reference to the Avro IDL of the payloads
+	SchemaTypeAvro = "avro"
+)
+
+type (
+	// PayloadValidator validates the payloads published to a destination
+	PayloadValidator interface {
+		Validate(data []byte) error
+	}
+
+	// jsonSchema is the subset of JSON Schema that is supported:
+	// type, properties, required, items, enum and a boolean
+	// additionalProperties
+	jsonSchema struct {
+		Type                 jsonSchemaTypes        `json:"type"`
+		Properties           map[string]*jsonSchema `json:"properties"`
+		Required             []string               `json:"required"`
+		Items                *jsonSchema            `json:"items"`
+		Enum                 []interface{}          `json:"enum"`
+		AdditionalProperties *bool                  `json:"additionalProperties"`
+	}
+
+	// jsonSchemaTypes is the type keyword, which can
+	// be either a single type or a list of types
+	jsonSchemaTypes []string
+
+	jsonPayloadValidator struct {
+		schema *jsonSchema
+	}
+)
+
+var jsonSchemaTypeNames = map[string]bool{
+	"object":  true,
+	"array":   true,
+	"string":  true,
+	"number":  true,
+	"integer": true,
+	"boolean": true,
+	"null":    true,
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *jsonSchemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = jsonSchemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("type must be a string or a list of strings")
+	}
+	*t = jsonSchemaTypes(list)
+	return nil
+}
+
+func (t jsonSchemaTypes) contains(typeName string) bool {
+	for _, name := range t {
+		if name == typeName || (name == "number" && typeName == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSchemaInfo checks that the given destination schema is well formed
+func ValidateSchemaInfo(schema *shared.SchemaInfo) error {
+	switch schema.GetType() {
+	case SchemaTypeJSON:
+		_, err := parseJSONSchema(schema.GetData())
+		return err
+	case SchemaTypeThrift, SchemaTypeAvro:
+		if len(schema.GetSource()) == 0 && len(schema.GetData()) == 0 {
+			return fmt.Errorf("%v schema must have either a source or data", schema.GetType())
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported schema type: %v", schema.GetType())
+	}
+}
+
+// NewPayloadValidator returns the validator for the payloads of a destination with
+// the given schema. The validator is nil for schema types that are not enforced.
+func NewPayloadValidator(schema *shared.SchemaInfo) (PayloadValidator, error) {
+	if schema.GetType() != SchemaTypeJSON {
+		return nil, ValidateSchemaInfo(schema)
+	}
+	js, err := parseJSONSchema(schema.GetData())
+	if err != nil {
+		return nil, err
+	}
+	return &jsonPayloadValidator{schema: js}, nil
+}
+
+// CheckSchemaCompatibility checks that the next version of a destination schema
+// is compatible with the previous one. Consumers may still be decoding with the
+// previous version, hence every payload that is valid with the next version has
+// to be valid with the previous one as well. For JSON schemas this means that
+// types can only be narrowed, enums can only shrink, required properties can't
+// be dropped and closed objects can't get new properties. IDL references can't
+// be checked, but the type of the schema must not change.
+func CheckSchemaCompatibility(prev *shared.SchemaInfo, next *shared.SchemaInfo) error {
+	if prev.GetType() != next.GetType() {
+		return fmt.Errorf("schema type can't be changed from %v to %v", prev.GetType(), next.GetType())
+	}
+	if next.GetType() != SchemaTypeJSON {
+		return nil
+	}
+
+	prevSchema, err := parseJSONSchema(prev.GetData())
+	if err != nil {
+		return err
+	}
+	nextSchema, err := parseJSONSchema(next.GetData())
+	if err != nil {
+		return err
+	}
+	return checkJSONSchemaCompatibility(prevSchema, nextSchema, "$")
+}
+
+// Validate implements PayloadValidator
+func (v *jsonPayloadValidator) Validate(data []byte) error {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("payload is not valid JSON: %v", err)
+	}
+	if decoder.More() {
+		return errors.New("payload is not valid JSON: trailing data")
+	}
+	return v.schema.validate(value, "$")
+}
+
+func parseJSONSchema(data []byte) (*jsonSchema, error) {
+	schema := &jsonSchema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %v", err)
+	}
+	if err := schema.check("$"); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %v", err)
+	}
+	return schema, nil
+}
+
+// check makes sure that all the type names in the schema are known
+func (s *jsonSchema) check(path string) error {
+	for _, name := range s.Type {
+		if !jsonSchemaTypeNames[name] {
+			return fmt.Errorf("%v: unknown type %v", path, name)
+		}
+	}
+	for name, prop := range s.Properties {
+		if prop == nil {
+			return fmt.Errorf("%v.%v: missing schema", path, name)
+		}
+		if err := prop.check(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.check(path + "[]")
+	}
+	return nil
+}
+
+func (s *jsonSchema) validate(value interface{}, path string) error {
+	if len(s.Type) > 0 && !s.Type.contains(jsonTypeOf(value)) {
+		return fmt.Errorf("%v: expected %v, found %v", path, strings.Join(s.Type, " or "), jsonTypeOf(value))
+	}
+
+	if len(s.Enum) > 0 && !jsonEnumContains(s.Enum, value) {
+		return fmt.Errorf("%v: value is not one of the allowed values", path)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%v: missing required property %v", path, name)
+			}
+		}
+		for name, propValue := range v {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%v: unexpected property %v", path, name)
+				}
+				continue
+			}
+			if err := prop.validate(propValue, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(item, fmt.Sprintf("%v[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func checkJSONSchemaCompatibility(prev *jsonSchema, next *jsonSchema, path string) error {
+	if len(prev.Type) > 0 {
+		if len(next.Type) == 0 {
+			return fmt.Errorf("%v: type constraint can't be removed", path)
+		}
+		for _, name := range next.Type {
+			if !prev.Type.contains(name) {
+				return fmt.Errorf("%v: type %v is not allowed by the previous version", path, name)
+			}
+		}
+	}
+
+	if len(prev.Enum) > 0 {
+		if len(next.Enum) == 0 {
+			return fmt.Errorf("%v: enum constraint can't be removed", path)
+		}
+		for _, value := range next.Enum {
+			if !jsonEnumContains(prev.Enum, value) {
+				return fmt.Errorf("%v: enum value %v is not allowed by the previous version", path, value)
+			}
+		}
+	}
+
+	for _, name := range prev.Required {
+		if !stringInSlice(name, next.Required) {
+			return fmt.Errorf("%v: required property %v can't be made optional", path, name)
+		}
+	}
+
+	if prev.AdditionalProperties != nil && !*prev.AdditionalProperties {
+		if next.AdditionalProperties == nil || *next.AdditionalProperties {
+			return fmt.Errorf("%v: additional properties can't be allowed", path)
+		}
+		for name := range next.Properties {
+			if _, ok := prev.Properties[name]; !ok {
+				return fmt.Errorf("%v: property %v is not allowed by the previous version", path, name)
+			}
+		}
+	}
+
+	for name, prevProp := range prev.Properties {
+		nextProp, ok := next.Properties[name]
+		if !ok {
+			return fmt.Errorf("%v: property %v can't be removed", path, name)
+		}
+		if err := checkJSONSchemaCompatibility(prevProp, nextProp, path+"."+name); err != nil {
+			return err
+		}
+	}
+
+	if prev.Items != nil {
+		if next.Items == nil {
+			return fmt.Errorf("%v: items constraint can't be removed", path)
+		}
+		return checkJSONSchemaCompatibility(prev.Items, next.Items, path+"[]")
+	}
+	return nil
+}
+
+// jsonTypeOf returns the JSON schema type name of a decoded JSON value
+func jsonTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func jsonEnumContains(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(e, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringInSlice(s string, list []string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
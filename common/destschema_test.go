@@ -0,0 +1,152 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+)
+
+type DestSchemaSuite struct {
+	*require.Assertions
+	suite.Suite
+}
+
+func TestDestSchemaSuite(t *testing.T) {
+	suite.Run(t, new(DestSchemaSuite))
+}
+
+func (s *DestSchemaSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+}
+
+const testJSONSchema = `{
+	"type": "object",
+	"required": ["id", "kind"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "integer"},
+		"kind": {"type": "string", "enum": ["a", "b"]},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"score": {"type": ["number", "null"]}
+	}
+}`
+
+func jsonSchemaInfo(data string) *shared.SchemaInfo {
+	return &shared.SchemaInfo{
+		Type: StringPtr(SchemaTypeJSON),
+		Data: []byte(data),
+	}
+}
+
+func (s *DestSchemaSuite) TestValidateSchemaInfo() {
+	s.NoError(ValidateSchemaInfo(jsonSchemaInfo(testJSONSchema)))
+	s.Error(ValidateSchemaInfo(jsonSchemaInfo(`{"type": "foo"}`)))
+	s.Error(ValidateSchemaInfo(jsonSchemaInfo(`not json`)))
+	s.Error(ValidateSchemaInfo(&shared.SchemaInfo{Type: StringPtr("xml")}))
+	s.Error(ValidateSchemaInfo(&shared.SchemaInfo{Type: StringPtr(SchemaTypeThrift)}))
+	s.NoError(ValidateSchemaInfo(&shared.SchemaInfo{
+		Type:   StringPtr(SchemaTypeAvro),
+		Source: StringPtr("git://idl/foo.avsc"),
+	}))
+}
+
+func (s *DestSchemaSuite) TestValidatePayload() {
+	validator, err := NewPayloadValidator(jsonSchemaInfo(testJSONSchema))
+	s.NoError(err)
+	s.NotNil(validator)
+
+	s.NoError(validator.Validate([]byte(`{"id": 1, "kind": "a"}`)))
+	s.NoError(validator.Validate([]byte(`{"id": 1, "kind": "b", "tags": ["x"], "score": null}`)))
+	s.NoError(validator.Validate([]byte(`{"id": 1, "kind": "b", "score": 0.5}`)))
+
+	s.Error(validator.Validate([]byte(`garbage`)))
+	s.Error(validator.Validate([]byte(`{"id": 1, "kind": "a"} {}`)))
+	s.Error(validator.Validate([]byte(`[]`)))
+	s.Error(validator.Validate([]byte(`{"id": 1}`)))
+	s.Error(validator.Validate([]byte(`{"id": 1.5, "kind": "a"}`)))
+	s.Error(validator.Validate([]byte(`{"id": 1, "kind": "c"}`)))
+	s.Error(validator.Validate([]byte(`{"id": 1, "kind": "a", "tags": [1]}`)))
+	s.Error(validator.Validate([]byte(`{"id": 1, "kind": "a", "other": true}`)))
+
+	// IDL references are not enforced
+	validator, err = NewPayloadValidator(&shared.SchemaInfo{
+		Type:   StringPtr(SchemaTypeThrift),
+		Source: StringPtr("git://idl/foo.thrift"),
+	})
+	s.NoError(err)
+	s.Nil(validator)
+}
+
+func (s *DestSchemaSuite) TestSchemaCompatibility() {
+	prev := jsonSchemaInfo(testJSONSchema)
+
+	compatible := []string{
+		testJSONSchema,
+		// narrowed type
+		`{"type": "object", "required": ["id", "kind"], "additionalProperties": false, "properties": {
+			"id": {"type": "integer"}, "kind": {"type": "string", "enum": ["a", "b"]},
+			"tags": {"type": "array", "items": {"type": "string"}}, "score": {"type": "number"}}}`,
+		// shrunk enum, new required property
+		`{"type": "object", "required": ["id", "kind", "tags"], "additionalProperties": false, "properties": {
+			"id": {"type": "integer"}, "kind": {"type": "string", "enum": ["a"]},
+			"tags": {"type": "array", "items": {"type": "string"}}, "score": {"type": ["number", "null"]}}}`,
+	}
+	for _, next := range compatible {
+		s.NoError(CheckSchemaCompatibility(prev, jsonSchemaInfo(next)), next)
+	}
+
+	incompatible := []string{
+		// widened type
+		`{"type": "object", "required": ["id", "kind"], "additionalProperties": false, "properties": {
+			"id": {"type": "number"}, "kind": {"type": "string", "enum": ["a", "b"]},
+			"tags": {"type": "array", "items": {"type": "string"}}, "score": {"type": ["number", "null"]}}}`,
+		// optional property that used to be required
+		`{"type": "object", "required": ["id"], "additionalProperties": false, "properties": {
+			"id": {"type": "integer"}, "kind": {"type": "string", "enum": ["a", "b"]},
+			"tags": {"type": "array", "items": {"type": "string"}}, "score": {"type": ["number", "null"]}}}`,
+		// grown enum
+		`{"type": "object", "required": ["id", "kind"], "additionalProperties": false, "properties": {
+			"id": {"type": "integer"}, "kind": {"type": "string", "enum": ["a", "b", "c"]},
+			"tags": {"type": "array", "items": {"type": "string"}}, "score": {"type": ["number", "null"]}}}`,
+		// new property on a closed object
+		`{"type": "object", "required": ["id", "kind"], "additionalProperties": false, "properties": {
+			"id": {"type": "integer"}, "kind": {"type": "string", "enum": ["a", "b"]},
+			"tags": {"type": "array", "items": {"type": "string"}}, "score": {"type": ["number", "null"]},
+			"other": {"type": "string"}}}`,
+		// opened object
+		`{"type": "object", "required": ["id", "kind"], "properties": {
+			"id": {"type": "integer"}, "kind": {"type": "string", "enum": ["a", "b"]},
+			"tags": {"type": "array", "items": {"type": "string"}}, "score": {"type": ["number", "null"]}}}`,
+	}
+	for _, next := range incompatible {
+		s.Error(CheckSchemaCompatibility(prev, jsonSchemaInfo(next)), next)
+	}
+
+	// the schema type can't change
+	s.Error(CheckSchemaCompatibility(prev, &shared.SchemaInfo{
+		Type:   StringPtr(SchemaTypeAvro),
+		Source: StringPtr("git://idl/foo.avsc"),
+	}))
+}
@@ -40,6 +40,13 @@ type HTTPHandler struct {
 	service *Service
 }
 
+// HTTPHandlerRegistrar is implemented by services
+// that serve additional http endpoints on the
+// diagnostic port, next to the common ones.
+type HTTPHandlerRegistrar interface {
+	RegisterHTTPHandlers(mux *http.ServeMux)
+}
+
 const (
 	serviceURLParam = "service"
 )
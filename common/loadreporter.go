@@ -61,6 +61,7 @@ type (
 		ReportConsumerGroupMetric(destinationUUID string, consumerGroupUUID string, metrics controller.ConsumerGroupMetrics) error
 		ReportConsumerGroupExtentMetric(destinationUUID string, consumerGroupUUID string, extentUUID string, metrics controller.ConsumerGroupExtentMetrics) error
 		ReportStoreExtentMetric(extentUUID string, metrics controller.StoreExtentMetrics) error
+		ReportReplicatingStoreExtentMetric(extentUUID string, metrics controller.StoreExtentMetrics, lag ReplicationLag) error
 	}
 
 	loadReporterDaemonFactoryImpl struct {
@@ -275,6 +276,16 @@ func (d *loadReporterImpl) ReportConsumerGroupExtentMetric(destinationUUID strin
 
 // ReportStoreExtentMetric is the API exposed by LoadReporter for reporting store extent load to controller
 func (d *loadReporterImpl) ReportStoreExtentMetric(extentUUID string, metrics controller.StoreExtentMetrics) error {
+	return d.reportStoreExtentMetric(extentUUID, metrics, nil)
+}
+
+// ReportReplicatingStoreExtentMetric is the API exposed by LoadReporter for reporting the load
+// of a store extent that is being replicated, along with its replication lag, to controller
+func (d *loadReporterImpl) ReportReplicatingStoreExtentMetric(extentUUID string, metrics controller.StoreExtentMetrics, lag ReplicationLag) error {
+	return d.reportStoreExtentMetric(extentUUID, metrics, &lag)
+}
+
+func (d *loadReporterImpl) reportStoreExtentMetric(extentUUID string, metrics controller.StoreExtentMetrics, lag *ReplicationLag) error {
 	controllerClient, err := d.getControllerClient()
 	if err != nil {
 		return err
@@ -290,7 +301,7 @@ func (d *loadReporterImpl) ReportStoreExtentMetric(extentUUID string, metrics co
 	ctx, cancel := thrift.NewContext(reportLoadMetricThriftTimeout)
 	defer cancel()
 
-	return controllerClient.ReportStoreExtentMetric(ctx, request)
+	return controllerClient.ReportStoreExtentMetric(WithReplicationLag(ctx, lag), request)
 }
 
 func (d *loadReporterImpl) getControllerClient() (controller.TChanController, error) {
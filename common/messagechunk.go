@@ -0,0 +1,114 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"strconv"
+
+	"github.com/uber/cherami-thrift/.generated/go/cherami"
+)
+
+// SplitMessage splits the payload of the given message into chunks of at most chunkSize
+// bytes. Every chunk carries all the other fields of the original message, e.g. the ID and
+// the checksum, and its position in the user context. Messages that fit in one chunk are
+// returned as is.
+func SplitMessage(msg *cherami.PutMessage, chunkSize int) []*cherami.PutMessage {
+	data := msg.GetData()
+	if chunkSize <= 0 || len(data) <= chunkSize {
+		return []*cherami.PutMessage{msg}
+	}
+
+	count := (len(data) + chunkSize - 1) / chunkSize
+	chunks := make([]*cherami.PutMessage, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		userContext := make(map[string]string, len(msg.GetUserContext())+2)
+		for k, v := range msg.GetUserContext() {
+			userContext[k] = v
+		}
+		userContext[MessageChunkIndexKey] = strconv.Itoa(i)
+		userContext[MessageChunkCountKey] = strconv.Itoa(count)
+
+		chunk := *msg
+		chunk.Data = data[i*chunkSize : end]
+		chunk.UserContext = userContext
+		chunks = append(chunks, &chunk)
+	}
+	return chunks
+}
+
+// GetMessageChunk returns the index of the given chunk and the number of chunks of the
+// message it belongs to; ok is false if the message is not a chunk
+func GetMessageChunk(msg *cherami.PutMessage) (index int, count int, ok bool) {
+	if msg == nil {
+		return 0, 0, false
+	}
+
+	userContext := msg.GetUserContext()
+	idxStr, idxOk := userContext[MessageChunkIndexKey]
+	countStr, countOk := userContext[MessageChunkCountKey]
+	if !idxOk || !countOk {
+		return 0, 0, false
+	}
+
+	var err error
+	if index, err = strconv.Atoi(idxStr); err != nil {
+		return 0, 0, false
+	}
+	if count, err = strconv.Atoi(countStr); err != nil || index < 0 || index >= count {
+		return 0, 0, false
+	}
+	return index, count, true
+}
+
+// JoinMessageChunks reassembles a message from all of its chunks, in order
+func JoinMessageChunks(chunks []*cherami.PutMessage) *cherami.PutMessage {
+	last := chunks[len(chunks)-1]
+
+	size := 0
+	for _, chunk := range chunks {
+		size += len(chunk.GetData())
+	}
+	data := make([]byte, 0, size)
+	for _, chunk := range chunks {
+		data = append(data, chunk.GetData()...)
+	}
+
+	var userContext map[string]string
+	for k, v := range last.GetUserContext() {
+		if k == MessageChunkIndexKey || k == MessageChunkCountKey {
+			continue
+		}
+		if userContext == nil {
+			userContext = make(map[string]string)
+		}
+		userContext[k] = v
+	}
+
+	msg := *last
+	msg.Data = data
+	msg.UserContext = userContext
+	return &msg
+}
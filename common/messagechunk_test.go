@@ -0,0 +1,103 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/uber/cherami-thrift/.generated/go/cherami"
+)
+
+type MessageChunkSuite struct {
+	*require.Assertions
+	suite.Suite
+}
+
+func TestMessageChunkSuite(t *testing.T) {
+	suite.Run(t, new(MessageChunkSuite))
+}
+
+func (s *MessageChunkSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+}
+
+func (s *MessageChunkSuite) TestSplitSmallMessage() {
+	msg := &cherami.PutMessage{
+		ID:   StringPtr(`small`),
+		Data: []byte(`abc`),
+	}
+
+	chunks := SplitMessage(msg, 3)
+	s.Equal(1, len(chunks))
+	s.True(chunks[0] == msg, `message that fits in a chunk should not be copied`)
+
+	_, _, ok := GetMessageChunk(chunks[0])
+	s.False(ok)
+}
+
+func (s *MessageChunkSuite) TestSplitAndJoin() {
+	data := bytes.Repeat([]byte(`0123456789`), 10)
+	msg := &cherami.PutMessage{
+		ID:                    StringPtr(`large`),
+		DelayMessageInSeconds: Int32Ptr(5),
+		Data:                  data,
+		UserContext:           map[string]string{`foo`: `bar`},
+	}
+
+	chunks := SplitMessage(msg, 30)
+	s.Equal(4, len(chunks))
+	for i, chunk := range chunks {
+		index, count, ok := GetMessageChunk(chunk)
+		s.True(ok)
+		s.Equal(i, index)
+		s.Equal(4, count)
+		s.Equal(`large`, chunk.GetID())
+		s.Equal(`bar`, chunk.GetUserContext()[`foo`])
+	}
+	s.Equal(10, len(chunks[3].GetData()))
+
+	// the original message is not modified
+	s.Equal(1, len(msg.GetUserContext()))
+
+	joined := JoinMessageChunks(chunks)
+	s.Equal(data, joined.GetData())
+	s.Equal(`large`, joined.GetID())
+	s.EqualValues(5, joined.GetDelayMessageInSeconds())
+	s.Equal(map[string]string{`foo`: `bar`}, joined.GetUserContext())
+
+	_, _, ok := GetMessageChunk(joined)
+	s.False(ok)
+}
+
+func (s *MessageChunkSuite) TestGetMessageChunkInvalid() {
+	for _, uc := range []map[string]string{
+		{MessageChunkIndexKey: `0`},
+		{MessageChunkIndexKey: `x`, MessageChunkCountKey: `2`},
+		{MessageChunkIndexKey: `2`, MessageChunkCountKey: `2`},
+		{MessageChunkIndexKey: `-1`, MessageChunkCountKey: `2`},
+	} {
+		_, _, ok := GetMessageChunk(&cherami.PutMessage{UserContext: uc})
+		s.False(ok)
+	}
+}
@@ -68,6 +68,7 @@ const (
 	OperationTagName     = "operation"
 	DestinationTagName   = "destination"
 	ConsumerGroupTagName = "consumerGroup"
+	ZoneTagName          = "zone"
 )
 
 // This package should hold all the metrics and tags for cherami
@@ -280,12 +281,26 @@ const (
 	OutputNotifyEventScope
 	// InputFailedEventScope represents event handler
 	InputFailedEventScope
+	// OutputFailedEventScope represents event handler
+	OutputFailedEventScope
 	// StoreFailedEventScope represents event handler
 	StoreFailedEventScope
 	// StoreExtentStatusOutOfSyncEventScope represents an event handler
 	StoreExtentStatusOutOfSyncEventScope
 	// StartReplicationForRemoteZoneExtentScope represents event handler
 	StartReplicationForRemoteZoneExtentScope
+	// ExtentReReplicationEventScope represents event handler
+	ExtentReReplicationEventScope
+	// StoreDrainEventScope represents event handler
+	StoreDrainEventScope
+	// ExtentRollEventScope represents event handler
+	ExtentRollEventScope
+	// RebalancerScope represents the host load rebalancer daemon
+	RebalancerScope
+	// ReplicaVerifierScope represents the replica consistency verifier daemon
+	ReplicaVerifierScope
+	// LeaderElectionScope represents the election of the controller running the background loops
+	LeaderElectionScope
 	// ExtentMonitorScope represents the extent monitor daemon
 	ExtentMonitorScope
 	// RetentionMgrScope represents the retention manager
@@ -308,6 +323,8 @@ const (
 	ControllerCreateRemoteZoneExtentScope
 	// QueueDepthBacklogCGScope represents metrics within queuedepth per consumer group
 	QueueDepthBacklogCGScope
+	// ReplicationLagDestScope represents the replication lag metrics per destination and zone
+	ReplicationLagDestScope
 
 	// -- Operation scopes for FrontendHost --
 
@@ -392,12 +409,30 @@ const (
 	ReplicatorDeleteDestScope
 	// ReplicatorDeleteRmtDestScope represents replicator DeleteRemoteDestination API
 	ReplicatorDeleteRmtDestScope
+	// ReplicatorCreateCgUUIDScope represents replicator CreateConsumerGroupUUID API
+	ReplicatorCreateCgUUIDScope
+	// ReplicatorCreateRmtCgUUIDScope represents replicator CreateRemoteConsumerGroupUUID API
+	ReplicatorCreateRmtCgUUIDScope
+	// ReplicatorUpdateCgScope represents replicator UpdateConsumerGroup API
+	ReplicatorUpdateCgScope
+	// ReplicatorUpdateRmtCgScope represents replicator UpdateRemoteConsumerGroup API
+	ReplicatorUpdateRmtCgScope
+	// ReplicatorDeleteCgScope represents replicator DeleteConsumerGroup API
+	ReplicatorDeleteCgScope
+	// ReplicatorDeleteRmtCgScope represents replicator DeleteRemoteConsumerGroup API
+	ReplicatorDeleteRmtCgScope
 	// ReplicatorCreateExtentScope represents replicator CreateExtent API
 	ReplicatorCreateExtentScope
 	// ReplicatorCreateRmtExtentScope represents replicator CreateRemoteExtent API
 	ReplicatorCreateRmtExtentScope
 	// ReplicatorReconcileScope represents replicator's reconcile process
 	ReplicatorReconcileScope
+	// ReplicatorShipAckLevelsScope represents replicator's shipping of consumer group ack levels
+	ReplicatorShipAckLevelsScope
+	// ReplicatorReceiveAckLevelsScope represents replicator's receiving of consumer group ack levels
+	ReplicatorReceiveAckLevelsScope
+	// ReplicatorListCgScope represents replicator's listing of multi-zone consumer groups for remote reconciliation
+	ReplicatorListCgScope
 )
 
 var scopeDefs = map[ServiceIdx]map[int]scopeDefinition{
@@ -518,9 +553,18 @@ var scopeDefs = map[ServiceIdx]map[int]scopeDefinition{
 		ReplicatorUpdateRmtDestScope:     {operation: "ReplicatorUpdateRemoteDestination"},
 		ReplicatorDeleteDestScope:        {operation: "ReplicatorDeleteDestination"},
 		ReplicatorDeleteRmtDestScope:     {operation: "ReplicatorDeleteRemoteDestination"},
+		ReplicatorCreateCgUUIDScope:      {operation: "ReplicatorCreateConsumerGroupUUID"},
+		ReplicatorCreateRmtCgUUIDScope:   {operation: "ReplicatorCreateRemoteConsumerGroupUUID"},
+		ReplicatorUpdateCgScope:          {operation: "ReplicatorUpdateConsumerGroup"},
+		ReplicatorUpdateRmtCgScope:       {operation: "ReplicatorUpdateRemoteConsumerGroup"},
+		ReplicatorDeleteCgScope:          {operation: "ReplicatorDeleteConsumerGroup"},
+		ReplicatorDeleteRmtCgScope:       {operation: "ReplicatorDeleteRemoteConsumerGroup"},
 		ReplicatorCreateExtentScope:      {operation: "ReplicatorCreateExtent"},
 		ReplicatorCreateRmtExtentScope:   {operation: "ReplicatorCreateRemoteExtent"},
 		ReplicatorReconcileScope:         {operation: "ReplicatorReconcile"},
+		ReplicatorShipAckLevelsScope:     {operation: "ReplicatorShipAckLevels"},
+		ReplicatorReceiveAckLevelsScope:  {operation: "ReplicatorReceiveAckLevels"},
+		ReplicatorListCgScope:            {operation: "ReplicatorListConsumerGroups"},
 	},
 
 	// Controller operation tag values as seen by the Metrics backend
@@ -543,7 +587,14 @@ var scopeDefs = map[ServiceIdx]map[int]scopeDefinition{
 		InputNotifyEventScope:                    {operation: "InputNotifyEvent"},
 		OutputNotifyEventScope:                   {operation: "OutputNotifyEvent"},
 		InputFailedEventScope:                    {operation: "InputFailedEvent"},
+		OutputFailedEventScope:                   {operation: "OutputFailedEvent"},
 		StoreFailedEventScope:                    {operation: "StoreFailedEvent"},
+		ExtentReReplicationEventScope:            {operation: "ExtentReReplicationEvent"},
+		StoreDrainEventScope:                     {operation: "StoreDrainEvent"},
+		ExtentRollEventScope:                     {operation: "ExtentRollEvent"},
+		RebalancerScope:                          {operation: "Rebalancer"},
+		ReplicaVerifierScope:                     {operation: "ReplicaVerifier"},
+		LeaderElectionScope:                      {operation: "LeaderElection"},
 		StoreExtentStatusOutOfSyncEventScope:     {operation: "StoreExtentStatusOutOfSyncEvent"},
 		StartReplicationForRemoteZoneExtentScope: {operation: "StartReplicationForRemoteZoneExtent"},
 		QueueDepthBacklogCGScope:                 {operation: "QueueDepthBacklog"},
@@ -557,6 +608,7 @@ var scopeDefs = map[ServiceIdx]map[int]scopeDefinition{
 		ControllerUpdateConsumerGroupScope:       {operation: "UpdateConsumerGroup"},
 		ControllerDeleteConsumerGroupScope:       {operation: "DeleteConsumerGroup"},
 		ControllerCreateRemoteZoneExtentScope:    {operation: "CreateRemoteZoneExtent"},
+		ReplicationLagDestScope:                  {operation: "ReplicationLag"},
 	},
 }
 
@@ -577,6 +629,7 @@ var dynamicScopeDefs = map[ServiceIdx]map[int]scopeDefinition{
 	// Controller Scope Names
 	Controller: {
 		QueueDepthBacklogCGScope: {operation: "QueueDepthBacklog"},
+		ReplicationLagDestScope:  {operation: "ReplicationLag"},
 	},
 }
 
@@ -608,6 +661,8 @@ const (
 	InputhostMessageLimitThrottled
 	//InputhostMessageChannelFullThrottled indicates the request has been throttled due to the channel being full
 	InputhostMessageChannelFullThrottled
+	// InputhostMessageSchemaRejected indicates the message was rejected, because its payload doesn't satisfy the destination schema
+	InputhostMessageSchemaRejected
 	// InputhostUserFailures indicates this is a user failure (~HTTP 4xx)
 	InputhostUserFailures
 	// InputhostInternalFailures indicates this is an internal failure (HTTP 5xx)
@@ -641,6 +696,9 @@ const (
 	// InputhostDestMessageChannelFullThrottled is used to indicate that this particular destination
 	// is throttled due to the channel being full
 	InputhostDestMessageChannelFullThrottled
+	// InputhostDestMessageSchemaRejected is used to indicate that a message to this particular destination
+	// was rejected, because its payload doesn't satisfy the destination schema
+	InputhostDestMessageSchemaRejected
 	// InputhostDestMessageUserFailures indicates prefix nmae of destinations failure counter
 	// append the destination path will be the actual name for the counter.
 	// each destination has a unique name tag
@@ -679,6 +737,8 @@ const (
 	OutputhostDLQMessageFailures
 	// OutputhostMessageRedelivered records the count of messages redeliverd
 	OutputhostMessageRedelivered
+	// OutputhostMessageExpired records the count of messages not delivered because their TTL elapsed
+	OutputhostMessageExpired
 	// OutputhostMessageSentAck records the count of ack messages
 	OutputhostMessageSentAck
 	// OutputhostMessageSentNAck records the count of nack messages
@@ -713,6 +773,12 @@ const (
 	OutputhostCGDLQMessageFailures
 	// OutputhostCGMessageRedelivered records the count of messages redelivered
 	OutputhostCGMessageRedelivered
+	// OutputhostCGMessageExpired records the count of expired messages consumed on behalf of the consumer group
+	OutputhostCGMessageExpired
+	// OutputhostCGMessageExpiredDLQ records the count of expired messages published to the DLQ
+	OutputhostCGMessageExpiredDLQ
+	// OutputhostCGMessageChunksDropped records the count of chunks dropped because their message was incomplete
+	OutputhostCGMessageChunksDropped
 	// OutputhostCGMessageSentAck records the count of ack messages
 	OutputhostCGMessageSentAck
 	// OutputhostCGMessageSentNAck records the count of nack messages
@@ -879,15 +945,77 @@ const (
 	ControllerGetAddressCompletedCounter
 	// ControllerPurgeMessagesRequestCounter indicates the purge messages request count
 	ControllerPurgeMessagesRequestCounter
+	// ControllerRetentionForcedPurgeCounter is the count of extents purged past the ack level of a consumer group, to enforce size retention
+	ControllerRetentionForcedPurgeCounter
+	// ControllerRetentionFullSweepJobs is the count of retention jobs scheduled by full sweeps
+	ControllerRetentionFullSweepJobs
+	// ControllerRetentionIncrementalJobs is the count of retention jobs scheduled by incremental runs
+	ControllerRetentionIncrementalJobs
+	// ControllerRetentionIncrementalSkipped is the count of unchanged extents skipped by incremental runs
+	ControllerRetentionIncrementalSkipped
 
 	// ControllerLatencyTimer represents time taken by an operation
 	ControllerLatencyTimer
 	// ControllerRetentionJobDuration is the time spent to finish retention on an extent
 	ControllerRetentionJobDuration
+	// ControllerRetentionFullSweepDuration is the time spent by a full sweep to find the extents to schedule
+	ControllerRetentionFullSweepDuration
+	// ControllerRetentionIncrementalDuration is the time spent by an incremental run to find the extents to schedule
+	ControllerRetentionIncrementalDuration
+	// ControllerRetentionSignals is the count of changes signaled to the retention manager
+	ControllerRetentionSignals
 	// ControllerGetAddressLatency is the latency of getAddressFromTS
 	ControllerGetAddressLatency
 	// ControllerPurgeMessagesLatency is the letency of purge messages request
 	ControllerPurgeMessagesLatency
+	// ControllerPublishExtentsScaleUp is the count of times the open publish extents of a destination were scaled up
+	ControllerPublishExtentsScaleUp
+	// ControllerPublishExtentsScaleDown is the count of times the open publish extents of a destination were scaled down
+	ControllerPublishExtentsScaleDown
+	// ControllerSurplusExtentsSealed is the count of surplus publish extents sealed when scaling down
+	ControllerSurplusExtentsSealed
+	// ControllerReReplicationStarted is the count of extent re-replications started after a store host was lost
+	ControllerReReplicationStarted
+	// ControllerReReplicationCompleted is the count of extent re-replications that replaced the lost replica
+	ControllerReReplicationCompleted
+	// ControllerReReplicationFailed is the count of extent re-replications that could not be done
+	ControllerReReplicationFailed
+	// ControllerReReplicationInProgress is the number of extent re-replications in progress
+	ControllerReReplicationInProgress
+	// ControllerRebalanceCGMoves is the count of consumer groups moved off overloaded output hosts
+	ControllerRebalanceCGMoves
+	// ControllerRebalanceExtentMoves is the count of extents sealed on overloaded input hosts
+	ControllerRebalanceExtentMoves
+	// ControllerRebalanceDryRunMoves is the count of moves the rebalancer would have made in dry run mode
+	ControllerRebalanceDryRunMoves
+	// ControllerLeadershipAcquired is the count of times this controller became the leader for a lease
+	ControllerLeadershipAcquired
+	// ControllerLeadershipLost is the count of times this controller lost the leadership for a lease
+	ControllerLeadershipLost
+	// ControllerLeasesHeld is the number of leases held by this controller
+	ControllerLeasesHeld
+	// ControllerEventsJournaled is the count of events saved to the event journal
+	ControllerEventsJournaled
+	// ControllerEventsReplayed is the count of journaled events replayed after their controller went away
+	ControllerEventsReplayed
+	// ControllerEventsCanceled is the count of journaled events canceled by an operator
+	ControllerEventsCanceled
+	// ControllerErrEventJournal indicates a failure to read or write the event journal
+	ControllerErrEventJournal
+	// ControllerExtentsRolledBySize is the count of extents sealed for crossing their size limit
+	ControllerExtentsRolledBySize
+	// ControllerExtentsRolledByAge is the count of extents sealed for crossing their age limit
+	ControllerExtentsRolledByAge
+	// ControllerReplicasVerified is the count of extents whose replicas were compared
+	ControllerReplicasVerified
+	// ControllerReplicasDivergent is the count of extents found with replicas that differ
+	ControllerReplicasDivergent
+	// ControllerReplicasInconclusive is the count of extents whose replicas could not be compared
+	ControllerReplicasInconclusive
+	// ControllerReplicaRepairs is the count of divergent replicas being replaced
+	ControllerReplicaRepairs
+	// ControllerReplicaVerifierRoundSize is the number of extents verified in the last round
+	ControllerReplicaVerifierRoundSize
 
 	// ControllerCGBacklogAvailable is the numbers for availbale back log
 	ControllerCGBacklogAvailable
@@ -899,6 +1027,12 @@ const (
 	ControllerCGBacklogDLQ
 	// ControllerCGBacklogProgress is an indication of progress made on the backlog
 	ControllerCGBacklogProgress
+	// ControllerReplicationLagMsgs is the max replication lag, in messages, of the replicas of a destination
+	ControllerReplicationLagMsgs
+	// ControllerReplicationLagSecs is the max replication lag, in seconds, of the replicas of a destination
+	ControllerReplicationLagSecs
+	// ControllerReplicationLagAlert is the number of replicas of a destination that lag beyond its threshold
+	ControllerReplicationLagAlert
 
 	// -- Replicator metrics -- //
 
@@ -921,6 +1055,13 @@ const (
 	ReplicatorOutConnCreditsSent
 	// ReplicatorOutConnMsgRead indicates how many messages OutConn read
 	ReplicatorOutConnMsgRead
+	// ReplicatorOutConnReplicationLag is the age of the messages OutConn read, when it read them
+	ReplicatorOutConnReplicationLag
+	// ReplicatorOutConnThrottleLatency is the time OutConn held a message back to stay within the zone bandwidth
+	ReplicatorOutConnThrottleLatency
+
+	// ReplicatorStaleUpdate indicates an update from a remote zone lost to the local version
+	ReplicatorStaleUpdate
 
 	// ReplicatorReconcileDestRun indicates the reconcile for dest runs
 	ReplicatorReconcileDestRun
@@ -936,6 +1077,23 @@ const (
 	ReplicatorReconcileDestExtentFoundMissing
 	// ReplicatorReconcileDestExtentInconsistentStatus indicates the reconcile for dest extent found an inconsistent extent status
 	ReplicatorReconcileDestExtentInconsistentStatus
+	// ReplicatorReconcileCgRun indicates the reconcile for consumer group runs
+	ReplicatorReconcileCgRun
+	// ReplicatorReconcileCgFail indicates the reconcile for consumer group fails
+	ReplicatorReconcileCgFail
+	// ReplicatorReconcileCgFoundMissing indicates the reconcile for consumer group found a consumer group missing locally
+	ReplicatorReconcileCgFoundMissing
+	// ReplicatorReconcileCgFoundExtra indicates the reconcile for consumer group found a consumer group missing in the authoritative zone
+	ReplicatorReconcileCgFoundExtra
+	// ReplicatorReconcileCgInconsistentConfig indicates the reconcile for consumer group found an inconsistent config
+	ReplicatorReconcileCgInconsistentConfig
+	// ReplicatorReconcileCgInconsistentStatus indicates the reconcile for consumer group found an inconsistent status
+	ReplicatorReconcileCgInconsistentStatus
+
+	// ReplicatorAckLevelsShipped indicates how many consumer group ack levels were shipped to remote zones
+	ReplicatorAckLevelsShipped
+	// ReplicatorAckLevelsMoved indicates how many shipped ack levels moved a local consumer group extent
+	ReplicatorAckLevelsMoved
 
 	numMetrics
 )
@@ -959,6 +1117,7 @@ var metricDefs = map[ServiceIdx]map[int]metricDefinition{
 		InputhostReconfClientRequests:         {Counter, "inputhost.reconfigure.client.request"},
 		InputhostMessageLimitThrottled:        {Counter, "inputhost.message.limit.throttled"},
 		InputhostMessageChannelFullThrottled:  {Counter, "inputhost.message.channel.throttled"},
+		InputhostMessageSchemaRejected:        {Counter, "inputhost.message.schema-rejected"},
 		InputhostUserFailures:                 {Counter, "inputhost.user-errors"},
 		InputhostInternalFailures:             {Counter, "inputhost.internal-errors"},
 		InputhostMessageUserFailures:          {Counter, "inputhost.message.user-errors"},
@@ -981,6 +1140,7 @@ var metricDefs = map[ServiceIdx]map[int]metricDefinition{
 		OutputhostDLQMessageRequests:                    {Counter, "outputhost.message.sent-dlq"},
 		OutputhostDLQMessageFailures:                    {Counter, "outputhost.message.errors-dlq"},
 		OutputhostMessageRedelivered:                    {Counter, "outputhost.message.redelivered"},
+		OutputhostMessageExpired:                        {Counter, "outputhost.message.expired"},
 		OutputhostMessageSentAck:                        {Counter, "outputhost.message.sent-ack"},
 		OutputhostMessageSentNAck:                       {Counter, "outputhost.message.sent-nack"},
 		OutputhostMessageAckFailures:                    {Counter, "outputhost.message.errors-ack"},
@@ -1064,10 +1224,41 @@ var metricDefs = map[ServiceIdx]map[int]metricDefinition{
 		ControllerGetAddressFailedCounter:          {Counter, "controller.retentionmgr.getaddress.failed"},
 		ControllerGetAddressCompletedCounter:       {Counter, "controller.retentionmgr.getaddress.completed"},
 		ControllerPurgeMessagesRequestCounter:      {Counter, "controller.retentionmgr.purgemessagesrequest"},
+		ControllerRetentionForcedPurgeCounter:      {Counter, "controller.retentionmgr.forcedpurge"},
+		ControllerRetentionFullSweepJobs:           {Counter, "controller.retentionmgr.fullsweep.jobs"},
+		ControllerRetentionIncrementalJobs:         {Counter, "controller.retentionmgr.incremental.jobs"},
+		ControllerRetentionIncrementalSkipped:      {Counter, "controller.retentionmgr.incremental.skipped"},
 		ControllerLatencyTimer:                     {Timer, "controller.latency"},
 		ControllerRetentionJobDuration:             {Timer, "controller.retentionmgr.jobduration"},
+		ControllerRetentionFullSweepDuration:       {Timer, "controller.retentionmgr.fullsweep.duration"},
+		ControllerRetentionIncrementalDuration:     {Timer, "controller.retentionmgr.incremental.duration"},
+		ControllerRetentionSignals:                 {Counter, "controller.retentionmgr.signals"},
 		ControllerGetAddressLatency:                {Timer, "controller.retentionmgr.getaddresslatency"},
 		ControllerPurgeMessagesLatency:             {Timer, "controller.retentionmgr.purgemessageslatency"},
+		ControllerPublishExtentsScaleUp:            {Counter, "controller.publish-extents.scale-up"},
+		ControllerPublishExtentsScaleDown:          {Counter, "controller.publish-extents.scale-down"},
+		ControllerSurplusExtentsSealed:             {Counter, "controller.publish-extents.surplus-sealed"},
+		ControllerReReplicationStarted:             {Counter, "controller.rereplication.started"},
+		ControllerReReplicationCompleted:           {Counter, "controller.rereplication.completed"},
+		ControllerReReplicationFailed:              {Counter, "controller.rereplication.failed"},
+		ControllerReReplicationInProgress:          {Gauge, "controller.rereplication.inprogress"},
+		ControllerRebalanceCGMoves:                 {Counter, "controller.rebalance.cg-moves"},
+		ControllerRebalanceExtentMoves:             {Counter, "controller.rebalance.extent-moves"},
+		ControllerRebalanceDryRunMoves:             {Counter, "controller.rebalance.dryrun-moves"},
+		ControllerLeadershipAcquired:               {Counter, "controller.leader.acquired"},
+		ControllerLeadershipLost:                   {Counter, "controller.leader.lost"},
+		ControllerLeasesHeld:                       {Gauge, "controller.leader.leases-held"},
+		ControllerEventsJournaled:                  {Counter, "controller.events-journaled"},
+		ControllerEventsReplayed:                   {Counter, "controller.events-replayed"},
+		ControllerEventsCanceled:                   {Counter, "controller.events-canceled"},
+		ControllerErrEventJournal:                  {Counter, "controller.errors.event-journal"},
+		ControllerExtentsRolledBySize:              {Counter, "controller.extents-rolled.size"},
+		ControllerExtentsRolledByAge:               {Counter, "controller.extents-rolled.age"},
+		ControllerReplicasVerified:                 {Counter, "controller.replica-verifier.verified"},
+		ControllerReplicasDivergent:                {Counter, "controller.replica-verifier.divergent"},
+		ControllerReplicasInconclusive:             {Counter, "controller.replica-verifier.inconclusive"},
+		ControllerReplicaRepairs:                   {Counter, "controller.replica-verifier.repairs"},
+		ControllerReplicaVerifierRoundSize:         {Gauge, "controller.replica-verifier.round-size"},
 	},
 
 	// definitions for Replicator metrics
@@ -1081,6 +1272,9 @@ var metricDefs = map[ServiceIdx]map[int]metricDefinition{
 		ReplicatorInConnMsgWritten:                      {Counter, "replicator.inconn.msgwritten"},
 		ReplicatorOutConnCreditsSent:                    {Counter, "replicator.outconn.creditssent"},
 		ReplicatorOutConnMsgRead:                        {Counter, "replicator.outconn.msgread"},
+		ReplicatorOutConnReplicationLag:                 {Timer, "replicator.outconn.replication-lag"},
+		ReplicatorOutConnThrottleLatency:                {Timer, "replicator.outconn.throttle-latency"},
+		ReplicatorStaleUpdate:                           {Counter, "replicator.requests.stale"},
 		ReplicatorReconcileDestRun:                      {Gauge, "replicator.reconcile.dest.run"},
 		ReplicatorReconcileDestFail:                     {Gauge, "replicator.reconcile.dest.fail"},
 		ReplicatorReconcileDestFoundMissing:             {Gauge, "replicator.reconcile.dest.foundmissing"},
@@ -1088,6 +1282,14 @@ var metricDefs = map[ServiceIdx]map[int]metricDefinition{
 		ReplicatorReconcileDestExtentFail:               {Gauge, "replicator.reconcile.destextent.fail"},
 		ReplicatorReconcileDestExtentFoundMissing:       {Gauge, "replicator.reconcile.destextent.foundmissing"},
 		ReplicatorReconcileDestExtentInconsistentStatus: {Gauge, "replicator.reconcile.destextent.inconsistentstatus"},
+		ReplicatorReconcileCgRun:                        {Gauge, "replicator.reconcile.cg.run"},
+		ReplicatorReconcileCgFail:                       {Gauge, "replicator.reconcile.cg.fail"},
+		ReplicatorReconcileCgFoundMissing:               {Counter, "replicator.reconcile.cg.foundmissing"},
+		ReplicatorReconcileCgFoundExtra:                 {Counter, "replicator.reconcile.cg.foundextra"},
+		ReplicatorReconcileCgInconsistentConfig:         {Counter, "replicator.reconcile.cg.inconsistentconfig"},
+		ReplicatorReconcileCgInconsistentStatus:         {Counter, "replicator.reconcile.cg.inconsistentstatus"},
+		ReplicatorAckLevelsShipped:                      {Counter, "replicator.acklevels.shipped"},
+		ReplicatorAckLevelsMoved:                        {Counter, "replicator.acklevels.moved"},
 	},
 }
 
@@ -1098,6 +1300,7 @@ var dynamicMetricDefs = map[ServiceIdx]map[int]metricDefinition{
 		InputhostDestMessageFailures:              {Counter, "inputhost.message.errors.dest"},
 		InputhostDestMessageLimitThrottled:        {Counter, "inputhost.message.limit.throttled.dest"},
 		InputhostDestMessageChannelFullThrottled:  {Counter, "inputhost.message.channel.throttled.dest"},
+		InputhostDestMessageSchemaRejected:        {Counter, "inputhost.message.schema-rejected.dest"},
 		InputhostDestMessageUserFailures:          {Counter, "inputhost.message.user-errors.dest"},
 		InputhostDestMessageInternalFailures:      {Counter, "inputhost.message.internal-errors.dest"},
 		InputhostDestWriteMessageLatency:          {Timer, "inputhost.message.write-latency.dest"},
@@ -1113,6 +1316,9 @@ var dynamicMetricDefs = map[ServiceIdx]map[int]metricDefinition{
 		OutputhostCGDLQMessageRequests:    {Counter, "outputhost.message.sent-dlq.cg"},
 		OutputhostCGDLQMessageFailures:    {Counter, "outputhost.message.errors-dlq.cg"},
 		OutputhostCGMessageRedelivered:    {Counter, "outputhost.message.redelivered.cg"},
+		OutputhostCGMessageExpired:        {Counter, "outputhost.message.expired.cg"},
+		OutputhostCGMessageExpiredDLQ:     {Counter, "outputhost.message.expired-dlq.cg"},
+		OutputhostCGMessageChunksDropped:  {Counter, "outputhost.message.chunks-dropped.cg"},
 		OutputhostCGMessageSentAck:        {Counter, "outputhost.message.sent-ack.cg"},
 		OutputhostCGMessageSentNAck:       {Counter, "outputhost.message.sent-nack.cg"},
 		OutputhostCGMessagesThrottled:     {Counter, "outputhost.message.throttled"},
@@ -1137,6 +1343,9 @@ var dynamicMetricDefs = map[ServiceIdx]map[int]metricDefinition{
 		ControllerCGBacklogInflight:    {Gauge, "controller.backlog.inflight.cg"},
 		ControllerCGBacklogDLQ:         {Gauge, "controller.backlog.DLQ.cg"},
 		ControllerCGBacklogProgress:    {Gauge, "controller.backlog.progress.cg"},
+		ControllerReplicationLagMsgs:   {Gauge, "controller.replication-lag.msgs.dst"},
+		ControllerReplicationLagSecs:   {Gauge, "controller.replication-lag.secs.dst"},
+		ControllerReplicationLagAlert:  {Gauge, "controller.replication-lag.alert.dst"},
 	},
 }
 
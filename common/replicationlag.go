@@ -0,0 +1,165 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// The controller thrift API has no room for the replication lag of an
+// extent replica, so a store host that is replicating an extent sends
+// it as headers of its store extent metric report.
+const (
+	replicationLagMsgsHeader = "cherami-replication-lag-msgs"
+	replicationLagSecsHeader = "cherami-replication-lag-secs"
+)
+
+type (
+	// ReplicationLag is how far a replica is behind the source of its replication
+	ReplicationLag struct {
+		Messages int64
+		Seconds  int64
+	}
+
+	// ReplicationLagEstimator estimates the lag of a replication stream
+	// from the messages going through it and the last sequence number at
+	// its source, as reported through ObserveSource. The lag in messages
+	// is how many sequence numbers the replica is behind the source. While
+	// the source has messages the replica doesn't, the lag in seconds is
+	// the time since the last replicated message was enqueued, so it keeps
+	// growing when the stream stalls; it is subject to the clock skew
+	// between the zones. When the source is not known, as for the streams
+	// from a remote zone, only the lag in seconds is reported, as the time
+	// since the last replicated message was enqueued: a stalled stream
+	// can't be told apart from an idle source, so the lag of both grows.
+	ReplicationLagEstimator struct {
+		sync.Mutex
+		startTime       int64 // unix nanos
+		lastSeqNum      int64
+		lastEnqueueTime int64 // unix nanos
+		lastSeenTime    int64 // unix nanos
+		sourceSeqNum    int64 // -1 until the source is observed
+	}
+)
+
+// NewReplicationLagEstimator returns a lag estimator for a replication
+// stream, given the last sequence number the replica already has, or -1
+func NewReplicationLagEstimator(lastSeqNum int64) *ReplicationLagEstimator {
+	return &ReplicationLagEstimator{
+		startTime:    time.Now().UnixNano(),
+		lastSeqNum:   lastSeqNum,
+		sourceSeqNum: -1,
+	}
+}
+
+// Observe records a message that went through the replication stream
+func (e *ReplicationLagEstimator) Observe(seqNum int64, enqueueTime int64, now int64) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.lastSeqNum = seqNum
+	e.lastEnqueueTime = enqueueTime
+	e.lastSeenTime = now
+}
+
+// ObserveSource records the last sequence number at the source of the
+// replication stream
+func (e *ReplicationLagEstimator) ObserveSource(lastSeqNum int64) {
+	e.Lock()
+	defer e.Unlock()
+
+	if lastSeqNum > e.sourceSeqNum {
+		e.sourceSeqNum = lastSeqNum
+	}
+}
+
+// Lag returns the lag estimate as of now, and false if neither a message
+// went through the stream nor the source was observed yet
+func (e *ReplicationLagEstimator) Lag(now int64) (ReplicationLag, bool) {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.sourceSeqNum < 0 {
+		if e.lastSeenTime == 0 {
+			return ReplicationLag{}, false
+		}
+		return ReplicationLag{Seconds: nanosToSecs(now - e.lastEnqueueTime)}, true
+	}
+
+	if e.sourceSeqNum <= e.lastSeqNum {
+		return ReplicationLag{}, true // caught up
+	}
+
+	since := e.lastEnqueueTime
+	if e.lastSeenTime == 0 {
+		since = e.startTime // nothing came through the stream yet
+	}
+	return ReplicationLag{
+		Messages: e.sourceSeqNum - e.lastSeqNum,
+		Seconds:  nanosToSecs(now - since),
+	}, true
+}
+
+func nanosToSecs(nanos int64) int64 {
+	if nanos < 0 {
+		return 0 // the clock of the source is ahead
+	}
+	return nanos / int64(time.Second)
+}
+
+// WithReplicationLag attaches the replication lag to the context of a load report
+func WithReplicationLag(ctx thrift.Context, lag *ReplicationLag) thrift.Context {
+	if lag == nil {
+		return ctx
+	}
+	return thrift.WithHeaders(ctx, map[string]string{
+		replicationLagMsgsHeader: strconv.FormatInt(lag.Messages, 10),
+		replicationLagSecsHeader: strconv.FormatInt(lag.Seconds, 10),
+	})
+}
+
+// ReplicationLagFromContext returns the replication lag a load report
+// was made with, or nil if the reported extent is not being replicated
+func ReplicationLagFromContext(ctx thrift.Context) (*ReplicationLag, error) {
+	if ctx == nil {
+		return nil, nil
+	}
+	headers := ctx.Headers()
+	msgs, ok := headers[replicationLagMsgsHeader]
+	if !ok {
+		return nil, nil
+	}
+	lag := &ReplicationLag{}
+	var err error
+	if lag.Messages, err = strconv.ParseInt(msgs, 10, 64); err != nil {
+		return nil, fmt.Errorf("malformed replication lag %q", msgs)
+	}
+	secs := headers[replicationLagSecsHeader]
+	if lag.Seconds, err = strconv.ParseInt(secs, 10, 64); err != nil {
+		return nil, fmt.Errorf("malformed replication lag %q", secs)
+	}
+	return lag, nil
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+type ReplicationLagSuite struct {
+	*require.Assertions
+	suite.Suite
+}
+
+func TestReplicationLagSuite(t *testing.T) {
+	suite.Run(t, new(ReplicationLagSuite))
+}
+
+func (s *ReplicationLagSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+}
+
+func (s *ReplicationLagSuite) TestEstimator() {
+	e := NewReplicationLagEstimator(-1)
+
+	_, ok := e.Lag(time.Now().UnixNano())
+	s.False(ok, "no lag before the first message")
+
+	start := time.Now().UnixNano()
+	sec := int64(time.Second)
+
+	// source unknown, messages seen 30 seconds after they were enqueued
+	for i := int64(0); i <= 100; i++ {
+		enqueueTime := start + i*sec/10
+		e.Observe(i, enqueueTime, enqueueTime+30*sec)
+	}
+
+	lag, ok := e.Lag(start + 40*sec)
+	s.True(ok)
+	s.Equal(ReplicationLag{Seconds: 30}, lag)
+
+	// the source is 200 messages ahead, the lag keeps growing while nothing comes through
+	e.ObserveSource(300)
+	lag, ok = e.Lag(start + 40*sec)
+	s.True(ok)
+	s.Equal(ReplicationLag{Messages: 200, Seconds: 30}, lag)
+	lag, ok = e.Lag(start + 100*sec)
+	s.True(ok)
+	s.Equal(ReplicationLag{Messages: 200, Seconds: 90}, lag)
+
+	// an older source observation doesn't move the source back
+	e.ObserveSource(150)
+	lag, _ = e.Lag(start + 100*sec)
+	s.Equal(int64(200), lag.Messages)
+
+	// caught up, with the clock of the source ahead
+	e.Observe(300, start+100*sec, start+99*sec)
+	lag, ok = e.Lag(start + 99*sec)
+	s.True(ok)
+	s.Equal(ReplicationLag{}, lag)
+
+	// an idle source doesn't make a caught up replica lag
+	lag, ok = e.Lag(start + 1000*sec)
+	s.True(ok)
+	s.Equal(ReplicationLag{}, lag)
+}
+
+func (s *ReplicationLagSuite) TestEstimatorStalledWithoutSource() {
+	// the streams from a remote zone don't know their source
+	e := NewReplicationLagEstimator(-1)
+
+	start := time.Now().UnixNano()
+	sec := int64(time.Second)
+
+	e.Observe(0, start, start+2*sec)
+	lag, ok := e.Lag(start + 2*sec)
+	s.True(ok)
+	s.Equal(ReplicationLag{Seconds: 2}, lag)
+
+	// the stream stalls, the lag keeps growing while nothing comes through
+	lag, ok = e.Lag(start + 60*sec)
+	s.True(ok)
+	s.Equal(ReplicationLag{Seconds: 60}, lag)
+	lag, ok = e.Lag(start + 600*sec)
+	s.True(ok)
+	s.Equal(ReplicationLag{Seconds: 600}, lag)
+
+	// and drops once the stream resumes
+	e.Observe(1, start+599*sec, start+600*sec)
+	lag, ok = e.Lag(start + 600*sec)
+	s.True(ok)
+	s.Equal(ReplicationLag{Seconds: 1}, lag)
+}
+
+func (s *ReplicationLagSuite) TestEstimatorResume() {
+	e := NewReplicationLagEstimator(99)
+
+	_, ok := e.Lag(time.Now().UnixNano())
+	s.False(ok, "no lag before a message or the source is seen")
+
+	// resuming at 99 with the source at 149, nothing replicated since the start
+	e.ObserveSource(149)
+	lag, ok := e.Lag(e.startTime + int64(5*time.Second))
+	s.True(ok)
+	s.Equal(ReplicationLag{Messages: 50, Seconds: 5}, lag)
+}
+
+func (s *ReplicationLagSuite) TestContext() {
+	ctx, cancel := thrift.NewContext(time.Second)
+	defer cancel()
+
+	lag, err := ReplicationLagFromContext(ctx)
+	s.NoError(err)
+	s.Nil(lag, "no lag without headers")
+
+	s.Equal(ctx, WithReplicationLag(ctx, nil))
+
+	lag, err = ReplicationLagFromContext(WithReplicationLag(ctx, &ReplicationLag{Messages: 1234, Seconds: 56}))
+	s.NoError(err)
+	s.Equal(&ReplicationLag{Messages: 1234, Seconds: 56}, lag)
+
+	_, err = ReplicationLagFromContext(thrift.WithHeaders(ctx, map[string]string{
+		replicationLagMsgsHeader: "many",
+		replicationLagSecsHeader: "56",
+	}))
+	s.Error(err)
+}
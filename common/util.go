@@ -102,6 +102,22 @@ const (
 	MaxHostMaxConnPerDestination = 10000
 	// HostMaxConnPerDestination is the max connections per destination
 	HostMaxConnPerDestination = 1000
+
+	// MaxHostMaxMessageSize is the maximum for the max message size, in bytes
+	MaxHostMaxMessageSize = 256 * 1024 * 1024
+	// HostMaxMessageSize is the max size of the payload of a message, in bytes
+	HostMaxMessageSize = 32 * 1024 * 1024
+
+	// MaxHostMessageChunkSize is the maximum for the message chunk size, in bytes
+	MaxHostMessageChunkSize = 32 * 1024 * 1024
+	// HostMessageChunkSize is the size of the chunks that large messages are split into, in bytes
+	HostMessageChunkSize = 1024 * 1024
+
+	// MaxHostDrainTimeoutSeconds is the maximum for the drain timeout, in seconds
+	MaxHostDrainTimeoutSeconds = 600
+	// HostDrainTimeoutSeconds is the time to wait on shutdown for the publishers
+	// to move to other inputhosts, in seconds; zero closes the streams right away
+	HostDrainTimeoutSeconds = 10
 )
 
 // Utlity routines for ringpop..
@@ -206,10 +222,14 @@ func CreateHyperbahnClient(ch *tchannel.Channel, bootstrapFile string) *hyperbah
 }
 
 // ServiceLoop runs the http admin endpoints. This is a blocking call.
-func ServiceLoop(port int, cfg configure.CommonAppConfig, service *Service) {
+// Services that expose additional endpoints can pass them as registrars.
+func ServiceLoop(port int, cfg configure.CommonAppConfig, service *Service, registrars ...HTTPHandlerRegistrar) {
 	httpHandlers := NewHTTPHandler(cfg, service)
 	mux := http.NewServeMux()
 	httpHandlers.Register(mux)
+	for _, r := range registrars {
+		r.RegisterHTTPHandlers(mux)
+	}
 
 	listenAddress := `127.0.0.1`
 	if service.cfg.GetListenAddress().IsLoopback() { // If we have a particular loopback listen address, override the default
@@ -390,6 +410,68 @@ func GetConnectionKey(host *cherami.HostAddress) string {
 	return fmt.Sprintf("%v:%d", host.GetHost(), host.GetPort())
 }
 
+// GetMessageTTL returns the time-to-live carried in the user context of
+// the given message, or zero if the message doesn't have one
+func GetMessageTTL(msg *cherami.PutMessage) (time.Duration, error) {
+	if msg == nil {
+		return 0, nil
+	}
+
+	ttlStr, ok := msg.GetUserContext()[MessageTTLSecondsKey]
+	if !ok {
+		return 0, nil
+	}
+
+	ttl, err := strconv.ParseInt(ttlStr, 10, 64)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid message ttl: %v", ttlStr)
+	}
+	return time.Duration(ttl) * time.Second, nil
+}
+
+// SetThrottleHint adds the suggested pause and publish rate to the user context
+// of the given THROTTLED ack. A zero pause or rate is left out. The user context
+// is copied, since it is usually shared with the message that was throttled.
+func SetThrottleHint(ack *cherami.PutMessageAck, pause time.Duration, rate int) {
+	userContext := make(map[string]string, len(ack.GetUserContext())+2)
+	for k, v := range ack.GetUserContext() {
+		userContext[k] = v
+	}
+	if pause > 0 {
+		userContext[ThrottlePauseMillisKey] = strconv.FormatInt(int64(pause/time.Millisecond), 10)
+	}
+	if rate > 0 {
+		userContext[ThrottleRateKey] = strconv.Itoa(rate)
+	}
+	ack.UserContext = userContext
+}
+
+// GetThrottleHint returns the suggested pause and publish rate carried by the
+// given THROTTLED ack, or zero for the ones that are missing or invalid
+func GetThrottleHint(ack *cherami.PutMessageAck) (pause time.Duration, rate int) {
+	if ms, err := strconv.ParseInt(ack.GetUserContext()[ThrottlePauseMillisKey], 10, 64); err == nil && ms > 0 {
+		pause = time.Duration(ms) * time.Millisecond
+	}
+	if r, err := strconv.Atoi(ack.GetUserContext()[ThrottleRateKey]); err == nil && r > 0 {
+		rate = r
+	}
+	return
+}
+
+// IsMessageExpired returns true if the message has a TTL and the TTL has elapsed
+// by the given time. The TTL starts when the message becomes visible, i.e. it
+// includes the delay of the message, if any.
+func IsMessageExpired(msg *cherami.ConsumerMessage, now UnixNanoTime) bool {
+	ttl, err := GetMessageTTL(msg.Payload)
+	if err != nil || ttl == 0 {
+		return false
+	}
+
+	delay := time.Duration(msg.Payload.GetDelayMessageInSeconds()) * time.Second
+	expiry := UnixNanoTime(msg.GetEnqueueTimeUtc()) + UnixNanoTime(delay+ttl)
+	return now >= expiry
+}
+
 // GetRandInt64 is used to get a 64 bit random number between min and max
 func GetRandInt64(min int64, max int64) int64 {
 	// we need to get a random number between min and max
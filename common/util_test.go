@@ -23,11 +23,13 @@ package common
 import (
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/uber-common/bark"
+	"github.com/uber/cherami-thrift/.generated/go/cherami"
 )
 
 var baseLog = bark.NewLoggerFromLogrus(logrus.StandardLogger())
@@ -179,3 +181,80 @@ func (s *UtilSuite) TestOverrideValueByPrefixConcurrency() {
 	startersPistol.Unlock() // bang!
 	wg.Wait()
 }
+
+func (s *UtilSuite) TestGetMessageTTL() {
+	ttl, err := GetMessageTTL(nil)
+	s.NoError(err)
+	s.Zero(ttl)
+
+	msg := &cherami.PutMessage{}
+	ttl, err = GetMessageTTL(msg)
+	s.NoError(err)
+	s.Zero(ttl)
+
+	msg.UserContext = map[string]string{MessageTTLSecondsKey: `300`}
+	ttl, err = GetMessageTTL(msg)
+	s.NoError(err)
+	s.Equal(5*time.Minute, ttl)
+
+	for _, bad := range []string{``, `0`, `-1`, `5m`, `abc`} {
+		msg.UserContext[MessageTTLSecondsKey] = bad
+		_, err = GetMessageTTL(msg)
+		s.Error(err, `ttl `+bad+` should be rejected`)
+	}
+}
+
+func (s *UtilSuite) TestIsMessageExpired() {
+	enqueueTime := time.Now().UnixNano()
+	msg := &cherami.ConsumerMessage{
+		EnqueueTimeUtc: Int64Ptr(enqueueTime),
+		Payload:        &cherami.PutMessage{},
+	}
+
+	// no ttl; never expires
+	s.False(IsMessageExpired(msg, UnixNanoTime(enqueueTime)+UnixNanoTime(time.Hour)))
+
+	msg.Payload.UserContext = map[string]string{MessageTTLSecondsKey: `60`}
+	s.False(IsMessageExpired(msg, UnixNanoTime(enqueueTime)))
+	s.False(IsMessageExpired(msg, UnixNanoTime(enqueueTime)+UnixNanoTime(59*time.Second)))
+	s.True(IsMessageExpired(msg, UnixNanoTime(enqueueTime)+UnixNanoTime(time.Minute)))
+
+	// the ttl of a delayed message starts when the message fires
+	msg.Payload.DelayMessageInSeconds = Int32Ptr(60)
+	s.False(IsMessageExpired(msg, UnixNanoTime(enqueueTime)+UnixNanoTime(time.Minute)))
+	s.True(IsMessageExpired(msg, UnixNanoTime(enqueueTime)+UnixNanoTime(2*time.Minute)))
+
+	// an invalid ttl is ignored
+	msg.Payload.UserContext[MessageTTLSecondsKey] = `abc`
+	s.False(IsMessageExpired(msg, UnixNanoTime(enqueueTime)+UnixNanoTime(time.Hour)))
+}
+
+func (s *UtilSuite) TestThrottleHint() {
+	msgContext := map[string]string{"foo": "bar"}
+	ack := &cherami.PutMessageAck{
+		ID:          StringPtr("id"),
+		UserContext: msgContext,
+		Status:      CheramiStatusPtr(cherami.Status_THROTTLED),
+	}
+
+	pause, rate := GetThrottleHint(ack)
+	s.Equal(time.Duration(0), pause)
+	s.Equal(0, rate)
+
+	SetThrottleHint(ack, 250*time.Millisecond, 100)
+	pause, rate = GetThrottleHint(ack)
+	s.Equal(250*time.Millisecond, pause)
+	s.Equal(100, rate)
+	s.Equal("bar", ack.GetUserContext()["foo"])
+	// the user context of the message must not be modified
+	s.Len(msgContext, 1)
+
+	// zero values are left out
+	ack.UserContext = msgContext
+	SetThrottleHint(ack, 0, 10)
+	_, ok := ack.GetUserContext()[ThrottlePauseMillisKey]
+	s.False(ok)
+	pause, rate = GetThrottleHint(ack)
+	s.Equal(time.Duration(0), pause)
+	s.Equal(10, rate)
+}
@@ -117,14 +117,41 @@ func areExtentStoresHealthy(context *Context, extent *shared.Extent) bool {
 	return true
 }
 
-func addExtentDownEvent(context *Context, sealSeq int64, dstID string, extentID string) {
+// addExtentDownEvent enqueues an ExtentDownEvent, unless the extent is
+// already being sealed. Returns false if the event queue is full.
+func addExtentDownEvent(context *Context, sealSeq int64, dstID string, extentID string) bool {
 	if !context.extentSeals.inProgress.PutIfNotExist(extentID, Boolean(true)) {
-		return
+		return true
 	}
 	event := NewExtentDownEvent(sealSeq, dstID, extentID)
 	if !context.eventPipeline.Add(event) {
 		context.extentSeals.inProgress.Remove(extentID)
+		return false
+	}
+	return true
+}
+
+// addExtentReReplicationEvent enqueues an ExtentReReplicationEvent, unless
+// the extent is already being re-replicated. Returns false if the event
+// queue is full.
+func addExtentReReplicationEvent(context *Context, dstID string, extentID string, failedStoreID string) bool {
+	status := &reReplicationStatus{
+		DstUUID:         dstID,
+		ExtentUUID:      extentID,
+		FailedStoreUUID: failedStoreID,
+		State:           reReplicationPending,
+		StartTime:       time.Now(),
+	}
+	if !context.extentRepairs.inProgress.PutIfNotExist(extentID, status) {
+		return true
+	}
+	event := NewExtentReReplicationEvent(dstID, extentID, failedStoreID)
+	if !context.eventPipeline.Add(event) {
+		context.extentRepairs.inProgress.Remove(extentID)
+		return false
 	}
+	context.m3Client.UpdateGauge(metrics.ExtentReReplicationEventScope, metrics.ControllerReReplicationInProgress, int64(context.extentRepairs.inProgress.Size()))
+	return true
 }
 
 func addStoreExtentStatusOutOfSyncEvent(context *Context, dstID string, extentID string, storeID string) {
@@ -263,6 +290,12 @@ func getInputAddrIfExtentIsWritable(context *Context, extent *shared.Extent, m3S
 }
 
 func createExtent(context *Context, dstUUID string, isMultiZoneDest bool, m3Scope int) (extentUUID string, inhost *common.HostInfo, storehosts []*common.HostInfo, err error) {
+	return createExtentOnInputHost(context, dstUUID, isMultiZoneDest, "", m3Scope)
+}
+
+// createExtentOnInputHost creates a new extent served by the given input host,
+// or by an input host picked by the placement if inhostID is empty
+func createExtentOnInputHost(context *Context, dstUUID string, isMultiZoneDest bool, inhostID string, m3Scope int) (extentUUID string, inhost *common.HostInfo, storehosts []*common.HostInfo, err error) {
 	// TODO We also have a dst specific nReplicas param, do we need it ?
 	var nReplicasPerExtent = int(context.appConfig.GetDestinationConfig().GetReplicas())
 
@@ -277,10 +310,19 @@ func createExtent(context *Context, dstUUID string, isMultiZoneDest bool, m3Scop
 		storeids[i] = storehosts[i].UUID
 	}
 
-	inhost, err = context.placement.PickInputHost(storehosts)
-	if err != nil {
-		context.m3Client.IncCounter(m3Scope, metrics.ControllerErrPickInHostCounter)
-		return
+	if len(inhostID) > 0 {
+		var addr string
+		if addr, err = context.rpm.ResolveUUID(common.InputServiceName, inhostID); err != nil {
+			context.m3Client.IncCounter(m3Scope, metrics.ControllerErrResolveUUIDCounter)
+			return
+		}
+		inhost = &common.HostInfo{UUID: inhostID, Addr: addr}
+	} else {
+		inhost, err = context.placement.PickInputHost(storehosts)
+		if err != nil {
+			context.m3Client.IncCounter(m3Scope, metrics.ControllerErrPickInHostCounter)
+			return
+		}
 	}
 
 	extentUUID = uuid.New()
@@ -369,6 +411,8 @@ func refreshInputHostsForDst(context *Context, dstUUID string, now int64) ([]str
 
 	var nHealthy = 0
 	var inputHosts = make(map[string]*common.HostInfo, len(openExtentStats))
+	var inputAddrs = make(map[string]string, len(openExtentStats))
+	var healthyExtents = make([]*shared.ExtentStats, 0, len(openExtentStats))
 
 	for _, stat := range openExtentStats {
 		ext := stat.GetExtent()
@@ -384,8 +428,21 @@ func refreshInputHostsForDst(context *Context, dstUUID string, now int64) ([]str
 		if e != nil {
 			continue
 		}
-		hostID := ext.GetInputHostUUID()
-		hostInfo := &common.HostInfo{UUID: hostID, Addr: addr}
+		inputAddrs[ext.GetInputHostUUID()] = addr
+		healthyExtents = append(healthyExtents, stat)
+	}
+
+	if dstType == dstTypePlain {
+		var isAdaptive bool
+		minOpenExtents, isAdaptive = context.extentScaler.targetOpenExtents(dstUUID, dstDesc.GetPath(), healthyExtents, minOpenExtents, now)
+		if isAdaptive && len(healthyExtents) > minOpenExtents {
+			healthyExtents = context.extentScaler.releaseSurplusExtents(dstUUID, healthyExtents, minOpenExtents, now)
+		}
+	}
+
+	for _, stat := range healthyExtents {
+		hostID := stat.GetExtent().GetInputHostUUID()
+		hostInfo := &common.HostInfo{UUID: hostID, Addr: inputAddrs[hostID]}
 		inputHosts[hostID] = hostInfo
 		nHealthy++
 	}
@@ -54,6 +54,61 @@ type (
 		NumPublisherExtentsByPath      []string `name:"numPublisherExtentsByPath" default:"/=4"`
 		NumConsumerExtentsByPath       []string `name:"numConsumerExtentsByPath" default:"/=8"`
 		NumRemoteConsumerExtentsByPath []string `name:"numRemoteConsumerExtentsByPath" default:"/=4"`
+		// Bounds and targets for adaptive scaling of the open publish
+		// extents; scaling is disabled for a path when its max is zero
+		MinPublisherExtentsByPath       []string `name:"minPublisherExtentsByPath" default:"/=1"`
+		MaxPublisherExtentsByPath       []string `name:"maxPublisherExtentsByPath" default:"/=0"`
+		TargetMsgsPerSecPerExtentByPath []string `name:"targetMsgsPerSecPerExtentByPath" default:"/=1000"`
+		MaxPutLatencyMillisByPath       []string `name:"maxPutLatencyMillisByPath" default:"/=100"`
+		// StoreHostDownPeriodForStage3Mins is how long a store host
+		// has to be gone before its extents are re-replicated to
+		// other store hosts; zero disables re-replication
+		StoreHostDownPeriodForStage3Mins int `name:"storeHostDownPeriodForStage3Mins" default:"1440"`
+		// RebalancerMode is one of off, dryrun or on. In dryrun
+		// mode, the rebalancer only reports the moves it would make
+		RebalancerMode string `name:"rebalancerMode" default:"off"`
+		// RebalancerIntervalSecs is the time between rebalancing rounds
+		RebalancerIntervalSecs int `name:"rebalancerIntervalSecs" default:"600"`
+		// RebalancerThresholdPercent is how far above the mean load
+		// a host has to be, for it to be considered overloaded
+		RebalancerThresholdPercent int `name:"rebalancerThresholdPercent" default:"25"`
+		// RebalancerMaxMovesPerRound caps the number of consumer
+		// groups and extents moved in a single round
+		RebalancerMaxMovesPerRound int `name:"rebalancerMaxMovesPerRound" default:"10"`
+		// EventJournal is enabled or disabled. When enabled, the events
+		// that must survive a controller restart are saved to metadata
+		// until they are done, and replayed if their controller goes away
+		EventJournal string `name:"eventJournal" default:"disabled"`
+		// Limits after which an open extent is sealed and replaced by
+		// a new one, a limit of zero disables it. The extent size is
+		// derived from the rates reported by the input hosts
+		MaxExtentSizeBytesByPath []string `name:"maxExtentSizeBytesByPath" default:"/=0"`
+		MaxExtentSizeMsgsByPath  []string `name:"maxExtentSizeMsgsByPath" default:"/=0"`
+		MaxExtentAgeMinsByPath   []string `name:"maxExtentAgeMinsByPath" default:"/=0"`
+		// RetentionMode is one of on or dryrun. In dryrun mode, the
+		// retention manager computes and logs its decisions, but does
+		// not purge messages or mark extents consumed or deleted
+		RetentionMode string `name:"retentionMode" default:"on"`
+		// MaxRetainedBytesByPath is the max size a destination can take
+		// on storage; past it, the oldest messages are purged even if
+		// they were not consumed. A limit of zero disables it
+		MaxRetainedBytesByPath []string `name:"maxRetainedBytesByPath" default:"/=0"`
+		// MaxReplicationLagSecsByPath is the replication lag past which
+		// the replicas of a destination raise the replication lag alert
+		// metric. A threshold of zero disables the alert
+		MaxReplicationLagSecsByPath []string `name:"maxReplicationLagSecsByPath" default:"/=0"`
+		// ReplicaVerifierMode is one of off, report or repair. In repair
+		// mode, a replica that differs from the majority of the replicas
+		// of its extent is replaced by a copy of a healthy replica
+		ReplicaVerifierMode string `name:"replicaVerifierMode" default:"off"`
+		// ReplicaVerifierIntervalSecs is the time between verification rounds
+		ReplicaVerifierIntervalSecs int `name:"replicaVerifierIntervalSecs" default:"3600"`
+		// ReplicaVerifierExtentsPerRound is the number of sealed extents
+		// sampled in a single round, at most one per destination
+		ReplicaVerifierExtentsPerRound int `name:"replicaVerifierExtentsPerRound" default:"10"`
+		// ReplicaVerifierMaxMsgsPerExtent caps the number of messages
+		// compared on every extent, zero compares the extents in full
+		ReplicaVerifierMaxMsgsPerExtent int `name:"replicaVerifierMaxMsgsPerExtent" default:"100000"`
 	}
 )
 
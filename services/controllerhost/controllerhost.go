@@ -40,6 +40,7 @@ import (
 
 	"github.com/pborman/uuid"
 	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/clients/metadata"
 	"github.com/uber/cherami-server/common"
 	"github.com/uber/cherami-server/common/configure"
 	"github.com/uber/cherami-server/common/dconfig"
@@ -86,6 +87,7 @@ const (
 	hashLockTableSize          = 1024
 	maxFailedExtentSealSetSize = 8192 // max # of failed extent seals we can keep track of
 	maxExtentSealsPerSecond    = 200
+	maxReReplicationsPerSecond = 10
 )
 
 type (
@@ -109,6 +111,11 @@ type (
 		eventPipeline   EventPipeline
 		resultCache     *resultCache
 		extentMonitor   *extentStateMonitor
+		rebalancer      *rebalancer
+		replicaVerifier *replicaVerifier
+		leaders         *leaderElection
+		eventJournal    *eventJournal
+		extentRoller    *extentRoller
 		timeSource      common.TimeSource
 		channel         *tchannel.Channel
 		clientFactory   common.ClientFactory
@@ -118,6 +125,8 @@ type (
 		cfgMgr          dconfig.ConfigManager
 		loadMetrics     load.MetricsAggregator
 		placement       Placement
+		extentScaler    *publishExtentScaler
+		extentReplicas  metadata.ExtentReplicaService
 		extentSeals     struct {
 			// set of extents for which seal is in progress
 			// if an extent exist in this set, some worker
@@ -134,6 +143,19 @@ type (
 			// per second from a single controller instance
 			tokenBucket common.TokenBucket
 		}
+		extentRepairs struct {
+			// set of extents for which the replica on a lost
+			// store host is being replaced, maps the extent
+			// uuid to its *reReplicationStatus
+			inProgress common.ConcurrentMap
+			// Rate limiter for throttling re-replications
+			// issued per second from a single controller
+			tokenBucket common.TokenBucket
+			// number of re-replications completed and
+			// failed since the controller was started
+			completed int64
+			failed    int64
+		}
 	}
 
 	// Boolean is an alias for bool
@@ -177,10 +199,21 @@ func NewController(cfg configure.CommonAppConfig, sVice *common.Service, metadat
 	context.extentSeals.inProgress = common.NewShardedConcurrentMap(1024, common.UUIDHashCode)
 	context.extentSeals.failed = common.NewShardedConcurrentMap(1024, common.UUIDHashCode)
 	context.extentSeals.tokenBucket = common.NewTokenBucket(maxExtentSealsPerSecond, common.NewRealTimeSource())
+	context.extentRepairs.inProgress = common.NewShardedConcurrentMap(1024, common.UUIDHashCode)
+	context.extentRepairs.tokenBucket = common.NewTokenBucket(maxReReplicationsPerSecond, common.NewRealTimeSource())
+	context.extentReplicas, _ = metadataClient.(metadata.ExtentReplicaService)
 
 	context.resultCache = newResultCache(context)
 	context.cfgMgr = newConfigManager(metadataClient, context.log)
 	context.loadMetrics = load.NewTimeSlotAggregator(common.NewRealTimeSource(), context.log)
+	context.extentScaler = newPublishExtentScaler(context)
+	context.extentRoller = newExtentRoller(context)
+
+	leases, _ := metadataClient.(metadata.LeaseService)
+	context.leaders = newLeaderElection(context, leases)
+
+	journal, _ := metadataClient.(metadata.EventJournalService)
+	context.eventJournal = newEventJournal(context, journal)
 
 	if context.placement, err = NewDistancePlacement(context); err != nil {
 		context.log.WithField(common.TagErr, err).Error("Cannot initialize topology for placement")
@@ -212,6 +245,9 @@ func (mcp *Mcp) Start(thriftService []thrift.TChanServer) {
 	context.failureDetector = NewDfdd(context)
 	context.failureDetector.Start()
 
+	context.leaders.Start()
+	context.eventJournal.Start()
+
 	context.retMgr = newRetMgrRunner(&retMgrRunnerContext{
 		hostID:         mcp.GetHostUUID(),
 		ringpop:        context.rpm,
@@ -220,6 +256,8 @@ func (mcp *Mcp) Start(thriftService []thrift.TChanServer) {
 		log:            context.log,
 		m3Client:       context.m3Client,
 		localZone:      context.localZone,
+		leaders:        context.leaders,
+		cfgMgr:         context.cfgMgr,
 	})
 	context.retMgr.Start()
 
@@ -229,14 +267,27 @@ func (mcp *Mcp) Start(thriftService []thrift.TChanServer) {
 	context.extentMonitor = newExtentStateMonitor(context)
 	context.extentMonitor.Start()
 
+	context.rebalancer = newRebalancer(context)
+	context.rebalancer.Start()
+
+	context.replicaVerifier = newReplicaVerifier(context)
+	context.replicaVerifier.Start()
+
+	context.extentRoller.Start()
+
 	atomic.StoreInt32(&mcp.started, 1)
 }
 
 // Stop stops the controller service
 func (mcp *Mcp) Stop() {
 	mcp.hostIDHeartbeater.Stop()
+	mcp.context.extentRoller.Stop()
+	mcp.context.replicaVerifier.Stop()
+	mcp.context.rebalancer.Stop()
 	mcp.context.extentMonitor.Stop()
 	mcp.context.retMgr.Stop()
+	mcp.context.eventJournal.Stop()
+	mcp.context.leaders.Stop()
 	mcp.context.failureDetector.Stop()
 	mcp.context.eventPipeline.Stop()
 	mcp.context.loadMetrics.Stop()
@@ -622,6 +673,13 @@ func (mcp *Mcp) ReportDestinationExtentMetric(ctx thrift.Context, request *c.Rep
 	if metrics.IsSetIncomingBytesCounter() {
 		loadMetrics.Put(hostID, extID, load.BytesInPerSec, metrics.GetIncomingBytesCounter(), timestamp)
 	}
+	if metrics.IsSetPutMessageLatency() {
+		loadMetrics.Put(hostID, extID, load.PutMsgLatency, metrics.GetPutMessageLatency(), timestamp)
+	}
+
+	if dstID := request.GetDestinationUUID(); len(dstID) > 0 {
+		mcp.context.extentRoller.report(dstID, extID, timestamp)
+	}
 
 	return nil
 }
@@ -702,6 +760,11 @@ func (mcp *Mcp) ReportConsumerGroupExtentMetric(ctx thrift.Context, request *c.R
 		loadMetrics.Put(hostID, extID, load.BytesOutPerSec, metrics.GetOutgoingBytesCounter(), timestamp)
 	}
 
+	// messages delivered on the extent move its ack level, and its retention
+	if dstID := request.GetDestinationUUID(); len(dstID) > 0 && metrics.GetOutgoingMessagesCounter() > 0 {
+		context.retMgr.extentChanged(dstID, extID)
+	}
+
 	return nil
 }
 
@@ -750,6 +813,16 @@ func (mcp *Mcp) ReportStoreExtentMetric(ctx thrift.Context, request *c.ReportSto
 		context.extentMonitor.RecvStoreExtentHeartbeat(hostID, extID, status)
 	}
 
+	// the replication lag, if the replica is being replicated, comes in the headers
+	lag, err := common.ReplicationLagFromContext(ctx)
+	if err != nil {
+		return &shared.BadRequestError{Message: err.Error()}
+	}
+	if lag != nil {
+		loadMetrics.Put(hostID, extID, load.ReplicationLagMsgs, lag.Messages, timestamp)
+		loadMetrics.Put(hostID, extID, load.ReplicationLagSecs, lag.Seconds, timestamp)
+	}
+
 	return nil
 }
 
@@ -857,6 +930,8 @@ func (mcp *Mcp) UpdateDestination(ctx thrift.Context, updateRequest *shared.Upda
 		return nil, err
 	}
 
+	context.retMgr.destinationChanged(destDesc.GetDestinationUUID())
+
 	if destDesc.GetIsMultiZone() {
 		// send to local replicator to fan out
 		localReplicator, replicatorErr := mcp.GetClientFactory().GetReplicatorClient()
@@ -920,6 +995,8 @@ func (mcp *Mcp) DeleteDestination(ctx thrift.Context, deleteRequest *shared.Dele
 		return err
 	}
 
+	context.retMgr.destinationChanged(destDesc.GetDestinationUUID())
+
 	if destDesc.GetIsMultiZone() {
 		// send to local replicator to fan out
 		localReplicator, replicatorErr := mcp.GetClientFactory().GetReplicatorClient()
@@ -972,6 +1049,8 @@ func (mcp *Mcp) CreateConsumerGroup(ctx thrift.Context, createRequest *shared.Cr
 		return nil, err
 	}
 
+	context.retMgr.destinationChanged(cgDesc.GetDestinationUUID())
+
 	if createRequest.IsSetIsMultiZone() && createRequest.GetIsMultiZone() {
 		// get dest uuid from local consumer group, re-use for remote consumer group
 		cgUUID := cgDesc.GetConsumerGroupUUID()
@@ -1031,21 +1110,31 @@ func (mcp *Mcp) UpdateConsumerGroup(ctx thrift.Context, updateRequest *shared.Up
 		return nil, err
 	}
 
-	//	updateRemoteCGs := func() {
-	//		// send to local replicator to fan out
-	//		localReplicator, err := mcp.GetClientFactory().GetReplicatorClient()
-	//		if err != nil {
-	//			lclLg.Error(err.Error())
-	//		}
+	context.retMgr.destinationChanged(cgDesc.GetDestinationUUID())
+
+	if cgDesc.GetIsMultiZone() {
+		// send to local replicator to fan out
+		localReplicator, replicatorErr := mcp.GetClientFactory().GetReplicatorClient()
+		lclLg = lclLg.WithField(common.TagCnsm, common.FmtCnsm(cgDesc.GetConsumerGroupUUID()))
+		if replicatorErr != nil {
+			lclLg.Error(replicatorErr.Error())
+			context.m3Client.IncCounter(metrics.ControllerUpdateConsumerGroupScope, metrics.ControllerErrCallReplicatorCounter)
 
-	//		err = localReplicator.UpdateRemoteConsumerGroup(ctx, updateRequest)
-	//		if err != nil {
-	//			lclLg.Error(err.Error())
-	//		}
-	//	}
+			// errors in calling replicator doesn't fail this call
+			// a reconciliation process between replicators(slow path) will fix the inconsistency eventually
+			return cgDesc, nil
+		}
 
-	//	// best effort for fast path
-	//	go updateRemoteCGs()
+		replicatorErr = localReplicator.UpdateRemoteConsumerGroup(ctx, updateRequest)
+		if replicatorErr != nil {
+			lclLg.Error(replicatorErr.Error())
+			context.m3Client.IncCounter(metrics.ControllerUpdateConsumerGroupScope, metrics.ControllerErrCallReplicatorCounter)
+
+			// errors in calling replicator doesn't fail this call
+			// a reconciliation process between replicators(slow path) will fix the inconsistency eventually
+			return cgDesc, nil
+		}
+	}
 
 	return cgDesc, nil
 }
@@ -1068,29 +1157,52 @@ func (mcp *Mcp) DeleteConsumerGroup(ctx thrift.Context, deleteRequest *shared.De
 		common.TagCnsPth: common.FmtCnsPth(deleteRequest.GetConsumerGroupName()),
 	})
 
+	// first read the consumer group
+	readConsumerGroupRequest := &m.ReadConsumerGroupRequest{
+		DestinationPath:   common.StringPtr(deleteRequest.GetDestinationPath()),
+		ConsumerGroupName: common.StringPtr(deleteRequest.GetConsumerGroupName()),
+	}
+	cgDesc, err := mcp.mClient.ReadConsumerGroup(ctx, readConsumerGroupRequest)
+	if err != nil {
+		lclLg.Error(err.Error())
+		context.m3Client.IncCounter(metrics.ControllerDeleteConsumerGroupScope, metrics.ControllerFailures)
+		return err
+	}
+
+	lclLg = lclLg.WithField(common.TagCnsm, common.FmtCnsm(cgDesc.GetConsumerGroupUUID()))
+
 	// delete local consumer group
-	err := mcp.mClient.DeleteConsumerGroup(ctx, deleteRequest)
+	err = mcp.mClient.DeleteConsumerGroup(ctx, deleteRequest)
 	if err != nil {
 		lclLg.Error(err.Error())
 		context.m3Client.IncCounter(metrics.ControllerDeleteConsumerGroupScope, metrics.ControllerFailures)
 		return err
 	}
 
-	//	deleteRemoteCGs := func() {
-	//		// send to local replicator to fan out
-	//		localReplicator, err := mcp.GetClientFactory().GetReplicatorClient()
-	//		if err != nil {
-	//			lclLg.Error(err.Error())
-	//		}
+	context.retMgr.destinationChanged(cgDesc.GetDestinationUUID())
 
-	//		err = localReplicator.DeleteRemoteConsumerGroup(ctx, deleteRequest)
-	//		if err != nil {
-	//			lclLg.Error(err.Error())
-	//		}
-	//	}
+	if cgDesc.GetIsMultiZone() {
+		// send to local replicator to fan out
+		localReplicator, replicatorErr := mcp.GetClientFactory().GetReplicatorClient()
+		if replicatorErr != nil {
+			lclLg.Error(replicatorErr.Error())
+			context.m3Client.IncCounter(metrics.ControllerDeleteConsumerGroupScope, metrics.ControllerErrCallReplicatorCounter)
+
+			// errors in calling replicator doesn't fail this call
+			// a reconciliation process between replicators(slow path) will fix the inconsistency eventually
+			return nil
+		}
 
-	//	// best effort for fast path
-	//	go deleteRemoteCGs()
+		replicatorErr = localReplicator.DeleteRemoteConsumerGroup(ctx, deleteRequest)
+		if replicatorErr != nil {
+			lclLg.Error(replicatorErr.Error())
+			context.m3Client.IncCounter(metrics.ControllerDeleteConsumerGroupScope, metrics.ControllerErrCallReplicatorCounter)
+
+			// errors in calling replicator doesn't fail this call
+			// a reconciliation process between replicators(slow path) will fix the inconsistency eventually
+			return nil
+		}
+	}
 
 	return nil
 }
@@ -33,6 +33,7 @@ import (
 	"github.com/uber/cherami-server/common"
 	"github.com/uber/cherami-server/common/configure"
 	dconfig "github.com/uber/cherami-server/common/dconfigclient"
+	"github.com/uber/cherami-server/services/controllerhost/load"
 	"github.com/uber/cherami-server/test"
 	mockcommon "github.com/uber/cherami-server/test/mocks/common"
 	mockreplicator "github.com/uber/cherami-server/test/mocks/replicator"
@@ -624,6 +625,172 @@ func (s *McpSuite) TestGetOutputHosts() {
 	}
 }
 
+func (s *McpSuite) TestGetOutputHostsOnReplicatedAckLevel() {
+
+	path := s.generateName("/cherami/mcp-test")
+	dstDesc, err := s.createDestination(path, shared.DestinationType_PLAIN)
+	s.Nil(err, "Failed to create destination")
+
+	cgName := s.generateName("/cherami/mcp-test-cg")
+	cgDesc, err := s.createConsumerGroup(path, cgName)
+	s.Nil(err, "Failed to create consumer group")
+
+	dstUUID := dstDesc.GetDestinationUUID()
+	cgUUID := cgDesc.GetConsumerGroupUUID()
+
+	storehosts, _ := s.mcp.context.placement.PickStoreHosts(3)
+	storeids := make([]string, 3)
+	for i := 0; i < 3; i++ {
+		storeids[i] = storehosts[i].UUID
+	}
+	inhost, _ := s.mcp.context.placement.PickInputHost(storehosts)
+	extentUUID := uuid.New()
+	_, err = s.mcp.context.mm.CreateExtent(dstUUID, extentUUID, inhost.UUID, storeids)
+	s.Nil(err, "Failed to create new extent")
+
+	// the replicator creates the consumer group extent, without
+	// outputhost, when it gets an ack level from another zone
+	mzService, ok := s.mClient.(mc.MultiZoneService)
+	s.True(ok, "Metadata client doesn't support replicated ack levels")
+	moved, err := mzService.SetReplicatedAckLevel(nil, cgUUID, extentUUID, storeids, 100, 10)
+	s.Nil(err, "SetReplicatedAckLevel() failed")
+	s.True(moved)
+
+	resp, err := s.mcp.GetOutputHosts(nil, &c.GetOutputHostsRequest{DestinationUUID: common.StringPtr(dstUUID), ConsumerGroupUUID: common.StringPtr(cgUUID)})
+	s.Nil(err, "GetOutputHosts() failed")
+	s.Equal(1, len(resp.GetOutputHostIds()), "GetOutputHosts() returned more than one out host")
+
+	outputHost, err := s.mockrpm.FindHostForAddr(common.OutputServiceName, resp.OutputHostIds[0])
+	s.Nil(err, "GetOutputHosts() returned invalid host")
+
+	// the extent is assigned an outputhost, and keeps the shipped ack level
+	cge, err := s.mClient.ReadConsumerGroupExtent(nil, &m.ReadConsumerGroupExtentRequest{
+		ConsumerGroupUUID: common.StringPtr(cgUUID),
+		ExtentUUID:        common.StringPtr(extentUUID),
+	})
+	s.Nil(err, "Failed to read consumer group extent")
+	s.Equal(m.ConsumerGroupExtentStatus_OPEN, cge.GetExtent().GetStatus())
+	s.Equal(outputHost.UUID, cge.GetExtent().GetOutputHostUUID(), "Consumer group extent wasn't assigned an outputhost")
+	s.Equal(int64(100), cge.GetExtent().GetAckLevelOffset())
+}
+
+func (s *McpSuite) TestExtentRollerSize() {
+
+	path := s.generateName("/cherami/mcp-test")
+	dstDesc, err := s.createDestination(path, shared.DestinationType_PLAIN)
+	s.Nil(err, "Failed to create destination")
+	dstUUID := dstDesc.GetDestinationUUID()
+
+	storehosts, _ := s.mcp.context.placement.PickStoreHosts(3)
+	storeids := make([]string, 3)
+	for i := 0; i < 3; i++ {
+		storeids[i] = storehosts[i].UUID
+	}
+	inhost, _ := s.mcp.context.placement.PickInputHost(storehosts)
+	extentUUID := uuid.New()
+	_, err = s.mcp.context.mm.CreateExtent(dstUUID, extentUUID, inhost.UUID, storeids)
+	s.Nil(err, "Failed to create new extent")
+
+	extent := &shared.Extent{ExtentUUID: common.StringPtr(extentUUID), StoreUUIDs: storeids}
+	roller := s.mcp.context.extentRoller
+
+	msgs, bytes := roller.getSize(extent)
+	s.Equal(int64(0), msgs)
+	s.Equal(int64(0), bytes)
+
+	// the size is the largest one reported by the replicas, one of them lagging
+	for i, size := range []int64{1000, 900} {
+		err = s.mClient.UpdateStoreExtentReplicaStats(nil, &m.UpdateStoreExtentReplicaStatsRequest{
+			ExtentUUID: common.StringPtr(extentUUID),
+			ReplicaStats: []*shared.ExtentReplicaStats{
+				{
+					ExtentUUID:   common.StringPtr(extentUUID),
+					StoreUUID:    common.StringPtr(storeids[i]),
+					LastSequence: common.Int64Ptr(size),
+					SizeInBytes:  common.Int64Ptr(size * 100),
+				},
+			},
+		})
+		s.Nil(err, "Failed to update replica stats")
+	}
+
+	msgs, bytes = roller.getSize(extent)
+	s.Equal(int64(1000), msgs)
+	s.Equal(int64(100000), bytes)
+}
+
+func (s *McpSuite) TestRebalancerMovesExtents() {
+
+	path := s.generateName("/cherami/mcp-test")
+	dstDesc, err := s.createDestination(path, shared.DestinationType_PLAIN)
+	s.Nil(err, "Failed to create destination")
+	dstUUID := dstDesc.GetDestinationUUID()
+
+	context := s.mcp.context
+	clock := common.NewMockTimeSource()
+	loadMetrics := context.loadMetrics
+	context.loadMetrics = load.NewTimeSlotAggregator(clock, context.log)
+	context.loadMetrics.Start()
+	defer func() {
+		context.loadMetrics.Stop()
+		context.loadMetrics = loadMetrics
+	}()
+
+	inputHosts, err := s.mockrpm.GetHosts(common.InputServiceName)
+	s.Nil(err)
+	s.Equal(3, len(inputHosts))
+	hotHost := inputHosts[0].UUID
+
+	storehosts, err := context.placement.PickStoreHosts(3)
+	s.Nil(err)
+	storeids := []string{storehosts[0].UUID, storehosts[1].UUID, storehosts[2].UUID}
+
+	// all the load is on the extents of a single input host
+	now := clock.Now().UnixNano()
+	extents := make(map[string]struct{})
+	for i := 0; i < 3; i++ {
+		extentUUID := uuid.New()
+		_, err = context.mm.CreateExtent(dstUUID, extentUUID, hotHost, storeids)
+		s.Nil(err, "Failed to create extent")
+		extents[extentUUID] = struct{}{}
+		context.loadMetrics.Put(hotHost, extentUUID, load.MsgsInPerSec, 300, now)
+	}
+	for _, h := range inputHosts {
+		val := int64(0)
+		if h.UUID == hotHost {
+			val = 900
+		}
+		context.loadMetrics.Put(h.UUID, load.EmptyTag, load.MsgsInPerSec, val, now)
+	}
+	aggr, _ := context.loadMetrics.(*load.TimeslotAggregator)
+	for aggr.DataChannelLength() > 0 {
+		time.Sleep(time.Millisecond * 2)
+	}
+	clock.Advance(time.Minute)
+
+	r := newRebalancer(context)
+	r.rebalance(&rebalanceConfig{mode: rebalancerModeOn, thresholdPercent: 25, maxMoves: 1})
+
+	report := r.getReport()
+	s.NotNil(report)
+	s.Equal(1, len(report.Moves))
+
+	move := report.Moves[0]
+	s.Equal(rebalanceMoveExtent, move.Type)
+	s.Equal(hotHost, move.FromHost)
+	s.NotEqual(hotHost, move.ToHost)
+	s.True(move.Done)
+	s.Contains(extents, move.UUID)
+	s.True(isExtentBeingSealed(context, move.UUID), "Moved extent is not being sealed")
+
+	// the replacement extent is created on the planned target
+	mResp, err := s.listInputHostExtents(dstUUID, move.ToHost)
+	s.Nil(err)
+	s.Equal(1, len(mResp.GetExtentStatsList()), "Replacement extent not created on target input host")
+	s.Equal(shared.ExtentStatus_OPEN, mResp.GetExtentStatsList()[0].GetStatus())
+	s.NotContains(extents, mResp.GetExtentStatsList()[0].GetExtent().GetExtentUUID())
+}
+
 func (s *McpSuite) TestMultiZoneDestCUD() {
 	/*********TEST CREATION*****************/
 	var destUUID string
@@ -762,7 +929,11 @@ func (s *McpSuite) TestUpdateConsumerGroup() {
 	cgName := s.generateName("/cherami/mcp-test-cg")
 	_, err := s.createDestination(destPath, shared.DestinationType_PLAIN)
 	s.Nil(err, "Failed to create destination")
-	_, err = s.createConsumerGroup(destPath, cgName)
+	_, err = s.mClient.CreateConsumerGroup(nil, &shared.CreateConsumerGroupRequest{
+		DestinationPath:   common.StringPtr(destPath),
+		ConsumerGroupName: common.StringPtr(cgName),
+		IsMultiZone:       common.BoolPtr(true),
+	})
 	s.Nil(err, "Failed to create consumer group")
 
 	newOwnerEmail := "updated@email.com"
@@ -784,6 +955,7 @@ func (s *McpSuite) TestUpdateConsumerGroup() {
 	cgDesc, err := s.mcp.UpdateConsumerGroup(nil, updateReq)
 	s.NoError(err)
 	s.NotNil(cgDesc)
+	s.mockReplicator.AssertCalled(s.T(), "UpdateRemoteConsumerGroup", mock.Anything, mock.Anything)
 
 	// verify local operation
 	cgDesc, err = s.mClient.ReadConsumerGroup(nil, &m.ReadConsumerGroupRequest{
@@ -800,7 +972,11 @@ func (s *McpSuite) TestDeleteConsumerGroup() {
 	cgName := s.generateName("/cherami/mcp-test-cg")
 	_, err := s.createDestination(destPath, shared.DestinationType_PLAIN)
 	s.Nil(err, "Failed to create destination")
-	_, err = s.createConsumerGroup(destPath, cgName)
+	_, err = s.mClient.CreateConsumerGroup(nil, &shared.CreateConsumerGroupRequest{
+		DestinationPath:   common.StringPtr(destPath),
+		ConsumerGroupName: common.StringPtr(cgName),
+		IsMultiZone:       common.BoolPtr(true),
+	})
 	s.Nil(err, "Failed to create consumer group")
 
 	deleteReq := &shared.DeleteConsumerGroupRequest{
@@ -818,6 +994,7 @@ func (s *McpSuite) TestDeleteConsumerGroup() {
 	// issue request
 	err = s.mcp.DeleteConsumerGroup(nil, deleteReq)
 	s.NoError(err)
+	s.mockReplicator.AssertCalled(s.T(), "DeleteRemoteConsumerGroup", mock.Anything, mock.Anything)
 
 	// verify local operation
 	cgDesc, err := s.mClient.ReadConsumerGroup(nil, &m.ReadConsumerGroupRequest{
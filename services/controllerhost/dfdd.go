@@ -40,6 +40,7 @@ type (
 
 		// override the durations, used for testing
 		OverrideHostDownPeriodForStage2(period time.Duration)
+		OverrideHostDownPeriodForStage3(period time.Duration)
 		OverrideHealthCheckInterval(period time.Duration)
 	}
 
@@ -55,19 +56,25 @@ type (
 		// Channels subscribed to RingpopMonitor
 		// RingpopMonitor will enqueue Join/Leave
 		// events to this channel
-		inputListenerCh chan *common.RingpopListenerEvent
-		storeListenerCh chan *common.RingpopListenerEvent
+		inputListenerCh  chan *common.RingpopListenerEvent
+		outputListenerCh chan *common.RingpopListenerEvent
+		storeListenerCh  chan *common.RingpopListenerEvent
 
 		healthCheckTicker   *time.Ticker
 		healthCheckInterval time.Duration
 
 		unhealthyStores     map[string]time.Time
 		unhealthyStoresLock sync.RWMutex
+		// time when each unhealthy store was first seen as
+		// down, unlike unhealthyStores this is not reset by
+		// the periodic stage 2 handling
+		storesDownSince map[string]time.Time
 
 		unhealthyInputs     map[string]time.Time
 		unhealthyInputsLock sync.RWMutex
 
 		hostDownPeriodForStage2 time.Duration
+		hostDownPeriodForStage3 time.Duration // zero means use the dynamic config
 	}
 )
 
@@ -91,12 +98,13 @@ const (
 // stage 1: host is just removed from ringpop. Any service restart or deployment can trigger it
 // stage 2: host is removed from ringpop for hostDownPeriodForStage2. For example a machine reboot can trigger it
 // stage 3: host is removed form ringpop for hostDownPeriodForStage3(for example: 24 hrs). Most likely the machine is down and needs manual repair.
-// Note currently stage 3 is not being handled yet
+// Note currently stage 3 is only handled for store hosts, by re-replicating their extents to other store hosts
 type hostDownStage int
 
 const (
 	hostDownStage1 hostDownStage = iota
 	hostDownStage2
+	hostDownStage3
 )
 
 // NewDfdd creates and returns an instance of discovery
@@ -110,8 +118,10 @@ func NewDfdd(context *Context) Dfdd {
 		context:                 context,
 		shutdownC:               make(chan struct{}),
 		inputListenerCh:         make(chan *common.RingpopListenerEvent, listenerChannelSize),
+		outputListenerCh:        make(chan *common.RingpopListenerEvent, listenerChannelSize),
 		storeListenerCh:         make(chan *common.RingpopListenerEvent, listenerChannelSize),
 		unhealthyStores:         make(map[string]time.Time),
+		storesDownSince:         make(map[string]time.Time),
 		unhealthyInputs:         make(map[string]time.Time),
 		hostDownPeriodForStage2: hostDownPeriodForStage2,
 		healthCheckInterval:     healthCheckInterval,
@@ -133,6 +143,12 @@ func (dfdd *dfddImpl) Start() {
 		return
 	}
 
+	err = rpm.AddListener(common.OutputServiceName, buildListenerName(common.OutputServiceName), dfdd.outputListenerCh)
+	if err != nil {
+		dfdd.context.log.WithField(common.TagErr, err).Fatal(`AddListener(outputhost) failed`)
+		return
+	}
+
 	err = rpm.AddListener(common.StoreServiceName, buildListenerName(common.StoreServiceName), dfdd.storeListenerCh)
 	if err != nil {
 		dfdd.context.log.WithField(common.TagErr, err).Fatal(`AddListener(storehost) failed`)
@@ -165,6 +181,8 @@ func (dfdd *dfddImpl) run() {
 		select {
 		case e := <-dfdd.inputListenerCh:
 			dfdd.handleListenerEvent(inputServiceID, e)
+		case e := <-dfdd.outputListenerCh:
+			dfdd.handleListenerEvent(outputServiceID, e)
 		case e := <-dfdd.storeListenerCh:
 			dfdd.handleListenerEvent(storeServiceID, e)
 		case <-dfdd.shutdownC:
@@ -178,6 +196,30 @@ func (dfdd *dfddImpl) OverrideHostDownPeriodForStage2(period time.Duration) {
 	dfdd.hostDownPeriodForStage2 = period
 }
 
+func (dfdd *dfddImpl) OverrideHostDownPeriodForStage3(period time.Duration) {
+	dfdd.hostDownPeriodForStage3 = period
+}
+
+// getHostDownPeriodForStage3 returns the period after which a store host
+// is considered lost for good, zero if stage 3 handling is disabled
+func (dfdd *dfddImpl) getHostDownPeriodForStage3() time.Duration {
+	if dfdd.hostDownPeriodForStage3 > 0 {
+		return dfdd.hostDownPeriodForStage3
+	}
+	if dfdd.context.cfgMgr == nil {
+		return 0
+	}
+	cfgIface, err := dfdd.context.cfgMgr.Get(common.ControllerServiceName, `*`, `*`, `*`)
+	if err != nil {
+		return 0
+	}
+	cfg, ok := cfgIface.(ControllerDynamicConfig)
+	if !ok || cfg.StoreHostDownPeriodForStage3Mins <= 0 {
+		return 0
+	}
+	return time.Duration(cfg.StoreHostDownPeriodForStage3Mins) * time.Minute
+}
+
 func (dfdd *dfddImpl) OverrideHealthCheckInterval(period time.Duration) {
 	dfdd.healthCheckInterval = period
 }
@@ -206,6 +248,7 @@ func (dfdd *dfddImpl) healthCheckRoutine() {
 
 	var unhealthyStoreList []string
 	{
+		stage3Period := dfdd.getHostDownPeriodForStage3()
 		dfdd.unhealthyStoresLock.RLock()
 		currentTime := time.Now().UTC()
 		for host, lastSeenTime := range dfdd.unhealthyStores {
@@ -220,6 +263,21 @@ func (dfdd *dfddImpl) healthCheckRoutine() {
 					dfdd.context.log.WithField(common.TagStor, common.FmtStor(host)).Error("Failed to enqueue StoreHostFailedEvent(stage 2)")
 				}
 				unhealthyStoreList = append(unhealthyStoreList, host)
+
+				// stage 3 is re-triggered along with stage 2 for as long as the host
+				// stays down, so extents that could not be re-replicated before are
+				// retried; the ones that were re-replicated no longer list this host
+				if downSince, ok := dfdd.storesDownSince[host]; ok && stage3Period > 0 && currentTime.Sub(downSince) > stage3Period {
+					dfdd.context.log.WithFields(bark.Fields{
+						common.TagStor: common.FmtStor(host),
+						`down since`:   downSince,
+					}).Info("Store host is down(stage3)")
+
+					event := NewStoreHostFailedEvent(host, hostDownStage3)
+					if !dfdd.context.eventPipeline.Add(event) {
+						dfdd.context.log.WithField(common.TagStor, common.FmtStor(host)).Error("Failed to enqueue StoreHostFailedEvent(stage 3)")
+					}
+				}
 			}
 		}
 		dfdd.unhealthyStoresLock.RUnlock()
@@ -255,7 +313,11 @@ func (dfdd *dfddImpl) reportHostUnhealthy(id serviceID, hostUUID string) {
 		dfdd.context.log.WithField(common.TagStor, common.FmtStor(hostUUID)).Info("report store unhealthy")
 		dfdd.unhealthyStoresLock.Lock()
 		defer dfdd.unhealthyStoresLock.Unlock()
-		dfdd.unhealthyStores[hostUUID] = time.Now().UTC()
+		now := time.Now().UTC()
+		dfdd.unhealthyStores[hostUUID] = now
+		if _, ok := dfdd.storesDownSince[hostUUID]; !ok {
+			dfdd.storesDownSince[hostUUID] = now
+		}
 	}
 }
 
@@ -269,6 +331,7 @@ func (dfdd *dfddImpl) reportHostHealthy(id serviceID, hostUUID string) {
 		dfdd.unhealthyStoresLock.Lock()
 		defer dfdd.unhealthyStoresLock.Unlock()
 		delete(dfdd.unhealthyStores, hostUUID)
+		delete(dfdd.storesDownSince, hostUUID)
 	}
 }
 
@@ -287,6 +350,9 @@ func (dfdd *dfddImpl) handleListenerEvent(id serviceID, listenerEvent *common.Ri
 	case inputServiceID:
 		dfdd.context.log.WithField(common.TagIn, common.FmtIn(listenerEvent.Key)).Info("InputHostFailed")
 		event = NewInputHostFailedEvent(listenerEvent.Key)
+	case outputServiceID:
+		dfdd.context.log.WithField(common.TagOut, common.FmtOut(listenerEvent.Key)).Info("OutputHostFailed")
+		event = NewOutputHostFailedEvent(listenerEvent.Key)
 	case storeServiceID:
 		dfdd.context.log.WithField(common.TagStor, common.FmtStor(listenerEvent.Key)).Info("StoreHostFailed")
 		event = NewStoreHostFailedEvent(listenerEvent.Key, hostDownStage1)
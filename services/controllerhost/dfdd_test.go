@@ -66,12 +66,17 @@ func (s *DfddTestSuite) TestFailureDetection() {
 	s.dfdd.OverrideHealthCheckInterval(time.Duration(1 * time.Second))
 	s.dfdd.Start()
 	inHostIDs := []string{uuid.New(), uuid.New(), uuid.New()}
+	outHostIDs := []string{uuid.New(), uuid.New(), uuid.New()}
 	storeIDs := []string{uuid.New(), uuid.New(), uuid.New()}
 
 	for _, h := range inHostIDs {
 		s.rpm.NotifyListeners(common.InputServiceName, h, common.HostAddedEvent)
 		s.rpm.NotifyListeners(common.InputServiceName, h, common.HostRemovedEvent)
 	}
+	for _, h := range outHostIDs {
+		s.rpm.NotifyListeners(common.OutputServiceName, h, common.HostAddedEvent)
+		s.rpm.NotifyListeners(common.OutputServiceName, h, common.HostRemovedEvent)
+	}
 	for _, h := range storeIDs {
 		s.rpm.NotifyListeners(common.StoreServiceName, h, common.HostAddedEvent)
 		s.rpm.NotifyListeners(common.StoreServiceName, h, common.HostRemovedEvent)
@@ -79,6 +84,7 @@ func (s *DfddTestSuite) TestFailureDetection() {
 
 	cond := func() bool {
 		return (s.eventPipeline.inHostFailureCount() == len(inHostIDs) &&
+			s.eventPipeline.outHostFailureCount() == len(outHostIDs) &&
 			s.eventPipeline.storeHostFailureStage1Count() == len(storeIDs) &&
 			s.eventPipeline.storeHostFailureStage2Count() == len(storeIDs))
 	}
@@ -90,6 +96,10 @@ func (s *DfddTestSuite) TestFailureDetection() {
 		s.True(s.eventPipeline.isHostFailed(h), "Dfdd failed to detect in host failure")
 	}
 
+	for _, h := range outHostIDs {
+		s.True(s.eventPipeline.isHostFailed(h), "Dfdd failed to detect out host failure")
+	}
+
 	for _, h := range storeIDs {
 		s.True(s.eventPipeline.isHostFailed(h), "Dfdd failed to detect store host failure")
 		s.True(s.eventPipeline.isStoreFailedStage2(h), "Dfdd failed to detect store host stage 2 failure")
@@ -98,12 +108,45 @@ func (s *DfddTestSuite) TestFailureDetection() {
 	s.dfdd.Stop()
 }
 
+func (s *DfddTestSuite) TestStoreHostLost() {
+	s.dfdd.OverrideHostDownPeriodForStage2(time.Duration(1 * time.Second))
+	s.dfdd.OverrideHostDownPeriodForStage3(time.Duration(2 * time.Second))
+	s.dfdd.OverrideHealthCheckInterval(time.Duration(1 * time.Second))
+	s.dfdd.Start()
+	lostIDs := []string{uuid.New(), uuid.New()}
+	backID := uuid.New()
+
+	for _, h := range append(lostIDs, backID) {
+		s.rpm.NotifyListeners(common.StoreServiceName, h, common.HostAddedEvent)
+		s.rpm.NotifyListeners(common.StoreServiceName, h, common.HostRemovedEvent)
+	}
+	// the store host that comes back must not be considered lost
+	s.rpm.NotifyListeners(common.StoreServiceName, backID, common.HostAddedEvent)
+
+	cond := func() bool {
+		for _, h := range lostIDs {
+			if !s.eventPipeline.isStoreFailedStage3(h) {
+				return false
+			}
+		}
+		return true
+	}
+
+	succ := common.SpinWaitOnCondition(cond, 10*time.Second)
+	s.True(succ, "Dfdd failed to detect lost store hosts within timeout")
+	s.False(s.eventPipeline.isStoreFailedStage3(backID), "Dfdd detected a healthy store host as lost")
+
+	s.dfdd.Stop()
+}
+
 type testEventPipelineImpl struct {
 	inHostFailures          int
+	outHostFailures         int
 	storeHostStage1Failures int
 	storeHostStage2Failures int
 	failedHosts             map[string]bool
 	failedStage2Stores      map[string]bool
+	failedStage3Stores      map[string]bool
 	mutex                   sync.Mutex
 }
 
@@ -111,6 +154,7 @@ func newTestEventPipeline() *testEventPipelineImpl {
 	return &testEventPipelineImpl{
 		failedHosts:        make(map[string]bool),
 		failedStage2Stores: make(map[string]bool),
+		failedStage3Stores: make(map[string]bool),
 	}
 }
 
@@ -123,6 +167,10 @@ func (ep *testEventPipelineImpl) Add(event Event) bool {
 		ep.inHostFailures++
 		e, _ := event.(*InputHostFailedEvent)
 		ep.failedHosts[e.hostUUID] = true
+	case *OutputHostFailedEvent:
+		ep.outHostFailures++
+		e, _ := event.(*OutputHostFailedEvent)
+		ep.failedHosts[e.hostUUID] = true
 	case *StoreHostFailedEvent:
 		e, _ := event.(*StoreHostFailedEvent)
 		if e.stage == hostDownStage1 {
@@ -131,6 +179,8 @@ func (ep *testEventPipelineImpl) Add(event Event) bool {
 		} else if e.stage == hostDownStage2 {
 			ep.storeHostStage2Failures++
 			ep.failedStage2Stores[e.hostUUID] = true
+		} else if e.stage == hostDownStage3 {
+			ep.failedStage3Stores[e.hostUUID] = true
 		}
 	}
 	ep.mutex.Unlock()
@@ -141,6 +191,14 @@ func (ep *testEventPipelineImpl) GetRetryableEventExecutor() RetryableEventExecu
 	return nil
 }
 
+func (ep *testEventPipelineImpl) Status() *EventPipelineStatus {
+	return &EventPipelineStatus{}
+}
+
+func (ep *testEventPipelineImpl) Abort(id int64, eventType string) error {
+	return nil
+}
+
 func (ep *testEventPipelineImpl) isHostFailed(uuid string) bool {
 	ok := false
 	ep.mutex.Lock()
@@ -157,6 +215,14 @@ func (ep *testEventPipelineImpl) isStoreFailedStage2(uuid string) bool {
 	return ok
 }
 
+func (ep *testEventPipelineImpl) isStoreFailedStage3(uuid string) bool {
+	ok := false
+	ep.mutex.Lock()
+	_, ok = ep.failedStage3Stores[uuid]
+	ep.mutex.Unlock()
+	return ok
+}
+
 func (ep *testEventPipelineImpl) storeHostFailureStage1Count() int {
 	count := 0
 	ep.mutex.Lock()
@@ -181,6 +247,14 @@ func (ep *testEventPipelineImpl) inHostFailureCount() int {
 	return count
 }
 
+func (ep *testEventPipelineImpl) outHostFailureCount() int {
+	count := 0
+	ep.mutex.Lock()
+	count = ep.outHostFailures
+	ep.mutex.Unlock()
+	return count
+}
+
 type testRpmImpl struct {
 	listeners map[string][]chan<- *common.RingpopListenerEvent
 }
@@ -34,6 +34,8 @@ type (
 	dlqMonitor struct {
 		*Context
 		dlqMinMergeTimestamp common.UnixNanoTime
+		// term is the leadership term the iteration started in
+		term int64
 		destinationFlags
 	}
 
@@ -114,6 +116,7 @@ func (m *dlqMonitor) handleEvent(e *mIteratorEvent) {
 	switch e.t {
 	case eIterStart:
 		m.dlqMinMergeTimestamp = common.Now() - common.UnixNanoTime(common.DLQMaxMergeAge)
+		m.term, _ = m.Context.leaders.Term(leaseExtentMonitor)
 	case eDestStart:
 		// Reset all destination flags to their original values
 		m.destinationFlags = destinationFlags{}
@@ -151,7 +154,9 @@ func (m *dlqMonitor) handleEvent(e *mIteratorEvent) {
 				`maxTime`:              m.operationTime,
 				`dlqMinMergeTimestamp`: m.dlqMinMergeTimestamp,
 			}).Info(`Resetting DLQ operation, timestamps are too old`)
-			m.resetTimestamp(e, m.op, m.operationTime)
+			if m.isPrimary() {
+				m.resetTimestamp(e, m.op, m.operationTime)
+			}
 			m.destinationFlags = destinationFlags{}
 			return
 		}
@@ -186,6 +191,10 @@ func (m *dlqMonitor) handleEvent(e *mIteratorEvent) {
 
 		if common.UnixNanoTime(createTime) < common.UnixNanoTime(m.operationTime) {
 			m.destinationFlags.dirty = true
+			if !m.isPrimary() {
+				ll().Warn(`Skipping extent, controller lost the primary role during the iteration`)
+				return
+			}
 			switch m.op {
 			case mergeOp:
 				m.merge(e)
@@ -208,6 +217,10 @@ func (m *dlqMonitor) handleEvent(e *mIteratorEvent) {
 		ll().Info(`End of destination`)
 
 		if !m.destinationFlags.dirty { // End of multiple iterations for this operation, no seals/merges/purges occurred on this latest pass
+			if !m.isPrimary() {
+				ll().Warn(`Skipping operation end, controller lost the primary role during the iteration`)
+				return
+			}
 			ll().Info(`Notifying output hosts`)
 			err := notifyOutputHostsForConsumerGroup(m.Context, e.dest.GetDestinationUUID(), e.dest.GetDLQConsumerGroupUUID(),
 				notifyDLQMergedExtents, e.dest.GetDestinationUUID(), metrics.DLQOperationScope)
@@ -221,6 +234,12 @@ func (m *dlqMonitor) handleEvent(e *mIteratorEvent) {
 	}
 }
 
+// isPrimary returns true if this controller is still the
+// primary it was when the current iteration started
+func (m *dlqMonitor) isPrimary() bool {
+	return m.Context.leaders.IsLeaderForTerm(leaseExtentMonitor, m.term)
+}
+
 func (m *dlqMonitor) merge(e *mIteratorEvent) (err error) {
 	defer func() {
 		if err != nil {
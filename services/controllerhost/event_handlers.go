@@ -21,6 +21,8 @@
 package controllerhost
 
 import (
+	"errors"
+	"math"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -32,6 +34,7 @@ import (
 	"github.com/uber/cherami-server/common"
 	"github.com/uber/cherami-server/common/metrics"
 	"github.com/uber/cherami-thrift/.generated/go/admin"
+	"github.com/uber/cherami-thrift/.generated/go/cherami"
 	m "github.com/uber/cherami-thrift/.generated/go/metadata"
 	"github.com/uber/cherami-thrift/.generated/go/shared"
 	"github.com/uber/cherami-thrift/.generated/go/store"
@@ -122,12 +125,43 @@ type (
 		remoteExtentPrimaryStore string
 	}
 
+	// StoreHostDrainEvent is triggered
+	// when a store host is being drained,
+	// to move its extents to other stores
+	StoreHostDrainEvent struct {
+		eventBase
+		hostUUID string
+	}
+
+	// ExtentRollEvent is triggered when an
+	// open extent crosses the size or age
+	// limit of its destination. The action
+	// is to open a replacement extent and
+	// then seal the extent.
+	ExtentRollEvent struct {
+		eventBase
+		dstID    string
+		extentID string
+		reason   string
+		rolled   bool
+	}
+
 	// InputHostFailedEvent is triggered
 	// when an input host fails
 	InputHostFailedEvent struct {
 		eventBase
 		hostUUID string
 	}
+	// OutputHostFailedEvent is triggered
+	// when an output host fails
+	OutputHostFailedEvent struct {
+		eventBase
+		hostUUID string
+		// retryCGs maps the consumer groups that couldn't
+		// be reassigned to their destination, the retries
+		// only reassign these
+		retryCGs map[string]string
+	}
 	// StoreHostFailedEvent is triggered
 	// when a store host fails
 	StoreHostFailedEvent struct {
@@ -135,6 +169,46 @@ type (
 		hostUUID string
 		stage    hostDownStage
 	}
+	// ExtentReReplicationEvent is triggered
+	// for every sealed extent that had a replica
+	// on a store host that is considered lost or
+	// that is being drained. The action is to copy
+	// the extent from a surviving replica to a new
+	// store host and replace the old store in metadata
+	ExtentReReplicationEvent struct {
+		eventBase
+		dstID         string
+		extentID      string
+		failedStoreID string
+		newStoreID    string // picked on the first attempt, reused by the retries
+		sourceID      string
+		sealSeqNum    int64 // where the source replica is sealed
+		lastSeqNum    int64 // last message on the new replica, on the previous poll
+		stalls        int
+		attempts      int
+		started       bool
+		replaced      bool
+	}
+
+	// reReplicationStatus is the progress of a
+	// single extent re-replication, it is never
+	// modified once stored in extentRepairs
+	reReplicationStatus struct {
+		DstUUID         string    `json:"destinationUUID"`
+		ExtentUUID      string    `json:"extentUUID"`
+		FailedStoreUUID string    `json:"failedStoreUUID"`
+		NewStoreUUID    string    `json:"newStoreUUID,omitempty"`
+		State           string    `json:"state"`
+		Attempts        int       `json:"attempts"`
+		StartTime       time.Time `json:"startTime"`
+	}
+)
+
+// ExtentReReplicationEvent states, as reported by reReplicationStatus
+const (
+	reReplicationPending     = "pending"
+	reReplicationReplicating = "replicating"
+	reReplicationUpdating    = "updatingMetadata"
 )
 
 // ExtentDownEvent States
@@ -155,6 +229,12 @@ var (
 	replicateExtentCallTimeout   = 20 * time.Second
 )
 
+// maxReReplicationStalls is how many polls a new replica can make no
+// progress for, before its replication is started again
+const maxReReplicationStalls = 3
+
+var errReReplicationNotSupported = errors.New("metadata client does not support replacing extent replicas")
+
 // this is the list of "reasons" for notifications sent to outputhost/inputhost
 const (
 	notifyExtentCreated    = "ExtentCreated"
@@ -162,6 +242,8 @@ const (
 	notifyCGExtUpdated     = "CGExtUpdated"
 	notifyDLQMergedExtents = "DLQMergedExtents"
 	notifyCGDeleted        = "CGDeleted"
+	notifyOutputHostFailed = "OutputHostFailed"
+	notifyCGRebalanced     = "CGRebalanced"
 )
 
 // Done provides default callback for all events
@@ -249,6 +331,21 @@ func NewInputHostFailedEvent(hostUUID string) Event {
 	return &InputHostFailedEvent{hostUUID: hostUUID}
 }
 
+// NewStoreHostDrainEvent creates and returns a StoreHostDrainEvent
+func NewStoreHostDrainEvent(hostUUID string) Event {
+	return &StoreHostDrainEvent{hostUUID: hostUUID}
+}
+
+// NewExtentRollEvent creates and returns an ExtentRollEvent
+func NewExtentRollEvent(dstID string, extentID string, reason string) Event {
+	return &ExtentRollEvent{dstID: dstID, extentID: extentID, reason: reason}
+}
+
+// NewOutputHostFailedEvent creates and returns a OutputHostFailedEvent
+func NewOutputHostFailedEvent(hostUUID string) Event {
+	return &OutputHostFailedEvent{hostUUID: hostUUID}
+}
+
 // NewStoreHostFailedEvent creates and returns a StoreHostFailedEvent
 func NewStoreHostFailedEvent(hostUUID string, stage hostDownStage) Event {
 	return &StoreHostFailedEvent{
@@ -257,6 +354,15 @@ func NewStoreHostFailedEvent(hostUUID string, stage hostDownStage) Event {
 	}
 }
 
+// NewExtentReReplicationEvent creates and returns a ExtentReReplicationEvent
+func NewExtentReReplicationEvent(dstID string, extentID string, failedStoreID string) Event {
+	return &ExtentReReplicationEvent{
+		dstID:         dstID,
+		extentID:      extentID,
+		failedStoreID: failedStoreID,
+	}
+}
+
 // Handle handles the creation of a new extent.
 // Following are the async actions to be triggered on creation of an extent:
 //    a. For every input host that serves a open extent for the DST
@@ -535,9 +641,154 @@ func (event *InputHostFailedEvent) Handle(context *Context) error {
 	return nil
 }
 
-// Handle handles an StoreHostFailedEvent. All it does is to list all
-// OPEN extents for the store host and enqueue an ExtentDownEvent for
-// each one of them.
+// Handle handles an OutputHostFailedEvent. It finds all the OPEN
+// consumer group extents that are assigned to the output host,
+// reassigns them to healthy output hosts and notifies the new
+// output hosts, so that the consumers get reconfigured without
+// waiting for the next GetOutputHosts call to repair the extents.
+// Only the primary controller handles the event. Consumer groups
+// that can't be reassigned are retried.
+func (event *OutputHostFailedEvent) Handle(context *Context) error {
+	sw := context.m3Client.StartTimer(metrics.OutputFailedEventScope, metrics.ControllerLatencyTimer)
+	defer sw.Stop()
+	context.m3Client.IncCounter(metrics.OutputFailedEventScope, metrics.ControllerRequests)
+
+	// every controller's dfdd sees the host leave, only the primary
+	// repairs, or each one would scan all the consumer groups and
+	// move the same extents to a different output host
+	if !isPrimaryController(context) {
+		return nil
+	}
+
+	if event.retryCGs != nil {
+		failed := make(map[string]string)
+		for cgID, dstID := range event.retryCGs {
+			if err := event.reassignConsumerGroup(context, dstID, cgID); err != nil {
+				failed[cgID] = dstID
+			}
+		}
+		return event.retryLater(context, failed)
+	}
+
+	// there is no index on the output host of consumer group
+	// extents, so walk all the consumer groups. Output host
+	// failures are rare enough for this to be acceptable
+	dests, err := context.mm.ListDestinations()
+	if err != nil {
+		// metadata store is temporarily unavailable. The extents held
+		// by this output host will be repaired eventually when the
+		// consumers call GetOutputHosts
+		context.m3Client.IncCounter(metrics.OutputFailedEventScope, metrics.ControllerFailures)
+		context.m3Client.IncCounter(metrics.OutputFailedEventScope, metrics.ControllerErrMetadataReadCounter)
+		context.log.WithFields(bark.Fields{
+			common.TagErr: err,
+			common.TagOut: event.hostUUID,
+		}).Error(`OutputHostFailedEvent: Cannot list destinations`)
+		return nil
+	}
+
+	failed := make(map[string]string)
+	for _, dstDesc := range dests {
+		if validateDstStatus(dstDesc) != nil {
+			continue
+		}
+		dstID := dstDesc.GetDestinationUUID()
+		consGroups, err := context.mm.ListConsumerGroupsByDstID(dstID)
+		if err != nil {
+			context.m3Client.IncCounter(metrics.OutputFailedEventScope, metrics.ControllerErrMetadataReadCounter)
+			context.log.WithFields(bark.Fields{
+				common.TagErr: err,
+				common.TagDst: common.FmtDst(dstID),
+				common.TagOut: event.hostUUID,
+			}).Error(`OutputHostFailedEvent: Cannot list consumer groups`)
+			continue
+		}
+		for _, cgDesc := range consGroups {
+			if cgDesc.GetStatus() != shared.ConsumerGroupStatus_ENABLED {
+				continue
+			}
+			cgID := cgDesc.GetConsumerGroupUUID()
+			if err := event.reassignConsumerGroup(context, dstID, cgID); err != nil {
+				failed[cgID] = dstID
+			}
+		}
+	}
+
+	return event.retryLater(context, failed)
+}
+
+// retryLater remembers the consumer groups that failed
+// to be reassigned and returns errRetryable, if any
+func (event *OutputHostFailedEvent) retryLater(context *Context, failed map[string]string) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	event.retryCGs = failed
+	context.log.WithFields(bark.Fields{
+		common.TagOut: event.hostUUID,
+		`numCGs`:      len(failed),
+	}).Warn(`OutputHostFailedEvent: Failed to reassign consumer groups, will retry`)
+	return errRetryable
+}
+
+// reassignConsumerGroup moves the OPEN extents of the consumer
+// group that belong to the failed output host to other output
+// hosts. Returns an error if the consumer group has to be retried
+func (event *OutputHostFailedEvent) reassignConsumerGroup(context *Context, dstID string, cgID string) error {
+
+	filterBy := []m.ConsumerGroupExtentStatus{m.ConsumerGroupExtentStatus_OPEN}
+	cgExtents, err := listConsumerGroupExtents(context, dstID, cgID, metrics.OutputFailedEventScope, filterBy)
+	if err != nil {
+		return err
+	}
+
+	var orphans []*m.ConsumerGroupExtent
+	for _, cge := range cgExtents {
+		if cge.GetOutputHostUUID() == event.hostUUID {
+			orphans = append(orphans, cge)
+		}
+	}
+
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	// hold the destination lock, so that we don't race
+	// with GetOutputHosts repairing the same extents
+	if !context.dstLock.TryLock(dstID, time.Second) {
+		context.m3Client.IncCounter(metrics.OutputFailedEventScope, metrics.ControllerErrTryLockCounter)
+		return ErrTryLock
+	}
+
+	newHosts := make(map[string]struct{})
+	for _, cge := range orphans {
+		if outHost := reassignOutHost(context, dstID, cge, metrics.OutputFailedEventScope); outHost != nil {
+			newHosts[outHost.UUID] = struct{}{}
+		}
+	}
+
+	context.dstLock.Unlock(dstID)
+
+	for hostID := range newHosts {
+		notifyEvent := NewOutputHostNotificationEvent(dstID, cgID, hostID, notifyOutputHostFailed, event.hostUUID, admin.NotificationType_ALL)
+		if !context.eventPipeline.Add(notifyEvent) {
+			context.log.WithFields(bark.Fields{
+				common.TagDst:  common.FmtDst(dstID),
+				common.TagCnsm: common.FmtCnsm(cgID),
+				common.TagOut:  common.FmtOut(hostID),
+			}).Error("OutputHostFailedEvent: Failed to enqueue OutputHostNotificationEvent, event queue full")
+		}
+	}
+
+	// the cached output hosts still include the failed host
+	triggerCacheRefreshForCG(context, cgID)
+	return nil
+}
+
+// Handle handles an StoreHostFailedEvent. On stage 1, it lists all
+// OPEN extents for the store host and enqueues an ExtentDownEvent for
+// each one of them. On stage 3, it enqueues an ExtentReReplicationEvent
+// for each SEALED extent that has a replica on the store host.
 func (event *StoreHostFailedEvent) Handle(context *Context) error {
 	sw := context.m3Client.StartTimer(metrics.StoreFailedEventScope, metrics.ControllerLatencyTimer)
 	defer sw.Stop()
@@ -560,11 +811,44 @@ func (event *StoreHostFailedEvent) Handle(context *Context) error {
 		return nil
 	} else if event.stage == hostDownStage2 {
 		return event.handleHostDownForRemoteExtent(context)
+	} else if event.stage == hostDownStage3 {
+		return event.handleHostLost(context)
 	}
 
 	return nil
 }
 
+// handleHostLost schedules the re-replication of every sealed extent
+// on the store host. Open extents are left alone, they would have been
+// sealed by the stage 1 handling and get picked up by a later trigger
+func (event *StoreHostFailedEvent) handleHostLost(context *Context) error {
+	// every controller's dfdd triggers stage 3, only the primary repairs,
+	// or each one would copy the extents to a different new store host
+	if !isPrimaryController(context) {
+		return nil
+	}
+
+	stats, err := context.mm.ListExtentsByStoreIDStatus(event.hostUUID, common.MetadataExtentStatusPtr(shared.ExtentStatus_SEALED))
+	if err != nil {
+		// stage 3 is re-triggered by dfdd as long as
+		// the host is down, no need to retry here
+		context.m3Client.IncCounter(metrics.StoreFailedEventScope, metrics.ControllerFailures)
+		context.m3Client.IncCounter(metrics.StoreFailedEventScope, metrics.ControllerErrMetadataReadCounter)
+		context.log.WithFields(bark.Fields{
+			common.TagErr:  err,
+			common.TagStor: event.hostUUID,
+		}).Error(`StoreHostFailedEvent: Cannot list sealed extents`)
+		return nil
+	}
+	for _, stat := range stats {
+		if common.IsRemoteZoneExtent(stat.GetExtent().GetOriginZone(), context.localZone) {
+			continue
+		}
+		addExtentReReplicationEvent(context, stat.GetExtent().GetDestinationUUID(), stat.GetExtent().GetExtentUUID(), event.hostUUID)
+	}
+	return nil
+}
+
 func (event *StoreHostFailedEvent) handleHostDownForRemoteExtent(context *Context) error {
 
 	// We need to get extents in both 'pending' and 'done' state, and assign a new store host for these extents
@@ -651,6 +935,123 @@ func (event *StoreHostFailedEvent) handleHostDownForRemoteExtent(context *Contex
 	return nil
 }
 
+// Handle handles a StoreHostDrainEvent. It seals all the OPEN
+// extents on the store host and re-replicates the SEALED ones that
+// still hold unconsumed data to other store hosts. Extents that are
+// consumed by every consumer group are not needed by anyone and are
+// left alone. Extents being sealed now will be re-replicated on the
+// next drain pass.
+func (event *StoreHostDrainEvent) Handle(context *Context) error {
+	sw := context.m3Client.StartTimer(metrics.StoreDrainEventScope, metrics.ControllerLatencyTimer)
+	defer sw.Stop()
+	context.m3Client.IncCounter(metrics.StoreDrainEventScope, metrics.ControllerRequests)
+
+	stats, err := context.mm.ListExtentsByStoreIDStatus(event.hostUUID, common.MetadataExtentStatusPtr(shared.ExtentStatus_OPEN))
+	if err != nil {
+		context.m3Client.IncCounter(metrics.StoreDrainEventScope, metrics.ControllerFailures)
+		context.m3Client.IncCounter(metrics.StoreDrainEventScope, metrics.ControllerErrMetadataReadCounter)
+		context.log.WithFields(bark.Fields{
+			common.TagErr:  err,
+			common.TagStor: event.hostUUID,
+		}).Error(`StoreHostDrainEvent: Cannot list open extents`)
+		return errRetryable
+	}
+	createExtentDownEvents(context, stats)
+
+	stats, err = context.mm.ListExtentsByStoreIDStatus(event.hostUUID, common.MetadataExtentStatusPtr(shared.ExtentStatus_SEALED))
+	if err != nil {
+		context.m3Client.IncCounter(metrics.StoreDrainEventScope, metrics.ControllerFailures)
+		context.m3Client.IncCounter(metrics.StoreDrainEventScope, metrics.ControllerErrMetadataReadCounter)
+		context.log.WithFields(bark.Fields{
+			common.TagErr:  err,
+			common.TagStor: event.hostUUID,
+		}).Error(`StoreHostDrainEvent: Cannot list sealed extents`)
+		return errRetryable
+	}
+	for _, stat := range stats {
+		dstID, extentID := stat.GetExtent().GetDestinationUUID(), stat.GetExtent().GetExtentUUID()
+		needed, e := extentHasUnconsumedData(context, dstID, extentID)
+		if e != nil {
+			context.m3Client.IncCounter(metrics.StoreDrainEventScope, metrics.ControllerErrMetadataReadCounter)
+			context.log.WithFields(bark.Fields{
+				common.TagErr:  e,
+				common.TagStor: event.hostUUID,
+				common.TagExt:  common.FmtExt(extentID),
+			}).Error(`StoreHostDrainEvent: Cannot read consumer group extents`)
+			continue
+		}
+		if !needed {
+			continue
+		}
+		addExtentReReplicationEvent(context, dstID, extentID, event.hostUUID)
+	}
+
+	return nil
+}
+
+// Handle handles an ExtentRollEvent. With the destination
+// lock held, the extent is marked as being sealed, which
+// excludes it from the extents handed out to publishers, and
+// the input hosts of the destination are refreshed to open a
+// replacement. The extent is sealed after that, so publishers
+// always have an extent to publish to.
+func (event *ExtentRollEvent) Handle(context *Context) error {
+	sw := context.m3Client.StartTimer(metrics.ExtentRollEventScope, metrics.ControllerLatencyTimer)
+	defer sw.Stop()
+	context.m3Client.IncCounter(metrics.ExtentRollEventScope, metrics.ControllerRequests)
+
+	if !context.dstLock.TryLock(event.dstID, time.Second) {
+		context.m3Client.IncCounter(metrics.ExtentRollEventScope, metrics.ControllerErrTryLockCounter)
+		return errRetryable
+	}
+	defer context.dstLock.Unlock(event.dstID)
+
+	if !context.extentSeals.inProgress.PutIfNotExist(event.extentID, Boolean(true)) {
+		return nil // already being sealed
+	}
+
+	lclLg := context.log.WithFields(bark.Fields{
+		common.TagDst: common.FmtDst(event.dstID),
+		common.TagExt: common.FmtExt(event.extentID),
+		`reason`:      event.reason,
+	})
+
+	if _, err := refreshInputHostsForDst(context, event.dstID, context.timeSource.Now().UnixNano()); err != nil {
+		context.extentSeals.inProgress.Remove(event.extentID)
+		switch err.(type) {
+		case *shared.EntityNotExistsError, *shared.EntityDisabledError:
+			return nil // nothing to roll over
+		}
+		lclLg.WithField(common.TagErr, err).Warn("ExtentRollEvent: cannot open replacement extent")
+		return errRetryable
+	}
+
+	if !context.eventPipeline.Add(NewExtentDownEvent(0, event.dstID, event.extentID)) {
+		context.extentSeals.inProgress.Remove(event.extentID)
+		return errRetryable
+	}
+
+	event.rolled = true
+	lclLg.Info("ExtentRollEvent: opened replacement, sealing extent")
+	return nil
+}
+
+// Done does cleanup for ExtentRollEvent
+func (event *ExtentRollEvent) Done(context *Context, err error) {
+	if err != nil {
+		context.m3Client.IncCounter(metrics.ExtentRollEventScope, metrics.ControllerFailures)
+	} else if event.rolled {
+		m3Counter := metrics.ControllerExtentsRolledBySize
+		if event.reason == extentRollReasonAge {
+			m3Counter = metrics.ControllerExtentsRolledByAge
+		}
+		context.m3Client.IncCounter(metrics.ExtentRollEventScope, m3Counter)
+	}
+	if context.extentRoller != nil {
+		context.extentRoller.rollDone(event.extentID, err)
+	}
+}
+
 // Handle handles an StoreExtentStatusOutOfSyncEvent.
 // This handler reissues SealExtent call to an out
 // of sync store host without updating metadata state
@@ -921,6 +1322,7 @@ func (event *ExtentDownEvent) Handle(context *Context) error {
 				}).Error("Moving forward without updating metadata after SEALing extent, state has already moved forward")
 			}
 			context.extentSeals.failed.Remove(event.extentID)
+			context.retMgr.extentChanged(event.dstID, event.extentID)
 			event.state = doneState
 		case doneState:
 			return nil
@@ -957,6 +1359,349 @@ func (event *ExtentDownEvent) Done(context *Context, err error) {
 	context.extentSeals.inProgress.Remove(event.extentID)
 }
 
+// Handle copies an extent from a surviving replica to a new store host
+// and replaces the lost store host in the extent metadata. The copy is
+// asynchronous on the new store, so the metadata is only updated after
+// the new replica is sealed at the sequence number the source is sealed
+// at. Until then, retries poll the new replica; a failure in between
+// leaves the extent as it was before.
+func (event *ExtentReReplicationEvent) Handle(context *Context) error {
+
+	sw := context.m3Client.StartTimer(metrics.ExtentReReplicationEventScope, metrics.ControllerLatencyTimer)
+	defer sw.Stop()
+
+	context.m3Client.IncCounter(metrics.ExtentReReplicationEventScope, metrics.ControllerRequests)
+
+	lclLg := context.log.WithFields(bark.Fields{
+		common.TagDst:  common.FmtDst(event.dstID),
+		common.TagExt:  common.FmtExt(event.extentID),
+		common.TagStor: common.FmtStor(event.failedStoreID),
+	})
+
+	if context.extentReplicas == nil {
+		context.m3Client.IncCounter(metrics.ExtentReReplicationEventScope, metrics.ControllerFailures)
+		lclLg.Error("ExtentReReplicationEvent: metadata client cannot replace extent replicas")
+		return errReReplicationNotSupported
+	}
+
+	event.attempts++
+
+	if !event.started {
+		done, err := event.startReplication(context, lclLg)
+		if done || err != nil {
+			return err
+		}
+	}
+
+	return event.completeReplication(context, lclLg)
+}
+
+// startReplication picks the source and the new store host and starts
+// the copy on the new store. It returns true when there is nothing to
+// re-replicate anymore.
+func (event *ExtentReReplicationEvent) startReplication(context *Context, lclLg bark.Logger) (bool, error) {
+
+	isRetry := event.attempts > 1
+	event.setState(context, reReplicationPending)
+
+	// Re-replications are rate limited, same as extent seals
+	var rateLimited bool
+	if !isRetry {
+		consumed, _ := context.extentRepairs.tokenBucket.TryConsume(1)
+		rateLimited = !consumed
+	} else {
+		rateLimited = !context.extentRepairs.tokenBucket.Consume(1, 10*time.Second)
+	}
+	if rateLimited {
+		context.m3Client.IncCounter(metrics.ExtentReReplicationEventScope, metrics.ControllerRateLimited)
+		return false, errRetryable
+	}
+
+	stats, err := context.mm.ReadExtentStats(event.dstID, event.extentID)
+	if err != nil {
+		context.m3Client.IncCounter(metrics.ExtentReReplicationEventScope, metrics.ControllerErrMetadataReadCounter)
+		return false, errRetryable
+	}
+
+	if stats.GetStatus() != shared.ExtentStatus_SEALED {
+		lclLg.WithField(`status`, stats.GetStatus()).Info("ExtentReReplicationEvent: extent is not sealed, skipping")
+		return true, nil
+	}
+
+	var survivors []string
+	var found bool
+	for _, id := range stats.GetExtent().GetStoreUUIDs() {
+		if id == event.failedStoreID {
+			found = true
+			continue
+		}
+		survivors = append(survivors, id)
+	}
+
+	if !found {
+		// already replaced, by an earlier attempt or another controller
+		lclLg.Info("ExtentReReplicationEvent: lost store is no longer a replica, skipping")
+		return true, nil
+	}
+
+	var sourceID string
+	survivorHosts := make([]*common.HostInfo, 0, len(survivors))
+	for _, id := range survivors {
+		addr, e := context.rpm.ResolveUUID(common.StoreServiceName, id)
+		if e != nil {
+			continue
+		}
+		host, e := context.rpm.FindHostForAddr(common.StoreServiceName, addr)
+		if e != nil {
+			continue
+		}
+		if len(sourceID) == 0 {
+			sourceID = id
+		}
+		survivorHosts = append(survivorHosts, host)
+	}
+
+	if len(sourceID) == 0 {
+		// a store host that is being drained is still
+		// healthy, it can serve as the source when it
+		// holds the only replica of the extent
+		if _, e := context.rpm.ResolveUUID(common.StoreServiceName, event.failedStoreID); e == nil {
+			sourceID = event.failedStoreID
+		}
+	}
+
+	if len(sourceID) == 0 {
+		lclLg.Warn("ExtentReReplicationEvent: no healthy replica to copy the extent from")
+		return false, errRetryable
+	}
+
+	dstDesc, err := context.mm.ReadDestination(event.dstID, "")
+	if err != nil {
+		context.m3Client.IncCounter(metrics.ExtentReReplicationEventScope, metrics.ControllerErrMetadataReadCounter)
+		return false, errRetryable
+	}
+	dstType, err := common.CheramiDestinationType(dstDesc.GetType())
+	if err != nil {
+		lclLg.WithField(common.TagErr, err).Error("ExtentReReplicationEvent: unknown destination type")
+		return false, err
+	}
+
+	// the new replica is complete once it is sealed where the source is
+	sealSeqNum, sealed, err := readReplicaSealState(context, sourceID, event.extentID)
+	if err != nil || !sealed {
+		lclLg.WithFields(bark.Fields{
+			common.TagErr: err,
+			`sourceStore`: common.FmtStor(sourceID),
+		}).Warn("ExtentReReplicationEvent: source replica is not sealed yet")
+		return false, errRetryable
+	}
+
+	var newStoreAddr string
+	if len(event.newStoreID) == 0 {
+		host, e := context.placement.PickReplacementStoreHost(survivorHosts, []string{event.failedStoreID})
+		if e != nil {
+			lclLg.WithField(common.TagErr, e).Warn("ExtentReReplicationEvent: cannot pick a replacement store host")
+			return false, errRetryable
+		}
+		event.newStoreID = host.UUID
+		newStoreAddr = host.Addr
+		context.m3Client.IncCounter(metrics.ExtentReReplicationEventScope, metrics.ControllerReReplicationStarted)
+	} else {
+		newStoreAddr, err = context.rpm.ResolveUUID(common.StoreServiceName, event.newStoreID)
+		if err != nil {
+			return false, errRetryable
+		}
+	}
+
+	lclLg = lclLg.WithFields(bark.Fields{
+		`sourceStore`: common.FmtStor(sourceID),
+		`newStore`:    common.FmtStor(event.newStoreID),
+	})
+
+	event.setState(context, reReplicationReplicating)
+
+	client, err := context.clientFactory.GetThriftStoreClient(newStoreAddr, event.newStoreID)
+	if err != nil {
+		lclLg.WithField(common.TagErr, err).Error(`Client factory failed to get store client`)
+		return false, errRetryable
+	}
+	defer context.clientFactory.ReleaseThriftStoreClient(event.newStoreID)
+
+	ctx, cancel := thrift.NewContext(replicateExtentCallTimeout)
+	defer cancel()
+
+	req := store.NewReplicateExtentRequest()
+	req.DestinationUUID = common.StringPtr(event.dstID)
+	req.DestinationType = cherami.DestinationTypePtr(dstType)
+	req.ExtentUUID = common.StringPtr(event.extentID)
+	req.StoreUUID = common.StringPtr(sourceID)
+	if err = client.ReplicateExtent(ctx, req); err != nil {
+		lclLg.WithField(common.TagErr, err).Error("ExtentReReplicationEvent: ReplicateExtent failed on new store host")
+		return false, errRetryable
+	}
+
+	event.started = true
+	event.sourceID = sourceID
+	event.sealSeqNum = sealSeqNum
+	event.stalls = 0
+	lclLg.WithField(`sealSeqNum`, sealSeqNum).Info("ExtentReReplicationEvent: replication started on new store host")
+	return false, nil
+}
+
+// completeReplication replaces the lost store in metadata once the new
+// replica is sealed at the sequence number of the source. A copy that
+// makes no progress for maxReReplicationStalls polls is started again,
+// the new store resumes it from its last message.
+func (event *ExtentReReplicationEvent) completeReplication(context *Context, lclLg bark.Logger) error {
+
+	lclLg = lclLg.WithFields(bark.Fields{
+		`sourceStore`: common.FmtStor(event.sourceID),
+		`newStore`:    common.FmtStor(event.newStoreID),
+	})
+
+	seqNum, sealed, err := readReplicaSealState(context, event.newStoreID, event.extentID)
+	if err != nil || !sealed || seqNum != event.sealSeqNum {
+		if err == nil && seqNum != event.lastSeqNum {
+			event.lastSeqNum = seqNum
+			event.stalls = 0
+		} else {
+			event.stalls++
+		}
+		if event.stalls >= maxReReplicationStalls {
+			lclLg.WithFields(bark.Fields{
+				common.TagErr: err,
+				`seqNum`:      seqNum,
+				`sealSeqNum`:  event.sealSeqNum,
+			}).Warn("ExtentReReplicationEvent: new replica makes no progress, restarting replication")
+			event.started = false
+		}
+		return errRetryable
+	}
+
+	event.setState(context, reReplicationUpdating)
+
+	if _, err = context.extentReplicas.ReplaceExtentStore(nil, event.dstID, event.extentID, event.failedStoreID, event.newStoreID); err != nil {
+		context.m3Client.IncCounter(metrics.ExtentReReplicationEventScope, metrics.ControllerErrMetadataUpdateCounter)
+		lclLg.WithField(common.TagErr, err).Error("ExtentReReplicationEvent: failed to replace lost store in metadata")
+		return errRetryable
+	}
+
+	event.replaced = true
+	lclLg.WithField(`sealSeqNum`, event.sealSeqNum).Info("ExtentReReplicationEvent: lost replica replaced")
+
+	// the replaced copy is no longer part of the extent, free its space
+	// if its store host is still around, e.g. when it was divergent or
+	// the host is being drained
+	if err = purgeReplica(context, event.failedStoreID, event.extentID); err != nil {
+		lclLg.WithField(common.TagErr, err).Info("ExtentReReplicationEvent: replaced replica not purged")
+	}
+	return nil
+}
+
+// readReplicaSealState returns the sequence number of the last message
+// of the extent replica on the store host, and whether it is sealed
+func readReplicaSealState(context *Context, storeID string, extentID string) (int64, bool, error) {
+	addr, err := context.rpm.ResolveUUID(common.StoreServiceName, storeID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	client, err := context.clientFactory.GetThriftStoreClient(addr, storeID)
+	if err != nil {
+		return 0, false, err
+	}
+	defer context.clientFactory.ReleaseThriftStoreClient(storeID)
+
+	ctx, cancel := thrift.NewContext(replicateExtentCallTimeout)
+	defer cancel()
+
+	// the floor of the latest possible timestamp is the last message,
+	// and the replica is sealed right after it
+	req := store.NewGetAddressFromTimestampRequest()
+	req.ExtentUUID = common.StringPtr(extentID)
+	req.Timestamp = common.Int64Ptr(math.MaxInt64)
+	res, err := client.GetAddressFromTimestamp(ctx, req)
+	if err != nil {
+		return 0, false, err
+	}
+	return res.GetSequenceNumber(), res.GetSealed(), nil
+}
+
+// purgeReplica deletes the extent replica from the store host, it is
+// best effort: retention purges the replicas it doesn't know about
+func purgeReplica(context *Context, storeID string, extentID string) error {
+	addr, err := context.rpm.ResolveUUID(common.StoreServiceName, storeID)
+	if err != nil {
+		return err
+	}
+
+	client, err := context.clientFactory.GetThriftStoreClient(addr, storeID)
+	if err != nil {
+		return err
+	}
+	defer context.clientFactory.ReleaseThriftStoreClient(storeID)
+
+	ctx, cancel := thrift.NewContext(replicateExtentCallTimeout)
+	defer cancel()
+
+	req := store.NewPurgeMessagesRequest()
+	req.ExtentUUID = common.StringPtr(extentID)
+	req.Address = common.Int64Ptr(store.ADDR_SEAL)
+	_, err = client.PurgeMessages(ctx, req)
+	return err
+}
+
+// Done does cleanup for ExtentReReplicationEvent
+func (event *ExtentReReplicationEvent) Done(context *Context, err error) {
+	if err != nil {
+		atomic.AddInt64(&context.extentRepairs.failed, 1)
+		context.m3Client.IncCounter(metrics.ExtentReReplicationEventScope, metrics.ControllerReReplicationFailed)
+		context.m3Client.IncCounter(metrics.ExtentReReplicationEventScope, metrics.ControllerFailures)
+		context.log.WithFields(bark.Fields{
+			common.TagDst:  common.FmtDst(event.dstID),
+			common.TagExt:  common.FmtExt(event.extentID),
+			common.TagStor: common.FmtStor(event.failedStoreID),
+			common.TagErr:  err,
+		}).Error("ExtentReReplicationEvent: all retries exceeded, will retry on the next stage 3 trigger")
+		if len(event.newStoreID) > 0 && !event.replaced {
+			// the next attempt can pick another store host, don't leave the partial copy behind
+			if e := purgeReplica(context, event.newStoreID, event.extentID); e != nil {
+				context.log.WithFields(bark.Fields{
+					common.TagExt:  common.FmtExt(event.extentID),
+					common.TagStor: common.FmtStor(event.newStoreID),
+					common.TagErr:  e,
+				}).Warn("ExtentReReplicationEvent: failed to purge partial replica")
+			}
+		}
+	} else if event.replaced {
+		atomic.AddInt64(&context.extentRepairs.completed, 1)
+		context.m3Client.IncCounter(metrics.ExtentReReplicationEventScope, metrics.ControllerReReplicationCompleted)
+	}
+	context.extentRepairs.inProgress.Remove(event.extentID)
+	context.m3Client.UpdateGauge(metrics.ExtentReReplicationEventScope, metrics.ControllerReReplicationInProgress, int64(context.extentRepairs.inProgress.Size()))
+}
+
+// setState publishes the progress of the event to extentRepairs
+func (event *ExtentReReplicationEvent) setState(context *Context, state string) {
+	status := &reReplicationStatus{
+		DstUUID:         event.dstID,
+		ExtentUUID:      event.extentID,
+		FailedStoreUUID: event.failedStoreID,
+		NewStoreUUID:    event.newStoreID,
+		State:           state,
+		Attempts:        event.attempts,
+	}
+	if old, ok := context.extentRepairs.inProgress.Get(event.extentID); ok {
+		if s, ok := old.(*reReplicationStatus); ok {
+			status.StartTime = s.StartTime
+		}
+	}
+	if status.StartTime.IsZero() {
+		status.StartTime = time.Now()
+	}
+	context.extentRepairs.inProgress.Put(event.extentID, status)
+}
+
 // triggerCacheRefreshForCG forces a result cache
 // refresh for the given consumer group
 func triggerCacheRefreshForCG(context *Context, cgID string) {
@@ -0,0 +1,768 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/clients/metadata"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-server/common/metrics"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+type (
+	// journaledEvent is an event that is saved to the event journal
+	// until it is done, so that it survives a controller restart. The
+	// handlers of these events must be idempotent, a replayed event may
+	// have been partially or completely handled before.
+	journaledEvent interface {
+		Event
+		// journalRecord returns the type and the payload of the
+		// event, the payload is decoded by the replayer of the type
+		journalRecord() (string, interface{})
+	}
+
+	// eventReplayer decodes a journaled event and adds it back
+	// to the event pipeline, returns false if it couldn't be added
+	eventReplayer func(context *Context, payload []byte) (bool, error)
+
+	// eventJournal saves the journaled events to metadata while they
+	// are handled by this controller. Events of controllers that went
+	// away are replayed by the leader of the extent monitor lease.
+	// The writes to metadata are queued and flushed in batches by a
+	// background routine, so that adding an event to the event pipeline
+	// never waits on metadata; an event that is done before the next
+	// flush is never written at all.
+	eventJournal struct {
+		started    int32
+		stopping   int32
+		context    *Context
+		store      metadata.EventJournalService
+		ll         bark.Logger
+		active     map[string]*journalEntry
+		mutex      sync.Mutex
+		writeC     chan *journalWrite
+		flushLock  sync.Mutex
+		lastBucket int64 // the last partition registered by this controller, guarded by flushLock
+		shutdownC  chan struct{}
+		shutdownWG sync.WaitGroup
+	}
+
+	// journalEntry wraps a journaled event while it is in the journal
+	journalEntry struct {
+		journaledEvent
+		journal   *eventJournal
+		record    *metadata.JournalEvent
+		canceled  int32
+		persisted int32 // set once the event is written to metadata
+	}
+
+	// journalWrite is a write to the journal waiting to be flushed
+	journalWrite struct {
+		record  metadata.JournalEvent
+		entry   *journalEntry // nil for the events of other controllers
+		deleted bool
+	}
+
+	// journalEventStatus is a journaled event, as reported
+	// by the admin endpoint
+	journalEventStatus struct {
+		UUID        string    `json:"uuid"`
+		Type        string    `json:"type"`
+		Payload     string    `json:"payload"`
+		Owner       string    `json:"owner"`
+		State       string    `json:"state"`
+		Attempts    int       `json:"attempts"`
+		LastError   string    `json:"lastError,omitempty"`
+		CreatedTime time.Time `json:"createdTime"`
+		UpdatedTime time.Time `json:"updatedTime"`
+	}
+
+	extentDownEventRecord struct {
+		SealSeq  int64  `json:"sealSeq"`
+		DstID    string `json:"dstID"`
+		ExtentID string `json:"extentID"`
+	}
+
+	storeHostFailedEventRecord struct {
+		HostUUID string `json:"hostUUID"`
+		Stage    int    `json:"stage"`
+	}
+
+	remoteZoneReplicationEventRecord struct {
+		DstID                    string   `json:"dstID"`
+		ExtentID                 string   `json:"extentID"`
+		StoreIDs                 []string `json:"storeIDs"`
+		RemoteExtentPrimaryStore string   `json:"remoteExtentPrimaryStore"`
+	}
+
+	extentReReplicationEventRecord struct {
+		DstID         string `json:"dstID"`
+		ExtentID      string `json:"extentID"`
+		FailedStoreID string `json:"failedStoreID"`
+	}
+)
+
+const (
+	controllerEventJournal = "controller"
+
+	journalEventPending = "pending"
+	journalEventFailed  = "failed"
+
+	eventJournalEnabled = "enabled"
+
+	journalTypeExtentDown            = "ExtentDownEvent"
+	journalTypeStoreHostFailed       = "StoreHostFailedEvent"
+	journalTypeRemoteZoneReplication = "StartReplicationForRemoteZoneExtent"
+	journalTypeExtentReReplication   = "ExtentReReplicationEvent"
+)
+
+var (
+	errEventCanceled           = errors.New("Event canceled")
+	errEventJournalUnsupported = &shared.BadRequestError{Message: "Event journal is not supported by the metadata store"}
+
+	// eventJournalReplayInterval is the time between scans of the journal
+	// for events whose controller went away
+	eventJournalReplayInterval = time.Minute
+	// eventJournalReplayGracePeriod is how old an event has to be, to be
+	// replayed. It gives the ring time to learn about new controllers
+	eventJournalReplayGracePeriod = time.Minute
+	// eventJournalFlushInterval is the time between flushes of the
+	// queued journal writes to metadata
+	eventJournalFlushInterval = time.Second
+	// eventJournalBucketSize is the span of time covered by one
+	// partition of the events journaled by a controller
+	eventJournalBucketSize = time.Hour
+	// eventJournalWriteQueueSize is the number of journal writes that
+	// can wait to be flushed, events are not journaled when it is full
+	eventJournalWriteQueueSize = 4096
+
+	eventReplayers = map[string]eventReplayer{
+		journalTypeExtentDown:            replayExtentDownEvent,
+		journalTypeStoreHostFailed:       replayStoreHostFailedEvent,
+		journalTypeRemoteZoneReplication: replayRemoteZoneReplicationEvent,
+		journalTypeExtentReReplication:   replayExtentReReplicationEvent,
+	}
+)
+
+// newEventJournal creates and returns a new instance of eventJournal,
+// events are only journaled when the store is not nil
+func newEventJournal(context *Context, store metadata.EventJournalService) *eventJournal {
+	return &eventJournal{
+		context:   context,
+		store:     store,
+		ll:        context.log.WithField(common.TagModule, `eventJournal`),
+		active:    make(map[string]*journalEntry),
+		writeC:    make(chan *journalWrite, eventJournalWriteQueueSize),
+		shutdownC: make(chan struct{}),
+	}
+}
+
+func (j *eventJournal) Start() {
+	if !atomic.CompareAndSwapInt32(&j.started, 0, 1) {
+		return
+	}
+	j.shutdownWG.Add(2)
+	go j.run()
+	go j.writePump()
+	j.ll.Info("EventJournal started")
+}
+
+// Stop stops the replays and flushes the queued writes. The events
+// that are not done when the event pipeline stops are left in the
+// journal, for them to be replayed by another controller
+func (j *eventJournal) Stop() {
+	atomic.StoreInt32(&j.stopping, 1)
+	close(j.shutdownC)
+	if !common.AwaitWaitGroup(&j.shutdownWG, time.Second) {
+		j.ll.Error("Timed out waiting for EventJournal to stop")
+		return
+	}
+	j.ll.Info("EventJournal stopped")
+}
+
+func (j *eventJournal) isEnabled() bool {
+	if j.store == nil {
+		return false
+	}
+	cfgIface, err := j.context.cfgMgr.Get(common.ControllerServiceName, `*`, `*`, `*`)
+	if err != nil {
+		return false
+	}
+	cfg, ok := cfgIface.(ControllerDynamicConfig)
+	return ok && cfg.EventJournal == eventJournalEnabled
+}
+
+// wrap saves the event to the journal, if it is a journaled event,
+// and returns the event to be added to the event pipeline. Events
+// that cannot be saved are handled without being journaled.
+func (j *eventJournal) wrap(event Event) Event {
+
+	je, ok := event.(journaledEvent)
+	if !ok || !j.isEnabled() {
+		return event
+	}
+	if entry := j.add(je); entry != nil {
+		return entry
+	}
+	return event
+}
+
+// add saves the event to the journal, returns nil on failure
+func (j *eventJournal) add(je journaledEvent) *journalEntry {
+
+	eventType, payload := je.journalRecord()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		j.ll.WithFields(bark.Fields{
+			common.TagErr: err,
+			`eventType`:   eventType,
+		}).Error("Failed to encode event for the journal")
+		return nil
+	}
+
+	now := time.Now()
+	entry := &journalEntry{
+		journaledEvent: je,
+		journal:        j,
+		record: &metadata.JournalEvent{
+			JournalPartition: metadata.JournalPartition{
+				Owner:  j.context.hostID,
+				Bucket: now.Truncate(eventJournalBucketSize).Unix(),
+			},
+			ID:          uuid.New(),
+			Type:        eventType,
+			Payload:     string(data),
+			State:       journalEventPending,
+			CreatedTime: now,
+			UpdatedTime: now,
+		},
+	}
+
+	if !j.write(entry.record, entry, false) {
+		return nil
+	}
+
+	j.mutex.Lock()
+	j.active[entry.record.ID] = entry
+	j.mutex.Unlock()
+
+	j.context.m3Client.IncCounter(metrics.EventPipelineScope, metrics.ControllerEventsJournaled)
+	return entry
+}
+
+// discard removes an event that was journaled but could not
+// be added to the event pipeline
+func (j *eventJournal) discard(event Event) {
+	if entry, ok := event.(*journalEntry); ok {
+		j.remove(entry)
+		j.write(entry.record, entry, true)
+	}
+}
+
+// cancel removes the event from the journal. If the event is handled
+// by this controller, it is not attempted anymore. Events handled by
+// other controllers are stopped before their next retry.
+func (j *eventJournal) cancel(eventID string) error {
+
+	if j.store == nil {
+		return errEventJournalUnsupported
+	}
+
+	j.mutex.Lock()
+	entry, ok := j.active[eventID]
+	if ok {
+		atomic.StoreInt32(&entry.canceled, 1)
+	}
+	j.mutex.Unlock()
+
+	var record *metadata.JournalEvent
+	if ok {
+		record = &metadata.JournalEvent{JournalPartition: entry.record.JournalPartition, ID: eventID}
+	} else {
+		records, err := j.listRecords()
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			if r.ID == eventID {
+				record = r
+				break
+			}
+		}
+		if record == nil {
+			return &shared.EntityNotExistsError{Message: fmt.Sprintf("Event %v does not exist in the journal", eventID)}
+		}
+	}
+
+	// the delete goes through the queue, after the writes already queued for the event
+	if !j.write(record, entry, true) {
+		return &shared.InternalServiceError{Message: "Event journal write queue full"}
+	}
+	if err := j.flush(); err != nil {
+		return err
+	}
+
+	j.context.m3Client.IncCounter(metrics.EventPipelineScope, metrics.ControllerEventsCanceled)
+	j.ll.WithField(`eventID`, eventID).Info("Event canceled")
+	return nil
+}
+
+// list returns all the events in the journal
+func (j *eventJournal) list() ([]*journalEventStatus, error) {
+
+	if j.store == nil {
+		return nil, errEventJournalUnsupported
+	}
+
+	records, err := j.listRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*journalEventStatus, 0, len(records))
+	for _, r := range records {
+		result = append(result, &journalEventStatus{
+			UUID:        r.ID,
+			Type:        r.Type,
+			Payload:     r.Payload,
+			Owner:       r.Owner,
+			State:       r.State,
+			Attempts:    r.Attempts,
+			LastError:   r.LastError,
+			CreatedTime: r.CreatedTime,
+			UpdatedTime: r.UpdatedTime,
+		})
+	}
+	return result, nil
+}
+
+// listRecords returns the events of all the partitions of the journal
+func (j *eventJournal) listRecords() ([]*metadata.JournalEvent, error) {
+
+	ctx, cancel := thrift.NewContext(thriftCallTimeout)
+	defer cancel()
+
+	partitions, err := j.store.ListJournalPartitions(ctx, controllerEventJournal)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*metadata.JournalEvent
+	for _, partition := range partitions {
+		records, err := j.store.ListJournalEvents(ctx, controllerEventJournal, partition)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, records...)
+	}
+	return result, nil
+}
+
+// Handle handles the journaled event. Retries are minutes apart,
+// so the journal is checked before every retry, to find out if the
+// event was canceled from another controller.
+func (entry *journalEntry) Handle(context *Context) error {
+	if atomic.LoadInt32(&entry.canceled) == 1 {
+		return nil
+	}
+	entry.record.Attempts++
+	if entry.record.Attempts > 1 && !entry.journal.touch(entry) {
+		atomic.StoreInt32(&entry.canceled, 1)
+		return nil
+	}
+	return entry.journaledEvent.Handle(context)
+}
+
+// Done calls the Done callback of the journaled event and removes
+// the event from the journal. Events that failed for good stay in
+// the journal, marked as failed, until they are canceled or expire.
+func (entry *journalEntry) Done(context *Context, err error) {
+
+	if atomic.LoadInt32(&entry.canceled) == 1 {
+		err = errEventCanceled
+	}
+
+	entry.journaledEvent.Done(context, err)
+
+	j := entry.journal
+	j.remove(entry)
+
+	switch {
+	case err == errEventCanceled:
+		// already removed from the journal
+	case atomic.LoadInt32(&j.stopping) == 1:
+		// not done, left for another controller to replay
+	case err == nil:
+		j.write(entry.record, entry, true)
+	default:
+		entry.record.State = journalEventFailed
+		entry.record.LastError = err.Error()
+		entry.record.UpdatedTime = time.Now()
+		j.write(entry.record, entry, false)
+	}
+}
+
+// touch records a new attempt of the event in the journal,
+// returns false if the event is not in the journal anymore
+func (j *eventJournal) touch(entry *journalEntry) bool {
+
+	// an event that was not flushed yet cannot have been canceled
+	// from another controller, which only sees the journal
+	if atomic.LoadInt32(&entry.persisted) == 1 {
+		ctx, cancel := thrift.NewContext(thriftCallTimeout)
+		defer cancel()
+
+		if _, err := j.store.ReadJournalEvent(ctx, controllerEventJournal, entry.record.JournalPartition, entry.record.ID); err != nil {
+			if _, ok := err.(*shared.EntityNotExistsError); ok {
+				return false
+			}
+			j.context.m3Client.IncCounter(metrics.EventPipelineScope, metrics.ControllerErrEventJournal)
+			return true
+		}
+	}
+
+	entry.record.UpdatedTime = time.Now()
+	j.write(entry.record, entry, false)
+	return true
+}
+
+func (j *eventJournal) remove(entry *journalEntry) {
+	j.mutex.Lock()
+	delete(j.active, entry.record.ID)
+	j.mutex.Unlock()
+}
+
+// write queues a copy of the record to be written to the journal, or
+// deleted from it. Returns false if the write queue is full.
+func (j *eventJournal) write(record *metadata.JournalEvent, entry *journalEntry, deleted bool) bool {
+	select {
+	case j.writeC <- &journalWrite{record: *record, entry: entry, deleted: deleted}:
+		return true
+	default:
+		j.context.m3Client.IncCounter(metrics.EventPipelineScope, metrics.ControllerErrEventJournal)
+		j.ll.WithFields(bark.Fields{
+			`eventID`:   record.ID,
+			`eventType`: record.Type,
+		}).Error("Event journal write queue full")
+		return false
+	}
+}
+
+// flush writes the queued writes to metadata, in one batch per partition.
+// Only the last write of an event counts, and an event that is deleted
+// before it was ever written is skipped altogether.
+func (j *eventJournal) flush() error {
+
+	j.flushLock.Lock()
+	defer j.flushLock.Unlock()
+
+	writes := make(map[string]*journalWrite)
+	var ids []string
+
+drain:
+	for {
+		select {
+		case w := <-j.writeC:
+			id := w.record.ID
+			prev, ok := writes[id]
+			if !ok {
+				ids = append(ids, id)
+			}
+			if w.deleted && prev != nil && !prev.deleted && prev.entry != nil && atomic.LoadInt32(&prev.entry.persisted) == 0 {
+				writes[id] = nil // nothing to delete
+				continue
+			}
+			writes[id] = w
+		default:
+			break drain
+		}
+	}
+
+	var events, deleted []*metadata.JournalEvent
+	var entries []*journalEntry
+	for _, id := range ids {
+		w := writes[id]
+		switch {
+		case w == nil:
+		case w.deleted:
+			deleted = append(deleted, &w.record)
+		case j.registerPartition(w.record.JournalPartition):
+			events = append(events, &w.record)
+			if w.entry != nil {
+				entries = append(entries, w.entry)
+			}
+		}
+	}
+
+	if len(events) == 0 && len(deleted) == 0 {
+		return nil
+	}
+
+	ctx, cancel := thrift.NewContext(thriftCallTimeout)
+	defer cancel()
+
+	if err := j.store.WriteJournalEvents(ctx, controllerEventJournal, events, deleted); err != nil {
+		j.context.m3Client.IncCounter(metrics.EventPipelineScope, metrics.ControllerErrEventJournal)
+		j.ll.WithFields(bark.Fields{
+			common.TagErr: err,
+			`events`:      len(events),
+			`deleted`:     len(deleted),
+		}).Error("Failed to write events to the journal")
+		return err
+	}
+
+	for _, entry := range entries {
+		atomic.StoreInt32(&entry.persisted, 1)
+	}
+	return nil
+}
+
+// registerPartition records the partition of an event of this controller
+// in the journal, for the partition to be found when it is replayed
+func (j *eventJournal) registerPartition(partition metadata.JournalPartition) bool {
+
+	if partition.Bucket == j.lastBucket {
+		return true
+	}
+
+	ctx, cancel := thrift.NewContext(thriftCallTimeout)
+	defer cancel()
+
+	if err := j.store.PutJournalPartition(ctx, controllerEventJournal, partition); err != nil {
+		j.context.m3Client.IncCounter(metrics.EventPipelineScope, metrics.ControllerErrEventJournal)
+		j.ll.WithFields(bark.Fields{
+			common.TagErr: err,
+			`bucket`:      partition.Bucket,
+		}).Error("Failed to register event journal partition")
+		return false
+	}
+
+	j.lastBucket = partition.Bucket
+	return true
+}
+
+func (j *eventJournal) writePump() {
+	defer j.shutdownWG.Done()
+	ticker := time.NewTicker(eventJournalFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if j.store != nil {
+				j.flush()
+			}
+		case <-j.shutdownC:
+			if j.store != nil {
+				j.flush()
+			}
+			return
+		}
+	}
+}
+
+func (j *eventJournal) run() {
+	defer j.shutdownWG.Done()
+	ticker := time.NewTicker(eventJournalReplayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if j.store != nil && isPrimaryController(j.context) {
+				j.replay()
+			}
+		case <-j.shutdownC:
+			return
+		}
+	}
+}
+
+// replay adds back to the event pipeline the pending events of the
+// controllers that are not part of the ring anymore. Replayed events
+// are journaled again, under this controller. Only the partitions of
+// the controllers that went away are read.
+func (j *eventJournal) replay() {
+
+	context := j.context
+
+	ctx, cancel := thrift.NewContext(thriftCallTimeout)
+	partitions, err := j.store.ListJournalPartitions(ctx, controllerEventJournal)
+	cancel()
+	if err != nil {
+		context.m3Client.IncCounter(metrics.EventPipelineScope, metrics.ControllerErrEventJournal)
+		j.ll.WithField(common.TagErr, err).Error("Failed to list the event journal partitions")
+		return
+	}
+
+	for _, partition := range partitions {
+
+		if partition.Owner == context.hostID {
+			continue
+		}
+
+		if _, err := context.rpm.ResolveUUID(common.ControllerServiceName, partition.Owner); err == nil {
+			continue // owner is still around
+		}
+
+		if !j.replayPartition(partition) {
+			return
+		}
+	}
+}
+
+// replayPartition replays the pending events of the given partition,
+// and forgets the partition once it has no events left. Returns false
+// if the event queue is full.
+func (j *eventJournal) replayPartition(partition metadata.JournalPartition) bool {
+
+	context := j.context
+
+	ctx, cancel := thrift.NewContext(thriftCallTimeout)
+	defer cancel()
+
+	records, err := j.store.ListJournalEvents(ctx, controllerEventJournal, partition)
+	if err != nil {
+		context.m3Client.IncCounter(metrics.EventPipelineScope, metrics.ControllerErrEventJournal)
+		j.ll.WithFields(bark.Fields{
+			common.TagErr: err,
+			`owner`:       partition.Owner,
+			`bucket`:      partition.Bucket,
+		}).Error("Failed to list the event journal")
+		return true
+	}
+
+	if len(records) == 0 {
+		if err := j.store.DeleteJournalPartition(ctx, controllerEventJournal, partition); err != nil {
+			context.m3Client.IncCounter(metrics.EventPipelineScope, metrics.ControllerErrEventJournal)
+		}
+		return true
+	}
+
+	deadline := time.Now().Add(-eventJournalReplayGracePeriod)
+
+	for _, record := range records {
+
+		if record.State != journalEventPending || record.CreatedTime.After(deadline) {
+			continue
+		}
+
+		lg := j.ll.WithFields(bark.Fields{
+			`eventID`:   record.ID,
+			`eventType`: record.Type,
+			`owner`:     record.Owner,
+		})
+
+		replayer, ok := eventReplayers[record.Type]
+		if !ok {
+			lg.Error("Cannot replay event of unknown type")
+			continue
+		}
+
+		added, err := replayer(context, []byte(record.Payload))
+		if err != nil {
+			lg.WithField(common.TagErr, err).Error("Cannot decode journaled event")
+			continue
+		}
+		if !added {
+			lg.Warn("Cannot replay event, event queue full")
+			return false
+		}
+
+		j.write(record, nil, true)
+		context.m3Client.IncCounter(metrics.EventPipelineScope, metrics.ControllerEventsReplayed)
+		lg.Info("Replayed journaled event")
+	}
+
+	return true
+}
+
+func (event *ExtentDownEvent) journalRecord() (string, interface{}) {
+	return journalTypeExtentDown, &extentDownEventRecord{
+		SealSeq:  event.sealSeq,
+		DstID:    event.dstID,
+		ExtentID: event.extentID,
+	}
+}
+
+func replayExtentDownEvent(context *Context, payload []byte) (bool, error) {
+	var r extentDownEventRecord
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return false, err
+	}
+	return addExtentDownEvent(context, r.SealSeq, r.DstID, r.ExtentID), nil
+}
+
+func (event *StoreHostFailedEvent) journalRecord() (string, interface{}) {
+	return journalTypeStoreHostFailed, &storeHostFailedEventRecord{
+		HostUUID: event.hostUUID,
+		Stage:    int(event.stage),
+	}
+}
+
+func replayStoreHostFailedEvent(context *Context, payload []byte) (bool, error) {
+	var r storeHostFailedEventRecord
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return false, err
+	}
+	return context.eventPipeline.Add(NewStoreHostFailedEvent(r.HostUUID, hostDownStage(r.Stage))), nil
+}
+
+func (event *StartReplicationForRemoteZoneExtent) journalRecord() (string, interface{}) {
+	return journalTypeRemoteZoneReplication, &remoteZoneReplicationEventRecord{
+		DstID:                    event.dstID,
+		ExtentID:                 event.extentID,
+		StoreIDs:                 event.storeIDs,
+		RemoteExtentPrimaryStore: event.remoteExtentPrimaryStore,
+	}
+}
+
+func replayRemoteZoneReplicationEvent(context *Context, payload []byte) (bool, error) {
+	var r remoteZoneReplicationEventRecord
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return false, err
+	}
+	return context.eventPipeline.Add(NewStartReplicationForRemoteZoneExtent(r.DstID, r.ExtentID, r.StoreIDs, r.RemoteExtentPrimaryStore)), nil
+}
+
+func (event *ExtentReReplicationEvent) journalRecord() (string, interface{}) {
+	return journalTypeExtentReReplication, &extentReReplicationEventRecord{
+		DstID:         event.dstID,
+		ExtentID:      event.extentID,
+		FailedStoreID: event.failedStoreID,
+	}
+}
+
+func replayExtentReReplicationEvent(context *Context, payload []byte) (bool, error) {
+	var r extentReReplicationEventRecord
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return false, err
+	}
+	return addExtentReReplicationEvent(context, r.DstID, r.ExtentID, r.FailedStoreID), nil
+}
@@ -0,0 +1,364 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/clients/metadata"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+type (
+	EventJournalSuite struct {
+		*require.Assertions
+		suite.Suite
+		store   *mockEventJournalService
+		journal *eventJournal
+	}
+
+	// mockEventJournalService is an in memory event journal
+	mockEventJournalService struct {
+		sync.Mutex
+		events     map[string]metadata.JournalEvent
+		partitions map[metadata.JournalPartition]bool
+		writes     int
+	}
+
+	testJournaledEvent struct {
+		eventBase
+		Key     string `json:"key"`
+		handled int
+		doneErr error
+		done    bool
+	}
+)
+
+const testJournalType = "testJournaledEvent"
+
+func TestEventJournalSuite(t *testing.T) {
+	suite.Run(t, new(EventJournalSuite))
+}
+
+func (s *EventJournalSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+	s.store = &mockEventJournalService{
+		events:     make(map[string]metadata.JournalEvent),
+		partitions: make(map[metadata.JournalPartition]bool),
+	}
+	context := &Context{
+		hostID:   uuid.New(),
+		log:      bark.NewLoggerFromLogrus(log.New()),
+		m3Client: &MockM3Metrics{},
+		rpm:      common.NewMockRingpopMonitor(),
+	}
+	s.journal = newEventJournal(context, s.store)
+}
+
+func (s *EventJournalSuite) TestEventDone() {
+
+	event := &testJournaledEvent{Key: "done"}
+	entry := s.journal.add(event)
+	s.NotNil(entry)
+
+	_, ok := s.store.get(entry.record.ID)
+	s.False(ok, "Events are only written on flush")
+	s.Nil(s.journal.flush())
+
+	record, ok := s.store.get(entry.record.ID)
+	s.True(ok)
+	s.Equal(testJournalType, record.Type)
+	s.Equal(journalEventPending, record.State)
+	s.Equal(s.journal.context.hostID, record.Owner)
+	s.Equal(`{"key":"done"}`, record.Payload)
+	s.True(s.store.partitions[record.JournalPartition], "Partition must be registered")
+
+	s.Nil(entry.Handle(s.journal.context))
+	entry.Done(s.journal.context, nil)
+	s.Nil(s.journal.flush())
+
+	s.Equal(1, event.handled)
+	s.True(event.done)
+	s.Nil(event.doneErr)
+	_, ok = s.store.get(entry.record.ID)
+	s.False(ok, "Done event must be removed from the journal")
+	s.Equal(0, len(s.journal.active))
+}
+
+func (s *EventJournalSuite) TestEventFailed() {
+
+	event := &testJournaledEvent{Key: "failed"}
+	entry := s.journal.add(event)
+	s.NotNil(entry)
+	s.Nil(s.journal.flush())
+
+	// a retry records the attempt in the journal
+	s.Nil(entry.Handle(s.journal.context))
+	s.Nil(entry.Handle(s.journal.context))
+	s.Nil(s.journal.flush())
+	record, _ := s.store.get(entry.record.ID)
+	s.Equal(2, record.Attempts)
+
+	entry.Done(s.journal.context, errRetryable)
+	s.Nil(s.journal.flush())
+	record, ok := s.store.get(entry.record.ID)
+	s.True(ok, "Failed event must stay in the journal")
+	s.Equal(journalEventFailed, record.State)
+	s.Equal(errRetryable.Error(), record.LastError)
+}
+
+func (s *EventJournalSuite) TestEventLeftOnStop() {
+
+	event := &testJournaledEvent{Key: "stop"}
+	entry := s.journal.add(event)
+	s.NotNil(entry)
+
+	s.journal.Start()
+	s.journal.Stop()
+
+	// the queued write is flushed on stop
+	record, ok := s.store.get(entry.record.ID)
+	s.True(ok)
+
+	entry.Done(s.journal.context, errRetryable)
+	s.Nil(s.journal.flush())
+	record, ok = s.store.get(entry.record.ID)
+	s.True(ok, "Unfinished event must be left for replay on shutdown")
+	s.Equal(journalEventPending, record.State)
+}
+
+func (s *EventJournalSuite) TestEventCanceled() {
+
+	s.Error(s.journal.cancel(uuid.New()))
+
+	event := &testJournaledEvent{Key: "cancel"}
+	entry := s.journal.add(event)
+	s.NotNil(entry)
+	s.Nil(s.journal.flush())
+
+	s.Nil(s.journal.cancel(entry.record.ID))
+	_, ok := s.store.get(entry.record.ID)
+	s.False(ok)
+
+	s.Nil(entry.Handle(s.journal.context))
+	entry.Done(s.journal.context, nil)
+	s.Equal(0, event.handled, "Canceled event must not be handled")
+	s.Equal(errEventCanceled, event.doneErr)
+
+	// cancel from another controller is seen before the next retry
+	event = &testJournaledEvent{Key: "remote-cancel"}
+	entry = s.journal.add(event)
+	s.Nil(entry.Handle(s.journal.context))
+	s.Nil(s.journal.flush())
+	s.store.delete(entry.record.ID)
+	s.Nil(entry.Handle(s.journal.context))
+	entry.Done(s.journal.context, nil)
+	s.Equal(1, event.handled)
+	s.Equal(errEventCanceled, event.doneErr)
+}
+
+func (s *EventJournalSuite) TestShortLivedEventNotWritten() {
+
+	event := &testJournaledEvent{Key: "short"}
+	entry := s.journal.add(event)
+	s.NotNil(entry)
+	s.Nil(entry.Handle(s.journal.context))
+	entry.Done(s.journal.context, nil)
+
+	s.Nil(s.journal.flush())
+	_, ok := s.store.get(entry.record.ID)
+	s.False(ok)
+	s.Equal(0, s.store.writes, "Event done before the flush must not be written")
+
+	// an event queue that is full is not waited on
+	for i := 0; i < eventJournalWriteQueueSize; i++ {
+		s.True(s.journal.write(entry.record, nil, true))
+	}
+	s.Nil(s.journal.add(&testJournaledEvent{Key: "full"}))
+	s.Nil(s.journal.flush())
+}
+
+func (s *EventJournalSuite) TestReplay() {
+
+	var replayed []string
+	eventReplayers[testJournalType] = func(context *Context, payload []byte) (bool, error) {
+		var event testJournaledEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return false, err
+		}
+		replayed = append(replayed, event.Key)
+		return true, nil
+	}
+	defer delete(eventReplayers, testJournalType)
+
+	liveController := uuid.New()
+	s.journal.context.rpm.(*common.MockRingpopMonitor).Add(common.ControllerServiceName, liveController, "127.0.0.1:5425")
+
+	old := time.Now().Add(-2 * eventJournalReplayGracePeriod)
+	partition := func(owner string) metadata.JournalPartition {
+		return metadata.JournalPartition{Owner: owner, Bucket: old.Truncate(eventJournalBucketSize).Unix()}
+	}
+	events := []metadata.JournalEvent{
+		{JournalPartition: partition(uuid.New()), ID: uuid.New(), Type: testJournalType, Payload: `{"key":"orphan"}`, State: journalEventPending, CreatedTime: old},
+		{JournalPartition: partition(liveController), ID: uuid.New(), Type: testJournalType, Payload: `{"key":"live"}`, State: journalEventPending, CreatedTime: old},
+		{JournalPartition: partition(uuid.New()), ID: uuid.New(), Type: testJournalType, Payload: `{"key":"recent"}`, State: journalEventPending, CreatedTime: time.Now()},
+		{JournalPartition: partition(uuid.New()), ID: uuid.New(), Type: testJournalType, Payload: `{"key":"failed"}`, State: journalEventFailed, CreatedTime: old},
+		{JournalPartition: partition(s.journal.context.hostID), ID: uuid.New(), Type: testJournalType, Payload: `{"key":"mine"}`, State: journalEventPending, CreatedTime: old},
+	}
+	for i := range events {
+		s.store.PutJournalPartition(nil, controllerEventJournal, events[i].JournalPartition)
+		s.store.WriteJournalEvents(nil, controllerEventJournal, []*metadata.JournalEvent{&events[i]}, nil)
+	}
+	empty := partition(uuid.New())
+	s.store.PutJournalPartition(nil, controllerEventJournal, empty)
+
+	s.journal.replay()
+	s.Nil(s.journal.flush())
+
+	s.Equal([]string{"orphan"}, replayed)
+	_, ok := s.store.get(events[0].ID)
+	s.False(ok, "Replayed event must be removed from the journal")
+	for _, e := range events[1:] {
+		_, ok = s.store.get(e.ID)
+		s.True(ok)
+	}
+	s.False(s.store.partitions[empty], "Empty partition of a dead controller must be forgotten")
+
+	list, err := s.journal.list()
+	s.Nil(err)
+	s.Equal(len(events)-1, len(list))
+
+	// the partition of the replayed event is forgotten once it is empty
+	s.journal.replay()
+	s.False(s.store.partitions[events[0].JournalPartition])
+	s.Equal([]string{"orphan"}, replayed)
+}
+
+func (s *EventJournalSuite) TestJournalUnsupported() {
+	journal := newEventJournal(s.journal.context, nil)
+	s.Equal(errEventJournalUnsupported, journal.cancel(uuid.New()))
+	_, err := journal.list()
+	s.Equal(errEventJournalUnsupported, err)
+	event := &testJournaledEvent{}
+	s.Equal(event, journal.wrap(event))
+}
+
+func (event *testJournaledEvent) journalRecord() (string, interface{}) {
+	return testJournalType, event
+}
+
+func (event *testJournaledEvent) Handle(context *Context) error {
+	event.handled++
+	return nil
+}
+
+func (event *testJournaledEvent) Done(context *Context, err error) {
+	event.done = true
+	event.doneErr = err
+}
+
+func (m *mockEventJournalService) get(eventID string) (metadata.JournalEvent, bool) {
+	m.Lock()
+	defer m.Unlock()
+	event, ok := m.events[eventID]
+	return event, ok
+}
+
+func (m *mockEventJournalService) delete(eventID string) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.events, eventID)
+}
+
+func (m *mockEventJournalService) WriteJournalEvents(ctx thrift.Context, journal string, events []*metadata.JournalEvent, deleted []*metadata.JournalEvent) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, event := range events {
+		m.events[event.ID] = *event
+	}
+	for _, event := range deleted {
+		delete(m.events, event.ID)
+	}
+	m.writes++
+	return nil
+}
+
+func (m *mockEventJournalService) ReadJournalEvent(ctx thrift.Context, journal string, partition metadata.JournalPartition, eventID string) (*metadata.JournalEvent, error) {
+	m.Lock()
+	defer m.Unlock()
+	event, ok := m.events[eventID]
+	if !ok || event.JournalPartition != partition {
+		return nil, &shared.EntityNotExistsError{Message: "event not found"}
+	}
+	return &event, nil
+}
+
+func (m *mockEventJournalService) ListJournalEvents(ctx thrift.Context, journal string, partition metadata.JournalPartition) ([]*metadata.JournalEvent, error) {
+	m.Lock()
+	defer m.Unlock()
+	var result []*metadata.JournalEvent
+	for _, event := range m.events {
+		if event.JournalPartition == partition {
+			e := event
+			result = append(result, &e)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockEventJournalService) PutJournalPartition(ctx thrift.Context, journal string, partition metadata.JournalPartition) error {
+	m.Lock()
+	defer m.Unlock()
+	m.partitions[partition] = true
+	return nil
+}
+
+func (m *mockEventJournalService) ListJournalPartitions(ctx thrift.Context, journal string) ([]metadata.JournalPartition, error) {
+	m.Lock()
+	defer m.Unlock()
+	var result []metadata.JournalPartition
+	for partition := range m.partitions {
+		result = append(result, partition)
+	}
+	return result, nil
+}
+
+func (m *mockEventJournalService) DeleteJournalPartition(ctx thrift.Context, journal string, partition metadata.JournalPartition) error {
+	m.Lock()
+	defer m.Unlock()
+	if !m.partitions[partition] {
+		return errors.New("partition not found")
+	}
+	delete(m.partitions, partition)
+	return nil
+}
@@ -81,6 +81,12 @@ type (
 		// GetRetryableEventExecutor returns the executor for
 		// running retryable events
 		GetRetryableEventExecutor() RetryableEventExecutor
+		// Status returns a snapshot of the events that
+		// are queued, being handled or being retried
+		Status() *EventPipelineStatus
+		// Abort stops handling the in-flight event with
+		// the given id, the event type must match
+		Abort(id int64, eventType string) error
 	}
 
 	eventPipelineImpl struct {
@@ -88,6 +94,7 @@ type (
 		context       *Context
 		eventQueue    chan Event // workers handle events from this queue
 		retryExecutor RetryableEventExecutor
+		tracker       *eventTracker
 		started       int32
 		log           bark.Logger
 		shutdownC     chan struct{}
@@ -111,7 +118,8 @@ func NewEventPipeline(context *Context, nWorkers int) EventPipeline {
 		nWorkers:      nWorkers,
 		context:       context,
 		eventQueue:    make(chan Event, eventQueueSize),
-		retryExecutor: NewRetryableEventExecutor(context, maxRetryWorkers),
+		retryExecutor: newRetryableEventExecutor(context, maxRetryWorkers),
+		tracker:       newEventTracker(),
 		shutdownC:     make(chan struct{}),
 		log:           context.log.WithField(common.TagModule, `EventPipeline`),
 	}
@@ -157,16 +165,45 @@ func (ep *eventPipelineImpl) Add(event Event) bool {
 	if !ep.isStarted() {
 		ep.log.Fatal("Attempt to add event before starting the event pipeline")
 	}
+	if ep.context.eventJournal != nil {
+		event = ep.context.eventJournal.wrap(event)
+	}
+	tracked := ep.tracker.add(event)
 	select {
-	case ep.eventQueue <- event:
+	case ep.eventQueue <- tracked:
 		return true
 	default:
+		ep.tracker.remove(tracked)
+		if ep.context.eventJournal != nil {
+			ep.context.eventJournal.discard(event)
+		}
 		ep.context.m3Client.IncCounter(metrics.EventPipelineScope, metrics.ControllerEventsDropped)
 		ep.log.WithField(common.TagEvent, event).Warn("EventQueue full, dropping event")
 		return false
 	}
 }
 
+// Status returns a snapshot of the events in the pipeline
+func (ep *eventPipelineImpl) Status() *EventPipelineStatus {
+	status := ep.tracker.status()
+	status.QueueDepth = len(ep.eventQueue)
+	status.QueueCapacity = cap(ep.eventQueue)
+	if executor, ok := ep.retryExecutor.(*retryableEventExecutor); ok {
+		status.RetryWorkers = executor.busyWorkers()
+	}
+	if ep.context.dstLock != nil {
+		status.Locks = ep.context.dstLock.Status()
+	}
+	return status
+}
+
+// Abort stops handling the given in-flight event. Queued events are
+// not handled, events being retried are woken up and not retried
+// anymore, their Done callback is called with errEventAborted.
+func (ep *eventPipelineImpl) Abort(id int64, eventType string) error {
+	return ep.tracker.abort(id, eventType)
+}
+
 func (ep *eventPipelineImpl) isStarted() bool {
 	return atomic.LoadInt32(&ep.started) == 1
 }
@@ -204,6 +241,7 @@ func (ep *eventPipelineImpl) eventLoop() {
 // failures.
 type retryableEventExecutor struct {
 	sync.RWMutex
+	maxWorkers int
 	tokens     int // number of concurrent workers
 	stopped    int32
 	shutdownC  chan struct{}
@@ -231,10 +269,15 @@ const (
 //   * Retries should not impact or delay the processing of other
 //     events
 func NewRetryableEventExecutor(context *Context, maxWorkers int) RetryableEventExecutor {
+	return newRetryableEventExecutor(context, maxWorkers)
+}
+
+func newRetryableEventExecutor(context *Context, maxWorkers int) *retryableEventExecutor {
 	return &retryableEventExecutor{
-		tokens:    maxWorkers,
-		context:   context,
-		shutdownC: make(chan struct{}),
+		maxWorkers: maxWorkers,
+		tokens:     maxWorkers,
+		context:    context,
+		shutdownC:  make(chan struct{}),
 	}
 }
 
@@ -263,7 +306,7 @@ func (executor *retryableEventExecutor) execute(event Event) {
 
 	context := executor.context
 
-	if !executor.sleep(computeRetryInterval()) {
+	if !executor.sleep(event, computeRetryInterval()) {
 		// we are shutting down, exit asap
 		event.Done(executor.context, errRetryable)
 		return
@@ -276,17 +319,17 @@ func (executor *retryableEventExecutor) execute(event Event) {
 		context.m3Client.IncCounter(metrics.EventPipelineScope, metrics.ControllerRetries)
 
 		err = event.Handle(executor.context)
-		if err == nil {
+		if err == nil || err == errEventAborted {
 			break
 		}
 		if err == errRetryable {
-			if !executor.sleep(computeRetryInterval()) {
+			if !executor.sleep(event, computeRetryInterval()) {
 				break
 			}
 		}
 	}
 
-	if err != nil {
+	if err != nil && err != errEventAborted {
 		context.m3Client.IncCounter(metrics.EventPipelineScope, metrics.ControllerRetriesExceeded)
 	}
 
@@ -298,10 +341,18 @@ func computeRetryInterval() time.Duration {
 	return eventHandlerRetryInterval + time.Duration(int64(time.Second)*jitter)
 }
 
-func (executor *retryableEventExecutor) sleep(duration time.Duration) bool {
+// sleep waits for the given duration, returns false if the
+// executor is shutting down. An aborted event is woken up early.
+func (executor *retryableEventExecutor) sleep(event Event, duration time.Duration) bool {
+	var abortC <-chan struct{}
+	if tracked, ok := event.(*trackedEvent); ok {
+		abortC = tracked.abortC
+	}
 	select {
 	case <-time.After(duration):
 		return true
+	case <-abortC:
+		return true
 	case <-executor.shutdownC:
 		return false
 	}
@@ -324,6 +375,12 @@ func (executor *retryableEventExecutor) releaseToken() {
 	executor.tokens++
 }
 
+func (executor *retryableEventExecutor) busyWorkers() int {
+	executor.RLock()
+	defer executor.RUnlock()
+	return executor.maxWorkers - executor.tokens
+}
+
 func (executor *retryableEventExecutor) setStopped() {
 	executor.Lock()
 	defer executor.Unlock()
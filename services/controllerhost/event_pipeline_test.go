@@ -43,6 +43,7 @@ import (
 	localMetrics "github.com/uber/cherami-server/common/metrics"
 	storeStream "github.com/uber/cherami-server/stream"
 	"github.com/uber/cherami-thrift/.generated/go/admin"
+	"github.com/uber/cherami-thrift/.generated/go/cherami"
 	m "github.com/uber/cherami-thrift/.generated/go/metadata"
 	"github.com/uber/cherami-thrift/.generated/go/shared"
 	"github.com/uber/cherami-thrift/.generated/go/store"
@@ -426,6 +427,311 @@ func (s *EventPipelineSuite) TestInputHostFailedEvent() {
 	}
 }
 
+func (s *EventPipelineSuite) TestStoreHostDrainEvent() {
+
+	path := s.generateName("/cherami/event-test")
+	dstDesc, err := s.createDestination(path)
+	s.Nil(err, "Failed to create destination")
+
+	dstID := dstDesc.GetDestinationUUID()
+	inHostIDs := []string{uuid.New(), uuid.New()}
+	extentIDs := []string{uuid.New(), uuid.New()}
+	storeIDs := []string{uuid.New(), uuid.New(), uuid.New()}
+	spareStoreID := uuid.New()
+
+	for i := 0; i < len(extentIDs); i++ {
+		_, err = s.mcp.context.mm.CreateExtent(dstID, extentIDs[i], inHostIDs[i], storeIDs)
+		s.Nil(err, "Failed to create extent")
+	}
+	// the first extent is sealed and can be moved right
+	// away, the second one has to be sealed by the drain
+	s.Nil(s.mcp.context.mm.SealExtent(dstID, extentIDs[0]), "Failed to seal extent")
+
+	rpm := common.NewMockRingpopMonitor()
+	allStoreIDs := append([]string{spareStoreID}, storeIDs...)
+	stores := make(map[string]*MockStoreService)
+	for _, id := range allStoreIDs {
+		stores[id] = NewMockStoreService()
+		stores[id].Start()
+		rpm.Add(common.StoreServiceName, id, stores[id].hostPort)
+	}
+	s.mcp.context.rpm = rpm
+
+	drainedID := storeIDs[0]
+	s.mcp.context.eventPipeline.Add(NewStoreHostDrainEvent(drainedID))
+
+	cond := func() bool {
+		return stores[drainedID].isSealed(extentIDs[1]) && stores[spareStoreID].isExtentReReplicated(extentIDs[0])
+	}
+	succ := common.SpinWaitOnCondition(cond, 60*time.Second)
+	s.True(succ, "Timed out waiting for the extents to be sealed and re-replicated")
+
+	isReplaced := func(extentID string) bool {
+		stats, e := s.mcp.context.mm.ReadExtentStats(dstID, extentID)
+		if e != nil {
+			return false
+		}
+		var hasDrained, hasSpare bool
+		for _, id := range stats.GetExtent().GetStoreUUIDs() {
+			hasDrained = hasDrained || id == drainedID
+			hasSpare = hasSpare || id == spareStoreID
+		}
+		return !hasDrained && hasSpare
+	}
+	succ = common.SpinWaitOnCondition(func() bool { return isReplaced(extentIDs[0]) }, 60*time.Second)
+	s.True(succ, "Timed out waiting for the store list of the extent to be updated")
+
+	host, err := resolveStoreHost(s.mcp.context, drainedID)
+	s.Nil(err)
+
+	// the extent sealed by the drain is moved on the next pass
+	cond = func() bool {
+		status, e := readStoreDrainStatus(s.mcp.context, host)
+		return e == nil && status.OpenExtents == 0 && status.SealedExtents == 1 && !status.Drained
+	}
+	succ = common.SpinWaitOnCondition(cond, 60*time.Second)
+	s.True(succ, "Timed out waiting for the open extent to be sealed")
+
+	s.mcp.context.eventPipeline.Add(NewStoreHostDrainEvent(drainedID))
+
+	cond = func() bool {
+		status, e := readStoreDrainStatus(s.mcp.context, host)
+		return e == nil && status.Drained && isReplaced(extentIDs[1])
+	}
+	succ = common.SpinWaitOnCondition(cond, 60*time.Second)
+	s.True(succ, "Timed out waiting for the store host to be drained")
+
+	for _, store := range stores {
+		store.Stop()
+	}
+}
+
+func (s *EventPipelineSuite) TestStoreHostDrainEventSkipsConsumedExtents() {
+
+	path := s.generateName("/cherami/event-test")
+	dstDesc, err := s.createDestination(path)
+	s.Nil(err, "Failed to create destination")
+	cgDesc, err := s.createConsumerGroup(path, s.generateName("/cherami/event-test-cg"))
+	s.Nil(err, "Failed to create consumer group")
+
+	dstID := dstDesc.GetDestinationUUID()
+	extentID := uuid.New()
+	storeIDs := []string{uuid.New(), uuid.New(), uuid.New()}
+	spareStoreID := uuid.New()
+
+	_, err = s.mcp.context.mm.CreateExtent(dstID, extentID, uuid.New(), storeIDs)
+	s.Nil(err, "Failed to create extent")
+	s.Nil(s.mcp.context.mm.SealExtent(dstID, extentID), "Failed to seal extent")
+	s.Nil(s.mcp.context.mm.AddExtentToConsumerGroup(dstID, cgDesc.GetConsumerGroupUUID(), extentID, uuid.New(), storeIDs))
+
+	rpm := common.NewMockRingpopMonitor()
+	stores := make(map[string]*MockStoreService)
+	for _, id := range append([]string{spareStoreID}, storeIDs...) {
+		stores[id] = NewMockStoreService()
+		stores[id].Start()
+		rpm.Add(common.StoreServiceName, id, stores[id].hostPort)
+	}
+	s.mcp.context.rpm = rpm
+
+	drainedID := storeIDs[0]
+	host, err := resolveStoreHost(s.mcp.context, drainedID)
+	s.Nil(err)
+
+	// the consumer group still has to read the extent
+	status, err := readStoreDrainStatus(s.mcp.context, host)
+	s.Nil(err)
+	s.Equal(1, status.SealedExtents)
+	s.False(status.Drained)
+
+	s.Nil(s.mcp.context.mm.UpdateConsumerGroupExtentStatus(cgDesc.GetConsumerGroupUUID(), extentID, m.ConsumerGroupExtentStatus_CONSUMED))
+
+	s.Nil(NewStoreHostDrainEvent(drainedID).Handle(s.mcp.context))
+	_, inProgress := s.mcp.context.extentRepairs.inProgress.Get(extentID)
+	s.False(inProgress, "Consumed extent was re-replicated")
+
+	status, err = readStoreDrainStatus(s.mcp.context, host)
+	s.Nil(err)
+	s.Equal(0, status.SealedExtents)
+	s.Equal(1, status.ConsumedExtents)
+	s.True(status.Drained)
+
+	for _, store := range stores {
+		store.Stop()
+	}
+}
+
+func (s *EventPipelineSuite) TestExtentReReplicationEventWaitsForCopy() {
+
+	path := s.generateName("/cherami/event-test")
+	dstDesc, err := s.createDestination(path)
+	s.Nil(err, "Failed to create destination")
+
+	dstID := dstDesc.GetDestinationUUID()
+	extentID := uuid.New()
+	storeIDs := []string{uuid.New(), uuid.New(), uuid.New()}
+	spareStoreID := uuid.New()
+
+	_, err = s.mcp.context.mm.CreateExtent(dstID, extentID, uuid.New(), storeIDs)
+	s.Nil(err, "Failed to create extent")
+	s.Nil(s.mcp.context.mm.SealExtent(dstID, extentID), "Failed to seal extent")
+
+	rpm := common.NewMockRingpopMonitor()
+	stores := make(map[string]*MockStoreService)
+	for _, id := range append([]string{spareStoreID}, storeIDs...) {
+		stores[id] = NewMockStoreService()
+		stores[id].Start()
+		rpm.Add(common.StoreServiceName, id, stores[id].hostPort)
+	}
+	s.mcp.context.rpm = rpm
+
+	hasStore := func(storeID string) bool {
+		stats, e := s.mcp.context.mm.ReadExtentStats(dstID, extentID)
+		s.Nil(e)
+		for _, id := range stats.GetExtent().GetStoreUUIDs() {
+			if id == storeID {
+				return true
+			}
+		}
+		return false
+	}
+
+	// the copy is still running on the new store, the metadata is left alone
+	stores[spareStoreID].setCopying(extentID, true)
+	event := NewExtentReReplicationEvent(dstID, extentID, storeIDs[0]).(*ExtentReReplicationEvent)
+	s.Equal(errRetryable, event.Handle(s.mcp.context))
+	s.True(stores[spareStoreID].isExtentReReplicated(extentID))
+	s.True(hasStore(storeIDs[0]))
+	s.False(hasStore(spareStoreID))
+
+	expectedType, err := common.CheramiDestinationType(dstDesc.GetType())
+	s.Nil(err)
+	dstType, ok := stores[spareStoreID].getReReplicationDstType(extentID)
+	s.True(ok)
+	s.Equal(expectedType, dstType)
+
+	// sealed where the source is, the new replica replaces the lost one
+	stores[spareStoreID].setCopying(extentID, false)
+	s.Nil(event.Handle(s.mcp.context))
+	s.False(hasStore(storeIDs[0]))
+	s.True(hasStore(spareStoreID))
+	event.Done(s.mcp.context, nil)
+
+	// the replaced copy is purged, the new one is kept
+	s.True(stores[storeIDs[0]].isExtentPurged(extentID))
+	s.False(stores[spareStoreID].isExtentPurged(extentID))
+
+	for _, store := range stores {
+		store.Stop()
+	}
+}
+
+func (s *EventPipelineSuite) TestOutputHostFailedEvent() {
+
+	path := s.generateName("/cherami/event-test")
+	dstDesc, err := s.createDestination(path)
+	s.Nil(err, "Failed to create destination")
+	s.Equal(common.UUIDStringLength, len(dstDesc.GetDestinationUUID()), "Invalid destination uuid")
+
+	dstID := dstDesc.GetDestinationUUID()
+	inHostIDs := []string{uuid.New(), uuid.New()}
+	extentIDs := []string{uuid.New(), uuid.New()}
+	storeIDs := []string{uuid.New(), uuid.New(), uuid.New()}
+	deadOutHostID := uuid.New()
+	liveOutHostID := uuid.New()
+
+	for i := 0; i < len(extentIDs); i++ {
+		_, err := s.mcp.context.mm.CreateExtent(dstID, extentIDs[i], inHostIDs[i], storeIDs)
+		s.Nil(err, "Failed to create extent")
+	}
+
+	cgNames := []string{s.generateName("cons-1"), s.generateName("cons-2")}
+	cgIDs := make([]string, len(cgNames))
+	for i, name := range cgNames {
+		cgDesc, errCCG := s.createConsumerGroup(dstDesc.GetPath(), name)
+		s.Nil(errCCG, "Failed to create consumer group")
+		cgIDs[i] = cgDesc.GetConsumerGroupUUID()
+		for _, extID := range extentIDs {
+			err = s.mcp.context.mm.AddExtentToConsumerGroup(dstID, cgIDs[i], extID, deadOutHostID, storeIDs)
+			s.Nil(err, "Failed to add extent to consumer group")
+		}
+	}
+
+	outputService := NewMockInputOutputService(common.OutputServiceName)
+	thriftService := admin.NewTChanOutputHostAdminServer(outputService)
+	outputService.Start(common.OutputServiceName, thriftService)
+
+	rpm := common.NewMockRingpopMonitor()
+	stores := make([]*MockStoreService, len(storeIDs))
+	for i := 0; i < len(storeIDs); i++ {
+		stores[i] = NewMockStoreService()
+		stores[i].Start()
+		rpm.Add(common.StoreServiceName, storeIDs[i], stores[i].hostPort)
+	}
+	// only the live output host is part of the ring
+	rpm.Add(common.OutputServiceName, liveOutHostID, outputService.hostPort)
+	s.mcp.context.rpm = rpm
+
+	// leadership follows the ringpop mock, the first controller is the primary
+	otherCtrlID := uuid.New()
+	s.mcp.context.hostID = uuid.New()
+	s.mcp.context.leaders = newLeaderElection(s.mcp.context, nil)
+	rpm.Add(common.ControllerServiceName, otherCtrlID, "127.0.0.1")
+
+	// a controller that isn't the primary leaves the extents alone
+	event := NewOutputHostFailedEvent(deadOutHostID)
+	s.Nil(event.Handle(s.mcp.context))
+	for _, cgID := range cgIDs {
+		cgExtents, errList := s.mcp.context.mm.ListExtentsByConsumerGroup(dstID, cgID, nil)
+		s.Nil(errList)
+		for _, cge := range cgExtents {
+			s.Equal(deadOutHostID, cge.GetOutputHostUUID())
+		}
+	}
+
+	rpm.Remove(common.ControllerServiceName, otherCtrlID)
+	rpm.Add(common.ControllerServiceName, s.mcp.context.hostID, "127.0.0.1")
+
+	// consumer groups that can't be locked are retried
+	s.True(s.mcp.context.dstLock.TryLock(dstID, time.Second))
+	s.Equal(errRetryable, event.Handle(s.mcp.context))
+	s.mcp.context.dstLock.Unlock(dstID)
+	retryCGs := event.(*OutputHostFailedEvent).retryCGs
+	s.Equal(len(cgIDs), len(retryCGs))
+	for _, cgID := range cgIDs {
+		s.Equal(dstID, retryCGs[cgID])
+	}
+
+	s.mcp.context.eventPipeline.Add(event)
+
+	for _, cgID := range cgIDs {
+		cond := func() bool {
+			cgExtents, err := s.mcp.context.mm.ListExtentsByConsumerGroup(dstID, cgID, nil)
+			if err != nil || len(cgExtents) != len(extentIDs) {
+				return false
+			}
+			for _, cge := range cgExtents {
+				if cge.GetOutputHostUUID() != liveOutHostID {
+					return false
+				}
+			}
+			return true
+		}
+		succ := common.SpinWaitOnCondition(cond, 60*time.Second)
+		s.True(succ, "Timed out waiting for consumer group extents to be reassigned")
+
+		cond = func() bool {
+			return outputService.GetUpdatedCount(cgID) > 0
+		}
+		succ = common.SpinWaitOnCondition(cond, 60*time.Second)
+		s.True(succ, "Output host failed to receive notification within timeout")
+	}
+
+	outputService.Stop()
+	for i := 0; i < len(stores); i++ {
+		stores[i].Stop()
+	}
+}
+
 func (s *EventPipelineSuite) TestRemoteZoneExtentCreatedEvent() {
 	destID := uuid.New()
 	extentID := uuid.New()
@@ -518,13 +824,22 @@ type MockStoreService struct {
 	sealFailedCount          int
 	remoteReplicationExtents []string
 	reReplicationExtents     []string
+	reReplicationDstTypes    map[string]cherami.DestinationType
+	// replicas still being copied, they are not sealed yet
+	copyingExtents map[string]bool
+	purgedExtents  []string
 }
 
+// mockStoreSealSeqNum is where the mock store has every extent sealed at
+const mockStoreSealSeqNum = 100
+
 func NewMockStoreService() *MockStoreService {
 	return &MockStoreService{
 		sealedExtents:            make(map[string]bool),
 		remoteReplicationExtents: make([]string, 0),
 		reReplicationExtents:     make([]string, 0),
+		reReplicationDstTypes:    make(map[string]cherami.DestinationType),
+		copyingExtents:           make(map[string]bool),
 	}
 }
 
@@ -561,13 +876,27 @@ func (service *MockStoreService) OpenReadStream(ctx thrift.Context, cfs storeStr
 	return errors.New("Not implemented")
 }
 func (service *MockStoreService) GetAddressFromTimestamp(ctx thrift.Context, req *store.GetAddressFromTimestampRequest) (r *store.GetAddressFromTimestampResult_, err error) {
-	return nil, errors.New("Not implemented")
+	service.mu.Lock()
+	copying := service.copyingExtents[req.GetExtentUUID()]
+	service.mu.Unlock()
+	res := store.NewGetAddressFromTimestampResult_()
+	res.Address = common.Int64Ptr(mockStoreSealSeqNum)
+	res.SequenceNumber = common.Int64Ptr(mockStoreSealSeqNum)
+	res.Sealed = common.BoolPtr(true)
+	if copying {
+		res.SequenceNumber = common.Int64Ptr(mockStoreSealSeqNum / 2)
+		res.Sealed = common.BoolPtr(false)
+	}
+	return res, nil
 }
 func (service *MockStoreService) GetExtentInfo(ctx thrift.Context, eir *store.GetExtentInfoRequest) (r *store.ExtentInfo, err error) {
 	return nil, errors.New("Not implemented")
 }
 func (service *MockStoreService) PurgeMessages(ctx thrift.Context, req *store.PurgeMessagesRequest) (*store.PurgeMessagesResult_, error) {
-	return nil, errors.New("Not implemented")
+	service.mu.Lock()
+	service.purgedExtents = append(service.purgedExtents, req.GetExtentUUID())
+	service.mu.Unlock()
+	return store.NewPurgeMessagesResult_(), nil
 }
 func (service *MockStoreService) ReadMessages(ctx thrift.Context, readMessagesRequest *store.ReadMessagesRequest) (*store.ReadMessagesResult_, error) {
 	return nil, errors.New("Not implemented")
@@ -575,6 +904,7 @@ func (service *MockStoreService) ReadMessages(ctx thrift.Context, readMessagesRe
 func (service *MockStoreService) ReplicateExtent(ctx thrift.Context, req *store.ReplicateExtentRequest) error {
 	service.mu.Lock()
 	service.reReplicationExtents = append(service.reReplicationExtents, req.GetExtentUUID())
+	service.reReplicationDstTypes[req.GetExtentUUID()] = req.GetDestinationType()
 	service.mu.Unlock()
 	return nil
 }
@@ -715,3 +1045,27 @@ func (service *MockInputOutputService) GetUpdatedCount(key string) int {
 func (service *MockInputOutputService) UnloadConsumerGroups(ctx thrift.Context, request *admin.UnloadConsumerGroupsRequest) error {
 	return fmt.Errorf("mock not implemented")
 }
+
+func (service *MockStoreService) setCopying(extentID string, copying bool) {
+	service.mu.Lock()
+	service.copyingExtents[extentID] = copying
+	service.mu.Unlock()
+}
+
+func (service *MockStoreService) getReReplicationDstType(extentID string) (cherami.DestinationType, bool) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	dstType, ok := service.reReplicationDstTypes[extentID]
+	return dstType, ok
+}
+
+func (service *MockStoreService) isExtentPurged(extentID string) bool {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	for _, id := range service.purgedExtents {
+		if id == extentID {
+			return true
+		}
+	}
+	return false
+}
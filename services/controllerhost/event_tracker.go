@@ -0,0 +1,234 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+)
+
+const (
+	eventStageQueued   = "queued"
+	eventStageHandling = "handling"
+	eventStageRetrying = "retrying"
+	eventStageAborted  = "aborted"
+)
+
+// minAbortEventAge is how long an event has to be in the pipeline
+// before it can be aborted, only stuck events are meant to be aborted
+var minAbortEventAge = time.Minute
+
+var errEventAborted = errors.New("Event aborted")
+
+type (
+	// EventPipelineStatus is a snapshot of the event pipeline
+	EventPipelineStatus struct {
+		QueueDepth     int              `json:"queueDepth"`
+		QueueCapacity  int              `json:"queueCapacity"`
+		RetryWorkers   int              `json:"retryWorkers"`
+		QueuedByType   map[string]int   `json:"queuedByType"`
+		RetryingByType map[string]int   `json:"retryingByType"`
+		Events         []*InFlightEvent `json:"events"`
+		Locks          []*LockStatus    `json:"locks"`
+	}
+
+	// InFlightEvent describes an event that was added
+	// to the event pipeline and is not done yet
+	InFlightEvent struct {
+		ID          int64     `json:"id"`
+		Type        string    `json:"type"`
+		Stage       string    `json:"stage"`
+		Attempts    int       `json:"attempts"`
+		AddedTime   time.Time `json:"addedTime"`
+		AgeSecs     int64     `json:"ageSecs"`
+		LastAttempt time.Time `json:"lastAttempt"`
+	}
+
+	// eventTracker keeps track of the in-flight events
+	// of the event pipeline, for the debug endpoints
+	eventTracker struct {
+		sync.Mutex
+		nextID int64
+		events map[int64]*trackedEvent
+	}
+
+	// trackedEvent wraps an event while it is in the
+	// event pipeline and records its progress. The
+	// fields are guarded by the tracker lock.
+	trackedEvent struct {
+		Event
+		tracker     *eventTracker
+		id          int64
+		eventType   string
+		addedTime   time.Time
+		stage       string
+		attempts    int
+		lastAttempt time.Time
+		aborted     bool
+		abortC      chan struct{}
+	}
+
+	inFlightEventsByAge []*InFlightEvent
+)
+
+func newEventTracker() *eventTracker {
+	return &eventTracker{
+		events: make(map[int64]*trackedEvent),
+	}
+}
+
+// add starts tracking the given event, the returned
+// event must be the one added to the event queue
+func (tracker *eventTracker) add(event Event) *trackedEvent {
+	tracker.Lock()
+	defer tracker.Unlock()
+	tracker.nextID++
+	tracked := &trackedEvent{
+		Event:     event,
+		tracker:   tracker,
+		id:        tracker.nextID,
+		eventType: eventTypeName(event),
+		addedTime: time.Now(),
+		stage:     eventStageQueued,
+		abortC:    make(chan struct{}),
+	}
+	tracker.events[tracked.id] = tracked
+	return tracked
+}
+
+func (tracker *eventTracker) remove(tracked *trackedEvent) {
+	tracker.Lock()
+	delete(tracker.events, tracked.id)
+	tracker.Unlock()
+}
+
+func (tracker *eventTracker) abort(id int64, eventType string) error {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	tracked, ok := tracker.events[id]
+	if !ok {
+		return &shared.EntityNotExistsError{Message: fmt.Sprintf("event %v not found", id)}
+	}
+	if tracked.eventType != eventType {
+		return &shared.BadRequestError{Message: fmt.Sprintf("event %v is a %v, not a %v", id, tracked.eventType, eventType)}
+	}
+	if time.Since(tracked.addedTime) < minAbortEventAge {
+		return &shared.BadRequestError{Message: fmt.Sprintf("event %v is younger than %v", id, minAbortEventAge)}
+	}
+	if !tracked.aborted {
+		tracked.aborted = true
+		tracked.stage = eventStageAborted
+		close(tracked.abortC)
+	}
+	return nil
+}
+
+func (tracker *eventTracker) status() *EventPipelineStatus {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	now := time.Now()
+	status := &EventPipelineStatus{
+		QueuedByType:   make(map[string]int),
+		RetryingByType: make(map[string]int),
+		Events:         make([]*InFlightEvent, 0, len(tracker.events)),
+	}
+
+	for _, tracked := range tracker.events {
+		switch tracked.stage {
+		case eventStageQueued:
+			status.QueuedByType[tracked.eventType]++
+		case eventStageRetrying:
+			status.RetryingByType[tracked.eventType]++
+		}
+		status.Events = append(status.Events, &InFlightEvent{
+			ID:          tracked.id,
+			Type:        tracked.eventType,
+			Stage:       tracked.stage,
+			Attempts:    tracked.attempts,
+			AddedTime:   tracked.addedTime,
+			AgeSecs:     int64(now.Sub(tracked.addedTime) / time.Second),
+			LastAttempt: tracked.lastAttempt,
+		})
+	}
+
+	sort.Sort(inFlightEventsByAge(status.Events))
+	return status
+}
+
+// Handle handles the wrapped event, unless it was aborted
+func (tracked *trackedEvent) Handle(context *Context) error {
+	tracker := tracked.tracker
+
+	tracker.Lock()
+	if tracked.aborted {
+		tracker.Unlock()
+		return errEventAborted
+	}
+	tracked.stage = eventStageHandling
+	tracked.attempts++
+	tracked.lastAttempt = time.Now()
+	tracker.Unlock()
+
+	err := tracked.Event.Handle(context)
+
+	tracker.Lock()
+	if tracked.aborted {
+		err = errEventAborted
+	} else if err == errRetryable {
+		tracked.stage = eventStageRetrying
+	}
+	tracker.Unlock()
+
+	return err
+}
+
+// Done stops tracking the event and calls its Done callback
+func (tracked *trackedEvent) Done(context *Context, err error) {
+	tracked.tracker.remove(tracked)
+	tracked.Event.Done(context, err)
+}
+
+// eventTypeName returns the type of the event, without the package
+func eventTypeName(event Event) string {
+	if entry, ok := event.(*journalEntry); ok {
+		return eventTypeName(entry.journaledEvent)
+	}
+	t := reflect.TypeOf(event)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+func (events inFlightEventsByAge) Len() int      { return len(events) }
+func (events inFlightEventsByAge) Swap(i, j int) { events[i], events[j] = events[j], events[i] }
+func (events inFlightEventsByAge) Less(i, j int) bool {
+	// ids are handed out in the order the events are added
+	return events[i].ID < events[j].ID
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+)
+
+type (
+	EventTrackerSuite struct {
+		*require.Assertions
+		suite.Suite
+		tracker *eventTracker
+	}
+
+	testTrackedEvent struct {
+		eventBase
+		err     error
+		handled int
+		doneErr error
+	}
+)
+
+func TestEventTrackerSuite(t *testing.T) {
+	suite.Run(t, new(EventTrackerSuite))
+}
+
+func (s *EventTrackerSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+	s.tracker = newEventTracker()
+}
+
+func (s *EventTrackerSuite) TestStatus() {
+
+	queued := s.tracker.add(&testTrackedEvent{})
+	retrying := s.tracker.add(&testTrackedEvent{err: errRetryable})
+	s.Equal(errRetryable, retrying.Handle(nil))
+
+	status := s.tracker.status()
+	s.Equal(2, len(status.Events))
+	s.Equal(map[string]int{"testTrackedEvent": 1}, status.QueuedByType)
+	s.Equal(map[string]int{"testTrackedEvent": 1}, status.RetryingByType)
+
+	s.Equal(queued.id, status.Events[0].ID)
+	s.Equal(eventStageQueued, status.Events[0].Stage)
+	s.Equal(0, status.Events[0].Attempts)
+	s.Equal(retrying.id, status.Events[1].ID)
+	s.Equal(eventStageRetrying, status.Events[1].Stage)
+	s.Equal(1, status.Events[1].Attempts)
+
+	queued.Done(nil, nil)
+	retrying.Done(nil, errRetryable)
+	s.Equal(0, len(s.tracker.status().Events))
+}
+
+func (s *EventTrackerSuite) TestAbort() {
+
+	event := &testTrackedEvent{err: errRetryable}
+	tracked := s.tracker.add(event)
+
+	err := s.tracker.abort(tracked.id, "testTrackedEvent")
+	s.IsType(&shared.BadRequestError{}, err, "Young events must not be aborted")
+
+	defer func(age time.Duration) { minAbortEventAge = age }(minAbortEventAge)
+	minAbortEventAge = 0
+
+	s.IsType(&shared.EntityNotExistsError{}, s.tracker.abort(tracked.id+1, "testTrackedEvent"))
+	s.IsType(&shared.BadRequestError{}, s.tracker.abort(tracked.id, "ExtentDownEvent"))
+
+	s.Nil(s.tracker.abort(tracked.id, "testTrackedEvent"))
+	s.Nil(s.tracker.abort(tracked.id, "testTrackedEvent"))
+
+	select {
+	case <-tracked.abortC:
+	default:
+		s.Fail("Aborted event must be woken up")
+	}
+
+	s.Equal(errEventAborted, tracked.Handle(nil))
+	s.Equal(0, event.handled)
+	tracked.Done(nil, errEventAborted)
+	s.Equal(errEventAborted, event.doneErr)
+}
+
+func (s *EventTrackerSuite) TestEventTypeName() {
+	s.Equal("ExtentDownEvent", eventTypeName(&ExtentDownEvent{}))
+	s.Equal("ExtentDownEvent", eventTypeName(&journalEntry{journaledEvent: &ExtentDownEvent{}}))
+}
+
+func (event *testTrackedEvent) Handle(context *Context) error {
+	event.handled++
+	return event.err
+}
+
+func (event *testTrackedEvent) Done(context *Context, err error) {
+	event.doneErr = err
+}
@@ -60,6 +60,12 @@ type (
 		shutdownWG   sync.WaitGroup
 		*queueDepthCalculator
 		mi *mIterator
+		// zones each destination had replicas lagging
+		// from, as of the last replication lag report
+		lagZones map[string]map[string]struct{}
+		// term is the leadership term the current scan
+		// started in, only accessed by the scan loop
+		term int64
 	}
 
 	extentCacheEntry struct {
@@ -105,6 +111,7 @@ func newExtentStateMonitor(context *Context) *extentStateMonitor {
 	monitor.rateLimiter = common.NewTokenBucket(maxExtentDownEventsPerSec, common.NewRealTimeSource())
 	monitor.queueDepthCalculator = newQueueDepthCalculator(monitor)
 	monitor.mi = newMIterator(context)
+	monitor.lagZones = make(map[string]map[string]struct{})
 	return monitor
 }
 
@@ -134,12 +141,26 @@ func (monitor *extentStateMonitor) RecvStoreExtentHeartbeat(hostID string, extID
 }
 
 func (monitor *extentStateMonitor) isPrimary() bool {
-	context := monitor.context
-	hi, err := context.rpm.FindHostForKey(common.ControllerServiceName, common.ControllerServiceName)
-	if err != nil {
-		return false
+	return isPrimaryController(monitor.context)
+}
+
+// isPrimaryForScan returns true if this controller is still the
+// primary it was when the current scan started. A scan takes long
+// enough for the leadership to move to another controller, and
+// back, so this is checked before every change the scan makes.
+func (monitor *extentStateMonitor) isPrimaryForScan() bool {
+	if monitor.context.leaders.IsLeaderForTerm(leaseExtentMonitor, monitor.term) {
+		return true
 	}
-	return (hi.UUID == context.hostID)
+	monitor.ll.Warn("ExtentStateMonitor lost the primary role during the scan, stopping")
+	return false
+}
+
+// isPrimaryController returns true if this controller
+// owns the background work that must only run once in
+// the cluster
+func isPrimaryController(context *Context) bool {
+	return context.leaders.IsLeader(leaseExtentMonitor)
 }
 
 // waitUntilBootstrap waits for ringpop to bootstrap and
@@ -192,11 +213,13 @@ func (monitor *extentStateMonitor) run() {
 shutdown:
 	for !monitor.isShutdown() {
 
-		if !monitor.isPrimary() {
+		term, isPrimary := monitor.context.leaders.Term(leaseExtentMonitor)
+		if !isPrimary {
 			monitor.ll.Info("ExtentStateMonitor won't run, controller is not primary")
 			monitor.sleep(30 * time.Second)
 			continue shutdown
 		}
+		monitor.term = term
 
 		monitor.ll.Info("ExtentStateMonitor beginning to scan all extents")
 
@@ -219,6 +242,10 @@ shutdown:
 				continue readLoop
 			}
 
+			if !monitor.isPrimaryForScan() {
+				break readLoop
+			}
+
 			// Invoke queueDepthCalculator before invoking processDestination.
 			// Why? Because when the destination is in DELETING state, processDestination
 			// would go ahead and delete all consumer groups for that destination, so
@@ -232,6 +259,12 @@ shutdown:
 
 		monitor.mi.publishEvent(eIterEnd, nil)
 
+		// keep draining the store hosts that are being drained, the
+		// extents sealed since the last pass are re-replicated now
+		if monitor.isPrimaryForScan() {
+			driveStoreDrains(monitor.context)
+		}
+
 		monitor.ll.Info("ExtentStateMonitor done with scanning all extents")
 		monitor.sleep(sleepTime)
 	}
@@ -244,6 +277,7 @@ func (monitor *extentStateMonitor) processDestination(dstDesc *shared.Destinatio
 	var err error
 	var context = monitor.context
 	var stats []*shared.ExtentStats
+	var replicating []*shared.ExtentStats // open and sealed extents, that may be replicating
 
 	monitor.mi.publishEvent(eExtentIterStart, nil)
 
@@ -272,10 +306,16 @@ extentIter:
 		}
 
 		monitor.processExtents(dstDesc, stats)
+
+		if status == shared.ExtentStatus_OPEN || status == shared.ExtentStatus_SEALED {
+			replicating = append(replicating, stats...)
+		}
 	}
 
 	monitor.mi.publishEvent(eExtentIterEnd, nil)
 
+	monitor.reportReplicationLag(dstDesc, replicating)
+
 	if dstDesc.GetStatus() == shared.DestinationStatus_DELETING {
 		// When a destination is in DELETING state, we need to make
 		// sure all of the consumer groups tied to that destination
@@ -309,6 +349,9 @@ func (monitor *extentStateMonitor) processExtents(dstDesc *shared.DestinationDes
 				if !monitor.rateLimiter.Consume(1, 2*time.Second) {
 					continue
 				}
+				if !monitor.isPrimaryForScan() {
+					return
+				}
 				addExtentDownEvent(monitor.context, 0, extent.GetDestinationUUID(), extent.GetExtentUUID())
 			}
 		default:
@@ -345,6 +388,9 @@ func (monitor *extentStateMonitor) fixOutOfSyncStoreExtents(dstID string, extent
 			continue
 		}
 		if entry.status == shared.ExtentStatus_OPEN {
+			if !monitor.isPrimaryForScan() {
+				return
+			}
 			// store out of sync, re-seal this extent
 			addStoreExtentStatusOutOfSyncEvent(monitor.context, dstID, extent.GetExtentUUID(), storeh)
 			monitor.ll.WithFields(bark.Fields{
@@ -409,6 +455,10 @@ func (monitor *extentStateMonitor) deleteConsumerGroups(dstDesc *shared.Destinat
 			continue
 		}
 
+		if !monitor.isPrimaryForScan() {
+			return
+		}
+
 		// Update the metadata state before notifying the output hosts. This is
 		// because, updating the consumer group status is a Quorum operation and
 		// will fail in a minority partition. We don't want to sit in a tight
@@ -102,6 +102,8 @@ func (s *ExtentStateMonitorSuite) SetupTest() {
 	s.mcp.context.eventPipeline = NewEventPipeline(s.mcp.context, 2)
 	s.mcp.context.eventPipeline.Start()
 	s.mcp.context.extentMonitor = newExtentStateMonitor(s.mcp.context)
+	// leadership follows the ringpop mock in these tests
+	s.mcp.context.leaders = newLeaderElection(s.mcp.context, nil)
 	s.mcp.context.m3Client = metrics.NewClient(common.NewMetricReporterWithHostname(configure.NewCommonServiceConfig()), metrics.Controller)
 }
 
@@ -136,6 +138,8 @@ func (s *ExtentStateMonitorSuite) TestStoreExtentStatusOutOfSync() {
 		stores[i].Start()
 		rpm.Add(common.StoreServiceName, storeIDs[i], stores[i].hostPort)
 	}
+	// the scan only makes changes while this controller is the primary
+	rpm.Add(common.ControllerServiceName, s.mcp.context.hostID, "127.0.0.1")
 
 	s.mcp.context.rpm = rpm
 	// simulate one of the store host reporting itself as out of sync
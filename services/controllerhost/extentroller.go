@@ -0,0 +1,310 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-server/common/metrics"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+)
+
+const (
+	extentRollReasonSize = "size"
+	extentRollReasonAge  = "age"
+)
+
+var (
+	// extentRollInterval is the time between checks of
+	// the open extents against their size and age limits
+	extentRollInterval = time.Minute
+	// extentRollStateTTL is the time after which an extent
+	// that's no longer reported is dropped
+	extentRollStateTTL = 10 * time.Minute
+)
+
+type (
+	// extentRoller seals the open extents of a destination that
+	// cross the size or age limits configured for its path, after
+	// opening a replacement extent. The size of an extent is the
+	// largest last seqnum and size in bytes of its replicas, as the
+	// store hosts report them to metadata once a minute, so it does
+	// not depend on how long this controller has been receiving
+	// load reports. Extents that are not reported by an input host,
+	// i.e. not loaded on an input host, are left alone.
+	extentRoller struct {
+		sync.Mutex
+		started    int32
+		context    *Context
+		ll         bark.Logger
+		extents    map[string]*extentRollState
+		shutdownC  chan struct{}
+		shutdownWG sync.WaitGroup
+	}
+
+	// extentRollState is the state of a single reported extent
+	extentRollState struct {
+		dstID      string
+		lastReport int64 // timestamp of the last report, unix nanos
+		rolling    bool  // an ExtentRollEvent is in flight
+	}
+
+	// extentRollLimits are the limits for the extents
+	// of a destination path, zero disables a limit
+	extentRollLimits struct {
+		maxBytes int64
+		maxMsgs  int64
+		maxAge   time.Duration
+	}
+)
+
+// newExtentRoller creates and returns a new instance of extentRoller
+func newExtentRoller(context *Context) *extentRoller {
+	return &extentRoller{
+		context:   context,
+		ll:        context.log.WithField(common.TagModule, `extentRoller`),
+		extents:   make(map[string]*extentRollState),
+		shutdownC: make(chan struct{}),
+	}
+}
+
+func (r *extentRoller) Start() {
+	if !atomic.CompareAndSwapInt32(&r.started, 0, 1) {
+		return
+	}
+	r.shutdownWG.Add(1)
+	go r.run()
+	r.ll.Info("ExtentRoller started")
+}
+
+func (r *extentRoller) Stop() {
+	close(r.shutdownC)
+	if !common.AwaitWaitGroup(&r.shutdownWG, time.Second) {
+		r.ll.Error("Timed out waiting for ExtentRoller to stop")
+		return
+	}
+	r.ll.Info("ExtentRoller stopped")
+}
+
+// report records that an extent is loaded on an input host,
+// which makes it a candidate for being rolled over
+func (r *extentRoller) report(dstID string, extID string, timestamp int64) {
+	r.Lock()
+	defer r.Unlock()
+
+	state, ok := r.extents[extID]
+	if !ok {
+		r.extents[extID] = &extentRollState{dstID: dstID, lastReport: timestamp}
+		return
+	}
+	if timestamp > state.lastReport {
+		state.lastReport = timestamp
+	}
+}
+
+// rollDone is called when the ExtentRollEvent of an extent is done,
+// a failed roll is attempted again on the next check
+func (r *extentRoller) rollDone(extID string, err error) {
+	r.Lock()
+	defer r.Unlock()
+	if state, ok := r.extents[extID]; ok && err != nil {
+		state.rolling = false
+	}
+}
+
+func (r *extentRoller) run() {
+	defer r.shutdownWG.Done()
+	ticker := time.NewTicker(extentRollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.check(time.Now().UnixNano())
+		case <-r.shutdownC:
+			return
+		}
+	}
+}
+
+// check compares the open extents of every destination
+// that has reported extents against their limits
+func (r *extentRoller) check(now int64) {
+
+	dsts := make(map[string]struct{})
+
+	r.Lock()
+	for extID, state := range r.extents {
+		if now-state.lastReport >= int64(extentRollStateTTL) {
+			delete(r.extents, extID)
+			continue
+		}
+		dsts[state.dstID] = struct{}{}
+	}
+	r.Unlock()
+
+	for dstID := range dsts {
+		select {
+		case <-r.shutdownC:
+			return
+		default:
+		}
+		r.checkDestination(dstID, now)
+	}
+}
+
+func (r *extentRoller) checkDestination(dstID string, now int64) {
+
+	context := r.context
+	m3Scope := metrics.ExtentRollEventScope
+
+	dstDesc, err := readDestination(context, dstID, m3Scope)
+	if err != nil || validateDstStatus(dstDesc) != nil {
+		return
+	}
+
+	limits := r.getLimits(dstDesc.GetPath())
+	if limits.disabled() {
+		return
+	}
+
+	stats, err := findOpenExtents(context, dstID, m3Scope)
+	if err != nil {
+		return
+	}
+
+	for _, stat := range stats {
+
+		ext := stat.GetExtent()
+		extID := ext.GetExtentUUID()
+
+		if common.IsRemoteZoneExtent(ext.GetOriginZone(), context.localZone) || isExtentBeingSealed(context, extID) {
+			continue
+		}
+
+		age := time.Duration(now - stat.GetCreatedTimeMillis()*int64(time.Millisecond))
+
+		r.Lock()
+		state, ok := r.extents[extID]
+		skip := !ok || state.rolling
+		r.Unlock()
+		if skip {
+			continue
+		}
+
+		var msgs, bytes int64
+		if limits.maxMsgs > 0 || limits.maxBytes > 0 {
+			msgs, bytes = r.getSize(ext)
+		}
+
+		reason := limits.exceeded(msgs, bytes, age)
+		if len(reason) == 0 {
+			continue
+		}
+
+		r.Lock()
+		rolling := !state.rolling && context.eventPipeline.Add(NewExtentRollEvent(dstID, extID, reason))
+		if rolling {
+			state.rolling = true
+		}
+		r.Unlock()
+
+		if rolling {
+			r.ll.WithFields(bark.Fields{
+				common.TagDst: common.FmtDst(dstID),
+				common.TagExt: common.FmtExt(extID),
+				`reason`:      reason,
+				`msgs`:        msgs,
+				`bytes`:       bytes,
+				`ageMins`:     int64(age / time.Minute),
+			}).Info("Rolling extent over")
+		}
+	}
+}
+
+// getSize returns the size of an extent, in messages and bytes, as
+// the largest one reported by its replicas. Replicas whose stats
+// cannot be read are ignored.
+func (r *extentRoller) getSize(ext *shared.Extent) (msgs int64, bytes int64) {
+	for _, storeID := range ext.GetStoreUUIDs() {
+		stats, err := r.context.mm.ReadStoreExtentStats(ext.GetExtentUUID(), storeID)
+		if err != nil {
+			r.context.m3Client.IncCounter(metrics.ExtentRollEventScope, metrics.ControllerErrMetadataReadCounter)
+			continue
+		}
+		for _, rs := range stats.GetReplicaStats() {
+			if rs.GetLastSequence() > msgs {
+				msgs = rs.GetLastSequence()
+			}
+			if rs.GetSizeInBytes() > bytes {
+				bytes = rs.GetSizeInBytes()
+			}
+		}
+	}
+	return msgs, bytes
+}
+
+// getLimits returns the extent limits for the given destination path
+func (r *extentRoller) getLimits(dstPath string) *extentRollLimits {
+
+	result := &extentRollLimits{}
+
+	cfgIface, err := r.context.cfgMgr.Get(common.ControllerServiceName, `*`, `*`, `*`)
+	if err != nil {
+		return result
+	}
+
+	cfg, ok := cfgIface.(ControllerDynamicConfig)
+	if !ok {
+		return result
+	}
+
+	logFn := func() bark.Logger {
+		return r.ll.WithField(common.TagDst, dstPath)
+	}
+
+	result.maxBytes = common.OverrideValueByPrefix(logFn, dstPath, cfg.MaxExtentSizeBytesByPath, 0, `MaxExtentSizeBytesByPath`)
+	result.maxMsgs = common.OverrideValueByPrefix(logFn, dstPath, cfg.MaxExtentSizeMsgsByPath, 0, `MaxExtentSizeMsgsByPath`)
+	result.maxAge = time.Duration(common.OverrideValueByPrefix(logFn, dstPath, cfg.MaxExtentAgeMinsByPath, 0, `MaxExtentAgeMinsByPath`)) * time.Minute
+	return result
+}
+
+func (limits *extentRollLimits) disabled() bool {
+	return limits.maxBytes <= 0 && limits.maxMsgs <= 0 && limits.maxAge <= 0
+}
+
+// exceeded returns the reason for rolling an extent of the
+// given size and age over, or an empty string if the extent
+// is within its limits
+func (limits *extentRollLimits) exceeded(msgs int64, bytes int64, age time.Duration) string {
+	switch {
+	case limits.maxBytes > 0 && bytes >= limits.maxBytes:
+		return extentRollReasonSize
+	case limits.maxMsgs > 0 && msgs >= limits.maxMsgs:
+		return extentRollReasonSize
+	case limits.maxAge > 0 && age >= limits.maxAge:
+		return extentRollReasonAge
+	}
+	return ""
+}
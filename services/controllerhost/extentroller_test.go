@@ -0,0 +1,99 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/uber-common/bark"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+type ExtentRollerSuite struct {
+	*require.Assertions
+	suite.Suite
+	roller *extentRoller
+}
+
+func TestExtentRollerSuite(t *testing.T) {
+	suite.Run(t, new(ExtentRollerSuite))
+}
+
+func (s *ExtentRollerSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+	context := &Context{
+		log:      bark.NewLoggerFromLogrus(log.New()),
+		m3Client: &MockM3Metrics{},
+	}
+	s.roller = newExtentRoller(context)
+}
+
+func (s *ExtentRollerSuite) TestReport() {
+
+	dstID, extID := uuid.New(), uuid.New()
+	now := time.Now().UnixNano()
+
+	s.roller.report(dstID, extID, now)
+	state := s.roller.extents[extID]
+	s.Equal(dstID, state.dstID)
+	s.Equal(now, state.lastReport)
+
+	now += int64(time.Minute)
+	s.roller.report(dstID, extID, now)
+	s.Equal(now, state.lastReport)
+
+	// out of order reports are dropped
+	s.roller.report(dstID, extID, now-int64(time.Second))
+	s.Equal(now, state.lastReport)
+
+	// a failed roll is attempted again, a successful one is not
+	state.rolling = true
+	s.roller.rollDone(extID, nil)
+	s.True(state.rolling)
+	s.roller.rollDone(extID, errRetryable)
+	s.False(state.rolling)
+
+	// extents that are no longer reported are dropped
+	s.roller.check(now + int64(extentRollStateTTL))
+	s.Equal(0, len(s.roller.extents))
+}
+
+func (s *ExtentRollerSuite) TestLimits() {
+
+	limits := &extentRollLimits{}
+	s.True(limits.disabled())
+	s.Equal("", limits.exceeded(1<<40, 1<<40, 24*time.Hour))
+
+	limits = &extentRollLimits{maxBytes: 1000, maxMsgs: 100, maxAge: time.Hour}
+	s.False(limits.disabled())
+	s.Equal("", limits.exceeded(99, 999, time.Hour-time.Second))
+	s.Equal(extentRollReasonSize, limits.exceeded(99, 1000, 0))
+	s.Equal(extentRollReasonSize, limits.exceeded(100, 0, 0))
+	s.Equal(extentRollReasonAge, limits.exceeded(0, 0, time.Hour))
+
+	limits = &extentRollLimits{maxAge: time.Hour}
+	s.Equal("", limits.exceeded(1<<40, 1<<40, time.Minute))
+}
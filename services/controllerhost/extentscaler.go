@@ -0,0 +1,314 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-server/common/metrics"
+	"github.com/uber/cherami-server/services/controllerhost/load"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+)
+
+const (
+	// publishExtentsScaleUpCooldown is the min time between a change
+	// to the number of open extents and a subsequent scale up, this
+	// gives the load reports a chance to reflect the previous change
+	publishExtentsScaleUpCooldown = time.Minute
+	// publishExtentsScaleDownCooldown is the min time between a change
+	// to the number of open extents and a subsequent scale down
+	publishExtentsScaleDownCooldown = 10 * time.Minute
+	// publishExtentsScaleDownRatio is the hysteresis for scaling down,
+	// we only scale down when the destination rate would keep one less
+	// extent below this fraction of the per extent target rate
+	publishExtentsScaleDownRatio = 0.7
+	// publishExtentsScaleStateTTL is the time after which the scaling
+	// state of a destination that's no longer refreshed is dropped
+	publishExtentsScaleStateTTL = time.Hour
+	// defaultTargetMsgsPerSecPerExtent is used when the configured target is invalid
+	defaultTargetMsgsPerSecPerExtent = 1000
+)
+
+type (
+	// publishExtentScaler scales the number of open publish extents of a
+	// destination up and down, based on the destination message rate and
+	// the put latency of its extents, as reported by the input hosts
+	publishExtentScaler struct {
+		sync.Mutex
+		context   *Context
+		dsts      map[string]*publishExtentScaleState
+		lastSweep int64
+	}
+
+	// publishExtentScaleState is the scaling state of a single destination
+	publishExtentScaleState struct {
+		target         int
+		lastChangeTime int64 // unix nanos when the target was last changed
+		lastSeenTime   int64 // unix nanos when the target was last computed
+	}
+
+	// publishExtentScaleConfig is the scaling config for a destination path
+	publishExtentScaleConfig struct {
+		minExtents       int
+		maxExtents       int
+		targetMsgsPerSec int64
+		maxPutLatency    int64 // nanos
+	}
+)
+
+func newPublishExtentScaler(context *Context) *publishExtentScaler {
+	return &publishExtentScaler{
+		context: context,
+		dsts:    make(map[string]*publishExtentScaleState),
+	}
+}
+
+// getConfig returns the scaling config for the given destination path,
+// the returned bool is false if adaptive scaling is disabled for the path
+func (s *publishExtentScaler) getConfig(dstPath string) (*publishExtentScaleConfig, bool) {
+
+	cfgIface, err := s.context.cfgMgr.Get(common.ControllerServiceName, `*`, `*`, `*`)
+	if err != nil {
+		return nil, false
+	}
+
+	cfg, ok := cfgIface.(ControllerDynamicConfig)
+	if !ok {
+		return nil, false
+	}
+
+	logFn := func() bark.Logger {
+		return s.context.log.WithField(common.TagDst, dstPath).WithField(common.TagModule, `extentScaler`)
+	}
+
+	result := &publishExtentScaleConfig{
+		minExtents:       int(common.OverrideValueByPrefix(logFn, dstPath, cfg.MinPublisherExtentsByPath, 1, `MinPublisherExtentsByPath`)),
+		maxExtents:       int(common.OverrideValueByPrefix(logFn, dstPath, cfg.MaxPublisherExtentsByPath, 0, `MaxPublisherExtentsByPath`)),
+		targetMsgsPerSec: common.OverrideValueByPrefix(logFn, dstPath, cfg.TargetMsgsPerSecPerExtentByPath, defaultTargetMsgsPerSecPerExtent, `TargetMsgsPerSecPerExtentByPath`),
+		maxPutLatency:    common.OverrideValueByPrefix(logFn, dstPath, cfg.MaxPutLatencyMillisByPath, 0, `MaxPutLatencyMillisByPath`) * int64(time.Millisecond),
+	}
+
+	if result.maxExtents <= 0 {
+		return nil, false
+	}
+	if result.minExtents < 1 {
+		result.minExtents = 1
+	}
+	if result.maxExtents < result.minExtents {
+		result.maxExtents = result.minExtents
+	}
+	if result.targetMsgsPerSec <= 0 {
+		result.targetMsgsPerSec = defaultTargetMsgsPerSecPerExtent
+	}
+	if result.maxPutLatency <= 0 {
+		result.maxPutLatency = math.MaxInt64
+	}
+
+	return result, true
+}
+
+// nextTarget returns the number of open extents a destination should
+// have, given the current number, the load and the time since the
+// number was last changed. Scaling up is driven by either the message
+// rate or the put latency, scaling down happens one extent at a time.
+func (cfg *publishExtentScaleConfig) nextTarget(current int, msgsInPerSec int64, putLatency int64, sinceLastChange time.Duration) int {
+
+	next := current
+
+	switch {
+	case sinceLastChange >= publishExtentsScaleUpCooldown &&
+		(msgsInPerSec > int64(current)*cfg.targetMsgsPerSec || putLatency > cfg.maxPutLatency):
+		next = int((msgsInPerSec + cfg.targetMsgsPerSec - 1) / cfg.targetMsgsPerSec)
+		if next <= current {
+			next = current + 1
+		}
+	case sinceLastChange >= publishExtentsScaleDownCooldown && current > 1 && putLatency <= cfg.maxPutLatency &&
+		float64(msgsInPerSec) < float64(int64(current-1)*cfg.targetMsgsPerSec)*publishExtentsScaleDownRatio:
+		next = current - 1
+	}
+
+	if next < cfg.minExtents {
+		next = cfg.minExtents
+	}
+	if next > cfg.maxExtents {
+		next = cfg.maxExtents
+	}
+	return next
+}
+
+// dstLoad returns the message rate of the destination summed across the input
+// hosts of the given extents, along with the worst put latency among them. The
+// returned bool is false if there is no rate data available for the destination.
+func (s *publishExtentScaler) dstLoad(dstUUID string, extents []*shared.ExtentStats) (msgsInPerSec int64, putLatency int64, ok bool) {
+
+	loadMetrics := s.context.loadMetrics
+	inputHosts := make(map[string]struct{}, len(extents))
+
+	for _, stat := range extents {
+		ext := stat.GetExtent()
+		hostID := ext.GetInputHostUUID()
+		if _, seen := inputHosts[hostID]; !seen {
+			inputHosts[hostID] = struct{}{}
+			if val, err := loadMetrics.Get(hostID, dstUUID, load.MsgsInPerSec, load.OneMinAvg); err == nil {
+				msgsInPerSec += val
+				ok = true
+			}
+		}
+		if val, err := loadMetrics.Get(hostID, ext.GetExtentUUID(), load.PutMsgLatency, load.OneMinAvg); err == nil {
+			putLatency = common.MaxInt64(putLatency, val)
+		}
+	}
+
+	return
+}
+
+// targetOpenExtents returns the number of open publish extents the given destination
+// should have. The returned bool is false if adaptive scaling is disabled for the
+// destination, in which case the static target passed in is returned unchanged.
+func (s *publishExtentScaler) targetOpenExtents(dstUUID string, dstPath string, openExtents []*shared.ExtentStats, staticTarget int, now int64) (int, bool) {
+
+	cfg, ok := s.getConfig(dstPath)
+	if !ok {
+		s.Lock()
+		delete(s.dsts, dstUUID)
+		s.Unlock()
+		return staticTarget, false
+	}
+
+	msgsInPerSec, putLatency, haveData := s.dstLoad(dstUUID, openExtents)
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.sweep(now)
+
+	state, ok := s.dsts[dstUUID]
+	if !ok {
+		// start from the static target, so that enabling
+		// adaptive scaling doesn't cause a sudden change
+		state = &publishExtentScaleState{target: staticTarget, lastChangeTime: now}
+		s.dsts[dstUUID] = state
+	}
+	state.lastSeenTime = now
+
+	var current, next = state.target, 0
+	if haveData {
+		next = cfg.nextTarget(current, msgsInPerSec, putLatency, time.Duration(now-state.lastChangeTime))
+	} else {
+		next = cfg.nextTarget(current, 0, 0, 0) // only apply the bounds
+	}
+
+	if next == current {
+		return current, true
+	}
+
+	state.target = next
+	state.lastChangeTime = now
+
+	m3Counter := metrics.ControllerPublishExtentsScaleUp
+	if next < current {
+		m3Counter = metrics.ControllerPublishExtentsScaleDown
+	}
+	s.context.m3Client.IncCounter(metrics.RefreshInputHostsForDstScope, m3Counter)
+
+	s.context.log.WithFields(bark.Fields{
+		common.TagDst:    common.FmtDst(dstUUID),
+		common.TagModule: `extentScaler`,
+		`path`:           dstPath,
+		`from`:           current,
+		`to`:             next,
+		`msgsInPerSec`:   msgsInPerSec,
+		`putLatencyMs`:   putLatency / int64(time.Millisecond),
+		`min`:            cfg.minExtents,
+		`max`:            cfg.maxExtents,
+	}).Info("Scaling open publish extents for destination")
+
+	return next, true
+}
+
+// releaseSurplusExtents is called when a destination has more open extents than
+// its target. It keeps the target number of busiest extents, returns them to be
+// handed out to publishers and seals the surplus extents through the regular
+// extent down path. Sealing is what disconnects the publishers still writing to
+// a surplus extent, withholding it from GetInputHosts alone is not enough.
+// Extents created within the scale down cooldown are only withheld and get
+// sealed on a subsequent refresh.
+func (s *publishExtentScaler) releaseSurplusExtents(dstUUID string, extents []*shared.ExtentStats, target int, now int64) []*shared.ExtentStats {
+
+	if len(extents) <= target {
+		return extents
+	}
+
+	rates := make(map[string]int64, len(extents))
+	for _, stat := range extents {
+		ext := stat.GetExtent()
+		rate, err := s.context.loadMetrics.Get(ext.GetInputHostUUID(), ext.GetExtentUUID(), load.MsgsInPerSec, load.OneMinAvg)
+		if err != nil {
+			rate = math.MaxInt64 // no data yet, likely a new extent
+		}
+		rates[ext.GetExtentUUID()] = rate
+	}
+
+	sorter := &extentStatsSorter{
+		stats: extents,
+		cmpFunc: func(a, b *shared.ExtentStats) bool {
+			return rates[a.GetExtent().GetExtentUUID()] > rates[b.GetExtent().GetExtentUUID()]
+		},
+	}
+	sort.Stable(sorter)
+
+	maxCreatedMillis := (now - int64(publishExtentsScaleDownCooldown)) / int64(time.Millisecond)
+
+	for _, stat := range extents[target:] {
+		extID := stat.GetExtent().GetExtentUUID()
+		if stat.GetCreatedTimeMillis() > maxCreatedMillis {
+			continue
+		}
+		s.context.log.WithFields(bark.Fields{
+			common.TagDst:    common.FmtDst(dstUUID),
+			common.TagExt:    common.FmtExt(extID),
+			common.TagModule: `extentScaler`,
+			`msgsInPerSec`:   rates[extID],
+		}).Info("Sealing surplus extent after scaling down open publish extents")
+		s.context.m3Client.IncCounter(metrics.RefreshInputHostsForDstScope, metrics.ControllerSurplusExtentsSealed)
+		addExtentDownEvent(s.context, 0, dstUUID, extID)
+	}
+
+	return extents[:target]
+}
+
+// sweep drops the state of destinations that haven't been refreshed in a while
+func (s *publishExtentScaler) sweep(now int64) {
+	if now-s.lastSweep < int64(publishExtentsScaleStateTTL) {
+		return
+	}
+	for dstUUID, state := range s.dsts {
+		if now-state.lastSeenTime >= int64(publishExtentsScaleStateTTL) {
+			delete(s.dsts, dstUUID)
+		}
+	}
+	s.lastSweep = now
+}
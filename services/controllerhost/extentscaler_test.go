@@ -0,0 +1,151 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-server/services/controllerhost/load"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+)
+
+type ExtentScalerSuite struct {
+	*require.Assertions
+	suite.Suite
+	cfg *publishExtentScaleConfig
+}
+
+func TestExtentScalerSuite(t *testing.T) {
+	suite.Run(t, new(ExtentScalerSuite))
+}
+
+func (s *ExtentScalerSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+	s.cfg = &publishExtentScaleConfig{
+		minExtents:       2,
+		maxExtents:       8,
+		targetMsgsPerSec: 100,
+		maxPutLatency:    int64(50 * time.Millisecond),
+	}
+}
+
+func (s *ExtentScalerSuite) TestNextTargetScaleUp() {
+	latency := int64(10 * time.Millisecond)
+	// rate within capacity of current extents
+	s.Equal(4, s.cfg.nextTarget(4, 400, latency, time.Hour))
+	// rate beyond capacity, jump straight to the needed number of extents
+	s.Equal(6, s.cfg.nextTarget(4, 550, latency, time.Hour))
+	// capped at max
+	s.Equal(8, s.cfg.nextTarget(4, 5000, latency, time.Hour))
+	// latency too high, add one extent even though the rate is fine
+	s.Equal(5, s.cfg.nextTarget(4, 100, int64(80*time.Millisecond), time.Hour))
+	// still in cooldown from the previous change
+	s.Equal(4, s.cfg.nextTarget(4, 5000, latency, publishExtentsScaleUpCooldown/2))
+}
+
+func (s *ExtentScalerSuite) TestNextTargetScaleDown() {
+	latency := int64(10 * time.Millisecond)
+	// within the hysteresis band, don't scale down
+	s.Equal(4, s.cfg.nextTarget(4, 250, latency, time.Hour))
+	// well below the capacity of one less extent, scale down by one
+	s.Equal(3, s.cfg.nextTarget(4, 100, latency, time.Hour))
+	s.Equal(3, s.cfg.nextTarget(4, 0, latency, time.Hour))
+	// never below min
+	s.Equal(2, s.cfg.nextTarget(2, 0, latency, time.Hour))
+	// not while latency is high
+	s.Equal(4, s.cfg.nextTarget(4, 0, int64(80*time.Millisecond), publishExtentsScaleUpCooldown/2))
+	// still in cooldown from the previous change
+	s.Equal(4, s.cfg.nextTarget(4, 0, latency, publishExtentsScaleDownCooldown/2))
+}
+
+func (s *ExtentScalerSuite) TestNextTargetBounds() {
+	// bounds are enforced even when there is no reason to scale
+	s.Equal(2, s.cfg.nextTarget(1, 0, 0, 0))
+	s.Equal(8, s.cfg.nextTarget(12, 0, 0, 0))
+
+	// latency is ignored when no max is configured
+	s.cfg.maxPutLatency = math.MaxInt64
+	s.Equal(4, s.cfg.nextTarget(4, 300, int64(time.Second), time.Hour))
+}
+
+func (s *ExtentScalerSuite) TestSweep() {
+	scaler := newPublishExtentScaler(nil)
+	now := int64(publishExtentsScaleStateTTL) * 2
+	scaler.dsts["stale"] = &publishExtentScaleState{target: 2, lastSeenTime: now - int64(publishExtentsScaleStateTTL)}
+	scaler.dsts["fresh"] = &publishExtentScaleState{target: 2, lastSeenTime: now - int64(time.Minute)}
+	scaler.sweep(now)
+	s.Equal(1, len(scaler.dsts))
+	s.NotNil(scaler.dsts["fresh"])
+}
+
+func (s *ExtentScalerSuite) TestReleaseSurplusExtents() {
+	context := &Context{
+		log:           bark.NewLoggerFromLogrus(log.New()),
+		m3Client:      &MockM3Metrics{},
+		eventPipeline: newTestEventPipeline(),
+		loadMetrics:   load.NewTimeSlotAggregator(common.NewMockTimeSource(), bark.NewLoggerFromLogrus(log.New())),
+	}
+	context.extentSeals.inProgress = common.NewShardedConcurrentMap(1024, common.UUIDHashCode)
+	scaler := newPublishExtentScaler(context)
+
+	now := time.Now().UnixNano()
+	oldMillis := (now - int64(publishExtentsScaleDownCooldown) - int64(time.Minute)) / int64(time.Millisecond)
+	newMillis := now / int64(time.Millisecond)
+
+	dstID := uuid.New()
+	var extents []*shared.ExtentStats
+	for _, created := range []int64{oldMillis, oldMillis, oldMillis, newMillis} {
+		extents = append(extents, &shared.ExtentStats{
+			Extent: &shared.Extent{
+				ExtentUUID:    common.StringPtr(uuid.New()),
+				InputHostUUID: common.StringPtr(uuid.New()),
+			},
+			CreatedTimeMillis: common.Int64Ptr(created),
+		})
+	}
+
+	// no load reported for any extent, so none of them look idle;
+	// the surplus must be sealed anyway for publishers to move off
+	kept := scaler.releaseSurplusExtents(dstID, extents, 1, now)
+	s.Equal(1, len(kept))
+
+	keptID := kept[0].GetExtent().GetExtentUUID()
+	for _, stat := range extents {
+		extID := stat.GetExtent().GetExtentUUID()
+		_, sealing := context.extentSeals.inProgress.Get(extID)
+		switch {
+		case extID == keptID:
+			s.False(sealing, "kept extent must not be sealed")
+		case stat.GetCreatedTimeMillis() == newMillis:
+			s.False(sealing, "extent created within the cooldown must not be sealed yet")
+		default:
+			s.True(sealing, "surplus extent must be sealed")
+		}
+	}
+}
@@ -0,0 +1,680 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/clients/metadata"
+	"github.com/uber/cherami-server/common"
+	m "github.com/uber/cherami-thrift/.generated/go/metadata"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// The controller serves the admin operations that have
+// no counterpart in the thrift APIs as http/json endpoints
+// on the diagnostic port. These are used by cherami-admin.
+const (
+	httpPathDestinationAliases = "/admin/destination/aliases"
+	httpPathDestinationRename  = "/admin/destination/rename"
+	httpPathDestinationSchema  = "/admin/destination/schema"
+	httpPathStoreReReplication = "/admin/storehost/rereplication"
+	httpPathStoreDrain         = "/admin/storehost/drain"
+	httpPathRebalance          = "/admin/rebalance"
+	httpPathLeader             = "/admin/leader"
+	httpPathEvents             = "/admin/events"
+	httpPathPipeline           = "/admin/pipeline"
+	httpPathPipelineAbort      = "/admin/pipeline/abort"
+	httpPathRetention          = "/admin/retention"
+	httpPathCGRetention        = "/admin/consumergroup/retention"
+	httpPathReplicationLag     = "/admin/extent/replicationlag"
+	httpPathReplicaVerifier    = "/admin/extent/verify"
+)
+
+const (
+	httpParamPath    = "path"
+	httpParamAlias   = "alias"
+	httpParamNewPath = "newPath"
+	httpParamVersion = "version"
+	httpParamType    = "type"
+	httpParamSource  = "source"
+	httpParamData    = "data"
+	httpParamUUID    = "uuid"
+	httpParamID      = "id"
+
+	httpParamProtect      = "protect"
+	httpParamInactiveDays = "inactiveDays"
+	httpParamMaxMsgs      = "maxMsgs"
+)
+
+const httpAdminCallTimeout = 10 * time.Second
+
+// RegisterHTTPHandlers registers the controller specific
+// admin http handlers. It implements common.HTTPHandlerRegistrar
+func (mcp *Mcp) RegisterHTTPHandlers(mux *http.ServeMux) {
+	mux.Handle(httpPathDestinationAliases, http.HandlerFunc(mcp.destinationAliases))
+	mux.Handle(httpPathDestinationRename, http.HandlerFunc(mcp.destinationRename))
+	mux.Handle(httpPathDestinationSchema, http.HandlerFunc(mcp.destinationSchema))
+	mux.Handle(httpPathStoreReReplication, http.HandlerFunc(mcp.storeReReplication))
+	mux.Handle(httpPathStoreDrain, http.HandlerFunc(mcp.storeDrain))
+	mux.Handle(httpPathRebalance, http.HandlerFunc(mcp.rebalance))
+	mux.Handle(httpPathLeader, http.HandlerFunc(mcp.leader))
+	mux.Handle(httpPathEvents, http.HandlerFunc(mcp.events))
+	mux.Handle(httpPathPipeline, http.HandlerFunc(mcp.pipeline))
+	mux.Handle(httpPathPipelineAbort, http.HandlerFunc(mcp.pipelineAbort))
+	mux.Handle(httpPathRetention, http.HandlerFunc(mcp.retention))
+	mux.Handle(httpPathCGRetention, http.HandlerFunc(mcp.consumerGroupRetention))
+	mux.Handle(httpPathReplicationLag, http.HandlerFunc(mcp.extentReplicationLag))
+	mux.Handle(httpPathReplicaVerifier, http.HandlerFunc(mcp.extentVerify))
+}
+
+// destinationAliases is the http handler for /admin/destination/aliases.
+// GET with a path lists the aliases of the destination, POST with a path
+// and an alias adds the alias, DELETE with an alias removes it.
+func (mcp *Mcp) destinationAliases(w http.ResponseWriter, r *http.Request) {
+	aliasSvc, ok := mcp.mClient.(metadata.DestinationAliasService)
+	if !ok {
+		writeHTTPError(w, &shared.BadRequestError{Message: "destination aliases are not supported by the metadata service"})
+		return
+	}
+
+	ctx, cancel := newHTTPAdminContext(r)
+	defer cancel()
+
+	path := r.FormValue(httpParamPath)
+	alias := r.FormValue(httpParamAlias)
+
+	switch r.Method {
+	case "GET":
+		aliases, err := aliasSvc.ListDestinationAliases(ctx, path)
+		if err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		writeHTTPResult(w, aliases)
+	case "POST":
+		if err := validateDestinationPath(alias); err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		if err := aliasSvc.CreateDestinationAlias(ctx, path, alias); err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		mcp.context.log.WithFields(bark.Fields{common.TagDstPth: common.FmtDstPth(path), `alias`: alias}).Info(`Destination alias created`)
+		writeHTTPResult(w, alias)
+	case "DELETE":
+		if err := aliasSvc.DeleteDestinationAlias(ctx, alias); err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		mcp.context.log.WithField(`alias`, alias).Info(`Destination alias deleted`)
+		writeHTTPResult(w, alias)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// destinationRename is the http handler for /admin/destination/rename.
+// POST with a path and a newPath renames the destination, keeping the
+// old path as an alias.
+func (mcp *Mcp) destinationRename(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	aliasSvc, ok := mcp.mClient.(metadata.DestinationAliasService)
+	if !ok {
+		writeHTTPError(w, &shared.BadRequestError{Message: "destination rename is not supported by the metadata service"})
+		return
+	}
+
+	ctx, cancel := newHTTPAdminContext(r)
+	defer cancel()
+
+	path := r.FormValue(httpParamPath)
+	newPath := r.FormValue(httpParamNewPath)
+	if err := validateDestinationPath(newPath); err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	desc, err := aliasSvc.RenameDestination(ctx, path, newPath)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	mcp.context.log.WithFields(bark.Fields{
+		common.TagDst:    common.FmtDst(desc.GetDestinationUUID()),
+		common.TagDstPth: common.FmtDstPth(newPath),
+		`oldPath`:        path,
+	}).Info(`Destination renamed`)
+	writeHTTPResult(w, desc)
+}
+
+// destinationSchema is the http handler for /admin/destination/schema.
+// GET with a path lists the versions of the schema of the destination,
+// or returns the given version only. POST with a path, a type, and the
+// data and/or source of the schema adds a new version of the schema.
+func (mcp *Mcp) destinationSchema(w http.ResponseWriter, r *http.Request) {
+	schemaSvc, ok := mcp.mClient.(metadata.DestinationSchemaService)
+	if !ok {
+		writeHTTPError(w, &shared.BadRequestError{Message: "destination schemas are not supported by the metadata service"})
+		return
+	}
+
+	ctx, cancel := newHTTPAdminContext(r)
+	defer cancel()
+
+	path := r.FormValue(httpParamPath)
+	desc, err := mcp.mClient.ReadDestination(ctx, &m.ReadDestinationRequest{Path: common.StringPtr(path)})
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if v := r.FormValue(httpParamVersion); len(v) > 0 {
+			version, errParse := strconv.Atoi(v)
+			if errParse != nil || version <= 0 {
+				writeHTTPError(w, &shared.BadRequestError{Message: fmt.Sprintf("invalid version: %v", v)})
+				return
+			}
+			schema, errRead := schemaSvc.ReadDestinationSchema(ctx, desc.GetDestinationUUID(), int32(version))
+			if errRead != nil {
+				writeHTTPError(w, errRead)
+				return
+			}
+			writeHTTPResult(w, []*shared.SchemaInfo{schema})
+			return
+		}
+		schemas, errList := schemaSvc.ListDestinationSchemas(ctx, desc.GetDestinationUUID())
+		if errList != nil {
+			writeHTTPError(w, errList)
+			return
+		}
+		writeHTTPResult(w, schemas)
+	case "POST":
+		schema := &shared.SchemaInfo{
+			Type:   common.StringPtr(r.FormValue(httpParamType)),
+			Source: common.StringPtr(r.FormValue(httpParamSource)),
+			Data:   []byte(r.FormValue(httpParamData)),
+		}
+		schema, err = schemaSvc.CreateDestinationSchema(ctx, desc.GetDestinationUUID(), schema)
+		if err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		mcp.context.log.WithFields(bark.Fields{
+			common.TagDst:    common.FmtDst(desc.GetDestinationUUID()),
+			common.TagDstPth: common.FmtDstPth(desc.GetPath()),
+			`version`:        schema.GetVersion(),
+		}).Info(`Destination schema created`)
+		writeHTTPResult(w, schema)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// reReplicationReport is the result of /admin/storehost/rereplication
+type reReplicationReport struct {
+	InProgress []*reReplicationStatus `json:"inProgress"`
+	Completed  int64                  `json:"completed"`
+	Failed     int64                  `json:"failed"`
+}
+
+// storeReReplication is the http handler for /admin/storehost/rereplication.
+// GET returns the extents whose replica on a lost store host is being
+// replaced, along with the number of re-replications completed and failed
+// by this controller instance.
+func (mcp *Mcp) storeReReplication(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := &reReplicationReport{
+		InProgress: make([]*reReplicationStatus, 0),
+		Completed:  atomic.LoadInt64(&mcp.context.extentRepairs.completed),
+		Failed:     atomic.LoadInt64(&mcp.context.extentRepairs.failed),
+	}
+
+	iter := mcp.context.extentRepairs.inProgress.Iter()
+	for entry := range iter.Entries() {
+		if status, ok := entry.Value.(*reReplicationStatus); ok {
+			report.InProgress = append(report.InProgress, status)
+		}
+	}
+	iter.Close()
+
+	writeHTTPResult(w, report)
+}
+
+// rebalance is the http handler for /admin/rebalance.
+// GET returns the moves planned by the last rebalancing round,
+// and whether they were made. Only the primary controller runs
+// the rebalancer, other controllers return an empty report.
+func (mcp *Mcp) rebalance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := mcp.context.rebalancer.getReport()
+	if report == nil {
+		report = &rebalanceReport{
+			Mode:  mcp.context.rebalancer.getConfig().mode,
+			Moves: make([]*rebalanceMove, 0),
+		}
+	}
+
+	writeHTTPResult(w, report)
+}
+
+// leader is the http handler for /admin/leader.
+// GET returns, for each of the leases that elect the controller running
+// the background loops, the current leader as seen by this controller and
+// the number of times this controller gained or lost the leadership.
+func (mcp *Mcp) leader(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeHTTPResult(w, mcp.context.leaders.Status())
+}
+
+// storeDrain is the http handler for /admin/storehost/drain.
+// POST with a uuid starts draining the store host, GET returns the
+// progress of the drain and DELETE stops it. The store host must be
+// part of the ring.
+func (mcp *Mcp) storeDrain(w http.ResponseWriter, r *http.Request) {
+	storeUUID := r.FormValue(httpParamUUID)
+	host, err := resolveStoreHost(mcp.context, storeUUID)
+	if err != nil {
+		writeHTTPError(w, &shared.EntityNotExistsError{Message: fmt.Sprintf("store host not found: %v", storeUUID)})
+		return
+	}
+
+	ctx, cancel := newHTTPAdminContext(r)
+	defer cancel()
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		if err = setStoreDraining(ctx, mcp.context, mcp.mClient, host); err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		if !mcp.context.eventPipeline.Add(NewStoreHostDrainEvent(host.UUID)) {
+			// the extent monitor will start the drain on its next scan
+			mcp.context.log.WithField(common.TagStor, common.FmtStor(host.UUID)).Warn("Failed to enqueue StoreHostDrainEvent")
+		}
+	case "DELETE":
+		if err = clearStoreDraining(ctx, mcp.context, mcp.mClient, host); err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	status, err := readStoreDrainStatus(mcp.context, host)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	// the config change takes a config refresh to be seen locally
+	status.Draining = r.Method == "POST" || (r.Method == "GET" && status.Draining)
+	writeHTTPResult(w, status)
+}
+
+// newHTTPAdminContext returns a thrift context that carries the
+// caller info of the http request, for the user operations log
+func newHTTPAdminContext(r *http.Request) (thrift.Context, func()) {
+	ctx, cancel := thrift.NewContext(httpAdminCallTimeout)
+	headers := make(map[string]string)
+	for _, h := range []string{common.CallerUserName, common.CallerHostName, common.CallerServiceName} {
+		if v := r.Header.Get(h); len(v) > 0 {
+			headers[h] = v
+		}
+	}
+	return thrift.WithHeaders(ctx, headers), cancel
+}
+
+func validateDestinationPath(path string) error {
+	if !common.PathRegex.MatchString(path) || common.PathDLQRegex.MatchString(path) {
+		return &shared.BadRequestError{Message: fmt.Sprintf("Path specified is not valid: %v", path)}
+	}
+	return nil
+}
+
+func writeHTTPResult(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func writeHTTPError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch err.(type) {
+	case *shared.BadRequestError:
+		status = http.StatusBadRequest
+	case *shared.EntityNotExistsError:
+		status = http.StatusNotFound
+	case *shared.EntityAlreadyExistsError:
+		status = http.StatusConflict
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, err.Error())
+}
+
+// events lists the events in the event journal on GET and
+// cancels the event given by the uuid parameter on DELETE
+func (mcp *Mcp) events(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "DELETE":
+		eventID := r.FormValue(httpParamUUID)
+		if len(eventID) == 0 {
+			writeHTTPError(w, &shared.BadRequestError{Message: "missing event uuid"})
+			return
+		}
+		if err := mcp.context.eventJournal.cancel(eventID); err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	events, err := mcp.context.eventJournal.list()
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	writeHTTPResult(w, events)
+}
+
+// pipeline is the read-only http handler for /admin/pipeline, it
+// returns the in-flight events of the event pipeline and the locks
+// held by the controller
+func (mcp *Mcp) pipeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeHTTPResult(w, mcp.context.eventPipeline.Status())
+}
+
+// pipelineAbort is the http handler for /admin/pipeline/abort.
+// POST with the id and the type of an in-flight event aborts it,
+// the type guards against aborting an event whose id was misread.
+// Only events that have been in the pipeline for a while can be
+// aborted.
+func (mcp *Mcp) pipelineAbort(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.FormValue(httpParamID), 10, 64)
+	if err != nil {
+		writeHTTPError(w, &shared.BadRequestError{Message: fmt.Sprintf("invalid event id: %v", r.FormValue(httpParamID))})
+		return
+	}
+	eventType := r.FormValue(httpParamType)
+
+	if err = mcp.context.eventPipeline.Abort(id, eventType); err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	mcp.context.log.WithFields(bark.Fields{
+		`eventID`:   id,
+		`eventType`: eventType,
+	}).Warn("Event aborted through the admin api")
+
+	writeHTTPResult(w, mcp.context.eventPipeline.Status())
+}
+
+// retention is the read-only http handler for /admin/retention.
+// GET with the uuid or the path of a destination computes the
+// retention for each of its extents, without acting on it, and
+// returns it along with the last decision taken on the extent
+func (mcp *Mcp) retention(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	dstUUID := r.FormValue(httpParamUUID)
+	if path := r.FormValue(httpParamPath); len(dstUUID) == 0 && len(path) > 0 {
+		ctx, cancel := newHTTPAdminContext(r)
+		defer cancel()
+
+		desc, err := mcp.mClient.ReadDestination(ctx, &m.ReadDestinationRequest{Path: common.StringPtr(path)})
+		if err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		dstUUID = desc.GetDestinationUUID()
+	}
+
+	if len(dstUUID) == 0 {
+		writeHTTPError(w, &shared.BadRequestError{Message: "missing destination uuid or path"})
+		return
+	}
+
+	extents, err := mcp.context.retMgr.explain(dstUUID)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	writeHTTPResult(w, extents)
+}
+
+// cgRetentionResult is the retention override of a consumer group,
+// as returned by /admin/consumergroup/retention
+type cgRetentionResult struct {
+	ConsumerGroupUUID string    `json:"consumerGroupUUID"`
+	Protect           bool      `json:"protect"`
+	InactiveDays      int64     `json:"excludeAfterInactiveDays,omitempty"`
+	LastAckTime       time.Time `json:"lastAckTime"`
+	UpdatedTime       time.Time `json:"updatedTime,omitempty"`
+}
+
+// consumerGroupRetention is the http handler for /admin/consumergroup/retention.
+// GET with the uuid of a consumer group returns its retention override and the
+// time it last acked, POST with the uuid and either protect=true or inactiveDays
+// sets the override; protect=false and inactiveDays=0 remove it.
+func (mcp *Mcp) consumerGroupRetention(w http.ResponseWriter, r *http.Request) {
+	cgRetentionSvc, ok := mcp.mClient.(metadata.ConsumerGroupRetentionService)
+	if !ok {
+		writeHTTPError(w, &shared.BadRequestError{Message: "consumer group retention overrides are not supported by the metadata service"})
+		return
+	}
+
+	ctx, cancel := newHTTPAdminContext(r)
+	defer cancel()
+
+	cgUUID := r.FormValue(httpParamUUID)
+	if !common.UUIDRegex.MatchString(cgUUID) {
+		writeHTTPError(w, &shared.BadRequestError{Message: fmt.Sprintf("invalid consumer group uuid: %v", cgUUID)})
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		retention := &metadata.ConsumerGroupRetention{
+			ConsumerGroupUUID: cgUUID,
+			Protect:           r.FormValue(httpParamProtect) == "true",
+			UpdatedTime:       time.Now(),
+		}
+		if v := r.FormValue(httpParamInactiveDays); len(v) > 0 {
+			days, err := strconv.Atoi(v)
+			if err != nil || days < 0 {
+				writeHTTPError(w, &shared.BadRequestError{Message: fmt.Sprintf("invalid number of days: %v", v)})
+				return
+			}
+			retention.ExcludeAfterInactive = time.Duration(days) * 24 * time.Hour
+		}
+		if err := cgRetentionSvc.SetConsumerGroupRetention(ctx, retention); err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		mcp.context.log.WithFields(bark.Fields{
+			common.TagCnsm:         common.FmtCnsm(cgUUID),
+			`protect`:              retention.Protect,
+			`excludeAfterInactive`: retention.ExcludeAfterInactive,
+		}).Info(`Consumer group retention override set`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	result := &cgRetentionResult{ConsumerGroupUUID: cgUUID}
+
+	retention, err := cgRetentionSvc.ReadConsumerGroupRetention(ctx, cgUUID)
+	switch err.(type) {
+	case nil:
+		result.Protect = retention.Protect
+		result.InactiveDays = int64(retention.ExcludeAfterInactive / (24 * time.Hour))
+		result.UpdatedTime = retention.UpdatedTime
+	case *shared.EntityNotExistsError:
+		// no override
+	default:
+		writeHTTPError(w, err)
+		return
+	}
+
+	if result.LastAckTime, err = cgRetentionSvc.ReadConsumerGroupLastAckTime(ctx, cgUUID); err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	writeHTTPResult(w, result)
+}
+
+// extentReplicationLag is the http handler for /admin/extent/replicationlag.
+// GET with the uuid of an extent returns the replication lag of each of its
+// replicas that reported one recently. Load reports go to the primary
+// controller, other controllers return an empty list.
+func (mcp *Mcp) extentReplicationLag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	extUUID := r.FormValue(httpParamUUID)
+	if !common.UUIDRegex.MatchString(extUUID) {
+		writeHTTPError(w, &shared.BadRequestError{Message: fmt.Sprintf("invalid extent uuid: %v", extUUID)})
+		return
+	}
+
+	ctx, cancel := newHTTPAdminContext(r)
+	defer cancel()
+
+	stats, err := mcp.mClient.ReadExtentStats(ctx, &m.ReadExtentStatsRequest{ExtentUUID: common.StringPtr(extUUID)})
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	result := getExtentReplicationLag(mcp.context, stats.GetExtentStats().GetExtent())
+	if result == nil {
+		result = make([]*replicaReplicationLag, 0)
+	}
+	writeHTTPResult(w, result)
+}
+
+// extentVerify is the http handler for /admin/extent/verify.
+// GET without a uuid returns the outcome of the last verification
+// round. GET with the uuid of a sealed extent compares its replicas
+// right away, POST does the same and also starts replacing a replica
+// that differs from the majority. maxMsgs caps the number of messages
+// compared, the extent is compared in full by default.
+func (mcp *Mcp) extentVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	extUUID := r.FormValue(httpParamUUID)
+	if len(extUUID) == 0 && r.Method == "GET" {
+		report := mcp.context.replicaVerifier.getReport()
+		if report == nil {
+			report = &replicaVerifyReport{
+				Mode:    mcp.context.replicaVerifier.getConfig().mode,
+				Extents: make([]*extentVerification, 0),
+			}
+		}
+		writeHTTPResult(w, report)
+		return
+	}
+
+	if !common.UUIDRegex.MatchString(extUUID) {
+		writeHTTPError(w, &shared.BadRequestError{Message: fmt.Sprintf("invalid extent uuid: %v", extUUID)})
+		return
+	}
+
+	var maxMsgs int64
+	if v := r.FormValue(httpParamMaxMsgs); len(v) > 0 {
+		var err error
+		if maxMsgs, err = strconv.ParseInt(v, 10, 64); err != nil || maxMsgs < 0 {
+			writeHTTPError(w, &shared.BadRequestError{Message: fmt.Sprintf("invalid number of messages: %v", v)})
+			return
+		}
+	}
+
+	ctx, cancel := newHTTPAdminContext(r)
+	defer cancel()
+
+	stats, err := mcp.mClient.ReadExtentStats(ctx, &m.ReadExtentStatsRequest{ExtentUUID: common.StringPtr(extUUID)})
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	extStats := stats.GetExtentStats()
+	if extStats.GetStatus() != shared.ExtentStatus_SEALED {
+		writeHTTPError(w, &shared.BadRequestError{Message: fmt.Sprintf("extent is not sealed: %v", extStats.GetStatus())})
+		return
+	}
+
+	writeHTTPResult(w, mcp.context.replicaVerifier.verifyExtent(extStats, maxMsgs, r.Method == "POST"))
+}
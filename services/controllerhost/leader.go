@@ -0,0 +1,341 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/clients/metadata"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-server/common/metrics"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+type (
+	// leaderElection elects the controller that runs each of the
+	// background loops that must only run once in the cluster. The
+	// leader holds a lease in the metadata store, that it renews
+	// periodically and that expires if the leader goes away. When the
+	// metadata client doesn't support leases, the leader is the owner
+	// of a well known key in the ringpop ring, which can be ambiguous
+	// while the ring changes.
+	leaderElection struct {
+		sync.RWMutex
+		started    int32
+		context    *Context
+		leases     metadata.LeaseService
+		ll         bark.Logger
+		states     map[string]*leadershipState
+		shutdownC  chan struct{}
+		shutdownWG sync.WaitGroup
+	}
+
+	// leadershipState is the leadership of this controller for a lease
+	leadershipState struct {
+		isLeader    bool
+		leader      string
+		validUntil  time.Time
+		leaderSince time.Time
+		transitions int64
+		// term is bumped every time this controller becomes the
+		// leader, work started in a term must not go on in another
+		term int64
+	}
+
+	// leadershipStatus is the leadership of a lease, as reported
+	// by the admin endpoint
+	leadershipStatus struct {
+		Name        string    `json:"name"`
+		Backend     string    `json:"backend"`
+		Leader      string    `json:"leader"`
+		IsLeader    bool      `json:"isLeader"`
+		LeaderSince time.Time `json:"leaderSince"`
+		Transitions int64     `json:"transitions"`
+	}
+)
+
+const (
+	// leaseExtentMonitor is held by the controller that runs the
+	// extent monitor, along with the queue depth calculator, the
+	// dlq monitor, the store drains and the rebalancer
+	leaseExtentMonitor = "extent-monitor"
+	// leaseRetentionMgr is held by the controller that runs the
+	// retention manager
+	leaseRetentionMgr = "retention-manager"
+
+	leaderBackendLease   = "lease"
+	leaderBackendRingpop = "ringpop"
+)
+
+var (
+	// leaseTTL is how long a lease outlives its last renewal
+	leaseTTL = 30 * time.Second
+	// leaseRenewInterval is the time between attempts at acquiring or
+	// renewing the leases. The leader gives up the leadership on its own
+	// leaseTTL-leaseRenewInterval after the last renewal, so that it stops
+	// before the lease can expire and be taken by another controller.
+	leaseRenewInterval = 10 * time.Second
+
+	// ringpop keys used when leases are not supported, these
+	// are the keys that were used before leases were added
+	leaseRingpopKeys = map[string]string{
+		leaseExtentMonitor: common.ControllerServiceName,
+		leaseRetentionMgr:  "retention-manager",
+	}
+)
+
+// newLeaderElection creates and returns a new instance of leaderElection
+func newLeaderElection(context *Context, leases metadata.LeaseService) *leaderElection {
+	states := make(map[string]*leadershipState, len(leaseRingpopKeys))
+	for name := range leaseRingpopKeys {
+		states[name] = &leadershipState{}
+	}
+	return &leaderElection{
+		context:   context,
+		leases:    leases,
+		ll:        context.log.WithField(common.TagModule, `leaderElection`),
+		states:    states,
+		shutdownC: make(chan struct{}),
+	}
+}
+
+func (e *leaderElection) Start() {
+	if !atomic.CompareAndSwapInt32(&e.started, 0, 1) {
+		return
+	}
+	e.refresh()
+	e.shutdownWG.Add(1)
+	go e.run()
+	e.ll.WithField(`backend`, e.backend()).Info("LeaderElection started")
+}
+
+// Stop stops the election and gives up the leases held by
+// this controller, so that another controller can take over
+// without waiting for them to expire
+func (e *leaderElection) Stop() {
+	close(e.shutdownC)
+	if !common.AwaitWaitGroup(&e.shutdownWG, time.Second) {
+		e.ll.Error("Timed out waiting for LeaderElection to stop")
+		return
+	}
+
+	e.Lock()
+	defer e.Unlock()
+	for name, state := range e.states {
+		if !state.isLeader {
+			continue
+		}
+		e.setLeadership(name, state, false, "", time.Time{})
+		if e.leases == nil {
+			continue
+		}
+		ctx, cancel := thrift.NewContext(thriftCallTimeout)
+		if err := e.leases.ReleaseLease(ctx, name, e.context.hostID); err != nil {
+			e.ll.WithFields(bark.Fields{
+				common.TagErr: err,
+				`lease`:       name,
+			}).Warn("Failed to release lease")
+		}
+		cancel()
+	}
+	e.ll.Info("LeaderElection stopped")
+}
+
+// IsLeader returns true if this controller is the leader for
+// the given lease
+func (e *leaderElection) IsLeader(name string) bool {
+	if e.leases == nil {
+		// ringpop ownership is always current, check it directly
+		return e.isRingpopOwner(name)
+	}
+	e.RLock()
+	defer e.RUnlock()
+	state, ok := e.states[name]
+	return ok && state.isLeader && time.Now().Before(state.validUntil)
+}
+
+// Term returns the current leadership term of this controller for
+// the given lease; false if this controller is not the leader
+func (e *leaderElection) Term(name string) (int64, bool) {
+	if !e.IsLeader(name) {
+		return 0, false
+	}
+	e.RLock()
+	defer e.RUnlock()
+	state, ok := e.states[name]
+	if !ok {
+		return 0, false
+	}
+	return state.term, true
+}
+
+// IsLeaderForTerm returns true if this controller is the leader for
+// the given lease, and has not lost the leadership since the term
+// started. Long running work checks it before every side effect, so
+// that it stops when another controller could have taken over, even
+// if this controller became the leader again in the meantime.
+func (e *leaderElection) IsLeaderForTerm(name string, term int64) bool {
+	current, ok := e.Term(name)
+	return ok && current == term
+}
+
+// Status returns the leadership of every lease
+func (e *leaderElection) Status() []*leadershipStatus {
+	e.RLock()
+	defer e.RUnlock()
+	result := make([]*leadershipStatus, 0, len(e.states))
+	for name, state := range e.states {
+		result = append(result, &leadershipStatus{
+			Name:        name,
+			Backend:     e.backend(),
+			Leader:      state.leader,
+			IsLeader:    state.isLeader,
+			LeaderSince: state.leaderSince,
+			Transitions: state.transitions,
+		})
+	}
+	return result
+}
+
+func (e *leaderElection) backend() string {
+	if e.leases == nil {
+		return leaderBackendRingpop
+	}
+	return leaderBackendLease
+}
+
+func (e *leaderElection) run() {
+	defer e.shutdownWG.Done()
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.refresh()
+		case <-e.shutdownC:
+			return
+		}
+	}
+}
+
+// refresh acquires or renews every lease and records
+// the leadership changes
+func (e *leaderElection) refresh() {
+
+	context := e.context
+	nLeader := 0
+
+	for name := range leaseRingpopKeys {
+
+		start := time.Now()
+		isLeader, leader, err := e.elect(name)
+
+		e.Lock()
+		state := e.states[name]
+		if err != nil {
+			context.m3Client.IncCounter(metrics.LeaderElectionScope, metrics.ControllerFailures)
+			e.ll.WithFields(bark.Fields{
+				common.TagErr: err,
+				`lease`:       name,
+			}).Warn("Failed to acquire or renew lease")
+			// keep the leadership until the lease could have expired
+			isLeader = state.isLeader && start.Before(state.validUntil)
+			leader = state.leader
+		}
+		validUntil := state.validUntil
+		if err == nil && isLeader {
+			validUntil = start.Add(leaseTTL - leaseRenewInterval)
+		}
+		e.setLeadership(name, state, isLeader, leader, validUntil)
+		if state.isLeader {
+			nLeader++
+		}
+		e.Unlock()
+	}
+
+	context.m3Client.UpdateGauge(metrics.LeaderElectionScope, metrics.ControllerLeasesHeld, int64(nLeader))
+}
+
+// elect returns true if this controller is the leader
+// for the given lease, along with the current leader
+func (e *leaderElection) elect(name string) (bool, string, error) {
+
+	hostID := e.context.hostID
+
+	if e.leases == nil {
+		hi, err := e.context.rpm.FindHostForKey(common.ControllerServiceName, leaseRingpopKeys[name])
+		if err != nil {
+			return false, "", err
+		}
+		return hi.UUID == hostID, hi.UUID, nil
+	}
+
+	ctx, cancel := thrift.NewContext(thriftCallTimeout)
+	defer cancel()
+	lease, err := e.leases.AcquireLease(ctx, name, hostID, leaseTTL)
+	if err != nil {
+		return false, "", err
+	}
+	return lease.Owner == hostID, lease.Owner, nil
+}
+
+// setLeadership updates the state of a lease and records the
+// leadership changes, must be called with the lock held
+func (e *leaderElection) setLeadership(name string, state *leadershipState, isLeader bool, leader string, validUntil time.Time) {
+
+	state.leader = leader
+	state.validUntil = validUntil
+
+	if state.isLeader == isLeader {
+		return
+	}
+
+	state.isLeader = isLeader
+	state.transitions++
+
+	lg := e.ll.WithFields(bark.Fields{
+		`lease`:  name,
+		`leader`: leader,
+	})
+
+	if isLeader {
+		state.term++
+		state.leaderSince = time.Now()
+		e.context.m3Client.IncCounter(metrics.LeaderElectionScope, metrics.ControllerLeadershipAcquired)
+		lg.Info("Controller became the leader")
+		return
+	}
+
+	state.leaderSince = time.Time{}
+	e.context.m3Client.IncCounter(metrics.LeaderElectionScope, metrics.ControllerLeadershipLost)
+	lg.Info("Controller lost the leadership")
+}
+
+func (e *leaderElection) isRingpopOwner(name string) bool {
+	hi, err := e.context.rpm.FindHostForKey(common.ControllerServiceName, leaseRingpopKeys[name])
+	if err != nil {
+		return false
+	}
+	return hi.UUID == e.context.hostID
+}
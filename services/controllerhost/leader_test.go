@@ -0,0 +1,226 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/clients/metadata"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/tchannel-go/thrift"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+type (
+	LeaderElectionSuite struct {
+		*require.Assertions
+		suite.Suite
+		leases *mockLeaseService
+	}
+
+	// mockLeaseService is an in memory lease service, leases
+	// never expire unless the expired flag is set
+	mockLeaseService struct {
+		sync.Mutex
+		owners  map[string]string
+		expired bool
+		err     error
+	}
+)
+
+func TestLeaderElectionSuite(t *testing.T) {
+	suite.Run(t, new(LeaderElectionSuite))
+}
+
+func (s *LeaderElectionSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+	s.leases = &mockLeaseService{owners: make(map[string]string)}
+}
+
+func (s *LeaderElectionSuite) newElection(leases metadata.LeaseService) *leaderElection {
+	context := &Context{
+		hostID:   uuid.New(),
+		log:      bark.NewLoggerFromLogrus(log.New()),
+		m3Client: &MockM3Metrics{},
+	}
+	return newLeaderElection(context, leases)
+}
+
+func (s *LeaderElectionSuite) TestLeaseElection() {
+
+	e1 := s.newElection(s.leases)
+	e2 := s.newElection(s.leases)
+
+	e1.refresh()
+	e2.refresh()
+
+	s.True(e1.IsLeader(leaseExtentMonitor))
+	s.True(e1.IsLeader(leaseRetentionMgr))
+	s.False(e2.IsLeader(leaseExtentMonitor))
+	s.False(e2.IsLeader(leaseRetentionMgr))
+
+	for _, status := range e2.Status() {
+		s.Equal(leaderBackendLease, status.Backend)
+		s.Equal(e1.context.hostID, status.Leader)
+		s.False(status.IsLeader)
+	}
+
+	// the leader keeps the leadership while it can't renew the
+	// lease, until the lease could have been taken by someone else
+	s.leases.err = errors.New("metadata store unavailable")
+	e1.refresh()
+	s.True(e1.IsLeader(leaseExtentMonitor))
+	e1.Lock()
+	for _, state := range e1.states {
+		state.validUntil = time.Now().Add(-time.Second)
+	}
+	e1.Unlock()
+	s.False(e1.IsLeader(leaseExtentMonitor))
+	e1.refresh()
+	s.False(e1.IsLeader(leaseExtentMonitor))
+
+	// lease expired, the other controller takes over
+	s.leases.err = nil
+	s.leases.expired = true
+	e2.refresh()
+	s.leases.expired = false
+	e1.refresh()
+	s.True(e2.IsLeader(leaseExtentMonitor))
+	s.False(e1.IsLeader(leaseExtentMonitor))
+
+	for _, status := range e1.Status() {
+		s.Equal(int64(2), status.Transitions)
+		s.Equal(e2.context.hostID, status.Leader)
+	}
+}
+
+func (s *LeaderElectionSuite) TestLeadershipTerm() {
+
+	e1 := s.newElection(s.leases)
+	e2 := s.newElection(s.leases)
+
+	e1.refresh()
+	e2.refresh()
+
+	term, ok := e1.Term(leaseExtentMonitor)
+	s.True(ok)
+	s.True(e1.IsLeaderForTerm(leaseExtentMonitor, term))
+	_, ok = e2.Term(leaseExtentMonitor)
+	s.False(ok)
+
+	// renewing the lease keeps the term
+	e1.refresh()
+	s.True(e1.IsLeaderForTerm(leaseExtentMonitor, term))
+
+	// lose the lease and get it back, work started
+	// in the old term must not go on in the new one
+	s.leases.expired = true
+	e2.refresh()
+	s.leases.expired = false
+	e1.refresh()
+	s.False(e1.IsLeaderForTerm(leaseExtentMonitor, term))
+	s.True(e2.IsLeader(leaseExtentMonitor))
+
+	s.leases.expired = true
+	e1.refresh()
+	s.leases.expired = false
+
+	newTerm, ok := e1.Term(leaseExtentMonitor)
+	s.True(ok)
+	s.True(newTerm > term)
+	s.False(e1.IsLeaderForTerm(leaseExtentMonitor, term))
+	s.True(e1.IsLeaderForTerm(leaseExtentMonitor, newTerm))
+}
+
+func (s *LeaderElectionSuite) TestLeaseReleasedOnStop() {
+
+	e1 := s.newElection(s.leases)
+	e2 := s.newElection(s.leases)
+
+	e1.Start()
+	e2.Start()
+	s.True(e1.IsLeader(leaseExtentMonitor))
+	s.False(e2.IsLeader(leaseExtentMonitor))
+
+	e1.Stop()
+	s.False(e1.IsLeader(leaseExtentMonitor))
+
+	e2.refresh()
+	s.True(e2.IsLeader(leaseExtentMonitor))
+	e2.Stop()
+	s.Equal(0, len(s.leases.owners))
+}
+
+func (s *LeaderElectionSuite) TestRingpopFallback() {
+
+	e1 := s.newElection(nil)
+	e2 := s.newElection(nil)
+
+	rpm := common.NewMockRingpopMonitor()
+	rpm.Add(common.ControllerServiceName, e1.context.hostID, "127.0.0.1:1")
+	e1.context.rpm = rpm
+	e2.context.rpm = rpm
+
+	s.True(e1.IsLeader(leaseExtentMonitor))
+	s.False(e2.IsLeader(leaseExtentMonitor))
+
+	e2.refresh()
+	for _, status := range e2.Status() {
+		s.Equal(leaderBackendRingpop, status.Backend)
+		s.Equal(e1.context.hostID, status.Leader)
+	}
+}
+
+func (m *mockLeaseService) AcquireLease(ctx thrift.Context, name string, owner string, ttl time.Duration) (*metadata.Lease, error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	if current, ok := m.owners[name]; ok && !m.expired {
+		return &metadata.Lease{Name: name, Owner: current}, nil
+	}
+	m.owners[name] = owner
+	return &metadata.Lease{Name: name, Owner: owner}, nil
+}
+
+func (m *mockLeaseService) ReleaseLease(ctx thrift.Context, name string, owner string) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.owners[name] == owner {
+		delete(m.owners, name)
+	}
+	return nil
+}
+
+func (m *mockLeaseService) ReadLease(ctx thrift.Context, name string) (*metadata.Lease, error) {
+	m.Lock()
+	defer m.Unlock()
+	return &metadata.Lease{Name: name, Owner: m.owners[name]}, nil
+}
@@ -97,9 +97,18 @@ const (
 	BytesInPerSec = "bytesInPerSec"
 	// BytesOutPerSec refers to outgoing messages per sec counter
 	BytesOutPerSec = "bytesOutPerSec"
+	// PutMsgLatency refers to the average put message
+	// latency of an extent in nanoseconds
+	PutMsgLatency = "putMsgLatency"
 	// SmartRetryOn is a 0/1 counter that indicates if a
 	// consumer group has smart retry on or off
 	SmartRetryOn = "smartRetryOn"
+	// ReplicationLagMsgs is a guage that refers to how many
+	// messages an extent replica is behind its replication source
+	ReplicationLagMsgs = "replicationLagMsgs"
+	// ReplicationLagSecs is a guage that refers to how many
+	// seconds an extent replica is behind its replication source
+	ReplicationLagSecs = "replicationLagSecs"
 )
 
 // ErrNoData is returned when there is not enough
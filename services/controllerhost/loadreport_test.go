@@ -35,6 +35,7 @@ import (
 	"github.com/uber/cherami-server/services/controllerhost/load"
 	c "github.com/uber/cherami-thrift/.generated/go/controller"
 	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
 )
 
 type LoadReportAPISuite struct {
@@ -418,3 +419,43 @@ func (s *LoadReportAPISuite) TestReportStoreExtentMetric() {
 		s.Equal(shared.ExtentStatus_SEALED, entry.status, "ReportStoreExtentMetric reported wrong extent status")
 	}
 }
+
+func (s *LoadReportAPISuite) TestReportStoreExtentMetricReplicationLag() {
+
+	status := shared.ExtentStatus(shared.ExtentStatus_OPEN)
+	extentID := uuid.New()
+	hostIDs := []string{uuid.New(), uuid.New()}
+
+	ctx, cancel := thrift.NewContext(time.Second)
+	defer cancel()
+
+	req := &c.ReportStoreExtentMetricRequest{
+		StoreId:    common.StringPtr(hostIDs[0]),
+		ExtentUUID: common.StringPtr(extentID),
+		Timestamp:  common.Int64Ptr(s.clock.Now().UnixNano()),
+		Metrics:    &c.StoreExtentMetrics{ExtentStatus: &status},
+	}
+	err := s.mcp.ReportStoreExtentMetric(common.WithReplicationLag(ctx, &common.ReplicationLag{Messages: 500, Seconds: 25}), req)
+	s.Nil(err, "ReportStoreExtentMetric failed with error")
+
+	// the second replica is not replicating
+	req.StoreId = common.StringPtr(hostIDs[1])
+	err = s.mcp.ReportStoreExtentMetric(ctx, req)
+	s.Nil(err, "ReportStoreExtentMetric failed with error")
+
+	s.awaitAsyncAggregation()
+	s.clock.Advance(time.Minute)
+
+	extent := &shared.Extent{
+		ExtentUUID: common.StringPtr(extentID),
+		StoreUUIDs: hostIDs,
+		OriginZone: common.StringPtr("zone2"),
+	}
+	replicas := getExtentReplicationLag(s.mcp.context, extent)
+	s.Equal(1, len(replicas), "Wrong number of replicas with a replication lag")
+	s.Equal(&replicaReplicationLag{StoreUUID: hostIDs[0], Zone: "zone2", Messages: 500, Seconds: 25}, replicas[0])
+
+	ctx = thrift.WithHeaders(ctx, map[string]string{"cherami-replication-lag-msgs": "many"})
+	err = s.mcp.ReportStoreExtentMetric(ctx, req)
+	s.IsType(&shared.BadRequestError{}, err, "ReportStoreExtentMetric accepted a malformed replication lag")
+}
@@ -56,14 +56,30 @@ type (
 		// keys currently held by the
 		// lockmgr
 		Size() int64
+		// Status returns the keys that
+		// are currently locked, along
+		// with their waiters
+		Status() []*LockStatus
+	}
+
+	// LockStatus describes a lock that is
+	// currently held by the LockMgr
+	LockStatus struct {
+		Key      string `json:"key"`
+		Locked   bool   `json:"locked"`
+		HeldSecs int64  `json:"heldSecs"`
+		Waiting  int    `json:"waiting"`
+		WaitSecs int64  `json:"waitSecs"`
 	}
 
 	// lockEntry is the actual lock
 	// corresponding to a key
 	lockEntry struct {
-		state    int           // locked or unlocked
-		nWaiting int           // number of go-routines waiting for lock
-		sigCh    chan struct{} // only valid when state is locked
+		state     int           // locked or unlocked
+		nWaiting  int           // number of go-routines waiting for lock
+		sigCh     chan struct{} // only valid when state is locked
+		lockedAt  time.Time     // when the lock was last acquired
+		waitSince time.Time     // when the lock last acquired waiters
 	}
 
 	hashBucket struct {
@@ -133,6 +149,7 @@ func (lockMgr *lockMgrImpl) TryLock(key string, timeout time.Duration) bool {
 	entry := lockMgr.getOrCreateEntry(bucket, key)
 	if entry.state == lockStateUnlocked && entry.nWaiting == 0 {
 		entry.state = lockStateLocked
+		entry.lockedAt = time.Now()
 		bucket.Unlock()
 		return true
 	}
@@ -157,8 +174,14 @@ func (lockMgr *lockMgrImpl) TryLock(key string, timeout time.Duration) bool {
 	// out. If not, we got woken up through
 	// sigCh or we timed out at the same
 	// instant an UnLock happened.
+	if entry.nWaiting > 0 {
+		// the remaining waiters are reported
+		// as waiting from now on
+		entry.waitSince = time.Now()
+	}
 	if entry.state == lockStateUnlocked {
 		entry.state = lockStateLocked
+		entry.lockedAt = time.Now()
 		status = true
 		// Since we may have timed out
 		// at the exact same instant a
@@ -209,6 +232,32 @@ func (lockMgr *lockMgrImpl) Size() int64 {
 	return atomic.LoadInt64(&lockMgr.size)
 }
 
+// Status returns the locks that are currently held
+func (lockMgr *lockMgrImpl) Status() []*LockStatus {
+	var result []*LockStatus
+	now := time.Now()
+	for i := range lockMgr.buckets {
+		bucket := &lockMgr.buckets[i]
+		bucket.Lock()
+		for key, entry := range bucket.locks {
+			status := &LockStatus{
+				Key:     key,
+				Locked:  entry.state == lockStateLocked,
+				Waiting: entry.nWaiting,
+			}
+			if status.Locked {
+				status.HeldSecs = int64(now.Sub(entry.lockedAt) / time.Second)
+			}
+			if entry.nWaiting > 0 {
+				status.WaitSecs = int64(now.Sub(entry.waitSince) / time.Second)
+			}
+			result = append(result, status)
+		}
+		bucket.Unlock()
+	}
+	return result
+}
+
 func (lockMgr *lockMgrImpl) getOrCreateEntry(bucket *hashBucket, key string) *lockEntry {
 	lockMgr.lazyInitBucket(bucket)
 	entry, ok := bucket.locks[key]
@@ -236,6 +285,9 @@ func (lockMgr *lockMgrImpl) sleepOnWaitQ(entry *lockEntry, timeout time.Duration
 }
 
 func (lockMgr *lockMgrImpl) addToWaitQ(entry *lockEntry) {
+	if entry.nWaiting == 0 {
+		entry.waitSince = time.Now()
+	}
 	entry.nWaiting++
 	if entry.sigCh == nil {
 		entry.sigCh = make(chan struct{}, 1)
@@ -165,3 +165,35 @@ func (s *LockMgrSuite) TestTimeoutRace() {
 	lockMgr.Unlock(key)
 	wg.Wait()
 }
+
+func (s *LockMgrSuite) TestStatus() {
+	lockMgr, err := NewLockMgr(16, common.UUIDHashCode, common.GetDefaultLogger())
+	s.Nil(err, "Failed to create LockMgr")
+	s.Equal(0, len(lockMgr.Status()))
+
+	key := uuid.New()
+	s.True(lockMgr.TryLock(key, 0))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if lockMgr.TryLock(key, time.Minute) {
+			lockMgr.Unlock(key)
+		}
+	}()
+
+	cond := func() bool {
+		status := lockMgr.Status()
+		return len(status) == 1 && status[0].Waiting == 1
+	}
+	s.True(common.SpinWaitOnCondition(cond, time.Second), "Timed out waiting for lock waiter")
+
+	status := lockMgr.Status()
+	s.Equal(key, status[0].Key)
+	s.True(status[0].Locked)
+
+	lockMgr.Unlock(key)
+	wg.Wait()
+	s.Equal(0, len(lockMgr.Status()))
+}
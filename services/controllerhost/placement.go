@@ -23,6 +23,7 @@ package controllerhost
 import (
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"strconv"
 	"strings"
@@ -38,6 +39,38 @@ var errNoInputHosts = errors.New("Unable to find healthy input host")
 var errNoOutputHosts = errors.New("Unable to find healthy output host")
 var errNoStoreHosts = errors.New("Unable to find healthy store hosts")
 
+// Weights of the individual load metrics when scoring a store host for
+// placement. Each metric is normalized against the largest value seen
+// across the candidates, so the resulting score lies in [0, 1] and a
+// lower score means a less loaded host.
+const (
+	storeLoadWeightExtents  = 0.3
+	storeLoadWeightMsgsIn   = 0.2
+	storeLoadWeightBytesIn  = 0.2
+	storeLoadWeightDiskUsed = 0.3
+)
+
+const (
+	// storePlacementSpread is the number of least loaded candidates
+	// considered per requested store host. The load metrics are one
+	// minute averages, so extents created in a burst would otherwise
+	// all land on the same few hosts before their load shows up.
+	storePlacementSpread = 3
+	// storePlacementMinWeight keeps the pick probability of the most
+	// loaded candidate in the window above zero
+	storePlacementMinWeight = 0.1
+)
+
+// storeHostLoad is the load snapshot of a store host used for placement
+type storeHostLoad struct {
+	host          *common.HostInfo
+	numExtents    int64
+	msgsInPerSec  int64
+	bytesInPerSec int64
+	remDiskSpace  int64 // -1 if unknown
+	score         float64
+}
+
 // Placement is the placement strategy interface for picking hosts
 type Placement interface {
 	// PickInputHost picks an input host with certain distance from the store hosts
@@ -46,6 +79,9 @@ type Placement interface {
 	PickOutputHost(storeHosts []*common.HostInfo) (*common.HostInfo, error)
 	// PickStoreHosts picks n store hosts with certain distance between store replicas
 	PickStoreHosts(count int) ([]*common.HostInfo, error)
+	// PickReplacementStoreHost picks a store host to replace a lost replica of an
+	// extent, with certain distance from the given surviving replicas
+	PickReplacementStoreHost(replicas []*common.HostInfo, exclude []string) (*common.HostInfo, error)
 }
 
 // DistancePlacement holds the context and distance map
@@ -166,7 +202,9 @@ func (p *DistancePlacement) PickOutputHost(storeHosts []*common.HostInfo) (*comm
 	return host, nil
 }
 
-// PickStoreHosts picks n store hosts with certain distance between store replicas
+// PickStoreHosts picks n store hosts with certain distance between store replicas.
+// Candidates are ranked by their load and the hosts are picked at random among
+// the least loaded ones that satisfy the distance constraints.
 func (p *DistancePlacement) PickStoreHosts(count int) ([]*common.HostInfo, error) {
 
 	if storeHosts, err := p.findEligibleStoreHosts(); err == nil {
@@ -175,6 +213,8 @@ func (p *DistancePlacement) PickStoreHosts(count int) ([]*common.HostInfo, error
 			return nil, errNoHosts
 		}
 
+		ranked := rankStoreHostsByLoad(storeHosts, p.context.loadMetrics)
+
 		minDistance := p.context.appConfig.GetControllerConfig().GetMinStoreToStoreDistance()
 		maxDistance := p.context.appConfig.GetControllerConfig().GetMaxStoreToStoreDistance()
 		if minDistance <= distance.ZeroDistance {
@@ -183,7 +223,8 @@ func (p *DistancePlacement) PickStoreHosts(count int) ([]*common.HostInfo, error
 		if maxDistance <= minDistance {
 			maxDistance = distance.InfiniteDistance
 		}
-		if hosts, e := p.pickHosts(common.StoreServiceName, storeHosts, nil, count, minDistance, maxDistance); e == nil {
+		if hosts, e := p.pickLeastLoadedHosts(ranked, nil, count, minDistance, maxDistance); e == nil {
+			p.logStorePlacement(hosts, ranked, "distance")
 			return hosts, nil
 		}
 		minFallback := p.context.appConfig.GetControllerConfig().GetMinStoreToStoreFallbackDistance()
@@ -195,23 +236,209 @@ func (p *DistancePlacement) PickStoreHosts(count int) ([]*common.HostInfo, error
 			if maxFallback <= minFallback {
 				maxFallback = distance.InfiniteDistance
 			}
-			if hosts, e := p.pickHosts(common.StoreServiceName, storeHosts, nil, count, minFallback, maxFallback); e == nil {
+			if hosts, e := p.pickLeastLoadedHosts(ranked, nil, count, minFallback, maxFallback); e == nil {
+				p.logStorePlacement(hosts, ranked, "fallbackDistance")
 				return hosts, nil
 			}
 		}
-		if cnt := len(storeHosts); cnt >= count {
-			start := rand.Intn(cnt)
-			end := start + count
-			if end > cnt {
-				end = cnt
-			}
-			hosts := append([]*common.HostInfo{}, storeHosts[start:end]...)
-			hosts = append(hosts, storeHosts[:count-len(hosts)]...)
+		hosts := shuffleByLoad(ranked[:placementWindow(count, len(ranked))])[:count]
+		p.logStorePlacement(hosts, ranked, "leastLoaded")
+		return hosts, nil
+	}
+
+	return nil, errNoStoreHosts
+}
+
+// PickReplacementStoreHost picks a store host to replace a lost replica of an
+// extent. The surviving replicas and the hosts to exclude (which includes the
+// lost replica) are never picked. Like PickStoreHosts, the least loaded host
+// that satisfies the distance constraints to the surviving replicas is preferred.
+func (p *DistancePlacement) PickReplacementStoreHost(replicas []*common.HostInfo, exclude []string) (*common.HostInfo, error) {
+
+	storeHosts, err := p.findEligibleStoreHosts()
+	if err != nil {
+		return nil, errNoStoreHosts
+	}
+
+	excluded := make(map[string]struct{}, len(replicas)+len(exclude))
+	for _, h := range replicas {
+		excluded[h.UUID] = struct{}{}
+	}
+	for _, id := range exclude {
+		excluded[id] = struct{}{}
+	}
+
+	candidates := make([]*common.HostInfo, 0, len(storeHosts))
+	for _, h := range storeHosts {
+		if _, ok := excluded[h.UUID]; !ok {
+			candidates = append(candidates, h)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errNoStoreHosts
+	}
+
+	ranked := rankStoreHostsByLoad(candidates, p.context.loadMetrics)
+
+	minDistance := p.context.appConfig.GetControllerConfig().GetMinStoreToStoreDistance()
+	maxDistance := p.context.appConfig.GetControllerConfig().GetMaxStoreToStoreDistance()
+	if minDistance <= distance.ZeroDistance {
+		minDistance = distance.ZeroDistance + 1
+	}
+	if maxDistance <= minDistance {
+		maxDistance = distance.InfiniteDistance
+	}
+	if hosts, e := p.pickLeastLoadedHosts(ranked, replicas, 1, minDistance, maxDistance); e == nil {
+		p.logStorePlacement(hosts, ranked, "replacementDistance")
+		return hosts[0], nil
+	}
+	minFallback := p.context.appConfig.GetControllerConfig().GetMinStoreToStoreFallbackDistance()
+	maxFallback := p.context.appConfig.GetControllerConfig().GetMaxStoreToStoreFallbackDistance()
+	if minFallback < minDistance || maxFallback > maxDistance {
+		if minFallback <= distance.ZeroDistance {
+			minFallback = distance.ZeroDistance + 1
+		}
+		if maxFallback <= minFallback {
+			maxFallback = distance.InfiniteDistance
+		}
+		if hosts, e := p.pickLeastLoadedHosts(ranked, replicas, 1, minFallback, maxFallback); e == nil {
+			p.logStorePlacement(hosts, ranked, "replacementFallbackDistance")
+			return hosts[0], nil
+		}
+	}
+
+	hosts := shuffleByLoad(ranked[:placementWindow(1, len(ranked))])[:1]
+	p.logStorePlacement(hosts, ranked, "replacementLeastLoaded")
+	return hosts[0], nil
+}
+
+// pickLeastLoadedHosts runs the distance based selection over a window of the
+// least loaded hosts, doubling the window until the constraints can be met or
+// all hosts have been considered. The given hosts must be sorted by load. The
+// hosts within the window are ordered by a random draw weighted towards the
+// less loaded ones, so that concurrent placements don't pile onto the same hosts.
+func (p *DistancePlacement) pickLeastLoadedHosts(ranked []*storeHostLoad, sourceHosts []*common.HostInfo, count int, minDistance, maxDistance uint16) ([]*common.HostInfo, error) {
+	var err error
+	for window := placementWindow(count, len(ranked)); ; window *= 2 {
+		if window > len(ranked) {
+			window = len(ranked)
+		}
+		var hosts []*common.HostInfo
+		if hosts, err = p.pickHosts(common.StoreServiceName, shuffleByLoad(ranked[:window]), sourceHosts, count, minDistance, maxDistance); err == nil {
 			return hosts, nil
 		}
+		if window == len(ranked) {
+			return nil, err
+		}
 	}
+}
 
-	return nil, errNoStoreHosts
+// placementWindow returns the number of least loaded
+// candidates to pick count hosts from
+func placementWindow(count int, numHosts int) int {
+	if window := count * storePlacementSpread; window < numHosts {
+		return window
+	}
+	return numHosts
+}
+
+// shuffleByLoad returns the hosts in a random order where
+// the less loaded a host is, the more likely it comes first
+func shuffleByLoad(loads []*storeHostLoad) []*common.HostInfo {
+	keys := make([]float64, len(loads))
+	for i, l := range loads {
+		// weighted sampling without replacement (Efraimidis-Spirakis),
+		// the score lies in [0, 1] with lower meaning less loaded
+		weight := 1 - l.score + storePlacementMinWeight
+		keys[i] = math.Pow(rand.Float64(), 1/weight)
+	}
+	shuffled := append([]*storeHostLoad{}, loads...)
+	sortStoreHostsByKey(shuffled, keys)
+	hosts := make([]*common.HostInfo, len(shuffled))
+	for i, l := range shuffled {
+		hosts[i] = l.host
+	}
+	return hosts
+}
+
+// logStorePlacement logs the hosts picked for a new extent along with the
+// load that led to the decision, so that placement can be explained later
+func (p *DistancePlacement) logStorePlacement(picked []*common.HostInfo, ranked []*storeHostLoad, strategy string) {
+	loads := make(map[string]*storeHostLoad, len(ranked))
+	for _, l := range ranked {
+		loads[l.host.UUID] = l
+	}
+	var scores []string
+	for _, h := range picked {
+		if l, ok := loads[h.UUID]; ok {
+			scores = append(scores, fmt.Sprintf("%s{score=%.3f,extents=%d,msgsIn=%d,bytesIn=%d,freeDisk=%d}",
+				h.Addr, l.score, l.numExtents, l.msgsInPerSec, l.bytesInPerSec, l.remDiskSpace))
+		}
+	}
+	p.context.log.WithFields(bark.Fields{
+		`strategy`:   strategy,
+		`candidates`: len(ranked),
+		`picked`:     strings.Join(scores, ","),
+	}).Info("Placement picked store hosts")
+}
+
+// rankStoreHostsByLoad scores the given store hosts using the load metrics
+// reported to the controller and returns them sorted from the least loaded
+// to the most loaded. Hosts without any load data are treated as idle. Hosts
+// are shuffled before sorting so that ties don't always favor the same host.
+func rankStoreHostsByLoad(hosts []*common.HostInfo, loadMetrics load.MetricsAggregator) []*storeHostLoad {
+
+	getMetric := func(hostID string, metric load.MetricName, dflt int64) int64 {
+		if loadMetrics == nil {
+			return dflt
+		}
+		val, err := loadMetrics.Get(hostID, load.EmptyTag, metric, load.OneMinAvg)
+		if err != nil {
+			return dflt
+		}
+		return val
+	}
+
+	result := make([]*storeHostLoad, len(hosts))
+	var maxExtents, maxMsgsIn, maxBytesIn, maxDisk int64
+
+	for i, idx := range rand.Perm(len(hosts)) {
+		h := hosts[idx]
+		l := &storeHostLoad{
+			host:          h,
+			numExtents:    getMetric(h.UUID, load.NumExtentsActive, 0),
+			msgsInPerSec:  getMetric(h.UUID, load.MsgsInPerSec, 0),
+			bytesInPerSec: getMetric(h.UUID, load.BytesInPerSec, 0),
+			remDiskSpace:  getMetric(h.UUID, load.RemDiskSpaceBytes, -1),
+		}
+		maxExtents = common.MaxInt64(maxExtents, l.numExtents)
+		maxMsgsIn = common.MaxInt64(maxMsgsIn, l.msgsInPerSec)
+		maxBytesIn = common.MaxInt64(maxBytesIn, l.bytesInPerSec)
+		maxDisk = common.MaxInt64(maxDisk, l.remDiskSpace)
+		result[i] = l
+	}
+
+	normalize := func(val, max int64) float64 {
+		if max <= 0 || val <= 0 {
+			return 0
+		}
+		return float64(val) / float64(max)
+	}
+
+	for _, l := range result {
+		diskUsed := 0.0
+		if l.remDiskSpace >= 0 && maxDisk > 0 {
+			diskUsed = 1 - normalize(l.remDiskSpace, maxDisk)
+		}
+		l.score = storeLoadWeightExtents*normalize(l.numExtents, maxExtents) +
+			storeLoadWeightMsgsIn*normalize(l.msgsInPerSec, maxMsgsIn) +
+			storeLoadWeightBytesIn*normalize(l.bytesInPerSec, maxBytesIn) +
+			storeLoadWeightDiskUsed*diskUsed
+	}
+
+	sortStoreHostsByLoad(result)
+
+	return result
 }
 
 // doesStoreMeetConstraints returns true of the given storehost
@@ -0,0 +1,166 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-server/services/controllerhost/load"
+)
+
+type PlacementSuite struct {
+	*require.Assertions
+	suite.Suite
+	clock       *common.MockTimeSource
+	loadMetrics *load.TimeslotAggregator
+}
+
+func TestPlacementSuite(t *testing.T) {
+	suite.Run(t, new(PlacementSuite))
+}
+
+func (s *PlacementSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+	s.clock = common.NewMockTimeSource()
+	s.loadMetrics = load.NewTimeSlotAggregator(s.clock, bark.NewLoggerFromLogrus(log.New()))
+	s.loadMetrics.Start()
+}
+
+func (s *PlacementSuite) TearDownTest() {
+	s.loadMetrics.Stop()
+}
+
+func (s *PlacementSuite) putHostLoad(hostID string, extents, msgsIn, bytesIn, freeDisk int64) {
+	now := s.clock.Now().UnixNano()
+	s.loadMetrics.Put(hostID, load.EmptyTag, load.NumExtentsActive, extents, now)
+	s.loadMetrics.Put(hostID, load.EmptyTag, load.MsgsInPerSec, msgsIn, now)
+	s.loadMetrics.Put(hostID, load.EmptyTag, load.BytesInPerSec, bytesIn, now)
+	s.loadMetrics.Put(hostID, load.EmptyTag, load.RemDiskSpaceBytes, freeDisk, now)
+}
+
+func (s *PlacementSuite) awaitAsyncAggregation() {
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for s.loadMetrics.DataChannelLength() > 0 {
+			time.Sleep(time.Millisecond * 2)
+		}
+	}()
+	s.True(common.AwaitWaitGroup(wg, time.Minute), "Metrics aggregation timed out")
+}
+
+func (s *PlacementSuite) TestRankStoreHostsByLoad() {
+
+	hosts := []*common.HostInfo{
+		{UUID: uuid.New(), Addr: "10.0.0.1:4253"}, // busiest
+		{UUID: uuid.New(), Addr: "10.0.0.2:4253"}, // idle, lots of disk
+		{UUID: uuid.New(), Addr: "10.0.0.3:4253"}, // idle, but low on disk
+		{UUID: uuid.New(), Addr: "10.0.0.4:4253"}, // moderately loaded
+	}
+
+	s.putHostLoad(hosts[0].UUID, 1000, 5000, 5*1024*1024, 500*1024*1024*1024)
+	s.putHostLoad(hosts[1].UUID, 10, 10, 1024, 1024*1024*1024*1024)
+	s.putHostLoad(hosts[2].UUID, 10, 10, 1024, 10*1024*1024*1024)
+	s.putHostLoad(hosts[3].UUID, 500, 2000, 2*1024*1024, 800*1024*1024*1024)
+
+	s.awaitAsyncAggregation()
+	s.clock.Advance(time.Minute)
+
+	ranked := rankStoreHostsByLoad(hosts, s.loadMetrics)
+	s.Equal(len(hosts), len(ranked))
+
+	order := []string{hosts[1].UUID, hosts[2].UUID, hosts[3].UUID, hosts[0].UUID}
+	for i, l := range ranked {
+		s.Equal(order[i], l.host.UUID, "Wrong placement order at index %d", i)
+		if i > 0 {
+			s.True(ranked[i-1].score <= l.score, "Ranking not sorted by score")
+		}
+	}
+	s.Equal(int64(1000), ranked[3].numExtents)
+	s.Equal(int64(1024*1024*1024*1024), ranked[0].remDiskSpace)
+}
+
+func (s *PlacementSuite) TestRankStoreHostsByLoadNoData() {
+
+	hosts := []*common.HostInfo{
+		{UUID: uuid.New(), Addr: "10.0.0.1:4253"},
+		{UUID: uuid.New(), Addr: "10.0.0.2:4253"},
+		{UUID: uuid.New(), Addr: "10.0.0.3:4253"},
+	}
+
+	// a host that reports load should rank behind hosts with no data
+	s.putHostLoad(hosts[0].UUID, 100, 100, 1024, 1024*1024*1024)
+	s.awaitAsyncAggregation()
+	s.clock.Advance(time.Minute)
+
+	ranked := rankStoreHostsByLoad(hosts, s.loadMetrics)
+	s.Equal(len(hosts), len(ranked))
+	s.Equal(hosts[0].UUID, ranked[2].host.UUID)
+	s.Equal(int64(-1), ranked[0].remDiskSpace)
+	s.Equal(0.0, ranked[0].score)
+	s.Equal(0.0, ranked[1].score)
+
+	ranked = rankStoreHostsByLoad(hosts, nil)
+	s.Equal(len(hosts), len(ranked))
+	for _, l := range ranked {
+		s.Equal(0.0, l.score)
+	}
+}
+
+func (s *PlacementSuite) TestPickLeastLoadedHostsSpreadsPlacements() {
+
+	ranked := []*storeHostLoad{
+		{host: &common.HostInfo{UUID: uuid.New(), Addr: "10.0.0.1:4253"}, score: 0.0},
+		{host: &common.HostInfo{UUID: uuid.New(), Addr: "10.0.0.2:4253"}, score: 0.4},
+		{host: &common.HostInfo{UUID: uuid.New(), Addr: "10.0.0.3:4253"}, score: 0.8},
+		{host: &common.HostInfo{UUID: uuid.New(), Addr: "10.0.0.4:4253"}, score: 0.9},
+	}
+
+	p := &DistancePlacement{}
+	picked := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		hosts, err := p.pickLeastLoadedHosts(ranked, nil, 1, 1, 2)
+		s.NoError(err)
+		s.Equal(1, len(hosts))
+		picked[hosts[0].UUID]++
+	}
+
+	// only the storePlacementSpread least loaded hosts are candidates
+	// and the less loaded a host is, the more often it gets picked
+	s.Equal(0, picked[ranked[3].host.UUID])
+	s.True(picked[ranked[0].host.UUID] > picked[ranked[1].host.UUID], "picks not weighted by load: %v", picked)
+	s.True(picked[ranked[1].host.UUID] > picked[ranked[2].host.UUID], "picks not weighted by load: %v", picked)
+	s.True(picked[ranked[2].host.UUID] > 0, "picks not spread: %v", picked)
+
+	hosts, err := p.pickLeastLoadedHosts(ranked, nil, 2, 1, 2)
+	s.NoError(err)
+	s.Equal(2, len(hosts))
+	s.NotEqual(hosts[0].UUID, hosts[1].UUID)
+}
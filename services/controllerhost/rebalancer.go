@@ -0,0 +1,569 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-server/common/metrics"
+	"github.com/uber/cherami-server/services/controllerhost/load"
+	"github.com/uber/cherami-thrift/.generated/go/admin"
+	m "github.com/uber/cherami-thrift/.generated/go/metadata"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+type (
+	// rebalancer is a background daemon that periodically
+	// compares the load of the input and output hosts and
+	// moves consumer groups and extents off the hosts that
+	// are overloaded compared to the rest of the cluster.
+	// It only runs on the primary controller.
+	rebalancer struct {
+		started    int32
+		context    *Context
+		ll         bark.Logger
+		lastReport atomic.Value // *rebalanceReport
+		shutdownC  chan struct{}
+		shutdownWG sync.WaitGroup
+	}
+
+	// rebalanceConfig is the config for a single rebalancing round
+	rebalanceConfig struct {
+		mode             string
+		interval         time.Duration
+		thresholdPercent int
+		maxMoves         int
+	}
+
+	// rebalanceItem is a unit of load that can be moved
+	// off a host, either a consumer group or an extent
+	rebalanceItem struct {
+		dstID string
+		id    string
+		load  int64
+	}
+
+	// rebalanceMove is a single move planned by the rebalancer
+	rebalanceMove struct {
+		Type     string `json:"type"`
+		DstUUID  string `json:"dstUUID"`
+		UUID     string `json:"uuid"`
+		FromHost string `json:"fromHost"`
+		ToHost   string `json:"toHost,omitempty"`
+		Load     int64  `json:"load"`
+		Done     bool   `json:"done"`
+	}
+
+	// rebalanceReport is the outcome of the last rebalancing round
+	rebalanceReport struct {
+		Mode      string           `json:"mode"`
+		StartTime time.Time        `json:"startTime"`
+		Moves     []*rebalanceMove `json:"moves"`
+	}
+)
+
+const (
+	rebalancerModeOff    = "off"
+	rebalancerModeDryRun = "dryrun"
+	rebalancerModeOn     = "on"
+
+	rebalanceMoveConsumerGroup = "consumerGroup"
+	rebalanceMoveExtent        = "extent"
+
+	defaultRebalancerInterval = 10 * time.Minute
+)
+
+// newRebalancer creates and returns a new instance of rebalancer
+func newRebalancer(context *Context) *rebalancer {
+	return &rebalancer{
+		context:   context,
+		ll:        context.log.WithField(common.TagModule, `rebalancer`),
+		shutdownC: make(chan struct{}),
+	}
+}
+
+func (r *rebalancer) Start() {
+	if !atomic.CompareAndSwapInt32(&r.started, 0, 1) {
+		return
+	}
+	r.shutdownWG.Add(1)
+	go r.run()
+	r.ll.Info("Rebalancer started")
+}
+
+func (r *rebalancer) Stop() {
+	close(r.shutdownC)
+	if !common.AwaitWaitGroup(&r.shutdownWG, time.Second) {
+		r.ll.Error("Timed out waiting for Rebalancer to stop")
+		return
+	}
+	r.ll.Info("Rebalancer stopped")
+}
+
+// getReport returns the outcome of the last rebalancing
+// round, or nil if no round has run yet
+func (r *rebalancer) getReport() *rebalanceReport {
+	report, _ := r.lastReport.Load().(*rebalanceReport)
+	return report
+}
+
+func (r *rebalancer) run() {
+	defer r.shutdownWG.Done()
+	for {
+		cfg := r.getConfig()
+		if cfg.mode != rebalancerModeOff && isPrimaryController(r.context) {
+			r.rebalance(cfg)
+		}
+		if r.sleep(cfg.interval) {
+			return
+		}
+	}
+}
+
+func (r *rebalancer) getConfig() *rebalanceConfig {
+
+	result := &rebalanceConfig{
+		mode:     rebalancerModeOff,
+		interval: defaultRebalancerInterval,
+	}
+
+	cfgIface, err := r.context.cfgMgr.Get(common.ControllerServiceName, `*`, `*`, `*`)
+	if err != nil {
+		return result
+	}
+
+	cfg, ok := cfgIface.(ControllerDynamicConfig)
+	if !ok {
+		return result
+	}
+
+	switch cfg.RebalancerMode {
+	case rebalancerModeDryRun, rebalancerModeOn:
+		result.mode = cfg.RebalancerMode
+	}
+	if cfg.RebalancerIntervalSecs > 0 {
+		result.interval = time.Duration(cfg.RebalancerIntervalSecs) * time.Second
+	}
+	result.thresholdPercent = common.MaxInt(cfg.RebalancerThresholdPercent, 0)
+	result.maxMoves = common.MaxInt(cfg.RebalancerMaxMovesPerRound, 0)
+	return result
+}
+
+// rebalance runs a single rebalancing round. Output hosts are
+// rebalanced first, since moving a consumer group is cheaper
+// than sealing an extent, and the input hosts get whatever is
+// left of the moves allowed per round
+func (r *rebalancer) rebalance(cfg *rebalanceConfig) {
+
+	context := r.context
+	report := &rebalanceReport{
+		Mode:      cfg.mode,
+		StartTime: time.Now(),
+	}
+
+	cgItems, extItems, err := r.listAssignments()
+	if err != nil {
+		context.m3Client.IncCounter(metrics.RebalancerScope, metrics.ControllerFailures)
+		r.ll.WithField(common.TagErr, err).Error("Rebalancer cannot list assignments")
+		return
+	}
+
+	outLoads := r.hostLoads(common.OutputServiceName, load.MsgsOutPerSec)
+	cgMoves := planRebalance(outLoads, cgItems, cfg.thresholdPercent, cfg.maxMoves)
+	for _, move := range cgMoves {
+		move.Type = rebalanceMoveConsumerGroup
+	}
+
+	inLoads := r.hostLoads(common.InputServiceName, load.MsgsInPerSec)
+	extMoves := planRebalance(inLoads, extItems, cfg.thresholdPercent, cfg.maxMoves-len(cgMoves))
+	for _, move := range extMoves {
+		move.Type = rebalanceMoveExtent
+	}
+
+	report.Moves = append(cgMoves, extMoves...)
+
+	if cfg.mode == rebalancerModeDryRun {
+		for _, move := range report.Moves {
+			r.moveLogger(move).Info("Rebalancer dry run, would move")
+		}
+		context.m3Client.AddCounter(metrics.RebalancerScope, metrics.ControllerRebalanceDryRunMoves, int64(len(report.Moves)))
+		r.lastReport.Store(report)
+		return
+	}
+
+	for _, move := range cgMoves {
+		if err := r.moveConsumerGroup(move); err != nil {
+			r.moveLogger(move).WithField(common.TagErr, err).Error("Rebalancer failed to move consumer group")
+			continue
+		}
+		move.Done = true
+		context.m3Client.IncCounter(metrics.RebalancerScope, metrics.ControllerRebalanceCGMoves)
+		r.moveLogger(move).Info("Rebalancer moved consumer group")
+	}
+
+	dstIDs := make(map[string]struct{})
+	for _, move := range extMoves {
+		if !addExtentDownEvent(context, 0, move.DstUUID, move.UUID) {
+			r.moveLogger(move).Error("Rebalancer: Failed to enqueue ExtentDownEvent, event queue full")
+			continue
+		}
+		dstIDs[move.DstUUID] = struct{}{}
+		if err := r.replaceExtent(move); err != nil {
+			// the extent is being sealed already, the refresh
+			// below places its replacement on any input host
+			r.moveLogger(move).WithField(common.TagErr, err).Error("Rebalancer failed to create replacement extent")
+			continue
+		}
+		move.Done = true
+		context.m3Client.IncCounter(metrics.RebalancerScope, metrics.ControllerRebalanceExtentMoves)
+		r.moveLogger(move).Info("Rebalancer moved extent")
+	}
+
+	// compensate for the sealed extents right away,
+	// instead of waiting for the cached results of
+	// GetInputHosts() to expire. This also replaces
+	// the extents that couldn't be moved to their
+	// target input host
+	for id := range dstIDs {
+		if !context.dstLock.TryLock(id, time.Second) {
+			context.m3Client.IncCounter(metrics.RebalancerScope, metrics.ControllerErrTryLockCounter)
+			continue
+		}
+		refreshInputHostsForDst(context, id, context.timeSource.Now().UnixNano())
+		context.dstLock.Unlock(id)
+	}
+
+	r.lastReport.Store(report)
+}
+
+// listAssignments returns the consumer groups served by every
+// output host and the open extents served by every input host
+func (r *rebalancer) listAssignments() (cgItems map[string][]*rebalanceItem, extItems map[string][]*rebalanceItem, err error) {
+
+	context := r.context
+
+	dests, err := context.mm.ListDestinations()
+	if err != nil {
+		context.m3Client.IncCounter(metrics.RebalancerScope, metrics.ControllerErrMetadataReadCounter)
+		return nil, nil, err
+	}
+
+	cgItems = make(map[string][]*rebalanceItem)
+	extItems = make(map[string][]*rebalanceItem)
+
+	for _, dstDesc := range dests {
+
+		if validateDstStatus(dstDesc) != nil {
+			continue
+		}
+
+		dstID := dstDesc.GetDestinationUUID()
+
+		stats, err := findOpenExtents(context, dstID, metrics.RebalancerScope)
+		if err == nil {
+			for _, stat := range stats {
+				ext := stat.GetExtent()
+				if common.IsRemoteZoneExtent(ext.GetOriginZone(), context.localZone) {
+					continue
+				}
+				if isExtentBeingSealed(context, ext.GetExtentUUID()) {
+					continue
+				}
+				hostID := ext.GetInputHostUUID()
+				extItems[hostID] = append(extItems[hostID], &rebalanceItem{
+					dstID: dstID,
+					id:    ext.GetExtentUUID(),
+					load:  r.itemLoad(hostID, ext.GetExtentUUID(), load.MsgsInPerSec),
+				})
+			}
+		}
+
+		consGroups, err := context.mm.ListConsumerGroupsByDstID(dstID)
+		if err != nil {
+			context.m3Client.IncCounter(metrics.RebalancerScope, metrics.ControllerErrMetadataReadCounter)
+			continue
+		}
+
+		filterBy := []m.ConsumerGroupExtentStatus{m.ConsumerGroupExtentStatus_OPEN}
+		for _, cgDesc := range consGroups {
+			if cgDesc.GetStatus() != shared.ConsumerGroupStatus_ENABLED {
+				continue
+			}
+			cgID := cgDesc.GetConsumerGroupUUID()
+			cgExtents, err := listConsumerGroupExtents(context, dstID, cgID, metrics.RebalancerScope, filterBy)
+			if err != nil {
+				continue
+			}
+			hostIDs := make(map[string]struct{})
+			for _, cge := range cgExtents {
+				hostIDs[cge.GetOutputHostUUID()] = struct{}{}
+			}
+			for hostID := range hostIDs {
+				cgItems[hostID] = append(cgItems[hostID], &rebalanceItem{
+					dstID: dstID,
+					id:    cgID,
+					load:  r.itemLoad(hostID, cgID, load.MsgsOutPerSec),
+				})
+			}
+		}
+	}
+
+	return cgItems, extItems, nil
+}
+
+// hostLoads returns the load of every host of the given service
+// that's part of the ring. Hosts that haven't reported any load
+// yet are assumed to be idle
+func (r *rebalancer) hostLoads(service string, metric load.MetricName) map[string]int64 {
+	hosts, err := r.context.rpm.GetHosts(service)
+	if err != nil {
+		return nil
+	}
+	result := make(map[string]int64, len(hosts))
+	for _, host := range hosts {
+		val, err := r.context.loadMetrics.Get(host.UUID, load.EmptyTag, metric, load.OneMinAvg)
+		if err != nil {
+			val = 0
+		}
+		result[host.UUID] = val
+	}
+	return result
+}
+
+func (r *rebalancer) itemLoad(hostID string, tag string, metric load.MetricName) int64 {
+	val, err := r.context.loadMetrics.Get(hostID, tag, metric, load.OneMinAvg)
+	if err != nil {
+		return 0
+	}
+	return val
+}
+
+// moveConsumerGroup reassigns the open extents of the consumer group
+// held by the overloaded output host to the target output host, then
+// unloads the consumer group from the old host so that its consumers
+// reconnect and get the new output host from GetOutputHosts()
+func (r *rebalancer) moveConsumerGroup(move *rebalanceMove) error {
+
+	context := r.context
+
+	filterBy := []m.ConsumerGroupExtentStatus{m.ConsumerGroupExtentStatus_OPEN}
+	cgExtents, err := listConsumerGroupExtents(context, move.DstUUID, move.UUID, metrics.RebalancerScope, filterBy)
+	if err != nil {
+		return err
+	}
+
+	// hold the destination lock, so that we don't race
+	// with GetOutputHosts repairing the same extents
+	if !context.dstLock.TryLock(move.DstUUID, time.Second) {
+		context.m3Client.IncCounter(metrics.RebalancerScope, metrics.ControllerErrTryLockCounter)
+		return ErrTryLock
+	}
+
+	nMoved := 0
+	for _, cge := range cgExtents {
+		if cge.GetOutputHostUUID() != move.FromHost {
+			continue
+		}
+		err = context.mm.UpdateOutHost(move.DstUUID, move.UUID, cge.GetExtentUUID(), move.ToHost)
+		if err != nil {
+			context.m3Client.IncCounter(metrics.RebalancerScope, metrics.ControllerErrMetadataUpdateCounter)
+			break
+		}
+		nMoved++
+	}
+
+	context.dstLock.Unlock(move.DstUUID)
+
+	if nMoved == 0 {
+		return err
+	}
+
+	notifyEvent := NewOutputHostNotificationEvent(move.DstUUID, move.UUID, move.ToHost, notifyCGRebalanced, move.FromHost, admin.NotificationType_ALL)
+	if !context.eventPipeline.Add(notifyEvent) {
+		r.moveLogger(move).Error("Rebalancer: Failed to enqueue OutputHostNotificationEvent, event queue full")
+	}
+
+	triggerCacheRefreshForCG(context, move.UUID)
+
+	if unloadErr := r.unloadConsumerGroup(move.FromHost, move.UUID); unloadErr != nil {
+		// the extents have moved already, the consumers will
+		// switch over when the old host reloads the group
+		r.moveLogger(move).WithField(common.TagErr, unloadErr).Warn("Rebalancer failed to unload consumer group from old output host")
+	}
+
+	return err
+}
+
+// replaceExtent creates a new extent for the destination on the target
+// input host of the move, to take over the load of the extent being sealed
+func (r *rebalancer) replaceExtent(move *rebalanceMove) error {
+
+	context := r.context
+
+	dstDesc, err := readDestination(context, move.DstUUID, metrics.RebalancerScope)
+	if err != nil {
+		return err
+	}
+
+	// hold the destination lock, so that we don't race
+	// with GetInputHosts creating extents for the same
+	// destination
+	if !context.dstLock.TryLock(move.DstUUID, time.Second) {
+		context.m3Client.IncCounter(metrics.RebalancerScope, metrics.ControllerErrTryLockCounter)
+		return ErrTryLock
+	}
+	defer context.dstLock.Unlock(move.DstUUID)
+
+	_, _, _, err = createExtentOnInputHost(context, move.DstUUID, dstDesc.GetIsMultiZone(), move.ToHost, metrics.RebalancerScope)
+	return err
+}
+
+func (r *rebalancer) unloadConsumerGroup(hostID string, cgID string) error {
+
+	context := r.context
+
+	addr, err := context.rpm.ResolveUUID(common.OutputServiceName, hostID)
+	if err != nil {
+		context.m3Client.IncCounter(metrics.RebalancerScope, metrics.ControllerErrResolveUUIDCounter)
+		return err
+	}
+
+	adminClient, err := common.CreateOutputHostAdminClient(context.channel, addr)
+	if err != nil {
+		context.m3Client.IncCounter(metrics.RebalancerScope, metrics.ControllerErrCreateTChanClientCounter)
+		return err
+	}
+
+	ctx, cancel := thrift.NewContext(thriftCallTimeout)
+	defer cancel()
+	return adminClient.UnloadConsumerGroups(ctx, &admin.UnloadConsumerGroupsRequest{CgUUIDs: []string{cgID}})
+}
+
+func (r *rebalancer) moveLogger(move *rebalanceMove) bark.Logger {
+	fields := bark.Fields{
+		common.TagDst: common.FmtDst(move.DstUUID),
+		`moveType`:    move.Type,
+		`fromHost`:    move.FromHost,
+		`toHost`:      move.ToHost,
+		`load`:        move.Load,
+	}
+	if move.Type == rebalanceMoveConsumerGroup {
+		fields[common.TagCnsm] = common.FmtCnsm(move.UUID)
+	} else {
+		fields[common.TagExt] = common.FmtExt(move.UUID)
+	}
+	return r.ll.WithFields(fields)
+}
+
+func (r *rebalancer) sleep(d time.Duration) bool {
+	select {
+	case <-r.shutdownC:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+// planRebalance returns the moves needed to bring the hosts that
+// are more than thresholdPercent above the mean load back in line.
+// Every move takes the heaviest item off the most loaded host that
+// the least loaded host can take without getting overloaded itself.
+// Items of hosts that are not in loads are never moved.
+func planRebalance(loads map[string]int64, items map[string][]*rebalanceItem, thresholdPercent int, maxMoves int) []*rebalanceMove {
+
+	if len(loads) < 2 || maxMoves <= 0 {
+		return nil
+	}
+
+	var total int64
+	hosts := make([]string, 0, len(loads))
+	projected := make(map[string]int64, len(loads))
+	for hostID, val := range loads {
+		hosts = append(hosts, hostID)
+		projected[hostID] = val
+		total += val
+	}
+	sort.Strings(hosts) // for deterministic plans
+
+	mean := total / int64(len(hosts))
+	if mean <= 0 {
+		return nil
+	}
+	limit := mean + mean*int64(thresholdPercent)/100
+
+	var moves []*rebalanceMove
+	moved := make(map[*rebalanceItem]struct{})
+	exhausted := make(map[string]struct{})
+
+	for len(moves) < maxMoves {
+
+		var src, dst string
+		for _, hostID := range hosts {
+			if _, ok := exhausted[hostID]; !ok && (src == "" || projected[hostID] > projected[src]) {
+				src = hostID
+			}
+			if dst == "" || projected[hostID] < projected[dst] {
+				dst = hostID
+			}
+		}
+
+		if src == "" || projected[src] <= limit {
+			break
+		}
+
+		var best *rebalanceItem
+		for _, item := range items[src] {
+			if _, ok := moved[item]; ok {
+				continue
+			}
+			if item.load <= 0 || projected[dst]+item.load > limit {
+				continue
+			}
+			if best == nil || item.load > best.load {
+				best = item
+			}
+		}
+
+		if best == nil {
+			exhausted[src] = struct{}{}
+			continue
+		}
+
+		moved[best] = struct{}{}
+		projected[src] -= best.load
+		projected[dst] += best.load
+		moves = append(moves, &rebalanceMove{
+			DstUUID:  best.dstID,
+			UUID:     best.id,
+			FromHost: src,
+			ToHost:   dst,
+			Load:     best.load,
+		})
+	}
+
+	return moves
+}
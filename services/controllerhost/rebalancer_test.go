@@ -0,0 +1,92 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type RebalancerSuite struct {
+	*require.Assertions
+	suite.Suite
+}
+
+func TestRebalancerSuite(t *testing.T) {
+	suite.Run(t, new(RebalancerSuite))
+}
+
+func (s *RebalancerSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+}
+
+func (s *RebalancerSuite) TestPlanRebalanceBalanced() {
+	loads := map[string]int64{"h1": 100, "h2": 110, "h3": 90}
+	items := map[string][]*rebalanceItem{
+		"h2": {{dstID: "d1", id: "cg1", load: 60}, {dstID: "d1", id: "cg2", load: 50}},
+	}
+	// within the threshold, nothing to move
+	s.Nil(planRebalance(loads, items, 25, 10))
+	// single host, nowhere to move to
+	s.Nil(planRebalance(map[string]int64{"h1": 1000}, items, 25, 10))
+	// no load at all
+	s.Nil(planRebalance(map[string]int64{"h1": 0, "h2": 0}, items, 25, 10))
+}
+
+func (s *RebalancerSuite) TestPlanRebalanceOverloaded() {
+	loads := map[string]int64{"h1": 700, "h2": 100, "h3": 100}
+	items := map[string][]*rebalanceItem{
+		"h1": {
+			{dstID: "d1", id: "cg1", load: 400},
+			{dstID: "d1", id: "cg2", load: 200},
+			{dstID: "d2", id: "cg3", load: 100},
+		},
+	}
+
+	moves := planRebalance(loads, items, 25, 10)
+	s.Equal(2, len(moves))
+	// cg1 would overload the least loaded host, so cg2 goes first
+	s.Equal("cg2", moves[0].UUID)
+	s.Equal("h1", moves[0].FromHost)
+	s.Equal("h2", moves[0].ToHost)
+	s.Equal(int64(200), moves[0].Load)
+	s.Equal("cg3", moves[1].UUID)
+	s.Equal("h3", moves[1].ToHost)
+	s.Equal("d2", moves[1].DstUUID)
+
+	// rate limited
+	moves = planRebalance(loads, items, 25, 1)
+	s.Equal(1, len(moves))
+	s.Nil(planRebalance(loads, items, 25, 0))
+}
+
+func (s *RebalancerSuite) TestPlanRebalanceNoMovableItems() {
+	loads := map[string]int64{"h1": 1000, "h2": 0}
+	// a single hot item can't be split, moving it would only move the hotspot
+	items := map[string][]*rebalanceItem{
+		"h1": {{dstID: "d1", id: "ext1", load: 1000}},
+		// items of hosts that are not part of the ring are never moved
+		"h3": {{dstID: "d1", id: "ext2", load: 10}},
+	}
+	s.Nil(planRebalance(loads, items, 25, 10))
+}
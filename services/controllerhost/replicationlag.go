@@ -0,0 +1,195 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"sort"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-server/common/metrics"
+	"github.com/uber/cherami-server/services/controllerhost/load"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+)
+
+type (
+	// replicaReplicationLag is the replication lag of an extent
+	// replica, as last reported by the store host replicating it
+	replicaReplicationLag struct {
+		StoreUUID string `json:"storeUUID"`
+		Zone      string `json:"zone"`
+		Messages  int64  `json:"lagMsgs"`
+		Seconds   int64  `json:"lagSecs"`
+	}
+
+	// zoneReplicationLag is the replication lag of the replicas of
+	// a destination, that are replicated from the same zone
+	zoneReplicationLag struct {
+		lagging     bool // whether any replica reported a lag
+		maxMessages int64
+		maxSeconds  int64
+		overLimit   int64 // number of replicas lagging beyond the threshold
+	}
+)
+
+// getReplicaReplicationLag returns the replication lag of an extent replica,
+// and false if the replica hasn't reported any lag in the last minute
+func getReplicaReplicationLag(context *Context, storeUUID string, extUUID string) (common.ReplicationLag, bool) {
+	msgs, err := context.loadMetrics.Get(storeUUID, extUUID, load.ReplicationLagMsgs, load.OneMinAvg)
+	if err != nil {
+		return common.ReplicationLag{}, false
+	}
+	secs, err := context.loadMetrics.Get(storeUUID, extUUID, load.ReplicationLagSecs, load.OneMinAvg)
+	if err != nil {
+		return common.ReplicationLag{}, false
+	}
+	return common.ReplicationLag{Messages: msgs, Seconds: secs}, true
+}
+
+// getExtentReplicationLag returns the replication lag of the replicas
+// of an extent that are being replicated, ordered by store uuid
+func getExtentReplicationLag(context *Context, extent *shared.Extent) []*replicaReplicationLag {
+	zone := extent.GetOriginZone()
+	if len(zone) == 0 {
+		zone = context.localZone // re-replication from another local replica
+	}
+
+	var result []*replicaReplicationLag
+	for _, storeUUID := range extent.GetStoreUUIDs() {
+		lag, ok := getReplicaReplicationLag(context, storeUUID, extent.GetExtentUUID())
+		if !ok {
+			continue
+		}
+		result = append(result, &replicaReplicationLag{
+			StoreUUID: storeUUID,
+			Zone:      zone,
+			Messages:  lag.Messages,
+			Seconds:   lag.Seconds,
+		})
+	}
+	sort.Sort(replicaReplicationLagByStore(result))
+	return result
+}
+
+// getMaxReplicationLagSecs returns the replication lag past which the
+// replicas of the destination raise an alert, zero if it is disabled
+func getMaxReplicationLagSecs(context *Context, dstPath string) int64 {
+
+	cfgIface, err := context.cfgMgr.Get(common.ControllerServiceName, `*`, `*`, `*`)
+	if err != nil {
+		return 0
+	}
+
+	cfg, ok := cfgIface.(ControllerDynamicConfig)
+	if !ok {
+		return 0
+	}
+
+	logFn := func() bark.Logger {
+		return context.log.WithField(common.TagDstPth, common.FmtDstPth(dstPath))
+	}
+
+	return common.OverrideValueByPrefix(logFn, dstPath, cfg.MaxReplicationLagSecsByPath, 0, `MaxReplicationLagSecsByPath`)
+}
+
+// reportReplicationLag aggregates the replication lag of the replicas of
+// the given extents of a destination per zone, and emits it as metrics.
+// The zones that stopped lagging since the last report are reset to zero.
+func (monitor *extentStateMonitor) reportReplicationLag(dstDesc *shared.DestinationDescription, extents []*shared.ExtentStats) {
+
+	context := monitor.context
+	dstUUID := dstDesc.GetDestinationUUID()
+	maxLagSecs := getMaxReplicationLagSecs(context, dstDesc.GetPath())
+
+	zones := make(map[string]*zoneReplicationLag)
+	for zone := range monitor.lagZones[dstUUID] {
+		zones[zone] = &zoneReplicationLag{}
+	}
+
+	for _, stats := range extents {
+		for _, replica := range getExtentReplicationLag(context, stats.GetExtent()) {
+			zoneLag, ok := zones[replica.Zone]
+			if !ok {
+				zoneLag = &zoneReplicationLag{}
+				zones[replica.Zone] = zoneLag
+			}
+			zoneLag.lagging = true
+			if replica.Messages > zoneLag.maxMessages {
+				zoneLag.maxMessages = replica.Messages
+			}
+			if replica.Seconds > zoneLag.maxSeconds {
+				zoneLag.maxSeconds = replica.Seconds
+			}
+			if maxLagSecs > 0 && replica.Seconds > maxLagSecs {
+				zoneLag.overLimit++
+			}
+		}
+	}
+
+	if len(zones) == 0 {
+		return
+	}
+
+	dstTagValue, err := common.GetTagsFromPath(dstDesc.GetPath())
+	if err != nil {
+		dstTagValue = metrics.UnknownDirectoryTagValue
+	}
+
+	lagging := make(map[string]struct{})
+	for zone, zoneLag := range zones {
+		tags := map[string]string{
+			metrics.DestinationTagName: dstTagValue,
+			metrics.ZoneTagName:        zone,
+		}
+		m3Client := metrics.NewClientWithTags(context.m3Client, metrics.Controller, tags)
+		m3Client.UpdateGauge(metrics.ReplicationLagDestScope, metrics.ControllerReplicationLagMsgs, zoneLag.maxMessages)
+		m3Client.UpdateGauge(metrics.ReplicationLagDestScope, metrics.ControllerReplicationLagSecs, zoneLag.maxSeconds)
+		m3Client.UpdateGauge(metrics.ReplicationLagDestScope, metrics.ControllerReplicationLagAlert, zoneLag.overLimit)
+
+		if zoneLag.lagging {
+			lagging[zone] = struct{}{}
+		}
+
+		if zoneLag.overLimit > 0 {
+			context.log.WithFields(bark.Fields{
+				common.TagDst:      common.FmtDst(dstUUID),
+				common.TagDstPth:   common.FmtDstPth(dstDesc.GetPath()),
+				common.TagZoneName: common.FmtZoneName(zone),
+				`maxLagSecs`:       zoneLag.maxSeconds,
+				`maxLagMsgs`:       zoneLag.maxMessages,
+				`threshold`:        maxLagSecs,
+				`replicas`:         zoneLag.overLimit,
+			}).Warn(`Replication lag beyond threshold`)
+		}
+	}
+
+	if len(lagging) == 0 {
+		delete(monitor.lagZones, dstUUID)
+	} else {
+		monitor.lagZones[dstUUID] = lagging
+	}
+}
+
+type replicaReplicationLagByStore []*replicaReplicationLag
+
+func (s replicaReplicationLagByStore) Len() int           { return len(s) }
+func (s replicaReplicationLagByStore) Less(i, j int) bool { return s[i].StoreUUID < s[j].StoreUUID }
+func (s replicaReplicationLagByStore) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,550 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-server/common/metrics"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/cherami-thrift/.generated/go/store"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+type (
+	// replicaVerifier is a background daemon that periodically
+	// samples sealed extents and checks that their replicas hold
+	// the same messages. It reads the replicas in matching address
+	// ranges and compares the checksums of the ranges. The replicas
+	// that differ from the majority are reported and, if enabled,
+	// replaced by a copy of a healthy replica. It only runs on the
+	// primary controller.
+	replicaVerifier struct {
+		started    int32
+		context    *Context
+		ll         bark.Logger
+		read       replicaReader
+		lastReport atomic.Value // *replicaVerifyReport
+		shutdownC  chan struct{}
+		shutdownWG sync.WaitGroup
+	}
+
+	// replicaVerifierConfig is the config for a single verification round
+	replicaVerifierConfig struct {
+		mode             string
+		interval         time.Duration
+		extentsPerRound  int
+		maxMsgsPerExtent int64
+	}
+
+	// replicaReader reads up to n messages of an extent replica,
+	// starting after the given address
+	replicaReader func(storeID string, extID string, addr int64, n int32) ([]*store.ReadMessageContent, error)
+
+	// replicaRange is a range of messages read from a replica
+	replicaRange struct {
+		count    int64
+		lastAddr int64
+		sum      uint64 // checksum of the keys and payloads of the messages
+		end      string // how the replica ended, empty if it didn't
+	}
+
+	// extentVerification is the outcome of comparing the replicas of an extent
+	extentVerification struct {
+		DstUUID    string   `json:"dstUUID"`
+		ExtentUUID string   `json:"extentUUID"`
+		Replicas   []string `json:"replicas"`
+		// number of messages found identical on all replicas
+		Messages   int64 `json:"messages"`
+		Consistent bool  `json:"consistent"`
+		// address after which the replicas stop matching
+		DivergedAfter int64 `json:"divergedAfter,omitempty"`
+		// replicas that differ from the majority of the replicas
+		Divergent []string `json:"divergent,omitempty"`
+		// the reason the replicas could not be compared
+		Inconclusive string `json:"inconclusive,omitempty"`
+		Repairing    bool   `json:"repairing"`
+	}
+
+	// replicaVerifyReport is the outcome of the last verification round
+	replicaVerifyReport struct {
+		Mode      string                `json:"mode"`
+		StartTime time.Time             `json:"startTime"`
+		Extents   []*extentVerification `json:"extents"`
+	}
+)
+
+const (
+	replicaVerifierModeOff    = "off"
+	replicaVerifierModeReport = "report"
+	replicaVerifierModeRepair = "repair"
+
+	defaultReplicaVerifierInterval = time.Hour
+
+	// replicaVerifyBatchSize is the number of messages
+	// read from every replica in a single call
+	replicaVerifyBatchSize = 1000
+
+	replicaEndSealed  = "sealed"
+	replicaEndNoMore  = "nomore"
+	replicaEndError   = "error"
+	replicaEndMissing = "missing"
+)
+
+// newReplicaVerifier creates and returns a new instance of replicaVerifier
+func newReplicaVerifier(context *Context) *replicaVerifier {
+	v := &replicaVerifier{
+		context:   context,
+		ll:        context.log.WithField(common.TagModule, `replicaVerifier`),
+		shutdownC: make(chan struct{}),
+	}
+	v.read = v.readReplica
+	return v
+}
+
+func (v *replicaVerifier) Start() {
+	if !atomic.CompareAndSwapInt32(&v.started, 0, 1) {
+		return
+	}
+	v.shutdownWG.Add(1)
+	go v.run()
+	v.ll.Info("ReplicaVerifier started")
+}
+
+func (v *replicaVerifier) Stop() {
+	close(v.shutdownC)
+	if !common.AwaitWaitGroup(&v.shutdownWG, time.Second) {
+		v.ll.Error("Timed out waiting for ReplicaVerifier to stop")
+		return
+	}
+	v.ll.Info("ReplicaVerifier stopped")
+}
+
+// getReport returns the outcome of the last verification
+// round, or nil if no round has run yet
+func (v *replicaVerifier) getReport() *replicaVerifyReport {
+	report, _ := v.lastReport.Load().(*replicaVerifyReport)
+	return report
+}
+
+func (v *replicaVerifier) run() {
+	defer v.shutdownWG.Done()
+	for {
+		cfg := v.getConfig()
+		if cfg.mode != replicaVerifierModeOff && isPrimaryController(v.context) {
+			v.verifyRound(cfg)
+		}
+		select {
+		case <-time.After(cfg.interval):
+		case <-v.shutdownC:
+			return
+		}
+	}
+}
+
+func (v *replicaVerifier) getConfig() *replicaVerifierConfig {
+
+	result := &replicaVerifierConfig{
+		mode:     replicaVerifierModeOff,
+		interval: defaultReplicaVerifierInterval,
+	}
+
+	cfgIface, err := v.context.cfgMgr.Get(common.ControllerServiceName, `*`, `*`, `*`)
+	if err != nil {
+		return result
+	}
+
+	cfg, ok := cfgIface.(ControllerDynamicConfig)
+	if !ok {
+		return result
+	}
+
+	switch cfg.ReplicaVerifierMode {
+	case replicaVerifierModeReport, replicaVerifierModeRepair:
+		result.mode = cfg.ReplicaVerifierMode
+	}
+	if cfg.ReplicaVerifierIntervalSecs > 0 {
+		result.interval = time.Duration(cfg.ReplicaVerifierIntervalSecs) * time.Second
+	}
+	result.extentsPerRound = common.MaxInt(cfg.ReplicaVerifierExtentsPerRound, 0)
+	result.maxMsgsPerExtent = int64(common.MaxInt(cfg.ReplicaVerifierMaxMsgsPerExtent, 0))
+	return result
+}
+
+// verifyRound compares the replicas of a sample of the sealed extents
+func (v *replicaVerifier) verifyRound(cfg *replicaVerifierConfig) {
+
+	context := v.context
+	report := &replicaVerifyReport{
+		Mode:      cfg.mode,
+		StartTime: time.Now(),
+		Extents:   make([]*extentVerification, 0, cfg.extentsPerRound),
+	}
+
+	for _, stats := range v.sampleExtents(cfg.extentsPerRound) {
+		select {
+		case <-v.shutdownC:
+			return
+		default:
+		}
+		result := v.verifyExtent(stats, cfg.maxMsgsPerExtent, cfg.mode == replicaVerifierModeRepair)
+		report.Extents = append(report.Extents, result)
+	}
+
+	context.m3Client.UpdateGauge(metrics.ReplicaVerifierScope, metrics.ControllerReplicaVerifierRoundSize, int64(len(report.Extents)))
+	v.lastReport.Store(report)
+}
+
+// sampleExtents picks up to n sealed extents, from as many
+// destinations as possible. The extents that are being
+// re-replicated, or whose replicas are still being filled,
+// are left out since their replicas are expected to differ.
+func (v *replicaVerifier) sampleExtents(n int) []*shared.ExtentStats {
+
+	context := v.context
+
+	dests, err := context.mm.ListDestinations()
+	if err != nil {
+		context.m3Client.IncCounter(metrics.ReplicaVerifierScope, metrics.ControllerErrMetadataReadCounter)
+		v.ll.WithField(common.TagErr, err).Error("ReplicaVerifier cannot list destinations")
+		return nil
+	}
+
+	var result []*shared.ExtentStats
+	for _, i := range rand.Perm(len(dests)) {
+		if len(result) >= n {
+			break
+		}
+
+		dstDesc := dests[i]
+		if dstDesc.GetStatus() != shared.DestinationStatus_ENABLED {
+			continue
+		}
+
+		extents, e := context.mm.ListExtentsByDstIDStatus(dstDesc.GetDestinationUUID(), []shared.ExtentStatus{shared.ExtentStatus_SEALED})
+		if e != nil {
+			context.m3Client.IncCounter(metrics.ReplicaVerifierScope, metrics.ControllerErrMetadataReadCounter)
+			continue
+		}
+
+		for _, j := range rand.Perm(len(extents)) {
+			if v.isVerifiable(extents[j].GetExtent()) {
+				result = append(result, extents[j])
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// isVerifiable returns true if the replicas of the
+// extent are expected to hold the same messages
+func (v *replicaVerifier) isVerifiable(extent *shared.Extent) bool {
+	if len(extent.GetStoreUUIDs()) < 2 {
+		return false
+	}
+	if _, ok := v.context.extentRepairs.inProgress.Get(extent.GetExtentUUID()); ok {
+		return false
+	}
+	for _, storeID := range extent.GetStoreUUIDs() {
+		if _, ok := getReplicaReplicationLag(v.context, storeID, extent.GetExtentUUID()); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyExtent compares the replicas of an extent and, if repair is
+// true, starts replacing a replica that differs from the majority
+func (v *replicaVerifier) verifyExtent(stats *shared.ExtentStats, maxMsgs int64, repair bool) *extentVerification {
+
+	context := v.context
+	extent := stats.GetExtent()
+
+	lclLg := v.ll.WithFields(bark.Fields{
+		common.TagDst: common.FmtDst(extent.GetDestinationUUID()),
+		common.TagExt: common.FmtExt(extent.GetExtentUUID()),
+	})
+
+	result := compareReplicas(v.read, extent, maxMsgs)
+	context.m3Client.IncCounter(metrics.ReplicaVerifierScope, metrics.ControllerReplicasVerified)
+
+	switch {
+	case len(result.Inconclusive) > 0:
+		context.m3Client.IncCounter(metrics.ReplicaVerifierScope, metrics.ControllerReplicasInconclusive)
+		lclLg.WithField(`reason`, result.Inconclusive).Warn("ReplicaVerifier cannot compare the replicas")
+
+	case !result.Consistent:
+		context.m3Client.IncCounter(metrics.ReplicaVerifierScope, metrics.ControllerReplicasDivergent)
+		lclLg.WithFields(bark.Fields{
+			`divergedAfter`: result.DivergedAfter,
+			`divergent`:     result.Divergent,
+			`replicas`:      result.Replicas,
+		}).Error("ReplicaVerifier found divergent replicas")
+
+		// the repair replaces one replica at a time, any other
+		// divergent replica is taken care of by the next rounds.
+		// The divergence is read again before, a replica being
+		// purged or a lagging read must not cost a healthy copy
+		if repair && len(result.Divergent) > 0 {
+			if !confirmDivergence(v.read, extent, result) {
+				lclLg.Warn("ReplicaVerifier could not confirm the divergence, not repairing")
+				break
+			}
+			storeID := result.Divergent[0]
+			if addExtentReReplicationEvent(context, extent.GetDestinationUUID(), extent.GetExtentUUID(), storeID) {
+				result.Repairing = true
+				context.m3Client.IncCounter(metrics.ReplicaVerifierScope, metrics.ControllerReplicaRepairs)
+				lclLg.WithField(common.TagStor, common.FmtStor(storeID)).Info("ReplicaVerifier replacing divergent replica")
+			}
+		}
+	}
+
+	return result
+}
+
+// readReplica reads a range of messages from the store host of the replica
+func (v *replicaVerifier) readReplica(storeID string, extID string, addr int64, n int32) ([]*store.ReadMessageContent, error) {
+
+	client, _, err := v.context.clientFactory.GetThriftStoreClientUUID(storeID, extID)
+	if err != nil {
+		return nil, err
+	}
+	defer v.context.clientFactory.ReleaseThriftStoreClient(extID)
+
+	ctx, cancel := thrift.NewContext(thriftCallTimeout)
+	defer cancel()
+
+	req := store.NewReadMessagesRequest()
+	req.ExtentUUID = common.StringPtr(extID)
+	req.StartAddress = common.Int64Ptr(addr)
+	req.StartAddressInclusive = common.BoolPtr(false)
+	req.NumMessages = common.Int32Ptr(n)
+
+	res, err := client.ReadMessages(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.GetMessages(), nil
+}
+
+// compareReplicas reads the replicas of the extent in lock step, a range
+// of messages at a time, until they end or differ, or maxMsgs messages
+// were compared; zero compares the replicas in full. The replicas are
+// compared from the first address present on all of them, since
+// retention may not have purged all of them to the same address yet.
+func compareReplicas(read replicaReader, extent *shared.Extent, maxMsgs int64) *extentVerification {
+
+	extID := extent.GetExtentUUID()
+	replicas := extent.GetStoreUUIDs()
+
+	result := &extentVerification{
+		DstUUID:    extent.GetDestinationUUID(),
+		ExtentUUID: extID,
+		Replicas:   replicas,
+	}
+
+	if len(replicas) < 2 {
+		result.Inconclusive = "not enough replicas"
+		return result
+	}
+
+	// find the first address present on all the replicas
+	addr := int64(store.ADDR_BEGIN)
+	for _, storeID := range replicas {
+		msgs, err := read(storeID, extID, store.ADDR_BEGIN, 1)
+		if err != nil {
+			if _, ok := err.(*store.ExtentNotFoundError); ok {
+				continue // a missing replica will differ from the others
+			}
+			result.Inconclusive = fmt.Sprintf("cannot read replica %v: %v", storeID, err)
+			return result
+		}
+		if len(msgs) > 0 && msgs[0].GetType() == store.ReadMessageContentType_MESSAGE {
+			if first := msgs[0].GetMessage().GetAddress() - 1; first > addr {
+				addr = first
+			}
+		}
+	}
+
+	for maxMsgs <= 0 || result.Messages < maxMsgs {
+
+		n := int64(replicaVerifyBatchSize)
+		if maxMsgs > 0 && maxMsgs-result.Messages < n {
+			n = maxMsgs - result.Messages
+		}
+
+		ranges, inconclusive := readReplicaRanges(read, extID, replicas, addr, int32(n))
+		if len(inconclusive) > 0 {
+			result.Inconclusive = inconclusive
+			return result
+		}
+
+		if len(ranges) > 1 {
+			result.DivergedAfter = addr
+			result.Divergent = findDivergentReplicas(replicas, ranges)
+			return result
+		}
+
+		var done bool
+		for r := range ranges {
+			result.Messages += r.count
+			done = len(r.end) > 0 || r.count == 0
+			addr = r.lastAddr
+		}
+		if done {
+			break
+		}
+	}
+
+	result.Consistent = true
+	return result
+}
+
+// readReplicaRanges reads the range of messages after addr from every
+// replica, grouping the replicas that read the same range. A replica
+// that cannot be read, or that ends other than sealed, makes the ranges
+// inconclusive: the read may have failed transiently, or retention may
+// be purging the messages.
+func readReplicaRanges(read replicaReader, extID string, replicas []string, addr int64, n int32) (map[replicaRange][]string, string) {
+
+	ranges := make(map[replicaRange][]string)
+	for _, storeID := range replicas {
+		msgs, err := read(storeID, extID, addr, n)
+		if err != nil {
+			if _, ok := err.(*store.ExtentNotFoundError); ok {
+				missing := replicaRange{end: replicaEndMissing}
+				ranges[missing] = append(ranges[missing], storeID)
+				continue
+			}
+			return nil, fmt.Sprintf("cannot read replica %v: %v", storeID, err)
+		}
+		r := newReplicaRange(msgs)
+		if r.end == replicaEndNoMore || r.end == replicaEndError {
+			return nil, fmt.Sprintf("replica %v ended with %v after address %v", storeID, r.end, r.lastAddr)
+		}
+		ranges[r] = append(ranges[r], storeID)
+	}
+	return ranges, ""
+}
+
+// confirmDivergence reads the replicas again where they were found to
+// diverge, and checks that the same replicas still differ
+func confirmDivergence(read replicaReader, extent *shared.Extent, result *extentVerification) bool {
+
+	replicas := extent.GetStoreUUIDs()
+	ranges, inconclusive := readReplicaRanges(read, extent.GetExtentUUID(), replicas, result.DivergedAfter, replicaVerifyBatchSize)
+	if len(inconclusive) > 0 || len(ranges) < 2 {
+		return false
+	}
+
+	divergent := findDivergentReplicas(replicas, ranges)
+	if len(divergent) != len(result.Divergent) {
+		return false
+	}
+	for i := range divergent {
+		if divergent[i] != result.Divergent[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// findDivergentReplicas returns the replicas that are not in the
+// range read by the majority of the replicas, in the order of the
+// extent replicas, or nil if there is no majority
+func findDivergentReplicas(replicas []string, ranges map[replicaRange][]string) []string {
+
+	var majority map[string]struct{}
+	for _, storeIDs := range ranges {
+		if 2*len(storeIDs) > len(replicas) {
+			majority = make(map[string]struct{}, len(storeIDs))
+			for _, storeID := range storeIDs {
+				majority[storeID] = struct{}{}
+			}
+		}
+	}
+
+	if majority == nil {
+		return nil
+	}
+
+	var divergent []string
+	for _, storeID := range replicas {
+		if _, ok := majority[storeID]; !ok {
+			divergent = append(divergent, storeID)
+		}
+	}
+	return divergent
+}
+
+// newReplicaRange computes the checksum of a range of messages
+// read from a replica, along with how the replica ended, if it did
+func newReplicaRange(msgs []*store.ReadMessageContent) replicaRange {
+
+	var r replicaRange
+	h := fnv.New64a()
+
+	for _, msg := range msgs {
+		switch msg.GetType() {
+		case store.ReadMessageContentType_MESSAGE:
+			readMsg := msg.GetMessage()
+			appMsg := readMsg.GetMessage()
+			writeInt64(h, readMsg.GetAddress())
+			writeInt64(h, appMsg.GetSequenceNumber())
+			writeInt64(h, appMsg.GetEnqueueTimeUtc())
+			if payload := appMsg.GetPayload(); payload != nil {
+				h.Write([]byte(payload.GetID()))
+				h.Write(payload.GetData())
+			}
+			r.count++
+			r.lastAddr = readMsg.GetAddress()
+		case store.ReadMessageContentType_SEALED:
+			writeInt64(h, msg.GetSealed().GetSequenceNumber())
+			r.end = replicaEndSealed
+		default:
+			if msg.IsSetNoMoreMessage() {
+				r.end = replicaEndNoMore
+			} else {
+				r.end = replicaEndError
+			}
+		}
+	}
+
+	r.sum = h.Sum64()
+	return r
+}
+
+func writeInt64(h hash.Hash64, v int64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v))
+	h.Write(buf[:])
+}
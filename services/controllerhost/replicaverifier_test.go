@@ -0,0 +1,236 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-thrift/.generated/go/cherami"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/cherami-thrift/.generated/go/store"
+)
+
+type ReplicaVerifierSuite struct {
+	*require.Assertions
+	suite.Suite
+}
+
+// fakeReplica is a sealed extent replica, that
+// holds a message at each of its addresses
+type fakeReplica struct {
+	addrs   []int64
+	data    map[int64]string
+	missing bool
+}
+
+func TestReplicaVerifierSuite(t *testing.T) {
+	suite.Run(t, new(ReplicaVerifierSuite))
+}
+
+func (s *ReplicaVerifierSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+}
+
+func newFakeReplica(begin int64, end int64) *fakeReplica {
+	r := &fakeReplica{data: make(map[int64]string)}
+	for addr := begin; addr < end; addr++ {
+		r.addrs = append(r.addrs, addr*10)
+		r.data[addr*10] = fmt.Sprintf("msg-%d", addr)
+	}
+	return r
+}
+
+// fakeReplicaReader reads the replicas the way the store host
+// does, the seal marker follows the last message if there's room
+func fakeReplicaReader(replicas map[string]*fakeReplica) replicaReader {
+	return func(storeID string, extID string, addr int64, n int32) ([]*store.ReadMessageContent, error) {
+		r := replicas[storeID]
+		if r.missing {
+			return nil, &store.ExtentNotFoundError{ExtentUUID: common.StringPtr(extID)}
+		}
+
+		var result []*store.ReadMessageContent
+		for _, a := range r.addrs {
+			if a <= addr {
+				continue
+			}
+			if int32(len(result)) == n {
+				return result, nil
+			}
+			msg := store.NewReadMessageContent()
+			msg.Type = store.ReadMessageContentTypePtr(store.ReadMessageContentType_MESSAGE)
+			msg.Message = store.NewReadMessage()
+			msg.Message.Address = common.Int64Ptr(a)
+			msg.Message.Message = store.NewAppendMessage()
+			msg.Message.Message.SequenceNumber = common.Int64Ptr(a / 10)
+			msg.Message.Message.Payload = cherami.NewPutMessage()
+			msg.Message.Message.Payload.Data = []byte(r.data[a])
+			result = append(result, msg)
+		}
+		if int32(len(result)) < n {
+			msg := store.NewReadMessageContent()
+			msg.Type = store.ReadMessageContentTypePtr(store.ReadMessageContentType_SEALED)
+			msg.Sealed = store.NewExtentSealedError()
+			msg.Sealed.SequenceNumber = common.Int64Ptr(int64(len(r.addrs)))
+			result = append(result, msg)
+		}
+		return result, nil
+	}
+}
+
+func newFakeExtent(replicas ...string) *shared.Extent {
+	return &shared.Extent{
+		DestinationUUID: common.StringPtr("dst"),
+		ExtentUUID:      common.StringPtr("ext"),
+		StoreUUIDs:      replicas,
+	}
+}
+
+func (s *ReplicaVerifierSuite) TestCompareReplicasConsistent() {
+	replicas := map[string]*fakeReplica{
+		"s1": newFakeReplica(1, 2501),
+		"s2": newFakeReplica(1, 2501),
+		"s3": newFakeReplica(1, 2501),
+	}
+	// the seal marker falls into the next range
+	replicas["s4"] = newFakeReplica(1, 2001)
+	replicas["s5"] = newFakeReplica(1, 2001)
+
+	result := compareReplicas(fakeReplicaReader(replicas), newFakeExtent("s1", "s2", "s3"), 0)
+	s.True(result.Consistent)
+	s.Empty(result.Inconclusive)
+	s.Equal(int64(2500), result.Messages)
+
+	result = compareReplicas(fakeReplicaReader(replicas), newFakeExtent("s4", "s5"), 0)
+	s.True(result.Consistent)
+	s.Equal(int64(2000), result.Messages)
+
+	// only the first messages are compared
+	result = compareReplicas(fakeReplicaReader(replicas), newFakeExtent("s1", "s2", "s3"), 1200)
+	s.True(result.Consistent)
+	s.Equal(int64(1200), result.Messages)
+
+	// the first messages were purged from s2, but not yet from s1
+	replicas["s2"] = newFakeReplica(101, 2501)
+	result = compareReplicas(fakeReplicaReader(replicas), newFakeExtent("s1", "s2", "s3"), 0)
+	s.True(result.Consistent)
+	s.Equal(int64(2400), result.Messages)
+}
+
+func (s *ReplicaVerifierSuite) TestCompareReplicasDivergent() {
+	replicas := map[string]*fakeReplica{
+		"s1": newFakeReplica(1, 2501),
+		"s2": newFakeReplica(1, 2501),
+		"s3": newFakeReplica(1, 2501),
+	}
+	replicas["s2"].data[15000] = "corrupt"
+
+	result := compareReplicas(fakeReplicaReader(replicas), newFakeExtent("s1", "s2", "s3"), 0)
+	s.False(result.Consistent)
+	s.Equal([]string{"s2"}, result.Divergent)
+	s.Equal(int64(10000), result.DivergedAfter)
+	s.Equal(int64(1000), result.Messages)
+
+	// the divergence is past the compared messages
+	result = compareReplicas(fakeReplicaReader(replicas), newFakeExtent("s1", "s2", "s3"), 1000)
+	s.True(result.Consistent)
+
+	// a replica that lost its last messages
+	replicas["s2"] = newFakeReplica(1, 2400)
+	result = compareReplicas(fakeReplicaReader(replicas), newFakeExtent("s1", "s2", "s3"), 0)
+	s.False(result.Consistent)
+	s.Equal([]string{"s2"}, result.Divergent)
+
+	// a replica that lost the extent
+	replicas["s2"].missing = true
+	result = compareReplicas(fakeReplicaReader(replicas), newFakeExtent("s1", "s2", "s3"), 0)
+	s.False(result.Consistent)
+	s.Equal([]string{"s2"}, result.Divergent)
+	s.Equal(int64(0), result.Messages)
+
+	// no majority to tell the healthy replica
+	result = compareReplicas(fakeReplicaReader(replicas), newFakeExtent("s1", "s2"), 0)
+	s.False(result.Consistent)
+	s.Nil(result.Divergent)
+
+	result = compareReplicas(fakeReplicaReader(replicas), newFakeExtent("s1"), 0)
+	s.False(result.Consistent)
+	s.NotEmpty(result.Inconclusive)
+}
+
+func (s *ReplicaVerifierSuite) TestCompareReplicasInconclusive() {
+	replicas := map[string]*fakeReplica{
+		"s1": newFakeReplica(1, 2501),
+		"s2": newFakeReplica(1, 2501),
+		"s3": newFakeReplica(1, 2501),
+	}
+	read := fakeReplicaReader(replicas)
+
+	// a replica whose messages are being purged, or that fails to be
+	// read, is not taken for a divergent one
+	ended := func(end string) replicaReader {
+		return func(storeID string, extID string, addr int64, n int32) ([]*store.ReadMessageContent, error) {
+			msgs, err := read(storeID, extID, addr, n)
+			if storeID != "s2" || addr < 10000 || err != nil {
+				return msgs, err
+			}
+			msg := store.NewReadMessageContent()
+			msg.Type = store.ReadMessageContentTypePtr(store.ReadMessageContentType_ERROR)
+			if end == replicaEndNoMore {
+				msg.NoMoreMessage = store.NewNoMoreMessagesError()
+			}
+			return append(msgs[:1], msg), nil
+		}
+	}
+
+	for _, end := range []string{replicaEndNoMore, replicaEndError} {
+		result := compareReplicas(ended(end), newFakeExtent("s1", "s2", "s3"), 0)
+		s.False(result.Consistent, end)
+		s.NotEmpty(result.Inconclusive, end)
+		s.Nil(result.Divergent, end)
+	}
+}
+
+func (s *ReplicaVerifierSuite) TestConfirmDivergence() {
+	replicas := map[string]*fakeReplica{
+		"s1": newFakeReplica(1, 2501),
+		"s2": newFakeReplica(1, 2501),
+		"s3": newFakeReplica(1, 2501),
+	}
+	replicas["s2"].data[15000] = "corrupt"
+	extent := newFakeExtent("s1", "s2", "s3")
+
+	result := compareReplicas(fakeReplicaReader(replicas), extent, 0)
+	s.Equal([]string{"s2"}, result.Divergent)
+	s.True(confirmDivergence(fakeReplicaReader(replicas), extent, result))
+
+	// the replicas read the same on the second look
+	replicas["s2"].data[15000] = replicas["s1"].data[15000]
+	s.False(confirmDivergence(fakeReplicaReader(replicas), extent, result))
+
+	// another replica differs on the second look
+	replicas["s3"].data[15000] = "corrupt"
+	s.False(confirmDivergence(fakeReplicaReader(replicas), extent, result))
+}
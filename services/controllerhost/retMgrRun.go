@@ -21,8 +21,8 @@
 package controllerhost
 
 // retMgrRunner: ensures that retention-manager actually runs on only one of
-// the controllers. it does so by using ringpop hashing to pick a "chosen"
-// node.
+// the controllers. it does so by running it only on the controller that is
+// the leader for the retention-manager lease.
 
 import (
 	"sync"
@@ -31,6 +31,7 @@ import (
 
 	"github.com/uber-common/bark"
 	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-server/common/dconfig"
 	"github.com/uber/cherami-server/common/metrics"
 	"github.com/uber/cherami-server/services/retentionmgr"
 	"github.com/uber/cherami-thrift/.generated/go/metadata"
@@ -40,12 +41,19 @@ import (
 const (
 	// TODO: read these in from "config"
 	retentionMgrInterval             = 10 * time.Minute
+	retentionMgrFullSweepInterval    = 6 * time.Hour
 	dlqRetentionMgrInterval          = 1 * time.Hour
 	singleCGVisibleExtentGracePeriod = 7 * 24 * time.Hour
 	extentDeleteDeferPeriod          = 3 * time.Hour
 	retentionMgrWorkers              = 8
 )
 
+// values for the retentionMode dynamic config
+const (
+	retentionModeOn     = "on"
+	retentionModeDryRun = "dryrun"
+)
+
 type (
 	// retMgrRunnerContext are args passed into newRetMgr
 	retMgrRunnerContext struct {
@@ -56,12 +64,15 @@ type (
 		log            bark.Logger
 		m3Client       metrics.Client
 		localZone      string
+		leaders        *leaderElection
+		cfgMgr         dconfig.ConfigManager
 	}
 
 	// retMgrRunner holds the instance context
 	retMgrRunner struct {
 		*retMgrRunnerContext
 
+		mgrLock        sync.Mutex // protects the lazy init of retentionMgr
 		retentionMgr   *retentionMgr.RetentionManager
 		running        uint32
 		listenC        chan *common.RingpopListenerEvent
@@ -101,6 +112,11 @@ func (t *retMgrRunner) worker() {
 
 	defer t.Done()
 
+	// leadership is re-checked on every lease renewal, in case it
+	// changed without any change to the ring
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+
 	// register with ringpop to get notified on 'controller' events
 	err := t.ringpop.AddListener(common.ControllerServiceName, common.ControllerServiceName+"-retention", t.listenC)
 
@@ -126,6 +142,14 @@ forever:
 				t.stopRetentionMgr()
 			}
 
+		case <-ticker.C:
+
+			if t.isPrimary() {
+				t.startRetentionMgr()
+			} else {
+				t.stopRetentionMgr()
+			}
+
 		case <-t.stopC: // stopped
 			t.log.Debug("retMgrRunner: Stop notification")
 			t.stopRetentionMgr()
@@ -134,43 +158,116 @@ forever:
 	}
 }
 
-// runHere: checks if retention manager should run on this host
+// isPrimary: checks if retention manager should run on this host
 func (t *retMgrRunner) isPrimary() bool {
+	return t.leaders.IsLeader(leaseRetentionMgr)
+}
 
-	// do a findhost on a controller, with key "retention-manager"
-	hostInfo, err := t.ringpop.FindHostForKey(common.ControllerServiceName, "retention-manager")
+// getRetentionMgr: returns the retention manager, creating it the first time
+func (t *retMgrRunner) getRetentionMgr() *retentionMgr.RetentionManager {
 
+	t.mgrLock.Lock()
+	defer t.mgrLock.Unlock()
+
+	if t.retentionMgr == nil {
+
+		opts := &retentionMgr.Options{
+			RetentionInterval: retentionMgrInterval,
+			FullSweepInterval: retentionMgrFullSweepInterval,
+			// DLQRetentionInterval: dlqRetentionMgrInterval,
+			SingleCGVisibleExtentGracePeriod: singleCGVisibleExtentGracePeriod,
+			ExtentDeleteDeferPeriod:          extentDeleteDeferPeriod,
+			NumWorkers:                       retentionMgrWorkers,
+			LocalZone:                        t.retMgrRunnerContext.localZone,
+			DryRun:                           t.isDryRun(),
+			MaxRetainedBytes:                 t.maxRetainedBytes,
+		}
+
+		t.retentionMgr = retentionMgr.New(opts, t.metadataClient, t.clientFactory, t.m3Client, t.log)
+	}
+
+	return t.retentionMgr
+}
+
+// isDryRun: checks if retention manager should only compute
+// and log its decisions, without acting on them
+func (t *retMgrRunner) isDryRun() bool {
+
+	if t.cfgMgr == nil {
+		return false
+	}
+
+	cfgIface, err := t.cfgMgr.Get(common.ControllerServiceName, `*`, `*`, `*`)
 	if err != nil {
-		t.log.WithField(common.TagErr, err).Error(`retMgrRunner: FindHostForKey failed`)
-		return true // NB: on failure, we default to 'true'
+		return false
 	}
 
-	// if the host-id matches ours, run here!
-	return t.hostID == hostInfo.UUID
+	cfg, ok := cfgIface.(ControllerDynamicConfig)
+	return ok && cfg.RetentionMode == retentionModeDryRun
+}
+
+// maxRetainedBytes: returns the size retention limit for the given destination
+func (t *retMgrRunner) maxRetainedBytes(dstPath string) int64 {
+
+	if t.cfgMgr == nil {
+		return 0
+	}
+
+	cfgIface, err := t.cfgMgr.Get(common.ControllerServiceName, `*`, `*`, `*`)
+	if err != nil {
+		return 0
+	}
+
+	cfg, ok := cfgIface.(ControllerDynamicConfig)
+	if !ok {
+		return 0
+	}
+
+	logFn := func() bark.Logger {
+		return t.log.WithField(common.TagDstPth, common.FmtDstPth(dstPath))
+	}
+
+	return common.OverrideValueByPrefix(logFn, dstPath, cfg.MaxRetainedBytesByPath, 0, `MaxRetainedBytesByPath`)
 }
 
 // startRetentionMgr: starts retention manager, if it were not already running
 func (t *retMgrRunner) startRetentionMgr() {
 
+	// the mode is refreshed on every call, so that it can be
+	// switched without restarting the retention manager
+	retMgr := t.getRetentionMgr()
+	retMgr.SetDryRun(t.isDryRun())
+
 	if atomic.CompareAndSwapUint32(&t.running, 0, 1) {
 
-		// if uninitialized, initialize an instance (will happen only the first time)
-		if t.retentionMgr == nil {
+		t.log.Debug("retMgrRunner: Starting retention manager")
+		retMgr.Start()
+	}
+}
 
-			opts := &retentionMgr.Options{
-				RetentionInterval: retentionMgrInterval,
-				// DLQRetentionInterval: dlqRetentionMgrInterval,
-				SingleCGVisibleExtentGracePeriod: singleCGVisibleExtentGracePeriod,
-				ExtentDeleteDeferPeriod:          extentDeleteDeferPeriod,
-				NumWorkers:                       retentionMgrWorkers,
-				LocalZone:                        t.retMgrRunnerContext.localZone,
-			}
+// explain: computes the retention for the extents of a destination,
+// without acting on it; this can be called on any controller
+func (t *retMgrRunner) explain(dstUUID string) ([]*retentionMgr.ExtentRetention, error) {
+	return t.getRetentionMgr().Explain(dstUUID)
+}
 
-			t.retentionMgr = retentionMgr.New(opts, t.metadataClient, t.clientFactory, t.m3Client, t.log)
-		}
+// extentChanged: signals the retention manager, if it runs on this controller,
+// that the retention of an extent needs to be recomputed; the changes seen by
+// the other controllers are left to the periodic recompute and full sweeps
+func (t *retMgrRunner) extentChanged(dstUUID, extUUID string) {
 
-		t.log.Debug("retMgrRunner: Starting retention manager")
-		t.retentionMgr.Start()
+	if t != nil && t.IsRunning() {
+		t.getRetentionMgr().ExtentChanged(dstUUID, extUUID)
+	}
+}
+
+// destinationChanged: signals the retention manager, if it runs on this
+// controller, that the retention of all the extents of a destination
+// needs to be recomputed
+func (t *retMgrRunner) destinationChanged(dstUUID string) {
+
+	if t != nil && t.IsRunning() {
+		t.getRetentionMgr().DestinationChanged(dstUUID)
 	}
 }
 
@@ -179,7 +276,7 @@ func (t *retMgrRunner) stopRetentionMgr() {
 
 	if atomic.CompareAndSwapUint32(&t.running, 1, 0) {
 
-		t.retentionMgr.Stop()
+		t.getRetentionMgr().Stop()
 		t.log.Debug("retMgrRunner: Stopped retention manager")
 	}
 }
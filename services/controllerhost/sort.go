@@ -60,3 +60,55 @@ func sortExtentStatsByTime(stats []*shared.ExtentStats) {
 	}
 	sort.Sort(sorter)
 }
+
+type storeHostLoadSorter []*storeHostLoad
+
+// Len implements sort.Interace
+func (s storeHostLoadSorter) Len() int {
+	return len(s)
+}
+
+// Swap implements sort.Interface.
+func (s storeHostLoadSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less implements sort.Interface
+func (s storeHostLoadSorter) Less(i, j int) bool {
+	return s[i].score < s[j].score
+}
+
+// sortStoreHostsByLoad sorts the store hosts by
+// ascending load score, preserving the order of
+// hosts with equal scores
+func sortStoreHostsByLoad(loads []*storeHostLoad) {
+	sort.Stable(storeHostLoadSorter(loads))
+}
+
+type storeHostKeySorter struct {
+	loads []*storeHostLoad
+	keys  []float64
+}
+
+// Len implements sort.Interace
+func (s *storeHostKeySorter) Len() int {
+	return len(s.loads)
+}
+
+// Swap implements sort.Interface.
+func (s *storeHostKeySorter) Swap(i, j int) {
+	s.loads[i], s.loads[j] = s.loads[j], s.loads[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// Less implements sort.Interface
+func (s *storeHostKeySorter) Less(i, j int) bool {
+	return s.keys[i] > s.keys[j]
+}
+
+// sortStoreHostsByKey sorts the store hosts by
+// descending key, where keys[i] is the key of
+// loads[i]; both slices are reordered
+func sortStoreHostsByKey(loads []*storeHostLoad, keys []float64) {
+	sort.Sort(&storeHostKeySorter{loads: loads, keys: keys})
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/common"
+	m "github.com/uber/cherami-thrift/.generated/go/metadata"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// A store host is drained by setting the admin status in its placement
+// config to draining. This keeps every controller from placing new
+// extents on it, and lets the primary controller find the store hosts
+// to drain on every extent monitor scan. Draining seals the open extents
+// on the host and re-replicates the sealed ones to other store hosts.
+const (
+	storeAdminStatusDraining = "draining"
+	storeAdminStatusKey      = "adminstatus"
+)
+
+// storeDrainStatus is the progress of draining a store host
+type storeDrainStatus struct {
+	StoreUUID string `json:"storeUUID"`
+	Draining  bool   `json:"draining"`
+	// extents on the host that need to be sealed first
+	OpenExtents int `json:"openExtents"`
+	// extents on the host that still have to be re-replicated
+	SealedExtents int `json:"sealedExtents"`
+	// sealed extents on the host that every consumer group consumed
+	ConsumedExtents int `json:"consumedExtents"`
+	// re-replications in progress on this controller
+	ReReplicating int `json:"reReplicating"`
+	// true when the host holds nothing anyone needs
+	Drained bool `json:"drained"`
+}
+
+// isStoreDraining returns true if the admin status
+// of the given store host is set to draining
+func isStoreDraining(context *Context, host *common.HostInfo) bool {
+	cfgObj, err := context.cfgMgr.Get(common.StoreServiceName, "*", host.Sku, host.Name)
+	if err != nil {
+		return false
+	}
+	cfg, ok := cfgObj.(StorePlacementConfig)
+	return ok && cfg.AdminStatus == storeAdminStatusDraining
+}
+
+// setStoreDraining persists the draining admin status for the store
+// host. The config is keyed by sku and hostname, so the host must be
+// part of the ring for its sku and name to be known.
+func setStoreDraining(ctx thrift.Context, context *Context, mClient m.TChanMetadataService, host *common.HostInfo) error {
+	req := &m.UpdateServiceConfigRequest{
+		ConfigItem: &m.ServiceConfigItem{
+			ServiceName:    common.StringPtr(common.StoreServiceName),
+			ServiceVersion: common.StringPtr("*"),
+			Sku:            common.StringPtr(host.Sku),
+			Hostname:       common.StringPtr(host.Name),
+			ConfigKey:      common.StringPtr(storeAdminStatusKey),
+			ConfigValue:    common.StringPtr(storeAdminStatusDraining),
+		},
+	}
+	if err := mClient.UpdateServiceConfig(ctx, req); err != nil {
+		return err
+	}
+	context.log.WithFields(bark.Fields{
+		common.TagStor:   common.FmtStor(host.UUID),
+		common.TagHostIP: host.Addr,
+	}).Info("Store host is being drained")
+	return nil
+}
+
+// clearStoreDraining removes the admin status override of the store
+// host, which stops the draining. Re-replications already in progress
+// are not aborted.
+func clearStoreDraining(ctx thrift.Context, context *Context, mClient m.TChanMetadataService, host *common.HostInfo) error {
+	req := &m.DeleteServiceConfigRequest{
+		ServiceName:    common.StringPtr(common.StoreServiceName),
+		ServiceVersion: common.StringPtr("*"),
+		Sku:            common.StringPtr(host.Sku),
+		Hostname:       common.StringPtr(host.Name),
+		ConfigKey:      common.StringPtr(storeAdminStatusKey),
+	}
+	if err := mClient.DeleteServiceConfig(ctx, req); err != nil {
+		return err
+	}
+	context.log.WithFields(bark.Fields{
+		common.TagStor:   common.FmtStor(host.UUID),
+		common.TagHostIP: host.Addr,
+	}).Info("Store host is no longer being drained")
+	return nil
+}
+
+// readStoreDrainStatus computes the drain progress of the store host
+// from the extents that metadata still lists on the host. A replica is
+// swapped in metadata once its copy is sealed on the new store host, so
+// the host is drained when metadata lists nothing on it that is needed.
+func readStoreDrainStatus(context *Context, host *common.HostInfo) (*storeDrainStatus, error) {
+	status := &storeDrainStatus{
+		StoreUUID: host.UUID,
+		Draining:  isStoreDraining(context, host),
+	}
+
+	open, err := context.mm.ListExtentsByStoreIDStatus(host.UUID, common.MetadataExtentStatusPtr(shared.ExtentStatus_OPEN))
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := context.mm.ListExtentsByStoreIDStatus(host.UUID, common.MetadataExtentStatusPtr(shared.ExtentStatus_SEALED))
+	if err != nil {
+		return nil, err
+	}
+
+	status.OpenExtents = len(open)
+	for _, stat := range sealed {
+		needed, e := extentHasUnconsumedData(context, stat.GetExtent().GetDestinationUUID(), stat.GetExtent().GetExtentUUID())
+		if e != nil {
+			return nil, e
+		}
+		if needed {
+			status.SealedExtents++
+		} else {
+			status.ConsumedExtents++
+		}
+	}
+
+	iter := context.extentRepairs.inProgress.Iter()
+	for entry := range iter.Entries() {
+		if s, ok := entry.Value.(*reReplicationStatus); ok && s.FailedStoreUUID == host.UUID {
+			status.ReReplicating++
+		}
+	}
+	iter.Close()
+
+	status.Drained = status.OpenExtents == 0 && status.SealedExtents == 0 && status.ReReplicating == 0
+	return status, nil
+}
+
+// extentHasUnconsumedData tells whether a consumer group of the destination
+// can still read the sealed extent. Without any consumer group, one created
+// later can read it, so it is needed until every consumer group consumed it.
+func extentHasUnconsumedData(context *Context, dstID string, extentID string) (bool, error) {
+	cgs, err := context.mm.ListConsumerGroupsByDstID(dstID)
+	if err != nil {
+		return false, err
+	}
+
+	var consumers int
+	for _, cg := range cgs {
+		if cg.GetStatus() == shared.ConsumerGroupStatus_DELETED {
+			continue
+		}
+		consumers++
+		cge, e := context.mm.ReadConsumerGroupExtent(dstID, cg.GetConsumerGroupUUID(), extentID)
+		if e != nil {
+			if _, ok := e.(*shared.EntityNotExistsError); ok {
+				// the consumer group didn't get to the extent yet
+				return true, nil
+			}
+			return false, e
+		}
+		if cge.GetStatus() != m.ConsumerGroupExtentStatus_CONSUMED {
+			return true, nil
+		}
+	}
+	return consumers == 0, nil
+}
+
+// resolveStoreHost returns the ring membership info of the store host
+func resolveStoreHost(context *Context, storeUUID string) (*common.HostInfo, error) {
+	addr, err := context.rpm.ResolveUUID(common.StoreServiceName, storeUUID)
+	if err != nil {
+		return nil, err
+	}
+	return context.rpm.FindHostForAddr(common.StoreServiceName, addr)
+}
+
+// driveStoreDrains enqueues a drain pass for every store host in the
+// ring that is being drained. Passes on a drained host are cheap
+func driveStoreDrains(context *Context) {
+	hosts, err := context.rpm.GetHosts(common.StoreServiceName)
+	if err != nil {
+		return
+	}
+	for _, host := range hosts {
+		if !isStoreDraining(context, host) {
+			continue
+		}
+		if !context.eventPipeline.Add(NewStoreHostDrainEvent(host.UUID)) {
+			context.log.WithField(common.TagStor, common.FmtStor(host.UUID)).Error("Failed to enqueue StoreHostDrainEvent")
+		}
+	}
+}
@@ -214,6 +214,27 @@ func convertDestZoneConfigToInternal(destZoneCfg *c.DestinationZoneConfig) *shar
 	return internalDestZoneCfg
 }
 
+// convertSchemaInfoFromInternal converts internal shared SchemaInfo to Cherami SchemaInfo
+func convertSchemaInfoFromInternal(internalSchemaInfo *shared.SchemaInfo) *c.SchemaInfo {
+	schemaInfo := c.NewSchemaInfo()
+	schemaInfo.Type = common.StringPtr(internalSchemaInfo.GetType())
+	schemaInfo.Version = common.Int32Ptr(internalSchemaInfo.GetVersion())
+	schemaInfo.Data = internalSchemaInfo.GetData()
+	schemaInfo.Source = common.StringPtr(internalSchemaInfo.GetSource())
+	schemaInfo.CreatedTimeUtc = common.Int64Ptr(internalSchemaInfo.GetCreatedTimeUtc())
+	return schemaInfo
+}
+
+// convertSchemaInfoToInternal converts Cherami SchemaInfo to internal shared SchemaInfo.
+// The version is assigned by the metadata service, hence it's not converted.
+func convertSchemaInfoToInternal(schemaInfo *c.SchemaInfo) *shared.SchemaInfo {
+	internalSchemaInfo := shared.NewSchemaInfo()
+	internalSchemaInfo.Type = common.StringPtr(schemaInfo.GetType())
+	internalSchemaInfo.Data = schemaInfo.GetData()
+	internalSchemaInfo.Source = common.StringPtr(schemaInfo.GetSource())
+	return internalSchemaInfo
+}
+
 // convertCreateDestRequestToInternal converts Cherami CreateDestinationRequest to internal shared CreateDestinationRequest
 func convertCreateDestRequestToInternal(createRequest *c.CreateDestinationRequest) *shared.CreateDestinationRequest {
 	internalCreateRequest := shared.NewCreateDestinationRequest()
@@ -231,6 +252,9 @@ func convertCreateDestRequestToInternal(createRequest *c.CreateDestinationReques
 			internalCreateRequest.ZoneConfigs = append(internalCreateRequest.ZoneConfigs, convertDestZoneConfigToInternal(destZoneCfg))
 		}
 	}
+	if createRequest.IsSetSchemaInfo() {
+		internalCreateRequest.SchemaInfo = convertSchemaInfoToInternal(createRequest.GetSchemaInfo())
+	}
 	return internalCreateRequest
 }
 
@@ -243,6 +267,9 @@ func convertUpdateDestRequestToInternal(updateRequest *c.UpdateDestinationReques
 	internalUpdateRequest.UnconsumedMessagesRetention = common.Int32Ptr(updateRequest.GetUnconsumedMessagesRetention())
 	internalUpdateRequest.OwnerEmail = common.StringPtr(updateRequest.GetOwnerEmail())
 	internalUpdateRequest.ChecksumOption = common.InternalChecksumOptionPtr(shared.ChecksumOption(updateRequest.GetChecksumOption()))
+	if updateRequest.IsSetSchemaInfo() {
+		internalUpdateRequest.SchemaInfo = convertSchemaInfoToInternal(updateRequest.GetSchemaInfo())
+	}
 	return internalUpdateRequest
 }
 
@@ -272,6 +299,9 @@ func convertDestinationFromInternal(internalDestDesc *shared.DestinationDescript
 			destDesc.ZoneConfigs.Configs = append(destDesc.ZoneConfigs.Configs, convertDestZoneConfigFromInternal(_destZoneCfg))
 		}
 	}
+	if internalDestDesc.IsSetSchemaInfo() {
+		destDesc.SchemaInfo = convertSchemaInfoFromInternal(internalDestDesc.GetSchemaInfo())
+	}
 	return destDesc
 }
 
@@ -343,7 +373,8 @@ func convertDeleteCGRequestToInternal(deleteRequest *c.DeleteConsumerGroupReques
 func (h *Frontend) convertConsumerGroupFromInternal(ctx thrift.Context, _cgDesc *shared.ConsumerGroupDescription) (cgDesc *c.ConsumerGroupDescription, err error) {
 
 	// Check cache to map the destination UUID to destination path
-	// DEVNOTE: don't need to worry about cache invalidation here, since a destination UUID will never map to another path; just not vice-versa
+	// DEVNOTE: a renamed destination keeps its old path as an alias, which still resolves to the same UUID;
+	// so a stale entry here only means that the consumer group is reported with the old (still valid) path
 
 	destPath := h.readCacheDestinationPathForUUID(destinationUUID(_cgDesc.GetDestinationUUID()))
 
@@ -85,6 +85,10 @@ func destCreateRequestToDesc(createRequest *c.CreateDestinationRequest) *shared.
 			destDesc.ZoneConfigs = append(destDesc.ZoneConfigs, convertDestZoneConfigToInternal(destZoneCfg))
 		}
 	}
+	if createRequest.IsSetSchemaInfo() {
+		destDesc.SchemaInfo = convertSchemaInfoToInternal(createRequest.GetSchemaInfo())
+		destDesc.SchemaInfo.Version = common.Int32Ptr(1)
+	}
 	return destDesc
 }
 
@@ -97,6 +101,10 @@ func destUpdateRequestToDesc(updateRequest *c.UpdateDestinationRequest) *shared.
 	destDesc.UnconsumedMessagesRetention = common.Int32Ptr(updateRequest.GetUnconsumedMessagesRetention())
 	destDesc.OwnerEmail = common.StringPtr(updateRequest.GetOwnerEmail())
 	destDesc.ChecksumOption = common.InternalChecksumOptionPtr(shared.ChecksumOption(updateRequest.GetChecksumOption()))
+	if updateRequest.IsSetSchemaInfo() {
+		destDesc.SchemaInfo = convertSchemaInfoToInternal(updateRequest.GetSchemaInfo())
+		destDesc.SchemaInfo.Version = common.Int32Ptr(2)
+	}
 	return destDesc
 }
 
@@ -246,6 +254,10 @@ func (s *FrontendHostSuite) TestFrontendHostCreateDestination() {
 			},
 		},
 	}
+	req.SchemaInfo = &c.SchemaInfo{
+		Type: common.StringPtr(common.SchemaTypeJSON),
+		Data: []byte(`{"type": "object"}`),
+	}
 
 	s.mockController.On("CreateDestination", mock.Anything, mock.Anything).Return(destCreateRequestToDesc(req), nil).Run(func(args mock.Arguments) {
 		createReq := args.Get(1).(*shared.CreateDestinationRequest)
@@ -257,6 +269,8 @@ func (s *FrontendHostSuite) TestFrontendHostCreateDestination() {
 		s.Equal(createReq.GetIsMultiZone(), req.GetIsMultiZone())
 		s.Equal(len(createReq.GetZoneConfigs()), len(req.GetZoneConfigs().GetConfigs()))
 		s.Equal(createReq.GetZoneConfigs()[0].GetRemoteExtentReplicaNum(), req.GetZoneConfigs().GetConfigs()[0].GetRemoteExtentReplicaNum())
+		s.Equal(createReq.GetSchemaInfo().GetType(), req.GetSchemaInfo().GetType())
+		s.Equal(createReq.GetSchemaInfo().GetData(), req.GetSchemaInfo().GetData())
 	})
 
 	dst, err := frontendHost.CreateDestination(ctx, req)
@@ -272,6 +286,8 @@ func (s *FrontendHostSuite) TestFrontendHostCreateDestination() {
 		s.Equal(dst.GetIsMultiZone(), req.GetIsMultiZone())
 		s.Equal(len(dst.ZoneConfigs.GetConfigs()), len(req.ZoneConfigs.GetConfigs()))
 		s.Equal(dst.ZoneConfigs.GetConfigs()[0].GetRemoteExtentReplicaNum(), req.ZoneConfigs.GetConfigs()[0].GetRemoteExtentReplicaNum())
+		s.Equal(int32(1), dst.GetSchemaInfo().GetVersion())
+		s.Equal(req.GetSchemaInfo().GetData(), dst.GetSchemaInfo().GetData())
 	}
 }
 
@@ -393,8 +409,16 @@ func (s *FrontendHostSuite) TestFrontendHostUpdateDestination() {
 	req.ConsumedMessagesRetention = common.Int32Ptr(1800)
 	req.UnconsumedMessagesRetention = common.Int32Ptr(3600)
 	req.OwnerEmail = common.StringPtr("test_up@uber.com")
+	req.SchemaInfo = &c.SchemaInfo{
+		Type: common.StringPtr(common.SchemaTypeJSON),
+		Data: []byte(`{"type": "object"}`),
+	}
 	destDesc := destUpdateRequestToDesc(req)
-	s.mockController.On("UpdateDestination", mock.Anything, mock.Anything).Return(destDesc, nil)
+	s.mockController.On("UpdateDestination", mock.Anything, mock.Anything).Return(destDesc, nil).Run(func(args mock.Arguments) {
+		updateReq := args.Get(1).(*shared.UpdateDestinationRequest)
+		s.Equal(updateReq.GetSchemaInfo().GetType(), req.GetSchemaInfo().GetType())
+		s.Equal(updateReq.GetSchemaInfo().GetData(), req.GetSchemaInfo().GetData())
+	})
 	s.mockMeta.On("ReadDestination", mock.Anything, mock.Anything).Return(destDesc, nil)
 
 	dst, err := frontendHost.UpdateDestination(ctx, req)
@@ -408,6 +432,7 @@ func (s *FrontendHostSuite) TestFrontendHostUpdateDestination() {
 		s.Equal(dst.GetUnconsumedMessagesRetention(), int32(3600))
 		s.Equal(dst.GetStatus(), c.DestinationStatus_SENDONLY)
 		s.Equal(dst.GetOwnerEmail(), "test_up@uber.com")
+		s.Equal(int32(2), dst.GetSchemaInfo().GetVersion())
 	}
 }
 
@@ -37,6 +37,12 @@ const (
 	UkeyExtMsgs = "inputhost.HostPerExtentMsgsLimitPerSecond"
 	// UkeyConnMsgs is the uconfig key for HostPerConnMsgsLimitPerSecond
 	UkeyConnMsgs = "inputhost.HostPerConnMsgsLimitPerSecond"
+	// UkeyMaxMsgSize is the uconfig key for HostMaxMessageSize
+	UkeyMaxMsgSize = "inputhost.HostMaxMessageSize"
+	// UkeyMsgChunkSize is the uconfig key for HostMessageChunkSize
+	UkeyMsgChunkSize = "inputhost.HostMessageChunkSize"
+	// UkeyDrainTimeout is the uconfig key for HostDrainTimeoutSeconds
+	UkeyDrainTimeout = "inputhost.HostDrainTimeoutSeconds"
 )
 
 func (h *InputHost) registerInt() {
@@ -47,6 +53,9 @@ func (h *InputHost) registerInt() {
 	handlerMap[UkeyMaxConnPerDest] = dconfig.GenerateIntHandler(UkeyMaxConnPerDest, h.SetMaxConnPerDest, h.GetMaxConnPerDest)
 	handlerMap[UkeyExtMsgs] = dconfig.GenerateIntHandler(UkeyExtMsgs, h.SetExtMsgsLimitPerSecond, h.GetExtMsgsLimitPerSecond)
 	handlerMap[UkeyConnMsgs] = dconfig.GenerateIntHandler(UkeyConnMsgs, h.SetConnMsgsLimitPerSecond, h.GetConnMsgsLimitPerSecond)
+	handlerMap[UkeyMaxMsgSize] = dconfig.GenerateIntHandler(UkeyMaxMsgSize, h.SetMaxMessageSize, h.GetMaxMessageSize)
+	handlerMap[UkeyMsgChunkSize] = dconfig.GenerateIntHandler(UkeyMsgChunkSize, h.SetMessageChunkSize, h.GetMessageChunkSize)
+	handlerMap[UkeyDrainTimeout] = dconfig.GenerateIntHandler(UkeyDrainTimeout, h.SetDrainTimeoutSeconds, h.GetDrainTimeoutSeconds)
 	h.dConfigClient.AddHandlers(handlerMap)
 	// Add verify function for the dynamic config value
 	verifierMap := make(map[string]dconfig.Verifier)
@@ -55,6 +64,9 @@ func (h *InputHost) registerInt() {
 	verifierMap[UkeyMaxConnPerDest] = dconfig.GenerateIntMaxMinVerifier(UkeyMaxConnPerDest, 1, common.MaxHostMaxConnPerDestination)
 	verifierMap[UkeyExtMsgs] = dconfig.GenerateIntMaxMinVerifier(UkeyExtMsgs, 1, common.MaxHostPerExtentMsgsLimitPerSecond)
 	verifierMap[UkeyConnMsgs] = dconfig.GenerateIntMaxMinVerifier(UkeyConnMsgs, 1, common.MaxHostPerConnMsgsLimitPerSecond)
+	verifierMap[UkeyMaxMsgSize] = dconfig.GenerateIntMaxMinVerifier(UkeyMaxMsgSize, 1, common.MaxHostMaxMessageSize)
+	verifierMap[UkeyMsgChunkSize] = dconfig.GenerateIntMaxMinVerifier(UkeyMsgChunkSize, 1, common.MaxHostMessageChunkSize)
+	verifierMap[UkeyDrainTimeout] = dconfig.GenerateIntMaxMinVerifier(UkeyDrainTimeout, 0, common.MaxHostDrainTimeoutSeconds)
 	h.dConfigClient.AddVerifiers(verifierMap)
 }
 
@@ -69,6 +69,7 @@ type (
 		lastSuccessSeqNo       int64      // last sequence number where we replied success
 		lastSuccessSeqNoCh     chan int64 // last sequence number where we replied success
 		lastSentWatermark      int64      // last watermark sent to the replicas
+		numInflight            int64      // messages sent to the replicas and not acked yet
 
 		waitWriteWG   sync.WaitGroup
 		waitReadWG    sync.WaitGroup
@@ -107,6 +108,8 @@ type (
 		lastExtLoadReportedTime int64 // unix nanos when the last extent metrics were reported
 
 		minimumAllowedMessageDelaySeconds int32 // min delay on messages
+
+		inputHost *InputHost
 	}
 
 	// Holds a particular extent for use by multiple publisher connections.
@@ -125,6 +128,9 @@ type (
 		putMsgAck    chan<- *cherami.PutMessageAck
 		sentTime     time.Time
 		userContext  map[string]string // user specified context to pass through
+		// intermediateChunk is set for all but the last chunk of a chunked message;
+		// the ack of the last chunk is the ack of the whole message
+		intermediateChunk bool
 	}
 
 	// replicaInfo keeps track of both the replicaConnection and a timer object for this connection
@@ -202,6 +208,7 @@ func newExtConnection(destUUID string, pathCache *inPathCache, extUUID string, n
 		dstMetrics:              pathCache.dstMetrics,
 		hostMetrics:             pathCache.hostMetrics,
 		lastExtLoadReportedTime: time.Now().UnixNano(),
+		inputHost:               pathCache.inputHost,
 	}
 	if pathCache.destType == shared.DestinationType_LOG {
 		conn.lastSuccessSeqNoCh = make(chan int64, 1)
@@ -382,6 +389,7 @@ func (conn *extHost) sendMessageToReplicas(pr *inPutMessage, extSendTimer *commo
 	if !watermarkOnly {
 		msg.Payload = pr.putMsg
 		appendMsgAckCh = make(chan *store.AppendMessageAck, 5)
+		conn.extMetrics.Add(load.ExtentMetricBytesIn, int64(len(pr.putMsg.GetData())))
 	}
 	if watermark != nil && conn.lastSentWatermark < *watermark {
 		msg.FullyReplicatedWatermark = watermark
@@ -428,10 +436,17 @@ func (conn *extHost) sendMessageToReplicas(pr *inPutMessage, extSendTimer *commo
 	}
 
 	if !watermarkOnly {
+		// the publisher gets back the user context it sent, without the chunk position
+		userContext := pr.putMsg.GetUserContext()
+		if pr.chunkOf != nil {
+			userContext = pr.chunkOf.GetUserContext()
+		}
+
 		extSendTimer.Reset(replicaSendTimeout)
 		// this is for the extHost's inflight messages for a successful message
 		select {
-		case conn.replyClientCh <- writeResponse{pr.putMsg.GetID(), sequenceNumber, appendMsgAckCh, pr.putMsgAckCh, pr.putMsgRecvTime, pr.putMsg.GetUserContext()}:
+		case conn.replyClientCh <- writeResponse{pr.putMsg.GetID(), sequenceNumber, appendMsgAckCh, pr.putMsgAckCh, pr.putMsgRecvTime, userContext, pr.intermediateChunk}:
+			atomic.AddInt64(&conn.numInflight, 1)
 		case <-extSendTimer.C:
 			conn.logger.WithField(`lenReplyClientCh`, len(conn.replyClientCh)).Error(`inputhost: exthost: sending msg to the replyClientCh on exthost timed out`)
 			err = ErrTimeout
@@ -514,19 +529,14 @@ func (conn *extHost) writeMessagesPump() {
 func (conn *extHost) sendMessage(pr *inPutMessage, extSendTimer *common.Timer, watermark *int64) {
 	// make sure we can satisfy the rate, if needed
 	if conn.limitsEnabled {
-		if ok, _ := conn.GetExtTokenBucketValue().TryConsume(1); !ok {
+		if ok, wait := conn.GetExtTokenBucketValue().TryConsume(1); !ok {
 			// we couldn't acquire the token. just return throttled error here
 			conn.logger.
 				WithField(common.TagInPutAckID, common.FmtInPutAckID(pr.putMsg.GetID())).
 				Warn("inputhost: extHost: rate exceeded. throttling the message")
 			// Immediately send throttled status back to the client so that
 			// the client can throttle
-			pr.putMsgAckCh <- &cherami.PutMessageAck{
-				ID:          common.StringPtr(pr.putMsg.GetID()),
-				UserContext: pr.putMsg.GetUserContext(),
-				Status:      common.CheramiStatusPtr(cherami.Status_THROTTLED),
-				Message:     common.StringPtr("throttling: inputhost rate exceeded"),
-			}
+			pr.putMsgAckCh <- createThrottledAck(pr.putMsg, "throttling: inputhost rate exceeded", wait, conn.GetMsgsLimitPerSecond())
 			return
 		}
 	}
@@ -553,21 +563,76 @@ func (conn *extHost) sendMessage(pr *inPutMessage, extSendTimer *common.Timer, w
 		return
 	}
 
-	sequenceNumber, err := conn.sendMessageToReplicas(pr, extSendTimer, watermark)
-	if err != nil {
-		// For now, lets reply Status_FAILED immediately and
-		// close the connection if we got an error.
-		// this will result in the creation of a new extent, probably.
+	// the ttl, if any, is stored along with the message and enforced by the outputhost;
+	// reject malformed values here, rather than silently never expiring the message
+	if _, err := common.GetMessageTTL(pr.putMsg); err != nil {
+
+		conn.logger.
+			WithField(common.TagInPutAckID, common.FmtInPutAckID(pr.putMsg.GetID())).
+			WithField(common.TagErr, err).
+			Warn("inputhost: extHost: invalid message ttl; rejecting message")
+
 		pr.putMsgAckCh <- &cherami.PutMessageAck{
 			ID:          common.StringPtr(pr.putMsg.GetID()),
 			UserContext: pr.putMsg.GetUserContext(),
 			Status:      common.CheramiStatusPtr(cherami.Status_FAILED),
 			Message:     common.StringPtr(err.Error()),
 		}
-		go conn.close()
+
+		return
+	}
+
+	if maxSize := conn.inputHost.GetMaxMessageSize(); len(pr.putMsg.GetData()) > maxSize {
+
+		conn.logger.
+			WithField(common.TagInPutAckID, common.FmtInPutAckID(pr.putMsg.GetID())).
+			WithField(`size`, len(pr.putMsg.GetData())).
+			Warn("inputhost: extHost: message exceeds max message size; rejecting message")
+
+		pr.putMsgAckCh <- &cherami.PutMessageAck{
+			ID:          common.StringPtr(pr.putMsg.GetID()),
+			UserContext: pr.putMsg.GetUserContext(),
+			Status:      common.CheramiStatusPtr(cherami.Status_FAILED),
+			Message:     common.StringPtr(fmt.Sprintf("message size %d exceeds the max message size %d", len(pr.putMsg.GetData()), maxSize)),
+		}
+
 		return
 	}
 
+	// large messages are split into chunks, which are written to this extent back-to-back
+	// and reassembled by the outputhost; this way a single large message doesn't block the
+	// replica streams for long. Only the ack of the last chunk is sent back to the publisher.
+	var sequenceNumber int64
+	chunks := common.SplitMessage(pr.putMsg, conn.inputHost.GetMessageChunkSize())
+	for i, chunk := range chunks {
+		chunkPr := pr
+		if len(chunks) > 1 {
+			chunkPr = &inPutMessage{
+				putMsg:            chunk,
+				putMsgAckCh:       pr.putMsgAckCh,
+				putMsgRecvTime:    pr.putMsgRecvTime,
+				intermediateChunk: i < len(chunks)-1,
+				chunkOf:           pr.putMsg,
+			}
+		}
+
+		var err error
+		sequenceNumber, err = conn.sendMessageToReplicas(chunkPr, extSendTimer, watermark)
+		if err != nil {
+			// For now, lets reply Status_FAILED immediately and
+			// close the connection if we got an error.
+			// this will result in the creation of a new extent, probably.
+			pr.putMsgAckCh <- &cherami.PutMessageAck{
+				ID:          common.StringPtr(pr.putMsg.GetID()),
+				UserContext: pr.putMsg.GetUserContext(),
+				Status:      common.CheramiStatusPtr(cherami.Status_FAILED),
+				Message:     common.StringPtr(err.Error()),
+			}
+			go conn.close()
+			return
+		}
+	}
+
 	// If we reach the max sequence number, notify the extent controller but
 	// keep the pumps open
 	// Eventually we will get an error from the store when the extent is sealed
@@ -582,6 +647,10 @@ func (conn *extHost) aggregateAndSendReplies(numReplicas int) {
 	inflightMessages := make(map[int64]writeResponse)
 	defer conn.failInflightMessages(inflightMessages)
 
+	// chunkFailed is set when a chunk of the chunked message, that is currently being
+	// acked, failed; we fail the whole message when we get to its last chunk
+	var chunkFailed bool
+
 	// Setup the perMsgTimer
 	perMsgTimer := common.NewTimer(msgAckTimeout)
 	defer perMsgTimer.Stop()
@@ -646,6 +715,22 @@ func (conn *extHost) aggregateAndSendReplies(numReplicas int) {
 						}
 					}
 				}
+				if stat == cherami.Status_OK {
+					conn.extMetrics.Increment(load.ExtentMetricMsgsAcked)
+					conn.extMetrics.Add(load.ExtentMetricPutLatency, int64(time.Since(resCh.sentTime)))
+				}
+				if resCh.intermediateChunk {
+					chunkFailed = chunkFailed || stat != cherami.Status_OK
+					delete(inflightMessages, resCh.seqNo)
+					atomic.AddInt64(&conn.numInflight, -1)
+					continue
+				}
+
+				if chunkFailed {
+					stat = cherami.Status_FAILED
+					chunkFailed = false
+				}
+
 				// Now send the reply back to the pubConnection and ultimately on the stream to the publisher
 				putMsgAck := cherami.NewPutMessageAck()
 				putMsgAck.ID = common.StringPtr(resCh.ackID)
@@ -662,6 +747,7 @@ func (conn *extHost) aggregateAndSendReplies(numReplicas int) {
 					conn.logger.WithField(common.TagAckID, resCh.ackID).Error(`sending ack back to the client timed out`)
 				}
 				delete(inflightMessages, resCh.seqNo)
+				atomic.AddInt64(&conn.numInflight, -1)
 			} else {
 				// we are closing the connection.
 				return
@@ -672,6 +758,11 @@ func (conn *extHost) aggregateAndSendReplies(numReplicas int) {
 	}
 }
 
+// hasInflight returns true if some messages were sent to the replicas and not acked yet
+func (conn *extHost) hasInflight() bool {
+	return atomic.LoadInt64(&conn.numInflight) > 0
+}
+
 // sealExtent calls the extents unreachable error on the given extent
 // and seals the extent at the lastSuccessSeqNumber
 func (conn *extHost) sealExtent() error {
@@ -732,6 +823,10 @@ DrainLoop:
 	}
 
 	for _, respCh := range inflightMessages {
+		if respCh.intermediateChunk {
+			continue // the publisher gets the ack of the last chunk only
+		}
+
 		putMsgAck := &cherami.PutMessageAck{
 			ID:          common.StringPtr(respCh.ackID),
 			UserContext: respCh.userContext,
@@ -749,7 +844,6 @@ DrainLoop:
 
 // Report is used for reporting Destination Extent specific load to controller
 func (conn *extHost) Report(reporter common.LoadReporter) {
-	// TODO: Report Extent specific load like incomingMessageCount, incomingBytesCount, putLatency
 	now := time.Now().UnixNano()
 	intervalSecs := (now - conn.lastExtLoadReportedTime) / int64(time.Second)
 	if intervalSecs < 1 {
@@ -757,10 +851,21 @@ func (conn *extHost) Report(reporter common.LoadReporter) {
 	}
 
 	msgsInPerSec := conn.extMetrics.GetAndReset(load.ExtentMetricMsgsIn) / intervalSecs
+	bytesInPerSec := conn.extMetrics.GetAndReset(load.ExtentMetricBytesIn) / intervalSecs
+
+	var putMsgLatency int64
+	if msgsAcked := conn.extMetrics.GetAndReset(load.ExtentMetricMsgsAcked); msgsAcked != 0 {
+		// compute average latency
+		putMsgLatency = conn.extMetrics.GetAndReset(load.ExtentMetricPutLatency) / msgsAcked
+	}
 
 	metric := controller.DestinationExtentMetrics{
 		IncomingMessagesCounter: common.Int64Ptr(msgsInPerSec),
+		IncomingBytesCounter:    common.Int64Ptr(bytesInPerSec),
+		PutMessageLatency:       common.Int64Ptr(putMsgLatency),
 	}
+
+	conn.lastExtLoadReportedTime = now
 	reporter.ReportDestinationExtentMetric(conn.destUUID, conn.extUUID, metric)
 }
 
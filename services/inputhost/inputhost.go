@@ -32,6 +32,7 @@ import (
 	"github.com/uber/tchannel-go/thrift"
 
 	ccommon "github.com/uber/cherami-client-go/common"
+	mcli "github.com/uber/cherami-server/clients/metadata"
 	"github.com/uber/cherami-server/common"
 	dconfig "github.com/uber/cherami-server/common/dconfigclient"
 	mm "github.com/uber/cherami-server/common/metadata"
@@ -49,6 +50,9 @@ const (
 	// defaultIdleTimeout is the time to wait before we close all streams
 	defaultIdleTimeout = 10 * time.Minute
 
+	// drainCheckInterval is the interval at which we check if all publishers are gone
+	drainCheckInterval = 100 * time.Millisecond
+
 	// TODO: need to figure out the optimum number for the bufferSize to acheieve the right balance between throughput vs latency
 	defaultBufferSize = 1000
 
@@ -95,6 +99,10 @@ type (
 		maxConnLimit           int32
 		extMsgsLimitPerSecond  int32
 		connMsgsLimitPerSecond int32
+		maxMessageSize         int32
+		messageChunkSize       int32
+		drainTimeoutSeconds    int32
+		schemaSvc              mcli.DestinationSchemaService // nil, if destination schemas are not supported
 		hostMetrics            *load.HostMetrics
 		lastLoadReportedTime   int64 // unix nanos when the last load report was sent
 		common.SCommon
@@ -104,6 +112,11 @@ type (
 	InOptions struct {
 		//CacheIdleTimeout
 		CacheIdleTimeout time.Duration
+		// DrainTimeout is the time to wait on shutdown for the publishers to
+		// move to other inputhosts; zero, the default, closes the streams
+		// right away. The inputhost service uses common.HostDrainTimeoutSeconds
+		// and it can be changed through the dynamic config
+		DrainTimeout time.Duration
 	}
 
 	// extentInfo contains information about location of an extent
@@ -489,6 +502,11 @@ func (h *InputHost) PutMessageBatch(ctx thrift.Context, request *cherami.PutMess
 			putMsgRecvTime: time.Now(),
 		}
 
+		if err := pathCache.validateMessage(msg, metrics.PutMessageBatchInputHostScope, metrics.PutMessageBatchInputHostDestScope); err != nil {
+			result.FailedMessages = append(result.FailedMessages, createSchemaValidationAck(msg, err))
+			continue
+		}
+
 		select {
 		case pathCache.putMsgCh <- inMsg:
 			// remember how many ack is needed
@@ -699,6 +717,36 @@ func (h *InputHost) SetConnMsgsLimitPerSecond(connLimit int32) {
 	h.updateConnTokenBucket(int32(connLimit))
 }
 
+// GetMaxMessageSize gets the max size of the payload of a message
+func (h *InputHost) GetMaxMessageSize() int {
+	return int(atomic.LoadInt32(&h.maxMessageSize))
+}
+
+// SetMaxMessageSize sets the max size of the payload of a message
+func (h *InputHost) SetMaxMessageSize(size int32) {
+	atomic.StoreInt32(&h.maxMessageSize, size)
+}
+
+// GetMessageChunkSize gets the size of the chunks that large messages are split into
+func (h *InputHost) GetMessageChunkSize() int {
+	return int(atomic.LoadInt32(&h.messageChunkSize))
+}
+
+// SetMessageChunkSize sets the size of the chunks that large messages are split into
+func (h *InputHost) SetMessageChunkSize(size int32) {
+	atomic.StoreInt32(&h.messageChunkSize, size)
+}
+
+// GetDrainTimeoutSeconds gets the time to wait on shutdown for the publishers to move to other inputhosts
+func (h *InputHost) GetDrainTimeoutSeconds() int {
+	return int(atomic.LoadInt32(&h.drainTimeoutSeconds))
+}
+
+// SetDrainTimeoutSeconds sets the time to wait on shutdown for the publishers to move to other inputhosts
+func (h *InputHost) SetDrainTimeoutSeconds(timeout int32) {
+	atomic.StoreInt32(&h.drainTimeoutSeconds, timeout)
+}
+
 // GetTokenBucketValue gets token bucket for hostConnLimitPerSecond
 func (h *InputHost) GetTokenBucketValue() common.TokenBucket {
 	return h.tokenBucketValue.Load().(common.TokenBucket)
@@ -742,6 +790,10 @@ func (h *InputHost) Shutdown() {
 	for atomic.LoadInt32(&h.loadShutdownRef) > -0x80000000 {
 		time.Sleep(time.Second)
 	}
+	// new streams are rejected at this point; if enabled, move the
+	// publishers to other inputhosts before we close the streams,
+	// so that they don't see their inflight messages fail
+	h.drainAll()
 	// close all open streams
 	h.unloadAll()
 	close(h.shutdown)
@@ -796,15 +848,22 @@ func NewInputHost(serviceName string, sVice common.SCommon, mClient metadata.TCh
 	bs.SetHostConnLimit(int32(common.HostOverallConnLimit))
 	bs.SetHostConnLimitPerSecond(int32(common.HostPerSecondConnLimit))
 	bs.SetMaxConnPerDest(int32(common.HostMaxConnPerDestination))
+	bs.SetMaxMessageSize(int32(common.HostMaxMessageSize))
+	bs.SetMessageChunkSize(int32(common.HostMessageChunkSize))
 
 	// create the token bucket for this host
 	bs.SetTokenBucketValue(int32(bs.GetHostConnLimitPerSecond()))
 
 	bs.m3Client = metrics.NewClient(sVice.GetMetricsReporter(), metrics.Inputhost)
 	if opts != nil {
-		bs.cacheTimeout = opts.CacheIdleTimeout
+		if opts.CacheIdleTimeout > 0 {
+			bs.cacheTimeout = opts.CacheIdleTimeout
+		}
+		bs.SetDrainTimeoutSeconds(int32(opts.DrainTimeout / time.Second))
 	}
 
+	// the schemas are not part of the thrift metadata API
+	bs.schemaSvc, _ = mClient.(mcli.DestinationSchemaService)
 	bs.mClient = mm.NewMetadataMetricsMgr(mClient, bs.m3Client, bs.logger)
 
 	// manage uconfig, regiester handerFunc and verifyFunc for uConfig values
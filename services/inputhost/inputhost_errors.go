@@ -20,6 +20,15 @@
 
 package inputhost
 
+import (
+	"errors"
+	"fmt"
+)
+
+// errSchemaNotLoaded is returned when the destination schema couldn't be
+// loaded yet, the message can't be validated and has to be retried
+var errSchemaNotLoaded = errors.New("throttling; destination schema is not loaded yet")
+
 type (
 	// PathNotExistsError will be returned when no path is found to
 	// publish the message
@@ -28,6 +37,13 @@ type (
 	// ReplicaNotExistsError will be returned when there are no
 	// replicas to publish the message
 	ReplicaNotExistsError struct{}
+
+	// SchemaValidationError will be returned when the payload
+	// of a message doesn't satisfy the destination schema
+	SchemaValidationError struct {
+		SchemaVersion int32
+		Reason        string
+	}
 )
 
 // Error implementation of PathNotExists
@@ -39,3 +55,8 @@ func (pe *PathNotExistsError) Error() string {
 func (re *ReplicaNotExistsError) Error() string {
 	return "no replicas found"
 }
+
+// Error implementation of SchemaValidationError
+func (se *SchemaValidationError) Error() string {
+	return fmt.Sprintf("payload doesn't satisfy version %d of the destination schema: %v", se.SchemaVersion, se.Reason)
+}
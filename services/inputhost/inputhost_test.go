@@ -303,6 +303,118 @@ func (s *InputHostSuite) TestInputHostPublishMessage() {
 	inputHost.Shutdown()
 }
 
+// publishChunked publishes the messages with a chunk size of 4 bytes, while the store acks the
+// chunks with the given statuses, and returns the first numAcks acks that the publisher got and
+// the messages written to the store
+func (s *InputHostSuite) publishChunked(msgs []*cherami.PutMessage, chunkStatus []cherami.Status, numAcks int) ([]*cherami.PutMessageAck, []*store.AppendMessage) {
+	inputHost, _ := NewInputHost("inputhost-test", s.mockService, s.mockMeta, nil)
+	defer inputHost.Shutdown()
+	inputHost.SetMessageChunkSize(4)
+
+	ctx, cancel := utilGetThriftContextWithPath("foo")
+	defer cancel()
+
+	// the streams stay open until the acks are in
+	done := make(chan time.Time)
+	defer close(done)
+
+	written := make(chan *store.AppendMessage, 100)
+	s.mockAppend.On("Write", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		if msg := args.Get(0).(*store.AppendMessage); msg.IsSetPayload() {
+			written <- msg
+		}
+	})
+	for i, status := range chunkStatus {
+		aMsg := store.NewAppendMessageAck()
+		aMsg.SequenceNumber = common.Int64Ptr(int64(i + 1))
+		aMsg.Status = common.CheramiStatusPtr(status)
+		aMsg.Address = common.Int64Ptr(int64(i + 100))
+		s.mockAppend.On("Read").Return(aMsg, nil).Once()
+	}
+	s.mockAppend.On("Read").Return(nil, io.EOF).WaitUntil(done)
+
+	ackCh := make(chan *cherami.PutMessageAck, 100)
+	s.mockPub.On("Write", mock.Anything).Return(
+		func(cmd *cherami.InputHostCommand) error {
+			if cmd.GetType() == cherami.InputHostCommandType_ACK {
+				ackCh <- cmd.GetAck()
+			}
+			return nil
+		})
+	for _, msg := range msgs {
+		s.mockPub.On("Read").Return(msg, nil).Once()
+	}
+	s.mockPub.On("Read").Return(nil, io.EOF).WaitUntil(done)
+
+	go inputHost.OpenPublisherStream(ctx, s.mockPub)
+
+	var acks []*cherami.PutMessageAck
+	for len(acks) < numAcks {
+		select {
+		case ack := <-ackCh:
+			acks = append(acks, ack)
+		case <-time.After(10 * time.Second):
+			s.Fail("timed out waiting for the acks")
+		}
+	}
+
+	var writes []*store.AppendMessage
+	for len(written) > 0 {
+		writes = append(writes, <-written)
+	}
+	return acks, writes
+}
+
+// TestInputHostPublishChunkedMessage publishes a message larger than the chunk size, and makes
+// sure that it is written to the store in chunks, and that the publisher gets a single ack for it
+func (s *InputHostSuite) TestInputHostPublishChunkedMessage() {
+	big := cherami.NewPutMessage()
+	big.ID = common.StringPtr("big")
+	big.Data = []byte("0123456789")
+	big.UserContext = map[string]string{"UserMsgId": "user-msg-big"}
+	small := cherami.NewPutMessage()
+	small.ID = common.StringPtr("small")
+	small.Data = []byte("abc")
+
+	ok := cherami.Status_OK
+	acks, writes := s.publishChunked([]*cherami.PutMessage{big, small}, []cherami.Status{ok, ok, ok, ok}, 2)
+
+	s.Equal("big", acks[0].GetID())
+	s.Equal(cherami.Status_OK, acks[0].GetStatus())
+	s.Equal(big.GetUserContext(), acks[0].GetUserContext(), "the chunk position is not sent back")
+	s.Equal("3", strings.Split(acks[0].GetReceipt(), ":")[1], "the receipt is the one of the last chunk")
+	s.Equal("small", acks[1].GetID())
+	s.Equal(cherami.Status_OK, acks[1].GetStatus())
+	s.Equal("4", strings.Split(acks[1].GetReceipt(), ":")[1])
+
+	s.Len(writes, 4)
+	var data []byte
+	for i := 0; i < 3; i++ {
+		index, count, isChunk := common.GetMessageChunk(writes[i].GetPayload())
+		s.True(isChunk)
+		s.Equal(i, index)
+		s.Equal(3, count)
+		s.Equal("big", writes[i].GetPayload().GetID())
+		data = append(data, writes[i].GetPayload().GetData()...)
+	}
+	s.Equal(big.GetData(), data)
+	_, _, isChunk := common.GetMessageChunk(writes[3].GetPayload())
+	s.False(isChunk)
+}
+
+// TestInputHostPublishChunkedMessageFailedChunk makes sure that a chunked message is failed when
+// any of its chunks fails, even if its last chunk succeeds
+func (s *InputHostSuite) TestInputHostPublishChunkedMessageFailedChunk() {
+	big := cherami.NewPutMessage()
+	big.ID = common.StringPtr("big")
+	big.Data = []byte("0123456789")
+
+	acks, _ := s.publishChunked([]*cherami.PutMessage{big}, []cherami.Status{cherami.Status_OK, cherami.Status_FAILED, cherami.Status_OK}, 1)
+
+	s.Equal("big", acks[0].GetID())
+	s.Equal(cherami.Status_FAILED, acks[0].GetStatus())
+}
+
 // TestInputHostPublishMessage just publishes a bunch of messages and make sure
 // that watermarks are sent and we get the acks back for messages only.
 func (s *InputHostSuite) _TestInputHostPublishMessageLogDestination() {
@@ -476,6 +588,107 @@ func (s *InputHostSuite) TestInputHostCacheTime() {
 	inputHost.Shutdown()
 }
 
+// TestInputHostShutdownDrain makes sure the publishers are sent a drain
+// notice on shutdown and that we wait for them to go away
+func (s *InputHostSuite) TestInputHostShutdownDrain() {
+	inputHost, _ := NewInputHost("inputhost-test", s.mockService, s.mockMeta, &InOptions{
+		CacheIdleTimeout: time.Minute,
+		DrainTimeout:     10 * time.Second,
+	})
+	s.Equal(10, inputHost.GetDrainTimeoutSeconds())
+	ctx, cancel := utilGetThriftContextWithPath("foo")
+	defer cancel()
+
+	drainCh := make(chan time.Time)
+	var drainOnce sync.Once
+	s.mockAppend.On("Write", mock.Anything).Return(nil)
+	s.mockAppend.On("Read").Return(nil, io.EOF).WaitUntil(drainCh)
+	s.mockPub.On("Write", mock.Anything).Return(
+		func(cmd *cherami.InputHostCommand) error {
+			if cmd.GetType() == cherami.InputHostCommandType_RECONFIGURE {
+				drainOnce.Do(func() { close(drainCh) })
+			}
+			return nil
+		})
+	// the publisher goes away only once it has been asked to
+	s.mockPub.On("Read").Return(nil, io.EOF).WaitUntil(drainCh)
+
+	go inputHost.OpenPublisherStream(ctx, s.mockPub)
+
+	// wait for the connection to be opened
+	cond := func() bool {
+		return inputHost.GetNumConnections() == 1
+	}
+	s.True(common.SpinWaitOnCondition(cond, 10*time.Second), "publisher connection not opened")
+
+	shutdownStart := time.Now()
+	inputHost.Shutdown()
+	s.True(time.Since(shutdownStart) < 10*time.Second, "shutdown waited for the drain timeout")
+	s.Equal(0, inputHost.GetNumConnections())
+}
+
+func (f *fakeSchemaService) CreateDestinationSchema(ctx thrift.Context, dstUUID string, schema *shared.SchemaInfo) (*shared.SchemaInfo, error) {
+	return nil, &shared.BadRequestError{}
+}
+
+func (f *fakeSchemaService) ReadDestinationSchema(ctx thrift.Context, dstUUID string, version int32) (*shared.SchemaInfo, error) {
+	return f.schema, f.err
+}
+
+func (f *fakeSchemaService) ListDestinationSchemas(ctx thrift.Context, dstUUID string) ([]*shared.SchemaInfo, error) {
+	return []*shared.SchemaInfo{f.schema}, f.err
+}
+
+// TestInputHostValidateMessageWaitsForSchema makes sure messages published
+// before the schema of a freshly loaded path is known are not let through
+func (s *InputHostSuite) TestInputHostValidateMessageWaitsForSchema() {
+	schemaSvc := &fakeSchemaService{err: &shared.InternalServiceError{}}
+	m3Client := metrics.NewClient(metrics.NewSimpleReporter(nil), metrics.Inputhost)
+	pathCache := &inPathCache{
+		destUUID:     uuid.New(),
+		schemaLoaded: make(chan struct{}),
+		inputHost:    &InputHost{schemaSvc: schemaSvc},
+		logger:       common.GetDefaultLogger(),
+		m3Client:     m3Client,
+		destM3Client: metrics.NewClientWithTags(m3Client, metrics.Inputhost, map[string]string{}),
+		// no background reloads, the test reloads the schema itself
+		lastSchemaRetryTime: time.Now().UnixNano(),
+	}
+	msg := &cherami.PutMessage{ID: common.StringPtr("1"), Data: []byte(`{"id": "one"}`)}
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- pathCache.validateMessage(msg, metrics.PubConnectionStreamScope, metrics.PubConnectionScope)
+	}()
+	select {
+	case <-errC:
+		s.Fail("message validated before the schema was loaded")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the schema failed to load, the message is throttled
+	pathCache.refreshSchema()
+	s.Equal(errSchemaNotLoaded, <-errC)
+	ack := createSchemaValidationAck(msg, errSchemaNotLoaded)
+	s.Equal(cherami.Status_THROTTLED, ack.GetStatus())
+
+	schemaSvc.schema = &shared.SchemaInfo{
+		Type:    common.StringPtr(common.SchemaTypeJSON),
+		Version: common.Int32Ptr(1),
+		Data:    []byte(`{"type": "object", "properties": {"id": {"type": "number"}}}`),
+	}
+	schemaSvc.err = nil
+	pathCache.refreshSchema()
+
+	err := pathCache.validateMessage(msg, metrics.PubConnectionStreamScope, metrics.PubConnectionScope)
+	s.IsType(&SchemaValidationError{}, err)
+	ack = createSchemaValidationAck(msg, err)
+	s.Equal(cherami.Status_FAILED, ack.GetStatus())
+
+	msg.Data = []byte(`{"id": 1}`)
+	s.NoError(pathCache.validateMessage(msg, metrics.PubConnectionStreamScope, metrics.PubConnectionScope))
+}
+
 func (s *InputHostSuite) TestInputHostLoadUnloadRace() {
 	numAttempts := 10
 
@@ -23,6 +23,7 @@ package inputhost
 import (
 	"time"
 
+	"github.com/pborman/uuid"
 	"github.com/uber-common/bark"
 	"github.com/uber/cherami-server/common"
 	"github.com/uber/cherami-server/common/metrics"
@@ -84,6 +85,7 @@ func (h *InputHost) checkAndLoadPathCache(destPath string, destUUID string, dest
 			loadReporterFactory:     h.GetLoadReporterDaemonFactory(),
 			reconfigureCh:           make(chan inReconfigInfo, defaultBufferSize),
 			putMsgCh:                make(chan *inPutMessage, defaultBufferSize),
+			schemaLoaded:            make(chan struct{}),
 			connections:             make(map[connectionID]*pubConnection),
 			closeCh:                 make(chan struct{}),
 			notifyExtHostCloseCh:    make(chan string, defaultExtCloseNotifyChSize),
@@ -106,6 +108,10 @@ func (h *InputHost) checkAndLoadPathCache(destPath string, destUUID string, dest
 		//  the m3Client above is the overall host client to report host-level metrics.
 		pathCache.destM3Client = metrics.NewClientWithTags(pathCache.m3Client, metrics.Inputhost, h.getDestinationTags(destPath))
 		pathCache.startEventLoop()
+	} else if len(destPath) > 0 {
+		// the destination may already be loaded under another
+		// path, i.e. its primary path or one of its aliases
+		h.pathCacheByDestPath[destPath] = destUUID
 	}
 	h.pathMutex.Unlock()
 	return
@@ -118,6 +124,11 @@ func (h *InputHost) loadPath(extents []*extentInfo, destPath string, destUUID st
 		h.logger.WithField(common.TagDstPth, common.FmtDstPth(destPath)).
 			WithField(common.TagDst, common.FmtDst(destUUID)), m3Client, h.hostMetrics)
 
+	// make sure the schema is in place before any message is published
+	if !exists {
+		pathCache.refreshSchema()
+	}
+
 	foundOne := false
 
 	// Now we have the pathCache. check and load all extents
@@ -191,7 +202,12 @@ func (h *InputHost) removeFromCaches(pathCache *inPathCache) {
 	h.pathMutex.Lock()
 	if curr, ok := h.pathCache[pathCache.destUUID]; ok && curr == pathCache {
 		delete(h.pathCache, pathCache.destUUID)
-		delete(h.pathCacheByDestPath, pathCache.destinationPath)
+		// a destination can be cached under multiple paths (aliases)
+		for path, destUUID := range h.pathCacheByDestPath {
+			if destUUID == pathCache.destUUID {
+				delete(h.pathCacheByDestPath, path)
+			}
+		}
 	}
 	h.pathMutex.Unlock()
 }
@@ -209,6 +225,55 @@ func (h *InputHost) unloadAll() {
 	h.pathMutex.Unlock()
 }
 
+// drainAll moves the publishers on this host to other inputhosts before the
+// streams are closed. New messages are throttled; once the messages in flight
+// are acked, the extents are sealed, so that the controller places the new
+// extents of the destinations elsewhere, and the publishers are then asked to
+// reconnect. We wait for them to disconnect, upto the drain timeout; a zero
+// timeout skips the drain.
+func (h *InputHost) drainAll() {
+	drainTimeout := time.Duration(h.GetDrainTimeoutSeconds()) * time.Second
+	if drainTimeout <= 0 {
+		return
+	}
+
+	drainStart := time.Now()
+	deadline := drainStart.Add(drainTimeout)
+
+	h.pathMutex.RLock()
+	pathCaches := make([]*inPathCache, 0, len(h.pathCache))
+	for _, pathCache := range h.pathCache {
+		pathCaches = append(pathCaches, pathCache)
+	}
+	h.pathMutex.RUnlock()
+
+	for _, pathCache := range pathCaches {
+		pathCache.startDrain()
+	}
+
+	// the extents are sealed at the last acked message; wait
+	// for the messages in flight, so that they don't fail
+	for _, pathCache := range pathCaches {
+		for pathCache.hasInflight() && time.Now().Before(deadline) {
+			time.Sleep(drainCheckInterval)
+		}
+	}
+
+	for _, pathCache := range pathCaches {
+		pathCache.sealExtents()
+		pathCache.reconfigureClients(uuid.New())
+	}
+
+	for h.GetNumConnections() > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainCheckInterval)
+	}
+
+	h.logger.WithFields(bark.Fields{
+		`remainingConns`: h.GetNumConnections(),
+		`drainTime`:      time.Since(drainStart),
+	}).Info("inputhost: drained publishers")
+}
+
 // updateExtTokenBucket update the token bucket for the extents msgs limit rate per second
 func (h *InputHost) updateExtTokenBucket(connLimit int32) {
 	h.pathMutex.RLock()
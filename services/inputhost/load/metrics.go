@@ -85,6 +85,10 @@ const (
 	ExtentMetricMsgsIn = iota
 	// ExtentMetricBytesIn represents count of incoming bytes per extent
 	ExtentMetricBytesIn
+	// ExtentMetricMsgsAcked represents count of messages acked by all replicas per extent
+	ExtentMetricMsgsAcked
+	// ExtentMetricPutLatency represents the sum of put latencies (in nanos) of acked messages per extent
+	ExtentMetricPutLatency
 	// numExtentMetrics gives the number of input host extent metrics
 	numExtentMetrics
 )
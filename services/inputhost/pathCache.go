@@ -25,6 +25,7 @@ import (
 	"net/http"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/uber/cherami-server/common"
@@ -38,6 +39,7 @@ import (
 	"github.com/uber/cherami-thrift/.generated/go/store"
 
 	"github.com/uber-common/bark"
+	"github.com/uber/tchannel-go/thrift"
 	"golang.org/x/net/context"
 )
 
@@ -82,6 +84,28 @@ type (
 
 		// connsWG is used to wait for all the connections (including ext) to go away before stopping the manage routine.
 		connsWG sync.WaitGroup
+
+		// schema is the *destSchema enforced on publish,
+		// refreshed along with the extents
+		schema atomic.Value
+		// schemaLoaded is closed once the first attempt to load
+		// the schema is done; messages are not validated before
+		schemaLoaded     chan struct{}
+		schemaLoadedOnce sync.Once
+		// lastSchemaRetryTime is the unix nanos of the last
+		// attempt to load a schema that failed to load
+		lastSchemaRetryTime int64
+
+		// draining is set when the publishers are being moved
+		// to other inputhosts, before shutdown; accessed atomically
+		draining int32
+	}
+
+	// destSchema is a version of the destination schema and
+	// its validator, which is nil if the schema isn't enforced
+	destSchema struct {
+		version   int32
+		validator common.PayloadValidator
 	}
 
 	pathCacheState int
@@ -100,6 +124,11 @@ const (
 	unloadTickerTimeout = 10 * time.Minute
 	// idleTimeout is the idle time after the last client got disconnected
 	idleTimeout = 15 * time.Minute
+	// schemaReadTimeout is the timeout to read the destination schema
+	schemaReadTimeout = 10 * time.Second
+	// schemaRetryInterval is the minimum interval between attempts
+	// to load a schema that failed to load
+	schemaRetryInterval = 5 * time.Second
 )
 
 // isActive is called with the pathCache lock held
@@ -201,6 +230,7 @@ func (pathCache *inPathCache) eventLoop() {
 		case <-refreshTicker.C:
 			pathCache.logger.Debug("refreshing all extents")
 			h.getExtentsAndLoadPathCache(nil, "", pathCache.destUUID, shared.DestinationType_UNKNOWN)
+			pathCache.refreshSchema()
 		case <-unloadTicker.C:
 			unload := false
 			pathCache.RLock()
@@ -353,6 +383,134 @@ func (pathCache *inPathCache) reconfigureClients(updateUUID string) {
 	}).Info(`reconfigureClients: notified clients`)
 }
 
+// startDrain throttles the messages published on this path from now on
+func (pathCache *inPathCache) startDrain() {
+	atomic.StoreInt32(&pathCache.draining, 1)
+}
+
+// isDraining returns true if the publishers are being moved to other inputhosts
+func (pathCache *inPathCache) isDraining() bool {
+	return atomic.LoadInt32(&pathCache.draining) == 1
+}
+
+// hasInflight returns true if some messages published on this path were not acked yet
+func (pathCache *inPathCache) hasInflight() bool {
+
+	if len(pathCache.putMsgCh) > 0 {
+		return true
+	}
+
+	pathCache.RLock()
+	defer pathCache.RUnlock()
+
+	for _, extCache := range pathCache.extentCache {
+		if extCache.connection.hasInflight() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sealExtents asks the controller to seal all the extents of this path
+func (pathCache *inPathCache) sealExtents() {
+
+	pathCache.RLock()
+	conns := make([]*extHost, 0, len(pathCache.extentCache))
+	for _, extCache := range pathCache.extentCache {
+		conns = append(conns, extCache.connection)
+	}
+	pathCache.RUnlock()
+
+	for _, conn := range conns {
+		if err := conn.sealExtent(); err != nil {
+			pathCache.logger.WithFields(bark.Fields{
+				common.TagExt: common.FmtExt(conn.extUUID),
+				common.TagErr: err,
+			}).Warn(`sealExtents: seal extent notify failed`)
+		}
+	}
+}
+
+// refreshSchema loads the latest version of the destination schema, if it changed
+func (pathCache *inPathCache) refreshSchema() {
+	defer pathCache.schemaLoadedOnce.Do(func() { close(pathCache.schemaLoaded) })
+
+	schemaSvc := pathCache.inputHost.schemaSvc
+	if schemaSvc == nil {
+		pathCache.schema.Store(&destSchema{})
+		return
+	}
+
+	ctx, cancel := thrift.NewContext(schemaReadTimeout)
+	defer cancel()
+
+	schemaInfo, err := schemaSvc.ReadDestinationSchema(ctx, pathCache.destUUID, 0)
+	if err != nil {
+		if _, ok := err.(*shared.EntityNotExistsError); ok {
+			pathCache.schema.Store(&destSchema{})
+			return
+		}
+		// keep the schema we have, if any
+		pathCache.logger.WithField(common.TagErr, err).Warn("unable to read the destination schema")
+		return
+	}
+
+	if current, ok := pathCache.schema.Load().(*destSchema); ok && current.version == schemaInfo.GetVersion() {
+		return
+	}
+
+	validator, err := common.NewPayloadValidator(schemaInfo)
+	if err != nil {
+		pathCache.logger.WithFields(bark.Fields{
+			common.TagErr: err,
+			`version`:     schemaInfo.GetVersion(),
+		}).Error("invalid destination schema")
+		return
+	}
+
+	pathCache.schema.Store(&destSchema{version: schemaInfo.GetVersion(), validator: validator})
+	pathCache.logger.WithFields(bark.Fields{
+		`version`: schemaInfo.GetVersion(),
+		`type`:    schemaInfo.GetType(),
+	}).Info("loaded destination schema")
+}
+
+// validateMessage checks the payload of the message against the
+// destination schema and updates the given scopes, if it is rejected.
+// It waits for the first attempt to load the schema, and returns
+// errSchemaNotLoaded if the schema couldn't be loaded yet.
+func (pathCache *inPathCache) validateMessage(msg *cherami.PutMessage, hostScope int, destScope int) error {
+	<-pathCache.schemaLoaded
+
+	schema, ok := pathCache.schema.Load().(*destSchema)
+	if !ok {
+		pathCache.retrySchemaLoad()
+		return errSchemaNotLoaded
+	}
+	if schema.validator == nil {
+		return nil
+	}
+
+	if err := schema.validator.Validate(msg.GetData()); err != nil {
+		pathCache.m3Client.IncCounter(hostScope, metrics.InputhostMessageSchemaRejected)
+		pathCache.destM3Client.IncCounter(destScope, metrics.InputhostDestMessageSchemaRejected)
+		return &SchemaValidationError{SchemaVersion: schema.version, Reason: err.Error()}
+	}
+	return nil
+}
+
+// retrySchemaLoad attempts to load the schema in the background,
+// at most once per schemaRetryInterval
+func (pathCache *inPathCache) retrySchemaLoad() {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&pathCache.lastSchemaRetryTime)
+	if now-last < int64(schemaRetryInterval) || !atomic.CompareAndSwapInt64(&pathCache.lastSchemaRetryTime, last, now) {
+		return
+	}
+	go pathCache.refreshSchema()
+}
+
 func (pathCache *inPathCache) checkAndLoadReplicaStreams(conn *extHost, extUUID extentUUID, replicas []string /*storehostPort*/) (err error) {
 
 	h := pathCache.inputHost
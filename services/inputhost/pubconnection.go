@@ -83,6 +83,11 @@ type (
 		putMsg         *cherami.PutMessage
 		putMsgAckCh    chan *cherami.PutMessageAck
 		putMsgRecvTime time.Time
+		// intermediateChunk is set on all but the last chunk of a message
+		// that was split up; these are not acked back to the publisher
+		intermediateChunk bool
+		// chunkOf is the message that was split up, for its chunks
+		chunkOf *cherami.PutMessage
 	}
 
 	earlyReplyAck struct {
@@ -101,6 +106,14 @@ type (
 // if we don't get any acks back fail the messages
 const failTimeout = 3 * time.Second
 
+// queueFullPauseHint is the pause suggested to the client when a message is
+// throttled because the queue towards the replicas is full
+const queueFullPauseHint = 100 * time.Millisecond
+
+// drainPauseHint is the pause suggested to the client when a message is
+// throttled because the inputhost is moving its publishers elsewhere
+const drainPauseHint = time.Second
+
 // reconfigClientChSize is the size of the reconfigClientCh
 const reconfigClientChSize = 50
 
@@ -231,22 +244,32 @@ func (conn *pubConnection) readRequestStream() {
 				putMsgRecvTime: time.Now(),
 			}
 
+			if err = conn.pathCache.validateMessage(msg, metrics.PubConnectionStreamScope, metrics.PubConnectionScope); err != nil {
+				// the publisher should not retry this message,
+				// unless the schema isn't loaded yet
+				inMsg.putMsgAckCh <- createSchemaValidationAck(msg, err)
+				continue
+			}
+
+			if conn.pathCache.isDraining() {
+				// the extents are about to be sealed; the publisher retries
+				// the message once it has moved to another inputhost
+				inMsg.putMsgAckCh <- createThrottledAck(msg, "throttling; inputhost is draining", drainPauseHint, 0)
+				continue
+			}
+
 			throttled := false
 			if conn.limitsEnabled {
-				consumed, _ := conn.GetConnTokenBucketValue().TryConsume(1)
+				consumed, wait := conn.GetConnTokenBucketValue().TryConsume(1)
 				throttled = !consumed
 				if throttled {
-					// just send a THROTTLED status back to the client
+					// just send a THROTTLED status back to the client, along with
+					// the pause and rate the client should observe
 					conn.logger.Warn("throttling due to rate violation")
 					conn.pathCache.m3Client.IncCounter(metrics.PubConnectionStreamScope, metrics.InputhostMessageLimitThrottled)
 					conn.pathCache.destM3Client.IncCounter(metrics.PubConnectionScope, metrics.InputhostDestMessageLimitThrottled)
 
-					inMsg.putMsgAckCh <- &cherami.PutMessageAck{
-						ID:          common.StringPtr(msg.GetID()),
-						UserContext: msg.GetUserContext(),
-						Status:      common.CheramiStatusPtr(cherami.Status_THROTTLED),
-						Message:     common.StringPtr("throttling; inputhost is busy"),
-					}
+					inMsg.putMsgAckCh <- createThrottledAck(msg, "throttling; inputhost is busy", wait, conn.GetMsgsLimitPerSecond())
 				}
 			}
 
@@ -263,12 +286,7 @@ func (conn *pubConnection) readRequestStream() {
 
 						// just send a THROTTLED status back to the client
 						conn.logger.Warn("throttling due to putMsgCh being filled")
-						inMsg.putMsgAckCh <- &cherami.PutMessageAck{
-							ID:          common.StringPtr(msg.GetID()),
-							UserContext: msg.GetUserContext(),
-							Status:      common.CheramiStatusPtr(cherami.Status_THROTTLED),
-							Message:     common.StringPtr("throttling; inputhost is busy"),
-						}
+						inMsg.putMsgAckCh <- createThrottledAck(msg, "throttling; inputhost is busy", queueFullPauseHint, 0)
 					}
 				} else {
 					select {
@@ -595,6 +613,44 @@ func createReconfigureCmd(updateUUID string) *cherami.InputHostCommand {
 	return cmd
 }
 
+// createThrottledAck creates a THROTTLED ack for the given message. The command
+// types are fixed by the thrift IDL, so the backpressure is carried in the user
+// context of the ack: the pause the client should observe before retrying and,
+// if known, the publish rate the client should stay under.
+func createThrottledAck(msg *cherami.PutMessage, reason string, pause time.Duration, rate int) *cherami.PutMessageAck {
+	ack := &cherami.PutMessageAck{
+		ID:          common.StringPtr(msg.GetID()),
+		UserContext: msg.GetUserContext(),
+		Status:      common.CheramiStatusPtr(cherami.Status_THROTTLED),
+		Message:     common.StringPtr(reason),
+	}
+	common.SetThrottleHint(ack, pause, rate)
+	return ack
+}
+
+// createSchemaValidationAck creates a FAILED ack for a message whose payload doesn't
+// satisfy the destination schema. The type of the error is carried in the user
+// context, so that the client can tell it apart from retryable failures. If the
+// schema isn't loaded yet, the message is throttled instead.
+func createSchemaValidationAck(msg *cherami.PutMessage, err error) *cherami.PutMessageAck {
+	if err == errSchemaNotLoaded {
+		return createThrottledAck(msg, err.Error(), schemaRetryInterval, 0)
+	}
+
+	userContext := make(map[string]string, len(msg.GetUserContext())+1)
+	for k, v := range msg.GetUserContext() {
+		userContext[k] = v
+	}
+	userContext[common.PublishErrorKey] = common.PublishErrorSchemaValidation
+
+	return &cherami.PutMessageAck{
+		ID:          common.StringPtr(msg.GetID()),
+		UserContext: userContext,
+		Status:      common.CheramiStatusPtr(cherami.Status_FAILED),
+		Message:     common.StringPtr(err.Error()),
+	}
+}
+
 func createAckCmd(ack *cherami.PutMessageAck) *cherami.InputHostCommand {
 	cmd := cherami.NewInputHostCommand()
 	cmd.Ack = ack
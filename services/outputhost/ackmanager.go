@@ -43,6 +43,9 @@ type (
 	internalMsg struct {
 		addr  storeHostAddress
 		acked bool
+		// prevChunks is the number of messages before this one that are
+		// chunks of the same chunked message; these are acked along with it
+		prevChunks int
 	}
 
 	levels struct {
@@ -118,6 +121,13 @@ func newAckManager(cgCache *consumerGroupCache, ackMgrID uint32, outputHostUUID
 // First we get the ackID and store the address locally in our data structure
 // for maintaining the ack level
 func (ackMgr *ackManager) getNextAckID(address int64, sequence common.SequenceNumber) (ackID string) {
+	return ackMgr.getNextChunkedAckID(address, sequence, 0)
+}
+
+// getNextChunkedAckID is getNextAckID for the last chunk of a chunked message. The ack
+// of the returned ackID also acks the prevChunks messages before it, i.e. all the chunks
+// of the message, so that the ack level only moves past a chunked message as a unit.
+func (ackMgr *ackManager) getNextChunkedAckID(address int64, sequence common.SequenceNumber, prevChunks int) (ackID string) {
 	ackMgr.lk.Lock()
 	ackMgr.readLevel++ // This means that the first ID is '1'
 	ackMgr.readLevelAddr = storeHostAddress(address)
@@ -149,7 +159,8 @@ func (ackMgr *ackManager) getNextAckID(address int64, sequence common.SequenceNu
 
 	// now store the message in the data structure internally
 	ackMgr.addrs[ackMgr.readLevel] = &internalMsg{
-		addr: storeHostAddress(address),
+		addr:       storeHostAddress(address),
+		prevChunks: prevChunks,
 	}
 
 	ackMgr.lk.Unlock()
@@ -355,8 +366,27 @@ func (ackMgr *ackManager) updateAckLevel() {
 }
 
 func (ackMgr *ackManager) acknowledgeMessage(ackID AckID, seqNum uint32, address int64, isNack bool) error {
+	err := ackMgr.markAcked(seqNum, address, isNack)
+
+	// Now notify the message cache so that it can update it's state
+	// Note: We explicitly do this outside the lock in markAcked to prevent us from
+	// blocking with a lock held
+	// send the ack to the ack channel for the msg cache to cleanup
+	if err == nil {
+		if isNack {
+			ackMgr.cgCache.nackMsgCh <- timestampedAckID{AckID: ackID, ts: common.Now()}
+		} else {
+			ackMgr.cgCache.ackMsgCh <- timestampedAckID{AckID: ackID, ts: common.Now()}
+		}
+	}
+	return err
+}
+
+// markAcked records the ack of the given message, so that the ack level can move past it.
+// Unlike acknowledgeMessage, this doesn't notify the message cache; this is used for the
+// messages that are consumed on behalf of the consumer group, e.g. expired messages.
+func (ackMgr *ackManager) markAcked(seqNum uint32, address int64, isNack bool) error {
 	var err error
-	notifyCg := true
 	ackMgr.lk.Lock() // Read lock would be OK in this case (except for a benign race with two simultaneous acks for the same ackID), see below
 	// check if this id is present
 	if addrs, ok := ackMgr.addrs[common.SequenceNumber(seqNum)]; ok {
@@ -367,7 +397,6 @@ func (ackMgr *ackManager) acknowledgeMessage(ackID AckID, seqNum uint32, address
 				`expected`: addrs.addr,
 			}).Error(`ack address does not match!`)
 			err = errors.New("address of the ackID doesn't match with ackMgr")
-			notifyCg = false
 		} else {
 			if ackMgr.cgCache.cachedCGDesc.GetOwnerEmail() == SmartRetryDisableString {
 				ackMgr.logger.WithFields(bark.Fields{
@@ -379,25 +408,30 @@ func (ackMgr *ackManager) acknowledgeMessage(ackID AckID, seqNum uint32, address
 			}
 			if !isNack {
 				addrs.acked = true // This is the only place that this field of addrs is changed. It was initially set under a write lock elsewhere, hence we can have a read lock
+				for i := 1; i <= addrs.prevChunks; i++ {
+					if chunk, ok := ackMgr.addrs[common.SequenceNumber(seqNum)-common.SequenceNumber(i)]; ok {
+						chunk.acked = true
+					}
+				}
 			}
 		}
 	} else {
 		ackMgr.logger.WithField(common.TagSeq, seqNum).Error(`seqNum of acked msg not found!`)
 	}
 	ackMgr.lk.Unlock()
+	return err
+}
 
-	// Now notify the message cache so that it can update it's state
-	// Note: We explicitly do this outside the lock above to prevent us from
-	// blocking with a lock held
-	// send the ack to the ack channel for the msg cache to cleanup
-	if notifyCg {
-		if isNack {
-			ackMgr.cgCache.nackMsgCh <- timestampedAckID{AckID: ackID, ts: common.Now()}
-		} else {
-			ackMgr.cgCache.ackMsgCh <- timestampedAckID{AckID: ackID, ts: common.Now()}
-		}
+// consumeMessage acks the message with the given ackID, which was never delivered; this
+// is used for the chunks of chunked messages that can't be reassembled
+func (ackMgr *ackManager) consumeMessage(ackID string) error {
+	ackIDObj, err := common.AckIDFromString(ackID)
+	if err != nil {
+		return err
 	}
-	return err
+
+	_, _, seqNum := ackIDObj.MutatedID.DeconstructCombinedID()
+	return ackMgr.markAcked(seqNum, ackIDObj.Address, false)
 }
 
 func (ackMgr *ackManager) manageAckLevel() {
@@ -43,6 +43,8 @@ type (
 	cacheMsg struct {
 		msg    *cherami.ConsumerMessage
 		connID int
+		// expired is set if the message was not delivered because its TTL has elapsed
+		expired bool
 	}
 
 	// consumerGroupCache holds all the extents for this consumer group
@@ -543,6 +545,20 @@ func (cgCache *consumerGroupCache) getMessageCacheSize(cfg OutputCgConfig, oldSi
 	return cacheSize
 }
 
+// getExpiredMessagesToDLQ gets the configured value for whether expired messages of this
+// CG are published to the DLQ
+func (cgCache *consumerGroupCache) getExpiredMessagesToDLQ(cfg OutputCgConfig, oldVal bool) bool {
+	logFn := func() bark.Logger {
+		return cgCache.logger
+	}
+	var oldIntVal int64
+	if oldVal {
+		oldIntVal = 1
+	}
+	ruleKey := cgCache.destPath + `/` + cgCache.cachedCGDesc.GetConsumerGroupName()
+	return common.OverrideValueByPrefix(logFn, ruleKey, cfg.ExpiredMessagesToDLQ, oldIntVal, `expiredmessagestodlq`) != 0
+}
+
 // loadConsumerGroupCache loads everything on this cache including the extents and within the cache
 func (cgCache *consumerGroupCache) loadConsumerGroupCache(ctx thrift.Context, exists bool) error {
 	cgCache.extMutex.Lock()
@@ -38,6 +38,12 @@ type (
 		// with different size config as follows:
 		// "/test/destination//test/cg_1=50,/test/destination//test/cg_2=100"
 		MessageCacheSize []string `name:"messagecachesize" default:"/=10000"`
+
+		// ExpiredMessagesToDLQ is used to configure whether the messages
+		// of a CG whose TTL has elapsed are published to the DLQ (1),
+		// instead of being consumed on behalf of the CG (0).
+		// The format is the same as MessageCacheSize above.
+		ExpiredMessagesToDLQ []string `name:"expiredmessagestodlq" default:"/=0"`
 	}
 )
 
@@ -311,7 +311,11 @@ func (conn *consConnection) writeMsgsStream() {
 				conn.createMsgAndWriteToClientUtil(msg, &unflushedWrites, &localCredits, flushThreshold, conn.msgCacheRedeliveredCh)
 				conn.reSentMsgs++
 			case msg := <-conn.msgsCh:
-				conn.createMsgAndWriteToClientUtil(msg, &unflushedWrites, &localCredits, flushThreshold, conn.msgCacheCh)
+				if common.IsMessageExpired(msg, common.Now()) {
+					conn.skipExpiredMsg(msg)
+				} else {
+					conn.createMsgAndWriteToClientUtil(msg, &unflushedWrites, &localCredits, flushThreshold, conn.msgCacheCh)
+				}
 			case <-flushTicker.C:
 				if unflushedWrites > 0 {
 					if err := conn.flushToClient(unflushedWrites); err == nil {
@@ -412,6 +416,18 @@ func (conn *consConnection) createMsgAndWriteToClientUtil(msg *cherami.ConsumerM
 	}
 }
 
+// skipExpiredMsg hands a message whose TTL has elapsed to the message cache, instead
+// of writing it to the client. The message cache takes care of consuming it.
+func (conn *consConnection) skipExpiredMsg(msg *cherami.ConsumerMessage) {
+	select {
+	case conn.msgCacheCh <- cacheMsg{msg: msg, connID: conn.connID, expired: true}:
+	case <-conn.closeChannel:
+		conn.logger.
+			WithField(common.TagAckID, common.FmtAckID(msg.GetAckId())).
+			Error("outputhost: Unable to write the expired message to the cache (shutdown?)")
+	}
+}
+
 func createMsgCmd(msg *cherami.ConsumerMessage) *cherami.OutputHostCommand {
 	cmd := cherami.NewOutputHostCommand()
 	cmd.Message = msg
@@ -167,3 +167,6 @@ func (r *outputTestLoadReporter) ReportConsumerGroupExtentMetric(destinationUUID
 func (r *outputTestLoadReporter) ReportStoreExtentMetric(extentUUID string, metrics controller.StoreExtentMetrics) error {
 	return nil
 }
+func (r *outputTestLoadReporter) ReportReplicatingStoreExtentMetric(extentUUID string, metrics controller.StoreExtentMetrics, lag common.ReplicationLag) error {
+	return nil
+}
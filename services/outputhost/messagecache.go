@@ -143,6 +143,7 @@ const (
 	eventTimer
 	eventRedelivery
 	eventInjection
+	eventExpiry
 )
 
 type m3HealthState int64
@@ -262,6 +263,7 @@ type cgMsgCache struct {
 	creditNotifyCh     chan int32          // this is the notify ch to notify credits to extents
 	creditRequestCh    <-chan string       // read-only channel used by the extents to request credits specifically for that extent.
 	maxOutstandingMsgs int32               // max allowed outstanding messages
+	expiredMsgsToDLQ   bool                // publish expired messages to the DLQ, instead of consuming them
 	numAcks            int32               // num acks we received
 	cgCache            *consumerGroupCache // just a reference to the cgCache to grant credits to a local extent directly
 	shared.ConsumerGroupDescription
@@ -300,6 +302,8 @@ func getEventString(event msgEvent) string {
 		return "TIMER"
 	case eventRedelivery:
 		return "REDELIVERY"
+	case eventExpiry:
+		return "EXPIRY"
 	default:
 		panic("unhandled event" + fmt.Sprintf(" %d", event))
 	}
@@ -318,6 +322,11 @@ func (msgCache *cgMsgCache) utilHandleDeliveredMsg(cMsg cacheMsg, badConns map[i
 
 	cm := msgCache.getState(ackID)
 	cm.lastConnID = cMsg.connID
+	if cMsg.expired {
+		msgCache.utilHandleExpiredMsg(ackID, cm, msg)
+		return
+	}
+
 	switch cm.currentState {
 	case stateNX: // Happy path
 		msgCache.changeState(ackID, stateDelivered, msg, eventCache)
@@ -350,6 +359,11 @@ func (msgCache *cgMsgCache) utilHandleRedeliveredMsg(cMsg cacheMsg) {
 
 	cm := msgCache.getState(ackID)
 	cm.lastConnID = cMsg.connID
+	if cMsg.expired {
+		msgCache.utilHandleExpiredMsg(ackID, cm, msg)
+		return
+	}
+
 	switch cm.currentState {
 	case stateDelivered:
 		// update the state to increase the count of delivery
@@ -424,6 +438,12 @@ func (msgCache *cgMsgCache) utilHandleRedeliveryTicker(badConns map[int]int) {
 
 			switch cm.currentState {
 			case stateDelivered:
+				// Don't redeliver messages whose TTL elapsed while waiting for an ack
+				if cm.msg != nil && common.IsMessageExpired(cm.msg, now) {
+					msgCache.utilHandleExpiredMsg(ackID, cm, cm.msg)
+					continue thisCache
+				}
+
 				// Check if we need to put the message to DLQ or if we need to redeliver.
 				// We put the msg to DLQ on these conditions
 				// 1. We have already redelivered upto the max delivery count
@@ -521,6 +541,46 @@ ackDrain:
 	msgCache.consumerM3Client.AddCounter(metrics.ConsConnectionScope, metrics.OutputhostCGMessageSentAck, i)
 }
 
+// utilHandleExpiredMsg handles a message whose TTL has elapsed, either before it was
+// delivered or while it was waiting for redelivery. The message is consumed on behalf
+// of the consumer group or, if so configured, published to the DLQ.
+func (msgCache *cgMsgCache) utilHandleExpiredMsg(ackID AckID, cm *cachedMessage, msg *cherami.ConsumerMessage) {
+	switch cm.currentState {
+	case stateNX, stateDelivered, stateEarlyNACK:
+		break
+	case stateEarlyACK:
+		// the consumer already acked this message
+		msgCache.changeState(ackID, stateConsumed, msg, eventExpiry)
+		return
+	default:
+		return // already consumed or on its way to the DLQ
+	}
+
+	if msgCache.expiredMsgsToDLQ && msgCache.dlqPublishCh != nil {
+		msgCache.changeState(ackID, stateDLQDelivered, msg, eventExpiry)
+		msgCache.sendToDLQ(msg)
+		msgCache.consumerM3Client.IncCounter(metrics.ConsConnectionScope, metrics.OutputhostCGMessageExpiredDLQ)
+		return
+	}
+
+	// Consume the message, so that the ack level can move past it. We count it
+	// as an ack as well, otherwise we would stop renewing the credits once the
+	// extents only have expired messages left.
+	if thisOutputHost != nil {
+		if err := thisOutputHost.consumeMessage(ackID); err != nil {
+			msgCache.lclLg.WithFields(bark.Fields{
+				common.TagAckID: common.FmtAckID(string(ackID)),
+				common.TagErr:   err,
+			}).Warn("unable to consume expired message")
+		}
+	}
+	msgCache.changeState(ackID, stateConsumed, msg, eventExpiry)
+	msgCache.numAcks++
+
+	msgCache.m3Client.IncCounter(metrics.ConsConnectionStreamScope, metrics.OutputhostMessageExpired)
+	msgCache.consumerM3Client.IncCounter(metrics.ConsConnectionScope, metrics.OutputhostCGMessageExpired)
+}
+
 func (msgCache *cgMsgCache) utilRenewCredits() {
 	// now we can send credits to the extents, so that they can renew them
 	// to the appropriate store
@@ -975,12 +1035,15 @@ func (msgCache *cgMsgCache) updateConn(connID int, event msgEvent, badConns map[
 
 func (msgCache *cgMsgCache) refreshCgConfig(oldOutstandingMessages int32) {
 	outstandingMsgs := oldOutstandingMessages
+	expiredMsgsToDLQ := msgCache.expiredMsgsToDLQ
 	cfg, err := msgCache.cgCache.getDynamicCgConfig()
 	if err == nil {
 		outstandingMsgs = msgCache.cgCache.getMessageCacheSize(cfg, oldOutstandingMessages)
+		expiredMsgsToDLQ = msgCache.cgCache.getExpiredMessagesToDLQ(cfg, expiredMsgsToDLQ)
 	}
 
 	msgCache.maxOutstandingMsgs = outstandingMsgs
+	msgCache.expiredMsgsToDLQ = expiredMsgsToDLQ
 }
 
 // TODO: Make the delivery cache shared among all consumer groups
@@ -1030,18 +1093,21 @@ func newMessageDeliveryCache(
 }
 
 func (msgCache *cgMsgCache) publishToDLQ(cm *cachedMessage, badConns map[int]int) {
-	msg := cm.msg
+	msgCache.sendToDLQ(cm.msg)
+	// find the connection id of the message and then throttle that connection
+	// the notifier interface will let the appropriate connection know about this.
+	// the connections will take care of throttling based on the number of nacks
+	// received per second.
+	msgCache.updateConn(cm.lastConnID, eventNACK, badConns)
+}
+
+func (msgCache *cgMsgCache) sendToDLQ(msg *cherami.ConsumerMessage) {
 	msgCache.blockCheckingTimer.Reset(blockCheckingTimeout)
 	select {
 	case msgCache.dlqPublishCh <- msg:
 	case <-msgCache.blockCheckingTimer.C:
 		panic("this should never block")
 	}
-	// find the connection id of the message and then throttle that connection
-	// the notifier interface will let the appropriate connection know about this.
-	// the connections will take care of throttling based on the number of nacks
-	// received per second.
-	msgCache.updateConn(cm.lastConnID, eventNACK, badConns)
 }
 
 func (msgCache *cgMsgCache) startTimer(e msgEvent) {
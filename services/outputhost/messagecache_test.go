@@ -138,6 +138,88 @@ func (s *MessageCacheSuite) TestTimerQueueCleanupAfterRedelivery() {
 	s.Equal(0, len(s.msgRedeliveryCh), "Unexpected message cache redelivery")
 }
 
+func (s *MessageCacheSuite) TestExpiredMessages() {
+
+	newMsg := func(ackID string, enqueueTime time.Time) *cherami.ConsumerMessage {
+		return &cherami.ConsumerMessage{
+			EnqueueTimeUtc: common.Int64Ptr(enqueueTime.UnixNano()),
+			AckId:          common.StringPtr(ackID),
+			Payload: &cherami.PutMessage{
+				ID:          common.StringPtr(ackID),
+				Data:        []byte("abc"),
+				UserContext: map[string]string{common.MessageTTLSecondsKey: `2`},
+			},
+		}
+	}
+
+	// a message that expired before delivery is consumed right away
+	s.msgCache.utilHandleDeliveredMsg(cacheMsg{connID: 99, msg: newMsg(`201`, time.Now().Add(-time.Minute)), expired: true}, nil)
+	s.Equal(stateConsumed, s.msgCache.getState(AckID(`201`)).currentState)
+	s.EqualValues(1, s.msgCache.numAcks, "expired message should count towards credits")
+
+	// a message that expires while waiting for an ack is not redelivered
+	s.msgCache.utilHandleDeliveredMsg(cacheMsg{connID: 99, msg: newMsg(`202`, time.Now().Add(-time.Second))}, nil)
+	s.Equal(stateDelivered, s.msgCache.getState(AckID(`202`)).currentState)
+
+	time.Sleep(time.Second + time.Second/2)
+
+	s.msgCache.utilHandleRedeliveryTicker(nil)
+	s.Equal(0, len(s.msgRedeliveryCh), "expired message should not be redelivered")
+	s.Equal(stateConsumed, s.msgCache.getState(AckID(`202`)).currentState)
+	s.EqualValues(2, s.msgCache.numAcks)
+}
+
+func (s *MessageCacheSuite) TestExpiredMessagesToDLQ() {
+
+	dlqPublishCh := make(chan *cherami.ConsumerMessage, 8)
+	s.msgCache.expiredMsgsToDLQ = true
+	s.msgCache.dlqPublishCh = dlqPublishCh
+	s.msgCache.blockCheckingTimer = common.NewTimer(blockCheckingTimeout)
+
+	newMsg := func(ackID string, enqueueTime time.Time) *cherami.ConsumerMessage {
+		return &cherami.ConsumerMessage{
+			EnqueueTimeUtc: common.Int64Ptr(enqueueTime.UnixNano()),
+			AckId:          common.StringPtr(ackID),
+			Payload: &cherami.PutMessage{
+				ID:          common.StringPtr(ackID),
+				Data:        []byte("abc"),
+				UserContext: map[string]string{common.MessageTTLSecondsKey: `2`},
+			},
+		}
+	}
+
+	// a message that expired before delivery goes to the DLQ
+	msg := newMsg(`301`, time.Now().Add(-time.Minute))
+	s.msgCache.utilHandleDeliveredMsg(cacheMsg{connID: 99, msg: msg, expired: true}, nil)
+	s.Equal(1, len(dlqPublishCh))
+	s.Equal(msg, <-dlqPublishCh, "expired message should be published to the DLQ")
+	s.Equal(stateDLQDelivered, s.msgCache.getState(AckID(`301`)).currentState)
+
+	// a message that expires while waiting for an ack goes to the DLQ too
+	msg = newMsg(`302`, time.Now().Add(-time.Second))
+	s.msgCache.utilHandleDeliveredMsg(cacheMsg{connID: 99, msg: msg}, nil)
+
+	time.Sleep(time.Second + time.Second/2)
+
+	s.msgCache.utilHandleRedeliveryTicker(nil)
+	s.Equal(0, len(s.msgRedeliveryCh), "expired message should not be redelivered")
+	s.Equal(1, len(dlqPublishCh))
+	s.Equal(msg, <-dlqPublishCh, "expired message should be published to the DLQ")
+	s.Equal(stateDLQDelivered, s.msgCache.getState(AckID(`302`)).currentState)
+
+	// once the DLQ acks them, the messages are consumed and
+	// dropped from the cache, so the ack level can move past them
+	s.msgCache.utilHandleAckMsg(timestampedAckID{AckID: AckID(`301`), ts: common.Now()}, nil)
+	s.msgCache.utilHandleAckMsg(timestampedAckID{AckID: AckID(`302`), ts: common.Now()}, nil)
+	s.Equal(stateConsumed, s.msgCache.getState(AckID(`301`)).currentState)
+	s.Equal(stateConsumed, s.msgCache.getState(AckID(`302`)).currentState)
+
+	time.Sleep(2*time.Second + time.Second/2)
+
+	s.msgCache.utilHandleRedeliveryTicker(nil)
+	s.Equal(0, len(s.msgCache.msgMap), "consumed messages should be dropped from the cache")
+}
+
 // mocks go here
 
 type mockNotifier struct{}
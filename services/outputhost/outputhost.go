@@ -21,6 +21,7 @@
 package outputhost
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -393,6 +394,26 @@ func (h *OutputHost) processAcks(ackIds []string, isNack bool) (invalidIDs []str
 	return
 }
 
+// consumeMessage acks the given message on its ack manager, without going through
+// the message cache; the message cache uses this to consume expired messages.
+func (h *OutputHost) consumeMessage(ackID AckID) error {
+	ackIDObj, err := common.AckIDFromString(string(ackID))
+	if err != nil {
+		return err
+	}
+
+	sessionID, ackMgrID, seqNum := ackIDObj.MutatedID.DeconstructCombinedID()
+	if sessionID != h.sessionID {
+		return errors.New("ackID intended for a different outputhost")
+	}
+
+	ackMgr := h.getAckMgr(ackMgrID)
+	if ackMgr == nil {
+		return nil // the extent is already consumed
+	}
+	return ackMgr.markAcked(seqNum, ackIDObj.Address, false)
+}
+
 // AckMessages is the implementation of the thrift handler for the BOut service
 func (h *OutputHost) AckMessages(ctx thrift.Context, ackRequest *cherami.AckMessagesRequest) error {
 
@@ -469,8 +490,12 @@ func (h *OutputHost) ReceiveMessageBatch(ctx thrift.Context, request *cherami.Re
 	msgCacheWriteTicker := common.NewTimer(msgCacheWriteTimeout)
 	defer msgCacheWriteTicker.Stop()
 	deliver := func(msg *cherami.ConsumerMessage, msgCacheCh chan cacheMsg) {
-		// send msg back to caller
-		res.Messages = append(res.Messages, msg)
+		// send msg back to caller, unless its TTL has elapsed; an expired
+		// message only goes to the message cache, which consumes it
+		expired := common.IsMessageExpired(msg, common.Now())
+		if !expired {
+			res.Messages = append(res.Messages, msg)
+		}
 
 		// long poll consumers don't have a connectionID and we don't have anything to throttle here
 		// using -1 as a special connection ID here,
@@ -481,7 +506,7 @@ func (h *OutputHost) ReceiveMessageBatch(ctx thrift.Context, request *cherami.Re
 		// writing to message cache but this is the best we can do.
 		msgCacheWriteTicker.Reset(msgCacheWriteTimeout)
 		select {
-		case msgCacheCh <- cacheMsg{msg: msg, connID: -1}:
+		case msgCacheCh <- cacheMsg{msg: msg, connID: -1, expired: expired}:
 		case <-cgCache.closeChannel:
 			lclLg.WithField(common.TagAckID, common.FmtAckID(msg.GetAckId())).
 				Error("outputhost: Unable to write the message to the cache because cg cache closing")
@@ -532,6 +532,91 @@ func (s *OutputHostSuite) TestOutputHostReceiveMessageBatch() {
 	outputHost.Shutdown()
 }
 
+// TestOutputHostReceiveChunkedMessage makes sure that the chunks of a chunked message are
+// delivered as one message, and that chunks of a message whose beginning is missing are dropped
+func (s *OutputHostSuite) TestOutputHostReceiveChunkedMessage() {
+	outputHost, _ := NewOutputHost("outputhost-test", s.mockService, s.mockMeta, nil, nil)
+	ctx, _ := utilGetThriftContext()
+
+	destUUID := uuid.New()
+	destDesc := shared.NewDestinationDescription()
+	destDesc.Path = common.StringPtr("/foo/bar")
+	destDesc.DestinationUUID = common.StringPtr(destUUID)
+	destDesc.Status = common.InternalDestinationStatusPtr(shared.DestinationStatus_ENABLED)
+	s.mockMeta.On("ReadDestination", mock.Anything, mock.Anything).Return(destDesc, nil).Once()
+
+	cgDesc := shared.NewConsumerGroupDescription()
+	cgDesc.ConsumerGroupUUID = common.StringPtr(uuid.New())
+	cgDesc.DestinationUUID = common.StringPtr(destUUID)
+	s.mockMeta.On("ReadConsumerGroup", mock.Anything, mock.Anything).Return(cgDesc, nil).Twice()
+
+	cgExt := metadata.NewConsumerGroupExtent()
+	cgExt.ExtentUUID = common.StringPtr(uuid.New())
+	cgExt.StoreUUIDs = []string{"mock"}
+
+	cgRes := &metadata.ReadConsumerGroupExtentsResult_{}
+	cgRes.Extents = append(cgRes.Extents, cgExt)
+	s.mockMeta.On("ReadConsumerGroupExtents", mock.Anything, mock.Anything).Return(cgRes, nil).Once()
+	s.mockRead.On("Write", mock.Anything).Return(nil)
+
+	orphan := cherami.NewPutMessage()
+	orphan.ID = common.StringPtr("orphan")
+	orphan.Data = []byte("012345")
+	big := cherami.NewPutMessage()
+	big.ID = common.StringPtr("big")
+	big.Data = []byte("0123456789")
+	big.UserContext = map[string]string{"UserMsgId": "user-msg-big"}
+	small := cherami.NewPutMessage()
+	small.ID = common.StringPtr("small")
+	small.Data = []byte("abc")
+
+	// the extent starts with the last chunk of a message that was
+	// published before, then has a chunked and a plain message
+	var payloads []*cherami.PutMessage
+	payloads = append(payloads, common.SplitMessage(orphan, 4)[1])
+	payloads = append(payloads, common.SplitMessage(big, 4)...)
+	payloads = append(payloads, small)
+
+	for i, pMsg := range payloads {
+		aMsg := store.NewAppendMessage()
+		aMsg.SequenceNumber = common.Int64Ptr(int64(i))
+		aMsg.Payload = pMsg
+		rMsg := store.NewReadMessage()
+		rMsg.Message = aMsg
+
+		rmc := store.NewReadMessageContent()
+		rmc.Type = store.ReadMessageContentTypePtr(store.ReadMessageContentType_MESSAGE)
+		rmc.Message = rMsg
+
+		s.mockRead.On("Read").Return(rmc, nil).Once()
+	}
+
+	// close the read stream
+	s.mockRead.On("Read").Return(nil, io.EOF)
+
+	receiveMessageRequest := &cherami.ReceiveMessageBatchRequest{
+		DestinationPath:     common.StringPtr("foo"),
+		ConsumerGroupName:   common.StringPtr("testcons"),
+		MaxNumberOfMessages: common.Int32Ptr(2),
+		ReceiveTimeout:      common.Int32Ptr(30),
+	}
+
+	receivedMessages, err := outputHost.ReceiveMessageBatch(ctx, receiveMessageRequest)
+	s.NoError(err)
+	s.Len(receivedMessages.GetMessages(), 2)
+
+	msg := receivedMessages.GetMessages()[0].GetPayload()
+	s.Equal("big", msg.GetID())
+	s.Equal(big.GetData(), msg.GetData())
+	s.Equal(big.GetUserContext(), msg.GetUserContext(), "the chunk position is not delivered")
+
+	msg = receivedMessages.GetMessages()[1].GetPayload()
+	s.Equal("small", msg.GetID())
+	s.Equal(small.GetData(), msg.GetData())
+
+	outputHost.Shutdown()
+}
+
 // TestOutputHostReceiveMessageBatch_NoMsg tests the no message available scenario
 func (s *OutputHostSuite) TestOutputHostReceiveMessageBatch_NoMsg() {
 	var count int32
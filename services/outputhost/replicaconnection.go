@@ -29,6 +29,7 @@ import (
 	"github.com/uber-common/bark"
 
 	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-server/common/metrics"
 	"github.com/uber/cherami-server/services/outputhost/load"
 	storeStream "github.com/uber/cherami-server/stream"
 	"github.com/uber/cherami-thrift/.generated/go/cherami"
@@ -75,6 +76,11 @@ type (
 		// for concurrent access
 		sentCreds int64 // total credits sent
 		recvMsgs  int64 // total messages received
+
+		// chunks and chunkAckIDs hold the chunks of the chunked message that
+		// is being read, until its last chunk arrives; only used by the read pump
+		chunks      []*cherami.PutMessage
+		chunkAckIDs []string
 	}
 )
 
@@ -192,6 +198,7 @@ func (conn *replicaConnection) grantCredits(credits int32) bool {
 func (conn *replicaConnection) readMessagesPump() {
 	defer conn.waitWG.Done()
 	var localReadMsgs int32
+	var chunkCredits int32 // credits for the chunks that are not delivered on their own
 	hb := common.NewHeartbeat(&conn.name)
 	defer hb.CloseHeartbeat()
 
@@ -270,7 +277,43 @@ func (conn *replicaConnection) readMessagesPump() {
 				cMsg.EnqueueTimeUtc = msg.Message.EnqueueTimeUtc
 				cMsg.Payload = msg.Message.Payload
 
-				cMsg.AckId = common.StringPtr(conn.extCache.ackMgr.getNextAckID(msg.GetAddress(), correctSequenceNumber))
+				// Chunks of a chunked message are held back until the last chunk arrives,
+				// and then delivered as one message. The store charged us a credit for each
+				// chunk, but the message cache will give back one credit for the whole
+				// message; so give back the credits for the other chunks right away.
+				if index, count, ok := common.GetMessageChunk(msg.Message.Payload); ok {
+					if index != len(conn.chunks) {
+						// we missed some chunks; this happens when we start reading in the
+						// middle of a chunked message, or if its publish failed halfway
+						conn.dropChunks()
+					}
+
+					if index != len(conn.chunks) || index < count-1 {
+						ackID := conn.extCache.ackMgr.getNextAckID(msg.GetAddress(), correctSequenceNumber)
+						conn.chunks = append(conn.chunks, msg.Message.Payload)
+						conn.chunkAckIDs = append(conn.chunkAckIDs, ackID)
+						if index != len(conn.chunks)-1 {
+							conn.dropChunks() // the beginning of this message is gone
+						}
+
+						localReadMsgs++
+						chunkCredits++
+						select {
+						case conn.localCreditCh <- chunkCredits:
+							chunkCredits = 0
+						default:
+							// try again with the next chunk
+						}
+						continue
+					}
+
+					cMsg.Payload = common.JoinMessageChunks(append(conn.chunks, msg.Message.Payload))
+					cMsg.AckId = common.StringPtr(conn.extCache.ackMgr.getNextChunkedAckID(msg.GetAddress(), correctSequenceNumber, len(conn.chunks)))
+					conn.chunks, conn.chunkAckIDs = nil, nil
+				} else {
+					conn.dropChunks()
+					cMsg.AckId = common.StringPtr(conn.extCache.ackMgr.getNextAckID(msg.GetAddress(), correctSequenceNumber))
+				}
 				// write the message to the msgsCh so that it can be delivered
 				// after being stored on the cache.
 				// 1. either there are no listeners
@@ -312,6 +355,9 @@ func (conn *replicaConnection) readMessagesPump() {
 
 				seal := rmc.GetSealed()
 				conn.logger.WithField(common.TagSeq, seal.GetSequenceNumber()).Info(`extent seal`)
+				// the rest of a chunked message will never come; drop what we have,
+				// so that the extent can be consumed
+				conn.dropChunks()
 				// Notify the extent cache with an extent sealed error so that
 				// it can notify the ackMgr and wait for the extent to be consumed
 				go conn.close(seal)
@@ -330,6 +376,30 @@ func (conn *replicaConnection) readMessagesPump() {
 	}
 }
 
+// dropChunks drops the chunks of an incomplete chunked message, by acking them
+func (conn *replicaConnection) dropChunks() {
+	if len(conn.chunks) == 0 {
+		return
+	}
+
+	for _, ackID := range conn.chunkAckIDs {
+		if err := conn.extCache.ackMgr.consumeMessage(ackID); err != nil {
+			conn.logger.WithFields(bark.Fields{
+				common.TagAckID: common.FmtAckID(ackID),
+				common.TagErr:   err,
+			}).Error(`unable to ack dropped chunk`)
+		}
+	}
+
+	conn.logger.WithFields(bark.Fields{
+		common.TagMsgID: common.FmtMsgID(conn.chunks[0].GetID()),
+		`chunks`:        len(conn.chunks),
+	}).Warn(`dropping chunks of incomplete message`)
+	conn.extCache.ackMgr.cgCache.consumerM3Client.AddCounter(metrics.ConsConnectionScope, metrics.OutputhostCGMessageChunksDropped, int64(len(conn.chunks)))
+
+	conn.chunks, conn.chunkAckIDs = nil, nil
+}
+
 func (conn *replicaConnection) utilSendCredits(credits int32, numMsgsRead *int32, totalCreditsSent *int32) {
 	// conn.logger.WithField(`credits`, credits).Debug(`Sending credits to store.`)
 	if err := conn.sendCreditsToStore(credits); err != nil {
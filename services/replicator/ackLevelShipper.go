@@ -0,0 +1,497 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replicator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/tchannel-go/thrift"
+
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-server/common/metrics"
+	"github.com/uber/cherami-thrift/.generated/go/metadata"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+)
+
+type (
+	// AckLevelShipper periodically ships the ack levels of the local
+	// multi-zone consumer groups to the replicators of the other zones,
+	// so that consumers failing over to another zone resume close to
+	// where they left off
+	AckLevelShipper interface {
+		common.Daemon
+	}
+
+	// ackLevelShipper is an implementation of AckLevelShipper.
+	ackLevelShipper struct {
+		replicator *Replicator
+		localZone  string
+
+		mClient    metadata.TChanMetadataService
+		logger     bark.Logger
+		m3Client   metrics.Client
+		httpClient *http.Client
+
+		closeChannel chan struct{}
+
+		ticker  *time.Ticker
+		running int64
+
+		// shipped is the last ack level shipped to each zone,
+		// keyed by consumer group and extent
+		shipped map[string]map[string]int64
+	}
+
+	// ackLevel is the ack level of a consumer group extent, as shipped between zones
+	ackLevel struct {
+		DestinationUUID   string `json:"destinationUUID"`
+		ConsumerGroupUUID string `json:"consumerGroupUUID"`
+		ExtentUUID        string `json:"extentUUID"`
+		AckLevelAddress   int64  `json:"ackLevelAddress"`
+		AckLevelSeqNo     int64  `json:"ackLevelSeqNo"`
+	}
+
+	// ackLevelsResult is the reply of a replicator to shipped ack levels
+	ackLevelsResult struct {
+		Moved int `json:"moved"`
+		// Skipped are the keys of the ack levels of consumer groups or
+		// extents that didn't make it to the receiving zone yet
+		Skipped []string `json:"skipped"`
+	}
+)
+
+const (
+	// httpPathAckLevels is the path ack levels are shipped to, on the websocket port of the replicators
+	httpPathAckLevels = "/replicator/acklevels"
+	// httpParamZone is the query parameter naming the zone the ack levels are shipped from
+	httpParamZone = "zone"
+
+	ackLevelShipTimeout = 30 * time.Second
+)
+
+// NewAckLevelShipper returns an instance of AckLevelShipper
+func NewAckLevelShipper(mClient metadata.TChanMetadataService, replicator *Replicator, localZone string, interval time.Duration, logger bark.Logger, m3client metrics.Client) AckLevelShipper {
+	return &ackLevelShipper{
+		replicator: replicator,
+		localZone:  localZone,
+		mClient:    mClient,
+		logger:     logger,
+		m3Client:   m3client,
+		httpClient: &http.Client{Timeout: ackLevelShipTimeout},
+		ticker:     time.NewTicker(interval),
+		running:    0,
+		shipped:    make(map[string]map[string]int64),
+	}
+}
+
+func (s *ackLevelShipper) Start() {
+	s.logger.Info("AckLevelShipper: started")
+
+	s.closeChannel = make(chan struct{})
+	go s.houseKeep()
+}
+
+func (s *ackLevelShipper) Stop() {
+	close(s.closeChannel)
+	s.ticker.Stop()
+
+	s.logger.Info("AckLevelShipper: stopped")
+}
+
+func (s *ackLevelShipper) houseKeep() {
+	for {
+		select {
+		case <-s.ticker.C:
+			go s.run()
+		case <-s.closeChannel:
+			return
+		}
+	}
+}
+
+func (s *ackLevelShipper) run() {
+	primaryHost, err := s.replicator.GetRingpopMonitor().FindHostForKey(common.ReplicatorServiceName, common.ReplicatorServiceName)
+	if err != nil {
+		s.logger.WithField(common.TagErr, err).Error(`Error getting primary replicator from ringpop`)
+		return
+	}
+
+	// like the reconciler, the shipper only runs on the primary replicator
+	if primaryHost.UUID != s.replicator.GetHostUUID() {
+		return
+	}
+
+	if !atomic.CompareAndSwapInt64(&s.running, 0, 1) {
+		s.logger.Warn("AckLevelShipper: prev run is still ongoing...")
+		return
+	}
+	defer atomic.StoreInt64(&s.running, 0)
+
+	levels, err := s.getLocalAckLevels()
+	if err != nil {
+		s.m3Client.IncCounter(metrics.ReplicatorShipAckLevelsScope, metrics.ReplicatorFailures)
+		return
+	}
+
+	for _, zone := range s.replicator.allZones[s.replicator.tenancy] {
+		if strings.EqualFold(zone, s.localZone) {
+			continue
+		}
+
+		changed := s.changedAckLevels(zone, levels)
+		if len(changed) == 0 {
+			continue
+		}
+
+		s.m3Client.IncCounter(metrics.ReplicatorShipAckLevelsScope, metrics.ReplicatorRequests)
+		result, err := s.ship(zone, changed)
+		if err != nil {
+			s.m3Client.IncCounter(metrics.ReplicatorShipAckLevelsScope, metrics.ReplicatorFailures)
+			s.logger.WithFields(bark.Fields{
+				common.TagErr:      err,
+				common.TagZoneName: common.FmtZoneName(zone),
+			}).Warn(`AckLevelShipper: failed to ship ack levels`)
+			continue
+		}
+
+		s.m3Client.AddCounter(metrics.ReplicatorShipAckLevelsScope, metrics.ReplicatorAckLevelsShipped, int64(len(changed)))
+		s.markShipped(zone, changed, result.Skipped)
+	}
+}
+
+// getLocalAckLevels returns the ack levels of the extents of all the
+// multi-zone consumer groups in the local zone
+func (s *ackLevelShipper) getLocalAckLevels() ([]*ackLevel, error) {
+	ctx, cancel := thrift.NewContext(localReplicatorCallTimeOut)
+	defer cancel()
+
+	listReq := &metadata.ListConsumerGroupRequest{
+		Limit: common.Int64Ptr(metadataListRequestPageSize),
+	}
+
+	var levels []*ackLevel
+	for {
+		listResp, err := s.mClient.ListAllConsumerGroups(ctx, listReq)
+		if err != nil {
+			s.logger.WithField(common.TagErr, err).Error(`AckLevelShipper: ListAllConsumerGroups failed`)
+			return nil, err
+		}
+
+		for _, cg := range listResp.GetConsumerGroups() {
+			if !cg.GetIsMultiZone() || cg.GetStatus() != shared.ConsumerGroupStatus_ENABLED {
+				continue
+			}
+
+			// only the active zone of a consumer group ships its ack levels,
+			// the other zones would reject them
+			if !strings.EqualFold(cg.GetActiveZone(), s.localZone) {
+				continue
+			}
+
+			cgLevels, err := s.getConsumerGroupAckLevels(ctx, cg)
+			if err != nil {
+				return nil, err
+			}
+			levels = append(levels, cgLevels...)
+		}
+
+		if len(listResp.GetNextPageToken()) == 0 {
+			break
+		}
+		listReq.PageToken = listResp.GetNextPageToken()
+	}
+
+	return levels, nil
+}
+
+func (s *ackLevelShipper) getConsumerGroupAckLevels(ctx thrift.Context, cg *shared.ConsumerGroupDescription) ([]*ackLevel, error) {
+	req := &metadata.ReadConsumerGroupExtentsRequest{
+		DestinationUUID:   common.StringPtr(cg.GetDestinationUUID()),
+		ConsumerGroupUUID: common.StringPtr(cg.GetConsumerGroupUUID()),
+		MaxResults:        common.Int32Ptr(metadataListRequestPageSize),
+	}
+
+	var levels []*ackLevel
+	for {
+		resp, err := s.mClient.ReadConsumerGroupExtents(ctx, req)
+		if err != nil {
+			s.logger.WithFields(bark.Fields{
+				common.TagErr:  err,
+				common.TagDst:  common.FmtDst(cg.GetDestinationUUID()),
+				common.TagCnsm: common.FmtCnsm(cg.GetConsumerGroupUUID()),
+			}).Error(`AckLevelShipper: ReadConsumerGroupExtents failed`)
+			return nil, err
+		}
+
+		for _, cge := range resp.GetExtents() {
+			// nothing was acked yet, there is nothing to move in the other zones
+			if cge.GetAckLevelOffset() <= 0 {
+				continue
+			}
+
+			levels = append(levels, &ackLevel{
+				DestinationUUID:   cg.GetDestinationUUID(),
+				ConsumerGroupUUID: cg.GetConsumerGroupUUID(),
+				ExtentUUID:        cge.GetExtentUUID(),
+				AckLevelAddress:   cge.GetAckLevelOffset(),
+				AckLevelSeqNo:     cge.GetAckLevelSeqNo(),
+			})
+		}
+
+		if len(resp.GetNextPageToken()) == 0 {
+			break
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+
+	return levels, nil
+}
+
+func (l *ackLevel) key() string {
+	return l.ConsumerGroupUUID + "/" + l.ExtentUUID
+}
+
+// changedAckLevels returns the ack levels that moved since they were last shipped to the zone
+func (s *ackLevelShipper) changedAckLevels(zone string, levels []*ackLevel) []*ackLevel {
+	shipped := s.shipped[zone]
+
+	var changed []*ackLevel
+	for _, level := range levels {
+		if address, ok := shipped[level.key()]; ok && address == level.AckLevelAddress {
+			continue
+		}
+		changed = append(changed, level)
+	}
+
+	// forget the extents that are gone, so the map doesn't grow forever
+	if shipped != nil {
+		current := make(map[string]struct{}, len(levels))
+		for _, level := range levels {
+			current[level.key()] = struct{}{}
+		}
+		for key := range shipped {
+			if _, ok := current[key]; !ok {
+				delete(shipped, key)
+			}
+		}
+	}
+
+	return changed
+}
+
+// markShipped records the ack levels shipped to the zone, but the skipped
+// ones, which are shipped again in the next run
+func (s *ackLevelShipper) markShipped(zone string, levels []*ackLevel, skipped []string) {
+	shipped, ok := s.shipped[zone]
+	if !ok {
+		shipped = make(map[string]int64)
+		s.shipped[zone] = shipped
+	}
+
+	skip := make(map[string]struct{}, len(skipped))
+	for _, key := range skipped {
+		skip[key] = struct{}{}
+	}
+	for _, level := range levels {
+		if _, ok = skip[level.key()]; ok {
+			continue
+		}
+		shipped[level.key()] = level.AckLevelAddress
+	}
+}
+
+func (s *ackLevelShipper) ship(zone string, levels []*ackLevel) (*ackLevelsResult, error) {
+	hostPort, err := s.replicator.getRemoteReplicatorWSHostPort(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(levels)
+	if err != nil {
+		return nil, err
+	}
+
+	shipURL := fmt.Sprintf("http://%v%v?%v=%v", hostPort, httpPathAckLevels, httpParamZone, url.QueryEscape(s.localZone))
+	resp, err := s.httpClient.Post(shipURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %v", hostPort, resp.Status)
+	}
+
+	result := &ackLevelsResult{}
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(bark.Fields{
+		common.TagZoneName: common.FmtZoneName(zone),
+		`shipped`:          len(levels),
+		`moved`:            result.Moved,
+		`skipped`:          len(result.Skipped),
+	}).Debug(`AckLevelShipper: shipped ack levels`)
+	return result, nil
+}
+
+// AckLevelsHandler receives the ack levels shipped from the replicator of another zone
+func (r *Replicator) AckLevelsHandler(w http.ResponseWriter, req *http.Request) {
+	r.m3Client.IncCounter(metrics.ReplicatorReceiveAckLevelsScope, metrics.ReplicatorRequests)
+
+	if req.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	zone := req.URL.Query().Get(httpParamZone)
+	if !r.isRemoteZone(zone) {
+		r.m3Client.IncCounter(metrics.ReplicatorReceiveAckLevelsScope, metrics.ReplicatorBadRequest)
+		http.Error(w, fmt.Sprintf("unknown zone %q", zone), http.StatusForbidden)
+		return
+	}
+
+	var levels []*ackLevel
+	if err := json.NewDecoder(req.Body).Decode(&levels); err != nil {
+		r.m3Client.IncCounter(metrics.ReplicatorReceiveAckLevelsScope, metrics.ReplicatorBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := r.applyAckLevels(zone, levels)
+	if err != nil {
+		r.m3Client.IncCounter(metrics.ReplicatorReceiveAckLevelsScope, metrics.ReplicatorFailures)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// isRemoteZone returns whether the zone is one of the other zones of the tenancy
+func (r *Replicator) isRemoteZone(zone string) bool {
+	if len(zone) == 0 || strings.EqualFold(zone, r.localZone) {
+		return false
+	}
+	for _, z := range r.allZones[r.tenancy] {
+		if strings.EqualFold(z, zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAckLevels moves the local consumer group extents to the ack levels
+// shipped from the zone. Only the active zone of a multi-zone consumer
+// group is trusted with its ack levels, the others are rejected. Ack levels
+// of consumer groups or extents that didn't make it to the local zone yet
+// are skipped, they are shipped again until they do.
+func (r *Replicator) applyAckLevels(zone string, levels []*ackLevel) (*ackLevelsResult, error) {
+	if r.versions == nil {
+		return nil, &shared.InternalServiceError{Message: `Metadata client doesn't support replicated ack levels`}
+	}
+
+	ctx, cancel := thrift.NewContext(localReplicatorCallTimeOut)
+	defer cancel()
+
+	// the local consumer groups, nil if missing, and the stores of the
+	// local replicas of the extents, empty if missing
+	cgs := make(map[string]*shared.ConsumerGroupDescription)
+	extStores := make(map[string][]string)
+
+	result := &ackLevelsResult{}
+	for _, level := range levels {
+		lclLg := r.logger.WithFields(bark.Fields{
+			common.TagCnsm:     common.FmtCnsm(level.ConsumerGroupUUID),
+			common.TagExt:      common.FmtExt(level.ExtentUUID),
+			common.TagZoneName: common.FmtZoneName(zone),
+		})
+
+		cg, ok := cgs[level.ConsumerGroupUUID]
+		if !ok {
+			var err error
+			cg, err = r.metaClient.ReadConsumerGroupByUUID(ctx, &metadata.ReadConsumerGroupRequest{
+				ConsumerGroupUUID: common.StringPtr(level.ConsumerGroupUUID),
+			})
+			if err != nil {
+				if _, notExists := err.(*shared.EntityNotExistsError); !notExists {
+					return nil, err
+				}
+				cg = nil
+			}
+			cgs[level.ConsumerGroupUUID] = cg
+		}
+		if cg == nil {
+			result.Skipped = append(result.Skipped, level.key())
+			continue
+		}
+
+		if !cg.GetIsMultiZone() || !strings.EqualFold(cg.GetActiveZone(), zone) ||
+			cg.GetDestinationUUID() != level.DestinationUUID {
+			r.m3Client.IncCounter(metrics.ReplicatorReceiveAckLevelsScope, metrics.ReplicatorBadRequest)
+			lclLg.WithFields(bark.Fields{
+				`isMultiZone`: cg.GetIsMultiZone(),
+				`activeZone`:  cg.GetActiveZone(),
+			}).Warn(`Rejected ack level from a zone that isn't active for the consumer group`)
+			continue
+		}
+
+		stores, ok := extStores[level.ExtentUUID]
+		if !ok {
+			// a missing extent doesn't read as EntityNotExistsError, so
+			// any error skips it; skipped levels are shipped again
+			stats, err := r.metaClient.ReadExtentStats(ctx, &metadata.ReadExtentStatsRequest{
+				DestinationUUID: common.StringPtr(level.DestinationUUID),
+				ExtentUUID:      common.StringPtr(level.ExtentUUID),
+			})
+			if err == nil {
+				stores = stats.GetExtentStats().GetExtent().GetStoreUUIDs()
+			}
+			extStores[level.ExtentUUID] = stores
+		}
+		if len(stores) == 0 {
+			result.Skipped = append(result.Skipped, level.key())
+			continue
+		}
+
+		applied, err := r.versions.SetReplicatedAckLevel(ctx, level.ConsumerGroupUUID, level.ExtentUUID, stores, level.AckLevelAddress, level.AckLevelSeqNo)
+		if err != nil {
+			lclLg.WithField(common.TagErr, err).Error(`Failed to set replicated ack level`)
+			return nil, err
+		}
+		if applied {
+			result.Moved++
+		}
+	}
+
+	r.m3Client.AddCounter(metrics.ReplicatorReceiveAckLevelsScope, metrics.ReplicatorAckLevelsMoved, int64(result.Moved))
+	return result, nil
+}
@@ -26,11 +26,20 @@ import (
 
 const (
 	ukeyAuthoritativeZone = "replicator.AuthoritativeZone"
+	// ukeyZoneBandwidthLimits is the bandwidth available to the replicators
+	// of this zone to pull messages from each remote zone, as a comma
+	// separated list of zone=bytesPerSec; each replicator takes its share
+	ukeyZoneBandwidthLimits = "replicator.ZoneBandwidthLimits"
+	// ukeyDestinationPriorities is the priority of the destinations when
+	// the bandwidth is short, as a comma separated list of path=priority
+	ukeyDestinationPriorities = "replicator.DestinationPriorities"
 )
 
 func (r *Replicator) registerUconfig() {
 	handlerMap := make(map[string]dconfig.Handler)
 	handlerMap[ukeyAuthoritativeZone] = dconfig.GenerateStringHandler(ukeyAuthoritativeZone, r.setAuthoritativeZone, r.getAuthoritativeZone)
+	handlerMap[ukeyZoneBandwidthLimits] = dconfig.GenerateStringHandler(ukeyZoneBandwidthLimits, r.throttle.setZoneLimits, r.throttle.getZoneLimits)
+	handlerMap[ukeyDestinationPriorities] = dconfig.GenerateStringHandler(ukeyDestinationPriorities, r.throttle.setDestinationPriorities, r.throttle.getDestinationPriorities)
 	r.uconfigClient.AddHandlers(handlerMap)
 }
 
@@ -42,6 +51,20 @@ func (r *Replicator) loadUconfig() {
 	} else {
 		r.logger.WithField(ukeyAuthoritativeZone, valueUcfg).Error(`Cannot get value from uconfig`)
 	}
+
+	// no limits and all the destinations at normal priority by default
+	for key, setter := range map[string]dconfig.SetterString{
+		ukeyZoneBandwidthLimits:   r.throttle.setZoneLimits,
+		ukeyDestinationPriorities: r.throttle.setDestinationPriorities,
+	} {
+		value, ok := r.uconfigClient.GetOrDefault(key, ``).(string)
+		if !ok {
+			r.logger.WithField(key, value).Error(`Cannot get value from uconfig`)
+			continue
+		}
+		setter(value)
+		r.logger.WithField(key, value).Info(`Update the uconfig value`)
+	}
 }
 
 func (r *Replicator) dynamicConfigManage() {
@@ -21,6 +21,11 @@
 package replicator
 
 import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -47,21 +52,34 @@ type (
 		replicator *Replicator
 		localZone  string
 
-		mClient  metadata.TChanMetadataService
-		logger   bark.Logger
-		m3Client metrics.Client
+		mClient    metadata.TChanMetadataService
+		logger     bark.Logger
+		m3Client   metrics.Client
+		httpClient *http.Client
 
 		closeChannel chan struct{}
 
 		ticker  *time.Ticker
 		running int64
 	}
+
+	// zoneConsumerGroup is a multi-zone consumer group of a zone, as listed for reconciliation
+	zoneConsumerGroup struct {
+		DestinationPath string                           `json:"destinationPath"`
+		ConsumerGroup   *shared.ConsumerGroupDescription `json:"consumerGroup"`
+		// Version is the version of the consumer group in the zone, empty if it has none
+		Version string `json:"version,omitempty"`
+	}
 )
 
 const (
 	// runInterval determines how often the reconciler will run
 	runInterval                 = time.Duration(10 * time.Minute)
 	metadataListRequestPageSize = 50
+
+	// httpPathConsumerGroups is the path the multi-zone consumer groups are listed at, on the websocket port of the replicators;
+	// the requester passes its zone in httpParamZone, and must be one of the replicators configured for it
+	httpPathConsumerGroups = "/replicator/consumergroups"
 )
 
 // NewMetadataReconciler returns an instance of MetadataReconciler
@@ -72,6 +90,7 @@ func NewMetadataReconciler(mClient metadata.TChanMetadataService, replicator *Re
 		mClient:    mClient,
 		logger:     logger,
 		m3Client:   m3client,
+		httpClient: &http.Client{Timeout: remoteReplicatorCallTimeOut},
 		ticker:     time.NewTicker(runInterval),
 		running:    0,
 	}
@@ -108,13 +127,18 @@ func (r *metadataReconciler) run() {
 		return
 	}
 
-	// destination metadata reconciliation is only needed if this is a non-authoritative zone
-	if r.localZone != r.replicator.getAuthoritativeZone() {
-		r.m3Client.UpdateGauge(metrics.ReplicatorReconcileScope, metrics.ReplicatorReconcileDestRun, 1)
-		err = r.reconcileDestMetadata()
-		if err != nil {
-			r.m3Client.UpdateGauge(metrics.ReplicatorReconcileScope, metrics.ReplicatorReconcileDestFail, 1)
-		}
+	// destinations can be changed in any zone, so every zone reconciles against all the others
+	r.m3Client.UpdateGauge(metrics.ReplicatorReconcileScope, metrics.ReplicatorReconcileDestRun, 1)
+	err = r.reconcileDestMetadata()
+	if err != nil {
+		r.m3Client.UpdateGauge(metrics.ReplicatorReconcileScope, metrics.ReplicatorReconcileDestFail, 1)
+	}
+
+	// consumer groups are repaired from the authoritative zone, which needs their destinations reconciled first
+	r.m3Client.UpdateGauge(metrics.ReplicatorReconcileScope, metrics.ReplicatorReconcileCgRun, 1)
+	err = r.reconcileCgMetadata()
+	if err != nil {
+		r.m3Client.UpdateGauge(metrics.ReplicatorReconcileScope, metrics.ReplicatorReconcileCgFail, 1)
 	}
 
 	// reconcile destination extents
@@ -128,26 +152,40 @@ func (r *metadataReconciler) run() {
 }
 
 func (r *metadataReconciler) reconcileDestMetadata() error {
-	localDests, err := r.getAllMultiZoneDestInLocalZone()
-	if err != nil {
-		return err
-	}
+	var lastErr error
+	for _, zone := range r.replicator.allZones[r.replicator.tenancy] {
+		// skip local zone
+		if strings.EqualFold(zone, r.localZone) {
+			continue
+		}
 
-	remoteDests, err := r.getAllMultiZoneDestInAuthoritativeZone()
-	if err != nil {
-		return err
-	}
+		// the local destinations are listed again for every zone, as reconciling against a zone changes them
+		localDests, err := r.getAllMultiZoneDestInLocalZone()
+		if err != nil {
+			return err
+		}
+
+		remoteDests, remoteVersions, err := r.getAllMultiZoneDestInRemoteZone(zone)
+		if err != nil {
+			lastErr = err
+			continue
+		}
 
-	return r.reconcileDest(localDests, remoteDests)
+		if err = r.reconcileDest(localDests, remoteDests, remoteVersions, zone); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
 }
 
-func (r *metadataReconciler) reconcileDest(localDests []*shared.DestinationDescription, remoteDests []*shared.DestinationDescription) error {
+func (r *metadataReconciler) reconcileDest(localDests []*shared.DestinationDescription, remoteDests []*shared.DestinationDescription, remoteVersions map[string]*entityVersion, zone string) error {
 	localDestsSet := make(map[string]*shared.DestinationDescription)
 	for _, dest := range localDests {
 		localDestsSet[dest.GetDestinationUUID()] = dest
 	}
 
 	for _, remoteDest := range remoteDests {
+		remoteVersion := remoteVersions[remoteDest.GetDestinationUUID()]
 		localDest, ok := localDestsSet[remoteDest.GetDestinationUUID()]
 		if ok {
 			if remoteDest.GetStatus() == shared.DestinationStatus_DELETING || remoteDest.GetStatus() == shared.DestinationStatus_DELETED {
@@ -174,7 +212,20 @@ func (r *metadataReconciler) reconcileDest(localDests []*shared.DestinationDescr
 				continue
 			}
 
-			// case #2: destination exists in both remote and local, try to compare the property to see if anything gets updated
+			// case #2: destination exists in both remote and local, try to compare the property to see if anything gets updated.
+			// Versioned destinations follow the zone with the latest update; unversioned ones, as before, the authoritative zone
+			localVersion, err := r.replicator.readEntityVersion(remoteDest.GetDestinationUUID())
+			if err != nil {
+				r.logger.WithFields(bark.Fields{
+					common.TagErr: err,
+					common.TagDst: common.FmtDst(remoteDest.GetDestinationUUID()),
+				}).Error(`Failed to read destination version for reconciliation`)
+				continue
+			}
+			if remoteVersion == nil && (localVersion != nil || !strings.EqualFold(zone, r.replicator.getAuthoritativeZone())) {
+				continue
+			}
+
 			updateRequest := &shared.UpdateDestinationRequest{
 				DestinationUUID: common.StringPtr(remoteDest.GetDestinationUUID()),
 			}
@@ -198,11 +249,34 @@ func (r *metadataReconciler) reconcileDest(localDests []*shared.DestinationDescr
 				destUpdated = true
 			}
 
-			if destUpdated {
+			if !destUpdated {
+				// same state, the versions only need to learn about each other
+				if remoteVersion != nil && (localVersion == nil || localVersion.vector.compare(remoteVersion.vector) != vectorEqual) {
+					if err = r.replicator.appliedRemoteVersion(remoteDest.GetDestinationUUID(), remoteVersion); err != nil {
+						r.logger.WithFields(bark.Fields{
+							common.TagErr: err,
+							common.TagDst: common.FmtDst(remoteDest.GetDestinationUUID()),
+						}).Error(`Failed to merge destination version for reconciliation`)
+					}
+				}
+				continue
+			}
+
+			// the same version in both zones with a different state means an update
+			// was written without being versioned, e.g. when the controller could
+			// not reach the replicator; the authoritative zone wins then
+			if remoteVersion != nil && localVersion != nil && localVersion.vector.compare(remoteVersion.vector) == vectorEqual {
+				if !strings.EqualFold(zone, r.replicator.getAuthoritativeZone()) {
+					continue
+				}
+				remoteVersion = nil
+			}
+
+			if remoteVersion == nil || remoteVersion.supersedes(localVersion) {
 				r.logger.WithField(common.TagDst, common.FmtDst(remoteDest.GetDestinationUUID())).Info(`Found destination gets updated in remote but not in local`)
 				ctx, cancel := thrift.NewContext(localReplicatorCallTimeOut)
 				defer cancel()
-				_, err := r.replicator.UpdateDestination(ctx, updateRequest)
+				_, err := r.replicator.UpdateDestination(withVersion(ctx, remoteVersion), updateRequest)
 				if err != nil {
 					r.logger.WithFields(bark.Fields{
 						common.TagErr: err,
@@ -238,7 +312,7 @@ func (r *metadataReconciler) reconcileDest(localDests []*shared.DestinationDescr
 
 			ctx, cancel := thrift.NewContext(localReplicatorCallTimeOut)
 			defer cancel()
-			_, err := r.replicator.CreateDestinationUUID(ctx, createRequest)
+			_, err := r.replicator.CreateDestinationUUID(withVersion(ctx, remoteVersion), createRequest)
 			if err != nil {
 				r.logger.WithFields(bark.Fields{
 					common.TagErr: err,
@@ -278,16 +352,16 @@ func (r *metadataReconciler) getAllMultiZoneDestInLocalZone() ([]*shared.Destina
 	return dests, nil
 }
 
-func (r *metadataReconciler) getAllMultiZoneDestInAuthoritativeZone() ([]*shared.DestinationDescription, error) {
+// getAllMultiZoneDestInRemoteZone returns the multi-zone destinations of a remote zone, and their versions by uuid
+func (r *metadataReconciler) getAllMultiZoneDestInRemoteZone(zone string) ([]*shared.DestinationDescription, map[string]*entityVersion, error) {
 	var err error
-	authoritativeZone := r.replicator.getAuthoritativeZone()
-	remoteReplicator, err := r.replicator.clientFactory.GetReplicatorClient(authoritativeZone)
+	remoteReplicator, err := r.replicator.clientFactory.GetReplicatorClient(zone)
 	if err != nil {
 		r.logger.WithFields(bark.Fields{
 			common.TagErr:      err,
-			common.TagZoneName: common.FmtZoneName(authoritativeZone),
+			common.TagZoneName: common.FmtZoneName(zone),
 		}).Error(`Failed to get remote replicator client`)
-		return nil, err
+		return nil, nil, err
 	}
 
 	listReq := &shared.ListDestinationsByUUIDRequest{
@@ -297,25 +371,453 @@ func (r *metadataReconciler) getAllMultiZoneDestInAuthoritativeZone() ([]*shared
 	}
 
 	var dests []*shared.DestinationDescription
+	versions := make(map[string]*entityVersion)
 
 	for {
 		ctx, cancel := thrift.NewContext(remoteReplicatorCallTimeOut)
 		defer cancel()
 		res, err := remoteReplicator.ListDestinationsByUUID(ctx, listReq)
 		if err != nil {
-			r.logger.WithField(common.TagErr, err).Error(`Remote replicator call ListDestinationsByUUID failed`)
-			return nil, err
+			r.logger.WithFields(bark.Fields{
+				common.TagErr:      err,
+				common.TagZoneName: common.FmtZoneName(zone),
+			}).Error(`Remote replicator call ListDestinationsByUUID failed`)
+			return nil, nil, err
 		}
 
 		dests = append(dests, res.GetDestinations()...)
 
+		for key, value := range ctx.ResponseHeaders() {
+			if !strings.HasPrefix(key, versionHeaderPrefix) {
+				continue
+			}
+			version, errVer := parseEntityVersion(value)
+			if errVer != nil {
+				r.logger.WithFields(bark.Fields{
+					common.TagErr:      errVer,
+					common.TagZoneName: common.FmtZoneName(zone),
+				}).Warn(`Remote replicator returned a malformed destination version`)
+				continue
+			}
+			versions[strings.TrimPrefix(key, versionHeaderPrefix)] = version
+		}
+
 		if len(res.GetNextPageToken()) == 0 {
 			break
 		}
 
 		listReq.PageToken = res.GetNextPageToken()
 	}
-	return dests, nil
+	return dests, versions, nil
+}
+
+// reconcileCgMetadata repairs the multi-zone consumer groups of the local zone
+// from the authoritative zone. Consumer groups whose latest update was made
+// locally, but never made it to the authoritative zone, are shipped to it instead.
+func (r *metadataReconciler) reconcileCgMetadata() error {
+	zone := r.replicator.getAuthoritativeZone()
+	// the authoritative zone is the reference the other zones are repaired from
+	if len(zone) == 0 || strings.EqualFold(zone, r.localZone) {
+		return nil
+	}
+
+	localCgs, err := r.replicator.listMultiZoneConsumerGroups()
+	if err != nil {
+		return err
+	}
+
+	remoteCgs, err := r.getAllMultiZoneCgInRemoteZone(zone)
+	if err != nil {
+		return err
+	}
+
+	return r.reconcileCg(localCgs, remoteCgs, zone)
+}
+
+func (r *metadataReconciler) reconcileCg(localCgs []*zoneConsumerGroup, remoteCgs []*zoneConsumerGroup, zone string) error {
+	localCgsSet := make(map[string]*zoneConsumerGroup)
+	for _, cg := range localCgs {
+		localCgsSet[cg.ConsumerGroup.GetConsumerGroupUUID()] = cg
+	}
+	remoteCgsSet := make(map[string]*zoneConsumerGroup)
+	for _, cg := range remoteCgs {
+		remoteCgsSet[cg.ConsumerGroup.GetConsumerGroupUUID()] = cg
+	}
+
+	for _, remoteCg := range remoteCgs {
+		lclLg := r.cgLogger(remoteCg, zone)
+
+		localCg, ok := localCgsSet[remoteCg.ConsumerGroup.GetConsumerGroupUUID()]
+		if ok {
+			r.reconcileCgState(localCg, remoteCg, zone, lclLg)
+			continue
+		}
+
+		// case #1: consumer group exists in the authoritative zone, but not in local. Create the consumer group locally
+		if remoteCg.ConsumerGroup.GetStatus() == shared.ConsumerGroupStatus_DELETED {
+			continue
+		}
+		lclLg.Warn(`Found missing consumer group from authoritative zone!`)
+		r.m3Client.IncCounter(metrics.ReplicatorReconcileScope, metrics.ReplicatorReconcileCgFoundMissing)
+
+		remoteVersion, err := remoteCg.version()
+		if err != nil {
+			lclLg.WithField(common.TagErr, err).Warn(`Authoritative zone returned a malformed consumer group version`)
+		}
+
+		// a disabled consumer group is created enabled, the next run disables it
+		ctx, cancel := thrift.NewContext(localReplicatorCallTimeOut)
+		_, err = r.replicator.CreateConsumerGroupUUID(withVersion(ctx, remoteVersion), cgCreateRequest(remoteCg))
+		cancel()
+		if err != nil {
+			lclLg.WithField(common.TagErr, err).Error(`Failed to create consumer group in local zone for reconciliation`)
+		}
+	}
+
+	for _, localCg := range localCgs {
+		if _, ok := remoteCgsSet[localCg.ConsumerGroup.GetConsumerGroupUUID()]; ok {
+			continue
+		}
+
+		// case #2: consumer group exists in local, but not in the authoritative zone. Deleted consumer
+		// groups are kept in the DELETED status, so its creation never made it there: ship it again
+		if localCg.ConsumerGroup.GetStatus() == shared.ConsumerGroupStatus_DELETED {
+			continue
+		}
+		lclLg := r.cgLogger(localCg, zone)
+		lclLg.Warn(`Found consumer group missing in authoritative zone!`)
+		r.m3Client.IncCounter(metrics.ReplicatorReconcileScope, metrics.ReplicatorReconcileCgFoundExtra)
+
+		localVersion, err := localCg.version()
+		if err != nil {
+			lclLg.WithField(common.TagErr, err).Warn(`Malformed local consumer group version`)
+		}
+		r.replicator.createConsumerGroupRemoteCall(zone, lclLg, cgCreateRequest(localCg), localVersion)
+	}
+	return nil
+}
+
+// reconcileCgState repairs the config and status of a consumer group that exists in both zones
+func (r *metadataReconciler) reconcileCgState(localCg *zoneConsumerGroup, remoteCg *zoneConsumerGroup, zone string, lclLg bark.Logger) {
+	localDeleted := localCg.ConsumerGroup.GetStatus() == shared.ConsumerGroupStatus_DELETED
+	remoteDeleted := remoteCg.ConsumerGroup.GetStatus() == shared.ConsumerGroupStatus_DELETED
+	if localDeleted || remoteDeleted {
+		if localDeleted == remoteDeleted {
+			return
+		}
+
+		// case #3: consumer group is deleted in one zone only. Deletions are not versioned, they
+		// win over any update, so the consumer group is deleted wherever it is not yet
+		lclLg.WithFields(bark.Fields{
+			`localStatus`:  localCg.ConsumerGroup.GetStatus(),
+			`remoteStatus`: remoteCg.ConsumerGroup.GetStatus(),
+		}).Info(`Found consumer group deleted in one zone only`)
+		r.m3Client.IncCounter(metrics.ReplicatorReconcileScope, metrics.ReplicatorReconcileCgInconsistentStatus)
+
+		deleteRequest := &shared.DeleteConsumerGroupRequest{
+			DestinationPath:   common.StringPtr(localCg.DestinationPath),
+			ConsumerGroupName: common.StringPtr(localCg.ConsumerGroup.GetConsumerGroupName()),
+		}
+		if localDeleted {
+			r.replicator.deleteConsumerGroupRemoteCall(zone, lclLg, deleteRequest)
+			return
+		}
+
+		ctx, cancel := thrift.NewContext(localReplicatorCallTimeOut)
+		defer cancel()
+		if err := r.replicator.DeleteConsumerGroup(ctx, deleteRequest); err != nil {
+			lclLg.WithField(common.TagErr, err).Error(`Failed to delete consumer group in local zone for reconciliation`)
+		}
+		return
+	}
+
+	localVersion, err := localCg.version()
+	if err != nil {
+		lclLg.WithField(common.TagErr, err).Warn(`Malformed local consumer group version`)
+	}
+	remoteVersion, err := remoteCg.version()
+	if err != nil {
+		lclLg.WithField(common.TagErr, err).Warn(`Authoritative zone returned a malformed consumer group version`)
+	}
+
+	configChanged, statusChanged := diffConsumerGroup(localCg.ConsumerGroup, remoteCg.ConsumerGroup)
+	if !configChanged && !statusChanged {
+		// same state, the versions only need to learn about each other
+		if remoteVersion != nil && (localVersion == nil || localVersion.vector.compare(remoteVersion.vector) != vectorEqual) {
+			if err = r.replicator.appliedRemoteVersion(remoteCg.ConsumerGroup.GetConsumerGroupUUID(), remoteVersion); err != nil {
+				lclLg.WithField(common.TagErr, err).Error(`Failed to merge consumer group version for reconciliation`)
+			}
+		}
+		return
+	}
+
+	// case #4: consumer group exists in both zones with a different config or status
+	if configChanged {
+		r.m3Client.IncCounter(metrics.ReplicatorReconcileScope, metrics.ReplicatorReconcileCgInconsistentConfig)
+	}
+	if statusChanged {
+		r.m3Client.IncCounter(metrics.ReplicatorReconcileScope, metrics.ReplicatorReconcileCgInconsistentStatus)
+	}
+
+	if localVersion.supersedes(remoteVersion) {
+		lclLg.Info(`Found consumer group updated in local but not in authoritative zone`)
+		r.replicator.updateConsumerGroupRemoteCall(zone, lclLg, cgUpdateRequest(localCg), localVersion)
+		return
+	}
+
+	lclLg.Info(`Found consumer group updated in authoritative zone but not in local`)
+	// the same version in both zones with a different state would be skipped as stale,
+	// the authoritative zone wins then
+	if localVersion != nil && remoteVersion != nil && localVersion.vector.compare(remoteVersion.vector) == vectorEqual {
+		remoteVersion = nil
+	}
+	ctx, cancel := thrift.NewContext(localReplicatorCallTimeOut)
+	defer cancel()
+	if _, err = r.replicator.UpdateConsumerGroup(withVersion(ctx, remoteVersion), cgUpdateRequest(remoteCg)); err != nil {
+		lclLg.WithField(common.TagErr, err).Error(`Failed to update consumer group in local zone for reconciliation`)
+	}
+}
+
+func (r *metadataReconciler) cgLogger(cg *zoneConsumerGroup, zone string) bark.Logger {
+	return r.logger.WithFields(bark.Fields{
+		common.TagCnsm:     common.FmtCnsm(cg.ConsumerGroup.GetConsumerGroupUUID()),
+		common.TagDstPth:   common.FmtDstPth(cg.DestinationPath),
+		common.TagCnsPth:   common.FmtCnsPth(cg.ConsumerGroup.GetConsumerGroupName()),
+		common.TagZoneName: common.FmtZoneName(zone),
+	})
+}
+
+// getAllMultiZoneCgInRemoteZone returns the multi-zone consumer groups of a remote zone. The
+// replicator thrift API can't list consumer groups, they are listed on the websocket port.
+func (r *metadataReconciler) getAllMultiZoneCgInRemoteZone(zone string) ([]*zoneConsumerGroup, error) {
+	hostPort, err := r.replicator.getRemoteReplicatorWSHostPort(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	listURL := fmt.Sprintf("http://%v%v?%v=%v", hostPort, httpPathConsumerGroups, httpParamZone, url.QueryEscape(r.localZone))
+	resp, err := r.httpClient.Get(listURL)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = fmt.Errorf("%v: %v", hostPort, resp.Status)
+	}
+	if err != nil {
+		r.logger.WithFields(bark.Fields{
+			common.TagErr:      err,
+			common.TagZoneName: common.FmtZoneName(zone),
+		}).Error(`Failed to list consumer groups of remote zone`)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var cgs []*zoneConsumerGroup
+	if err = json.NewDecoder(resp.Body).Decode(&cgs); err != nil {
+		r.logger.WithFields(bark.Fields{
+			common.TagErr:      err,
+			common.TagZoneName: common.FmtZoneName(zone),
+		}).Error(`Remote replicator returned malformed consumer groups`)
+		return nil, err
+	}
+	return cgs, nil
+}
+
+// diffConsumerGroup tells whether the replicated config, and the status, of two
+// copies of a consumer group differ. The dead letter queue is local to each zone.
+func diffConsumerGroup(local *shared.ConsumerGroupDescription, remote *shared.ConsumerGroupDescription) (configChanged bool, statusChanged bool) {
+	configChanged = local.GetLockTimeoutSeconds() != remote.GetLockTimeoutSeconds() ||
+		local.GetMaxDeliveryCount() != remote.GetMaxDeliveryCount() ||
+		local.GetSkipOlderMessagesSeconds() != remote.GetSkipOlderMessagesSeconds() ||
+		local.GetOwnerEmail() != remote.GetOwnerEmail()
+	statusChanged = local.GetStatus() != remote.GetStatus()
+	return
+}
+
+func cgCreateRequest(cg *zoneConsumerGroup) *shared.CreateConsumerGroupUUIDRequest {
+	desc := cg.ConsumerGroup
+	return &shared.CreateConsumerGroupUUIDRequest{
+		Request: &shared.CreateConsumerGroupRequest{
+			DestinationPath:          common.StringPtr(cg.DestinationPath),
+			ConsumerGroupName:        common.StringPtr(desc.GetConsumerGroupName()),
+			StartFrom:                common.Int64Ptr(desc.GetStartFrom()),
+			LockTimeoutSeconds:       common.Int32Ptr(desc.GetLockTimeoutSeconds()),
+			MaxDeliveryCount:         common.Int32Ptr(desc.GetMaxDeliveryCount()),
+			SkipOlderMessagesSeconds: common.Int32Ptr(desc.GetSkipOlderMessagesSeconds()),
+			OwnerEmail:               common.StringPtr(desc.GetOwnerEmail()),
+			IsMultiZone:              common.BoolPtr(desc.GetIsMultiZone()),
+			ActiveZone:               common.StringPtr(desc.GetActiveZone()),
+			ZoneConfigs:              desc.GetZoneConfigs(),
+		},
+		ConsumerGroupUUID: common.StringPtr(desc.GetConsumerGroupUUID()),
+	}
+}
+
+func cgUpdateRequest(cg *zoneConsumerGroup) *shared.UpdateConsumerGroupRequest {
+	desc := cg.ConsumerGroup
+	return &shared.UpdateConsumerGroupRequest{
+		DestinationPath:          common.StringPtr(cg.DestinationPath),
+		ConsumerGroupName:        common.StringPtr(desc.GetConsumerGroupName()),
+		Status:                   common.InternalConsumerGroupStatusPtr(desc.GetStatus()),
+		LockTimeoutSeconds:       common.Int32Ptr(desc.GetLockTimeoutSeconds()),
+		MaxDeliveryCount:         common.Int32Ptr(desc.GetMaxDeliveryCount()),
+		SkipOlderMessagesSeconds: common.Int32Ptr(desc.GetSkipOlderMessagesSeconds()),
+		OwnerEmail:               common.StringPtr(desc.GetOwnerEmail()),
+		// empty keeps the dead letter queue of the zone, nil would clear it
+		DeadLetterQueueDestinationUUID: common.StringPtr(""),
+	}
+}
+
+// version returns the version the consumer group is at in its zone, nil if it has none
+func (cg *zoneConsumerGroup) version() (*entityVersion, error) {
+	if len(cg.Version) == 0 {
+		return nil, nil
+	}
+	return parseEntityVersion(cg.Version)
+}
+
+// listMultiZoneConsumerGroups returns the multi-zone consumer groups of the local
+// zone, with the paths of their destinations and their versions
+func (r *Replicator) listMultiZoneConsumerGroups() ([]*zoneConsumerGroup, error) {
+	ctx, cancel := thrift.NewContext(localReplicatorCallTimeOut)
+	defer cancel()
+
+	listReq := &metadata.ListConsumerGroupRequest{
+		Limit: common.Int64Ptr(metadataListRequestPageSize),
+	}
+
+	paths := make(map[string]string)
+
+	var cgs []*zoneConsumerGroup
+	for {
+		listResp, err := r.metaClient.ListAllConsumerGroups(ctx, listReq)
+		if err != nil {
+			r.logger.WithField(common.TagErr, err).Error(`Metadata call ListAllConsumerGroups failed`)
+			return nil, err
+		}
+
+		for _, cg := range listResp.GetConsumerGroups() {
+			if !cg.GetIsMultiZone() {
+				continue
+			}
+
+			path, ok := paths[cg.GetDestinationUUID()]
+			if !ok {
+				dest, errDest := r.metaClient.ReadDestination(ctx, &metadata.ReadDestinationRequest{
+					DestinationUUID: common.StringPtr(cg.GetDestinationUUID()),
+				})
+				if errDest != nil {
+					if _, notExists := errDest.(*shared.EntityNotExistsError); !notExists {
+						r.logger.WithFields(bark.Fields{
+							common.TagErr: errDest,
+							common.TagDst: common.FmtDst(cg.GetDestinationUUID()),
+						}).Error(`Metadata call ReadDestination failed`)
+						return nil, errDest
+					}
+				} else {
+					path = dest.GetPath()
+				}
+				paths[cg.GetDestinationUUID()] = path
+			}
+			// the consumer groups of a destination that is gone are not reconciled
+			if len(path) == 0 {
+				continue
+			}
+
+			version, err := r.readEntityVersion(cg.GetConsumerGroupUUID())
+			if err != nil {
+				r.logger.WithFields(bark.Fields{
+					common.TagErr:  err,
+					common.TagCnsm: common.FmtCnsm(cg.GetConsumerGroupUUID()),
+				}).Error(`Failed to read consumer group version`)
+				return nil, err
+			}
+
+			zoneCg := &zoneConsumerGroup{
+				DestinationPath: path,
+				ConsumerGroup:   cg,
+			}
+			if version != nil {
+				zoneCg.Version = version.String()
+			}
+			cgs = append(cgs, zoneCg)
+		}
+
+		if len(listResp.GetNextPageToken()) == 0 {
+			break
+		}
+		listReq.PageToken = listResp.GetNextPageToken()
+	}
+
+	return cgs, nil
+}
+
+// ConsumerGroupsHandler lists the multi-zone consumer groups of the local zone,
+// for the replicators of the other zones to reconcile against. The listing has
+// the owners of the consumer groups, it is only served to those replicators.
+func (r *Replicator) ConsumerGroupsHandler(w http.ResponseWriter, req *http.Request) {
+	r.m3Client.IncCounter(metrics.ReplicatorListCgScope, metrics.ReplicatorRequests)
+
+	if req.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	zone := req.URL.Query().Get(httpParamZone)
+	if !r.isReplicatorOfZone(zone, req.RemoteAddr) {
+		r.m3Client.IncCounter(metrics.ReplicatorListCgScope, metrics.ReplicatorBadRequest)
+		r.logger.WithFields(bark.Fields{
+			common.TagZoneName: common.FmtZoneName(zone),
+			`remoteAddr`:       req.RemoteAddr,
+		}).Warn(`Refused to list consumer groups to unknown replicator`)
+		http.Error(w, fmt.Sprintf("not a replicator of zone %q", zone), http.StatusForbidden)
+		return
+	}
+
+	cgs, err := r.listMultiZoneConsumerGroups()
+	if err != nil {
+		r.m3Client.IncCounter(metrics.ReplicatorListCgScope, metrics.ReplicatorFailures)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cgs)
+}
+
+// isReplicatorOfZone tells whether the remote address is one of the
+// replicators configured for the given remote zone
+func (r *Replicator) isReplicatorOfZone(zone string, remoteAddr string) bool {
+	if !r.isRemoteZone(zone) {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	remoteDeployment := strings.ToLower(fmt.Sprintf("%v_%v", r.tenancy, zone))
+	for deployment, hosts := range r.AppConfig.GetReplicatorConfig().GetReplicatorHosts() {
+		if !strings.EqualFold(deployment, remoteDeployment) {
+			continue
+		}
+		for _, h := range strings.Split(hosts, ",") {
+			h = strings.TrimSpace(h)
+			if h == host {
+				return true
+			}
+			// the replicators may be configured by name
+			if net.ParseIP(h) != nil {
+				continue
+			}
+			addrs, _ := net.LookupHost(h)
+			for _, addr := range addrs {
+				if addr == host {
+					return true
+				}
+			}
+		}
+	}
+	return false
 }
 
 func (r *metadataReconciler) reconcileDestExtentMetadata() error {
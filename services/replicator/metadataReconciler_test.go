@@ -0,0 +1,130 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replicator
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+)
+
+type MetadataReconcilerSuite struct {
+	*require.Assertions
+	suite.Suite
+}
+
+func TestMetadataReconcilerSuite(t *testing.T) {
+	suite.Run(t, new(MetadataReconcilerSuite))
+}
+
+func (s *MetadataReconcilerSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+}
+
+func newTestConsumerGroup() *shared.ConsumerGroupDescription {
+	return &shared.ConsumerGroupDescription{
+		ConsumerGroupUUID:              common.StringPtr("cg"),
+		DestinationUUID:                common.StringPtr("dst"),
+		ConsumerGroupName:              common.StringPtr("/test/cg"),
+		Status:                         common.InternalConsumerGroupStatusPtr(shared.ConsumerGroupStatus_ENABLED),
+		LockTimeoutSeconds:             common.Int32Ptr(60),
+		MaxDeliveryCount:               common.Int32Ptr(10),
+		SkipOlderMessagesSeconds:       common.Int32Ptr(3600),
+		DeadLetterQueueDestinationUUID: common.StringPtr("dlq"),
+		OwnerEmail:                     common.StringPtr("owner@example.com"),
+		IsMultiZone:                    common.BoolPtr(true),
+	}
+}
+
+func (s *MetadataReconcilerSuite) TestDiffConsumerGroup() {
+	local, remote := newTestConsumerGroup(), newTestConsumerGroup()
+	configChanged, statusChanged := diffConsumerGroup(local, remote)
+	s.False(configChanged)
+	s.False(statusChanged)
+
+	// the dead letter queue is not replicated
+	remote.DeadLetterQueueDestinationUUID = common.StringPtr("otherdlq")
+	configChanged, statusChanged = diffConsumerGroup(local, remote)
+	s.False(configChanged)
+	s.False(statusChanged)
+
+	remote.MaxDeliveryCount = common.Int32Ptr(20)
+	configChanged, statusChanged = diffConsumerGroup(local, remote)
+	s.True(configChanged)
+	s.False(statusChanged)
+
+	remote = newTestConsumerGroup()
+	remote.Status = common.InternalConsumerGroupStatusPtr(shared.ConsumerGroupStatus_DISABLED)
+	configChanged, statusChanged = diffConsumerGroup(local, remote)
+	s.False(configChanged)
+	s.True(statusChanged)
+}
+
+func (s *MetadataReconcilerSuite) TestRepairRequests() {
+	cg := &zoneConsumerGroup{DestinationPath: "/test/dst", ConsumerGroup: newTestConsumerGroup()}
+
+	createRequest := cgCreateRequest(cg)
+	s.Equal("cg", createRequest.GetConsumerGroupUUID())
+	s.Equal("/test/dst", createRequest.GetRequest().GetDestinationPath())
+	s.Equal(int32(10), createRequest.GetRequest().GetMaxDeliveryCount())
+	s.True(createRequest.GetRequest().GetIsMultiZone())
+	// the dead letter queue is created by each zone
+	s.False(createRequest.GetRequest().IsSetDeadLetterQueueDestinationUUID())
+
+	updateRequest := cgUpdateRequest(cg)
+	s.Equal("/test/dst", updateRequest.GetDestinationPath())
+	s.Equal(shared.ConsumerGroupStatus_ENABLED, updateRequest.GetStatus())
+	s.Equal("owner@example.com", updateRequest.GetOwnerEmail())
+	// an empty dead letter queue keeps the local one
+	s.True(updateRequest.IsSetDeadLetterQueueDestinationUUID())
+	s.Empty(updateRequest.GetDeadLetterQueueDestinationUUID())
+}
+
+func (s *MetadataReconcilerSuite) TestZoneConsumerGroupEncoding() {
+	version := newLocalVersion(nil, "zone1", time.Unix(1, 0))
+	cg := &zoneConsumerGroup{
+		DestinationPath: "/test/dst",
+		ConsumerGroup:   newTestConsumerGroup(),
+		Version:         version.String(),
+	}
+
+	data, err := json.Marshal([]*zoneConsumerGroup{cg, {DestinationPath: "/test/dst", ConsumerGroup: newTestConsumerGroup()}})
+	s.NoError(err)
+
+	var decoded []*zoneConsumerGroup
+	s.NoError(json.Unmarshal(data, &decoded))
+	s.Len(decoded, 2)
+	s.Equal(cg.ConsumerGroup, decoded[0].ConsumerGroup)
+
+	decodedVersion, err := decoded[0].version()
+	s.NoError(err)
+	s.Equal(version, decodedVersion)
+
+	decodedVersion, err = decoded[1].version()
+	s.NoError(err)
+	s.Nil(decodedVersion)
+}
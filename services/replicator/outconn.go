@@ -22,6 +22,7 @@ package replicator
 
 import (
 	"sync"
+	"time"
 
 	"github.com/uber-common/bark"
 	"github.com/uber/cherami-server/common"
@@ -40,6 +41,8 @@ type (
 		logger     bark.Logger
 		m3Client   metrics.Client
 		metricsTag int
+		lag        *common.ReplicationLagEstimator
+		throttle   *streamThrottle // nil if the messages are not throttled
 
 		readMsgCountChannel chan int32    // channel to pass read msg count from readMsgStream to writeCreditsStream in order to issue more credits
 		closeChannel        chan struct{} // channel to indicate the connection should be closed
@@ -56,6 +59,10 @@ const (
 	initialCreditSize = 10000
 
 	creditBatchSize = initialCreditSize / 10
+
+	// lagReportInterval is the interval at which the replication lag
+	// is recorded, whether or not messages come through the stream
+	lagReportInterval = 10 * time.Second
 )
 
 func newOutConnection(extUUID string, stream storeStream.BStoreOpenReadStreamOutCall, logger bark.Logger, m3Client metrics.Client, metricsTag int) *outConnection {
@@ -66,6 +73,7 @@ func newOutConnection(extUUID string, stream storeStream.BStoreOpenReadStreamOut
 		logger:              logger.WithField(common.TagExt, extUUID).WithField(`scope`, "outConnection"),
 		m3Client:            m3Client,
 		metricsTag:          metricsTag,
+		lag:                 common.NewReplicationLagEstimator(-1),
 		readMsgCountChannel: make(chan int32, 10),
 		closeChannel:        make(chan struct{}),
 	}
@@ -110,6 +118,9 @@ func (conn *outConnection) writeCreditsStream() {
 
 	var numMsgsRead int32
 
+	lagTicker := time.NewTicker(lagReportInterval)
+	defer lagTicker.Stop()
+
 	for {
 		if numMsgsRead > 0 {
 			if err := conn.sendCredits(numMsgsRead); err != nil {
@@ -121,9 +132,11 @@ func (conn *outConnection) writeCreditsStream() {
 			numMsgsRead = 0
 		} else {
 			select {
-			// Note: this will block until readMsgStream sends msg count to the channel, or the connection is closed
+			// Note: this will block until readMsgStream sends msg count to the channel, the lag is due, or the connection is closed
 			case msgsRead := <-conn.readMsgCountChannel:
 				numMsgsRead += msgsRead
+			case <-lagTicker.C:
+				conn.recordLag()
 			case <-conn.closeChannel:
 				return
 			}
@@ -188,9 +201,21 @@ func (conn *outConnection) readMsgStream() {
 
 				// update the lastSeqNum to this value
 				lastSeqNum = msg.Message.GetSequenceNumber()
+				conn.lag.Observe(lastSeqNum, msg.Message.GetEnqueueTimeUtc(), time.Now().UnixNano())
 
 				conn.m3Client.IncCounter(conn.metricsTag, metrics.ReplicatorOutConnMsgRead)
 
+				if conn.throttle != nil {
+					waited, ok := conn.throttle.wait(int64(len(msg.Message.GetPayload().GetData())), conn.closeChannel)
+					if !ok {
+						conn.logger.Info(`throttling msg interrupted because of shutdown`)
+						return
+					}
+					if waited > 0 {
+						conn.m3Client.RecordTimer(conn.metricsTag, metrics.ReplicatorOutConnThrottleLatency, waited)
+					}
+				}
+
 				// now push msg to the msg channel (which will in turn be pushed to client)
 				// Note this is a blocking call here
 				select {
@@ -229,6 +254,13 @@ func (conn *outConnection) readMsgStream() {
 	}
 }
 
+// recordLag records how far behind its source the replication stream is
+func (conn *outConnection) recordLag() {
+	if lag, ok := conn.lag.Lag(time.Now().UnixNano()); ok {
+		conn.m3Client.RecordTimer(conn.metricsTag, metrics.ReplicatorOutConnReplicationLag, time.Duration(lag.Seconds)*time.Second)
+	}
+}
+
 func (conn *outConnection) sendCredits(credits int32) error {
 	cFlow := cherami.NewControlFlow()
 	cFlow.Credits = common.Int32Ptr(credits)
@@ -34,6 +34,7 @@ import (
 	"github.com/uber/tchannel-go/thrift"
 
 	ccommon "github.com/uber/cherami-client-go/common"
+	mcli "github.com/uber/cherami-server/clients/metadata"
 	"github.com/uber/cherami-server/common"
 	"github.com/uber/cherami-server/common/configure"
 	dconfig "github.com/uber/cherami-server/common/dconfigclient"
@@ -55,6 +56,7 @@ type (
 		AppConfig                 configure.CommonAppConfig
 		uconfigClient             dconfig.Client
 		metaClient                metadata.TChanMetadataService
+		versions                  mcli.MultiZoneService
 		allZones                  map[string][]string
 		localZone                 string
 		authoritativeZone         string
@@ -65,8 +67,10 @@ type (
 		remoteReplicatorConnMutex sync.RWMutex
 		storehostConn             map[string]*outConnection
 		storehostConnMutex        sync.RWMutex
+		throttle                  *replicationThrottle
 
 		metadataReconciler MetadataReconciler
+		ackLevelShipper    AckLevelShipper
 	}
 )
 
@@ -125,7 +129,12 @@ func NewReplicator(serviceName string, sVice common.SCommon, metadataClient meta
 		remoteReplicatorConn:     make(map[string]*outConnection),
 		storehostConn:            make(map[string]*outConnection),
 	}
+	r.throttle = newReplicationThrottle(r.logger)
+	r.throttle.numHosts = r.numReplicatorHosts
 
+	// the versions of multi-zone entities are not part of the thrift
+	// metadata API; without them, updates from remote zones always apply
+	r.versions, _ = metadataClient.(mcli.MultiZoneService)
 	r.metaClient = mm.NewMetadataMetricsMgr(metadataClient, r.m3Client, r.logger)
 
 	r.uconfigClient = sVice.GetDConfigClient()
@@ -143,6 +152,9 @@ func (r *Replicator) Start(thriftService []thrift.TChanServer) {
 
 	r.metadataReconciler = NewMetadataReconciler(r.metaClient, r, r.localZone, r.logger, r.m3Client)
 	r.metadataReconciler.Start()
+
+	r.ackLevelShipper = NewAckLevelShipper(r.metaClient, r, r.localZone, r.AppConfig.GetReplicatorConfig().GetAckLevelShipInterval(), r.logger, r.m3Client)
+	r.ackLevelShipper.Start()
 }
 
 // Stop stops the service
@@ -155,6 +167,7 @@ func (r *Replicator) Stop() {
 		conn.close()
 	}
 	r.metadataReconciler.Stop()
+	r.ackLevelShipper.Stop()
 	r.SCommon.Stop()
 
 }
@@ -164,6 +177,8 @@ func (r *Replicator) RegisterWSHandler() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc(fmt.Sprintf(ccommon.HTTPHandlerPattern, ccommon.EndpointOpenReplicationRemoteReadStream), r.OpenReplicationRemoteReadStreamHandler)
 	mux.HandleFunc(fmt.Sprintf(ccommon.HTTPHandlerPattern, ccommon.EndpointOpenReplicationReadStream), r.OpenReplicationReadStreamHandler)
+	mux.HandleFunc(httpPathAckLevels, r.AckLevelsHandler)
+	mux.HandleFunc(httpPathConsumerGroups, r.ConsumerGroupsHandler)
 	return mux
 }
 
@@ -265,7 +280,7 @@ func (r *Replicator) OpenReplicationRemoteReadStreamHandler(w http.ResponseWrite
 	destUUID := request.GetDestinationUUID()
 
 	// get the websocket stream to a remote replicator
-	outStream, err := r.createRemoteReplicationReadStream(extUUID, destUUID, request)
+	outStream, throttle, err := r.createRemoteReplicationReadStream(extUUID, destUUID, request)
 	if err != nil {
 		r.logger.WithFields(bark.Fields{
 			common.TagErr: err,
@@ -277,6 +292,7 @@ func (r *Replicator) OpenReplicationRemoteReadStreamHandler(w http.ResponseWrite
 		return
 	}
 	outConn := newOutConnection(extUUID, outStream, r.logger, r.m3Client, metrics.OpenReplicationRemoteReadScope)
+	outConn.throttle = throttle
 	outConn.open()
 	r.addRemoteReplicatorConn(extUUID, outConn)
 
@@ -293,17 +309,30 @@ func (r *Replicator) OpenReplicationRemoteReadStreamHandler(w http.ResponseWrite
 func (r *Replicator) CreateDestinationUUID(ctx thrift.Context, createRequest *shared.CreateDestinationUUIDRequest) (*shared.DestinationDescription, error) {
 	r.m3Client.IncCounter(metrics.ReplicatorCreateDestUUIDScope, metrics.ReplicatorRequests)
 
+	lclLg := r.logger.WithFields(bark.Fields{
+		common.TagDst:    common.FmtDst(createRequest.GetDestinationUUID()),
+		common.TagDstPth: common.FmtDstPth(createRequest.GetRequest().GetPath()),
+	})
+
+	version, err := versionFromContext(ctx)
+	if err != nil {
+		r.m3Client.IncCounter(metrics.ReplicatorCreateDestUUIDScope, metrics.ReplicatorBadRequest)
+		r.m3Client.IncCounter(metrics.ReplicatorCreateDestUUIDScope, metrics.ReplicatorFailures)
+		lclLg.WithField(common.TagErr, err).Error(`Create destination request has a malformed version`)
+		return nil, &shared.BadRequestError{Message: err.Error()}
+	}
+
 	destDesc, err := r.metaClient.CreateDestinationUUID(ctx, createRequest)
 	if err != nil {
-		r.logger.WithFields(bark.Fields{
-			common.TagDst:    common.FmtDst(createRequest.GetDestinationUUID()),
-			common.TagDstPth: common.FmtDstPth(createRequest.GetRequest().GetPath()),
-			common.TagErr:    err,
-		}).Error(`Error creating destination`)
+		lclLg.WithField(common.TagErr, err).Error(`Error creating destination`)
 		r.m3Client.IncCounter(metrics.ReplicatorCreateDestUUIDScope, metrics.ReplicatorFailures)
 		return nil, err
 	}
 
+	if err = r.appliedRemoteVersion(destDesc.GetDestinationUUID(), version); err != nil {
+		lclLg.WithField(common.TagErr, err).Warn(`Failed to record the version of created destination`)
+	}
+
 	r.logger.WithFields(bark.Fields{
 		common.TagDst:                 common.FmtDst(destDesc.GetDestinationUUID()),
 		common.TagDstPth:              common.FmtDstPth(destDesc.GetPath()),
@@ -350,6 +379,12 @@ func (r *Replicator) CreateRemoteDestinationUUID(ctx thrift.Context, createReque
 		return err
 	}
 
+	// an unversioned creation still reaches the remote zones, it only loses to any versioned update
+	version, err := r.newUpdateVersion(createRequest.GetDestinationUUID())
+	if err != nil {
+		lclLg.WithField(common.TagErr, err).Warn(`Failed to version destination creation`)
+	}
+
 	// for all the zones of current tenancy
 	for _, zone := range r.allZones[r.tenancy] {
 		// skip local zone
@@ -358,13 +393,13 @@ func (r *Replicator) CreateRemoteDestinationUUID(ctx thrift.Context, createReque
 		}
 
 		// call remote replicators in a goroutine. Errors can be ignored since reconciliation will fix the inconsistency eventually
-		go r.createDestinationRemoteCall(zone, lclLg, createRequest)
+		go r.createDestinationRemoteCall(zone, lclLg, createRequest, version)
 	}
 
 	return nil
 }
 
-func (r *Replicator) createDestinationRemoteCall(zone string, logger bark.Logger, createRequest *shared.CreateDestinationUUIDRequest) error {
+func (r *Replicator) createDestinationRemoteCall(zone string, logger bark.Logger, createRequest *shared.CreateDestinationUUIDRequest, version *entityVersion) error {
 	// acquire remote zone replicator thrift client
 	client, err := r.clientFactory.GetReplicatorClient(zone)
 	if err != nil {
@@ -379,7 +414,7 @@ func (r *Replicator) createDestinationRemoteCall(zone string, logger bark.Logger
 	// send to remote zone replicator
 	ctx, cancel := thrift.NewContext(remoteReplicatorCallTimeOut)
 	defer cancel()
-	_, err = client.CreateDestinationUUID(ctx, createRequest)
+	_, err = client.CreateDestinationUUID(withVersion(ctx, version), createRequest)
 	if err != nil {
 		r.m3Client.IncCounter(metrics.ReplicatorCreateRmtDestUUIDScope, metrics.ReplicatorFailures)
 		logger.WithFields(bark.Fields{
@@ -396,16 +431,43 @@ func (r *Replicator) createDestinationRemoteCall(zone string, logger bark.Logger
 func (r *Replicator) UpdateDestination(ctx thrift.Context, updateRequest *shared.UpdateDestinationRequest) (*shared.DestinationDescription, error) {
 	r.m3Client.IncCounter(metrics.ReplicatorUpdateDestScope, metrics.ReplicatorRequests)
 
+	lclLg := r.logger.WithField(common.TagDst, common.FmtDst(updateRequest.GetDestinationUUID()))
+
+	version, err := versionFromContext(ctx)
+	if err != nil {
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateDestScope, metrics.ReplicatorBadRequest)
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateDestScope, metrics.ReplicatorFailures)
+		lclLg.WithField(common.TagErr, err).Error(`Update destination request has a malformed version`)
+		return nil, &shared.BadRequestError{Message: err.Error()}
+	}
+
+	apply, err := r.acceptRemoteVersion(updateRequest.GetDestinationUUID(), version)
+	if err != nil {
+		lclLg.WithField(common.TagErr, err).Error(`Error resolving the version of destination update`)
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateDestScope, metrics.ReplicatorFailures)
+		return nil, err
+	}
+
+	if !apply {
+		// the local state already includes, or won against, this update
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateDestScope, metrics.ReplicatorStaleUpdate)
+		lclLg.WithField(`Version`, version.String()).Info(`Skipped stale destination update`)
+		return r.metaClient.ReadDestination(ctx, &metadata.ReadDestinationRequest{
+			DestinationUUID: common.StringPtr(updateRequest.GetDestinationUUID()),
+		})
+	}
+
 	destDesc, err := r.metaClient.UpdateDestination(ctx, updateRequest)
 	if err != nil {
-		r.logger.WithFields(bark.Fields{
-			common.TagDst: common.FmtDst(updateRequest.GetDestinationUUID()),
-			common.TagErr: err,
-		}).Error(`Error updating destination`)
+		lclLg.WithField(common.TagErr, err).Error(`Error updating destination`)
 		r.m3Client.IncCounter(metrics.ReplicatorUpdateDestScope, metrics.ReplicatorFailures)
 		return nil, err
 	}
 
+	if err = r.appliedRemoteVersion(updateRequest.GetDestinationUUID(), version); err != nil {
+		lclLg.WithField(common.TagErr, err).Warn(`Failed to record the version of destination update`)
+	}
+
 	r.logger.WithFields(bark.Fields{
 		common.TagDst:                 common.FmtDst(updateRequest.GetDestinationUUID()),
 		`Type`:                        destDesc.GetType(),
@@ -442,6 +504,11 @@ func (r *Replicator) UpdateRemoteDestination(ctx thrift.Context, updateRequest *
 		return err
 	}
 
+	version, err := r.newUpdateVersion(updateRequest.GetDestinationUUID())
+	if err != nil {
+		lclLg.WithField(common.TagErr, err).Warn(`Failed to version destination update`)
+	}
+
 	// for all the zones of current tenancy
 	for _, zone := range r.allZones[r.tenancy] {
 		// skip local zone
@@ -450,13 +517,13 @@ func (r *Replicator) UpdateRemoteDestination(ctx thrift.Context, updateRequest *
 		}
 
 		// call remote replicators in a goroutine. Errors can be ignored since reconciliation will fix the inconsistency eventually
-		go r.updateDestinationRemoteCall(zone, lclLg, updateRequest)
+		go r.updateDestinationRemoteCall(zone, lclLg, updateRequest, version)
 	}
 
 	return nil
 }
 
-func (r *Replicator) updateDestinationRemoteCall(zone string, logger bark.Logger, updateRequest *shared.UpdateDestinationRequest) error {
+func (r *Replicator) updateDestinationRemoteCall(zone string, logger bark.Logger, updateRequest *shared.UpdateDestinationRequest, version *entityVersion) error {
 	// acquire remote zone replicator thrift client
 	client, err := r.clientFactory.GetReplicatorClient(zone)
 	if err != nil {
@@ -471,7 +538,7 @@ func (r *Replicator) updateDestinationRemoteCall(zone string, logger bark.Logger
 	// send to remote zone replicator
 	ctx, cancel := thrift.NewContext(remoteReplicatorCallTimeOut)
 	defer cancel()
-	_, err = client.UpdateDestination(ctx, updateRequest)
+	_, err = client.UpdateDestination(withVersion(ctx, version), updateRequest)
 	if err != nil {
 		r.m3Client.IncCounter(metrics.ReplicatorUpdateRmtDestScope, metrics.ReplicatorFailures)
 		logger.WithFields(bark.Fields{
@@ -484,7 +551,8 @@ func (r *Replicator) updateDestinationRemoteCall(zone string, logger bark.Logger
 	return nil
 }
 
-// DeleteDestination deletes destination at local zone, expect to be called by remote replicator
+// DeleteDestination deletes destination at local zone, expect to be called by remote replicator.
+// Deletions are not versioned: a deleted destination cannot come back, so they win over any concurrent update.
 func (r *Replicator) DeleteDestination(ctx thrift.Context, deleteRequest *shared.DeleteDestinationRequest) error {
 	r.m3Client.IncCounter(metrics.ReplicatorDeleteDestScope, metrics.ReplicatorRequests)
 
@@ -568,31 +636,369 @@ func (r *Replicator) deleteDestinationRemoteCall(zone string, logger bark.Logger
 
 // CreateConsumerGroupUUID creates consumer group at local zone, expect to be called by remote replicator
 func (r *Replicator) CreateConsumerGroupUUID(ctx thrift.Context, createRequest *shared.CreateConsumerGroupUUIDRequest) (*shared.ConsumerGroupDescription, error) {
-	return nil, nil
+	r.m3Client.IncCounter(metrics.ReplicatorCreateCgUUIDScope, metrics.ReplicatorRequests)
+
+	lclLg := r.logger.WithFields(bark.Fields{
+		common.TagCnsm:   common.FmtCnsm(createRequest.GetConsumerGroupUUID()),
+		common.TagDstPth: common.FmtDstPth(createRequest.GetRequest().GetDestinationPath()),
+		common.TagCnsPth: common.FmtCnsPth(createRequest.GetRequest().GetConsumerGroupName()),
+	})
+
+	if r.versions == nil {
+		r.m3Client.IncCounter(metrics.ReplicatorCreateCgUUIDScope, metrics.ReplicatorFailures)
+		err := &shared.InternalServiceError{Message: `Metadata cannot create consumer groups by uuid`}
+		lclLg.WithField(common.TagErr, err).Error(`Error creating consumer group`)
+		return nil, err
+	}
+
+	version, err := versionFromContext(ctx)
+	if err != nil {
+		r.m3Client.IncCounter(metrics.ReplicatorCreateCgUUIDScope, metrics.ReplicatorBadRequest)
+		r.m3Client.IncCounter(metrics.ReplicatorCreateCgUUIDScope, metrics.ReplicatorFailures)
+		lclLg.WithField(common.TagErr, err).Error(`Create consumer group request has a malformed version`)
+		return nil, &shared.BadRequestError{Message: err.Error()}
+	}
+
+	// creating a consumer group that exists would remove it when the
+	// insert by name fails, so repeated creations stop here
+	_, err = r.metaClient.ReadConsumerGroupByUUID(ctx, &metadata.ReadConsumerGroupRequest{
+		ConsumerGroupUUID: common.StringPtr(createRequest.GetConsumerGroupUUID()),
+	})
+	if err == nil {
+		return nil, &shared.EntityAlreadyExistsError{
+			Message: fmt.Sprintf(`Consumer group %v already exists`, createRequest.GetConsumerGroupUUID()),
+		}
+	}
+	if _, ok := err.(*shared.EntityNotExistsError); !ok {
+		lclLg.WithField(common.TagErr, err).Error(`Error reading consumer group`)
+		r.m3Client.IncCounter(metrics.ReplicatorCreateCgUUIDScope, metrics.ReplicatorFailures)
+		return nil, err
+	}
+
+	cgDesc, err := r.versions.CreateConsumerGroupUUID(ctx, createRequest)
+	if err != nil {
+		lclLg.WithField(common.TagErr, err).Error(`Error creating consumer group`)
+		r.m3Client.IncCounter(metrics.ReplicatorCreateCgUUIDScope, metrics.ReplicatorFailures)
+		return nil, err
+	}
+
+	if err = r.appliedRemoteVersion(cgDesc.GetConsumerGroupUUID(), version); err != nil {
+		lclLg.WithField(common.TagErr, err).Warn(`Failed to record the version of created consumer group`)
+	}
+
+	lclLg.WithFields(bark.Fields{
+		common.TagDst: common.FmtDst(cgDesc.GetDestinationUUID()),
+		`OwnerEmail`:  cgDesc.GetOwnerEmail(),
+		`IsMultiZone`: cgDesc.GetIsMultiZone(), // expected to be true
+	}).Info(`Created consumer group`)
+
+	return cgDesc, nil
 }
 
 // CreateRemoteConsumerGroupUUID propagate creation to multiple remote zones, expect to be called by local zone services
 func (r *Replicator) CreateRemoteConsumerGroupUUID(ctx thrift.Context, createRequest *shared.CreateConsumerGroupUUIDRequest) error {
+	r.m3Client.IncCounter(metrics.ReplicatorCreateRmtCgUUIDScope, metrics.ReplicatorRequests)
+
+	if createRequest == nil || !createRequest.IsSetRequest() || !createRequest.IsSetConsumerGroupUUID() {
+		r.m3Client.IncCounter(metrics.ReplicatorCreateRmtCgUUIDScope, metrics.ReplicatorFailures)
+		err := &shared.BadRequestError{Message: `Create remote consumer group request has nil request or nil uuid`}
+		r.logger.WithField(common.TagErr, err).Error(`Create remote consumer group request verification failed`)
+		return err
+	}
+
+	lclLg := r.logger.WithFields(bark.Fields{
+		common.TagCnsm:   common.FmtCnsm(createRequest.GetConsumerGroupUUID()),
+		common.TagDstPth: common.FmtDstPth(createRequest.GetRequest().GetDestinationPath()),
+		common.TagCnsPth: common.FmtCnsPth(createRequest.GetRequest().GetConsumerGroupName()),
+	})
+
+	if !createRequest.GetRequest().GetIsMultiZone() {
+		r.m3Client.IncCounter(metrics.ReplicatorCreateRmtCgUUIDScope, metrics.ReplicatorFailures)
+		err := &shared.BadRequestError{Message: `Not a valid create remote consumer group request for IsMultiZone [false]`}
+		lclLg.WithField(common.TagErr, err).Error(`Create remote consumer group request verification failed`)
+		return err
+	}
+
+	// in case no zone configured for current tenancy
+	if _, ok := r.allZones[r.tenancy]; !ok {
+		r.m3Client.IncCounter(metrics.ReplicatorCreateRmtCgUUIDScope, metrics.ReplicatorFailures)
+		err := &shared.BadRequestError{Message: fmt.Sprintf(`Unknown tenancy [%s]`, r.tenancy)}
+		lclLg.WithField(common.TagErr, err).Error(`Create remote consumer group failed with unknown tenancy`)
+		return err
+	}
+
+	version, err := r.newUpdateVersion(createRequest.GetConsumerGroupUUID())
+	if err != nil {
+		lclLg.WithField(common.TagErr, err).Warn(`Failed to version consumer group creation`)
+	}
+
+	// for all the zones of current tenancy
+	for _, zone := range r.allZones[r.tenancy] {
+		// skip local zone
+		if strings.EqualFold(zone, r.localZone) {
+			continue
+		}
+
+		// call remote replicators in a goroutine. Errors can be ignored since reconciliation will fix the inconsistency eventually
+		go r.createConsumerGroupRemoteCall(zone, lclLg, createRequest, version)
+	}
+
+	return nil
+}
+
+func (r *Replicator) createConsumerGroupRemoteCall(zone string, logger bark.Logger, createRequest *shared.CreateConsumerGroupUUIDRequest, version *entityVersion) error {
+	// acquire remote zone replicator thrift client
+	client, err := r.clientFactory.GetReplicatorClient(zone)
+	if err != nil {
+		r.m3Client.IncCounter(metrics.ReplicatorCreateRmtCgUUIDScope, metrics.ReplicatorFailures)
+		logger.WithFields(bark.Fields{
+			common.TagErr:      err,
+			common.TagZoneName: common.FmtZoneName(zone),
+		}).Error(`Get remote replicator client failed`)
+		return err
+	}
+
+	// send to remote zone replicator
+	ctx, cancel := thrift.NewContext(remoteReplicatorCallTimeOut)
+	defer cancel()
+	_, err = client.CreateConsumerGroupUUID(withVersion(ctx, version), createRequest)
+	if err != nil {
+		r.m3Client.IncCounter(metrics.ReplicatorCreateRmtCgUUIDScope, metrics.ReplicatorFailures)
+		logger.WithFields(bark.Fields{
+			common.TagErr:      err,
+			common.TagZoneName: common.FmtZoneName(zone),
+		}).Error(`Create remote consumer group call failed`)
+		return err
+	}
+
 	return nil
 }
 
 // UpdateConsumerGroup updates consumer group at local zone, expect to be called by remote replicator
 func (r *Replicator) UpdateConsumerGroup(ctx thrift.Context, updateRequest *shared.UpdateConsumerGroupRequest) (*shared.ConsumerGroupDescription, error) {
-	return nil, nil
+	r.m3Client.IncCounter(metrics.ReplicatorUpdateCgScope, metrics.ReplicatorRequests)
+
+	lclLg := r.logger.WithFields(bark.Fields{
+		common.TagDstPth: common.FmtDstPth(updateRequest.GetDestinationPath()),
+		common.TagCnsPth: common.FmtCnsPth(updateRequest.GetConsumerGroupName()),
+	})
+
+	version, err := versionFromContext(ctx)
+	if err != nil {
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateCgScope, metrics.ReplicatorBadRequest)
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateCgScope, metrics.ReplicatorFailures)
+		lclLg.WithField(common.TagErr, err).Error(`Update consumer group request has a malformed version`)
+		return nil, &shared.BadRequestError{Message: err.Error()}
+	}
+
+	// the version is kept by uuid, the request only has the path and name
+	cgDesc, err := r.metaClient.ReadConsumerGroup(ctx, &metadata.ReadConsumerGroupRequest{
+		DestinationPath:   common.StringPtr(updateRequest.GetDestinationPath()),
+		ConsumerGroupName: common.StringPtr(updateRequest.GetConsumerGroupName()),
+	})
+	if err != nil {
+		lclLg.WithField(common.TagErr, err).Error(`Error reading consumer group`)
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateCgScope, metrics.ReplicatorFailures)
+		return nil, err
+	}
+
+	lclLg = lclLg.WithField(common.TagCnsm, common.FmtCnsm(cgDesc.GetConsumerGroupUUID()))
+
+	apply, err := r.acceptRemoteVersion(cgDesc.GetConsumerGroupUUID(), version)
+	if err != nil {
+		lclLg.WithField(common.TagErr, err).Error(`Error resolving the version of consumer group update`)
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateCgScope, metrics.ReplicatorFailures)
+		return nil, err
+	}
+
+	if !apply {
+		// the local state already includes, or won against, this update
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateCgScope, metrics.ReplicatorStaleUpdate)
+		lclLg.WithField(`Version`, version.String()).Info(`Skipped stale consumer group update`)
+		return cgDesc, nil
+	}
+
+	cgDesc, err = r.metaClient.UpdateConsumerGroup(ctx, updateRequest)
+	if err != nil {
+		lclLg.WithField(common.TagErr, err).Error(`Error updating consumer group`)
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateCgScope, metrics.ReplicatorFailures)
+		return nil, err
+	}
+
+	if err = r.appliedRemoteVersion(cgDesc.GetConsumerGroupUUID(), version); err != nil {
+		lclLg.WithField(common.TagErr, err).Warn(`Failed to record the version of consumer group update`)
+	}
+
+	lclLg.WithFields(bark.Fields{
+		`Status`:                   cgDesc.GetStatus(),
+		`LockTimeoutSeconds`:       cgDesc.GetLockTimeoutSeconds(),
+		`MaxDeliveryCount`:         cgDesc.GetMaxDeliveryCount(),
+		`SkipOlderMessagesSeconds`: cgDesc.GetSkipOlderMessagesSeconds(),
+		`OwnerEmail`:               cgDesc.GetOwnerEmail(),
+	}).Info(`Updated consumer group`)
+	return cgDesc, nil
 }
 
 // UpdateRemoteConsumerGroup propagate update to multiple remote zones, expect to be called by local zone services
 func (r *Replicator) UpdateRemoteConsumerGroup(ctx thrift.Context, updateRequest *shared.UpdateConsumerGroupRequest) error {
+	r.m3Client.IncCounter(metrics.ReplicatorUpdateRmtCgScope, metrics.ReplicatorRequests)
+
+	if updateRequest == nil {
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateRmtCgScope, metrics.ReplicatorFailures)
+		err := &shared.BadRequestError{Message: `Update remote consumer group request has nil request`}
+		r.logger.WithField(common.TagErr, err).Error(`Update remote consumer group request verification failed`)
+		return err
+	}
+
+	lclLg := r.logger.WithFields(bark.Fields{
+		common.TagDstPth: common.FmtDstPth(updateRequest.GetDestinationPath()),
+		common.TagCnsPth: common.FmtCnsPth(updateRequest.GetConsumerGroupName()),
+	})
+
+	// in case no zone configured for current tenancy
+	if _, ok := r.allZones[r.tenancy]; !ok {
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateRmtCgScope, metrics.ReplicatorFailures)
+		err := &shared.BadRequestError{Message: fmt.Sprintf(`Unknown tenancy [%s]`, r.tenancy)}
+		lclLg.WithField(common.TagErr, err).Error(`Update remote consumer group failed with unknown tenancy`)
+		return err
+	}
+
+	var version *entityVersion
+	cgDesc, err := r.metaClient.ReadConsumerGroup(ctx, &metadata.ReadConsumerGroupRequest{
+		DestinationPath:   common.StringPtr(updateRequest.GetDestinationPath()),
+		ConsumerGroupName: common.StringPtr(updateRequest.GetConsumerGroupName()),
+	})
+	if err == nil {
+		version, err = r.newUpdateVersion(cgDesc.GetConsumerGroupUUID())
+	}
+	if err != nil {
+		lclLg.WithField(common.TagErr, err).Warn(`Failed to version consumer group update`)
+	}
+
+	// for all the zones of current tenancy
+	for _, zone := range r.allZones[r.tenancy] {
+		// skip local zone
+		if strings.EqualFold(zone, r.localZone) {
+			continue
+		}
+
+		// call remote replicators in a goroutine. Errors can be ignored since reconciliation will fix the inconsistency eventually
+		go r.updateConsumerGroupRemoteCall(zone, lclLg, updateRequest, version)
+	}
+
+	return nil
+}
+
+func (r *Replicator) updateConsumerGroupRemoteCall(zone string, logger bark.Logger, updateRequest *shared.UpdateConsumerGroupRequest, version *entityVersion) error {
+	// acquire remote zone replicator thrift client
+	client, err := r.clientFactory.GetReplicatorClient(zone)
+	if err != nil {
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateRmtCgScope, metrics.ReplicatorFailures)
+		logger.WithFields(bark.Fields{
+			common.TagErr:      err,
+			common.TagZoneName: common.FmtZoneName(zone),
+		}).Error(`Get remote replicator client failed`)
+		return err
+	}
+
+	// send to remote zone replicator
+	ctx, cancel := thrift.NewContext(remoteReplicatorCallTimeOut)
+	defer cancel()
+	_, err = client.UpdateConsumerGroup(withVersion(ctx, version), updateRequest)
+	if err != nil {
+		r.m3Client.IncCounter(metrics.ReplicatorUpdateRmtCgScope, metrics.ReplicatorFailures)
+		logger.WithFields(bark.Fields{
+			common.TagErr:      err,
+			common.TagZoneName: common.FmtZoneName(zone),
+		}).Error(`Update remote consumer group call failed`)
+		return err
+	}
+
 	return nil
 }
 
-// DeleteConsumerGroup deletes consumer group at local zone, expect to be called by remote replicator
+// DeleteConsumerGroup deletes consumer group at local zone, expect to be called by remote replicator.
+// Like for destinations, deletions are not versioned, they win over any concurrent update.
 func (r *Replicator) DeleteConsumerGroup(ctx thrift.Context, deleteRequest *shared.DeleteConsumerGroupRequest) error {
+	r.m3Client.IncCounter(metrics.ReplicatorDeleteCgScope, metrics.ReplicatorRequests)
+
+	err := r.metaClient.DeleteConsumerGroup(ctx, deleteRequest)
+	if err != nil {
+		r.logger.WithFields(bark.Fields{
+			common.TagDstPth: common.FmtDstPth(deleteRequest.GetDestinationPath()),
+			common.TagCnsPth: common.FmtCnsPth(deleteRequest.GetConsumerGroupName()),
+			common.TagErr:    err,
+		}).Error(`Error deleting consumer group`)
+		r.m3Client.IncCounter(metrics.ReplicatorDeleteCgScope, metrics.ReplicatorFailures)
+		return err
+	}
+
 	return nil
 }
 
 // DeleteRemoteConsumerGroup propagate deletion to multiple remote zones, expect to be called by local zone services
 func (r *Replicator) DeleteRemoteConsumerGroup(ctx thrift.Context, deleteRequest *shared.DeleteConsumerGroupRequest) error {
+	r.m3Client.IncCounter(metrics.ReplicatorDeleteRmtCgScope, metrics.ReplicatorRequests)
+
+	if deleteRequest == nil {
+		r.m3Client.IncCounter(metrics.ReplicatorDeleteRmtCgScope, metrics.ReplicatorFailures)
+		err := &shared.BadRequestError{Message: `Delete remote consumer group request has nil request`}
+		r.logger.WithField(common.TagErr, err).Error(`Delete remote consumer group request verification failed`)
+		return err
+	}
+
+	lclLg := r.logger.WithFields(bark.Fields{
+		common.TagDstPth: common.FmtDstPth(deleteRequest.GetDestinationPath()),
+		common.TagCnsPth: common.FmtCnsPth(deleteRequest.GetConsumerGroupName()),
+	})
+
+	// in case no zone configured for current tenancy
+	if _, ok := r.allZones[r.tenancy]; !ok {
+		r.m3Client.IncCounter(metrics.ReplicatorDeleteRmtCgScope, metrics.ReplicatorFailures)
+		err := &shared.BadRequestError{Message: fmt.Sprintf(`Unknown tenancy [%s]`, r.tenancy)}
+		lclLg.WithField(common.TagErr, err).Error(`Delete remote consumer group failed with unknown tenancy`)
+		return err
+	}
+
+	// for all the zones of current tenancy
+	for _, zone := range r.allZones[r.tenancy] {
+		// skip local zone
+		if strings.EqualFold(zone, r.localZone) {
+			continue
+		}
+
+		// call remote replicators in a goroutine. Errors can be ignored since reconciliation will fix the inconsistency eventually
+		go r.deleteConsumerGroupRemoteCall(zone, lclLg, deleteRequest)
+	}
+
+	return nil
+}
+
+func (r *Replicator) deleteConsumerGroupRemoteCall(zone string, logger bark.Logger, deleteRequest *shared.DeleteConsumerGroupRequest) error {
+	// acquire remote zone replicator thrift client
+	client, err := r.clientFactory.GetReplicatorClient(zone)
+	if err != nil {
+		r.m3Client.IncCounter(metrics.ReplicatorDeleteRmtCgScope, metrics.ReplicatorFailures)
+		logger.WithFields(bark.Fields{
+			common.TagErr:      err,
+			common.TagZoneName: common.FmtZoneName(zone),
+		}).Error(`Get remote replicator client failed`)
+		return err
+	}
+
+	// send to remote zone replicator
+	ctx, cancel := thrift.NewContext(remoteReplicatorCallTimeOut)
+	defer cancel()
+	err = client.DeleteConsumerGroup(ctx, deleteRequest)
+	if err != nil {
+		r.m3Client.IncCounter(metrics.ReplicatorDeleteRmtCgScope, metrics.ReplicatorFailures)
+		logger.WithFields(bark.Fields{
+			common.TagErr:      err,
+			common.TagZoneName: common.FmtZoneName(zone),
+		}).Error(`Delete remote consumer group call failed`)
+		return err
+	}
+
 	return nil
 }
 
@@ -688,9 +1094,31 @@ func (r *Replicator) ListDestinations(ctx thrift.Context, listRequest *shared.Li
 	return r.metaClient.ListDestinations(ctx, listRequest)
 }
 
-// ListDestinationsByUUID returns a list of destinations by UUID
+// ListDestinationsByUUID returns a list of destinations by UUID. The versions of the
+// destinations are returned in the response headers, for reconciliation in remote zones.
 func (r *Replicator) ListDestinationsByUUID(ctx thrift.Context, listRequest *shared.ListDestinationsByUUIDRequest) (*shared.ListDestinationsResult_, error) {
-	return r.metaClient.ListDestinationsByUUID(ctx, listRequest)
+	res, err := r.metaClient.ListDestinationsByUUID(ctx, listRequest)
+	if err != nil || ctx == nil || r.versions == nil {
+		return res, err
+	}
+
+	headers := make(map[string]string)
+	for _, dest := range res.GetDestinations() {
+		version, errVer := r.readEntityVersion(dest.GetDestinationUUID())
+		if errVer != nil {
+			r.logger.WithFields(bark.Fields{
+				common.TagErr: errVer,
+				common.TagDst: common.FmtDst(dest.GetDestinationUUID()),
+			}).Warn(`Failed to read destination version`)
+			continue
+		}
+		if version != nil {
+			headers[versionHeaderPrefix+dest.GetDestinationUUID()] = version.String()
+		}
+	}
+	ctx.SetResponseHeaders(headers)
+
+	return res, nil
 }
 
 // ListExtentsStats returns a list of extents
@@ -740,7 +1168,7 @@ func (r *Replicator) addStoreHostConn(extUUID string, conn *outConnection) {
 	r.storehostConn[extUUID] = conn
 }
 
-func (r *Replicator) createRemoteReplicationReadStream(extUUID string, destUUID string, request *common.OpenReplicationRemoteReadStreamRequest) (stream storeStream.BStoreOpenReadStreamOutCall, err error) {
+func (r *Replicator) createRemoteReplicationReadStream(extUUID string, destUUID string, request *common.OpenReplicationRemoteReadStreamRequest) (stream storeStream.BStoreOpenReadStreamOutCall, throttle *streamThrottle, err error) {
 	readExtentStats := &metadata.ReadExtentStatsRequest{
 		DestinationUUID: common.StringPtr(destUUID),
 		ExtentUUID:      common.StringPtr(extUUID)}
@@ -755,23 +1183,24 @@ func (r *Replicator) createRemoteReplicationReadStream(extUUID string, destUUID
 	}
 
 	remoteZone := extentStatsResult.GetExtentStats().GetExtent().GetOriginZone()
-	remoteDeployment := fmt.Sprintf("%v_%v", r.tenancy, remoteZone)
-	if _, inCfg := r.AppConfig.GetReplicatorConfig().GetReplicatorHosts()[remoteDeployment]; !inCfg {
-		err = &shared.BadRequestError{Message: fmt.Sprintf("Deployment [%v] is not configured", remoteDeployment)}
-		r.logger.WithFields(bark.Fields{common.TagErr: err, common.TagDeploymentName: remoteDeployment}).Error("Deployment is not configured")
+	hostPort, err := r.getRemoteReplicatorWSHostPort(remoteZone)
+	if err != nil {
 		return
 	}
 
-	hosts := strings.Split(r.AppConfig.GetReplicatorConfig().GetReplicatorHosts()[remoteDeployment], ",")
-	if len(hosts) < 1 {
-		err = &shared.BadRequestError{Message: fmt.Sprintf("Deployment [%v] doesn't have any host in config", remoteDeployment)}
-		r.logger.WithFields(bark.Fields{common.TagErr: err, common.TagDeploymentName: remoteDeployment}).Error("Deployment doesn't have any host in config")
-		return
+	// the destination path only matters for its priority,
+	// the default priority applies if it can't be read
+	var dstPath string
+	dstDesc, e := r.metaClient.ReadDestination(nil, &metadata.ReadDestinationRequest{DestinationUUID: common.StringPtr(destUUID)})
+	if e == nil {
+		dstPath = dstDesc.GetPath()
 	}
-
-	host := hosts[rand.Intn(len(hosts))]
-	port := strconv.Itoa(r.AppConfig.GetServiceConfig(common.ReplicatorServiceName).GetWebsocketPort())
-	hostPort := net.JoinHostPort(host, port)
+	sealed := extentStatsResult.GetExtentStats().GetStatus() != shared.ExtentStatus_OPEN
+	isSealed := func() bool {
+		result, e := r.metaClient.ReadExtentStats(nil, readExtentStats)
+		return e == nil && result.GetExtentStats().GetStatus() != shared.ExtentStatus_OPEN
+	}
+	throttle = r.throttle.forStream(remoteZone, dstPath, sealed, isSealed)
 
 	r.logger.WithFields(bark.Fields{
 		common.TagExt:      common.FmtExt(extUUID),
@@ -787,6 +1216,37 @@ func (r *Replicator) createRemoteReplicationReadStream(extUUID string, destUUID
 	return
 }
 
+// getRemoteReplicatorWSHostPort returns the websocket host:port of a random replicator in the remote zone
+func (r *Replicator) getRemoteReplicatorWSHostPort(remoteZone string) (string, error) {
+	remoteDeployment := fmt.Sprintf("%v_%v", r.tenancy, remoteZone)
+	if _, inCfg := r.AppConfig.GetReplicatorConfig().GetReplicatorHosts()[remoteDeployment]; !inCfg {
+		err := &shared.BadRequestError{Message: fmt.Sprintf("Deployment [%v] is not configured", remoteDeployment)}
+		r.logger.WithFields(bark.Fields{common.TagErr: err, common.TagDeploymentName: remoteDeployment}).Error("Deployment is not configured")
+		return "", err
+	}
+
+	hosts := strings.Split(r.AppConfig.GetReplicatorConfig().GetReplicatorHosts()[remoteDeployment], ",")
+	if len(hosts) < 1 {
+		err := &shared.BadRequestError{Message: fmt.Sprintf("Deployment [%v] doesn't have any host in config", remoteDeployment)}
+		r.logger.WithFields(bark.Fields{common.TagErr: err, common.TagDeploymentName: remoteDeployment}).Error("Deployment doesn't have any host in config")
+		return "", err
+	}
+
+	host := hosts[rand.Intn(len(hosts))]
+	port := strconv.Itoa(r.AppConfig.GetServiceConfig(common.ReplicatorServiceName).GetWebsocketPort())
+	return net.JoinHostPort(host, port), nil
+}
+
+// numReplicatorHosts returns the number of live replicators in this zone,
+// which share the bandwidth limits of the remote zones
+func (r *Replicator) numReplicatorHosts() int {
+	hosts, err := r.GetRingpopMonitor().GetHosts(common.ReplicatorServiceName)
+	if err != nil || len(hosts) == 0 {
+		return 1
+	}
+	return len(hosts)
+}
+
 func (r *Replicator) createStoreHostReadStream(destUUID string, extUUID string, request *common.OpenReplicationReadStreamRequest) (stream storeStream.BStoreOpenReadStreamOutCall, err error) {
 	readExtentStats := &metadata.ReadExtentStatsRequest{
 		DestinationUUID: common.StringPtr(destUUID),
@@ -24,10 +24,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"testing"
 	"time"
 
+	mcli "github.com/uber/cherami-server/clients/metadata"
 	"github.com/uber/cherami-server/common"
 	"github.com/uber/cherami-server/common/configure"
 	dconfig "github.com/uber/cherami-server/common/dconfigclient"
@@ -46,6 +48,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
 )
 
 type ReplicatorSuite struct {
@@ -589,7 +592,7 @@ func (s *ReplicatorSuite) TestDestMetadataReconcileLocalMissing() {
 	remoteDests = append(remoteDests, &shared.DestinationDescription{
 		DestinationUUID: common.StringPtr(missingDestUUID),
 	})
-	err := reconciler.reconcileDest(localDests, remoteDests)
+	err := reconciler.reconcileDest(localDests, remoteDests, nil, `zone1`)
 	s.NoError(err)
 	s.mockMeta.AssertExpectations(s.T())
 }
@@ -603,7 +606,7 @@ func (s *ReplicatorSuite) TestDestMetadataReconcileLocalAndRemoteEmpty() {
 
 	var localDests []*shared.DestinationDescription
 	var remoteDests []*shared.DestinationDescription
-	err := reconciler.reconcileDest(localDests, remoteDests)
+	err := reconciler.reconcileDest(localDests, remoteDests, nil, `zone1`)
 	s.NoError(err)
 	s.mockMeta.AssertExpectations(s.T())
 }
@@ -621,7 +624,7 @@ func (s *ReplicatorSuite) TestDestMetadataReconcileRemoteMissing() {
 		DestinationUUID: common.StringPtr(missingDestUUID),
 	})
 	var remoteDests []*shared.DestinationDescription
-	err := reconciler.reconcileDest(localDests, remoteDests)
+	err := reconciler.reconcileDest(localDests, remoteDests, nil, `zone1`)
 	s.NoError(err)
 	s.mockMeta.AssertExpectations(s.T())
 }
@@ -640,7 +643,7 @@ func (s *ReplicatorSuite) TestDestMetadataReconcileLocalMissingRemoteDeleted() {
 		DestinationUUID: common.StringPtr(missingDestUUID),
 		Status:          common.InternalDestinationStatusPtr(shared.DestinationStatus_DELETING),
 	})
-	err := reconciler.reconcileDest(localDests, remoteDests)
+	err := reconciler.reconcileDest(localDests, remoteDests, nil, `zone1`)
 	s.NoError(err)
 	s.mockMeta.AssertExpectations(s.T())
 }
@@ -671,7 +674,7 @@ func (s *ReplicatorSuite) TestDestMetadataReconcileRemoteDeleted() {
 		Path:            common.StringPtr(destPath),
 		Status:          common.InternalDestinationStatusPtr(shared.DestinationStatus_DELETING),
 	})
-	err := reconciler.reconcileDest(localDests, remoteDests)
+	err := reconciler.reconcileDest(localDests, remoteDests, nil, `zone1`)
 	s.NoError(err)
 	s.mockMeta.AssertExpectations(s.T())
 }
@@ -697,7 +700,7 @@ func (s *ReplicatorSuite) TestDestMetadataReconcileRemoteLocalDeleted() {
 		Path:            common.StringPtr(destPath),
 		Status:          common.InternalDestinationStatusPtr(shared.DestinationStatus_DELETING),
 	})
-	err := reconciler.reconcileDest(localDests, remoteDests)
+	err := reconciler.reconcileDest(localDests, remoteDests, nil, `zone1`)
 	s.NoError(err)
 	s.mockMeta.AssertExpectations(s.T())
 }
@@ -707,12 +710,16 @@ func (s *ReplicatorSuite) TestDestMetadataReconcileRemoteUpdate() {
 	localZone := `zone2`
 	destUUID := uuid.New()
 	destPath := `path`
+	remoteZone := `zone1`
 	ownerRemote := `owner1`
 	ownerLocal := `owner2`
 
 	repliator, _ := NewReplicator("replicator-test", s.mockService, s.mockMeta, s.mockReplicatorClientFactory, s.cfg)
 	reconciler, _ := NewMetadataReconciler(repliator.metaClient, repliator, localZone, repliator.logger, repliator.m3Client).(*metadataReconciler)
 
+	// the destination is not versioned, so it follows the authoritative zone
+	repliator.setAuthoritativeZone(remoteZone)
+
 	// setup mock
 	s.mockMeta.On("UpdateDestination", mock.Anything, mock.Anything).Return(shared.NewDestinationDescription(), nil).Run(func(args mock.Arguments) {
 		req := args.Get(1).(*shared.UpdateDestinationRequest)
@@ -732,11 +739,251 @@ func (s *ReplicatorSuite) TestDestMetadataReconcileRemoteUpdate() {
 		Path:            common.StringPtr(destPath),
 		OwnerEmail:      common.StringPtr(ownerRemote),
 	})
-	err := reconciler.reconcileDest(localDests, remoteDests)
+	err := reconciler.reconcileDest(localDests, remoteDests, nil, remoteZone)
 	s.NoError(err)
 	s.mockMeta.AssertExpectations(s.T())
 }
 
+// both zones have the same destination version but a different state, the update of one of them was not versioned.
+// Expect the local zone to follow the authoritative zone, and only the authoritative zone
+func (s *ReplicatorSuite) TestDestMetadataReconcileSameVersionDiverged() {
+	localZone := `zone2`
+	destUUID := uuid.New()
+	remoteZone := `zone1`
+	ownerRemote := `owner1`
+
+	repliator, _ := NewReplicator("replicator-test", s.mockService, s.mockMeta, s.mockReplicatorClientFactory, s.cfg)
+	reconciler, _ := NewMetadataReconciler(repliator.metaClient, repliator, localZone, repliator.logger, repliator.m3Client).(*metadataReconciler)
+
+	version := newLocalVersion(nil, remoteZone, time.Now())
+	versions := &fakeEntityVersions{versions: map[string]*mcli.EntityVersion{destUUID: versionToMetadata(destUUID, version)}}
+	repliator.versions = versions
+
+	localDests := []*shared.DestinationDescription{{
+		DestinationUUID: common.StringPtr(destUUID),
+		Path:            common.StringPtr(`path`),
+		OwnerEmail:      common.StringPtr(`owner2`),
+	}}
+	remoteDests := []*shared.DestinationDescription{{
+		DestinationUUID: common.StringPtr(destUUID),
+		Path:            common.StringPtr(`path`),
+		OwnerEmail:      common.StringPtr(ownerRemote),
+	}}
+	remoteVersions := map[string]*entityVersion{destUUID: version}
+
+	// another zone than the authoritative one doesn't win
+	repliator.setAuthoritativeZone(`zone3`)
+	s.NoError(reconciler.reconcileDest(localDests, remoteDests, remoteVersions, remoteZone))
+	s.mockMeta.AssertNotCalled(s.T(), "UpdateDestination", mock.Anything, mock.Anything)
+
+	repliator.setAuthoritativeZone(remoteZone)
+	s.mockMeta.On("UpdateDestination", mock.Anything, mock.Anything).Return(shared.NewDestinationDescription(), nil).Run(func(args mock.Arguments) {
+		req := args.Get(1).(*shared.UpdateDestinationRequest)
+		s.Equal(destUUID, req.GetDestinationUUID())
+		s.Equal(ownerRemote, req.GetOwnerEmail())
+	}).Once()
+
+	s.NoError(reconciler.reconcileDest(localDests, remoteDests, remoteVersions, remoteZone))
+	s.mockMeta.AssertExpectations(s.T())
+}
+
+func newTestZoneCg(cgUUID string, ownerEmail string, status shared.ConsumerGroupStatus, version *entityVersion) *zoneConsumerGroup {
+	cg := &zoneConsumerGroup{
+		DestinationPath: `/dest`,
+		ConsumerGroup: &shared.ConsumerGroupDescription{
+			ConsumerGroupUUID: common.StringPtr(cgUUID),
+			ConsumerGroupName: common.StringPtr(`/cg/` + cgUUID),
+			OwnerEmail:        common.StringPtr(ownerEmail),
+			Status:            common.InternalConsumerGroupStatusPtr(status),
+			IsMultiZone:       common.BoolPtr(true),
+		},
+	}
+	if version != nil {
+		cg.Version = version.String()
+	}
+	return cg
+}
+
+// local zone is missing one consumer group compared to the authoritative zone. Expect to create it locally at
+// the version of the authoritative zone, unless it is deleted there
+func (s *ReplicatorSuite) TestCgMetadataReconcileLocalMissing() {
+	remoteZone := `zone1`
+	cgUUID := uuid.New()
+
+	repliator, _ := NewReplicator("replicator-test", s.mockService, s.mockMeta, s.mockReplicatorClientFactory, s.cfg)
+	reconciler, _ := NewMetadataReconciler(repliator.metaClient, repliator, `zone2`, repliator.logger, repliator.m3Client).(*metadataReconciler)
+	versions := &fakeEntityVersions{versions: make(map[string]*mcli.EntityVersion)}
+	repliator.versions = versions
+
+	s.mockMeta.On("ReadConsumerGroupByUUID", mock.Anything, mock.Anything).Return(nil, &shared.EntityNotExistsError{})
+
+	remoteVersion := newLocalVersion(nil, remoteZone, time.Now())
+	remoteCgs := []*zoneConsumerGroup{
+		newTestZoneCg(cgUUID, `owner`, shared.ConsumerGroupStatus_ENABLED, remoteVersion),
+		newTestZoneCg(uuid.New(), `owner`, shared.ConsumerGroupStatus_DELETED, nil),
+	}
+	s.NoError(reconciler.reconcileCg(nil, remoteCgs, remoteZone))
+
+	s.Len(versions.createdCgs, 1)
+	s.Equal(cgUUID, versions.createdCgs[0].GetConsumerGroupUUID())
+	s.Equal(`/dest`, versions.createdCgs[0].GetRequest().GetDestinationPath())
+	s.Equal(`owner`, versions.createdCgs[0].GetRequest().GetOwnerEmail())
+	s.Equal(remoteVersion.vector, versionFromMetadata(versions.versions[cgUUID]).vector)
+}
+
+// local zone has one more consumer group than the authoritative zone. Expect it to be shipped to the authoritative
+// zone at its local version, unless it is deleted locally
+func (s *ReplicatorSuite) TestCgMetadataReconcileRemoteMissing() {
+	remoteZone := `zone1`
+	cgUUID := uuid.New()
+	localVersion := newLocalVersion(nil, `zone2`, time.Now())
+
+	repliator, _ := NewReplicator("replicator-test", s.mockService, s.mockMeta, s.mockReplicatorClientFactory, s.cfg)
+	reconciler, _ := NewMetadataReconciler(repliator.metaClient, repliator, `zone2`, repliator.logger, repliator.m3Client).(*metadataReconciler)
+
+	mockReplicator := new(mockreplicator.MockTChanReplicator)
+	mockReplicator.On("CreateConsumerGroupUUID", mock.Anything, mock.Anything).Return(nil, nil).Run(func(args mock.Arguments) {
+		req := args.Get(1).(*shared.CreateConsumerGroupUUIDRequest)
+		s.Equal(cgUUID, req.GetConsumerGroupUUID())
+		s.Equal(`owner`, req.GetRequest().GetOwnerEmail())
+		version, err := versionFromContext(args.Get(0).(thrift.Context))
+		s.NoError(err)
+		s.Equal(localVersion.String(), version.String())
+	}).Once()
+	s.mockReplicatorClientFactory.On("GetReplicatorClient", remoteZone).Return(mockReplicator, nil)
+
+	localCgs := []*zoneConsumerGroup{
+		newTestZoneCg(cgUUID, `owner`, shared.ConsumerGroupStatus_ENABLED, localVersion),
+		newTestZoneCg(uuid.New(), `owner`, shared.ConsumerGroupStatus_DELETED, nil),
+	}
+	s.NoError(reconciler.reconcileCg(localCgs, nil, remoteZone))
+	mockReplicator.AssertExpectations(s.T())
+}
+
+// consumer groups deleted in one zone only. Expect them to be deleted in the other zone, whatever their versions
+func (s *ReplicatorSuite) TestCgMetadataReconcileDeletedInOneZone() {
+	remoteZone := `zone1`
+	deletedLocal := uuid.New()
+	deletedRemote := uuid.New()
+	deletedBoth := uuid.New()
+	newerVersion := newLocalVersion(newLocalVersion(nil, remoteZone, time.Now()), remoteZone, time.Now())
+
+	repliator, _ := NewReplicator("replicator-test", s.mockService, s.mockMeta, s.mockReplicatorClientFactory, s.cfg)
+	reconciler, _ := NewMetadataReconciler(repliator.metaClient, repliator, `zone2`, repliator.logger, repliator.m3Client).(*metadataReconciler)
+
+	mockReplicator := new(mockreplicator.MockTChanReplicator)
+	mockReplicator.On("DeleteConsumerGroup", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		req := args.Get(1).(*shared.DeleteConsumerGroupRequest)
+		s.Equal(`/dest`, req.GetDestinationPath())
+		s.Equal(`/cg/`+deletedLocal, req.GetConsumerGroupName())
+	}).Once()
+	s.mockReplicatorClientFactory.On("GetReplicatorClient", remoteZone).Return(mockReplicator, nil)
+
+	s.mockMeta.On("DeleteConsumerGroup", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		req := args.Get(1).(*shared.DeleteConsumerGroupRequest)
+		s.Equal(`/dest`, req.GetDestinationPath())
+		s.Equal(`/cg/`+deletedRemote, req.GetConsumerGroupName())
+	}).Once()
+
+	localCgs := []*zoneConsumerGroup{
+		newTestZoneCg(deletedLocal, `owner`, shared.ConsumerGroupStatus_DELETED, nil),
+		newTestZoneCg(deletedRemote, `owner`, shared.ConsumerGroupStatus_ENABLED, newerVersion),
+		newTestZoneCg(deletedBoth, `owner`, shared.ConsumerGroupStatus_DELETED, nil),
+	}
+	remoteCgs := []*zoneConsumerGroup{
+		newTestZoneCg(deletedLocal, `owner`, shared.ConsumerGroupStatus_ENABLED, newerVersion),
+		newTestZoneCg(deletedRemote, `owner`, shared.ConsumerGroupStatus_DELETED, nil),
+		newTestZoneCg(deletedBoth, `owner`, shared.ConsumerGroupStatus_DELETED, nil),
+	}
+	s.NoError(reconciler.reconcileCg(localCgs, remoteCgs, remoteZone))
+	mockReplicator.AssertExpectations(s.T())
+	s.mockMeta.AssertExpectations(s.T())
+}
+
+// consumer group updated locally, but the update never made it to the authoritative zone. Expect the local
+// state to be shipped to the authoritative zone at the local version
+func (s *ReplicatorSuite) TestCgMetadataReconcileLocalUpdate() {
+	remoteZone := `zone1`
+	cgUUID := uuid.New()
+	remoteVersion := newLocalVersion(nil, remoteZone, time.Now())
+	localVersion := newLocalVersion(remoteVersion, `zone2`, time.Now())
+
+	repliator, _ := NewReplicator("replicator-test", s.mockService, s.mockMeta, s.mockReplicatorClientFactory, s.cfg)
+	reconciler, _ := NewMetadataReconciler(repliator.metaClient, repliator, `zone2`, repliator.logger, repliator.m3Client).(*metadataReconciler)
+
+	mockReplicator := new(mockreplicator.MockTChanReplicator)
+	mockReplicator.On("UpdateConsumerGroup", mock.Anything, mock.Anything).Return(nil, nil).Run(func(args mock.Arguments) {
+		req := args.Get(1).(*shared.UpdateConsumerGroupRequest)
+		s.Equal(`/cg/`+cgUUID, req.GetConsumerGroupName())
+		s.Equal(`owner2`, req.GetOwnerEmail())
+		version, err := versionFromContext(args.Get(0).(thrift.Context))
+		s.NoError(err)
+		s.Equal(localVersion.String(), version.String())
+	}).Once()
+	s.mockReplicatorClientFactory.On("GetReplicatorClient", remoteZone).Return(mockReplicator, nil)
+
+	localCgs := []*zoneConsumerGroup{newTestZoneCg(cgUUID, `owner2`, shared.ConsumerGroupStatus_ENABLED, localVersion)}
+	remoteCgs := []*zoneConsumerGroup{newTestZoneCg(cgUUID, `owner1`, shared.ConsumerGroupStatus_ENABLED, remoteVersion)}
+	s.NoError(reconciler.reconcileCg(localCgs, remoteCgs, remoteZone))
+	mockReplicator.AssertExpectations(s.T())
+	s.mockMeta.AssertNotCalled(s.T(), "UpdateConsumerGroup", mock.Anything, mock.Anything)
+}
+
+// consumer group updated in the authoritative zone, but not locally. Expect the local zone to apply the
+// update at the version of the authoritative zone
+func (s *ReplicatorSuite) TestCgMetadataReconcileRemoteUpdate() {
+	remoteZone := `zone1`
+	cgUUID := uuid.New()
+	localVersion := newLocalVersion(nil, remoteZone, time.Now())
+	remoteVersion := newLocalVersion(localVersion, remoteZone, time.Now())
+
+	repliator, _ := NewReplicator("replicator-test", s.mockService, s.mockMeta, s.mockReplicatorClientFactory, s.cfg)
+	reconciler, _ := NewMetadataReconciler(repliator.metaClient, repliator, `zone2`, repliator.logger, repliator.m3Client).(*metadataReconciler)
+	versions := &fakeEntityVersions{versions: map[string]*mcli.EntityVersion{cgUUID: versionToMetadata(cgUUID, localVersion)}}
+	repliator.versions = versions
+
+	localCg := newTestZoneCg(cgUUID, `owner2`, shared.ConsumerGroupStatus_ENABLED, localVersion)
+	remoteCg := newTestZoneCg(cgUUID, `owner1`, shared.ConsumerGroupStatus_ENABLED, remoteVersion)
+
+	s.mockMeta.On("ReadConsumerGroup", mock.Anything, mock.Anything).Return(localCg.ConsumerGroup, nil)
+	s.mockMeta.On("UpdateConsumerGroup", mock.Anything, mock.Anything).Return(remoteCg.ConsumerGroup, nil).Run(func(args mock.Arguments) {
+		req := args.Get(1).(*shared.UpdateConsumerGroupRequest)
+		s.Equal(`/cg/`+cgUUID, req.GetConsumerGroupName())
+		s.Equal(`owner1`, req.GetOwnerEmail())
+	}).Once()
+
+	s.NoError(reconciler.reconcileCg([]*zoneConsumerGroup{localCg}, []*zoneConsumerGroup{remoteCg}, remoteZone))
+	s.mockMeta.AssertExpectations(s.T())
+	s.Equal(remoteVersion.vector, versionFromMetadata(versions.versions[cgUUID]).vector)
+	s.mockReplicatorClientFactory.AssertNotCalled(s.T(), "GetReplicatorClient", mock.Anything)
+}
+
+// the consumer groups are only listed to the replicators configured for the zone they claim to be from
+func (s *ReplicatorSuite) TestConsumerGroupsHandler() {
+	s.cfg.GetReplicatorConfig().GetReplicatorHosts()[`prod_zone1`] = `10.0.0.1,10.0.0.2`
+
+	repliator, _ := NewReplicator("replicator-test", s.mockService, s.mockMeta, s.mockReplicatorClientFactory, s.cfg)
+	repliator.localZone = `zone2`
+	repliator.tenancy = common.TenancyProd
+	repliator.allZones = map[string][]string{common.TenancyProd: {`zone1`, `zone2`}}
+
+	s.mockMeta.On("ListAllConsumerGroups", mock.Anything, mock.Anything).Return(&metadata.ListConsumerGroupResult_{}, nil).Once()
+
+	list := func(zone string, remoteAddr string) int {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("%v?%v=%v", httpPathConsumerGroups, httpParamZone, zone), nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		repliator.ConsumerGroupsHandler(w, req)
+		return w.Code
+	}
+
+	s.Equal(http.StatusForbidden, list(`zone1`, `10.0.0.3:1234`), "not a replicator of the zone")
+	s.Equal(http.StatusForbidden, list(`zone2`, `10.0.0.1:1234`), "the local zone")
+	s.Equal(http.StatusForbidden, list(``, `10.0.0.1:1234`), "no zone")
+	s.Equal(http.StatusOK, list(`zone1`, `10.0.0.2:1234`))
+	s.mockMeta.AssertExpectations(s.T())
+}
+
 // local zone is missing one destination extent compared to remote. Expect to create the missing destination extent
 func (s *ReplicatorSuite) TestDestExtentMetadataReconcileLocalMissing() {
 	localZone := `zone2`
@@ -825,3 +1072,104 @@ func (s *ReplicatorSuite) TestDestExtentMetadataReconcileInconsistentStatus() {
 	s.NoError(err)
 	s.mockMeta.AssertExpectations(s.T())
 }
+
+func (s *ReplicatorSuite) TestApplyAckLevels() {
+	dst := uuid.New()
+	cg := uuid.New()
+	missingCg := uuid.New()
+	singleZoneCg := uuid.New()
+	extent := uuid.New()
+	missingExtent := uuid.New()
+	newExtent := uuid.New()
+
+	repliator, _ := NewReplicator("replicator-test", s.mockService, s.mockMeta, s.mockReplicatorClientFactory, s.cfg)
+	versions := &fakeEntityVersions{ackLevels: map[string]int64{cg + "/" + extent: 200}}
+	repliator.versions = versions
+
+	cgDesc := &shared.ConsumerGroupDescription{
+		ConsumerGroupUUID: common.StringPtr(cg),
+		DestinationUUID:   common.StringPtr(dst),
+		IsMultiZone:       common.BoolPtr(true),
+		ActiveZone:        common.StringPtr(`zone2`),
+	}
+	readCg := func(cgUUID string) func(mock.Arguments) {
+		return func(args mock.Arguments) {
+			s.Equal(cgUUID, args.Get(1).(*metadata.ReadConsumerGroupRequest).GetConsumerGroupUUID())
+		}
+	}
+	s.mockMeta.On("ReadConsumerGroupByUUID", mock.Anything, mock.Anything).Return(nil, &shared.EntityNotExistsError{}).Run(readCg(missingCg)).Once()
+	s.mockMeta.On("ReadConsumerGroupByUUID", mock.Anything, mock.Anything).Return(&shared.ConsumerGroupDescription{
+		ConsumerGroupUUID: common.StringPtr(singleZoneCg),
+		DestinationUUID:   common.StringPtr(dst),
+		ActiveZone:        common.StringPtr(`zone2`),
+	}, nil).Run(readCg(singleZoneCg)).Once()
+	s.mockMeta.On("ReadConsumerGroupByUUID", mock.Anything, mock.Anything).Return(cgDesc, nil).Run(readCg(cg)).Once()
+
+	readExtent := func(extentUUID string) func(mock.Arguments) {
+		return func(args mock.Arguments) {
+			s.Equal(extentUUID, args.Get(1).(*metadata.ReadExtentStatsRequest).GetExtentUUID())
+		}
+	}
+	extentStats := func(extentUUID string) *metadata.ReadExtentStatsResult_ {
+		return &metadata.ReadExtentStatsResult_{
+			ExtentStats: &shared.ExtentStats{
+				Extent: &shared.Extent{
+					ExtentUUID: common.StringPtr(extentUUID),
+					StoreUUIDs: []string{uuid.New()},
+				},
+			},
+		}
+	}
+	s.mockMeta.On("ReadExtentStats", mock.Anything, mock.Anything).Return(nil, &shared.InternalServiceError{}).Run(readExtent(missingExtent)).Once()
+	s.mockMeta.On("ReadExtentStats", mock.Anything, mock.Anything).Return(extentStats(extent), nil).Run(readExtent(extent)).Once()
+	s.mockMeta.On("ReadExtentStats", mock.Anything, mock.Anything).Return(extentStats(newExtent), nil).Run(readExtent(newExtent)).Once()
+
+	levels := []*ackLevel{
+		{DestinationUUID: dst, ConsumerGroupUUID: missingCg, ExtentUUID: extent, AckLevelAddress: 300},
+		{DestinationUUID: dst, ConsumerGroupUUID: singleZoneCg, ExtentUUID: extent, AckLevelAddress: 300},
+		{DestinationUUID: dst, ConsumerGroupUUID: cg, ExtentUUID: missingExtent, AckLevelAddress: 300},
+		{DestinationUUID: uuid.New(), ConsumerGroupUUID: cg, ExtentUUID: extent, AckLevelAddress: 400},
+		{DestinationUUID: dst, ConsumerGroupUUID: cg, ExtentUUID: extent, AckLevelAddress: 100},
+		{DestinationUUID: dst, ConsumerGroupUUID: cg, ExtentUUID: extent, AckLevelAddress: 300},
+		{DestinationUUID: dst, ConsumerGroupUUID: cg, ExtentUUID: newExtent, AckLevelAddress: 100},
+	}
+	result, err := repliator.applyAckLevels(`zone2`, levels)
+	s.NoError(err)
+	s.Equal(2, result.Moved)
+	s.Equal([]string{levels[0].key(), levels[2].key()}, result.Skipped)
+	s.Equal(int64(300), versions.ackLevels[cg+"/"+extent])
+	s.Equal(int64(100), versions.ackLevels[cg+"/"+newExtent], "a missing consumer group extent is created on the local stores")
+	s.mockMeta.AssertExpectations(s.T())
+
+	// the ack levels of a consumer group are only trusted from its active zone
+	s.mockMeta.On("ReadConsumerGroupByUUID", mock.Anything, mock.Anything).Return(cgDesc, nil).Run(readCg(cg)).Once()
+	result, err = repliator.applyAckLevels(`zone3`, []*ackLevel{
+		{DestinationUUID: dst, ConsumerGroupUUID: cg, ExtentUUID: extent, AckLevelAddress: 500},
+	})
+	s.NoError(err)
+	s.Equal(0, result.Moved)
+	s.Empty(result.Skipped)
+	s.Equal(int64(300), versions.ackLevels[cg+"/"+extent])
+}
+
+func (s *ReplicatorSuite) TestChangedAckLevels() {
+	repliator, _ := NewReplicator("replicator-test", s.mockService, s.mockMeta, s.mockReplicatorClientFactory, s.cfg)
+	shipper, _ := NewAckLevelShipper(repliator.metaClient, repliator, `zone1`, time.Minute, repliator.logger, repliator.m3Client).(*ackLevelShipper)
+
+	level1 := &ackLevel{ConsumerGroupUUID: uuid.New(), ExtentUUID: uuid.New(), AckLevelAddress: 100}
+	level2 := &ackLevel{ConsumerGroupUUID: uuid.New(), ExtentUUID: uuid.New(), AckLevelAddress: 100}
+
+	// nothing was shipped yet
+	s.Equal([]*ackLevel{level1, level2}, shipper.changedAckLevels(`zone2`, []*ackLevel{level1, level2}))
+
+	// skipped levels are shipped again
+	shipper.markShipped(`zone2`, []*ackLevel{level1, level2}, []string{level2.key()})
+	s.Equal([]*ackLevel{level2}, shipper.changedAckLevels(`zone2`, []*ackLevel{level1, level2}))
+	s.Equal([]*ackLevel{level1, level2}, shipper.changedAckLevels(`zone3`, []*ackLevel{level1, level2}))
+
+	// only the levels that moved are shipped, and gone extents are forgotten
+	shipper.markShipped(`zone2`, []*ackLevel{level2}, nil)
+	moved := &ackLevel{ConsumerGroupUUID: level1.ConsumerGroupUUID, ExtentUUID: level1.ExtentUUID, AckLevelAddress: 200}
+	s.Equal([]*ackLevel{moved}, shipper.changedAckLevels(`zone2`, []*ackLevel{moved}))
+	s.Len(shipper.shipped[`zone2`], 1)
+}
@@ -0,0 +1,318 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replicator
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/common"
+)
+
+type (
+	// replicationThrottle limits the bandwidth used to pull messages
+	// from each remote zone. The limit of a zone is split evenly among
+	// the live replicators, and the streams of this host share its part,
+	// and a stream only gets bandwidth when no stream of a higher
+	// priority is waiting for it, so that a backfill of old extents
+	// does not hold back the fresh messages of the open extents.
+	replicationThrottle struct {
+		sync.RWMutex
+		logger      bark.Logger
+		zoneLimits  []string // zone=bytesPerSec rules, an empty zone is the default
+		dstPrios    []string // path=priority rules, by longest path prefix
+		zoneCfg     string   // zoneLimits, as configured
+		dstCfg      string   // dstPrios, as configured
+		zones       map[string]*zoneThrottle
+		timeSource  common.TimeSource
+		minWaitTime time.Duration
+		numHosts    func() int // the live replicators sharing the limits, nil if this is the only one
+	}
+
+	// zoneThrottle is the bandwidth of a single remote zone, as a token
+	// bucket of bytes that refills at the limit and holds up to a second
+	// worth of it. The bucket goes in debt for messages larger than the
+	// tokens left, so that a message is never held back forever.
+	zoneThrottle struct {
+		sync.Mutex
+		bytesPerSec int64
+		tokens      int64
+		lastRefill  time.Time
+		waiting     [numReplicationPriorities]int
+	}
+
+	// streamThrottle is the throttle of a single replication stream
+	streamThrottle struct {
+		throttle      *replicationThrottle
+		zone          *zoneThrottle
+		priority      int
+		isSealed      func() bool // nil once the extent is known to be sealed
+		nextSealCheck time.Time
+	}
+)
+
+// Destination priorities, lower is more urgent
+const (
+	replicationPriorityHigh = iota
+	replicationPriorityNormal
+	replicationPriorityLow
+
+	numDestinationPriorities
+)
+
+// the sealed extents of every destination come after
+// the open extents of all the destinations
+const numReplicationPriorities = 2 * numDestinationPriorities
+
+// throttleMinWaitTime is how often a stream that waits
+// behind streams of a higher priority checks again
+const throttleMinWaitTime = 10 * time.Millisecond
+
+// throttleSealCheckInterval is how often a stream of an open
+// extent checks whether the extent got sealed in the meantime
+const throttleSealCheckInterval = time.Minute
+
+func newReplicationThrottle(logger bark.Logger) *replicationThrottle {
+	return &replicationThrottle{
+		logger:      logger.WithField(common.TagModule, `throttle`),
+		zones:       make(map[string]*zoneThrottle),
+		timeSource:  common.NewRealTimeSource(),
+		minWaitTime: throttleMinWaitTime,
+	}
+}
+
+// setZoneLimits sets the bandwidth limits, given as a comma separated
+// list of zone=bytesPerSec; a rule without a zone applies to the zones
+// that are not listed, and a limit of zero disables throttling. The
+// limits are for the whole zone, each replicator takes its share.
+func (t *replicationThrottle) setZoneLimits(rules string) {
+	limits := splitThrottleRules(rules)
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.zoneCfg = rules
+	t.zoneLimits = limits
+	for zone, zt := range t.zones {
+		zt.setLimit(t.getZoneLimit(zone))
+	}
+}
+
+// setDestinationPriorities sets the destination priorities, given as a
+// comma separated list of path=priority, where the priority is one of
+// 0 (high), 1 (normal) and 2 (low). The longest matching path wins.
+func (t *replicationThrottle) setDestinationPriorities(rules string) {
+	prios := splitThrottleRules(rules)
+
+	t.Lock()
+	defer t.Unlock()
+	t.dstCfg = rules
+	t.dstPrios = prios
+}
+
+func (t *replicationThrottle) getZoneLimits() string {
+	t.RLock()
+	defer t.RUnlock()
+	return t.zoneCfg
+}
+
+func (t *replicationThrottle) getDestinationPriorities() string {
+	t.RLock()
+	defer t.RUnlock()
+	return t.dstCfg
+}
+
+// forStream returns the throttle for a stream from the given remote zone;
+// isSealed is polled to move the stream behind the open extents once its
+// extent gets sealed, it is not needed for an extent sealed already
+func (t *replicationThrottle) forStream(zone string, dstPath string, sealed bool, isSealed func() bool) *streamThrottle {
+	t.Lock()
+	defer t.Unlock()
+
+	zt, ok := t.zones[zone]
+	if !ok {
+		zt = &zoneThrottle{lastRefill: t.timeSource.Now()}
+		t.zones[zone] = zt
+	}
+	// the share of this host changes as the replicators come and go
+	zt.setLimit(t.getZoneLimit(zone))
+
+	logFn := func() bark.Logger {
+		return t.logger.WithField(common.TagDstPth, common.FmtDstPth(dstPath))
+	}
+	priority := int(common.OverrideValueByPrefix(logFn, dstPath, t.dstPrios, replicationPriorityNormal, `DestinationPriorities`))
+	if priority < replicationPriorityHigh || priority >= numDestinationPriorities {
+		priority = replicationPriorityNormal
+	}
+	if sealed {
+		priority += numDestinationPriorities
+		isSealed = nil
+	}
+
+	return &streamThrottle{
+		throttle:      t,
+		zone:          zt,
+		priority:      priority,
+		isSealed:      isSealed,
+		nextSealCheck: t.timeSource.Now().Add(throttleSealCheckInterval),
+	}
+}
+
+// getZoneLimit returns the share of this host of the bandwidth
+// limit of the zone, lock must be held
+func (t *replicationThrottle) getZoneLimit(zone string) int64 {
+	logFn := func() bark.Logger {
+		return t.logger.WithField(common.TagZoneName, common.FmtZoneName(zone))
+	}
+	limit := common.OverrideValueByPrefix(logFn, zone, t.zoneLimits, 0, `ZoneBandwidthLimits`)
+	if limit <= 0 || t.numHosts == nil {
+		return limit
+	}
+	if n := int64(t.numHosts()); n > 1 {
+		limit /= n
+		if limit == 0 {
+			limit = 1 // zero would disable throttling
+		}
+	}
+	return limit
+}
+
+// wait blocks until the stream may pull a message of the given size,
+// and returns the time it waited; false if closeCh was closed first
+func (s *streamThrottle) wait(size int64, closeCh <-chan struct{}) (time.Duration, bool) {
+	zt := s.zone
+	ts := s.throttle.timeSource
+	start := ts.Now()
+
+	s.checkSealed(start)
+	priority := s.priority
+
+	var registered bool
+	defer func() {
+		if registered {
+			zt.Lock()
+			zt.waiting[priority]--
+			zt.Unlock()
+		}
+	}()
+
+	for {
+		zt.Lock()
+		now := ts.Now()
+		wait, ok := zt.take(size, priority, registered, now)
+		if !ok && !registered {
+			zt.waiting[priority]++
+			registered = true
+		}
+		zt.Unlock()
+
+		if ok {
+			return now.Sub(start), true
+		}
+
+		if wait < s.throttle.minWaitTime {
+			wait = s.throttle.minWaitTime
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-closeCh:
+			return ts.Now().Sub(start), false
+		}
+	}
+}
+
+// checkSealed moves the stream behind the open extents once its
+// extent is sealed; the stream's goroutine is the only caller
+func (s *streamThrottle) checkSealed(now time.Time) {
+	if s.isSealed == nil || now.Before(s.nextSealCheck) {
+		return
+	}
+	s.nextSealCheck = now.Add(throttleSealCheckInterval)
+	if s.isSealed() {
+		s.priority += numDestinationPriorities
+		s.isSealed = nil
+	}
+}
+
+func (zt *zoneThrottle) setLimit(bytesPerSec int64) {
+	zt.Lock()
+	defer zt.Unlock()
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	zt.bytesPerSec = bytesPerSec
+	if zt.tokens > bytesPerSec {
+		zt.tokens = bytesPerSec
+	}
+}
+
+// take takes size bytes off the bucket, unless a stream of a higher
+// priority is waiting or the bucket is in debt. Otherwise, it returns
+// the time until the bucket is out of debt. Lock must be held.
+func (zt *zoneThrottle) take(size int64, priority int, registered bool, now time.Time) (time.Duration, bool) {
+	if zt.bytesPerSec <= 0 {
+		return 0, true
+	}
+
+	elapsed := now.Sub(zt.lastRefill)
+	if elapsed > 0 {
+		if elapsed > time.Second {
+			elapsed = time.Second // the bucket is full by then
+		}
+		zt.tokens += int64(elapsed) * zt.bytesPerSec / int64(time.Second)
+		if zt.tokens > zt.bytesPerSec {
+			zt.tokens = zt.bytesPerSec
+		}
+		zt.lastRefill = now
+	}
+
+	for p := 0; p < priority; p++ {
+		if zt.waiting[p] > 0 {
+			return 0, false
+		}
+	}
+
+	// streams of the same priority that came earlier go first
+	if !registered && zt.waiting[priority] > 0 {
+		return 0, false
+	}
+
+	if zt.tokens < 0 {
+		return time.Duration(-zt.tokens) * time.Second / time.Duration(zt.bytesPerSec), false
+	}
+
+	zt.tokens -= size
+	return 0, true
+}
+
+// splitThrottleRules splits a comma separated list of rules
+func splitThrottleRules(rules string) []string {
+	var result []string
+	for _, rule := range strings.Split(rules, ",") {
+		if rule = strings.TrimSpace(rule); len(rule) > 0 {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
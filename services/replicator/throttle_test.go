@@ -0,0 +1,190 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replicator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/uber/cherami-server/common"
+)
+
+type ThrottleSuite struct {
+	*require.Assertions
+	suite.Suite
+	clock    *common.MockTimeSource
+	throttle *replicationThrottle
+}
+
+func TestThrottleSuite(t *testing.T) {
+	suite.Run(t, new(ThrottleSuite))
+}
+
+func (s *ThrottleSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+	s.clock = common.NewMockTimeSource()
+	s.throttle = newReplicationThrottle(common.GetDefaultLogger())
+	s.throttle.timeSource = s.clock
+}
+
+func (s *ThrottleSuite) TestStreamPriority() {
+	s.throttle.setDestinationPriorities("/prio/=0, /bulk=2,/bad=7")
+	s.Equal("/prio/=0, /bulk=2,/bad=7", s.throttle.getDestinationPriorities())
+
+	s.Equal(replicationPriorityHigh, s.throttle.forStream("zone1", "/prio/a", false, nil).priority)
+	s.Equal(replicationPriorityNormal, s.throttle.forStream("zone1", "/other", false, nil).priority)
+	s.Equal(replicationPriorityNormal, s.throttle.forStream("zone1", "/bad", false, nil).priority)
+	s.Equal(replicationPriorityLow, s.throttle.forStream("zone1", "/bulk/x", false, nil).priority)
+
+	// sealed extents come after the open extents of every destination
+	s.Equal(numDestinationPriorities+replicationPriorityHigh, s.throttle.forStream("zone1", "/prio/a", true, nil).priority)
+	s.True(s.throttle.forStream("zone1", "/prio/a", true, nil).priority > s.throttle.forStream("zone1", "/bulk/x", false, nil).priority)
+}
+
+func (s *ThrottleSuite) TestZoneLimits() {
+	s.throttle.setZoneLimits("=1000,zone2=0")
+
+	zone1 := s.throttle.forStream("zone1", "/a", false, nil).zone
+	zone2 := s.throttle.forStream("zone2", "/a", false, nil).zone
+	s.Equal(int64(1000), zone1.bytesPerSec)
+	s.Equal(int64(0), zone2.bytesPerSec)
+	s.True(zone1 == s.throttle.forStream("zone1", "/b", true, nil).zone, "streams of a zone should share its limit")
+
+	// the new limits apply to the streams already open
+	s.throttle.setZoneLimits("zone2=500")
+	s.Equal(int64(0), zone1.bytesPerSec)
+	s.Equal(int64(500), zone2.bytesPerSec)
+}
+
+func (s *ThrottleSuite) TestTake() {
+	now := s.clock.Now()
+	zt := &zoneThrottle{lastRefill: now}
+	zt.setLimit(1000)
+
+	_, ok := zt.take(600, replicationPriorityNormal, false, now)
+	s.True(ok)
+
+	// in debt until 600 bytes worth of time went by
+	wait, ok := zt.take(100, replicationPriorityNormal, false, now)
+	s.False(ok)
+	s.Equal(600*time.Millisecond, wait)
+
+	now = now.Add(600 * time.Millisecond)
+	_, ok = zt.take(100, replicationPriorityNormal, false, now)
+	s.True(ok)
+
+	// the bucket holds up to a second worth of bytes
+	now = now.Add(time.Minute)
+	_, ok = zt.take(100, replicationPriorityNormal, false, now)
+	s.True(ok)
+	s.Equal(int64(900), zt.tokens)
+
+	// a higher priority stream is waiting
+	zt.waiting[replicationPriorityHigh]++
+	_, ok = zt.take(100, replicationPriorityNormal, true, now)
+	s.False(ok)
+	_, ok = zt.take(100, replicationPriorityHigh, true, now)
+	s.True(ok)
+	zt.waiting[replicationPriorityHigh]--
+
+	// a stream of the same priority came earlier
+	zt.waiting[replicationPriorityNormal]++
+	_, ok = zt.take(100, replicationPriorityNormal, false, now)
+	s.False(ok)
+	_, ok = zt.take(100, replicationPriorityNormal, true, now)
+	s.True(ok)
+
+	// no limit
+	zt.setLimit(0)
+	_, ok = zt.take(1000000, replicationPriorityLow, false, now)
+	s.True(ok)
+}
+
+func (s *ThrottleSuite) TestWait() {
+	s.throttle.setZoneLimits("zone1=1000")
+	st := s.throttle.forStream("zone1", "/a", true, nil)
+
+	closeCh := make(chan struct{})
+	waited, ok := st.wait(2000, closeCh)
+	s.True(ok)
+	s.Equal(time.Duration(0), waited)
+
+	// in debt, and the mock clock doesn't move
+	close(closeCh)
+	_, ok = st.wait(1, closeCh)
+	s.False(ok)
+	s.Equal(0, st.zone.waiting[st.priority])
+}
+
+func (s *ThrottleSuite) TestZoneLimitsSharedByHosts() {
+	numHosts := 3
+	s.throttle.numHosts = func() int { return numHosts }
+	s.throttle.setZoneLimits("zone1=3000,zone2=2")
+
+	zone1 := s.throttle.forStream("zone1", "/a", false, nil).zone
+	zone2 := s.throttle.forStream("zone2", "/a", false, nil).zone
+	s.Equal(int64(1000), zone1.bytesPerSec)
+	s.Equal(int64(1), zone2.bytesPerSec, "a share too small should still throttle")
+
+	// a replicator went away, the next stream picks up the larger share
+	numHosts = 2
+	s.throttle.forStream("zone1", "/b", false, nil)
+	s.Equal(int64(1500), zone1.bytesPerSec)
+}
+
+func (s *ThrottleSuite) TestStreamSealedMidStream() {
+	s.throttle.setZoneLimits("zone1=1000")
+
+	var sealed bool
+	var checks int
+	st := s.throttle.forStream("zone1", "/a", false, func() bool {
+		checks++
+		return sealed
+	})
+	s.Equal(replicationPriorityNormal, st.priority)
+
+	closeCh := make(chan struct{})
+	_, ok := st.wait(1, closeCh)
+	s.True(ok)
+	s.Equal(0, checks, "the extent shouldn't be checked before the interval")
+
+	s.clock.Advance(throttleSealCheckInterval)
+	_, ok = st.wait(1, closeCh)
+	s.True(ok)
+	s.Equal(1, checks)
+	s.Equal(replicationPriorityNormal, st.priority)
+
+	sealed = true
+	s.clock.Advance(throttleSealCheckInterval)
+	_, ok = st.wait(1, closeCh)
+	s.True(ok)
+	s.Equal(2, checks)
+	s.Equal(numDestinationPriorities+replicationPriorityNormal, st.priority)
+
+	// no more checks once sealed
+	s.clock.Advance(throttleSealCheckInterval)
+	_, ok = st.wait(1, closeCh)
+	s.True(ok)
+	s.Equal(2, checks)
+}
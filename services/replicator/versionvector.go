@@ -0,0 +1,359 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replicator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uber/tchannel-go/thrift"
+
+	mcli "github.com/uber/cherami-server/clients/metadata"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+)
+
+type (
+	// versionVector counts the updates made to a multi-zone entity in each zone
+	versionVector map[string]int64
+
+	// vectorOrder is how two version vectors relate to each other
+	vectorOrder int
+
+	// entityVersion is the version of a multi-zone destination or consumer
+	// group. Updates whose vectors are concurrent were made in different
+	// zones without seeing each other, the last writer wins between them,
+	// and the zone name breaks the tie when they were made at the same time.
+	entityVersion struct {
+		vector      versionVector
+		updatedZone string
+		updatedTime int64 // unix nanos
+	}
+)
+
+const (
+	vectorEqual vectorOrder = iota
+	vectorBefore
+	vectorAfter
+	vectorConcurrent
+)
+
+const (
+	// maxVersionWriteAttempts bounds the attempts to write the version of
+	// an entity that keeps being changed concurrently
+	maxVersionWriteAttempts = 5
+
+	// versionHeader is the thrift context header carrying the version of
+	// the entity a replicator call creates or updates
+	versionHeader = `cherami-entity-version`
+	// versionHeaderPrefix prefixes the response headers carrying the
+	// versions of the entities a replicator list call returns, by uuid
+	versionHeaderPrefix = versionHeader + `-`
+)
+
+// compare tells whether v happened before, after, or concurrently with o
+func (v versionVector) compare(o versionVector) vectorOrder {
+	var before, after bool
+	for zone, n := range v {
+		if n > o[zone] {
+			after = true
+		} else if n < o[zone] {
+			before = true
+		}
+	}
+	for zone, n := range o {
+		if _, ok := v[zone]; !ok && n > 0 {
+			before = true
+		}
+	}
+
+	switch {
+	case before && after:
+		return vectorConcurrent
+	case before:
+		return vectorBefore
+	case after:
+		return vectorAfter
+	}
+	return vectorEqual
+}
+
+// merge returns the smallest vector that happened after both v and o
+func (v versionVector) merge(o versionVector) versionVector {
+	merged := make(versionVector, len(v))
+	for zone, n := range v {
+		merged[zone] = n
+	}
+	for zone, n := range o {
+		if n > merged[zone] {
+			merged[zone] = n
+		}
+	}
+	return merged
+}
+
+// String encodes the vector as zone:count pairs, sorted by zone
+func (v versionVector) String() string {
+	zones := make([]string, 0, len(v))
+	for zone := range v {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	pairs := make([]string, len(zones))
+	for i, zone := range zones {
+		pairs[i] = zone + `:` + strconv.FormatInt(v[zone], 10)
+	}
+	return strings.Join(pairs, `,`)
+}
+
+func parseVersionVector(s string) (versionVector, error) {
+	v := make(versionVector)
+	if len(s) == 0 {
+		return v, nil
+	}
+	for _, pair := range strings.Split(s, `,`) {
+		parts := strings.Split(pair, `:`)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("malformed version vector %q", s)
+		}
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("malformed version vector %q", s)
+		}
+		v[parts[0]] = n
+	}
+	return v, nil
+}
+
+// newLocalVersion returns the version of an update made in the given zone,
+// on top of the current version of the entity, which can be nil
+func newLocalVersion(current *entityVersion, zone string, now time.Time) *entityVersion {
+	vector := make(versionVector)
+	if current != nil {
+		vector = current.vector.merge(nil)
+	}
+	vector[zone]++
+	return &entityVersion{vector: vector, updatedZone: zone, updatedTime: now.UnixNano()}
+}
+
+// supersedes tells whether the update with version e must replace the
+// state of an entity at version o; any version supersedes no version
+func (e *entityVersion) supersedes(o *entityVersion) bool {
+	if e == nil {
+		return false
+	}
+	if o == nil {
+		return true
+	}
+
+	switch e.vector.compare(o.vector) {
+	case vectorAfter:
+		return true
+	case vectorConcurrent:
+		if e.updatedTime != o.updatedTime {
+			return e.updatedTime > o.updatedTime
+		}
+		return e.updatedZone > o.updatedZone
+	}
+	return false
+}
+
+// mergeWith returns the version the entity is at after e was resolved
+// against the version of a conflicting update
+func (e *entityVersion) mergeWith(o *entityVersion) *entityVersion {
+	winner, loser := e, o
+	if o.supersedes(e) {
+		winner, loser = o, e
+	}
+	return &entityVersion{
+		vector:      winner.vector.merge(loser.vector),
+		updatedZone: winner.updatedZone,
+		updatedTime: winner.updatedTime,
+	}
+}
+
+// String encodes the version as vector|zone|time
+func (e *entityVersion) String() string {
+	return e.vector.String() + `|` + e.updatedZone + `|` + strconv.FormatInt(e.updatedTime, 10)
+}
+
+func parseEntityVersion(s string) (*entityVersion, error) {
+	parts := strings.Split(s, `|`)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed entity version %q", s)
+	}
+	vector, err := parseVersionVector(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	updatedTime, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed entity version %q", s)
+	}
+	return &entityVersion{vector: vector, updatedZone: parts[1], updatedTime: updatedTime}, nil
+}
+
+// withVersion attaches the version to the context of a replicator call
+func withVersion(ctx thrift.Context, version *entityVersion) thrift.Context {
+	if version == nil {
+		return ctx
+	}
+	return thrift.WithHeaders(ctx, map[string]string{versionHeader: version.String()})
+}
+
+// versionFromContext returns the version a replicator call was made with,
+// or nil when it was made by a replicator that does not version updates
+func versionFromContext(ctx thrift.Context) (*entityVersion, error) {
+	if ctx == nil {
+		return nil, nil
+	}
+	s, ok := ctx.Headers()[versionHeader]
+	if !ok {
+		return nil, nil
+	}
+	return parseEntityVersion(s)
+}
+
+func versionFromMetadata(version *mcli.EntityVersion) *entityVersion {
+	return &entityVersion{
+		vector:      versionVector(version.Vector),
+		updatedZone: version.UpdatedZone,
+		updatedTime: version.UpdatedTime.UnixNano(),
+	}
+}
+
+func versionToMetadata(entityUUID string, version *entityVersion) *mcli.EntityVersion {
+	return &mcli.EntityVersion{
+		EntityUUID:  entityUUID,
+		Vector:      map[string]int64(version.vector),
+		UpdatedZone: version.updatedZone,
+		UpdatedTime: time.Unix(0, version.updatedTime),
+	}
+}
+
+// readEntityVersion returns the local version of an entity, nil if it has
+// none or if the metadata does not keep versions
+func (r *Replicator) readEntityVersion(entityUUID string) (*entityVersion, error) {
+	if r.versions == nil {
+		return nil, nil
+	}
+	version, err := r.versions.ReadEntityVersion(nil, entityUUID)
+	if err != nil {
+		if _, ok := err.(*shared.EntityNotExistsError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return versionFromMetadata(version), nil
+}
+
+// updateEntityVersion reads the local version of an entity, nil if it has
+// none, and writes the version that update returns for it, if any. The
+// write only applies if the version didn't change since it was read, else
+// update is run again on top of the new version, so that concurrent
+// updates of the version don't lose each other. It returns the version the
+// entity is at.
+func (r *Replicator) updateEntityVersion(entityUUID string, update func(current *entityVersion) *entityVersion) (*entityVersion, error) {
+	if r.versions == nil {
+		return nil, nil
+	}
+	for attempt := 0; attempt < maxVersionWriteAttempts; attempt++ {
+		previous, err := r.versions.ReadEntityVersion(nil, entityUUID)
+		if err != nil {
+			if _, ok := err.(*shared.EntityNotExistsError); !ok {
+				return nil, err
+			}
+			previous = nil
+		}
+
+		var current *entityVersion
+		if previous != nil {
+			current = versionFromMetadata(previous)
+		}
+
+		next := update(current)
+		if next == nil {
+			return current, nil
+		}
+
+		applied, err := r.versions.WriteEntityVersion(nil, versionToMetadata(entityUUID, next), previous)
+		if err != nil {
+			return nil, err
+		}
+		if applied {
+			return next, nil
+		}
+	}
+	return nil, &shared.InternalServiceError{Message: fmt.Sprintf(`Version of entity %v changed during every write attempt`, entityUUID)}
+}
+
+// newUpdateVersion versions an update made to an entity in the local zone,
+// before it is sent to the remote zones
+func (r *Replicator) newUpdateVersion(entityUUID string) (*entityVersion, error) {
+	return r.updateEntityVersion(entityUUID, func(current *entityVersion) *entityVersion {
+		return newLocalVersion(current, r.localZone, time.Now())
+	})
+}
+
+// acceptRemoteVersion tells whether an update made in a remote zone at the
+// given version must be applied locally. Updates without a version are
+// always applied, as they were before versions were introduced. A stale
+// update is not applied, but its vector is merged into the local version so
+// that the next local update supersedes it in every zone.
+func (r *Replicator) acceptRemoteVersion(entityUUID string, incoming *entityVersion) (bool, error) {
+	if incoming == nil || r.versions == nil {
+		return true, nil
+	}
+	var apply bool
+	_, err := r.updateEntityVersion(entityUUID, func(current *entityVersion) *entityVersion {
+		apply = false
+		switch {
+		case current == nil || incoming.supersedes(current):
+			apply = true
+			return nil
+		case current.vector.compare(incoming.vector) == vectorEqual:
+			return nil
+		}
+		return current.mergeWith(incoming)
+	})
+	if err != nil {
+		return false, err
+	}
+	return apply, nil
+}
+
+// appliedRemoteVersion records the version of a remote update once it is
+// applied locally
+func (r *Replicator) appliedRemoteVersion(entityUUID string, incoming *entityVersion) error {
+	if incoming == nil || r.versions == nil {
+		return nil
+	}
+	_, err := r.updateEntityVersion(entityUUID, func(current *entityVersion) *entityVersion {
+		if current == nil {
+			return incoming
+		}
+		return incoming.mergeWith(current)
+	})
+	return err
+}
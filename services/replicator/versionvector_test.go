@@ -0,0 +1,240 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replicator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/uber/tchannel-go/thrift"
+
+	mcli "github.com/uber/cherami-server/clients/metadata"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+)
+
+type VersionVectorSuite struct {
+	*require.Assertions
+	suite.Suite
+}
+
+// fakeEntityVersions keeps entity versions, and replicated ack levels, in memory
+type fakeEntityVersions struct {
+	versions   map[string]*mcli.EntityVersion
+	ackLevels  map[string]int64
+	createdCgs []*shared.CreateConsumerGroupUUIDRequest
+
+	// beforeWrite, if set, runs once before the next version write, to
+	// change the version concurrently
+	beforeWrite func()
+}
+
+func TestVersionVectorSuite(t *testing.T) {
+	suite.Run(t, new(VersionVectorSuite))
+}
+
+func (s *VersionVectorSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+}
+
+func (f *fakeEntityVersions) ReadEntityVersion(ctx thrift.Context, entityUUID string) (*mcli.EntityVersion, error) {
+	version, ok := f.versions[entityUUID]
+	if !ok {
+		return nil, &shared.EntityNotExistsError{}
+	}
+	return version, nil
+}
+
+func (f *fakeEntityVersions) WriteEntityVersion(ctx thrift.Context, version *mcli.EntityVersion, previous *mcli.EntityVersion) (bool, error) {
+	if f.beforeWrite != nil {
+		beforeWrite := f.beforeWrite
+		f.beforeWrite = nil
+		beforeWrite()
+	}
+	current, ok := f.versions[version.EntityUUID]
+	if ok != (previous != nil) || (ok && !reflect.DeepEqual(current.Vector, previous.Vector)) {
+		return false, nil
+	}
+	f.versions[version.EntityUUID] = version
+	return true, nil
+}
+
+func (f *fakeEntityVersions) CreateConsumerGroupUUID(ctx thrift.Context, request *shared.CreateConsumerGroupUUIDRequest) (*shared.ConsumerGroupDescription, error) {
+	f.createdCgs = append(f.createdCgs, request)
+	return &shared.ConsumerGroupDescription{
+		ConsumerGroupUUID: common.StringPtr(request.GetConsumerGroupUUID()),
+		ConsumerGroupName: common.StringPtr(request.GetRequest().GetConsumerGroupName()),
+		OwnerEmail:        common.StringPtr(request.GetRequest().GetOwnerEmail()),
+		IsMultiZone:       common.BoolPtr(request.GetRequest().GetIsMultiZone()),
+	}, nil
+}
+
+func (f *fakeEntityVersions) SetReplicatedAckLevel(ctx thrift.Context, cgUUID string, extentUUID string, storeUUIDs []string, ackLevelAddress int64, ackLevelSeqNo int64) (bool, error) {
+	key := cgUUID + "/" + extentUUID
+	if _, ok := f.ackLevels[key]; !ok && len(storeUUIDs) == 0 {
+		return false, &shared.BadRequestError{}
+	}
+	if current, ok := f.ackLevels[key]; ok && current >= ackLevelAddress {
+		return false, nil
+	}
+	f.ackLevels[key] = ackLevelAddress
+	return true, nil
+}
+
+func (s *VersionVectorSuite) TestCompare() {
+	v := versionVector{"zone1": 2, "zone2": 1}
+
+	s.Equal(vectorEqual, v.compare(versionVector{"zone1": 2, "zone2": 1}))
+	s.Equal(vectorEqual, v.compare(versionVector{"zone1": 2, "zone2": 1, "zone3": 0}))
+	s.Equal(vectorAfter, v.compare(versionVector{"zone1": 1, "zone2": 1}))
+	s.Equal(vectorAfter, v.compare(versionVector{"zone1": 2}))
+	s.Equal(vectorBefore, v.compare(versionVector{"zone1": 2, "zone2": 1, "zone3": 1}))
+	s.Equal(vectorConcurrent, v.compare(versionVector{"zone1": 1, "zone2": 2}))
+	s.Equal(vectorConcurrent, v.compare(versionVector{"zone3": 1}))
+	s.Equal(vectorAfter, v.compare(nil))
+}
+
+func (s *VersionVectorSuite) TestMerge() {
+	v := versionVector{"zone1": 2, "zone2": 1}
+	merged := v.merge(versionVector{"zone1": 1, "zone2": 3, "zone3": 1})
+
+	s.Equal(versionVector{"zone1": 2, "zone2": 3, "zone3": 1}, merged)
+	s.Equal(versionVector{"zone1": 2, "zone2": 1}, v, "merge must not change the receiver")
+}
+
+func (s *VersionVectorSuite) TestEncoding() {
+	version := &entityVersion{
+		vector:      versionVector{"zone2": 1, "zone1": 12},
+		updatedZone: "zone1",
+		updatedTime: 1485900000123456789,
+	}
+	s.Equal("zone1:12,zone2:1|zone1|1485900000123456789", version.String())
+
+	parsed, err := parseEntityVersion(version.String())
+	s.NoError(err)
+	s.Equal(version, parsed)
+
+	for _, bad := range []string{"", "zone1:1|zone1", "zone1|zone1|1", "zone1:x|zone1|1", "zone1:1|zone1|x", ":1|zone1|1"} {
+		_, err = parseEntityVersion(bad)
+		s.Error(err, bad)
+	}
+}
+
+func (s *VersionVectorSuite) TestSupersedes() {
+	t0 := time.Unix(1485900000, 0)
+	v1 := newLocalVersion(nil, "zone1", t0)
+	s.Equal(versionVector{"zone1": 1}, v1.vector)
+	s.True(v1.supersedes(nil))
+	s.False((*entityVersion)(nil).supersedes(v1))
+	s.False(v1.supersedes(v1))
+
+	// a later update in the same history wins, whatever its time
+	v2 := newLocalVersion(v1, "zone2", t0.Add(-time.Hour))
+	s.Equal(versionVector{"zone1": 1, "zone2": 1}, v2.vector)
+	s.True(v2.supersedes(v1))
+	s.False(v1.supersedes(v2))
+
+	// between concurrent updates the last writer wins, then the greatest zone
+	a := newLocalVersion(v1, "zone1", t0.Add(time.Minute))
+	b := newLocalVersion(v1, "zone2", t0.Add(2*time.Minute))
+	s.True(b.supersedes(a))
+	s.False(a.supersedes(b))
+
+	c := newLocalVersion(v1, "zone3", t0.Add(time.Minute))
+	s.True(c.supersedes(a))
+	s.False(a.supersedes(c))
+
+	// both zones converge to the same version whichever update they saw first
+	s.Equal(a.mergeWith(b), b.mergeWith(a))
+	s.Equal(versionVector{"zone1": 2, "zone2": 1}, a.mergeWith(b).vector)
+	s.Equal("zone2", a.mergeWith(b).updatedZone)
+}
+
+func (s *VersionVectorSuite) TestAcceptRemoteVersion() {
+	versions := &fakeEntityVersions{versions: make(map[string]*mcli.EntityVersion)}
+	r := &Replicator{localZone: "zone1", versions: versions}
+	entityUUID := "3e1a2f6b-6f0b-4c2e-9d8b-1f1c3a0c2d11"
+	t0 := time.Unix(1485900000, 0)
+
+	// unversioned updates always apply
+	apply, err := r.acceptRemoteVersion(entityUUID, nil)
+	s.NoError(err)
+	s.True(apply)
+
+	// a local update, then a concurrent remote one made before it
+	local, err := r.newUpdateVersion(entityUUID)
+	s.NoError(err)
+	s.Equal(versionVector{"zone1": 1}, local.vector)
+
+	stale := newLocalVersion(nil, "zone2", t0)
+	apply, err = r.acceptRemoteVersion(entityUUID, stale)
+	s.NoError(err)
+	s.False(apply)
+
+	// the stale vector is merged, so the next local update supersedes it
+	current, err := r.readEntityVersion(entityUUID)
+	s.NoError(err)
+	s.Equal(versionVector{"zone1": 1, "zone2": 1}, current.vector)
+	s.Equal("zone1", current.updatedZone)
+
+	// a remote update that saw the local state applies
+	next := newLocalVersion(current, "zone2", t0)
+	apply, err = r.acceptRemoteVersion(entityUUID, next)
+	s.NoError(err)
+	s.True(apply)
+	s.NoError(r.appliedRemoteVersion(entityUUID, next))
+
+	current, err = r.readEntityVersion(entityUUID)
+	s.NoError(err)
+	s.Equal(next, current)
+
+	// the same update again is a no-op
+	apply, err = r.acceptRemoteVersion(entityUUID, next)
+	s.NoError(err)
+	s.False(apply)
+}
+
+func (s *VersionVectorSuite) TestConcurrentVersionUpdates() {
+	versions := &fakeEntityVersions{versions: make(map[string]*mcli.EntityVersion)}
+	r := &Replicator{localZone: "zone1", versions: versions}
+	entityUUID := "5b0c8e2a-1d4f-4a7e-8c3b-2e9f6a1d7c40"
+
+	_, err := r.newUpdateVersion(entityUUID)
+	s.NoError(err)
+
+	// a remote update is recorded between the read and the write of a
+	// local update, which is then made on top of it rather than losing it
+	remote := newLocalVersion(&entityVersion{vector: versionVector{"zone1": 1}}, "zone2", time.Now())
+	versions.beforeWrite = func() {
+		versions.versions[entityUUID] = versionToMetadata(entityUUID, remote)
+	}
+
+	local, err := r.newUpdateVersion(entityUUID)
+	s.NoError(err)
+	s.Equal(versionVector{"zone1": 2, "zone2": 1}, local.vector)
+
+	current, err := r.readEntityVersion(entityUUID)
+	s.NoError(err)
+	s.Equal(local.vector, current.vector)
+}
@@ -21,8 +21,10 @@
 package retentionMgr
 
 import (
+	"sync"
 	"time"
 
+	mcli "github.com/uber/cherami-server/clients/metadata"
 	"github.com/uber/cherami-server/common"
 	"github.com/uber/cherami-thrift/.generated/go/metadata"
 	"github.com/uber/cherami-thrift/.generated/go/shared"
@@ -35,14 +37,29 @@ import (
 const defaultPageSize = 1000
 
 type metadataDepImpl struct {
-	metadata metadata.TChanMetadataService
-	logger   bark.Logger
+	metadata    metadata.TChanMetadataService
+	cgRetention mcli.ConsumerGroupRetentionService // nil, if the metadata service has no retention overrides
+	logger      bark.Logger
+
+	// the retention overrides of the consumer groups, read once and kept
+	// until the next full sweep resets them
+	overridesLock sync.Mutex
+	overrides     map[consumerGroupID]*retentionOverride
 }
 
-func newMetadataDep(metadata metadata.TChanMetadataService, log bark.Logger) *metadataDepImpl {
+// retentionOverride is the retention override of a consumer group, as last read
+type retentionOverride struct {
+	protect              bool
+	excludeAfterInactive time.Duration
+	lastActiveTime       time.Time
+}
+
+func newMetadataDep(metadata metadata.TChanMetadataService, cgRetention mcli.ConsumerGroupRetentionService, log bark.Logger) *metadataDepImpl {
 	return &metadataDepImpl{
-		metadata: metadata,
-		logger:   log,
+		metadata:    metadata,
+		cgRetention: cgRetention,
+		logger:      log,
+		overrides:   make(map[consumerGroupID]*retentionOverride),
 	}
 }
 
@@ -104,6 +121,37 @@ func (t *metadataDepImpl) GetDestinations() (destinations []*destinationInfo) {
 	return
 }
 
+func (t *metadataDepImpl) GetDestination(destID destinationID) (*destinationInfo, error) {
+
+	req := &metadata.ReadDestinationRequest{DestinationUUID: common.StringPtr(string(destID))}
+
+	ctx, cancel := thrift.NewContext(2 * time.Second)
+	defer cancel()
+
+	log := t.logger.WithField(common.TagDst, string(destID))
+
+	log.Debug("GetDestination: ReadDestination on metadata")
+
+	destDesc, err := t.metadata.ReadDestination(ctx, req)
+
+	if err != nil {
+		log.WithField(common.TagErr, err).Error(`GetDestination: ReadDestination failed`)
+		return nil, err
+	}
+
+	dest := &destinationInfo{
+		id:            destinationID(destDesc.GetDestinationUUID()),
+		status:        destDesc.GetStatus(),
+		softRetention: destDesc.GetConsumedMessagesRetention(),
+		hardRetention: destDesc.GetUnconsumedMessagesRetention(),
+		path:          destDesc.GetPath(),
+		isMultiZone:   destDesc.GetIsMultiZone(),
+	}
+
+	log.Debug("GetDestination done")
+	return dest, nil
+}
+
 func (t *metadataDepImpl) GetExtents(destID destinationID) (extents []*extentInfo) {
 
 	req := shared.NewListExtentsStatsRequest()
@@ -139,12 +187,21 @@ func (t *metadataDepImpl) GetExtents(destID destinationID) (extents []*extentInf
 				storehosts:         make([]storehostID, 0, len(storeUUIDs)),
 				singleCGVisibility: consumerGroupID(extStats.GetConsumerGroupVisibility()),
 				originZone:         extStats.GetExtent().GetOriginZone(),
+				createdTime:        time.Unix(0, extStats.GetCreatedTimeMillis()*int64(time.Millisecond)),
 			}
 
 			for j := range storeUUIDs {
 				extInfo.storehosts = append(extInfo.storehosts, storehostID(storeUUIDs[j]))
 			}
 
+			// the replicas hold the same messages; use the largest
+			// size reported, since some replicas may lag behind
+			for _, replicaStats := range extStats.GetReplicaStats() {
+				if replicaStats.GetSizeInBytes() > extInfo.sizeInBytes {
+					extInfo.sizeInBytes = replicaStats.GetSizeInBytes()
+				}
+			}
+
 			extents = append(extents, extInfo)
 			i++
 
@@ -238,14 +295,21 @@ func (t *metadataDepImpl) GetConsumerGroups(destID destinationID) (consumerGroup
 
 			cg := &consumerGroupInfo{
 				id:     consumerGroupID(cgDesc.GetConsumerGroupUUID()),
+				name:   cgDesc.GetConsumerGroupName(),
 				status: cgDesc.GetStatus(),
 			}
 
+			if cg.status != shared.ConsumerGroupStatus_DELETED {
+				t.loadRetentionOverride(cg)
+			}
+
 			consumerGroups = append(consumerGroups, cg)
 
 			log.WithFields(bark.Fields{
-				common.TagCnsm: string(cg.id),
-				`status`:       cg.status,
+				common.TagCnsm:         string(cg.id),
+				`status`:               cg.status,
+				`protect`:              cg.protect,
+				`excludeAfterInactive`: cg.excludeAfterInactive,
 			}).Debug(`GetConsumerGroups: ListConsumerGroups output`)
 		}
 
@@ -262,6 +326,97 @@ func (t *metadataDepImpl) GetConsumerGroups(destID destinationID) (consumerGroup
 	return
 }
 
+// ResetRetentionOverrides drops the cached retention overrides, so that
+// they are read again; the full sweeps call it, the runs in between reuse
+// the overrides, and so the time of the last ack, read by the last sweep
+func (t *metadataDepImpl) ResetRetentionOverrides() {
+
+	t.overridesLock.Lock()
+	t.overrides = make(map[consumerGroupID]*retentionOverride)
+	t.overridesLock.Unlock()
+}
+
+// loadRetentionOverride fills in the retention override of the consumer
+// group, if it has one, from the cache or else from metadata; if it could
+// not be read, the consumer group is marked so, for the retention of its
+// destination to be skipped, since it could be protected
+func (t *metadataDepImpl) loadRetentionOverride(cg *consumerGroupInfo) {
+
+	if t.cgRetention == nil {
+		return
+	}
+
+	t.overridesLock.Lock()
+	override, ok := t.overrides[cg.id]
+	t.overridesLock.Unlock()
+
+	if !ok {
+		var err error
+		if override, err = t.readRetentionOverride(cg.id); err != nil {
+			cg.overrideUnknown = true
+			return
+		}
+
+		t.overridesLock.Lock()
+		t.overrides[cg.id] = override
+		t.overridesLock.Unlock()
+	}
+
+	cg.protect = override.protect
+	cg.excludeAfterInactive = override.excludeAfterInactive
+	cg.lastActiveTime = override.lastActiveTime
+}
+
+// readRetentionOverride reads the retention override of a consumer group
+// from metadata; one that has none gets an empty override
+func (t *metadataDepImpl) readRetentionOverride(cgID consumerGroupID) (*retentionOverride, error) {
+
+	ctx, cancel := thrift.NewContext(2 * time.Second)
+	defer cancel()
+
+	log := t.logger.WithField(common.TagCnsmID, string(cgID))
+
+	override := &retentionOverride{}
+
+	retention, err := t.cgRetention.ReadConsumerGroupRetention(ctx, string(cgID))
+	if err != nil {
+		if _, ok := err.(*shared.EntityNotExistsError); ok {
+			return override, nil
+		}
+		log.WithField(common.TagErr, err).Error(`readRetentionOverride: ReadConsumerGroupRetention failed`)
+		return nil, err
+	}
+
+	override.protect = retention.Protect
+
+	if retention.ExcludeAfterInactive <= 0 {
+		return override, nil
+	}
+
+	lastAckTime, err := t.cgRetention.ReadConsumerGroupLastAckTime(ctx, string(cgID))
+	if err != nil {
+		log.WithField(common.TagErr, err).Error(`readRetentionOverride: ReadConsumerGroupLastAckTime failed`)
+		return nil, err
+	}
+
+	// inactivity is counted from the last ack, or from when the override
+	// was set, if later; so that a consumer group that never acked is not
+	// excluded right away
+	override.excludeAfterInactive = retention.ExcludeAfterInactive
+	override.lastActiveTime = lastAckTime
+	if retention.UpdatedTime.After(override.lastActiveTime) {
+		override.lastActiveTime = retention.UpdatedTime
+	}
+
+	log.WithFields(bark.Fields{
+		`protect`:              override.protect,
+		`excludeAfterInactive`: override.excludeAfterInactive,
+		`lastActiveTime`:       override.lastActiveTime,
+	}).Debug(`readRetentionOverride done`)
+
+	return override, nil
+}
+
 func (t *metadataDepImpl) DeleteExtent(destID destinationID, extID extentID) (err error) {
 
 	req := metadata.NewUpdateExtentStatsRequest()
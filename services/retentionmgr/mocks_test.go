@@ -70,6 +70,9 @@ func (_m *mockMetadataDep) GetConsumerGroups(destID destinationID) []*consumerGr
 
 	return r0
 }
+func (_m *mockMetadataDep) ResetRetentionOverrides() {
+	_m.Called()
+}
 func (_m *mockMetadataDep) DeleteExtent(destID destinationID, extID extentID) error {
 	ret := _m.Called(destID, extID)
 
@@ -140,6 +143,28 @@ func (_m *mockMetadataDep) GetAckLevel(destID destinationID, extID extentID, cgI
 	return r0, r1
 }
 
+func (_m *mockMetadataDep) GetDestination(destID destinationID) (*destinationInfo, error) {
+	ret := _m.Called(destID)
+
+	var r0 *destinationInfo
+	if rf, ok := ret.Get(0).(func(destinationID) *destinationInfo); ok {
+		r0 = rf(destID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*destinationInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(destinationID) error); ok {
+		r1 = rf(destID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 func (_m *mockMetadataDep) GetExtentInfo(destID destinationID, extID extentID) (*extentInfo, error) {
 	ret := _m.Called(destID, extID)
 
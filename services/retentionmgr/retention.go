@@ -22,11 +22,16 @@ package retentionMgr
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/uber-common/bark"
+	mcli "github.com/uber/cherami-server/clients/metadata"
 	"github.com/uber/cherami-server/common"
 	metadataMetrics "github.com/uber/cherami-server/common/metadata"
 	"github.com/uber/cherami-server/common/metrics"
@@ -38,6 +43,16 @@ import (
 const numWorkersDefault = 1                      // default number of workers to use
 const bufferedJobs = 65536                       // capacity of the jobs-channel
 const defaultExtentDeleteDeferPeriod = time.Hour // wait an hour before deleting extent (after it is 'consumed')
+const lastDecisionTTL = 24 * time.Hour           // how long the last decision on an extent is remembered
+const maxPendingSignals = 65536                  // max changes signaled between two runs, before falling back to a full sweep
+
+// retention decisions taken on an extent
+const (
+	DecisionNone         = "none"          // nothing to purge
+	DecisionPurge        = "purge"         // purge messages until the retention address
+	DecisionMarkConsumed = "mark-consumed" // purge and move the extent to 'consumed'
+	DecisionDelete       = "delete"        // delete the extent from the stores and metadata
+)
 
 // TODO:
 // -- on failure, post a job that retries the failure condition
@@ -53,6 +68,41 @@ type (
 		ExtentDeleteDeferPeriod          time.Duration
 		NumWorkers                       int
 		LocalZone                        string
+		// DryRun computes retention without purging, or
+		// updating or deleting anything in metadata
+		DryRun bool
+		// FullSweepInterval, when set, makes the runs between two full
+		// sweeps incremental: instead of listing all the destinations,
+		// they only recompute the extents that were signaled as changed
+		// (see ExtentChanged and DestinationChanged), along with the
+		// ones that time alone has made due for a recompute
+		FullSweepInterval time.Duration
+		// MaxRetainedBytes returns the max bytes a destination can keep
+		// on storage; when a destination grows past it, its oldest
+		// messages are purged, even if they were not consumed. Zero, or
+		// a nil func, disables size retention
+		MaxRetainedBytes func(destPath string) int64
+	}
+
+	// ExtentRetention explains the retention computed for an extent
+	ExtentRetention struct {
+		DestinationUUID               string           `json:"destinationUUID"`
+		ExtentUUID                    string           `json:"extentUUID"`
+		Status                        string           `json:"status"`
+		HardRetentionAddr             int64            `json:"hardRetentionAddr"`
+		SoftRetentionAddr             int64            `json:"softRetentionAddr"`
+		MinAckAddr                    int64            `json:"minAckAddr"`
+		MinAckConsumerGroupUUID       string           `json:"minAckConsumerGroupUUID,omitempty"`
+		RetentionAddr                 int64            `json:"retentionAddr"`
+		SizeRetention                 bool             `json:"sizeRetention"` // hard retention was moved up to enforce the max retained bytes
+		ForcedPurgeConsumerGroupUUIDs []string         `json:"forcedPurgeConsumerGroupUUIDs,omitempty"`
+		ExcludedConsumerGroupUUIDs    []string         `json:"excludedConsumerGroupUUIDs,omitempty"` // inactive, not holding back soft retention
+		ProtectedByConsumerGroupUUID  string           `json:"protectedByConsumerGroupUUID,omitempty"`
+		Decision                      string           `json:"decision"`
+		DryRun                        bool             `json:"dryRun"`
+		Time                          time.Time        `json:"time"`
+		Error                         string           `json:"error,omitempty"`
+		Last                          *ExtentRetention `json:"last,omitempty"` // last decision taken by the workers
 	}
 
 	// RetentionManager context
@@ -74,6 +124,24 @@ type (
 		running bool
 
 		lastDLQRetentionRun time.Time
+
+		dryRun int32 // accessed atomically
+
+		sweep int64 // count of full sweeps
+
+		decisionsLock sync.Mutex
+		decisions     map[extentID]*ExtentRetention
+
+		// state as of the last time each extent was scheduled, used
+		// by the incremental runs; only accessed by the scheduler
+		tracked          map[extentID]*extentTrack
+		trackedConsumers map[destinationID]string
+
+		// changes signaled since the last run, consumed by the next one
+		signalsLock     sync.Mutex
+		signals         map[destinationID]*changeSignals
+		numSignals      int
+		signalsOverflow bool // too many signals, the next run is a full sweep
 	}
 )
 
@@ -82,8 +150,10 @@ type (
 	metadataDep interface {
 		// calls to metadata
 		GetDestinations() (destinations []*destinationInfo)
+		GetDestination(destID destinationID) (destination *destinationInfo, err error)
 		GetExtents(destID destinationID) (extents []*extentInfo)
 		GetConsumerGroups(destID destinationID) (consumerGroups []*consumerGroupInfo)
+		ResetRetentionOverrides()
 		DeleteExtent(destID destinationID, extID extentID) (err error)
 		MarkExtentConsumed(destID destinationID, extID extentID) (err error)
 		DeleteDestination(destID destinationID) (err error)
@@ -116,6 +186,9 @@ type (
 		hardRetention int32 // in seconds
 		path          string
 		isMultiZone   bool
+
+		consumersChanged bool // since the last run
+		partial          bool // only the extents signaled as changed were read
 	}
 
 	extentInfo struct {
@@ -125,26 +198,70 @@ type (
 		storehosts         []storehostID
 		singleCGVisibility consumerGroupID
 		originZone         string
+		createdTime        time.Time
+		sizeInBytes        int64 // approximate size on storage
+		sizeRetentionTime  int64 // time until which to purge, to enforce max retained bytes
+		signaled           bool  // signaled as changed since the last run
+		scheduled          bool  // a retention job is to be scheduled in this run
 		// destID  destinationID
 		// dest    *destinationInfo
 	}
 
 	consumerGroupInfo struct {
 		id     consumerGroupID
+		name   string
 		status shared.ConsumerGroupStatus
+
+		// retention overrides of the consumer group
+		protect              bool          // keep the messages it has not acked, even past hard retention
+		excludeAfterInactive time.Duration // exclude it from soft retention when inactive for this long
+		lastActiveTime       time.Time     // last ack, or when the override was set, if later
+		overrideUnknown      bool          // the override could not be read, retention is skipped
 		// destID destinationID
 		// dest   *destinationInfo
 	}
 
 	retentionJob struct {
-		runAt         time.Time
-		dest          *destinationInfo
-		ext           *extentInfo
-		consumers     []*consumerGroupInfo
-		err           error
-		minAckAddr    int64 // min-ack for all consumers
-		retentionAddr int64 // retention-address
-		deleteExtent  bool  // extent should be deleted
+		runAt             time.Time
+		dest              *destinationInfo
+		ext               *extentInfo
+		consumers         []*consumerGroupInfo
+		err               error
+		hardRetentionAddr int64           // address corresponding to the hard retention time
+		softRetentionAddr int64           // address corresponding to the soft retention time
+		minAckAddr        int64           // min-ack for all consumers
+		minAckCG          consumerGroupID // consumer group with the min-ack
+		retentionAddr     int64           // retention-address
+		deleteExtent      bool            // extent should be deleted
+		decision          string          // decision taken on the extent
+		dryRun            bool            // compute only, without side effects
+
+		sizeRetentionTime int64                // time until which to purge, to enforce max retained bytes
+		sizeRetention     bool                 // hard retention was moved up by size retention
+		forcedPurgeCGs    []*consumerGroupInfo // consumers that lose unconsumed messages to size retention
+
+		excludedCGs []*consumerGroupInfo // inactive consumers left out of the min-ack
+		protectCG   consumerGroupID      // protected consumer that held back the retention address
+	}
+
+	// extentsByCreatedTime sorts extents, oldest first
+	extentsByCreatedTime []*extentInfo
+
+	// extentTrack is what an extent looked like when it was last scheduled
+	extentTrack struct {
+		destID            destinationID
+		status            shared.ExtentStatus
+		statusUpdatedTime time.Time
+		replicas          int
+		recomputeAt       time.Time // when time alone makes it due for a recompute
+		sweep             int64     // full sweep that last saw the extent
+	}
+
+	// changeSignals are the changes signaled on a destination since the last run
+	changeSignals struct {
+		all     bool // recompute all the extents of the destination
+		list    bool // list all the extents, to find the ones due for a recompute
+		extents map[extentID]bool
 	}
 )
 
@@ -160,16 +277,27 @@ func New(opts *Options, metadata metadata.TChanMetadataService, clientFactory co
 	}
 
 	logger = logger.WithField(common.TagModule, `retMgr`)
+
+	// the retention overrides of consumer groups are not part of the
+	// thrift api; look for them before the client is wrapped for metrics
+	cgRetention, _ := metadata.(mcli.ConsumerGroupRetentionService)
 	metadata = metadataMetrics.NewMetadataMetricsMgr(metadata, m3Client, logger)
 
-	return &RetentionManager{
+	t := &RetentionManager{
 		Options:             opts,
 		logger:              logger,
 		m3Client:            m3Client,
-		metadata:            newMetadataDep(metadata, logger),
+		metadata:            newMetadataDep(metadata, cgRetention, logger),
 		storehost:           newStorehostDep(clientFactory, logger),
 		lastDLQRetentionRun: time.Now().AddDate(0, 0, -1),
+		decisions:           make(map[extentID]*ExtentRetention),
+		tracked:             make(map[extentID]*extentTrack),
+		trackedConsumers:    make(map[destinationID]string),
+		signals:             make(map[destinationID]*changeSignals),
 	}
+
+	t.SetDryRun(opts.DryRun)
+	return t
 }
 
 // tNew takes in the metadata and storehost dependencies (that could potentially be mocked for testing)
@@ -181,14 +309,21 @@ func tNew(opts *Options, metadata metadataDep, storehost storehostDep, m3Client
 
 	logger = logger.WithField(common.TagModule, `retMgr`)
 
-	return &RetentionManager{
+	t := &RetentionManager{
 		Options:             opts,
 		logger:              logger,
 		m3Client:            m3Client,
 		metadata:            metadata,
 		storehost:           storehost,
 		lastDLQRetentionRun: time.Now().AddDate(0, 0, -1),
+		decisions:           make(map[extentID]*ExtentRetention),
+		tracked:             make(map[extentID]*extentTrack),
+		trackedConsumers:    make(map[destinationID]string),
+		signals:             make(map[destinationID]*changeSignals),
 	}
+
+	t.SetDryRun(opts.DryRun)
+	return t
 }
 
 // Start starts the various go-routines asynchronously
@@ -201,6 +336,7 @@ func (t *RetentionManager) Start() {
 		t.logger.WithFields(bark.Fields{
 			`interval`:    t.RetentionInterval,
 			`dlqinterval`: t.DLQRetentionInterval,
+			`fullsweep`:   t.FullSweepInterval,
 			`workers`:     t.NumWorkers,
 		}).Info(`RetentionMgr starting`)
 
@@ -225,6 +361,8 @@ func (t *RetentionManager) Start() {
 				timer := time.NewTimer(time.Minute)
 				defer timer.Stop()
 
+				var lastFullSweep time.Time
+
 				for {
 					// wait until 'RetentionInterval' or if we get a "stop"
 					select {
@@ -234,10 +372,18 @@ func (t *RetentionManager) Start() {
 						return
 					}
 
-					if !t.runRetention(t.jobsC) {
+					// without a full sweep interval, every run is a full sweep
+					full := t.FullSweepInterval <= 0 || time.Since(lastFullSweep) >= t.FullSweepInterval ||
+						t.signalsOverflowed()
+
+					if !t.runRetention(t.jobsC, full) {
 						return
 					}
 
+					if full {
+						lastFullSweep = time.Now()
+					}
+
 					// assert( t.RetentionInterval != 0 )
 					timer.Reset(t.RetentionInterval)
 				}
@@ -274,9 +420,9 @@ func (t *RetentionManager) Run() {
 
 	t.RetentionInterval = 0
 	t.Start()
-	t.runRetention(t.jobsC) // run retention (once)
-	close(t.jobsC)          // there will be no more jobs
-	t.wg.Wait()             // wait for completion
+	t.runRetention(t.jobsC, true) // run retention (once)
+	close(t.jobsC)                // there will be no more jobs
+	t.wg.Wait()                   // wait for completion
 
 	t.logger.Info("RetentionMgr stopped")
 }
@@ -285,13 +431,271 @@ func (t *RetentionManager) wait() {
 	t.wg.Wait()
 }
 
+// SetDryRun turns the dry-run mode on or off; in dry-run mode, retention
+// is computed and logged, but nothing is purged, updated or deleted
+func (t *RetentionManager) SetDryRun(dryRun bool) {
+
+	var v int32
+	if dryRun {
+		v = 1
+	}
+
+	if atomic.SwapInt32(&t.dryRun, v) != v {
+		t.logger.WithField(`dryRun`, dryRun).Info(`RetentionMgr: dry-run mode changed`)
+	}
+}
+
+// IsDryRun returns true if the retention manager is in dry-run mode
+func (t *RetentionManager) IsDryRun() bool {
+	return atomic.LoadInt32(&t.dryRun) == 1
+}
+
+// Explain computes the retention for all the extents of a destination,
+// without any side effects, and returns it along with the last decision
+// the workers took for each of the extents
+func (t *RetentionManager) Explain(destID string) ([]*ExtentRetention, error) {
+
+	dest, err := t.metadata.GetDestination(destinationID(destID))
+	if err != nil {
+		return nil, err
+	}
+
+	dest.extents = t.metadata.GetExtents(dest.id)
+	consumers := t.metadata.GetConsumerGroups(dest.id)
+
+	t.computeSizeRetention(dest, t.logger.WithField(common.TagDst, string(dest.id)))
+
+	result := make([]*ExtentRetention, 0, len(dest.extents))
+
+	for _, ext := range dest.extents {
+
+		if ext.status == shared.ExtentStatus_DELETED {
+			continue
+		}
+
+		job := &retentionJob{
+			dest:              dest,
+			ext:               ext,
+			consumers:         consumers,
+			retentionAddr:     int64(store.ADDR_BEGIN),
+			dryRun:            true,
+			sizeRetentionTime: ext.sizeRetentionTime,
+		}
+
+		log := t.logger.WithFields(bark.Fields{
+			common.TagDst: string(dest.id),
+			common.TagExt: string(ext.id),
+		})
+
+		t.computeRetention(job, log)
+
+		explained := newExtentRetention(job)
+
+		t.decisionsLock.Lock()
+		explained.Last = t.decisions[ext.id]
+		t.decisionsLock.Unlock()
+
+		result = append(result, explained)
+	}
+
+	return result, nil
+}
+
+func newExtentRetention(job *retentionJob) *ExtentRetention {
+
+	r := &ExtentRetention{
+		DestinationUUID:         string(job.dest.id),
+		ExtentUUID:              string(job.ext.id),
+		Status:                  job.ext.status.String(),
+		HardRetentionAddr:       job.hardRetentionAddr,
+		SoftRetentionAddr:       job.softRetentionAddr,
+		MinAckAddr:              job.minAckAddr,
+		MinAckConsumerGroupUUID: string(job.minAckCG),
+		RetentionAddr:           job.retentionAddr,
+		SizeRetention:           job.sizeRetention,
+		Decision:                job.decision,
+		DryRun:                  job.dryRun,
+		Time:                    time.Now(),
+	}
+
+	for _, cg := range job.forcedPurgeCGs {
+		r.ForcedPurgeConsumerGroupUUIDs = append(r.ForcedPurgeConsumerGroupUUIDs, string(cg.id))
+	}
+
+	for _, cg := range job.excludedCGs {
+		r.ExcludedConsumerGroupUUIDs = append(r.ExcludedConsumerGroupUUIDs, string(cg.id))
+	}
+
+	r.ProtectedByConsumerGroupUUID = string(job.protectCG)
+
+	if job.err != nil {
+		r.Error = job.err.Error()
+	}
+
+	return r
+}
+
+// computeSizeRetention checks if the extents of a destination take more
+// space than the destination is allowed to retain. If so, it picks the
+// oldest extents to purge, regardless of their consumers, until the
+// excess is covered. Sealed extents that fit in the excess are purged
+// entirely; in the others, the part to purge is estimated assuming the
+// messages were written at a steady rate over the life of the extent.
+func (t *RetentionManager) computeSizeRetention(dest *destinationInfo, log bark.Logger) {
+
+	maxBytes := t.maxRetainedBytes(dest)
+	if maxBytes <= 0 {
+		return
+	}
+
+	// consumed extents are not counted, since they are deleted anyway
+	var totalBytes int64
+	extents := make(extentsByCreatedTime, 0, len(dest.extents))
+
+	for _, ext := range dest.extents {
+		if ext.status == shared.ExtentStatus_DELETED || ext.status == shared.ExtentStatus_CONSUMED || ext.sizeInBytes <= 0 {
+			continue
+		}
+		totalBytes += ext.sizeInBytes
+		extents = append(extents, ext)
+	}
+
+	excess := totalBytes - maxBytes
+	if excess <= 0 {
+		return
+	}
+
+	log.WithFields(bark.Fields{
+		`totalBytes`: totalBytes,
+		`maxBytes`:   maxBytes,
+	}).Warn(`computeSizeRetention: destination exceeds max retained bytes; purging oldest messages`)
+
+	sort.Sort(extents)
+
+	tNow := time.Now().UnixNano()
+
+	for _, ext := range extents {
+
+		if excess <= 0 {
+			break
+		}
+
+		if ext.status != shared.ExtentStatus_OPEN && ext.sizeInBytes <= excess {
+			ext.sizeRetentionTime = math.MaxInt64 // purge the whole extent
+		} else {
+			begin := ext.createdTime.UnixNano()
+			end := tNow
+			if ext.status != shared.ExtentStatus_OPEN {
+				end = ext.statusUpdatedTime.UnixNano() // approximately when the extent was sealed
+			}
+
+			fraction := math.Min(float64(excess)/float64(ext.sizeInBytes), 1.0)
+			ext.sizeRetentionTime = begin + int64(fraction*float64(end-begin))
+		}
+
+		excess -= ext.sizeInBytes
+
+		log.WithFields(bark.Fields{
+			common.TagExt:       string(ext.id),
+			`sizeInBytes`:       ext.sizeInBytes,
+			`sizeRetentionTime`: ext.sizeRetentionTime,
+		}).Debug(`computeSizeRetention: purging extent to enforce max retained bytes`)
+	}
+}
+
+// maxRetainedBytes returns the size retention limit of a destination, zero if none
+func (t *RetentionManager) maxRetainedBytes(dest *destinationInfo) int64 {
+
+	if t.Options.MaxRetainedBytes == nil {
+		return 0
+	}
+
+	return t.Options.MaxRetainedBytes(dest.path)
+}
+
+// reportForcedPurges counts the consumer groups that lost unconsumed
+// messages to size retention, under the consumer group tag
+func (t *RetentionManager) reportForcedPurges(job *retentionJob, log bark.Logger) {
+
+	for _, cg := range job.forcedPurgeCGs {
+
+		cgTagValue, err := common.GetTagsFromPath(cg.name)
+		if err != nil {
+			cgTagValue = metrics.UnknownDirectoryTagValue
+		}
+
+		cgM3Client := metrics.NewClientWithTags(t.m3Client, metrics.Controller, map[string]string{
+			metrics.ConsumerGroupTagName: cgTagValue,
+		})
+		cgM3Client.IncCounter(metrics.RetentionMgrScope, metrics.ControllerRetentionForcedPurgeCounter)
+
+		log.WithFields(bark.Fields{
+			common.TagCnsm:      string(cg.id),
+			common.TagCnsPth:    cg.name,
+			`retentionAddr`:     job.retentionAddr,
+			`sizeRetentionTime`: job.sizeRetentionTime,
+		}).Warn(`retentionWorker: purged unconsumed messages to enforce max retained bytes`)
+	}
+}
+
+func (t extentsByCreatedTime) Len() int {
+	return len(t)
+}
+
+func (t extentsByCreatedTime) Less(i, j int) bool {
+	return t[i].createdTime.Before(t[j].createdTime)
+}
+
+func (t extentsByCreatedTime) Swap(i, j int) {
+	t[i], t[j] = t[j], t[i]
+}
+
+// recordDecision remembers the decision taken on an extent, for Explain
+func (t *RetentionManager) recordDecision(job *retentionJob) {
+
+	t.decisionsLock.Lock()
+	defer t.decisionsLock.Unlock()
+
+	t.decisions[job.ext.id] = newExtentRetention(job)
+}
+
+// pruneDecisions forgets the decisions on extents that were not seen in a while
+func (t *RetentionManager) pruneDecisions() {
+
+	t.decisionsLock.Lock()
+	defer t.decisionsLock.Unlock()
+
+	for id, d := range t.decisions {
+		if time.Since(d.Time) > lastDecisionTTL {
+			delete(t.decisions, id)
+		}
+	}
+}
+
 // runRetention finds the list of destinations, extents and consumer-groups and
 // schedules a job, one per extent, to compute and enforce retention on storage.
-func (t *RetentionManager) runRetention(jobsC chan<- *retentionJob) bool {
+// A run that is not a full sweep only schedules the extents that changed.
+func (t *RetentionManager) runRetention(jobsC chan<- *retentionJob, full bool) bool {
+
+	t.logger.WithField(`full`, full).Debug("runRetention: start")
 
-	t.logger.Debug("runRetention: start")
+	runStartTime := time.Now()
 
-	destList := t.metadata.GetDestinations()
+	t.pruneDecisions()
+
+	var destList []*destinationInfo
+
+	if full {
+		t.sweep++
+		t.metadata.ResetRetentionOverrides()
+		t.takeSignals() // covered by the sweep
+		destList = t.metadata.GetDestinations()
+	} else {
+		destList = t.changedDestinations()
+	}
+
+	// the mode is picked once for the whole run
+	dryRun := t.IsDryRun()
 
 	// shuffle list of destinations (ie, randomize order each time)
 	for i := len(destList); i > 0; i-- {
@@ -303,7 +707,7 @@ func (t *RetentionManager) runRetention(jobsC chan<- *retentionJob) bool {
 		time.Now().Sub(t.lastDLQRetentionRun) < t.Options.DLQRetentionInterval
 
 	// estimate the number of retention jobs, we'll be scheduling
-	var totalJobs int64
+	var totalJobs, skippedJobs int64
 
 	// populate each destination-info with extents and consumer-groups information
 	for i := range destList {
@@ -318,8 +722,16 @@ func (t *RetentionManager) runRetention(jobsC chan<- *retentionJob) bool {
 			continue
 		}
 
-		// query extents for the destination
-		dest.extents = t.metadata.GetExtents(dest.id)
+		if full {
+			// query extents for the destination
+			dest.extents = t.metadata.GetExtents(dest.id)
+
+			t.computeSizeRetention(dest, t.logger.WithField(common.TagDst, string(dest.id)))
+
+			// the full sweeps also record the consumer groups, so that the
+			// next incremental run does not see them all as changed
+			t.loadConsumers(dest)
+		}
 
 		// TODO: shuffle list of extents?
 
@@ -329,6 +741,7 @@ func (t *RetentionManager) runRetention(jobsC chan<- *retentionJob) bool {
 		for j := range dest.extents {
 
 			if dest.extents[j].status == shared.ExtentStatus_DELETED {
+				delete(t.tracked, dest.extents[j].id)
 				continue // skip deleted extent
 			}
 
@@ -338,13 +751,33 @@ func (t *RetentionManager) runRetention(jobsC chan<- *retentionJob) bool {
 			if dest.extents[j].status == shared.ExtentStatus_CONSUMED &&
 				time.Since(dest.extents[j].statusUpdatedTime) < t.ExtentDeleteDeferPeriod {
 
+				// recompute it once it can be deleted
+				if tr, ok := t.tracked[dest.extents[j].id]; ok {
+					tr.status = dest.extents[j].status
+					tr.statusUpdatedTime = dest.extents[j].statusUpdatedTime
+					tr.recomputeAt = dest.extents[j].statusUpdatedTime.Add(t.ExtentDeleteDeferPeriod)
+				}
+
 				continue // skip consumed extent within 'delete-defer-period'
 			}
 
+			if !full && !t.extentChanged(dest, dest.extents[j]) {
+				skippedJobs++
+				continue // skip unchanged extent
+			}
+
+			dest.extents[j].scheduled = true
 			totalJobs++
 		}
 
-		if allExtentsDeleted && dest.status == shared.DestinationStatus_DELETING {
+		// the extents that were not read could still be there
+		if allExtentsDeleted && !dest.partial && dest.status == shared.DestinationStatus_DELETING {
+
+			if dryRun {
+				t.logger.WithField(common.TagDst, dest.id).
+					Info("dry run: would delete destination (all extents deleted)")
+				continue
+			}
 
 			t.logger.WithField(common.TagDst, dest.id).
 				Info("deleting destination (all extents deleted)")
@@ -362,10 +795,28 @@ func (t *RetentionManager) runRetention(jobsC chan<- *retentionJob) bool {
 		t.lastDLQRetentionRun = time.Now()
 	}
 
+	if full {
+		t.m3Client.AddCounter(metrics.RetentionMgrScope, metrics.ControllerRetentionFullSweepJobs, totalJobs)
+		t.m3Client.RecordTimer(metrics.RetentionMgrScope, metrics.ControllerRetentionFullSweepDuration, time.Since(runStartTime))
+	} else {
+		t.m3Client.AddCounter(metrics.RetentionMgrScope, metrics.ControllerRetentionIncrementalJobs, totalJobs)
+		t.m3Client.AddCounter(metrics.RetentionMgrScope, metrics.ControllerRetentionIncrementalSkipped, skippedJobs)
+		t.m3Client.RecordTimer(metrics.RetentionMgrScope, metrics.ControllerRetentionIncrementalDuration, time.Since(runStartTime))
+	}
+
+	t.logger.WithFields(bark.Fields{
+		`full`:        full,
+		`totalJobs`:   totalJobs,
+		`skippedJobs`: skippedJobs,
+	}).Info("runRetention: scheduling jobs")
+
 	// compute the time until when retention would run next to help pre-schedule the jobs
 	// so that they are distributed more or less evenly during the retention-interval
 
 	if totalJobs == 0 {
+		if full {
+			t.pruneTracked(destList)
+		}
 		t.logger.Debug("runRetention: done (nothing to do)")
 		return true
 	}
@@ -420,6 +871,10 @@ func (t *RetentionManager) runRetention(jobsC chan<- *retentionJob) bool {
 				continue
 			}
 
+			if !dest.extents[j].scheduled {
+				continue // unchanged since it was last scheduled
+			}
+
 			t.logger.WithFields(bark.Fields{
 				common.TagDst: dest.id,
 				common.TagExt: dest.extents[j],
@@ -428,27 +883,301 @@ func (t *RetentionManager) runRetention(jobsC chan<- *retentionJob) bool {
 
 			// create and post a job to process this extent on the destination
 			jobsC <- &retentionJob{
-				runAt:         scheduleAt,
-				dest:          dest,
-				ext:           dest.extents[j],
-				retentionAddr: int64(store.ADDR_BEGIN),
+				runAt:             scheduleAt,
+				dest:              dest,
+				ext:               dest.extents[j],
+				retentionAddr:     int64(store.ADDR_BEGIN),
+				dryRun:            dryRun,
+				sizeRetentionTime: dest.extents[j].sizeRetentionTime,
 			}
 
+			t.track(dest, dest.extents[j], scheduleAt)
+
 			// schedule next job after 'durationPerJob'
 			scheduleAt = scheduleAt.Add(durationPerJob)
 		}
 	}
 
+	if full {
+		t.pruneTracked(destList)
+	}
+
 	t.logger.WithField(`totalJobs`, totalJobs).Debug("runRetention: done")
 
 	return true
 }
 
+// changedDestinations gets the destinations to look at in an incremental run,
+// without listing all of them: the ones signaled as changed since the last run,
+// and the ones with extents that time alone has made due for a recompute. The
+// destinations that are due, signaled as a whole, or subject to size retention
+// get all their extents listed; the others only get the extents signaled.
+func (t *RetentionManager) changedDestinations() []*destinationInfo {
+
+	signals := t.takeSignals()
+
+	now := time.Now()
+
+	for _, tr := range t.tracked {
+
+		if now.Before(tr.recomputeAt) {
+			continue
+		}
+
+		sig, ok := signals[tr.destID]
+		if !ok {
+			sig = &changeSignals{extents: make(map[extentID]bool)}
+			signals[tr.destID] = sig
+		}
+
+		sig.list = true
+	}
+
+	destList := make([]*destinationInfo, 0, len(signals))
+
+	for destID, sig := range signals {
+
+		dest, err := t.metadata.GetDestination(destID)
+		if err != nil {
+			continue // left to the next full sweep
+		}
+
+		log := t.logger.WithField(common.TagDst, string(dest.id))
+
+		if sig.all || sig.list || t.maxRetainedBytes(dest) > 0 {
+
+			dest.extents = t.metadata.GetExtents(dest.id)
+
+			t.computeSizeRetention(dest, log)
+
+			t.loadConsumers(dest)
+			dest.consumersChanged = dest.consumersChanged || sig.all
+
+		} else {
+
+			dest.partial = true
+
+			for extID := range sig.extents {
+
+				ext, err := t.metadata.GetExtentInfo(dest.id, extID)
+				if err != nil {
+					continue // left to the next full sweep
+				}
+
+				dest.extents = append(dest.extents, ext)
+			}
+		}
+
+		for _, ext := range dest.extents {
+			ext.signaled = sig.extents[ext.id]
+		}
+
+		destList = append(destList, dest)
+	}
+
+	return destList
+}
+
+// loadConsumers gets the consumer groups of a destination, to find out if
+// they changed since the last time the destination was looked at
+func (t *RetentionManager) loadConsumers(dest *destinationInfo) {
+
+	consumers := t.metadata.GetConsumerGroups(dest.id)
+
+	// a consumer group that was created, deleted or changed state
+	// can change the retention of every extent of the destination
+	signature := consumersSignature(consumers)
+	dest.consumersChanged = t.trackedConsumers[dest.id] != signature
+	t.trackedConsumers[dest.id] = signature
+}
+
+// extentChanged checks if the retention of an extent needs to be recomputed in
+// an incremental run: if it is new, if it was signaled as changed, if its state
+// or its consumers changed, if it is subject to size retention or if time has
+// moved its retention far enough
+func (t *RetentionManager) extentChanged(dest *destinationInfo, ext *extentInfo) bool {
+
+	tr, ok := t.tracked[ext.id]
+
+	switch {
+	case !ok, ext.signaled, dest.consumersChanged, ext.sizeRetentionTime > 0:
+		return true
+
+	case tr.status != ext.status,
+		!tr.statusUpdatedTime.Equal(ext.statusUpdatedTime),
+		tr.replicas != len(ext.storehosts):
+		return true
+
+	case !time.Now().Before(tr.recomputeAt):
+		return true
+	}
+
+	return false
+}
+
+// recomputeInterval is how often the incremental runs recompute an extent that
+// did not change, since time alone moves its hard and soft retention forward;
+// it is a fraction of the shorter retention period of the destination
+func (t *RetentionManager) recomputeInterval(dest *destinationInfo) time.Duration {
+
+	retention := dest.hardRetention
+	if dest.softRetention < retention {
+		retention = dest.softRetention
+	}
+
+	interval := time.Duration(retention) * time.Second / 4
+
+	if interval < t.RetentionInterval {
+		interval = t.RetentionInterval
+	}
+
+	if t.FullSweepInterval > 0 && interval > t.FullSweepInterval {
+		interval = t.FullSweepInterval
+	}
+
+	return interval
+}
+
+// track records the state of an extent that is being scheduled
+func (t *RetentionManager) track(dest *destinationInfo, ext *extentInfo, scheduleAt time.Time) {
+
+	t.tracked[ext.id] = &extentTrack{
+		destID:            dest.id,
+		status:            ext.status,
+		statusUpdatedTime: ext.statusUpdatedTime,
+		replicas:          len(ext.storehosts),
+		recomputeAt:       scheduleAt.Add(t.recomputeInterval(dest)),
+		sweep:             t.sweep,
+	}
+}
+
+// ExtentChanged signals that the retention of an extent needs to be recomputed,
+// because it changed state or one of its consumer groups acked on it
+func (t *RetentionManager) ExtentChanged(destID, extID string) {
+	t.signalExtent(destinationID(destID), extentID(extID))
+}
+
+// DestinationChanged signals that the retention of all the extents of a
+// destination needs to be recomputed, because the destination or one of
+// its consumer groups was created, updated or deleted
+func (t *RetentionManager) DestinationChanged(destID string) {
+
+	t.signalsLock.Lock()
+	defer t.signalsLock.Unlock()
+
+	if sig := t.signal(destinationID(destID)); sig != nil {
+		sig.all = true
+	}
+}
+
+func (t *RetentionManager) signalExtent(destID destinationID, extID extentID) {
+
+	t.signalsLock.Lock()
+	defer t.signalsLock.Unlock()
+
+	if sig := t.signal(destID); sig != nil && !sig.extents[extID] {
+		sig.extents[extID] = true
+		t.numSignals++
+	}
+}
+
+// signal returns the pending signals of a destination, or nil if too many
+// changes are pending, in which case the next run is a full sweep; it is
+// called with signalsLock held
+func (t *RetentionManager) signal(destID destinationID) *changeSignals {
+
+	t.m3Client.IncCounter(metrics.RetentionMgrScope, metrics.ControllerRetentionSignals)
+
+	if t.numSignals >= maxPendingSignals {
+		t.signalsOverflow = true
+		return nil
+	}
+
+	sig, ok := t.signals[destID]
+	if !ok {
+		sig = &changeSignals{extents: make(map[extentID]bool)}
+		t.signals[destID] = sig
+		t.numSignals++
+	}
+
+	return sig
+}
+
+// takeSignals returns the changes signaled since the last run, and clears them
+func (t *RetentionManager) takeSignals() map[destinationID]*changeSignals {
+
+	t.signalsLock.Lock()
+	defer t.signalsLock.Unlock()
+
+	signals := t.signals
+
+	t.signals = make(map[destinationID]*changeSignals)
+	t.numSignals = 0
+	t.signalsOverflow = false
+
+	return signals
+}
+
+// signalsOverflowed checks if more changes were signaled than can be tracked
+func (t *RetentionManager) signalsOverflowed() bool {
+
+	t.signalsLock.Lock()
+	defer t.signalsLock.Unlock()
+
+	return t.signalsOverflow
+}
+
+// pruneTracked forgets the extents and destinations that a full sweep did not see
+func (t *RetentionManager) pruneTracked(destList []*destinationInfo) {
+
+	dests := make(map[destinationID]bool, len(destList))
+	for _, dest := range destList {
+		if dest.status != shared.DestinationStatus_DELETED {
+			dests[dest.id] = true
+		}
+	}
+
+	for id := range t.trackedConsumers {
+		if !dests[id] {
+			delete(t.trackedConsumers, id)
+		}
+	}
+
+	for id, tr := range t.tracked {
+		if tr.sweep != t.sweep {
+			delete(t.tracked, id)
+		}
+	}
+}
+
+// consumersSignature summarizes the consumer groups of a destination and their
+// state, including their retention overrides and whether they are inactive
+func consumersSignature(consumers []*consumerGroupInfo) string {
+
+	now := time.Now()
+
+	sigs := make([]string, 0, len(consumers))
+	for _, cg := range consumers {
+		sigs = append(sigs, fmt.Sprintf("%v:%v:%v:%v", cg.id, cg.status, cg.protect, cg.isInactive(now)))
+	}
+
+	sort.Strings(sigs)
+	return strings.Join(sigs, ",")
+}
+
+// isInactive checks if the consumer group is to be excluded from soft
+// retention, for not having acked anything for long enough
+func (cg *consumerGroupInfo) isInactive(now time.Time) bool {
+	return cg.excludeAfterInactive > 0 && !cg.protect && now.Sub(cg.lastActiveTime) >= cg.excludeAfterInactive
+}
+
 func (t *RetentionManager) computeRetention(job *retentionJob, log bark.Logger) {
 
 	dest := job.dest
 	ext := job.ext
 
+	job.decision = DecisionNone
+
 	if ext.status == shared.ExtentStatus_CONSUMED {
 
 		// keep extent in "consumed" state until 'ExtentDeleteDeferPeriod' has
@@ -458,6 +1187,7 @@ func (t *RetentionManager) computeRetention(job *retentionJob, log bark.Logger)
 		if time.Since(ext.statusUpdatedTime) >= t.ExtentDeleteDeferPeriod {
 			job.retentionAddr = store.ADDR_SEAL // delete extent from the stores
 			job.deleteExtent = true             // delete extent from metadata
+			job.decision = DecisionDelete
 		}
 		return
 	}
@@ -479,6 +1209,17 @@ func (t *RetentionManager) computeRetention(job *retentionJob, log bark.Logger)
 		if !pendingCGDelete {
 			job.retentionAddr = store.ADDR_SEAL
 			job.deleteExtent = true
+			job.decision = DecisionDelete
+			return
+		}
+	}
+
+	// a consumer group whose retention override could not be read could be
+	// protected, or not excluded; skip the extent until it can be read
+	for _, cgInfo := range job.consumers {
+		if cgInfo.overrideUnknown && cgInfo.status != shared.ConsumerGroupStatus_DELETED {
+			log.WithField(common.TagCnsmID, string(cgInfo.id)).Warn(`computeRetention: retention override of consumer group unknown; skipping extent`)
+			job.retentionAddr = store.ADDR_BEGIN
 			return
 		}
 	}
@@ -499,6 +1240,20 @@ func (t *RetentionManager) computeRetention(job *retentionJob, log bark.Logger)
 		}).Debug(`computeRetention: overriding retention times for DLQ merged extent`)
 	}
 
+	// size retention moves the hard retention forward, to purge the oldest
+	// messages of a destination that has grown past its max retained bytes
+	if job.sizeRetentionTime > hardRetentionTime {
+
+		hardRetentionTime = job.sizeRetentionTime
+		if hardRetentionTime > tNow {
+			hardRetentionTime = tNow
+		}
+
+		job.sizeRetention = true
+
+		log.WithField(`hardRetentionTime`, hardRetentionTime).Info(`computeRetention: hard retention overridden by size retention`)
+	}
+
 	// -- step 2: compute hard-retention address, by querying storehosts -- //
 
 	// find the 'hardRetentionAddr' that corresponds to the 'hardRetentionTime'
@@ -609,6 +1364,9 @@ func (t *RetentionManager) computeRetention(job *retentionJob, log bark.Logger)
 		softRetentionAddr = int64(store.ADDR_BEGIN)
 	}
 
+	job.hardRetentionAddr = hardRetentionAddr
+	job.softRetentionAddr = softRetentionAddr
+
 	log.WithFields(bark.Fields{
 		`softRetentionAddr`:      softRetentionAddr,
 		`softRetentionAddr_time`: time.Unix(0, softRetentionAddr),
@@ -620,6 +1378,10 @@ func (t *RetentionManager) computeRetention(job *retentionJob, log bark.Logger)
 	log.Debug("computing minAckAddr")
 
 	var minAckAddr = int64(store.ADDR_END)
+	var minAckCG consumerGroupID
+
+	// ack levels of the consumers, to find the ones that size retention purges past
+	ackAddrs := make(map[consumerGroupID]int64, len(job.consumers))
 
 	for _, cgInfo := range job.consumers {
 
@@ -638,6 +1400,19 @@ func (t *RetentionManager) computeRetention(job *retentionJob, log bark.Logger)
 			log.Debug("calculating minAckAddr for DLQ merged extent")
 		}
 
+		// an abandoned consumer group would otherwise hold back the
+		// messages until hard retention, for all the other consumers
+		if cgInfo.isInactive(time.Unix(0, tNow)) {
+
+			log.WithFields(bark.Fields{
+				common.TagCnsmID: cgInfo.id,
+				`lastActiveTime`: cgInfo.lastActiveTime,
+			}).Debug(`computeRetention: inactive consumer group excluded from minAckAddr`)
+
+			job.excludedCGs = append(job.excludedCGs, cgInfo)
+			continue
+		}
+
 		ackAddr, err := t.metadata.GetAckLevel(dest.id, ext.id, cgInfo.id)
 
 		if err != nil {
@@ -649,18 +1424,34 @@ func (t *RetentionManager) computeRetention(job *retentionJob, log bark.Logger)
 			}).Error(`computeRetention: minAckAddr GetAckLevel failed`)
 
 			minAckAddr = store.ADDR_BEGIN
+			minAckCG = cgInfo.id
 			break
 		}
 
+		ackAddrs[cgInfo.id] = ackAddr
+
 		// update minAckAddr, if ackAddr is less than the current value
 		if (minAckAddr == store.ADDR_END) ||
 			(minAckAddr == store.ADDR_SEAL) || // -> all existing consumers have completely consumed this extent
 			(ackAddr != store.ADDR_SEAL && ackAddr < minAckAddr) {
 
 			minAckAddr = ackAddr
+			minAckCG = cgInfo.id
 		}
 	}
 
+	// when the only consumers left are inactive, soft retention applies
+	// as if they had consumed the whole extent
+	if minAckAddr == store.ADDR_END && len(job.excludedCGs) > 0 {
+		log.Debug("all consumer groups are inactive, using 'ADDR_SEAL'")
+		minAckAddr = store.ADDR_SEAL
+	}
+
+	// when all consumers are done with the extent, none of them holds it back
+	if minAckAddr == store.ADDR_SEAL {
+		minAckCG = ""
+	}
+
 	// if we were unable to find any consumer groups, set minAckAddr to ADDR_BEGIN
 	if minAckAddr == store.ADDR_END {
 		log.Debug("could not compute ackLevel, using 'ADDR_BEGIN'")
@@ -668,10 +1459,12 @@ func (t *RetentionManager) computeRetention(job *retentionJob, log bark.Logger)
 	}
 
 	job.minAckAddr = minAckAddr // remember the minAckAddr for doing checks later
+	job.minAckCG = minAckCG
 
 	log.WithFields(bark.Fields{
 		`minAckAddr`:      minAckAddr,
 		`minAckAddr_time`: time.Unix(0, minAckAddr),
+		common.TagCnsmID:  minAckCG,
 	}).Debug("computed minAckAddr")
 
 	// -- step 5: compute retention address -- //
@@ -694,6 +1487,31 @@ func (t *RetentionManager) computeRetention(job *retentionJob, log bark.Logger)
 		`minAckAddr`:        minAckAddr,
 	}).Debug("computed retentionAddr")
 
+	// a protected consumer group keeps the messages it has not acked yet,
+	// over the hard retention and size retention of the destination
+	t.applyProtection(job, ackAddrs, log)
+
+	if job.retentionAddr != store.ADDR_BEGIN {
+		job.decision = DecisionPurge
+	}
+
+	// when the retention address was set by size retention, every consumer
+	// that had not yet acked until it loses the messages in between
+	if job.sizeRetention && job.retentionAddr == hardRetentionAddr && job.retentionAddr != store.ADDR_BEGIN {
+
+		for _, cgInfo := range job.consumers {
+
+			ackAddr, ok := ackAddrs[cgInfo.id]
+			if !ok || ackAddr == store.ADDR_SEAL {
+				continue
+			}
+
+			if job.retentionAddr == store.ADDR_SEAL || ackAddr < job.retentionAddr {
+				job.forcedPurgeCGs = append(job.forcedPurgeCGs, cgInfo)
+			}
+		}
+	}
+
 	// -- step 6: check to see if the extent status can be updated to 'consumed' -- //
 
 	// move the extent to 'consumed' if either:
@@ -706,12 +1524,21 @@ func (t *RetentionManager) computeRetention(job *retentionJob, log bark.Logger)
 	// B. or, the hard-retention has reached the end of the sealed extent,
 	// 	in which case we will force the extent to be "consumed"
 	// NB: retentionAddr == ADDR_BEGIN indicates there was an error, so we no-op
-	if job.retentionAddr != store.ADDR_BEGIN &&
+	// NB: a protected consumer group that has not read to the end of the
+	// extent keeps it from being "consumed", even by hard retention
+	if job.retentionAddr != store.ADDR_BEGIN && len(job.protectCG) == 0 &&
 		((ext.status == shared.ExtentStatus_SEALED &&
 			minAckAddr == store.ADDR_SEAL &&
 			softRetentionConsumed) ||
 			hardRetentionConsumed) {
 
+		job.decision = DecisionMarkConsumed
+
+		if job.dryRun {
+			log.WithField(`retentionAddr`, job.retentionAddr).Debug("computeRetention: dry run; not marking extent consumed")
+			return
+		}
+
 		log.WithFields(bark.Fields{
 			`retentionAddr`:         job.retentionAddr,
 			`extent-status`:         ext.status,
@@ -724,6 +1551,54 @@ func (t *RetentionManager) computeRetention(job *retentionJob, log bark.Logger)
 
 		if e != nil {
 			log.WithField(common.TagErr, job.err).Error("computeRetention: error marking extent consumed")
+		} else {
+			t.signalExtent(dest.id, ext.id) // to have it deleted after the defer period
+		}
+	}
+}
+
+// applyProtection lowers the retention address of the job to the ack level
+// of the slowest protected consumer group, if it would purge messages that
+// consumer group has not acked yet
+func (t *RetentionManager) applyProtection(job *retentionJob, ackAddrs map[consumerGroupID]int64, log bark.Logger) {
+
+	for _, cgInfo := range job.consumers {
+
+		if !cgInfo.protect || cgInfo.status == shared.ConsumerGroupStatus_DELETED {
+			continue
+		}
+
+		if len(job.ext.singleCGVisibility) > 0 && cgInfo.id != job.ext.singleCGVisibility {
+			continue
+		}
+
+		ackAddr, ok := ackAddrs[cgInfo.id]
+		if !ok {
+			var err error
+			if ackAddr, err = t.metadata.GetAckLevel(job.dest.id, job.ext.id, cgInfo.id); err != nil {
+				// purge nothing, rather than what it may not have acked
+				log.WithFields(bark.Fields{
+					common.TagCnsmID: cgInfo.id,
+					common.TagErr:    err,
+				}).Error(`computeRetention: protected consumer group GetAckLevel failed`)
+				ackAddr = store.ADDR_BEGIN
+			}
+		}
+
+		if ackAddr == store.ADDR_SEAL {
+			continue // done with the extent
+		}
+
+		if job.retentionAddr == store.ADDR_SEAL || ackAddr < job.retentionAddr {
+
+			log.WithFields(bark.Fields{
+				common.TagCnsmID: cgInfo.id,
+				`retentionAddr`:  job.retentionAddr,
+				`ackAddr`:        ackAddr,
+			}).Info(`computeRetention: retention address held back by protected consumer group`)
+
+			job.retentionAddr = ackAddr
+			job.protectCG = cgInfo.id
 		}
 	}
 }
@@ -787,7 +1662,18 @@ workerLoop:
 		// get consumer groups for the destination
 		job.consumers = t.metadata.GetConsumerGroups(dest.id)
 
-		if t.computeRetention(job, log); job.retentionAddr != store.ADDR_BEGIN {
+		if t.computeRetention(job, log); job.dryRun {
+
+			log.WithFields(bark.Fields{
+				`hardRetentionAddr`: job.hardRetentionAddr,
+				`softRetentionAddr`: job.softRetentionAddr,
+				`minAckAddr`:        job.minAckAddr,
+				common.TagCnsmID:    job.minAckCG,
+				`retentionAddr`:     job.retentionAddr,
+				`decision`:          job.decision,
+			}).Info(`retentionWorker: dry run; skipping purge and delete`)
+
+		} else if job.retentionAddr != store.ADDR_BEGIN {
 
 			log.WithFields(bark.Fields{
 				`retentionAddr`: job.retentionAddr,
@@ -826,6 +1712,8 @@ workerLoop:
 				}
 			}
 
+			t.reportForcedPurges(job, log)
+
 			// -- step 9: check and move the extent to "deleted" state -- //
 
 			// if we were able to successfully purge from all storehosts, move extent to "deleted" state;
@@ -877,6 +1765,8 @@ workerLoop:
 					if e != nil {
 						job.err = e
 						log.WithField(common.TagErr, job.err).Error("retentionWorker: error marking extent deleted")
+					} else {
+						t.signalExtent(dest.id, ext.id) // to stop tracking it
 					}
 				}
 			}
@@ -898,6 +1788,8 @@ workerLoop:
 			log.Debug("retentionWorker: retentionAddr == ADDR_BEGIN; nothing to do")
 		}
 
+		t.recordDecision(job)
+
 		if job.err != nil {
 			log.WithField(common.TagErr, job.err).Error("retentionWorker: retention job failed")
 			t.m3Client.IncCounter(metrics.RetentionMgrScope, metrics.ControllerRetentionJobFailedCounter)
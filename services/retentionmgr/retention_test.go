@@ -30,6 +30,7 @@ package retentionMgr
 // -
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -351,6 +352,8 @@ func (s *RetentionMgrSuite) TestRetentionManager() {
 
 	var retMgr *RetentionManager
 
+	s.metadata.On("ResetRetentionOverrides").Return()
+
 	opts := &Options{NumWorkers: 3, RetentionInterval: 5 * time.Second, ExtentDeleteDeferPeriod: 1 * time.Hour, LocalZone: `zone1`}
 
 	metricsClient := metrics.NewClient(common.NewMetricReporterWithHostname(configure.NewCommonServiceConfig()), metrics.Controller)
@@ -427,9 +430,428 @@ func (s *RetentionMgrSuite) TestRetentionManagerOnDeletedDestinations() {
 
 	var retMgr *RetentionManager
 
+	s.metadata.On("ResetRetentionOverrides").Return()
+
 	opts := &Options{NumWorkers: 3, RetentionInterval: 5 * time.Second, LocalZone: `zone1`}
 
 	metricsClient := metrics.NewClient(common.NewMetricReporterWithHostname(configure.NewCommonServiceConfig()), metrics.Controller)
 	retMgr = tNew(opts, s.metadata, s.storehost, metricsClient, common.GetDefaultLogger())
 	retMgr.Run()
 }
+
+func (s *RetentionMgrSuite) TestRetentionManagerDryRun() {
+
+	// Test cases
+	// DEST1,EXT1: destination being deleted, all consumer groups deleted -> would delete, but only recorded
+
+	destinations := []*destinationInfo{
+		{id: "DEST1", status: shared.DestinationStatus_DELETING},
+	}
+
+	consumerGroups := []*consumerGroupInfo{
+		{id: "CG1", status: shared.ConsumerGroupStatus_DELETED},
+	}
+
+	extents := []*extentInfo{
+		{
+			id:         "EXT1",
+			status:     shared.ExtentStatus_SEALED,
+			storehosts: []storehostID{"STOR1", "STOR2", "STOR3"},
+		},
+	}
+
+	s.metadata.On("GetDestinations").Return(destinations).Once()
+	s.metadata.On("GetExtents", destinationID("DEST1")).Return(extents).Once()
+	s.metadata.On("GetExtentInfo", destinationID("DEST1"), extentID("EXT1")).Return(extents[0], nil).Once()
+	s.metadata.On("GetConsumerGroups", destinationID("DEST1")).Return(consumerGroups)
+
+	// no PurgeMessages, DeleteConsumerGroupExtent or DeleteExtent expected
+
+	s.metadata.On("ResetRetentionOverrides").Return()
+
+	opts := &Options{NumWorkers: 1, RetentionInterval: 5 * time.Second, LocalZone: `zone1`, DryRun: true}
+
+	metricsClient := metrics.NewClient(common.NewMetricReporterWithHostname(configure.NewCommonServiceConfig()), metrics.Controller)
+	retMgr := tNew(opts, s.metadata, s.storehost, metricsClient, common.GetDefaultLogger())
+	s.True(retMgr.IsDryRun())
+	retMgr.Run()
+
+	s.metadata.AssertExpectations(s.T())
+	s.storehost.AssertNotCalled(s.T(), "PurgeMessages", mock.Anything, mock.Anything, mock.Anything)
+
+	last := retMgr.decisions["EXT1"]
+	s.NotNil(last)
+	s.Equal(DecisionDelete, last.Decision)
+	s.Equal(int64(store.ADDR_SEAL), last.RetentionAddr)
+	s.True(last.DryRun)
+}
+
+func (s *RetentionMgrSuite) TestRetentionManagerExplain() {
+
+	// Test cases
+	// DEST1,EXT1: hardRetentionAddr < minAckAddr < softRetentionAddr -> purge until minAckAddr, held back by CG1
+	// DEST1,EXT2: hard retention reached the end of the sealed extent -> mark consumed, but only explained
+
+	dest := &destinationInfo{id: "DEST1", status: shared.DestinationStatus_ENABLED, softRetention: 10, hardRetention: 20}
+
+	consumerGroups := []*consumerGroupInfo{
+		{id: "CG1", status: shared.ConsumerGroupStatus_ENABLED},
+		{id: "CG2", status: shared.ConsumerGroupStatus_ENABLED},
+		{id: "CG3", status: shared.ConsumerGroupStatus_DELETED},
+	}
+
+	extents := []*extentInfo{
+		{id: "EXT1", status: shared.ExtentStatus_OPEN, storehosts: []storehostID{"STOR1"}},
+		{id: "EXT2", status: shared.ExtentStatus_SEALED, storehosts: []storehostID{"STOR1"}},
+		{id: "EXT3", status: shared.ExtentStatus_DELETED, storehosts: []storehostID{"STOR1"}},
+	}
+
+	s.metadata.On("GetDestination", destinationID("DEST1")).Return(dest, nil).Once()
+	s.metadata.On("GetExtents", destinationID("DEST1")).Return(extents).Once()
+	s.metadata.On("GetConsumerGroups", destinationID("DEST1")).Return(consumerGroups).Once()
+
+	// hard retention is queried first, then soft retention
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT1"), mock.AnythingOfType("int64")).Return(int64(100), false, nil).Once()
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT1"), mock.AnythingOfType("int64")).Return(int64(300), false, nil).Once()
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT2"), mock.AnythingOfType("int64")).Return(int64(store.ADDR_SEAL), true, nil).Once()
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT2"), mock.AnythingOfType("int64")).Return(int64(300), false, nil).Once()
+
+	for _, ext := range []extentID{"EXT1", "EXT2"} {
+		s.metadata.On("GetAckLevel", destinationID("DEST1"), ext, consumerGroupID("CG1")).Return(int64(200), nil).Once()
+		s.metadata.On("GetAckLevel", destinationID("DEST1"), ext, consumerGroupID("CG2")).Return(int64(250), nil).Once()
+	}
+
+	opts := &Options{NumWorkers: 1, LocalZone: `zone1`}
+
+	metricsClient := metrics.NewClient(common.NewMetricReporterWithHostname(configure.NewCommonServiceConfig()), metrics.Controller)
+	retMgr := tNew(opts, s.metadata, s.storehost, metricsClient, common.GetDefaultLogger())
+
+	result, err := retMgr.Explain("DEST1")
+	s.NoError(err)
+	s.Len(result, 2)
+
+	s.Equal("EXT1", result[0].ExtentUUID)
+	s.Equal(int64(100), result[0].HardRetentionAddr)
+	s.Equal(int64(300), result[0].SoftRetentionAddr)
+	s.Equal(int64(200), result[0].MinAckAddr)
+	s.Equal("CG1", result[0].MinAckConsumerGroupUUID)
+	s.Equal(int64(200), result[0].RetentionAddr)
+	s.Equal(DecisionPurge, result[0].Decision)
+	s.True(result[0].DryRun)
+	s.Nil(result[0].Last)
+
+	s.Equal("EXT2", result[1].ExtentUUID)
+	s.Equal(int64(store.ADDR_SEAL), result[1].RetentionAddr)
+	s.Equal(DecisionMarkConsumed, result[1].Decision)
+
+	s.metadata.AssertExpectations(s.T())
+	s.metadata.AssertNotCalled(s.T(), "MarkExtentConsumed", mock.Anything, mock.Anything)
+	s.storehost.AssertNotCalled(s.T(), "PurgeMessages", mock.Anything, mock.Anything, mock.Anything)
+
+	// unknown destinations are reported as errors
+	s.metadata.On("GetDestination", destinationID("DEST2")).Return(nil, shared.NewEntityNotExistsError()).Once()
+	_, err = retMgr.Explain("DEST2")
+	s.Error(err)
+}
+
+func (s *RetentionMgrSuite) TestRetentionManagerConsumerGroupOverrides() {
+
+	// Test cases (CG2 is inactive and excluded, CG3 is protected)
+	// DEST1,EXT1: CG2 acked the least, but is left out -> purge until the ack of CG1
+	// DEST1,EXT2: hard retention reached the end of the sealed extent -> held back by CG3, not consumed
+	// DEST2,EXT3: the only consumer group is inactive -> soft retention applies, extent consumed
+
+	dest1 := &destinationInfo{id: "DEST1", status: shared.DestinationStatus_ENABLED, softRetention: 10, hardRetention: 20}
+	dest2 := &destinationInfo{id: "DEST2", status: shared.DestinationStatus_ENABLED, softRetention: 10, hardRetention: 20}
+
+	inactive := &consumerGroupInfo{
+		id:                   "CG2",
+		status:               shared.ConsumerGroupStatus_ENABLED,
+		excludeAfterInactive: time.Hour,
+		lastActiveTime:       time.Now().Add(-2 * time.Hour),
+	}
+
+	consumerGroups := []*consumerGroupInfo{
+		{id: "CG1", status: shared.ConsumerGroupStatus_ENABLED},
+		inactive,
+		{id: "CG3", status: shared.ConsumerGroupStatus_ENABLED, protect: true},
+	}
+
+	s.metadata.On("GetDestination", destinationID("DEST1")).Return(dest1, nil).Once()
+	s.metadata.On("GetExtents", destinationID("DEST1")).Return([]*extentInfo{
+		{id: "EXT1", status: shared.ExtentStatus_OPEN, storehosts: []storehostID{"STOR1"}},
+		{id: "EXT2", status: shared.ExtentStatus_SEALED, storehosts: []storehostID{"STOR1"}},
+	}).Once()
+	s.metadata.On("GetConsumerGroups", destinationID("DEST1")).Return(consumerGroups).Once()
+
+	// hard retention is queried first, then soft retention
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT1"), mock.AnythingOfType("int64")).Return(int64(100), false, nil).Once()
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT1"), mock.AnythingOfType("int64")).Return(int64(300), false, nil).Once()
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT2"), mock.AnythingOfType("int64")).Return(int64(store.ADDR_SEAL), true, nil).Once()
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT2"), mock.AnythingOfType("int64")).Return(int64(300), false, nil).Once()
+
+	// no ack levels are read for CG2
+	s.metadata.On("GetAckLevel", destinationID("DEST1"), extentID("EXT1"), consumerGroupID("CG1")).Return(int64(200), nil).Once()
+	s.metadata.On("GetAckLevel", destinationID("DEST1"), extentID("EXT1"), consumerGroupID("CG3")).Return(int64(250), nil).Once()
+	s.metadata.On("GetAckLevel", destinationID("DEST1"), extentID("EXT2"), consumerGroupID("CG1")).Return(int64(store.ADDR_SEAL), nil).Once()
+	s.metadata.On("GetAckLevel", destinationID("DEST1"), extentID("EXT2"), consumerGroupID("CG3")).Return(int64(150), nil).Once()
+
+	opts := &Options{NumWorkers: 1, LocalZone: `zone1`}
+
+	metricsClient := metrics.NewClient(common.NewMetricReporterWithHostname(configure.NewCommonServiceConfig()), metrics.Controller)
+	retMgr := tNew(opts, s.metadata, s.storehost, metricsClient, common.GetDefaultLogger())
+
+	result, err := retMgr.Explain("DEST1")
+	s.NoError(err)
+	s.Len(result, 2)
+
+	s.Equal("EXT1", result[0].ExtentUUID)
+	s.Equal(int64(200), result[0].MinAckAddr)
+	s.Equal("CG1", result[0].MinAckConsumerGroupUUID)
+	s.Equal(int64(200), result[0].RetentionAddr)
+	s.Equal([]string{"CG2"}, result[0].ExcludedConsumerGroupUUIDs)
+	s.Equal("", result[0].ProtectedByConsumerGroupUUID)
+	s.Equal(DecisionPurge, result[0].Decision)
+
+	s.Equal("EXT2", result[1].ExtentUUID)
+	s.Equal(int64(150), result[1].RetentionAddr)
+	s.Equal("CG3", result[1].ProtectedByConsumerGroupUUID)
+	s.Equal(DecisionPurge, result[1].Decision)
+
+	s.metadata.On("GetDestination", destinationID("DEST2")).Return(dest2, nil).Once()
+	s.metadata.On("GetExtents", destinationID("DEST2")).Return([]*extentInfo{
+		{id: "EXT3", status: shared.ExtentStatus_SEALED, storehosts: []storehostID{"STOR1"}},
+	}).Once()
+	s.metadata.On("GetConsumerGroups", destinationID("DEST2")).Return([]*consumerGroupInfo{inactive}).Once()
+
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT3"), mock.AnythingOfType("int64")).Return(int64(100), false, nil).Once()
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT3"), mock.AnythingOfType("int64")).Return(int64(store.ADDR_SEAL), true, nil).Once()
+
+	result, err = retMgr.Explain("DEST2")
+	s.NoError(err)
+	s.Len(result, 1)
+
+	s.Equal(int64(store.ADDR_SEAL), result[0].MinAckAddr)
+	s.Equal(int64(store.ADDR_SEAL), result[0].RetentionAddr)
+	s.Equal(DecisionMarkConsumed, result[0].Decision)
+
+	s.metadata.AssertExpectations(s.T())
+	s.storehost.AssertExpectations(s.T())
+	s.metadata.AssertNotCalled(s.T(), "GetAckLevel", mock.Anything, mock.Anything, consumerGroupID("CG2"))
+
+	// a consumer group is only excluded once it has been inactive long enough
+	s.False((&consumerGroupInfo{excludeAfterInactive: time.Hour, lastActiveTime: time.Now()}).isInactive(time.Now()))
+	s.True(inactive.isInactive(time.Now()))
+	s.False((&consumerGroupInfo{lastActiveTime: time.Now().Add(-2 * time.Hour)}).isInactive(time.Now()))
+
+	// the retention of a destination is skipped while the override of one of
+	// its consumer groups can't be read, since it could be protected
+	dest3 := &destinationInfo{id: "DEST3", status: shared.DestinationStatus_ENABLED, softRetention: 10, hardRetention: 20}
+	s.metadata.On("GetDestination", destinationID("DEST3")).Return(dest3, nil).Once()
+	s.metadata.On("GetExtents", destinationID("DEST3")).Return([]*extentInfo{
+		{id: "EXT4", status: shared.ExtentStatus_SEALED, storehosts: []storehostID{"STOR1"}},
+	}).Once()
+	s.metadata.On("GetConsumerGroups", destinationID("DEST3")).Return([]*consumerGroupInfo{
+		{id: "CG1", status: shared.ConsumerGroupStatus_ENABLED},
+		{id: "CG4", status: shared.ConsumerGroupStatus_ENABLED, overrideUnknown: true},
+	}).Once()
+
+	result, err = retMgr.Explain("DEST3")
+	s.NoError(err)
+	s.Len(result, 1)
+	s.Equal(int64(store.ADDR_BEGIN), result[0].RetentionAddr)
+	s.Equal(DecisionNone, result[0].Decision)
+	s.storehost.AssertNotCalled(s.T(), "GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT4"), mock.Anything)
+}
+
+func (s *RetentionMgrSuite) TestRetentionManagerSizeRetention() {
+
+	// Test cases (max retained bytes is 150, the extents take 230)
+	// DEST1,EXT0: oldest sealed extent that fits in the excess -> purged entirely, CG1 loses messages
+	// DEST1,EXT1: sealed extent, half of it is still in excess -> purged until the middle of its life, CG1 loses messages
+	// DEST1,EXT2: newest open extent -> time based retention only
+
+	tNow := time.Now()
+	hour := time.Hour
+
+	dest := &destinationInfo{id: "DEST1", path: "/test/size", status: shared.DestinationStatus_ENABLED, softRetention: 3600, hardRetention: 86400}
+
+	consumerGroups := []*consumerGroupInfo{
+		{id: "CG1", name: "/test/size_cg1", status: shared.ConsumerGroupStatus_ENABLED},
+		{id: "CG2", name: "/test/size_cg2", status: shared.ConsumerGroupStatus_ENABLED},
+	}
+
+	extents := []*extentInfo{
+		{id: "EXT2", status: shared.ExtentStatus_OPEN, storehosts: []storehostID{"STOR1"}, createdTime: tNow.Add(-hour), sizeInBytes: 100},
+		{id: "EXT1", status: shared.ExtentStatus_SEALED, storehosts: []storehostID{"STOR1"}, createdTime: tNow.Add(-3 * hour), statusUpdatedTime: tNow.Add(-2 * hour), sizeInBytes: 100},
+		{id: "EXT0", status: shared.ExtentStatus_SEALED, storehosts: []storehostID{"STOR1"}, createdTime: tNow.Add(-5 * hour), statusUpdatedTime: tNow.Add(-4 * hour), sizeInBytes: 30},
+	}
+
+	s.metadata.On("GetDestination", destinationID("DEST1")).Return(dest, nil).Once()
+	s.metadata.On("GetExtents", destinationID("DEST1")).Return(extents).Once()
+	s.metadata.On("GetConsumerGroups", destinationID("DEST1")).Return(consumerGroups).Once()
+
+	// EXT1 is to be purged until the middle of its life (ie, 2.5 hours ago)
+	midEXT1 := tNow.Add(-150 * time.Minute).UnixNano()
+	nearMidEXT1 := mock.MatchedBy(func(ts int64) bool {
+		return ts > midEXT1-int64(time.Minute) && ts < midEXT1+int64(time.Minute)
+	})
+
+	// hard retention is queried first, then soft retention
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT0"), mock.AnythingOfType("int64")).Return(int64(store.ADDR_SEAL), true, nil).Once()
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT0"), mock.AnythingOfType("int64")).Return(int64(store.ADDR_SEAL), true, nil).Once()
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT1"), nearMidEXT1).Return(int64(500), false, nil).Once()
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT1"), mock.AnythingOfType("int64")).Return(int64(store.ADDR_SEAL), true, nil).Once()
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT2"), mock.AnythingOfType("int64")).Return(int64(store.ADDR_BEGIN), false, nil).Once()
+	s.storehost.On("GetAddressFromTimestamp", storehostID("STOR1"), extentID("EXT2"), mock.AnythingOfType("int64")).Return(int64(store.ADDR_BEGIN), false, nil).Once()
+
+	s.metadata.On("GetAckLevel", destinationID("DEST1"), extentID("EXT0"), consumerGroupID("CG1")).Return(int64(10), nil).Once()
+	s.metadata.On("GetAckLevel", destinationID("DEST1"), extentID("EXT0"), consumerGroupID("CG2")).Return(int64(store.ADDR_SEAL), nil).Once()
+	s.metadata.On("GetAckLevel", destinationID("DEST1"), extentID("EXT1"), consumerGroupID("CG1")).Return(int64(400), nil).Once()
+	s.metadata.On("GetAckLevel", destinationID("DEST1"), extentID("EXT1"), consumerGroupID("CG2")).Return(int64(700), nil).Once()
+	s.metadata.On("GetAckLevel", destinationID("DEST1"), extentID("EXT2"), consumerGroupID("CG1")).Return(int64(100), nil).Once()
+	s.metadata.On("GetAckLevel", destinationID("DEST1"), extentID("EXT2"), consumerGroupID("CG2")).Return(int64(100), nil).Once()
+
+	opts := &Options{
+		NumWorkers: 1,
+		LocalZone:  `zone1`,
+		MaxRetainedBytes: func(destPath string) int64 {
+			s.Equal("/test/size", destPath)
+			return 150
+		},
+	}
+
+	metricsClient := metrics.NewClient(common.NewMetricReporterWithHostname(configure.NewCommonServiceConfig()), metrics.Controller)
+	retMgr := tNew(opts, s.metadata, s.storehost, metricsClient, common.GetDefaultLogger())
+
+	result, err := retMgr.Explain("DEST1")
+	s.NoError(err)
+	s.Len(result, 3)
+
+	explained := make(map[string]*ExtentRetention)
+	for _, r := range result {
+		explained[r.ExtentUUID] = r
+	}
+
+	s.True(explained["EXT0"].SizeRetention)
+	s.Equal(int64(store.ADDR_SEAL), explained["EXT0"].RetentionAddr)
+	s.Equal(DecisionMarkConsumed, explained["EXT0"].Decision)
+	s.Equal([]string{"CG1"}, explained["EXT0"].ForcedPurgeConsumerGroupUUIDs)
+
+	s.True(explained["EXT1"].SizeRetention)
+	s.Equal(int64(500), explained["EXT1"].RetentionAddr)
+	s.Equal(DecisionPurge, explained["EXT1"].Decision)
+	s.Equal([]string{"CG1"}, explained["EXT1"].ForcedPurgeConsumerGroupUUIDs)
+
+	s.False(explained["EXT2"].SizeRetention)
+	s.Equal(DecisionNone, explained["EXT2"].Decision)
+	s.Empty(explained["EXT2"].ForcedPurgeConsumerGroupUUIDs)
+
+	s.storehost.AssertExpectations(s.T())
+}
+
+func (s *RetentionMgrSuite) TestRetentionManagerIncremental() {
+
+	// Test cases
+	// run 1: full sweep -> EXT1 and EXT2 scheduled
+	// run 2: incremental, nothing signaled -> nothing scheduled, nothing listed
+	// run 3: incremental, EXT1 signaled (acked further) -> only EXT1 read and scheduled
+	// run 4: incremental, DEST1 signaled (CG2 created) -> EXT1 and EXT2 scheduled
+	// run 5: incremental, EXT2 due for a recompute -> DEST1 listed, EXT2 scheduled
+	// run 6: full sweep, EXT1 deleted -> EXT2 scheduled, EXT1 forgotten
+
+	retention := int32(10 * 24 * 3600)
+
+	extStatus := map[extentID]shared.ExtentStatus{
+		"EXT1": shared.ExtentStatus_OPEN,
+		"EXT2": shared.ExtentStatus_OPEN,
+	}
+
+	extent := func(id extentID) *extentInfo {
+		return &extentInfo{id: id, status: extStatus[id], storehosts: []storehostID{"STOR1"}}
+	}
+
+	consumerGroups := []*consumerGroupInfo{
+		{id: "CG1", status: shared.ConsumerGroupStatus_ENABLED},
+	}
+
+	dest := func() *destinationInfo {
+		return &destinationInfo{id: "DEST1", status: shared.DestinationStatus_ENABLED, softRetention: retention, hardRetention: retention}
+	}
+
+	s.metadata.On("GetDestinations").Return(func() []*destinationInfo {
+		return []*destinationInfo{dest()}
+	})
+
+	s.metadata.On("GetDestination", destinationID("DEST1")).Return(func(destinationID) *destinationInfo {
+		return dest()
+	}, nil)
+
+	s.metadata.On("GetExtents", destinationID("DEST1")).Return(func(destinationID) []*extentInfo {
+		return []*extentInfo{extent("EXT1"), extent("EXT2")}
+	})
+
+	s.metadata.On("GetExtentInfo", destinationID("DEST1"), mock.Anything).Return(func(_ destinationID, id extentID) *extentInfo {
+		return extent(id)
+	}, nil)
+
+	s.metadata.On("GetConsumerGroups", destinationID("DEST1")).Return(func(destinationID) []*consumerGroupInfo {
+		return consumerGroups
+	})
+
+	// the retention overrides are only read again on full sweeps
+	s.metadata.On("ResetRetentionOverrides").Return().Twice()
+
+	opts := &Options{NumWorkers: 1, RetentionInterval: 10 * time.Minute, FullSweepInterval: 6 * time.Hour, LocalZone: `zone1`}
+
+	metricsClient := metrics.NewClient(common.NewMetricReporterWithHostname(configure.NewCommonServiceConfig()), metrics.Controller)
+	retMgr := tNew(opts, s.metadata, s.storehost, metricsClient, common.GetDefaultLogger())
+
+	run := func(full bool) []extentID {
+		jobsC := make(chan *retentionJob, 16)
+		s.True(retMgr.runRetention(jobsC, full))
+		close(jobsC)
+
+		var scheduled []extentID
+		for job := range jobsC {
+			scheduled = append(scheduled, job.ext.id)
+		}
+		return scheduled
+	}
+
+	s.Equal([]extentID{"EXT1", "EXT2"}, run(true))
+
+	s.Empty(run(false))
+	s.metadata.AssertNumberOfCalls(s.T(), "GetDestinations", 1)
+	s.metadata.AssertNumberOfCalls(s.T(), "GetDestination", 0)
+
+	retMgr.ExtentChanged("DEST1", "EXT1")
+	s.Equal([]extentID{"EXT1"}, run(false))
+	s.metadata.AssertNumberOfCalls(s.T(), "GetExtentInfo", 1)
+	s.metadata.AssertNumberOfCalls(s.T(), "GetExtents", 1)
+
+	consumerGroups = append(consumerGroups, &consumerGroupInfo{id: "CG2", status: shared.ConsumerGroupStatus_ENABLED})
+	retMgr.DestinationChanged("DEST1")
+	s.Equal([]extentID{"EXT1", "EXT2"}, run(false))
+	s.metadata.AssertNumberOfCalls(s.T(), "GetExtents", 2)
+
+	retMgr.tracked["EXT2"].recomputeAt = time.Now().Add(-time.Second)
+	s.Equal([]extentID{"EXT2"}, run(false))
+	s.metadata.AssertNumberOfCalls(s.T(), "GetExtents", 3)
+	s.metadata.AssertNumberOfCalls(s.T(), "GetDestinations", 1)
+
+	// the full sweep forgets the extents that are gone
+	extStatus["EXT1"] = shared.ExtentStatus_DELETED
+	s.Equal([]extentID{"EXT2"}, run(true))
+	s.Len(retMgr.tracked, 1)
+
+	s.metadata.AssertNumberOfCalls(s.T(), "ResetRetentionOverrides", 2)
+
+	// too many signals make the next run a full sweep
+	for i := 0; i <= maxPendingSignals; i++ {
+		retMgr.ExtentChanged("DEST1", fmt.Sprintf("EXT%d", i))
+	}
+	s.True(retMgr.signalsOverflowed())
+	retMgr.takeSignals()
+	s.False(retMgr.signalsOverflowed())
+}
@@ -195,6 +195,7 @@ func newTestBase(baseDir string) *testBase {
 	t.mClient.On("RegisterHostUUID", mock.Anything, mock.Anything).Return(nil)
 	t.mClient.On("UpdateStoreExtentReplicaStats", mock.Anything, mock.Anything).Return(nil)
 	t.mClient.On("ListStoreExtentsStats", mock.Anything, mock.Anything).Return(metadata.NewListStoreExtentsStatsResult_(), nil)
+	t.mClient.On("ReadStoreExtentReplicaStats", mock.Anything, mock.Anything).Return(metadata.NewReadStoreExtentReplicaStatsResult_(), nil)
 
 	return t
 }
@@ -164,6 +164,11 @@ type (
 		extMetrics *load.ExtentMetrics
 		// unix nanos when the last report happened
 		lastLoadReportedTime int64
+
+		// lag estimate of the replication job writing to
+		// this extent, nil when it is not being replicated
+		replLagLock sync.Mutex
+		replLag     *common.ReplicationLagEstimator
 	}
 )
 
@@ -369,6 +374,7 @@ type seqNumSnapshot struct {
 	snapshotTime int64
 	beginSeqNum  int64
 	lastSeqNum   int64
+	sizeInBytes  int64
 }
 
 // getAllExtentsSeqNumSnapshot returns a snapshot of seqnums for all currently
@@ -388,6 +394,7 @@ func (xMgr *ExtentManager) getAllExtentsSeqNumSnapshot() map[string]*seqNumSnaps
 			snapshotTime: time.Now().UnixNano(),
 			beginSeqNum:  ext.getBeginSeqNum(),
 			lastSeqNum:   ext.getLastSeqNum(),
+			sizeInBytes:  ext.getSizeInBytes(),
 		}
 		ext.RUnlock()
 	}
@@ -479,6 +486,16 @@ func (ext *extentContext) getLastSeqNum() int64 {
 	return ext.lastSeqNum // should be called with extentLock held
 }
 
+func (ext *extentContext) getSizeInBytes() int64 {
+
+	// should be called with extentLock held
+	if !ext.initialized || ext.deleted || ext.closed || ext.store == nil {
+		return 0
+	}
+
+	return ext.store.ApproximateSize()
+}
+
 // prepareForOpen is called once per "open" for an extent; it calls into
 // 'initialize' the extentContext if it hasn't already been.
 func (ext *extentContext) prepareForOpen(intent OpenIntent) (err error) {
@@ -826,7 +843,7 @@ func (ext *extentContext) Report(reporter common.LoadReporter) {
 		extStatus = shared.ExtentStatus_SEALED
 	}
 
-	reporter.ReportStoreExtentMetric(ext.id.String(), controller.StoreExtentMetrics{
+	metrics := controller.StoreExtentMetrics{
 		NumberOfConnections:     common.Int64Ptr(numberOfConnections),
 		IncomingMessagesCounter: common.Int64Ptr(incomingMsgs / intervalSecs),  // report msgsPerSec
 		IncomingBytesCounter:    common.Int64Ptr(incomingBytes / intervalSecs), // report bytesPerSec
@@ -835,7 +852,33 @@ func (ext *extentContext) Report(reporter common.LoadReporter) {
 		OutgoingBytesCounter:    common.Int64Ptr(outgoingBytes / intervalSecs), // report bytesPerSec
 		ReadMessageLatency:      common.Int64Ptr(readMsgsLatency),
 		ExtentStatus:            &extStatus,
-	})
+	}
+
+	if lag, ok := ext.getReplicationLag(); ok {
+		reporter.ReportReplicatingStoreExtentMetric(ext.id.String(), metrics, lag)
+	} else {
+		reporter.ReportStoreExtentMetric(ext.id.String(), metrics)
+	}
 
 	ext.lastLoadReportedTime = now
 }
+
+// setReplicationLag sets the lag estimator of the replication job
+// writing to the extent, or clears it when the job is done
+func (ext *extentContext) setReplicationLag(replLag *common.ReplicationLagEstimator) {
+	ext.replLagLock.Lock()
+	ext.replLag = replLag
+	ext.replLagLock.Unlock()
+}
+
+// getReplicationLag returns the replication lag of the extent, if it is being replicated
+func (ext *extentContext) getReplicationLag() (common.ReplicationLag, bool) {
+	ext.replLagLock.Lock()
+	replLag := ext.replLag
+	ext.replLagLock.Unlock()
+
+	if replLag == nil {
+		return common.ReplicationLag{}, false
+	}
+	return replLag.Lag(time.Now().UnixNano())
+}
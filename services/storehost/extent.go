@@ -24,6 +24,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/uber/cherami-server/common"
 	"github.com/uber/cherami-server/services/storehost/load"
 	"github.com/uber/cherami-server/storage"
 	"github.com/uber/cherami-thrift/.generated/go/store"
@@ -106,6 +107,10 @@ func (x *ExtentObj) setLastSeqNum(lastSeqNum int64) {
 	x.ext.lastSeqNum = lastSeqNum // should be called with extentLock held
 }
 
+func (x *ExtentObj) setReplicationLag(replLag *common.ReplicationLagEstimator) {
+	x.ext.setReplicationLag(replLag)
+}
+
 func (x *ExtentObj) getSealSeqNum() int64 {
 	return atomic.LoadInt64(&x.ext.sealSeqNum)
 }
@@ -105,9 +105,11 @@ func (monitor *queueMonitor) doReport(extentID string, prevQueueInfo *seqNumSnap
 	if !ok {
 		stats.BeginSequence = common.Int64Ptr(prevQueueInfo.beginSeqNum)
 		stats.LastSequence = common.Int64Ptr(prevQueueInfo.lastSeqNum)
+		stats.SizeInBytes = common.Int64Ptr(prevQueueInfo.sizeInBytes)
 	} else {
 		stats.BeginSequence = common.Int64Ptr(queueInfo.beginSeqNum)
 		stats.LastSequence = common.Int64Ptr(queueInfo.lastSeqNum)
+		stats.SizeInBytes = common.Int64Ptr(queueInfo.sizeInBytes)
 		stats.LastSequenceRate = common.Float64Ptr(common.CalculateRate(
 			common.SequenceNumber(prevQueueInfo.lastSeqNum),
 			common.SequenceNumber(queueInfo.lastSeqNum),
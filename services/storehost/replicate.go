@@ -74,6 +74,7 @@ type (
 
 		cred     CreditLine
 		credC    chan int32
+		lag      *common.ReplicationLagEstimator
 		log      bark.Logger
 		m3Client metrics.Client
 		wg       sync.WaitGroup
@@ -93,6 +94,11 @@ const (
 	defaultCreditsPerHost  = 100000
 )
 
+// sourceSeqNumRefreshInterval is how often a re-replication job reads the
+// last seqnum of its source replica, which the source store updates in
+// metadata once every ReportInterval
+const sourceSeqNumRefreshInterval = time.Minute
+
 const (
 	_ = iota
 
@@ -158,6 +164,7 @@ func (t *ReplicationJob) cleanup() {
 	}
 
 	if t.ext != nil {
+		t.ext.setReplicationLag(nil)
 		t.ext.storeSync() // sync store messages
 		t.ext.Close()     // cleanup/close extent (unlistens automatically)
 		t.ext = nil
@@ -228,6 +235,10 @@ func (t *ReplicationJob) Start() error {
 		}
 	}
 
+	// from now on, the extent reports its replication lag to the controller
+	t.lag = common.NewReplicationLagEstimator(t.ext.getLastSeqNum())
+	t.ext.setReplicationLag(t.lag)
+
 	req := &store.OpenReadStreamRequest{
 		DestinationUUID:   common.StringPtr(t.destID.String()),
 		DestinationType:   cherami.DestinationTypePtr(t.destType),
@@ -494,6 +505,8 @@ pump:
 
 		// update lastSeqNum with this seqnum
 		x.setLastSeqNum(msgSeqNum)
+
+		t.lag.Observe(msgSeqNum, msg.GetMessage().GetEnqueueTimeUtc(), time.Now().UnixNano())
 	}
 
 	close(t.credC) // this should close the sendPump
@@ -514,9 +527,22 @@ func (t *ReplicationJob) sendPump() {
 
 	log := t.log // get "local" logger (that already contains extent info)
 
+	// the source of a re-replication is a store in this zone, so
+	// its progress is known and the lag doesn't have to be guessed
+	var sourceC <-chan time.Time
+	if t.jobType == JobTypeReReplication {
+		t.refreshSourceSeqNum()
+		ticker := time.NewTicker(sourceSeqNumRefreshInterval)
+		defer ticker.Stop()
+		sourceC = ticker.C
+	}
+
 pump:
 	for {
 		select {
+		case <-sourceC:
+			t.refreshSourceSeqNum()
+
 		case cred, ok := <-credC: // read from the go-channel
 
 			if !ok {
@@ -543,6 +569,23 @@ pump:
 	}
 }
 
+// refreshSourceSeqNum feeds the last seqnum the source replica reported
+// to metadata to the lag estimator of the job
+func (t *ReplicationJob) refreshSourceSeqNum() {
+	req := &metadata.ReadStoreExtentReplicaStatsRequest{
+		StoreUUID:  common.StringPtr(t.sourceHostID.String()),
+		ExtentUUID: common.StringPtr(t.extentID.String()),
+	}
+	res, err := t.replMgr.mClient.ReadStoreExtentReplicaStats(nil, req)
+	if err != nil {
+		t.log.WithField(common.TagErr, err).Warn(`replicate: failed to read source replica stats`)
+		return
+	}
+	if stats := res.GetExtent().GetReplicaStats(); len(stats) > 0 {
+		t.lag.ObserveSource(stats[0].GetLastSequence())
+	}
+}
+
 func (t *ReplicationJob) updateReplicationStatus(extentUUID string, status shared.ExtentReplicaReplicationStatus) error {
 	updateRequest := &metadata.UpdateStoreExtentReplicaStatsRequest{
 		ExtentUUID:        common.StringPtr(extentUUID),
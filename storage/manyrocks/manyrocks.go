@@ -688,6 +688,18 @@ func (t *Rock) GetKey(getKeyAddr s.Address) (key s.Key, err error) {
 	return
 }
 
+// ApproximateSize returns the total size of the live SST files of the
+// extent; messages that are still in the memtable are not included. Since
+// purge drops whole SST files, this follows the purges closely.
+func (t *Rock) ApproximateSize() (size int64) {
+
+	for _, file := range t.db.GetLiveFilesMetaData() {
+		size += file.Size
+	}
+
+	return
+}
+
 // Purge deletes all messages whose address is less than or equal
 // to the given address.
 func (t *Rock) Purge(purgeAddr s.Address) (nextAddr s.Address, nextKey s.Key, err error) {
@@ -278,6 +278,16 @@ type ExtentStore interface {
 	//    err: error, if any
 	Purge(endAddr Address) (nextAddr Address, nextKey Key, err error)
 
+	// ApproximateSize returns an estimate of the number of bytes stored
+	// for the extent. Purged messages may be included, until the storage
+	// engine actually reclaims the space.
+	// Args:
+	//    none
+	//
+	// Returns:
+	//    size: the approximate size of the extent, in bytes
+	ApproximateSize() (size int64)
+
 	// DeleteExtent deletes all messages and data associated with the extent
 	// when the extent is closed. In other words, marks this extent for delete
 	// on close.
@@ -0,0 +1,619 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/uber/cherami-server/common"
+	toolscommon "github.com/uber/cherami-server/tools/common"
+	"github.com/uber/cherami-thrift/.generated/go/metadata"
+	"github.com/uber/cherami-thrift/.generated/go/shared"
+)
+
+// The admin operations that are not part of the thrift APIs are
+// served by the controller over http, on its diagnostic port.
+const (
+	controllerPathDestinationAliases = "/admin/destination/aliases"
+	controllerPathDestinationRename  = "/admin/destination/rename"
+	controllerPathDestinationSchema  = "/admin/destination/schema"
+	controllerPathStoreReReplication = "/admin/storehost/rereplication"
+	controllerPathStoreDrain         = "/admin/storehost/drain"
+	controllerPathRebalance          = "/admin/rebalance"
+	controllerPathLeader             = "/admin/leader"
+	controllerPathEvents             = "/admin/events"
+	controllerPathPipeline           = "/admin/pipeline"
+	controllerPathRetention          = "/admin/retention"
+	controllerPathReplicationLag     = "/admin/extent/replicationlag"
+	controllerPathReplicaVerifier    = "/admin/extent/verify"
+)
+
+// controllerAdminCall issues a request against the http admin api of
+// the controller and decodes the json response into result, if any
+func controllerAdminCall(c *cli.Context, method string, path string, params url.Values, result interface{}) error {
+	return toolscommon.ControllerAdminCall(c, adminToolService, method, path, params, result)
+}
+
+type destAliasesJSONOutputFields struct {
+	Path    string   `json:"path"`
+	UUID    string   `json:"uuid"`
+	Aliases []string `json:"aliases"`
+}
+
+// CreateDestinationAlias adds an alias path to a destination
+func CreateDestinationAlias(c *cli.Context) {
+	if len(c.Args()) < 2 {
+		toolscommon.ExitIfError(errors.New("not enough arguments"))
+	}
+
+	params := url.Values{}
+	params.Set("path", c.Args()[0])
+	params.Set("alias", c.Args()[1])
+	toolscommon.ExitIfError(controllerAdminCall(c, "POST", controllerPathDestinationAliases, params, nil))
+}
+
+// DeleteDestinationAlias removes an alias path of a destination
+func DeleteDestinationAlias(c *cli.Context) {
+	if len(c.Args()) < 1 {
+		toolscommon.ExitIfError(errors.New("not enough arguments"))
+	}
+
+	params := url.Values{}
+	params.Set("alias", c.Args().First())
+	toolscommon.ExitIfError(controllerAdminCall(c, "DELETE", controllerPathDestinationAliases, params, nil))
+}
+
+// RenameDestination moves a destination to a new path, the old path remains as an alias
+func RenameDestination(c *cli.Context) {
+	if len(c.Args()) < 2 {
+		toolscommon.ExitIfError(errors.New("not enough arguments"))
+	}
+
+	params := url.Values{}
+	params.Set("path", c.Args()[0])
+	params.Set("newPath", c.Args()[1])
+
+	var desc shared.DestinationDescription
+	toolscommon.ExitIfError(controllerAdminCall(c, "POST", controllerPathDestinationRename, params, &desc))
+
+	output := &destAliasesJSONOutputFields{
+		Path:    desc.GetPath(),
+		UUID:    desc.GetDestinationUUID(),
+		Aliases: []string{c.Args()[0]},
+	}
+	outputStr, _ := json.Marshal(output)
+	fmt.Fprintln(os.Stdout, string(outputStr))
+}
+
+// ReadDestinationAliases prints the aliases of a destination
+func ReadDestinationAliases(c *cli.Context) {
+	if len(c.Args()) < 1 {
+		toolscommon.ExitIfError(errors.New("not enough arguments"))
+	}
+
+	mClient := toolscommon.GetMClient(c, adminToolService)
+	desc, err := mClient.ReadDestination(&metadata.ReadDestinationRequest{
+		Path: common.StringPtr(c.Args().First()),
+	})
+	toolscommon.ExitIfError(err)
+
+	params := url.Values{}
+	params.Set("path", desc.GetPath())
+	output := &destAliasesJSONOutputFields{
+		Path: desc.GetPath(),
+		UUID: desc.GetDestinationUUID(),
+	}
+	toolscommon.ExitIfError(controllerAdminCall(c, "GET", controllerPathDestinationAliases, params, &output.Aliases))
+
+	outputStr, _ := json.Marshal(output)
+	fmt.Fprintln(os.Stdout, string(outputStr))
+}
+
+type destSchemaJSONOutputFields struct {
+	Version     int32  `json:"version"`
+	Type        string `json:"type"`
+	Source      string `json:"source,omitempty"`
+	Schema      string `json:"schema,omitempty"`
+	CreatedTime string `json:"createdTime,omitempty"`
+}
+
+func printDestinationSchema(schema *shared.SchemaInfo) {
+	output := &destSchemaJSONOutputFields{
+		Version: schema.GetVersion(),
+		Type:    schema.GetType(),
+		Source:  schema.GetSource(),
+		Schema:  string(schema.GetData()),
+	}
+	if schema.GetCreatedTimeUtc() > 0 {
+		output.CreatedTime = time.Unix(0, schema.GetCreatedTimeUtc()).Format(time.RFC3339)
+	}
+	outputStr, _ := json.Marshal(output)
+	fmt.Fprintln(os.Stdout, string(outputStr))
+}
+
+// CreateDestinationSchema adds a new version of the schema of a destination
+func CreateDestinationSchema(c *cli.Context) {
+	if len(c.Args()) < 1 {
+		toolscommon.ExitIfError(errors.New("not enough arguments"))
+	}
+
+	params := url.Values{}
+	params.Set("path", c.Args().First())
+	params.Set("type", c.String("type"))
+	params.Set("source", c.String("source"))
+	if file := c.String("file"); len(file) > 0 {
+		data, err := ioutil.ReadFile(file)
+		toolscommon.ExitIfError(err)
+		params.Set("data", string(data))
+	}
+
+	var schema shared.SchemaInfo
+	toolscommon.ExitIfError(controllerAdminCall(c, "POST", controllerPathDestinationSchema, params, &schema))
+	printDestinationSchema(&schema)
+}
+
+// ReadDestinationSchema prints the versions of the schema of a destination
+func ReadDestinationSchema(c *cli.Context) {
+	if len(c.Args()) < 1 {
+		toolscommon.ExitIfError(errors.New("not enough arguments"))
+	}
+
+	params := url.Values{}
+	params.Set("path", c.Args().First())
+	if version := c.Int("version"); version > 0 {
+		params.Set("version", strconv.Itoa(version))
+	}
+
+	var schemas []*shared.SchemaInfo
+	toolscommon.ExitIfError(controllerAdminCall(c, "GET", controllerPathDestinationSchema, params, &schemas))
+	for _, schema := range schemas {
+		printDestinationSchema(schema)
+	}
+}
+
+type reReplicationJSONOutputFields struct {
+	DstUUID         string    `json:"destinationUUID"`
+	ExtentUUID      string    `json:"extentUUID"`
+	FailedStoreUUID string    `json:"failedStoreUUID"`
+	NewStoreUUID    string    `json:"newStoreUUID,omitempty"`
+	State           string    `json:"state"`
+	Attempts        int       `json:"attempts"`
+	StartTime       time.Time `json:"startTime"`
+}
+
+type reReplicationSummaryJSONOutputFields struct {
+	InProgress int   `json:"inProgress"`
+	Completed  int64 `json:"completed"`
+	Failed     int64 `json:"failed"`
+}
+
+// ReadStoreReReplication prints the extents whose replica on a lost
+// store host is being re-replicated, followed by a summary line
+func ReadStoreReReplication(c *cli.Context) {
+	var report struct {
+		InProgress []*reReplicationJSONOutputFields `json:"inProgress"`
+		Completed  int64                            `json:"completed"`
+		Failed     int64                            `json:"failed"`
+	}
+	toolscommon.ExitIfError(controllerAdminCall(c, "GET", controllerPathStoreReReplication, url.Values{}, &report))
+
+	for _, status := range report.InProgress {
+		outputStr, _ := json.Marshal(status)
+		fmt.Fprintln(os.Stdout, string(outputStr))
+	}
+
+	summary := &reReplicationSummaryJSONOutputFields{
+		InProgress: len(report.InProgress),
+		Completed:  report.Completed,
+		Failed:     report.Failed,
+	}
+	outputStr, _ := json.Marshal(summary)
+	fmt.Fprintln(os.Stdout, string(outputStr))
+}
+
+type storeDrainJSONOutputFields struct {
+	StoreUUID       string `json:"storeUUID"`
+	Draining        bool   `json:"draining"`
+	OpenExtents     int    `json:"openExtents"`
+	SealedExtents   int    `json:"sealedExtents"`
+	ConsumedExtents int    `json:"consumedExtents"`
+	ReReplicating   int    `json:"reReplicating"`
+	Drained         bool   `json:"drained"`
+}
+
+// DrainStoreHost starts draining a store host, or shows the progress
+// of the drain, or stops it. The store host can be removed once the
+// drain reports it as drained.
+func DrainStoreHost(c *cli.Context) {
+	if len(c.Args()) < 1 {
+		toolscommon.ExitIfError(errors.New("not enough arguments"))
+	}
+
+	method := "POST"
+	if c.String("cancel") == "true" {
+		method = "DELETE"
+	} else if c.String("status") == "true" {
+		method = "GET"
+	}
+
+	params := url.Values{}
+	params.Set("uuid", c.Args().First())
+
+	var output storeDrainJSONOutputFields
+	toolscommon.ExitIfError(controllerAdminCall(c, method, controllerPathStoreDrain, params, &output))
+
+	outputStr, _ := json.Marshal(&output)
+	fmt.Fprintln(os.Stdout, string(outputStr))
+}
+
+type rebalanceMoveJSONOutputFields struct {
+	Type     string `json:"type"`
+	DstUUID  string `json:"destinationUUID"`
+	UUID     string `json:"uuid"`
+	FromHost string `json:"fromHost"`
+	ToHost   string `json:"toHost,omitempty"`
+	Load     int64  `json:"load"`
+	Done     bool   `json:"done"`
+}
+
+type rebalanceSummaryJSONOutputFields struct {
+	Mode      string    `json:"mode"`
+	StartTime time.Time `json:"startTime"`
+	Moves     int       `json:"moves"`
+}
+
+// ReadRebalance prints the moves planned by the last rebalancing
+// round of the controller, followed by a summary line
+func ReadRebalance(c *cli.Context) {
+	var report struct {
+		Mode      string                           `json:"mode"`
+		StartTime time.Time                        `json:"startTime"`
+		Moves     []*rebalanceMoveJSONOutputFields `json:"moves"`
+	}
+	toolscommon.ExitIfError(controllerAdminCall(c, "GET", controllerPathRebalance, url.Values{}, &report))
+
+	for _, move := range report.Moves {
+		outputStr, _ := json.Marshal(move)
+		fmt.Fprintln(os.Stdout, string(outputStr))
+	}
+
+	summary := &rebalanceSummaryJSONOutputFields{
+		Mode:      report.Mode,
+		StartTime: report.StartTime,
+		Moves:     len(report.Moves),
+	}
+	outputStr, _ := json.Marshal(summary)
+	fmt.Fprintln(os.Stdout, string(outputStr))
+}
+
+type leadershipJSONOutputFields struct {
+	Name        string    `json:"name"`
+	Backend     string    `json:"backend"`
+	Leader      string    `json:"leader"`
+	IsLeader    bool      `json:"isLeader"`
+	LeaderSince time.Time `json:"leaderSince"`
+	Transitions int64     `json:"transitions"`
+}
+
+// ReadLeader prints the controller that runs each of the
+// background loops, as seen by the given controller
+func ReadLeader(c *cli.Context) {
+	var leases []*leadershipJSONOutputFields
+	toolscommon.ExitIfError(controllerAdminCall(c, "GET", controllerPathLeader, url.Values{}, &leases))
+
+	for _, lease := range leases {
+		outputStr, _ := json.Marshal(lease)
+		fmt.Fprintln(os.Stdout, string(outputStr))
+	}
+}
+
+type journalEventJSONOutputFields struct {
+	UUID        string    `json:"uuid"`
+	Type        string    `json:"type"`
+	Payload     string    `json:"payload"`
+	Owner       string    `json:"owner"`
+	State       string    `json:"state"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"lastError,omitempty"`
+	CreatedTime time.Time `json:"createdTime"`
+	UpdatedTime time.Time `json:"updatedTime"`
+}
+
+// ReadEvents prints the events in the controller event journal
+func ReadEvents(c *cli.Context) {
+	var events []*journalEventJSONOutputFields
+	toolscommon.ExitIfError(controllerAdminCall(c, "GET", controllerPathEvents, url.Values{}, &events))
+
+	for _, event := range events {
+		outputStr, _ := json.Marshal(event)
+		fmt.Fprintln(os.Stdout, string(outputStr))
+	}
+}
+
+// CancelEvent removes a stuck event from the controller event
+// journal and prints the events that are left
+func CancelEvent(c *cli.Context) {
+	if len(c.Args()) < 1 {
+		toolscommon.ExitIfError(errors.New("not enough arguments"))
+	}
+
+	params := url.Values{}
+	params.Set("uuid", c.Args().First())
+
+	var events []*journalEventJSONOutputFields
+	toolscommon.ExitIfError(controllerAdminCall(c, "DELETE", controllerPathEvents, params, &events))
+
+	for _, event := range events {
+		outputStr, _ := json.Marshal(event)
+		fmt.Fprintln(os.Stdout, string(outputStr))
+	}
+}
+
+type pipelineSummaryJSONOutputFields struct {
+	QueueDepth     int            `json:"queueDepth"`
+	QueueCapacity  int            `json:"queueCapacity"`
+	RetryWorkers   int            `json:"retryWorkers"`
+	QueuedByType   map[string]int `json:"queuedByType"`
+	RetryingByType map[string]int `json:"retryingByType"`
+	InFlight       int            `json:"inFlight"`
+	LocksHeld      int            `json:"locksHeld"`
+}
+
+type inFlightEventJSONOutputFields struct {
+	ID          int64     `json:"id"`
+	Type        string    `json:"type"`
+	Stage       string    `json:"stage"`
+	Attempts    int       `json:"attempts"`
+	AddedTime   time.Time `json:"addedTime"`
+	AgeSecs     int64     `json:"ageSecs"`
+	LastAttempt time.Time `json:"lastAttempt"`
+}
+
+type lockJSONOutputFields struct {
+	Key      string `json:"key"`
+	Locked   bool   `json:"locked"`
+	HeldSecs int64  `json:"heldSecs"`
+	Waiting  int    `json:"waiting"`
+	WaitSecs int64  `json:"waitSecs"`
+}
+
+// ReadController prints the in-flight events of the controller
+// event pipeline and the locks held by the controller, followed
+// by a summary of the queue depths
+func ReadController(c *cli.Context) {
+	var status struct {
+		pipelineSummaryJSONOutputFields
+		Events []*inFlightEventJSONOutputFields `json:"events"`
+		Locks  []*lockJSONOutputFields          `json:"locks"`
+	}
+	toolscommon.ExitIfError(controllerAdminCall(c, "GET", controllerPathPipeline, url.Values{}, &status))
+
+	for _, event := range status.Events {
+		outputStr, _ := json.Marshal(event)
+		fmt.Fprintln(os.Stdout, string(outputStr))
+	}
+	for _, lock := range status.Locks {
+		outputStr, _ := json.Marshal(lock)
+		fmt.Fprintln(os.Stdout, string(outputStr))
+	}
+
+	summary := status.pipelineSummaryJSONOutputFields
+	summary.InFlight = len(status.Events)
+	summary.LocksHeld = len(status.Locks)
+	outputStr, _ := json.Marshal(&summary)
+	fmt.Fprintln(os.Stdout, string(outputStr))
+}
+
+type extentRetentionJSONOutputFields struct {
+	DestinationUUID               string                           `json:"destinationUUID"`
+	ExtentUUID                    string                           `json:"extentUUID"`
+	Status                        string                           `json:"status"`
+	HardRetentionAddr             int64                            `json:"hardRetentionAddr"`
+	SoftRetentionAddr             int64                            `json:"softRetentionAddr"`
+	MinAckAddr                    int64                            `json:"minAckAddr"`
+	MinAckConsumerGroupUUID       string                           `json:"minAckConsumerGroupUUID,omitempty"`
+	RetentionAddr                 int64                            `json:"retentionAddr"`
+	SizeRetention                 bool                             `json:"sizeRetention"`
+	ForcedPurgeConsumerGroupUUIDs []string                         `json:"forcedPurgeConsumerGroupUUIDs,omitempty"`
+	ExcludedConsumerGroupUUIDs    []string                         `json:"excludedConsumerGroupUUIDs,omitempty"`
+	ProtectedByConsumerGroupUUID  string                           `json:"protectedByConsumerGroupUUID,omitempty"`
+	Decision                      string                           `json:"decision"`
+	DryRun                        bool                             `json:"dryRun"`
+	Time                          time.Time                        `json:"time"`
+	Error                         string                           `json:"error,omitempty"`
+	Last                          *extentRetentionJSONOutputFields `json:"last,omitempty"`
+}
+
+// ReadRetention prints, for each extent of a destination, the retention
+// addresses, the consumer group holding back the min ack address and the
+// decision the retention manager would take, along with the last one it took
+func ReadRetention(c *cli.Context) {
+	if len(c.Args()) < 1 {
+		toolscommon.ExitIfError(errors.New("not enough arguments"))
+	}
+
+	params := url.Values{}
+	if common.UUIDRegex.MatchString(c.Args().First()) {
+		params.Set("uuid", c.Args().First())
+	} else {
+		params.Set("path", c.Args().First())
+	}
+
+	var extents []*extentRetentionJSONOutputFields
+	toolscommon.ExitIfError(controllerAdminCall(c, "GET", controllerPathRetention, params, &extents))
+
+	for _, extent := range extents {
+		outputStr, _ := json.Marshal(extent)
+		fmt.Fprintln(os.Stdout, string(outputStr))
+	}
+}
+
+// UpdateConsumerGroupRetention sets the retention override of a consumer
+// group: --protect keeps the messages it has not acked, even past hard
+// retention; --exclude_after_inactive_days leaves it out of the soft
+// retention once it has not acked anything for that many days
+func UpdateConsumerGroupRetention(c *cli.Context) {
+	var cgUUID string
+	switch len(c.Args()) {
+	case 1:
+		cgUUID = c.Args().First()
+	case 2:
+		mClient := toolscommon.GetMClient(c, adminToolService)
+		cgDesc, err := mClient.ReadConsumerGroup(&metadata.ReadConsumerGroupRequest{
+			DestinationPath:   common.StringPtr(c.Args()[0]),
+			ConsumerGroupName: common.StringPtr(c.Args()[1]),
+		})
+		toolscommon.ExitIfError(err)
+		cgUUID = cgDesc.GetConsumerGroupUUID()
+	default:
+		toolscommon.ExitIfError(errors.New("Incorrect consumer group specification. Use \"<cg_uuid>\" or \"<dest_path> <cg_name>\""))
+	}
+
+	if !c.IsSet("protect") && !c.IsSet("exclude_after_inactive_days") {
+		toolscommon.ExitIfError(errors.New("either protect or exclude_after_inactive_days must be set"))
+	}
+
+	params := url.Values{}
+	params.Set("uuid", cgUUID)
+	params.Set("protect", strconv.FormatBool(c.Bool("protect")))
+	params.Set("inactiveDays", strconv.Itoa(c.Int("exclude_after_inactive_days")))
+
+	output := &toolscommon.CGRetentionJSONOutputFields{}
+	toolscommon.ExitIfError(controllerAdminCall(c, "POST", toolscommon.ControllerPathConsumerGroupRetention, params, output))
+
+	outputStr, _ := json.Marshal(output)
+	fmt.Fprintln(os.Stdout, string(outputStr))
+}
+
+// replicaReplicationLag is the replication lag of an extent replica,
+// as returned by /admin/extent/replicationlag
+type replicaReplicationLag struct {
+	StoreUUID string `json:"storeUUID"`
+	Zone      string `json:"zone"`
+	Messages  int64  `json:"lagMsgs"`
+	Seconds   int64  `json:"lagSecs"`
+}
+
+// readExtentReplicationLag returns the replication lag of the replicas of
+// an extent by store uuid. The lag is only known to the controller, so this
+// returns nothing when no controller is given or when it can't be reached.
+func readExtentReplicationLag(c *cli.Context, extUUID string) map[string]*replicaReplicationLag {
+	if len(c.GlobalString("controller_hostport")) == 0 {
+		return nil
+	}
+
+	params := url.Values{}
+	params.Set("uuid", extUUID)
+
+	var replicas []*replicaReplicationLag
+	if err := controllerAdminCall(c, "GET", controllerPathReplicationLag, params, &replicas); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read the replication lag: %v\n", err)
+		return nil
+	}
+
+	result := make(map[string]*replicaReplicationLag, len(replicas))
+	for _, replica := range replicas {
+		result[replica.StoreUUID] = replica
+	}
+	return result
+}
+
+type extentVerificationJSONOutputFields struct {
+	DstUUID       string   `json:"destinationUUID"`
+	ExtentUUID    string   `json:"extentUUID"`
+	Replicas      []string `json:"replicas"`
+	Messages      int64    `json:"messages"`
+	Consistent    bool     `json:"consistent"`
+	DivergedAfter int64    `json:"divergedAfter,omitempty"`
+	Divergent     []string `json:"divergent,omitempty"`
+	Inconclusive  string   `json:"inconclusive,omitempty"`
+	Repairing     bool     `json:"repairing"`
+}
+
+type replicaVerifierSummaryJSONOutputFields struct {
+	Mode         string    `json:"mode"`
+	StartTime    time.Time `json:"startTime"`
+	Extents      int       `json:"extents"`
+	Divergent    int       `json:"divergent"`
+	Inconclusive int       `json:"inconclusive"`
+}
+
+// VerifyExtent compares the messages held by the replicas of a sealed
+// extent, and with --repair replaces a replica that differs from the
+// majority of the replicas by a copy of a healthy one
+func VerifyExtent(c *cli.Context) {
+	if len(c.Args()) < 1 {
+		toolscommon.ExitIfError(errors.New("not enough arguments"))
+	}
+
+	method := "GET"
+	if c.String("repair") == "true" {
+		method = "POST"
+	}
+
+	params := url.Values{}
+	params.Set("uuid", c.Args().First())
+	params.Set("maxMsgs", strconv.Itoa(c.Int("max_msgs")))
+
+	var output extentVerificationJSONOutputFields
+	toolscommon.ExitIfError(controllerAdminCall(c, method, controllerPathReplicaVerifier, params, &output))
+
+	outputStr, _ := json.Marshal(&output)
+	fmt.Fprintln(os.Stdout, string(outputStr))
+}
+
+// ReadReplicaVerifier prints the extents compared by the last round
+// of the replica verifier of the controller, followed by a summary line
+func ReadReplicaVerifier(c *cli.Context) {
+	var report struct {
+		Mode      string                                `json:"mode"`
+		StartTime time.Time                             `json:"startTime"`
+		Extents   []*extentVerificationJSONOutputFields `json:"extents"`
+	}
+	toolscommon.ExitIfError(controllerAdminCall(c, "GET", controllerPathReplicaVerifier, url.Values{}, &report))
+
+	summary := &replicaVerifierSummaryJSONOutputFields{
+		Mode:      report.Mode,
+		StartTime: report.StartTime,
+		Extents:   len(report.Extents),
+	}
+
+	for _, extent := range report.Extents {
+		outputStr, _ := json.Marshal(extent)
+		fmt.Fprintln(os.Stdout, string(outputStr))
+		if len(extent.Inconclusive) > 0 {
+			summary.Inconclusive++
+		} else if !extent.Consistent {
+			summary.Divergent++
+		}
+	}
+
+	outputStr, _ := json.Marshal(summary)
+	fmt.Fprintln(os.Stdout, string(outputStr))
+}
@@ -71,6 +71,10 @@ func UpdateConsumerGroup(c *cli.Context) {
 func ReadDestination(c *cli.Context) {
 	mClient := toolscommon.GetMClient(c, adminToolService)
 	toolscommon.ReadDestination(c, mClient)
+
+	if string(c.String("showaliases")) == "true" {
+		ReadDestinationAliases(c)
+	}
 }
 
 // ReadDlq read Dlq properties
@@ -94,7 +98,7 @@ func DeleteConsumerGroup(c *cli.Context) {
 // ReadConsumerGroup reads properties of a consumer group
 func ReadConsumerGroup(c *cli.Context) {
 	mClient := toolscommon.GetMClient(c, adminToolService)
-	toolscommon.ReadConsumerGroup(c, mClient)
+	toolscommon.ReadConsumerGroup(c, mClient, adminToolService)
 }
 
 // ReadMessage read a message from store directly
@@ -206,6 +210,8 @@ type replicaExtentJSONOutputFields struct {
 	LastSequence      int64   `json:"last_sequence"`
 	SizeInBytes       int64   `json:"size_in_byes"`
 	SizeInBytesRate   float64 `json:"size_in_bytes_rate"`
+	ReplicationLagMsg int64   `json:"replication_lag_msgs,omitempty"`
+	ReplicationLagSec int64   `json:"replication_lag_secs,omitempty"`
 }
 
 // ReadStoreHost reads the store host metadata from metastore
@@ -360,6 +366,7 @@ func ReadExtent(c *cli.Context) {
 		inputHostAddr = extent.GetInputHostUUID() + toolscommon.UnknownUUID
 	}
 	replicaExtents := []*replicaExtentJSONOutputFields{}
+	replicationLag := readExtentReplicationLag(c, uuidStr)
 	if len(extReplicas) > 0 {
 		// updata the begin seq, last seq in extent replicas
 		for _, extReplica := range extReplicas {
@@ -378,6 +385,10 @@ func ReadExtent(c *cli.Context) {
 				SizeInBytes:       extReplica.GetSizeInBytes(),
 				SizeInBytesRate:   extReplica.GetSizeInBytesRate(),
 			}
+			if lag, ok := replicationLag[extReplica.GetStoreUUID()]; ok {
+				replicaJSON.ReplicationLagMsg = lag.Messages
+				replicaJSON.ReplicationLagSec = lag.Seconds
+			}
 			replicaExtents = append(replicaExtents, replicaJSON)
 		}
 	}
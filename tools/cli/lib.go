@@ -87,7 +87,7 @@ func DeleteConsumerGroup(c *cli.Context) {
 // ReadConsumerGroup gets info about the CG
 func ReadConsumerGroup(c *cli.Context) {
 	mClient := common.GetMClient(c, serviceName)
-	common.ReadConsumerGroup(c, mClient)
+	common.ReadConsumerGroup(c, mClient, serviceName)
 }
 
 // ReadMessage is used to read a message
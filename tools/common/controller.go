@@ -0,0 +1,101 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/uber/cherami-server/common"
+)
+
+// ControllerPathConsumerGroupRetention is the http admin endpoint of
+// the controller for the retention overrides of consumer groups
+const ControllerPathConsumerGroupRetention = "/admin/consumergroup/retention"
+
+const strNoControllerHostPort = "controller_hostport must be set for this command"
+
+// CGRetentionJSONOutputFields is the retention override of a consumer group
+type CGRetentionJSONOutputFields struct {
+	Protect                  bool      `json:"protect"`
+	ExcludeAfterInactiveDays int64     `json:"excludeAfterInactiveDays,omitempty"`
+	LastAckTime              time.Time `json:"lastAckTime"`
+}
+
+// ControllerAdminCall issues a request against the http admin api of
+// the controller and decodes the json response into result, if any
+func ControllerAdminCall(c *cli.Context, serviceName string, method string, path string, params url.Values, result interface{}) error {
+	hostPort := c.GlobalString("controller_hostport")
+	if len(hostPort) == 0 {
+		return errors.New(strNoControllerHostPort)
+	}
+
+	u := url.URL{Scheme: "http", Host: hostPort, Path: path, RawQuery: params.Encode()}
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	// caller info for the user operations log
+	req.Header.Set(common.CallerServiceName, serviceName)
+	req.Header.Set(common.CallerUserName, os.Getenv("USER"))
+	if hostName, e := os.Hostname(); e == nil {
+		req.Header.Set(common.CallerHostName, hostName)
+	}
+
+	client := &http.Client{Timeout: time.Duration(c.GlobalInt("timeout")) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%v: %v", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// ReadConsumerGroupRetention returns the retention override of a
+// consumer group, through the http admin api of the controller
+func ReadConsumerGroupRetention(c *cli.Context, serviceName string, cgUUID string) (*CGRetentionJSONOutputFields, error) {
+	params := url.Values{}
+	params.Set("uuid", cgUUID)
+
+	output := &CGRetentionJSONOutputFields{}
+	if err := ControllerAdminCall(c, serviceName, "GET", ControllerPathConsumerGroupRetention, params, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
@@ -481,7 +481,7 @@ func ReadDestination(c *cli.Context, mClient mcli.Client) {
 		}
 		// print out all the consumer groups for this destination
 		for _, cg := range cgsInfo {
-			printCG(cg)
+			printCG(cg, nil)
 		}
 	}
 }
@@ -511,7 +511,7 @@ func ReadDlq(c *cli.Context, mClient mcli.Client) {
 
 	resp, err := mClient.ReadConsumerGroupByUUID(req)
 	ExitIfError(err)
-	printCG(resp)
+	printCG(resp, nil)
 }
 
 // ReadCgBacklog reads the CG back log
@@ -566,19 +566,20 @@ func DeleteConsumerGroup(c *cli.Context, cClient ccli.Client) {
 }
 
 type cgJSONOutputFields struct {
-	CGName                   string                     `json:"consumer_group_name"`
-	DestUUID                 string                     `json:"destination_uuid"`
-	CGUUID                   string                     `json:"consumer_group_uuid"`
-	Status                   shared.ConsumerGroupStatus `json:"consumer_group_status"`
-	StartFrom                int64                      `json:"startFrom"`
-	LockTimeoutSeconds       int32                      `json:"lock_timeout_seconds"`
-	MaxDeliveryCount         int32                      `json:"max_delivery_count"`
-	SkipOlderMessagesSeconds int32                      `json:"skip_older_msg_seconds"`
-	CGEmail                  string                     `json:"owner_email"`
-	CGDlq                    string                     `json:"dlqUUID"`
+	CGName                   string                       `json:"consumer_group_name"`
+	DestUUID                 string                       `json:"destination_uuid"`
+	CGUUID                   string                       `json:"consumer_group_uuid"`
+	Status                   shared.ConsumerGroupStatus   `json:"consumer_group_status"`
+	StartFrom                int64                        `json:"startFrom"`
+	LockTimeoutSeconds       int32                        `json:"lock_timeout_seconds"`
+	MaxDeliveryCount         int32                        `json:"max_delivery_count"`
+	SkipOlderMessagesSeconds int32                        `json:"skip_older_msg_seconds"`
+	CGEmail                  string                       `json:"owner_email"`
+	CGDlq                    string                       `json:"dlqUUID"`
+	Retention                *CGRetentionJSONOutputFields `json:"retention,omitempty"`
 }
 
-func printCG(cg *shared.ConsumerGroupDescription) {
+func printCG(cg *shared.ConsumerGroupDescription, retention *CGRetentionJSONOutputFields) {
 	output := &cgJSONOutputFields{
 		CGName:                   cg.GetConsumerGroupName(),
 		DestUUID:                 cg.GetDestinationUUID(),
@@ -589,38 +590,45 @@ func printCG(cg *shared.ConsumerGroupDescription) {
 		MaxDeliveryCount:         cg.GetMaxDeliveryCount(),
 		SkipOlderMessagesSeconds: cg.GetSkipOlderMessagesSeconds(),
 		CGEmail:                  cg.GetOwnerEmail(),
-		CGDlq:                    cg.GetDeadLetterQueueDestinationUUID()}
+		CGDlq:                    cg.GetDeadLetterQueueDestinationUUID(),
+		Retention:                retention}
 	outputStr, _ := json.Marshal(output)
 	fmt.Fprintln(os.Stdout, string(outputStr))
 }
 
-// ReadConsumerGroup return the consumer group information
-func ReadConsumerGroup(c *cli.Context, mClient mcli.Client) {
+// ReadConsumerGroup return the consumer group information, along with
+// its retention override when the controller_hostport is set
+func ReadConsumerGroup(c *cli.Context, mClient mcli.Client, serviceName string) {
 	if len(c.Args()) < 1 {
 		ExitIfError(errors.New(strCGSpecIncorrectArgs))
 	}
 
+	var cgDesc *shared.ConsumerGroupDescription
+	var err error
+
 	if len(c.Args()) == 2 {
 		path := c.Args()[0]
 		name := c.Args()[1]
 
-		cgDesc, err := mClient.ReadConsumerGroup(&metadata.ReadConsumerGroupRequest{
+		cgDesc, err = mClient.ReadConsumerGroup(&metadata.ReadConsumerGroupRequest{
 			DestinationPath:   &path,
 			ConsumerGroupName: &name,
 		})
-
-		ExitIfError(err)
-		printCG(cgDesc)
-		return
-	}
-	if len(c.Args()) == 1 {
+	} else {
 		cgUUID := c.Args()[0]
 
-		cgDesc, err := mClient.ReadConsumerGroupByUUID(&metadata.ReadConsumerGroupRequest{
+		cgDesc, err = mClient.ReadConsumerGroupByUUID(&metadata.ReadConsumerGroupRequest{
 			ConsumerGroupUUID: common.StringPtr(cgUUID)})
+	}
+	ExitIfError(err)
+
+	var retention *CGRetentionJSONOutputFields
+	if len(c.GlobalString("controller_hostport")) > 0 {
+		retention, err = ReadConsumerGroupRetention(c, serviceName, cgDesc.GetConsumerGroupUUID())
 		ExitIfError(err)
-		printCG(cgDesc)
 	}
+
+	printCG(cgDesc, retention)
 }
 
 // MergeDLQForConsumerGroup return the consumer group information